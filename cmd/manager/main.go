@@ -17,15 +17,28 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/cloudfeatures"
+	"github.com/openshift/machine-api-provider-openstack/pkg/credentials"
+	"github.com/openshift/machine-api-provider-openstack/pkg/export"
+	providerfeatures "github.com/openshift/machine-api-provider-openstack/pkg/features"
+	"github.com/openshift/machine-api-provider-openstack/pkg/inventory"
 	"github.com/openshift/machine-api-provider-openstack/pkg/machine"
 	"github.com/openshift/machine-api-provider-openstack/pkg/machineset"
+	"github.com/openshift/machine-api-provider-openstack/pkg/metricsauth"
+	"github.com/openshift/machine-api-provider-openstack/pkg/preflight"
+	"github.com/openshift/machine-api-provider-openstack/pkg/topology"
+	"github.com/openshift/machine-api-provider-openstack/pkg/webhooks"
 	"github.com/openshift/machine-api-provider-openstack/version"
 
 	configv1 "github.com/openshift/api/config/v1"
@@ -36,19 +49,25 @@ import (
 	"github.com/openshift/library-go/pkg/features"
 	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/component-base/featuregate"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	cache "sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	rTcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 // The default durations for the leader election operations.
@@ -84,6 +103,12 @@ func main() {
 		"Start a leader election client and gain leadership before executing the main loop. Enable this when running replicated components for high availability.",
 	)
 
+	leaderElectID := flag.String(
+		"leader-elect-id",
+		"cluster-api-provider-openstack-leader",
+		"The name of the resource object that is used for locking during leader election. Change this to run a second instance of the controller, which must manage a disjoint set of machine-api objects, side by side with the first.",
+	)
+
 	leaderElectLeaseDuration := flag.Duration(
 		"leader-elect-lease-duration",
 		leaseDuration,
@@ -95,6 +120,144 @@ func main() {
 		"Address for hosting metrics",
 	)
 
+	metricsSecure := flag.Bool(
+		"metrics-secure",
+		false,
+		"Serve the metrics endpoint over HTTPS, with the tls.crt and tls.key of --metrics-cert-dir, reloaded when they change, or else a self-signed certificate.",
+	)
+
+	metricsCertDir := flag.String(
+		"metrics-cert-dir",
+		"",
+		"Directory with the tls.crt and tls.key served by the metrics endpoint with --metrics-secure.",
+	)
+
+	metricsClientCAFile := flag.String(
+		"metrics-client-ca-file",
+		"",
+		"File with the PEM encoded CAs which verify the client certificates presented to the metrics endpoint. Needs --metrics-secure.",
+	)
+
+	metricsAuth := flag.Bool(
+		"metrics-auth",
+		false,
+		"Require requests to the metrics endpoint to authenticate with a client certificate verified by --metrics-client-ca-file or a bearer token accepted by a TokenReview, and to be allowed the verb of the request on its path, e.g. get /metrics, by a SubjectAccessReview. Needs --metrics-secure.",
+	)
+
+	debugAddress := flag.String(
+		"debug-bind-address",
+		"",
+		"Loopback address, e.g. 127.0.0.1:6060, on which the pprof and trace endpoints are served under /debug/pprof/ for capturing CPU and heap profiles. Unset to disable them.",
+	)
+
+	openstackAPITimeout := flag.Duration(
+		"openstack-api-timeout",
+		clients.DefaultAPITimeout,
+		"How long a request to an OpenStack API may take, including reading its response, before it fails, so that a hung endpoint can't block a reconcile indefinitely. Set to 0 to disable the timeout.",
+	)
+
+	openstackAPIRetries := flag.Int(
+		"openstack-api-retries",
+		clients.DefaultAPIRetries,
+		"How often a request to an OpenStack API is retried, with jittered exponential backoff, after a transient error such as a 429, a 5xx or a dropped connection, before the error is returned. Set to 0 to disable the retries.",
+	)
+
+	instanceDeleteTimeout := flag.Duration(
+		"instance-delete-timeout",
+		machine.DefaultInstanceDeleteTimeout,
+		"How long to wait for an instance whose deletion is in progress, e.g. a bare metal instance being deprovisioned, before requesting its deletion again.",
+	)
+
+	portCreateConflictRetries := flag.Int(
+		"port-create-conflict-retries",
+		0,
+		"How often the creation of a port is retried, with jittered backoff, after Neutron reports a conflict, e.g. during large scale-outs. Set to 0 to disable the retries.",
+	)
+
+	zoneCreateFailureThreshold := flag.Int(
+		"zone-create-failure-threshold",
+		0,
+		"How many creations of machines in an availability zone must fail within --zone-create-failure-window, with none succeeding since, for an outage of the zone to be suspected and reported in an event on the cluster Infrastructure. Set to 0 to disable the tracking.",
+	)
+
+	zoneCreateFailureWindow := flag.Duration(
+		"zone-create-failure-window",
+		machine.DefaultZoneCreateFailureWindow,
+		"How long a failed creation of a machine counts towards --zone-create-failure-threshold.",
+	)
+
+	zoneCreateFailurePolicy := flag.String(
+		"zone-create-failure-policy",
+		machine.ZoneCreateFailurePolicyWarn,
+		"What to do about an availability zone whose outage is suspected: Warn only reports it, Block also delays the creation of machines in the zone until its failures are older than --zone-create-failure-window.",
+	)
+
+	instanceStateAnnotation := flag.Bool(
+		"instance-state-annotation",
+		true,
+		"Write the state of the instance of each machine to the legacy machine.openshift.io/instance-state annotation, as well as to the InstanceReady condition. Set to false to only write the condition and remove the annotation.",
+	)
+
+	capoCoexistence := flag.Bool(
+		"capo-coexistence",
+		false,
+		"Only adopt OpenStack servers by name which are marked as owned by their machine, with the machine UID tag or server metadata, so that servers created by CAPI/CAPO in the same project are never touched. Servers of the providerID of machines which aren't marked yet are marked.",
+	)
+
+	credentialsCheckInterval := flag.Duration(
+		"credentials-check-interval",
+		credentials.DefaultInterval,
+		"How often the OpenStack credentials used by each MachineSet are checked. Set to 0 to disable the check.",
+	)
+
+	credentialsRequiredRoles := flag.String(
+		"credentials-required-roles",
+		"",
+		"Comma-separated list of roles which a token issued for the OpenStack credentials used by a MachineSet must have.",
+	)
+
+	instanceInventoryInterval := flag.Duration(
+		"instance-inventory-interval",
+		inventory.DefaultInterval,
+		"How often machines are compared with the OpenStack servers tagged with their cluster. Set to 0 to disable the comparison.",
+	)
+
+	availabilityZoneDiscoveryInterval := flag.Duration(
+		"availability-zone-discovery-interval",
+		topology.DefaultInterval,
+		"How often the availability zones of the cloud of each MachineSet are discovered and written to the openstack-availability-zones ConfigMap. Set to 0 to disable the discovery.",
+	)
+
+	cloudFeatureCheckInterval := flag.Duration(
+		"cloud-feature-check-interval",
+		cloudfeatures.DefaultInterval,
+		"How often the cloud of each MachineSet is checked for the features used by its machines, and the result written to the openstack-cloud-features ConfigMap. Set to 0 to disable the check.",
+	)
+
+	webhookPort := flag.Int(
+		"webhook-port",
+		0,
+		"Port on which the admission webhooks defaulting and validating the providerSpecs of Machines and MachineSets are served, with the tls.crt and tls.key of --webhook-cert-dir. Set to 0 to disable the webhooks.",
+	)
+
+	webhookCertDir := flag.String(
+		"webhook-cert-dir",
+		"",
+		"Directory with the tls.crt and tls.key served by the admission webhooks.",
+	)
+
+	preflightCheck := flag.Bool(
+		"preflight",
+		false,
+		"Check that the credentials of the cloud of each MachineSet are allowed to make a read-only call to every OpenStack API which the provider needs, report the result and exit. The exit status is 1 if any check fails.",
+	)
+
+	exportCAPO := flag.Bool(
+		"export-capo",
+		false,
+		"Write the MachineSets and Machines as the equivalent CAPO OpenStackMachineTemplates and OpenStackMachines to stdout and exit, to help plan the migration to Cluster API. What can't be converted is described by comments.",
+	)
+
 	showVersion := flag.Bool(
 		"version",
 		false,
@@ -107,6 +270,9 @@ func main() {
 	if err != nil {
 		klog.Fatalf("Error setting up feature gates: %v", err)
 	}
+	if err := providerfeatures.Add(defaultMutableGate); err != nil {
+		klog.Fatalf("Error setting up provider feature gates: %v", err)
+	}
 
 	// Add the --feature-gates flag
 	gateOpts.AddFlagsToGoFlagSet(nil)
@@ -114,8 +280,24 @@ func main() {
 	klog.InitFlags(nil)
 	flag.Parse()
 
+	clients.SetAPITimeout(*openstackAPITimeout)
+	clients.SetAPIRetries(*openstackAPIRetries)
+
+	// Sets feature gates from flags
+	klog.Infof("Initializing feature gates: %s", strings.Join(defaultMutableGate.KnownFeatures(), ", "))
+	warnings, err := gateOpts.ApplyTo(defaultMutableGate)
+	if err != nil {
+		klog.Fatalf("Error setting feature gates from flags: %v", err)
+	}
+	if len(warnings) > 0 {
+		klog.Infof("Warnings setting feature gates from flags: %v", warnings)
+	}
+
+	klog.Infof("FeatureGateMachineAPIMigration initialised: %t", defaultMutableGate.Enabled(featuregate.Feature(apifeatures.FeatureGateMachineAPIMigration)))
+
+	versionReport := version.NewReport(capov1.GroupVersion.String(), featureGateStates(defaultMutableGate))
 	if *showVersion {
-		fmt.Println(version.Get().GitCommit)
+		fmt.Println(versionReport)
 		os.Exit(0)
 	}
 
@@ -125,32 +307,63 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	// Sets feature gates from flags
-	klog.Infof("Initializing feature gates: %s", strings.Join(defaultMutableGate.KnownFeatures(), ", "))
-	warnings, err := gateOpts.ApplyTo(defaultMutableGate)
-	if err != nil {
-		klog.Fatalf("Error setting feature gates from flags: %v", err)
+	if *preflightCheck {
+		os.Exit(runPreflight(cfg, *watchNamespace))
 	}
-	if len(warnings) > 0 {
-		klog.Infof("Warnings setting feature gates from flags: %v", warnings)
+
+	if *exportCAPO {
+		os.Exit(runExportCAPO(cfg, *watchNamespace))
 	}
 
-	klog.Infof("FeatureGateMachineAPIMigration initialised: %t", defaultMutableGate.Enabled(featuregate.Feature(apifeatures.FeatureGateMachineAPIMigration)))
+	// The profiles expose the memory of the process, including credentials,
+	// so they are never served beyond the host
+	if err := validateDebugAddress(*debugAddress); err != nil {
+		klog.Fatal(err)
+	}
+
+	// Client certificates and tokens must not be sent over plain HTTP
+	if !*metricsSecure && (*metricsAuth || *metricsClientCAFile != "") {
+		klog.Fatal("--metrics-auth and --metrics-client-ca-file need --metrics-secure")
+	}
+	metricsOpts := metricsserver.Options{
+		BindAddress:   *metricsAddress,
+		SecureServing: *metricsSecure,
+		CertDir:       *metricsCertDir,
+		ExtraHandlers: map[string]http.Handler{"/version": version.Handler(versionReport)},
+	}
+	if *metricsClientCAFile != "" {
+		clientCAOption, err := metricsauth.ClientCATLSOption(*metricsClientCAFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		metricsOpts.TLSOpts = append(metricsOpts.TLSOpts, clientCAOption)
+	}
+	if *metricsAuth {
+		metricsOpts.FilterProvider = metricsauth.FilterProvider
+	}
 
 	// Setup a Manager
 	opts := manager.Options{
 		HealthProbeBindAddress:  *healthAddr,
 		LeaderElection:          *leaderElect,
 		LeaderElectionNamespace: *leaderElectResourceNamespace,
-		LeaderElectionID:        "cluster-api-provider-openstack-leader",
+		LeaderElectionID:        *leaderElectID,
 		LeaseDuration:           leaderElectLeaseDuration,
-		Metrics:                 metricsserver.Options{BindAddress: *metricsAddress},
+		Metrics:                 metricsOpts,
+		PprofBindAddress:        *debugAddress,
 		// Slow the default retry and renew election rate to reduce etcd writes at idle: BZ 1858400
 		RetryPeriod:   &retryPeriod,
 		RenewDeadline: &renewDeadline,
 		Cache:         cache.Options{SyncPeriod: &syncPeriod},
 	}
 
+	if *webhookPort != 0 {
+		opts.WebhookServer = webhook.NewServer(webhook.Options{
+			Port:    *webhookPort,
+			CertDir: *webhookCertDir,
+		})
+	}
+
 	if *watchNamespace != "" {
 		opts.Cache = cache.Options{DefaultNamespaces: map[string]cache.Config{*watchNamespace: {}}}
 		klog.Infof("Watching machine-api objects only in namespace %q for reconciliation.", *watchNamespace)
@@ -176,12 +389,55 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	if err := ipamv1.AddToScheme(mgr.GetScheme()); err != nil {
+		klog.Fatal(err)
+	}
+
 	params := getActuatorParams(mgr)
+
+	params.InstanceDeleteTimeout = *instanceDeleteTimeout
+	params.PortCreateConflictRetries = *portCreateConflictRetries
+	params.ZoneCreateFailureThreshold = *zoneCreateFailureThreshold
+	params.ZoneCreateFailureWindow = *zoneCreateFailureWindow
+	params.ZoneCreateFailurePolicy = *zoneCreateFailurePolicy
+	params.DisableInstanceStateAnnotation = !*instanceStateAnnotation
+	params.CAPOCoexistence = *capoCoexistence
 	machineActuator, err := machine.NewActuator(params)
 	if err != nil {
 		klog.Fatal(err)
 	}
 
+	// Cache the CA certificate instead of getting it on every reconcile.
+	// When it changes, discard all authentications and requeue all
+	// machines
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		clients.RunCACertificateInformer(ctx, params.KubeClient, func() {
+			machineActuator.CACertificateChanged(ctx)
+		})
+		return nil
+	})); err != nil {
+		klog.Fatal(err)
+	}
+
+	// Cache the clouds secrets of the watched namespace. When a secret
+	// changes, e.g. because its credentials were rotated, discard its
+	// authentications and requeue the machines which use it
+	if *watchNamespace != "" {
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			clients.RunCloudsSecretInformer(ctx, params.KubeClient, *watchNamespace, func(namespace, name string) {
+				machineActuator.CloudsSecretChanged(ctx, namespace, name)
+			})
+			return nil
+		})); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	// Backfill the machines of very old versions once at startup
+	if err := mgr.Add(manager.RunnableFunc(machineActuator.BackfillMachines)); err != nil {
+		klog.Fatal(err)
+	}
+
 	// Setup OpenStack Machine controller
 	if err := maoMachine.AddWithActuator(mgr, machineActuator, defaultMutableGate); err != nil {
 		klog.Fatal(err)
@@ -198,6 +454,70 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *webhookPort != 0 {
+		if err := (&webhooks.MachineValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Machine")
+			os.Exit(1)
+		}
+		if err := (&webhooks.MachineSetValidator{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MachineSet")
+			os.Exit(1)
+		}
+		if err := (&webhooks.ProviderSpecDefaulter{KubeClient: params.KubeClient}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ProviderSpecDefaulter")
+			os.Exit(1)
+		}
+	}
+
+	if *credentialsCheckInterval > 0 {
+		var requiredRoles []string
+		if *credentialsRequiredRoles != "" {
+			requiredRoles = strings.Split(*credentialsRequiredRoles, ",")
+		}
+		if err = (&credentials.Reconciler{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("controllers").WithName("Credentials"),
+			Interval:      *credentialsCheckInterval,
+			RequiredRoles: requiredRoles,
+		}).SetupWithManager(mgr, rTcontroller.Options{}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Credentials")
+			os.Exit(1)
+		}
+	}
+
+	if *availabilityZoneDiscoveryInterval > 0 {
+		if err = (&topology.Reconciler{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("controllers").WithName("Topology"),
+			Interval: *availabilityZoneDiscoveryInterval,
+		}).SetupWithManager(mgr, rTcontroller.Options{}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Topology")
+			os.Exit(1)
+		}
+	}
+
+	if *cloudFeatureCheckInterval > 0 {
+		if err = (&cloudfeatures.Reconciler{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("controllers").WithName("Features"),
+			Interval: *cloudFeatureCheckInterval,
+		}).SetupWithManager(mgr, rTcontroller.Options{}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Features")
+			os.Exit(1)
+		}
+	}
+
+	if *instanceInventoryInterval > 0 {
+		if err = (&inventory.Reporter{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("inventory"),
+			Interval: *instanceInventoryInterval,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create instance inventory reporter")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
 		klog.Fatal(err)
 	}
@@ -233,3 +553,80 @@ func getActuatorParams(mgr manager.Manager) machine.ActuatorParams {
 	}
 
 }
+
+// featureGateStates returns whether each known feature gate is enabled.
+func featureGateStates(gate featuregate.MutableFeatureGate) map[string]bool {
+	states := map[string]bool{}
+	for feature := range gate.GetAll() {
+		states[string(feature)] = gate.Enabled(feature)
+	}
+	return states
+}
+
+// validateDebugAddress returns an error if the debug address is set and is
+// not a loopback address.
+func validateDebugAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid --debug-bind-address %q: %w", address, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("--debug-bind-address %q must be a loopback address, e.g. 127.0.0.1:6060", address)
+	}
+	return nil
+}
+
+// runPreflight checks the OpenStack APIs with the credentials of the clouds of
+// the MachineSets, and returns the exit status.
+func runPreflight(cfg *rest.Config, namespace string) int {
+	scheme := runtime.NewScheme()
+	if err := machinev1beta1.AddToScheme(scheme); err != nil {
+		klog.Fatal(err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		klog.Fatal(err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	results, err := preflight.Run(context.Background(), c, kubeClient, namespace)
+	if err != nil {
+		klog.Error(err)
+		return 1
+	}
+	if !preflight.Report(os.Stdout, results) {
+		return 1
+	}
+	return 0
+}
+
+// runExportCAPO writes the MachineSets and Machines as CAPO manifests to
+// stdout, and returns the exit status.
+func runExportCAPO(cfg *rest.Config, namespace string) int {
+	scheme := runtime.NewScheme()
+	if err := machinev1beta1.AddToScheme(scheme); err != nil {
+		klog.Fatal(err)
+	}
+	if err := configv1.AddToScheme(scheme); err != nil {
+		klog.Fatal(err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := export.Run(context.Background(), c, namespace, os.Stdout); err != nil {
+		klog.Error(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package clients
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// serviceUnknown is the service of requests to URLs which are not endpoints
+// of the service catalog.
+const serviceUnknown = "unknown"
+
+var (
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapo_openstack_api_requests_total",
+			Help: "Number of requests to OpenStack APIs, by service type, HTTP method and status code. The code is empty for requests which got no response.",
+		},
+		[]string{"service", "method", "code"},
+	)
+
+	apiRequestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapo_openstack_api_request_errors_total",
+			Help: "Number of requests to OpenStack APIs which failed with an error status code, or got no response, by service type, HTTP method and status code.",
+		},
+		[]string{"service", "method", "code"},
+	)
+
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapo_openstack_api_request_duration_seconds",
+			Help:    "How long requests to OpenStack APIs took until their response headers were received, by service type and HTTP method.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"service", "method"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(apiRequests, apiRequestErrors, apiRequestDuration)
+}
+
+// catalogEndpoint is an endpoint of the service catalog.
+type catalogEndpoint struct {
+	url         string
+	serviceType string
+}
+
+// serviceResolver finds the type of the service of request URLs in the
+// service catalog of the token of a provider client, e.g. compute or network.
+type serviceResolver struct {
+	provider         *gophercloud.ProviderClient
+	identityEndpoint string
+
+	mu sync.Mutex
+	// token is the token whose catalog has the endpoints
+	token     string
+	endpoints []catalogEndpoint
+}
+
+// service returns the type of the service of the request URL, or
+// serviceUnknown.
+func (r *serviceResolver) service(url string) string {
+	var longest catalogEndpoint
+	for _, endpoint := range r.catalogEndpoints() {
+		if strings.HasPrefix(url, endpoint.url) && len(endpoint.url) > len(longest.url) {
+			longest = endpoint
+		}
+	}
+	if longest.serviceType != "" {
+		return longest.serviceType
+	}
+	// Authenticating happens before there is a catalog
+	if r.identityEndpoint != "" && strings.HasPrefix(url, strings.TrimSuffix(r.identityEndpoint, "/")) {
+		return "identity"
+	}
+	return serviceUnknown
+}
+
+// catalogEndpoints returns the endpoints of the service catalog of the token
+// of the provider client, which are extracted again whenever its token
+// changes.
+func (r *serviceResolver) catalogEndpoints() []catalogEndpoint {
+	if r.provider == nil {
+		return nil
+	}
+	token := r.provider.Token()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token == r.token {
+		return r.endpoints
+	}
+	r.token = token
+	r.endpoints = nil
+
+	authResult, ok := r.provider.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return nil
+	}
+	catalog, err := authResult.ExtractServiceCatalog()
+	if err != nil {
+		return nil
+	}
+	for _, entry := range catalog.Entries {
+		for _, endpoint := range entry.Endpoints {
+			r.endpoints = append(r.endpoints, catalogEndpoint{
+				url:         strings.TrimSuffix(endpoint.URL, "/"),
+				serviceType: entry.Type,
+			})
+		}
+	}
+	return r.endpoints
+}
+
+// apiMetricsRoundTripper exports metrics of the requests made by a provider
+// client, so that slow or failing OpenStack APIs can be told apart from the
+// controller. Every attempt of a request which is retried is counted.
+type apiMetricsRoundTripper struct {
+	rt       http.RoundTripper
+	resolver *serviceResolver
+}
+
+func (rt *apiMetricsRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := rt.rt.RoundTrip(request)
+	duration := time.Since(start)
+
+	service := rt.resolver.service(request.URL.String())
+	var code string
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+
+	apiRequests.WithLabelValues(service, request.Method, code).Inc()
+	apiRequestDuration.WithLabelValues(service, request.Method).Observe(duration.Seconds())
+	if err != nil || response.StatusCode >= http.StatusBadRequest {
+		apiRequestErrors.WithLabelValues(service, request.Method, code).Inc()
+	}
+	return response, err
+}
+
+// instrumentAPIRequests makes the provider client export metrics of its
+// requests to the OpenStack APIs.
+func instrumentAPIRequests(provider *gophercloud.ProviderClient, identityEndpoint string) {
+	rt := provider.HTTPClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	provider.HTTPClient.Transport = &apiMetricsRoundTripper{
+		rt:       rt,
+		resolver: &serviceResolver{provider: provider, identityEndpoint: identityEndpoint},
+	}
+}
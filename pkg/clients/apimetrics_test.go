@@ -0,0 +1,141 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// newCatalogProvider returns a provider client whose token has a service
+// catalog with the given endpoints of each service type.
+func newCatalogProvider(t *testing.T, token string, catalog map[string][]string) *gophercloud.ProviderClient {
+	t.Helper()
+
+	var entries []interface{}
+	for serviceType, urls := range catalog {
+		var endpoints []interface{}
+		for _, url := range urls {
+			endpoints = append(endpoints, map[string]interface{}{"interface": "public", "url": url})
+		}
+		entries = append(entries, map[string]interface{}{"type": serviceType, "endpoints": endpoints})
+	}
+
+	var result tokens.CreateResult
+	result.Body = map[string]interface{}{"token": map[string]interface{}{"catalog": entries}}
+	result.Header = http.Header{"X-Subject-Token": []string{token}}
+
+	provider := &gophercloud.ProviderClient{}
+	if err := provider.SetTokenAndAuthResult(result); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestServiceResolver(t *testing.T) {
+	provider := newCatalogProvider(t, "token-1", map[string][]string{
+		"compute":       {"https://cloud.example.com:13774/v2.1/"},
+		"network":       {"https://cloud.example.com:13696"},
+		"load-balancer": {"https://cloud.example.com/load-balancer"},
+		"object-store":  {"https://cloud.example.com"},
+		"identity":      {"https://cloud.example.com:13000"},
+	})
+	resolver := &serviceResolver{provider: provider, identityEndpoint: "https://cloud.example.com:13000/"}
+
+	for url, expected := range map[string]string{
+		"https://cloud.example.com:13774/v2.1/servers/detail":      "compute",
+		"https://cloud.example.com:13696/v2.0/ports?name=worker-0": "network",
+		"https://cloud.example.com/load-balancer/v2/lbaas/pools":   "load-balancer",
+		"https://cloud.example.com/swift/v1":                       "object-store",
+		"https://cloud.example.com:13000/v3/auth/tokens":           "identity",
+		"https://other.example.com/v2.1/servers":                   serviceUnknown,
+	} {
+		if service := resolver.service(url); service != expected {
+			t.Errorf("Expected service %s of %s, got %s", expected, url, service)
+		}
+	}
+
+	// Before authenticating there is no catalog
+	unauthenticated := &serviceResolver{provider: &gophercloud.ProviderClient{}, identityEndpoint: "https://keystone.example.com/v3"}
+	if service := unauthenticated.service("https://keystone.example.com/v3/auth/tokens"); service != "identity" {
+		t.Errorf("Expected the identity service before authenticating, got %s", service)
+	}
+}
+
+func counterValue(t *testing.T, counter *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+
+	metric, err := counter.GetMetricWithLabelValues(labels...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestAPIMetricsRoundTripper(t *testing.T) {
+	provider := newCatalogProvider(t, "token-1", map[string][]string{
+		"compute": {"https://nova.metrics.example.com/v2.1"},
+	})
+
+	statusCode := http.StatusOK
+	var transportErr error
+	rt := &apiMetricsRoundTripper{
+		rt: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			if transportErr != nil {
+				return nil, transportErr
+			}
+			return &http.Response{StatusCode: statusCode}, nil
+		}),
+		resolver: &serviceResolver{provider: provider},
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "https://nova.metrics.example.com/v2.1/servers/detail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := func(code string) float64 { return counterValue(t, apiRequests, "compute", http.MethodGet, code) }
+	errs := func(code string) float64 { return counterValue(t, apiRequestErrors, "compute", http.MethodGet, code) }
+	before200, before503, beforeFailed := requests("200"), requests("503"), requests("")
+	beforeErr503, beforeErrFailed := errs("503"), errs("")
+
+	for _, code := range []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable} {
+		statusCode = code
+		if _, err := rt.RoundTrip(request); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	transportErr = errors.New("connection refused")
+	if _, err := rt.RoundTrip(request); err == nil {
+		t.Fatalf("Expected the error of the transport")
+	}
+
+	if n := requests("200") - before200; n != 2 {
+		t.Errorf("Expected 2 requests with status 200, got %v", n)
+	}
+	if n := requests("503") - before503; n != 1 {
+		t.Errorf("Expected 1 request with status 503, got %v", n)
+	}
+	if n := requests("") - beforeFailed; n != 1 {
+		t.Errorf("Expected 1 request without a response, got %v", n)
+	}
+	if n := errs("503") - beforeErr503; n != 1 {
+		t.Errorf("Expected 1 error with status 503, got %v", n)
+	}
+	if n := errs("") - beforeErrFailed; n != 1 {
+		t.Errorf("Expected 1 error without a response, got %v", n)
+	}
+}
@@ -0,0 +1,127 @@
+package clients
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	cloudProviderConfigNamespace = "openshift-config"
+	cloudProviderConfigName      = "cloud-provider-config"
+	caBundleKey                  = "ca-bundle.pem"
+)
+
+// cloudProviderConfigCache holds the cloud-provider-config ConfigMap while
+// RunCACertificateInformer runs.
+var cloudProviderConfigCache struct {
+	sync.RWMutex
+	informer cache.SharedIndexInformer
+}
+
+// RunCACertificateInformer watches the cloud-provider-config ConfigMap until
+// ctx is done. While it runs, and once it has synced, GetCACertificate reads
+// the CA certificate from the watched ConfigMap instead of getting it from
+// the API server on every call. onChange is called whenever the CA
+// certificate is updated, or the ConfigMap is deleted.
+func RunCACertificateInformer(ctx context.Context, kubeClient kubernetes.Interface, onChange func()) {
+	configMaps := kubeClient.CoreV1().ConfigMaps(cloudProviderConfigNamespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", cloudProviderConfigName).String()
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.FieldSelector = fieldSelector
+				return configMaps.List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.FieldSelector = fieldSelector
+				return configMaps.Watch(ctx, options)
+			},
+		},
+		&corev1.ConfigMap{}, 0, cache.Indexers{},
+	)
+
+	if onChange != nil {
+		_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, obj interface{}) {
+				if caCertificateChanged(oldObj, obj) {
+					onChange()
+				}
+			},
+			DeleteFunc: func(interface{}) { onChange() },
+		})
+	}
+
+	cloudProviderConfigCache.Lock()
+	cloudProviderConfigCache.informer = informer
+	cloudProviderConfigCache.Unlock()
+
+	defer func() {
+		cloudProviderConfigCache.Lock()
+		cloudProviderConfigCache.informer = nil
+		cloudProviderConfigCache.Unlock()
+	}()
+
+	informer.Run(ctx.Done())
+}
+
+// caCertificateChanged returns whether the CA certificate of an updated
+// cloud-provider-config ConfigMap changed. Updates of its other keys, e.g.
+// the cloud provider config, don't change it.
+func caCertificateChanged(oldObj, obj interface{}) bool {
+	oldConfigMap, ok := oldObj.(*corev1.ConfigMap)
+	if !ok {
+		return true
+	}
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return true
+	}
+	oldCACert, hadCACert := oldConfigMap.Data[caBundleKey]
+	caCert, hasCACert := configMap.Data[caBundleKey]
+	return hadCACert != hasCACert || oldCACert != caCert
+}
+
+// cachedCloudProviderConfigStore returns the store of the cloud-provider-config
+// informer, or nil if it isn't running or hasn't synced yet.
+func cachedCloudProviderConfigStore() cache.Store {
+	cloudProviderConfigCache.RLock()
+	defer cloudProviderConfigCache.RUnlock()
+
+	informer := cloudProviderConfigCache.informer
+	if informer == nil || !informer.HasSynced() {
+		return nil
+	}
+	return informer.GetStore()
+}
+
+// caCertificateFromStore gets the CA certificate from the cloud-provider-config
+// ConfigMap in store.
+func caCertificateFromStore(store cache.Store) []byte {
+	obj, exists, err := store.GetByKey(cloudProviderConfigNamespace + "/" + cloudProviderConfigName)
+	if err != nil {
+		klog.Warningf("failed to get configmap %s/%s from cache: %v", cloudProviderConfigNamespace, cloudProviderConfigName, err)
+		return nil
+	}
+	if !exists {
+		klog.Warningf("configmap %s/%s not found", cloudProviderConfigNamespace, cloudProviderConfigName)
+		return nil
+	}
+
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil
+	}
+	if cacert, ok := configMap.Data[caBundleKey]; ok {
+		return []byte(cacert)
+	}
+	return nil
+}
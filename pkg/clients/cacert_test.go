@@ -0,0 +1,79 @@
+package clients
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCACertificateFromStore(t *testing.T) {
+	const caBundle = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+	tests := []struct {
+		name       string
+		configMaps []*corev1.ConfigMap
+		expected   []byte
+	}{
+		{
+			name: "CA bundle",
+			configMaps: []*corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: cloudProviderConfigNamespace, Name: cloudProviderConfigName},
+				Data:       map[string]string{caBundleKey: caBundle},
+			}},
+			expected: []byte(caBundle),
+		},
+		{
+			name: "no CA bundle",
+			configMaps: []*corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: cloudProviderConfigNamespace, Name: cloudProviderConfigName},
+				Data:       map[string]string{"config": "[Global]"},
+			}},
+		},
+		{
+			name: "no ConfigMap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			for _, configMap := range tt.configMaps {
+				if err := store.Add(configMap); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if actual := caCertificateFromStore(store); !bytes.Equal(actual, tt.expected) {
+				t.Errorf("Expected CA certificate %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCACertificateChanged(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cloudProviderConfigNamespace, Name: cloudProviderConfigName},
+		Data:       map[string]string{"config": "[Global]", caBundleKey: "certificate"},
+	}
+
+	reconfigured := configMap.DeepCopy()
+	reconfigured.Data["config"] = "[Global]\nsecret-name = openstack-credentials"
+	if caCertificateChanged(configMap, reconfigured) {
+		t.Errorf("Expected a change of the cloud provider config not to change the CA certificate")
+	}
+
+	renewed := configMap.DeepCopy()
+	renewed.Data[caBundleKey] = "renewed certificate"
+	if !caCertificateChanged(configMap, renewed) {
+		t.Errorf("Expected a new CA bundle to change the CA certificate")
+	}
+
+	removed := configMap.DeepCopy()
+	delete(removed.Data, caBundleKey)
+	if !caCertificateChanged(configMap, removed) {
+		t.Errorf("Expected the removal of the CA bundle to change the CA certificate")
+	}
+}
@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// pemPrefix starts the PEM encoded certificates and keys which are set in
+// the cert and key of a cloud instead of the paths of their files.
+var pemPrefix = []byte("-----BEGIN ")
+
+// resolveClientCertificate replaces the cert and key of cloud with the
+// contents of the keys of the clouds secret they name, if any. In clouds.yaml
+// they are the paths of the client certificate and key, which MAPO can't
+// read from a secret, so instead they may name keys of the secret, e.g.
+// tls.crt and tls.key. Since the contents become part of the cloud, scopes
+// and provider clients, which are cached by the hash of the cloud, are
+// renewed when the client certificate is rotated.
+func resolveClientCertificate(cloud *clientconfig.Cloud, secret *corev1.Secret) {
+	if data, ok := secret.Data[cloud.ClientCertFile]; ok && cloud.ClientCertFile != "" {
+		cloud.ClientCertFile = string(data)
+	}
+	if data, ok := secret.Data[cloud.ClientKeyFile]; ok && cloud.ClientKeyFile != "" {
+		cloud.ClientKeyFile = string(data)
+	}
+}
+
+// clientCertificates returns the TLS client certificate of cloud, which is
+// presented to OpenStack endpoints which require mutual TLS, or nil if the
+// cloud has none. Its cert and key are either PEM encoded, when they were
+// read from the clouds secret, or the paths of PEM files.
+func clientCertificates(cloud clientconfig.Cloud) ([]tls.Certificate, error) {
+	if cloud.ClientCertFile == "" && cloud.ClientKeyFile == "" {
+		return nil, nil
+	}
+	if cloud.ClientCertFile == "" || cloud.ClientKeyFile == "" {
+		return nil, fmt.Errorf("the client certificate of cloud %s needs both a cert and a key", cloud.Cloud)
+	}
+
+	certPEM, err := readPEM(cloud.ClientCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client certificate of cloud %s: %v", cloud.Cloud, err)
+	}
+	keyPEM, err := readPEM(cloud.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the client key of cloud %s: %v", cloud.Cloud, err)
+	}
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate of cloud %s: %v", cloud.Cloud, err)
+	}
+	return []tls.Certificate{certificate}, nil
+}
+
+// readPEM returns value if it is PEM encoded, or else the contents of the
+// file at path value.
+func readPEM(value string) ([]byte, error) {
+	if data := []byte(value); bytes.HasPrefix(bytes.TrimSpace(data), pemPrefix) {
+		return data, nil
+	}
+	return os.ReadFile(value)
+}
@@ -0,0 +1,140 @@
+package clients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newClientCertificatePEM returns a self-signed client certificate and its
+// key, PEM encoded.
+func newClientCertificatePEM(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "machine-api"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestResolveClientCertificate(t *testing.T) {
+	certPEM, keyPEM := newClientCertificatePEM(t)
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			CloudsSecretKey: []byte("clouds: {}"),
+			"tls.crt":       []byte(certPEM),
+			"tls.key":       []byte(keyPEM),
+		},
+	}
+
+	cloud := clientconfig.Cloud{Cloud: "openstack", ClientCertFile: "tls.crt", ClientKeyFile: "tls.key"}
+	resolveClientCertificate(&cloud, secret)
+	if cloud.ClientCertFile != certPEM || cloud.ClientKeyFile != keyPEM {
+		t.Fatalf("Expected the cert and key of the secret, got %q and %q", cloud.ClientCertFile, cloud.ClientKeyFile)
+	}
+	if certs, err := clientCertificates(cloud); err != nil || len(certs) != 1 {
+		t.Errorf("Expected a client certificate, got %d and error %v", len(certs), err)
+	}
+
+	paths := clientconfig.Cloud{Cloud: "openstack", ClientCertFile: "/etc/pki/client.crt", ClientKeyFile: "/etc/pki/client.key"}
+	resolveClientCertificate(&paths, secret)
+	if paths.ClientCertFile != "/etc/pki/client.crt" || paths.ClientKeyFile != "/etc/pki/client.key" {
+		t.Errorf("Expected paths which aren't keys of the secret to be kept, got %q and %q", paths.ClientCertFile, paths.ClientKeyFile)
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	certPEM, keyPEM := newClientCertificatePEM(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, []byte(certPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cloud     clientconfig.Cloud
+		expected  int
+		expectErr bool
+	}{
+		{
+			name:  "no client certificate",
+			cloud: clientconfig.Cloud{Cloud: "openstack"},
+		},
+		{
+			name:     "PEM encoded",
+			cloud:    clientconfig.Cloud{Cloud: "openstack", ClientCertFile: certPEM, ClientKeyFile: keyPEM},
+			expected: 1,
+		},
+		{
+			name:     "files",
+			cloud:    clientconfig.Cloud{Cloud: "openstack", ClientCertFile: certFile, ClientKeyFile: keyFile},
+			expected: 1,
+		},
+		{
+			name:      "missing key",
+			cloud:     clientconfig.Cloud{Cloud: "openstack", ClientCertFile: certPEM},
+			expectErr: true,
+		},
+		{
+			name:      "missing file",
+			cloud:     clientconfig.Cloud{Cloud: "openstack", ClientCertFile: filepath.Join(dir, "missing.crt"), ClientKeyFile: keyFile},
+			expectErr: true,
+		},
+		{
+			name:      "mismatched key",
+			cloud:     clientconfig.Cloud{Cloud: "openstack", ClientCertFile: keyPEM, ClientKeyFile: keyPEM},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := clientCertificates(tt.cloud)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, found one: %v", err)
+			}
+			if len(certs) != tt.expected {
+				t.Errorf("Expected %d client certificates, got %d", tt.expected, len(certs))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// providerClientWithContext returns a shallow copy of provider whose requests
+// are made with ctx, so that they are cancelled with it. Provider clients are
+// shared by all the machines with the same credentials, so the context can't
+// be set on provider itself.
+//
+// The copy shares the token of provider: when the token expires, provider is
+// reauthenticated and its new token is copied.
+func providerClientWithContext(ctx context.Context, provider *gophercloud.ProviderClient) *gophercloud.ProviderClient {
+	withContext := *provider
+	withContext.Context = ctx
+
+	if reauth := provider.ReauthFunc; reauth != nil {
+		// The copy shares the reauthentication lock of provider, so it
+		// calls the reauthentication function of provider directly
+		// rather than provider.Reauthenticate, which would wait for the
+		// reauthentication of the copy itself.
+		withContext.ReauthFunc = func() error {
+			if err := reauth(); err != nil {
+				return err
+			}
+			withContext.CopyTokenFrom(provider)
+			return nil
+		}
+	}
+	return &withContext
+}
+
+// serviceClientWithContext returns a shallow copy of client whose requests
+// are made with provider, or nil if client is nil.
+func serviceClientWithContext(client *gophercloud.ServiceClient, provider *gophercloud.ProviderClient) *gophercloud.ServiceClient {
+	if client == nil {
+		return nil
+	}
+	withContext := *client
+	withContext.ProviderClient = provider
+	return &withContext
+}
+
+// WithContext returns a copy of the instance service whose requests are made
+// with ctx. The copy has its own service clients, and starts with the compute
+// microversion of the instance service, so that concurrent users of copies
+// don't share any state.
+func (is *InstanceService) WithContext(ctx context.Context) *InstanceService {
+	provider := providerClientWithContext(ctx, is.computeClient.ProviderClient)
+
+	is.computeMicroversionMu.Lock()
+	defer is.computeMicroversionMu.Unlock()
+
+	return &InstanceService{
+		computeClient:            serviceClientWithContext(is.computeClient, provider),
+		imagesClient:             serviceClientWithContext(is.imagesClient, provider),
+		baremetalClient:          serviceClientWithContext(is.baremetalClient, provider),
+		volumeClient:             serviceClientWithContext(is.volumeClient, provider),
+		networkClient:            serviceClientWithContext(is.networkClient, provider),
+		placementClient:          serviceClientWithContext(is.placementClient, provider),
+		dnsClient:                serviceClientWithContext(is.dnsClient, provider),
+		computeMicroversion:      is.computeMicroversion,
+		computeMicroversionKnown: is.computeMicroversionKnown,
+	}
+}
+
+// endpointCache remembers the endpoints located in the catalog of a shared
+// provider client, which its copies would otherwise search again every time
+// they create a service client. Only located endpoints are remembered, so a
+// missing endpoint is searched again.
+type endpointCache struct {
+	mu        sync.Mutex
+	locator   gophercloud.EndpointLocator
+	endpoints map[gophercloud.EndpointOpts]string
+}
+
+func newEndpointCache(locator gophercloud.EndpointLocator) *endpointCache {
+	return &endpointCache{
+		locator:   locator,
+		endpoints: make(map[gophercloud.EndpointOpts]string),
+	}
+}
+
+// locate is the gophercloud.EndpointLocator of the copies of the provider
+// client.
+func (c *endpointCache) locate(opts gophercloud.EndpointOpts) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if endpoint, ok := c.endpoints[opts]; ok {
+		return endpoint, nil
+	}
+	endpoint, err := c.locator(opts)
+	if err != nil {
+		return "", err
+	}
+	c.endpoints[opts] = endpoint
+	return endpoint, nil
+}
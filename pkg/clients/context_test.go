@@ -0,0 +1,118 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+func TestProviderClientWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "renewed" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider := &gophercloud.ProviderClient{HTTPClient: *server.Client()}
+	provider.UseTokenLock()
+	provider.SetToken("expired")
+	reauthentications := 0
+	provider.ReauthFunc = func() error {
+		reauthentications++
+		provider.SetToken("renewed")
+		return nil
+	}
+
+	// The copy gets the token of the reauthenticated provider client
+	ctx, cancel := context.WithCancel(context.Background())
+	withContext := providerClientWithContext(ctx, provider)
+	if _, err := withContext.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reauthentications != 1 || withContext.Token() != "renewed" {
+		t.Errorf("Expected the copy to be reauthenticated once, got %d reauthentications and token %q", reauthentications, withContext.Token())
+	}
+	if provider.Context != nil {
+		t.Errorf("Expected the shared provider client to have no context")
+	}
+
+	// Requests of the copy are cancelled with its context
+	cancel()
+	_, err := withContext.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the request to be cancelled, got %v", err)
+	}
+	if _, err := provider.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{}); err != nil {
+		t.Errorf("Expected requests of the shared provider client not to be cancelled, got %v", err)
+	}
+}
+
+func TestScopeWithContext(t *testing.T) {
+	located := 0
+	provider := &gophercloud.ProviderClient{}
+	provider.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
+		located++
+		if opts.Type != "compute" {
+			return "", &gophercloud.ErrEndpointNotFound{}
+		}
+		return "https://nova.example.com/v2.1/", nil
+	}
+	shared := &providerScope{
+		providerClient:     provider,
+		providerClientOpts: &clientconfig.ClientOpts{},
+		endpoints:          newEndpointCache(provider.EndpointLocator),
+	}
+
+	// The copies of the shared scope locate each endpoint once
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		withContext := WithContext(ctx, shared).(*providerScope)
+		if withContext.providerClient.Context != ctx {
+			t.Errorf("Expected the copy to make its requests with its context")
+		}
+		if _, err := withContext.NewComputeClient(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := withContext.NewNetworkClient(); err == nil {
+			t.Errorf("Expected the network endpoint not to be found")
+		}
+		cancel()
+	}
+	if located != 3 {
+		t.Errorf("Expected the compute endpoint to be located once and the missing network endpoint twice, got %d searches", located)
+	}
+	if provider.Context != nil {
+		t.Errorf("Expected the shared provider client to have no context")
+	}
+}
+
+func TestInstanceServiceWithContext(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.95"}
+	is := compute.serve(t)
+	is.SetComputeMicroversion("2.88")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	withContext := is.WithContext(ctx)
+	if withContext.computeClient == is.computeClient || withContext.computeClient.ProviderClient == is.computeClient.ProviderClient {
+		t.Errorf("Expected the copy to have its own clients")
+	}
+	if microversion, err := withContext.ComputeMicroversion(); err != nil || microversion != "2.88" {
+		t.Errorf("Expected the copy to keep the microversion 2.88, got %q and %v", microversion, err)
+	}
+
+	cancel()
+	if _, err := withContext.GetServerIdentity("server-id", "2.19"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the request to be cancelled, got %v", err)
+	}
+	if _, err := is.GetServerIdentity("server-id", "2.19"); err != nil {
+		t.Errorf("Expected requests of the instance service not to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package clients
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+)
+
+// Feature is a feature of machines which can only be used if the cloud
+// supports a minimum compute microversion, or has a block storage service.
+type Feature struct {
+	// Name is the name of the feature.
+	Name string
+
+	// ComputeMicroversion is the minimum compute microversion.
+	ComputeMicroversion string
+
+	// BlockStorage is true if the feature needs a block storage service.
+	BlockStorage bool
+}
+
+var (
+	// FeatureServerTags is the tagging of servers with the tags of the
+	// providerSpec.
+	FeatureServerTags = Feature{Name: "ServerTags", ComputeMicroversion: "2.52"}
+
+	// FeatureMultiattachVolumes is the attachment of the volumes of
+	// multiattachVolumes.
+	FeatureMultiattachVolumes = Feature{Name: "MultiattachVolumes", ComputeMicroversion: "2.60", BlockStorage: true}
+
+	// FeatureServerDescription is the description of servers given by
+	// serverDescription.
+	FeatureServerDescription = Feature{Name: "ServerDescription", ComputeMicroversion: "2.19"}
+
+	// FeatureServerHostname is the hostname of servers in the metadata
+	// service, which is set to the hostname of the machine when the cloud
+	// supports it. Unlike the other features it is optional: the hostname of
+	// the instance is set by its user data either way.
+	FeatureServerHostname = Feature{Name: "ServerHostname", ComputeMicroversion: "2.90"}
+
+	// FeatureServerFQDNHostname is FeatureServerHostname for fully qualified
+	// hostnames.
+	FeatureServerFQDNHostname = Feature{Name: "ServerFQDNHostname", ComputeMicroversion: "2.94"}
+)
+
+// MachineFeatures returns the features used by a machine with the given
+// providerSpec.
+func MachineFeatures(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *ProviderSpecExtensions) []Feature {
+	var features []Feature
+	if len(machineSpec.Tags) > 0 {
+		features = append(features, FeatureServerTags)
+	}
+	if len(extensions.MultiattachVolumes) > 0 {
+		features = append(features, FeatureMultiattachVolumes)
+	}
+	if extensions.ServerDescription != "" {
+		features = append(features, FeatureServerDescription)
+	}
+	return features
+}
+
+// Capabilities are what a cloud supports of what features need.
+type Capabilities struct {
+	// ComputeMicroversion is the maximum microversion of the compute
+	// service. It is empty if the compute service has no microversions.
+	ComputeMicroversion string
+
+	// BlockStorage is true if the cloud has a block storage service.
+	BlockStorage bool
+}
+
+// Unsupported returns why feature can't be used with the capabilities, or an
+// empty string if it can.
+func (c Capabilities) Unsupported(feature Feature) string {
+	if feature.ComputeMicroversion != "" && !microversionAtLeast(c.ComputeMicroversion, feature.ComputeMicroversion) {
+		if c.ComputeMicroversion == "" {
+			return fmt.Sprintf("%s requires compute microversion %s, but the compute service has no microversions", feature.Name, feature.ComputeMicroversion)
+		}
+		return fmt.Sprintf("%s requires compute microversion %s, but the compute service only supports %s", feature.Name, feature.ComputeMicroversion, c.ComputeMicroversion)
+	}
+	if feature.BlockStorage && !c.BlockStorage {
+		return fmt.Sprintf("%s requires a block storage service, but the cloud has none", feature.Name)
+	}
+	return ""
+}
+
+// GetCapabilities returns the capabilities of the cloud. The compute
+// microversion is the one the instance service may use, see
+// ComputeMicroversion.
+func (is *InstanceService) GetCapabilities() (Capabilities, error) {
+	microversion, err := is.ComputeMicroversion()
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	return Capabilities{
+		ComputeMicroversion: microversion,
+		BlockStorage:        is.volumeClient != nil,
+	}, nil
+}
+
+// microversionAtLeast returns true if the microversion version is at least
+// minimum. An invalid microversion is never at least minimum.
+func microversionAtLeast(version, minimum string) bool {
+	major, minor, ok := parseMicroversion(version)
+	if !ok {
+		return false
+	}
+	minMajor, minMinor, ok := parseMicroversion(minimum)
+	if !ok {
+		return false
+	}
+	return major > minMajor || (major == minMajor && minor >= minMinor)
+}
+
+// parseMicroversion returns the major and minor version of a microversion
+// such as 2.60.
+func parseMicroversion(microversion string) (int, int, bool) {
+	majorPart, minorPart, ok := strings.Cut(microversion, ".")
+	if !ok {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(majorPart)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(minorPart)
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
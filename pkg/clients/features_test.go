@@ -0,0 +1,80 @@
+package clients
+
+import (
+	"testing"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+)
+
+func TestMicroversionAtLeast(t *testing.T) {
+	tests := []struct {
+		version  string
+		minimum  string
+		expected bool
+	}{
+		{version: "2.60", minimum: "2.60", expected: true},
+		{version: "2.95", minimum: "2.60", expected: true},
+		{version: "2.9", minimum: "2.60", expected: false},
+		{version: "3.0", minimum: "2.60", expected: true},
+		{version: "", minimum: "2.52", expected: false},
+		{version: "latest", minimum: "2.52", expected: false},
+	}
+	for _, tt := range tests {
+		if actual := microversionAtLeast(tt.version, tt.minimum); actual != tt.expected {
+			t.Errorf("microversionAtLeast(%q, %q) = %t, expected %t", tt.version, tt.minimum, actual, tt.expected)
+		}
+	}
+}
+
+func TestCapabilitiesUnsupported(t *testing.T) {
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{Tags: []string{"team-a"}}
+	extensions := &ProviderSpecExtensions{MultiattachVolumes: []MultiattachVolume{{VolumeID: "4d6f8a0c-2e4a-4c6e-8a0c-2e4a6c8e0a2c"}}}
+	features := MachineFeatures(machineSpec, extensions)
+	if len(features) != 2 {
+		t.Fatalf("expected 2 features, got %v", features)
+	}
+
+	tests := []struct {
+		name         string
+		capabilities Capabilities
+		unsupported  []string
+	}{
+		{
+			name:         "all supported",
+			capabilities: Capabilities{ComputeMicroversion: "2.95", BlockStorage: true},
+		},
+		{
+			name:         "old compute service",
+			capabilities: Capabilities{ComputeMicroversion: "2.53", BlockStorage: true},
+			unsupported:  []string{FeatureMultiattachVolumes.Name},
+		},
+		{
+			name:         "no block storage service",
+			capabilities: Capabilities{ComputeMicroversion: "2.95"},
+			unsupported:  []string{FeatureMultiattachVolumes.Name},
+		},
+		{
+			name:         "no microversions",
+			capabilities: Capabilities{BlockStorage: true},
+			unsupported:  []string{FeatureServerTags.Name, FeatureMultiattachVolumes.Name},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unsupported []string
+			for _, feature := range features {
+				if reason := tt.capabilities.Unsupported(feature); reason != "" {
+					unsupported = append(unsupported, feature.Name)
+				}
+			}
+			if len(unsupported) != len(tt.unsupported) {
+				t.Fatalf("expected unsupported features %v, got %v", tt.unsupported, unsupported)
+			}
+			for i := range unsupported {
+				if unsupported[i] != tt.unsupported[i] {
+					t.Errorf("expected unsupported features %v, got %v", tt.unsupported, unsupported)
+				}
+			}
+		})
+	}
+}
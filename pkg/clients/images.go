@@ -0,0 +1,119 @@
+package clients
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+)
+
+// ImageSelection controls which image is used when more than one image has
+// the requested name.
+type ImageSelection struct {
+	// Tags restricts the candidates to images which have all of the given
+	// tags.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+
+	// PreferredVisibility is the visibility of the image to prefer, one of
+	// public, private, shared or community.
+	// +optional
+	PreferredVisibility string `json:"preferredVisibility,omitempty"`
+}
+
+// GetImageID returns the ID of the image with the given name or ID. If more
+// than one image has the name, the candidates are narrowed down using
+// selection. The newest remaining candidate is returned. It also returns the
+// number of images which had the name.
+//
+// A UUID is looked up as an ID first, and only as a name if no image has that
+// ID.
+func (is *InstanceService) GetImageID(imageName string, selection *ImageSelection) (string, int, error) {
+	if uuid.Validate(imageName) == nil {
+		image, err := images.Get(is.imagesClient, imageName).Extract()
+		if err == nil {
+			return image.ID, 1, nil
+		}
+		if !capoerrors.IsNotFound(err) {
+			return "", 0, err
+		}
+	}
+
+	pages, err := images.List(is.imagesClient, images.ListOpts{Name: imageName}).AllPages()
+	if err != nil {
+		return "", 0, err
+	}
+
+	allImages, err := images.ExtractImages(pages)
+	if err != nil {
+		return "", 0, err
+	}
+
+	image, err := SelectImage(allImages, selection)
+	if err != nil {
+		return "", len(allImages), fmt.Errorf("image %s: %w", imageName, err)
+	}
+	return image.ID, len(allImages), nil
+}
+
+// SelectImage deterministically selects one of candidates. If there is more
+// than one candidate only active images with all the tags of selection are
+// considered. Of those, images with the preferred visibility are preferred,
+// followed by the most recently created image. Remaining ties are broken by
+// image ID.
+func SelectImage(candidates []images.Image, selection *ImageSelection) (*images.Image, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no image could be found")
+	case 1:
+		return &candidates[0], nil
+	}
+
+	if selection == nil {
+		selection = &ImageSelection{}
+	}
+
+	filtered := make([]images.Image, 0, len(candidates))
+	for _, image := range candidates {
+		if image.Status != images.ImageStatusActive {
+			continue
+		}
+		if !hasAllTags(image.Tags, selection.Tags) {
+			continue
+		}
+		filtered = append(filtered, image)
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("none of the %d images with the name is active and has tags [%s]", len(candidates), strings.Join(selection.Tags, ", "))
+	}
+
+	slices.SortFunc(filtered, func(a, b images.Image) int {
+		if selection.PreferredVisibility != "" {
+			aPreferred := string(a.Visibility) == selection.PreferredVisibility
+			bPreferred := string(b.Visibility) == selection.PreferredVisibility
+			if aPreferred && !bPreferred {
+				return -1
+			}
+			if bPreferred && !aPreferred {
+				return 1
+			}
+		}
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return &filtered[0], nil
+}
+
+func hasAllTags(tags, required []string) bool {
+	for _, tag := range required {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package clients
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+)
+
+func TestSelectImage(t *testing.T) {
+	older := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		candidates []images.Image
+		selection  *ImageSelection
+		expectedID string
+		expectErr  bool
+	}{
+		{
+			name:      "no candidates",
+			expectErr: true,
+		},
+		{
+			name: "single candidate",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusQueued},
+			},
+			expectedID: "a",
+		},
+		{
+			name: "newest candidate",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusActive, CreatedAt: older},
+				{ID: "b", Status: images.ImageStatusActive, CreatedAt: newer},
+			},
+			expectedID: "b",
+		},
+		{
+			name: "inactive candidates are ignored",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusActive, CreatedAt: older},
+				{ID: "b", Status: images.ImageStatusDeactivated, CreatedAt: newer},
+			},
+			expectedID: "a",
+		},
+		{
+			name: "candidates without the tags are ignored",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusActive, CreatedAt: older, Tags: []string{"rhcos", "4.16"}},
+				{ID: "b", Status: images.ImageStatusActive, CreatedAt: newer, Tags: []string{"rhcos"}},
+			},
+			selection:  &ImageSelection{Tags: []string{"rhcos", "4.16"}},
+			expectedID: "a",
+		},
+		{
+			name: "preferred visibility",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusActive, CreatedAt: older, Visibility: images.ImageVisibilityPrivate},
+				{ID: "b", Status: images.ImageStatusActive, CreatedAt: newer, Visibility: images.ImageVisibilityPublic},
+			},
+			selection:  &ImageSelection{PreferredVisibility: "private"},
+			expectedID: "a",
+		},
+		{
+			name: "ties are broken by ID",
+			candidates: []images.Image{
+				{ID: "b", Status: images.ImageStatusActive, CreatedAt: newer},
+				{ID: "a", Status: images.ImageStatusActive, CreatedAt: newer},
+			},
+			expectedID: "a",
+		},
+		{
+			name: "no candidate matches",
+			candidates: []images.Image{
+				{ID: "a", Status: images.ImageStatusActive, Tags: []string{"rhcos"}},
+				{ID: "b", Status: images.ImageStatusActive},
+			},
+			selection: &ImageSelection{Tags: []string{"4.16"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := SelectImage(tt.candidates, tt.selection)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got image %s", image.ID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, found one: %v", err)
+			}
+			if image.ID != tt.expectedID {
+				t.Errorf("Expected image %s, got %s", tt.expectedID, image.ID)
+			}
+		})
+	}
+}
+
+func TestGetImageID(t *testing.T) {
+	const (
+		imageID     = "2c4e6a8c-0e2a-4c4e-8a8c-0e2a4c6e8a0c"
+		namedID     = "8a0c2e4a-6c8e-4a0c-9e4a-6c8e0a2c4e6a"
+		missingUUID = "5b7d9f1b-3d5f-4b7d-8f1b-3d5f7b9d1f3b"
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v2/images/"+imageID:
+			fmt.Fprintf(w, `{"id": %q, "name": "rhcos", "status": "active"}`, imageID)
+		case r.URL.Path == "/v2/images" && r.URL.Query().Get("name") == "rhcos":
+			fmt.Fprintf(w, `{"images": [{"id": %q, "name": "rhcos", "status": "active"}]}`, imageID)
+		case r.URL.Path == "/v2/images" && r.URL.Query().Get("name") == missingUUID:
+			fmt.Fprintf(w, `{"images": [{"id": %q, "name": %q, "status": "active"}]}`, namedID, missingUUID)
+		case r.URL.Path == "/v2/images":
+			fmt.Fprint(w, `{"images": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	is := &InstanceService{
+		imagesClient: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{HTTPClient: *server.Client()},
+			Endpoint:       server.URL + "/v2/",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		image      string
+		expectedID string
+		expectErr  bool
+	}{
+		{
+			name:       "by name",
+			image:      "rhcos",
+			expectedID: imageID,
+		},
+		{
+			name:       "by ID",
+			image:      imageID,
+			expectedID: imageID,
+		},
+		{
+			name:       "UUID which is a name",
+			image:      missingUUID,
+			expectedID: namedID,
+		},
+		{
+			name:      "missing image",
+			image:     "fedora",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _, err := is.GetImageID(tt.image, nil)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got image %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id != tt.expectedID {
+				t.Errorf("Expected image %s, got %s", tt.expectedID, id)
+			}
+		})
+	}
+}
@@ -17,46 +17,97 @@ limitations under the License.
 package clients
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	volumeazs "github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/availabilityzones"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/extendedstatus"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/instanceactions"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/pauseunpause"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/suspendresume"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/volumeattach"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	networkextensions "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/qos/policies"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"github.com/gophercloud/gophercloud/openstack/placement/v1/resourceproviders"
 	"github.com/gophercloud/utils/openstack/clientconfig"
 	azutils "github.com/gophercloud/utils/openstack/compute/v2/availabilityzones"
 	flavorutils "github.com/gophercloud/utils/openstack/compute/v2/flavors"
-	imageutils "github.com/gophercloud/utils/openstack/imageservice/v2/images"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/klog/v2"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
 )
 
 type InstanceService struct {
-	computeClient *gophercloud.ServiceClient
-	imagesClient  *gophercloud.ServiceClient
+	computeClient   *gophercloud.ServiceClient
+	imagesClient    *gophercloud.ServiceClient
+	baremetalClient *gophercloud.ServiceClient
+	volumeClient    *gophercloud.ServiceClient
+	networkClient   *gophercloud.ServiceClient
+	placementClient *gophercloud.ServiceClient
+	dnsClient       *gophercloud.ServiceClient
+
+	// computeMicroversion is the highest compute microversion the calls of
+	// the instance service may use, if computeMicroversionKnown. The checks
+	// of a machine use the instance service concurrently.
+	computeMicroversionMu    sync.Mutex
+	computeMicroversion      string
+	computeMicroversionKnown bool
 }
 
 // TODO: Eventually we'll have a NewInstanceServiceFromCluster too
-func NewInstanceServiceFromMachine(kubeClient kubernetes.Interface, machine *machinev1.Machine) (*InstanceService, error) {
+func NewInstanceServiceFromMachine(ctx context.Context, kubeClient kubernetes.Interface, machine *machinev1.Machine) (*InstanceService, error) {
 	cloud, err := GetCloud(kubeClient, machine)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewInstanceServiceFromCloud(cloud, GetCACertificate(kubeClient))
+	// An invalid providerSpec is reported by the validation of the machine
+	var computeMicroversion string
+	if extensions, err := ExtensionsFromProviderSpec(machine.Spec.ProviderSpec); err == nil {
+		computeMicroversion = extensions.ComputeMicroversion
+	}
+	return newInstanceServiceFromCloud(ctx, cloud, GetCACertificate(kubeClient), computeMicroversion)
 }
 
 func NewInstanceService() (*InstanceService, error) {
 	cloud := clientconfig.Cloud{}
-	return NewInstanceServiceFromCloud(cloud, nil)
+	return NewInstanceServiceFromCloud(context.Background(), cloud, nil)
 }
 
-func NewInstanceServiceFromCloud(cloud clientconfig.Cloud, cert []byte) (*InstanceService, error) {
-	provider, err := GetProviderClient(cloud, cert)
+// NewInstanceServiceFromCloud returns an instance service for cloud. Its
+// provider client is shared with the other instance services with the same
+// credentials and CA certificate until half way through the lifetime of its
+// token. The requests of the instance service are made with ctx, so they are
+// cancelled with it.
+func NewInstanceServiceFromCloud(ctx context.Context, cloud clientconfig.Cloud, cert []byte) (*InstanceService, error) {
+	return newInstanceServiceFromCloud(ctx, cloud, cert, "")
+}
+
+// newInstanceServiceFromCloud is NewInstanceServiceFromCloud with
+// computeMicroversion as the highest compute microversion, if it is not empty.
+func newInstanceServiceFromCloud(ctx context.Context, cloud clientconfig.Cloud, cert []byte, computeMicroversion string) (*InstanceService, error) {
+	provider, err := providerClients.get(cloud, cert)
 	if err != nil {
 		return nil, err
 	}
+	provider = providerClientWithContext(ctx, provider)
 
 	computeClient, err := openstack.NewComputeV2(provider, gophercloud.EndpointOpts{
 		Region: cloud.RegionName,
@@ -72,10 +123,63 @@ func NewInstanceServiceFromCloud(cloud clientconfig.Cloud, cert []byte) (*Instan
 		return nil, fmt.Errorf("create ImageClient err: %v", err)
 	}
 
-	return &InstanceService{
-		computeClient: computeClient,
-		imagesClient:  imagesClient,
-	}, nil
+	// The bare metal service is optional. It is only used to report
+	// progress, and many clouds don't have it or don't expose it to us.
+	baremetalClient, err := openstack.NewBareMetalV1(provider, gophercloud.EndpointOpts{
+		Region: cloud.RegionName,
+	})
+	if err != nil {
+		klog.V(4).Infof("Bare metal service is not available: %v", err)
+		baremetalClient = nil
+	}
+
+	// The block storage service is only required for root volumes
+	volumeClient, err := openstack.NewBlockStorageV3(provider, gophercloud.EndpointOpts{
+		Region: cloud.RegionName,
+	})
+	if err != nil {
+		klog.V(4).Infof("Block storage service is not available: %v", err)
+		volumeClient = nil
+	}
+
+	networkClient, err := openstack.NewNetworkV2(provider, gophercloud.EndpointOpts{
+		Region: cloud.RegionName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create NetworkClient err: %v", err)
+	}
+
+	// The placement service is optional. It is only used to check that
+	// resources requested by flavors exist.
+	placementClient, err := openstack.NewPlacementV1(provider, gophercloud.EndpointOpts{
+		Region: cloud.RegionName,
+	})
+	if err != nil {
+		klog.V(4).Infof("Placement service is not available: %v", err)
+		placementClient = nil
+	}
+
+	// The DNS service is optional. It is only used to check that the DNS
+	// names of machines don't collide with existing records.
+	dnsClient, err := openstack.NewDNSV2(provider, gophercloud.EndpointOpts{
+		Region: cloud.RegionName,
+	})
+	if err != nil {
+		klog.V(4).Infof("DNS service is not available: %v", err)
+		dnsClient = nil
+	}
+
+	is := &InstanceService{
+		computeClient:   computeClient,
+		imagesClient:    imagesClient,
+		baremetalClient: baremetalClient,
+		volumeClient:    volumeClient,
+		networkClient:   networkClient,
+		placementClient: placementClient,
+		dnsClient:       dnsClient,
+	}
+	is.initComputeMicroversion(computeMicroversion)
+	return is, nil
 }
 
 // DoesFlavorExist returns nil if exactly one flavor exists with the given name.
@@ -84,12 +188,36 @@ func (is *InstanceService) DoesFlavorExist(flavorName string) error {
 	return err
 }
 
-// DoesImageExist returns nil if exactly one image exists with the given name.
-func (is *InstanceService) DoesImageExist(imageName string) error {
-	_, err := imageutils.IDFromName(is.imagesClient, imageName)
+// DoesImageExist returns nil if an image with the given ID exists, or one with
+// the given name can be selected using selection.
+func (is *InstanceService) DoesImageExist(imageName string, selection *ImageSelection) error {
+	_, _, err := is.GetImageID(imageName, selection)
 	return err
 }
 
+// DoesVolumeTypeExist returns nil if a volume type exists with the given name
+// or ID.
+func (is *InstanceService) DoesVolumeTypeExist(volumeType string) error {
+	if is.volumeClient == nil {
+		return fmt.Errorf("block storage service is not available to look up volume type %s", volumeType)
+	}
+
+	pages, err := volumetypes.List(is.volumeClient, volumetypes.ListOpts{}).AllPages()
+	if err != nil {
+		return err
+	}
+	allVolumeTypes, err := volumetypes.ExtractVolumeTypes(pages)
+	if err != nil {
+		return err
+	}
+	for _, vt := range allVolumeTypes {
+		if vt.Name == volumeType || vt.ID == volumeType {
+			return nil
+		}
+	}
+	return fmt.Errorf("could not find volume type: %s", volumeType)
+}
+
 // DoesAvailabilityZoneExist return an error if AZ with the given name doesn't exist, and nil otherwise
 func (is *InstanceService) DoesAvailabilityZoneExist(azName string) error {
 	if azName == "" {
@@ -110,6 +238,38 @@ func (is *InstanceService) DoesAvailabilityZoneExist(azName string) error {
 	return fmt.Errorf("could not find compute availability zone: %s", azName)
 }
 
+// ListAvailabilityZones returns the names of the available compute
+// availability zones.
+func (is *InstanceService) ListAvailabilityZones() ([]string, error) {
+	return azutils.ListAvailableAvailabilityZones(is.computeClient)
+}
+
+// ListVolumeAvailabilityZones returns the names of the available block storage
+// availability zones. It returns false if the block storage service is not
+// available.
+func (is *InstanceService) ListVolumeAvailabilityZones() ([]string, bool, error) {
+	if is.volumeClient == nil {
+		return nil, false, nil
+	}
+
+	pages, err := volumeazs.List(is.volumeClient).AllPages()
+	if err != nil {
+		return nil, true, err
+	}
+	zones, err := volumeazs.ExtractAvailabilityZones(pages)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var names []string
+	for _, zone := range zones {
+		if zone.ZoneState.Available {
+			names = append(names, zone.ZoneName)
+		}
+	}
+	return names, true, nil
+}
+
 func (is *InstanceService) GetFlavorInfo(flavorID string) (flavor *flavors.Flavor, err error) {
 
 	info, err := flavors.Get(is.computeClient, flavorID).Extract()
@@ -119,23 +279,69 @@ func (is *InstanceService) GetFlavorInfo(flavorID string) (flavor *flavors.Flavo
 	return info, nil
 }
 
+// GetFlavorExtraSpecs returns the extra specs of the flavor with the given ID.
+func (is *InstanceService) GetFlavorExtraSpecs(flavorID string) (map[string]string, error) {
+	extraSpecs, err := flavors.ListExtraSpecs(is.computeClient, flavorID).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("could not list extra specs of flavor id %s: %w", flavorID, err)
+	}
+	return extraSpecs, nil
+}
+
 func (is *InstanceService) GetFlavorID(flavorName string) (string, error) {
 	return flavorutils.IDFromName(is.computeClient, flavorName)
 }
 
-func (is *InstanceService) CreateServerGroup(name string) (*servergroups.ServerGroup, error) {
-	// Microversion "2.15" is the first that supports "soft"-anti-affinity.
-	// Microversions starting from "2.64" accept policies as a string
-	// instead of an array.
-	defer func(microversion string) {
-		is.computeClient.Microversion = microversion
-	}(is.computeClient.Microversion)
-	is.computeClient.Microversion = "2.15"
+// Server group policies supported by CreateServerGroup
+const (
+	ServerGroupPolicyAffinity         = "affinity"
+	ServerGroupPolicyAntiAffinity     = "anti-affinity"
+	ServerGroupPolicySoftAffinity     = "soft-affinity"
+	ServerGroupPolicySoftAntiAffinity = "soft-anti-affinity"
+)
+
+// ValidateServerGroupPolicy returns an error if policy is not a server group
+// policy supported by CreateServerGroup. The empty string is valid, and means
+// ServerGroupPolicySoftAntiAffinity.
+func ValidateServerGroupPolicy(policy string) error {
+	switch policy {
+	case "", ServerGroupPolicyAffinity, ServerGroupPolicyAntiAffinity, ServerGroupPolicySoftAffinity, ServerGroupPolicySoftAntiAffinity:
+		return nil
+	}
+	return fmt.Errorf("invalid server group policy %q: must be one of %s, %s, %s or %s", policy,
+		ServerGroupPolicyAffinity, ServerGroupPolicyAntiAffinity, ServerGroupPolicySoftAffinity, ServerGroupPolicySoftAntiAffinity)
+}
+
+func (is *InstanceService) CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error) {
+	if policy == "" {
+		policy = ServerGroupPolicySoftAntiAffinity
+	}
+
+	// Microversion "2.64" replaces the array of policies by a single
+	// policy. Older clouds need "2.15", the first that supports
+	// "soft"-affinity and "soft"-anti-affinity.
+	microversion, opts := "2.64", &servergroups.CreateOpts{Name: name, Policy: policy}
+	if supported, err := is.ComputeMicroversion(); err == nil && !microversionAtLeast(supported, microversion) {
+		microversion, opts = "2.15", &servergroups.CreateOpts{Name: name, Policies: []string{policy}}
+	}
+
+	var serverGroup *servergroups.ServerGroup
+	err := is.withComputeMicroversion(microversion, func(client *gophercloud.ServiceClient) error {
+		var err error
+		serverGroup, err = servergroups.Create(client, opts).Extract()
+		return err
+	})
+	return serverGroup, err
+}
 
-	return servergroups.Create(is.computeClient, &servergroups.CreateOpts{
-		Name:     name,
-		Policies: []string{"soft-anti-affinity"},
-	}).Extract()
+// DeleteServerGroup deletes the server group with the given ID. It is not an
+// error if the server group does not exist.
+func (is *InstanceService) DeleteServerGroup(id string) error {
+	err := servergroups.Delete(is.computeClient, id).ExtractErr()
+	if capoerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
 }
 
 func (is *InstanceService) GetServerGroupsByName(name string) ([]servergroups.ServerGroup, error) {
@@ -166,3 +372,565 @@ func (is *InstanceService) GetServerGroupByID(id string) (*servergroups.ServerGr
 	}
 	return servergroup, nil
 }
+
+// GetServerTaskState returns the task state of the server with the given ID,
+// e.g. "deleting". It returns the empty string if no task is in progress.
+func (is *InstanceService) GetServerTaskState(serverID string) (string, error) {
+	var server extendedstatus.ServerExtendedStatusExt
+	if err := servers.Get(is.computeClient, serverID).ExtractInto(&server); err != nil {
+		return "", err
+	}
+	return server.TaskState, nil
+}
+
+// ListServersByTag returns all servers with the given tag.
+func (is *InstanceService) ListServersByTag(tag string) ([]servers.Server, error) {
+	// Microversion "2.26" is the first that supports filtering by tags.
+	var allServers []servers.Server
+	err := is.withComputeMicroversion("2.26", func(client *gophercloud.ServiceClient) error {
+		pages, err := servers.List(client, servers.ListOpts{Tags: tag}).AllPages()
+		if err != nil {
+			return err
+		}
+		allServers, err = servers.ExtractServers(pages)
+		return err
+	})
+	return allServers, err
+}
+
+// DeleteServer deletes the server with the given ID. It is not an error if
+// the server does not exist.
+func (is *InstanceService) DeleteServer(serverID string) error {
+	err := servers.Delete(is.computeClient, serverID).ExtractErr()
+	if capoerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// SetServerMetadata sets the given metadata items of the server with the
+// given ID, leaving its other metadata alone.
+func (is *InstanceService) SetServerMetadata(serverID string, metadata map[string]string) error {
+	_, err := servers.UpdateMetadata(is.computeClient, serverID, servers.MetadataOpts(metadata)).Extract()
+	return err
+}
+
+// IsServerLocked returns true if the server with the given ID is locked, in
+// which case it can't be deleted until it is unlocked.
+func (is *InstanceService) IsServerLocked(serverID string) (bool, error) {
+	// Microversion "2.9" is the first that returns the locked attribute.
+	var server struct {
+		Locked bool `json:"locked"`
+	}
+	err := is.withComputeMicroversion("2.9", func(client *gophercloud.ServiceClient) error {
+		return servers.Get(client, serverID).ExtractInto(&server)
+	})
+	return server.Locked, err
+}
+
+// ServerIdentity is the description and hostname of a server, which Nova
+// shows to its users and in the metadata service.
+type ServerIdentity struct {
+	Description string `json:"description,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+}
+
+// GetServerIdentity returns the description and hostname of the server with
+// the given ID. The microversion must be at least "2.19" for the description,
+// and "2.90" for the hostname, which is only shown to admins before.
+func (is *InstanceService) GetServerIdentity(serverID, microversion string) (ServerIdentity, error) {
+	var server struct {
+		Description *string `json:"description"`
+		Hostname    string  `json:"OS-EXT-SRV-ATTR:hostname"`
+	}
+	err := is.withComputeMicroversion(microversion, func(client *gophercloud.ServiceClient) error {
+		return servers.Get(client, serverID).ExtractInto(&server)
+	})
+	if err != nil {
+		return ServerIdentity{}, err
+	}
+
+	identity := ServerIdentity{Hostname: server.Hostname}
+	if server.Description != nil {
+		identity.Description = *server.Description
+	}
+	return identity, nil
+}
+
+// UpdateServerIdentity sets the non-empty description and hostname of
+// identity on the server with the given ID. The microversion must be at least
+// "2.19" for the description, "2.90" for the hostname, and "2.94" for a fully
+// qualified hostname.
+func (is *InstanceService) UpdateServerIdentity(serverID, microversion string, identity ServerIdentity) error {
+	return is.withComputeMicroversion(microversion, func(client *gophercloud.ServiceClient) error {
+		_, err := client.Put(client.ServiceURL("servers", serverID), map[string]interface{}{"server": identity}, nil, &gophercloud.RequestOpts{
+			OkCodes: []int{200},
+		})
+		return err
+	})
+}
+
+// UnpauseServer unpauses the paused server with the given ID.
+func (is *InstanceService) UnpauseServer(serverID string) error {
+	return pauseunpause.Unpause(is.computeClient, serverID).ExtractErr()
+}
+
+// ResumeServer resumes the suspended server with the given ID.
+func (is *InstanceService) ResumeServer(serverID string) error {
+	return suspendresume.Resume(is.computeClient, serverID).ExtractErr()
+}
+
+// GetBaremetalProvisionState returns the provision state of the bare metal
+// node hosting the server with the given ID. It returns the empty string if
+// the bare metal service is not available or no node hosts the server.
+func (is *InstanceService) GetBaremetalProvisionState(serverID string) (string, error) {
+	if is.baremetalClient == nil {
+		return "", nil
+	}
+
+	pages, err := nodes.List(is.baremetalClient, nodes.ListOpts{
+		InstanceUUID: serverID,
+		Fields:       []string{"uuid", "provision_state"},
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	allNodes, err := nodes.ExtractNodes(pages)
+	if err != nil {
+		return "", err
+	}
+	if len(allNodes) == 0 {
+		return "", nil
+	}
+	return allNodes[0].ProvisionState, nil
+}
+
+// GetServerActions returns the most recent actions performed on the server
+// with the given ID, newest first, including their events.
+func (is *InstanceService) GetServerActions(serverID string, limit int) ([]instanceactions.InstanceActionDetail, error) {
+	pages, err := instanceactions.List(is.computeClient, serverID, instanceactions.ListOpts{Limit: limit}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := instanceactions.ExtractInstanceActions(pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(actions) > limit {
+		actions = actions[:limit]
+	}
+
+	// Microversion "2.51" is the first that returns action events to
+	// non-admin users.
+	details := make([]instanceactions.InstanceActionDetail, len(actions))
+	err = is.withComputeMicroversion("2.51", func(client *gophercloud.ServiceClient) error {
+		for i := range actions {
+			var err error
+			details[i], err = instanceactions.Get(client, serverID, actions[i].RequestID).Extract()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// GetQoSPolicyID returns the ID of the QoS policy with the given name or ID.
+func (is *InstanceService) GetQoSPolicyID(nameOrID string) (string, error) {
+	for _, opts := range []policies.ListOpts{{ID: nameOrID}, {Name: nameOrID}} {
+		pages, err := policies.List(is.networkClient, opts).AllPages()
+		if err != nil {
+			return "", err
+		}
+		allPolicies, err := policies.ExtractPolicies(pages)
+		if err != nil {
+			return "", err
+		}
+		switch len(allPolicies) {
+		case 0:
+			continue
+		case 1:
+			return allPolicies[0].ID, nil
+		default:
+			return "", fmt.Errorf("found %d QoS policies named %s", len(allPolicies), nameOrID)
+		}
+	}
+	return "", fmt.Errorf("could not find QoS policy: %s", nameOrID)
+}
+
+// HasResourceProvider returns true if a resource provider has the capacity
+// for the given resources, e.g. VGPU:2. The second value is false if resource
+// providers can't be listed, because the placement service is not available
+// or only administrators may list them.
+func (is *InstanceService) HasResourceProvider(resources string) (bool, bool, error) {
+	if is.placementClient == nil {
+		return false, false, nil
+	}
+
+	// Listing resource providers by resources requires microversion 1.4
+	client := *is.placementClient
+	client.Microversion = "1.4"
+	pages, err := resourceproviders.List(&client, resourceproviders.ListOpts{Resources: resources}).AllPages()
+	var forbidden gophercloud.ErrDefault403
+	if capoerrors.IsNotFound(err) || errors.As(err, &forbidden) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, true, err
+	}
+	providers, err := resourceproviders.ExtractResourceProviders(pages)
+	if err != nil {
+		return false, true, err
+	}
+	return len(providers) > 0, true, nil
+}
+
+// PortWithQoSPolicy is a port and the ID of its QoS policy.
+type PortWithQoSPolicy struct {
+	ports.Port
+	policies.QoSPolicyExt
+}
+
+// ListPortsWithQoSPolicy returns the ports of the server with the given ID
+// with their QoS policies.
+func (is *InstanceService) ListPortsWithQoSPolicy(serverID string) ([]PortWithQoSPolicy, error) {
+	pages, err := ports.List(is.networkClient, ports.ListOpts{DeviceID: serverID}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	var allPorts []PortWithQoSPolicy
+	if err := ports.ExtractPortsInto(pages, &allPorts); err != nil {
+		return nil, err
+	}
+	return allPorts, nil
+}
+
+// SetPortQoSPolicy sets the QoS policy of the port with the given ID.
+func (is *InstanceService) SetPortQoSPolicy(portID, policyID string) error {
+	return ports.Update(is.networkClient, portID, policies.PortUpdateOptsExt{
+		UpdateOptsBuilder: ports.UpdateOpts{},
+		QoSPolicyID:       &policyID,
+	}).Err
+}
+
+// PortWithDNS is a port and its DNS attributes, which are set by the DNS
+// integration of Neutron.
+type PortWithDNS struct {
+	ports.Port
+	DNSName string `json:"dns_name"`
+}
+
+// ListPortsByDNSName returns the ports whose dns_name is dnsName.
+func (is *InstanceService) ListPortsByDNSName(dnsName string) ([]PortWithDNS, error) {
+	// Gophercloud has no support for the dns extension
+	pages, err := ports.List(is.networkClient, dnsNameListOpts{DNSName: dnsName}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	var allPorts []PortWithDNS
+	if err := ports.ExtractPortsInto(pages, &allPorts); err != nil {
+		return nil, err
+	}
+	return allPorts, nil
+}
+
+type dnsNameListOpts struct {
+	DNSName string `q:"dns_name"`
+}
+
+func (opts dnsNameListOpts) ToPortListQuery() (string, error) {
+	query, err := gophercloud.BuildQueryString(opts)
+	if err != nil {
+		return "", err
+	}
+	return query.String(), nil
+}
+
+// GetNetworkDNSDomain returns the dns_domain of the network with the given
+// ID, which is empty if the network has none.
+func (is *InstanceService) GetNetworkDNSDomain(networkID string) (string, error) {
+	var network struct {
+		DNSDomain string `json:"dns_domain"`
+	}
+	if err := networks.Get(is.networkClient, networkID).ExtractInto(&network); err != nil {
+		return "", err
+	}
+	return network.DNSDomain, nil
+}
+
+// DNSRecordSet is a recordset of the DNS service.
+type DNSRecordSet struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	ZoneName string   `json:"zone_name"`
+	Records  []string `json:"records"`
+}
+
+// ListDNSRecordSets returns the recordsets of the DNS service with the given
+// fully qualified name, in all the zones of the project. It returns false if
+// the DNS service is not available.
+func (is *InstanceService) ListDNSRecordSets(name string) ([]DNSRecordSet, bool, error) {
+	if is.dnsClient == nil {
+		return nil, false, nil
+	}
+
+	// Gophercloud's dns package is not vendored
+	query, err := gophercloud.BuildQueryString(struct {
+		Name string `q:"name"`
+	}{Name: name})
+	if err != nil {
+		return nil, true, err
+	}
+	var body struct {
+		RecordSets []DNSRecordSet `json:"recordsets"`
+	}
+	if _, err := is.dnsClient.Get(is.dnsClient.ServiceURL("recordsets")+query.String(), &body, nil); err != nil {
+		return nil, true, err
+	}
+	return body.RecordSets, true, nil
+}
+
+// ComputeLimits are the absolute compute limits of the project and its usage
+// of them. A limit of -1 is unlimited.
+type ComputeLimits struct {
+	MaxTotalCores      int `json:"maxTotalCores"`
+	MaxTotalRAMSize    int `json:"maxTotalRAMSize"`
+	MaxTotalInstances  int `json:"maxTotalInstances"`
+	TotalCoresUsed     int `json:"totalCoresUsed"`
+	TotalRAMUsed       int `json:"totalRAMUsed"`
+	TotalInstancesUsed int `json:"totalInstancesUsed"`
+}
+
+// GetComputeLimits returns the compute limits of the project.
+func (is *InstanceService) GetComputeLimits() (*ComputeLimits, error) {
+	// Gophercloud's limits extension is not vendored
+	var body struct {
+		Limits struct {
+			Absolute ComputeLimits `json:"absolute"`
+		} `json:"limits"`
+	}
+	if _, err := is.computeClient.Get(is.computeClient.ServiceURL("limits"), &body, nil); err != nil {
+		return nil, err
+	}
+	return &body.Limits.Absolute, nil
+}
+
+// NetworkQuota is a network quota of the project and its usage. A limit of
+// -1 is unlimited.
+type NetworkQuota struct {
+	Limit    int `json:"limit"`
+	Used     int `json:"used"`
+	Reserved int `json:"reserved"`
+}
+
+// NetworkQuotas are the network quotas of the project which the resources of
+// a machine count against.
+type NetworkQuotas struct {
+	Port              NetworkQuota `json:"port"`
+	FloatingIP        NetworkQuota `json:"floatingip"`
+	SecurityGroupRule NetworkQuota `json:"security_group_rule"`
+}
+
+// GetNetworkQuotas returns the network quotas of the project with the given
+// ID, which requires the quota_details extension.
+func (is *InstanceService) GetNetworkQuotas(projectID string) (*NetworkQuotas, error) {
+	// Gophercloud's quotas extension is not vendored
+	var body struct {
+		Quota NetworkQuotas `json:"quota"`
+	}
+	if _, err := is.networkClient.Get(is.networkClient.ServiceURL("quotas", projectID, "details"), &body, nil); err != nil {
+		return nil, err
+	}
+	return &body.Quota, nil
+}
+
+// HasNetworkExtension returns true if the network service has the extension
+// with the given alias, e.g. trunk.
+func (is *InstanceService) HasNetworkExtension(alias string) (bool, error) {
+	_, err := networkextensions.Get(is.networkClient, alias).Extract()
+	if capoerrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NetworkSegment is a segment of a routed provider network.
+type NetworkSegment struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListNetworkSegments returns the segments of the network with the given ID.
+func (is *InstanceService) ListNetworkSegments(networkID string) ([]NetworkSegment, error) {
+	// Gophercloud has no support for the segments extension
+	query, err := gophercloud.BuildQueryString(struct {
+		NetworkID string `q:"network_id"`
+	}{networkID})
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Segments []NetworkSegment `json:"segments"`
+	}
+	if _, err := is.networkClient.Get(is.networkClient.ServiceURL("segments")+query.String(), &body, nil); err != nil {
+		return nil, err
+	}
+	return body.Segments, nil
+}
+
+// SubnetWithSegment is a subnet and the ID of the segment of its network it
+// is associated with, if any.
+type SubnetWithSegment struct {
+	subnets.Subnet
+	SegmentID string `json:"segment_id"`
+}
+
+// ListSubnetsWithSegment returns the subnets of the network with the given ID
+// with their segments.
+func (is *InstanceService) ListSubnetsWithSegment(networkID string) ([]SubnetWithSegment, error) {
+	pages, err := subnets.List(is.networkClient, subnets.ListOpts{NetworkID: networkID}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	var allSubnets []SubnetWithSegment
+	if err := pages.(subnets.SubnetPage).ExtractIntoSlicePtr(&allSubnets, "subnets"); err != nil {
+		return nil, err
+	}
+	return allSubnets, nil
+}
+
+// GetVolumeByName returns the volume with the given name, or nil if there is
+// none.
+func (is *InstanceService) GetVolumeByName(name string) (*volumes.Volume, error) {
+	if is.volumeClient == nil {
+		return nil, fmt.Errorf("block storage service is not available to look up volume %s", name)
+	}
+
+	pages, err := volumes.List(is.volumeClient, volumes.ListOpts{Name: name}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	allVolumes, err := volumes.ExtractVolumes(pages)
+	if err != nil {
+		return nil, err
+	}
+	switch len(allVolumes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &allVolumes[0], nil
+	default:
+		return nil, fmt.Errorf("%d volumes named %s exist", len(allVolumes), name)
+	}
+}
+
+// SetVolumeMetadata replaces the metadata of the volume with the given ID.
+func (is *InstanceService) SetVolumeMetadata(volumeID string, metadata map[string]string) error {
+	if is.volumeClient == nil {
+		return fmt.Errorf("block storage service is not available to update volume %s", volumeID)
+	}
+	return volumes.Update(is.volumeClient, volumeID, volumes.UpdateOpts{Metadata: metadata}).Err
+}
+
+// DeleteVolume deletes the volume with the given ID.
+func (is *InstanceService) DeleteVolume(volumeID string) error {
+	if is.volumeClient == nil {
+		return fmt.Errorf("block storage service is not available to delete volume %s", volumeID)
+	}
+	return volumes.Delete(is.volumeClient, volumeID, volumes.DeleteOpts{}).ExtractErr()
+}
+
+// GetVolume returns the volume with the given ID.
+func (is *InstanceService) GetVolume(volumeID string) (*volumes.Volume, error) {
+	if is.volumeClient == nil {
+		return nil, fmt.Errorf("block storage service is not available to look up volume %s", volumeID)
+	}
+	return volumes.Get(is.volumeClient, volumeID).Extract()
+}
+
+// ListAttachedVolumeIDs returns the IDs of the volumes attached to the server
+// with the given ID.
+func (is *InstanceService) ListAttachedVolumeIDs(serverID string) ([]string, error) {
+	pages, err := volumeattach.List(is.computeClient, serverID).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := volumeattach.ExtractVolumeAttachments(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeIDs := make([]string, len(attachments))
+	for i := range attachments {
+		volumeIDs[i] = attachments[i].VolumeID
+	}
+	return volumeIDs, nil
+}
+
+// AttachVolume attaches the volume with the given ID to the server with the
+// given ID.
+func (is *InstanceService) AttachVolume(serverID, volumeID string) error {
+	// Microversion "2.60" is the first that supports attaching multiattach
+	// volumes.
+	return is.withComputeMicroversion("2.60", func(client *gophercloud.ServiceClient) error {
+		return volumeattach.Create(client, serverID, volumeattach.CreateOpts{VolumeID: volumeID}).Err
+	})
+}
+
+// DetachVolume detaches the volume with the given ID from the server with the
+// given ID. The volume is detached asynchronously.
+func (is *InstanceService) DetachVolume(serverID, volumeID string) error {
+	return volumeattach.Delete(is.computeClient, serverID, volumeID).ExtractErr()
+}
+
+// ExtendVolume extends the volume with the given ID to size GiB.
+func (is *InstanceService) ExtendVolume(volumeID string, size int) error {
+	if is.volumeClient == nil {
+		return fmt.Errorf("block storage service is not available to extend volume %s", volumeID)
+	}
+
+	// Microversion "3.42" is the first that supports extending volumes
+	// which are attached to a server.
+	client := *is.volumeClient
+	client.Microversion = "3.42"
+
+	return volumeactions.ExtendSize(&client, volumeID, volumeactions.ExtendSizeOpts{NewSize: size}).ExtractErr()
+}
+
+// RebootServer soft reboots the server with the given ID.
+func (is *InstanceService) RebootServer(serverID string) error {
+	return servers.Reboot(is.computeClient, serverID, servers.RebootOpts{Type: servers.SoftReboot}).ExtractErr()
+}
+
+// RebuildServer rebuilds the server with the given ID from the image with the
+// given ID. The server keeps its ID, ports and metadata.
+func (is *InstanceService) RebuildServer(serverID, imageID string) error {
+	return servers.Rebuild(is.computeClient, serverID, servers.RebuildOpts{ImageRef: imageID}).Err
+}
+
+// GetKeyPair returns the keypair of the user with the given name, or nil if
+// there is none.
+func (is *InstanceService) GetKeyPair(name string) (*keypairs.KeyPair, error) {
+	keyPair, err := keypairs.Get(is.computeClient, name, nil).Extract()
+	if capoerrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return keyPair, err
+}
+
+// CreateKeyPair imports the public key as a keypair of the user with the
+// given name.
+func (is *InstanceService) CreateKeyPair(name, publicKey string) error {
+	return keypairs.Create(is.computeClient, keypairs.CreateOpts{Name: name, PublicKey: publicKey}).Err
+}
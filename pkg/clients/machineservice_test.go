@@ -27,3 +27,16 @@ func TestMachineServiceInstance(t *testing.T) {
 		t.Errorf("Couldn't create instance service: %v", err)
 	}
 }
+
+func TestValidateServerGroupPolicy(t *testing.T) {
+	for _, policy := range []string{"", "affinity", "anti-affinity", "soft-affinity", "soft-anti-affinity"} {
+		if err := ValidateServerGroupPolicy(policy); err != nil {
+			t.Errorf("Expected policy %q to be valid, got: %v", policy, err)
+		}
+	}
+	for _, policy := range []string{"Affinity", "anti_affinity", "spread"} {
+		if err := ValidateServerGroupPolicy(policy); err == nil {
+			t.Errorf("Expected policy %q to be invalid", policy)
+		}
+	}
+}
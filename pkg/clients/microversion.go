@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/klog/v2"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+)
+
+// microversionCacheTTL is how long the negotiated microversion of a compute
+// endpoint is used before it is negotiated again, so that upgrades of the
+// cloud are picked up.
+const microversionCacheTTL = time.Hour
+
+// ComputeMicroversionUnsupportedError is returned by calls which need a
+// compute microversion which is higher than the one the instance service may
+// use.
+type ComputeMicroversionUnsupportedError struct {
+	// Required is the microversion the call needs.
+	Required string
+
+	// Supported is the microversion the instance service may use. It is
+	// empty if the compute service has no microversions.
+	Supported string
+}
+
+func (e *ComputeMicroversionUnsupportedError) Error() string {
+	if e.Supported == "" {
+		return fmt.Sprintf("compute microversion %s is required, but the compute service has no microversions", e.Required)
+	}
+	return fmt.Sprintf("compute microversion %s is required, but only %s is supported", e.Required, e.Supported)
+}
+
+type negotiatedMicroversion struct {
+	microversion string
+	expires      time.Time
+}
+
+// computeMicroversions caches the negotiated microversions by compute
+// endpoint, as most instance services need them and they rarely change.
+var computeMicroversions = struct {
+	sync.Mutex
+	byEndpoint map[string]negotiatedMicroversion
+}{byEndpoint: make(map[string]negotiatedMicroversion)}
+
+// negotiateComputeMicroversion returns the highest microversion of the
+// compute service of client, from the version document of its endpoint. It
+// is empty if the compute service has no microversions.
+func negotiateComputeMicroversion(client *gophercloud.ServiceClient) (string, error) {
+	endpoint := client.ServiceURL()
+	now := time.Now()
+
+	computeMicroversions.Lock()
+	cached, ok := computeMicroversions.byEndpoint[endpoint]
+	computeMicroversions.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.microversion, nil
+	}
+
+	var body struct {
+		Version struct {
+			Version string `json:"version"`
+		} `json:"version"`
+	}
+	if _, err := client.Get(endpoint, &body, nil); err != nil {
+		return "", fmt.Errorf("error getting the version of the compute service: %w", err)
+	}
+
+	computeMicroversions.Lock()
+	computeMicroversions.byEndpoint[endpoint] = negotiatedMicroversion{
+		microversion: body.Version.Version,
+		expires:      now.Add(microversionCacheTTL),
+	}
+	computeMicroversions.Unlock()
+	return body.Version.Version, nil
+}
+
+// ValidateComputeMicroversion returns an error if microversion can't be used
+// as the compute microversion of machines: it must be a valid microversion,
+// and at least the microversion servers are created with.
+func ValidateComputeMicroversion(microversion string) error {
+	if _, _, ok := parseMicroversion(microversion); !ok {
+		return fmt.Errorf("invalid compute microversion %q: must be of the form 2.60", microversion)
+	}
+	if !microversionAtLeast(microversion, capoclients.NovaMinimumMicroversion) {
+		return fmt.Errorf("invalid compute microversion %s: must be at least %s", microversion, capoclients.NovaMinimumMicroversion)
+	}
+	return nil
+}
+
+// SetComputeMicroversion makes microversion the highest compute microversion
+// the calls of the instance service may use, instead of the negotiated one.
+func (is *InstanceService) SetComputeMicroversion(microversion string) {
+	is.computeMicroversionMu.Lock()
+	defer is.computeMicroversionMu.Unlock()
+
+	is.computeMicroversion = microversion
+	is.computeMicroversionKnown = true
+}
+
+// initComputeMicroversion sets the compute microversion of a new instance
+// service to override, if it is not empty, without negotiating it. Otherwise
+// the compute microversion is negotiated once per endpoint and cached, and if
+// that fails it is negotiated again when it is first needed.
+func (is *InstanceService) initComputeMicroversion(override string) {
+	if override != "" {
+		is.SetComputeMicroversion(override)
+		return
+	}
+	if _, err := is.ComputeMicroversion(); err != nil {
+		klog.V(4).Infof("Compute microversion could not be negotiated: %v", err)
+	}
+}
+
+// ComputeMicroversion returns the highest compute microversion the calls of
+// the instance service may use: the one set with SetComputeMicroversion, or
+// else the highest one supported by the compute service. It is empty if the
+// compute service has no microversions.
+func (is *InstanceService) ComputeMicroversion() (string, error) {
+	is.computeMicroversionMu.Lock()
+	defer is.computeMicroversionMu.Unlock()
+
+	if !is.computeMicroversionKnown {
+		microversion, err := negotiateComputeMicroversion(is.computeClient)
+		if err != nil {
+			return "", err
+		}
+		is.computeMicroversion, is.computeMicroversionKnown = microversion, true
+	}
+	return is.computeMicroversion, nil
+}
+
+// Supports returns true if the cloud supports feature.
+func (is *InstanceService) Supports(feature Feature) (bool, error) {
+	capabilities, err := is.GetCapabilities()
+	if err != nil {
+		return false, err
+	}
+	return capabilities.Unsupported(feature) == "", nil
+}
+
+// withComputeMicroversion makes call with a copy of the compute client set to
+// microversion, so that concurrent calls don't change each other's
+// microversion. If the instance service may not use microversion, a
+// ComputeMicroversionUnsupportedError is returned instead. If the
+// microversion can't be negotiated, call is made anyway, so that it fails with
+// the error of the compute service if the microversion is not supported.
+func (is *InstanceService) withComputeMicroversion(microversion string, call func(client *gophercloud.ServiceClient) error) error {
+	if supported, err := is.ComputeMicroversion(); err == nil && !microversionAtLeast(supported, microversion) {
+		return &ComputeMicroversionUnsupportedError{Required: microversion, Supported: supported}
+	}
+
+	client := *is.computeClient
+	client.Microversion = microversion
+	return call(&client)
+}
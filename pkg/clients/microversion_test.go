@@ -0,0 +1,207 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// fakeCompute is a compute service with the given maximum microversion, which
+// records the microversions and bodies of the requests it gets.
+type fakeCompute struct {
+	maxMicroversion string
+	versionRequests int
+	microversions   []string
+	bodies          []map[string]interface{}
+}
+
+func (f *fakeCompute) serve(t *testing.T) *InstanceService {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v2.1/" {
+			f.versionRequests++
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"version": map[string]string{"id": "v2.1", "version": f.maxMicroversion}})
+			return
+		}
+
+		f.microversions = append(f.microversions, r.Header.Get("X-OpenStack-Nova-API-Version"))
+		var body map[string]interface{}
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("Invalid request body: %v", err)
+			}
+		}
+		f.bodies = append(f.bodies, body)
+
+		switch {
+		case r.URL.Path == "/v2.1/os-server-groups":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"server_group": map[string]string{"id": "group-id", "name": "group"}})
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"server": map[string]string{"id": "server-id", "description": "old", "OS-EXT-SRV-ATTR:hostname": "worker-0"}})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"server": map[string]string{"id": "server-id"}})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &InstanceService{computeClient: &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{HTTPClient: *server.Client()},
+		Endpoint:       server.URL + "/v2.1/",
+		Type:           "compute",
+	}}
+}
+
+func TestComputeMicroversionNegotiation(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.95"}
+	is := compute.serve(t)
+
+	for range 2 {
+		microversion, err := is.ComputeMicroversion()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if microversion != "2.95" {
+			t.Errorf("Expected microversion 2.95, got %s", microversion)
+		}
+	}
+
+	// Another instance service of the same endpoint uses the cached microversion
+	other := &InstanceService{computeClient: is.computeClient}
+	if microversion, err := other.ComputeMicroversion(); err != nil || microversion != "2.95" {
+		t.Errorf("Expected the cached microversion 2.95, got %q and %v", microversion, err)
+	}
+	if compute.versionRequests != 1 {
+		t.Errorf("Expected the microversion to be negotiated once, got %d requests", compute.versionRequests)
+	}
+}
+
+func TestSetComputeMicroversion(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.95"}
+	is := compute.serve(t)
+	is.SetComputeMicroversion("2.88")
+
+	if microversion, err := is.ComputeMicroversion(); err != nil || microversion != "2.88" {
+		t.Errorf("Expected the overridden microversion 2.88, got %q and %v", microversion, err)
+	}
+	if supported, err := is.Supports(FeatureServerHostname); err != nil || supported {
+		t.Errorf("Expected ServerHostname to be unsupported, got %t and %v", supported, err)
+	}
+	if compute.versionRequests != 0 {
+		t.Errorf("Expected no negotiation, got %d requests", compute.versionRequests)
+	}
+}
+
+func TestWithComputeMicroversion(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.60"}
+	is := compute.serve(t)
+	is.computeClient.Microversion = "2.1"
+
+	err := is.UpdateServerIdentity("server-id", "2.90", ServerIdentity{Hostname: "worker-0"})
+	var unsupported *ComputeMicroversionUnsupportedError
+	if !errors.As(err, &unsupported) || unsupported.Required != "2.90" || unsupported.Supported != "2.60" {
+		t.Errorf("Expected an unsupported microversion error, got %v", err)
+	}
+	if len(compute.microversions) != 0 {
+		t.Errorf("Expected no request, got %d", len(compute.microversions))
+	}
+
+	if err := is.UpdateServerIdentity("server-id", "2.19", ServerIdentity{Description: "worker"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if compute.microversions[0] != "2.19" {
+		t.Errorf("Expected microversion 2.19, got %s", compute.microversions[0])
+	}
+	if server := compute.bodies[0]["server"]; len(server.(map[string]interface{})) != 1 {
+		t.Errorf("Expected only the description to be updated, got %v", server)
+	}
+	if is.computeClient.Microversion != "2.1" {
+		t.Errorf("Expected the microversion of the client to be unchanged, got %s", is.computeClient.Microversion)
+	}
+}
+
+func TestGetServerIdentity(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.95"}
+	is := compute.serve(t)
+
+	identity, err := is.GetServerIdentity("server-id", "2.90")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if identity != (ServerIdentity{Description: "old", Hostname: "worker-0"}) {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+	if compute.microversions[0] != "2.90" {
+		t.Errorf("Expected microversion 2.90, got %s", compute.microversions[0])
+	}
+}
+
+func TestInitComputeMicroversion(t *testing.T) {
+	compute := &fakeCompute{maxMicroversion: "2.95"}
+	overridden := compute.serve(t)
+	overridden.initComputeMicroversion("2.88")
+	if microversion, err := overridden.ComputeMicroversion(); err != nil || microversion != "2.88" {
+		t.Errorf("Expected the overridden microversion 2.88, got %q and %v", microversion, err)
+	}
+	if compute.versionRequests != 0 {
+		t.Errorf("Expected no negotiation with an override, got %d requests", compute.versionRequests)
+	}
+
+	compute = &fakeCompute{maxMicroversion: "2.94"}
+	negotiated := compute.serve(t)
+	negotiated.initComputeMicroversion("")
+	if compute.versionRequests != 1 {
+		t.Errorf("Expected the microversion to be negotiated, got %d requests", compute.versionRequests)
+	}
+	if microversion, err := negotiated.ComputeMicroversion(); err != nil || microversion != "2.94" {
+		t.Errorf("Expected the negotiated microversion 2.94, got %q and %v", microversion, err)
+	}
+}
+
+func TestCreateServerGroupMicroversion(t *testing.T) {
+	tests := []struct {
+		maxMicroversion      string
+		expectedMicroversion string
+		expectedField        string
+	}{
+		{maxMicroversion: "2.95", expectedMicroversion: "2.64", expectedField: "policy"},
+		{maxMicroversion: "2.60", expectedMicroversion: "2.15", expectedField: "policies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxMicroversion, func(t *testing.T) {
+			compute := &fakeCompute{maxMicroversion: tt.maxMicroversion}
+			is := compute.serve(t)
+
+			if _, err := is.CreateServerGroup("group", ServerGroupPolicySoftAntiAffinity); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if compute.microversions[0] != tt.expectedMicroversion {
+				t.Errorf("Expected microversion %s, got %s", tt.expectedMicroversion, compute.microversions[0])
+			}
+			serverGroup := compute.bodies[0]["server_group"].(map[string]interface{})
+			if _, ok := serverGroup[tt.expectedField]; !ok {
+				t.Errorf("Expected the server group to have %s, got %v", tt.expectedField, serverGroup)
+			}
+		})
+	}
+}
+
+func TestValidateComputeMicroversion(t *testing.T) {
+	for microversion, valid := range map[string]bool{
+		"2.60":   true,
+		"2.95":   true,
+		"3.0":    true,
+		"2.59":   false,
+		"2":      false,
+		"latest": false,
+		"2.x":    false,
+	} {
+		if err := ValidateComputeMicroversion(microversion); (err == nil) != valid {
+			t.Errorf("%s: expected valid to be %t, got %v", microversion, valid, err)
+		}
+	}
+}
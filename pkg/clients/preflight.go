@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumetypes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+// APICheck is a read-only call to an OpenStack API which the provider needs.
+type APICheck struct {
+	// Name describes the call, e.g. "list servers".
+	Name string
+
+	// Run makes the call.
+	Run func() error
+}
+
+// APIChecks returns a read-only call to every OpenStack API which the provider
+// needs. Volume types are only listed if the cloud has a block storage
+// service, which is only needed for volumes.
+func (is *InstanceService) APIChecks() []APICheck {
+	checks := []APICheck{
+		{
+			Name: "list servers",
+			Run:  func() error { return firstPage(servers.List(is.computeClient, servers.ListOpts{Limit: 1})) },
+		},
+		{
+			Name: "list flavors",
+			Run:  func() error { return firstPage(flavors.ListDetail(is.computeClient, flavors.ListOpts{Limit: 1})) },
+		},
+		{
+			Name: "list images",
+			Run:  func() error { return firstPage(images.List(is.imagesClient, images.ListOpts{Limit: 1})) },
+		},
+		{
+			Name: "list ports",
+			Run:  func() error { return firstPage(ports.List(is.networkClient, ports.ListOpts{Limit: 1})) },
+		},
+	}
+	if is.volumeClient != nil {
+		checks = append(checks, APICheck{
+			Name: "list volume types",
+			Run:  func() error { return firstPage(volumetypes.List(is.volumeClient, volumetypes.ListOpts{Limit: 1})) },
+		})
+	}
+	return checks
+}
+
+// firstPage requests only the first page of a list.
+func firstPage(pager pagination.Pager) error {
+	return pager.EachPage(func(pagination.Page) (bool, error) {
+		return false, nil
+	})
+}
@@ -0,0 +1,238 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// providerClientCacheEntry is an authenticated provider client.
+type providerClientCacheEntry struct {
+	// mu is held while the provider client is authenticated and used
+	// by the cache
+	mu       sync.Mutex
+	provider *gophercloud.ProviderClient
+
+	// scope is the scope of the provider client, which is created the
+	// first time it is used
+	scope *providerScope
+
+	// secrets are the clouds secrets the cloud of the provider client was
+	// read from. They are guarded by the lock of the cache.
+	secrets sets.Set[types.NamespacedName]
+
+	// expiresAt is when the provider client is discarded, half way
+	// through the lifetime of its token
+	expiresAt time.Time
+}
+
+// providerClientCache shares authenticated provider clients between the
+// instance services and the scopes of the same credentials, so that Keystone
+// authenticates once per credentials instead of once per instance service,
+// machine and reconcile. Provider clients are keyed by the hashes of the
+// cloud and the CA certificate, so that changed credentials or a changed CA
+// certificate get a new provider client. They are discarded when the clouds
+// secret they were read from is changed or deleted, and half way through the
+// lifetime of their token.
+type providerClientCache struct {
+	// mu guards the entries, and is never held while authenticating
+	mu      sync.Mutex
+	entries map[string]*providerClientCacheEntry
+
+	// newProviderClient authenticates a provider client which isn't cached
+	newProviderClient func(cloud clientconfig.Cloud, cert []byte) (*gophercloud.ProviderClient, error)
+
+	// newScope returns the scope of a provider client
+	newScope func(provider *gophercloud.ProviderClient, cloud clientconfig.Cloud, logger logr.Logger) (*providerScope, error)
+
+	// tokenExpiry returns when the token of a provider client expires, or
+	// false if it can't tell
+	tokenExpiry func(provider *gophercloud.ProviderClient) (time.Time, bool)
+
+	now func() time.Time
+}
+
+func newProviderClientCache() *providerClientCache {
+	return &providerClientCache{
+		entries:           make(map[string]*providerClientCacheEntry),
+		newProviderClient: GetProviderClient,
+		newScope:          newProviderScope,
+		tokenExpiry:       providerTokenExpiry,
+		now:               time.Now,
+	}
+}
+
+// providerClients are the provider clients of the instance services and
+// scopes.
+var providerClients = newProviderClientCache()
+
+// SharedProviderScope returns the scope of cloud, which was read from the
+// clouds secret secret. Its provider client is shared with the scopes and
+// instance services of the same credentials and CA certificate, see
+// DiscardProviderClients. The returned scope makes its requests with ctx, so
+// they are cancelled with it, and logs with logger.
+func SharedProviderScope(ctx context.Context, cloud clientconfig.Cloud, caCert []byte, secret types.NamespacedName, logger logr.Logger) (scope.Scope, error) {
+	s, err := providerClients.getScope(cloud, caCert, secret)
+	if err != nil {
+		return nil, err
+	}
+	withContext := WithContext(ctx, s).(*providerScope)
+	withContext.logger = logger
+	return withContext, nil
+}
+
+// DiscardProviderClients discards the shared provider clients of the clouds
+// read from the clouds secret with the given namespace and name, e.g. because
+// its credentials were rotated.
+func DiscardProviderClients(namespace, name string) {
+	providerClients.invalidate(types.NamespacedName{Namespace: namespace, Name: name})
+}
+
+// DiscardAllProviderClients discards all shared provider clients, e.g.
+// because they trust a CA certificate which changed.
+func DiscardAllProviderClients() {
+	providerClients.invalidateAll()
+}
+
+// get returns an authenticated provider client for cloud, creating it if it
+// isn't cached.
+func (c *providerClientCache) get(cloud clientconfig.Cloud, cert []byte) (*gophercloud.ProviderClient, error) {
+	entry, err := c.lockedEntry(cloud, cert, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.mu.Unlock()
+
+	return entry.provider, nil
+}
+
+// getScope returns the scope of the authenticated provider client for cloud,
+// which was read from secret, creating them if they aren't cached.
+func (c *providerClientCache) getScope(cloud clientconfig.Cloud, cert []byte, secret types.NamespacedName) (*providerScope, error) {
+	entry, err := c.lockedEntry(cloud, cert, &secret)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.mu.Unlock()
+
+	if entry.scope == nil {
+		s, err := c.newScope(entry.provider, cloud, logr.Discard())
+		if err != nil {
+			return nil, err
+		}
+		entry.scope = s
+	}
+	return entry.scope, nil
+}
+
+// lockedEntry returns the locked entry of cloud, which was read from secret
+// unless it is nil, authenticating its provider client if it isn't cached.
+// Only the entry is locked while authenticating, so that the users of the
+// same credentials don't all authenticate at once, while the users of other
+// credentials don't wait for them. A provider client whose token expiry is
+// unknown is authenticated anew by the next user of the entry.
+func (c *providerClientCache) lockedEntry(cloud clientconfig.Cloud, cert []byte, secret *types.NamespacedName) (*providerClientCacheEntry, error) {
+	cloudJSON, err := json.Marshal(cloud)
+	if err != nil {
+		return nil, err
+	}
+	key := hashBytes(cloudJSON) + "/" + hashBytes(cert)
+
+	c.mu.Lock()
+	now := c.now()
+	// Drop expired entries, e.g. of rotated credentials. Entries which
+	// are in use are dropped later.
+	for k, entry := range c.entries {
+		if k == key || !entry.mu.TryLock() {
+			continue
+		}
+		expired := entry.provider != nil && !now.Before(entry.expiresAt)
+		entry.mu.Unlock()
+		if expired {
+			delete(c.entries, k)
+		}
+	}
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &providerClientCacheEntry{secrets: sets.New[types.NamespacedName]()}
+		c.entries[key] = entry
+	}
+	if secret != nil {
+		entry.secrets.Insert(*secret)
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	now = c.now()
+	if entry.provider != nil && now.Before(entry.expiresAt) {
+		return entry, nil
+	}
+
+	provider, err := c.newProviderClient(cloud, cert)
+	if err != nil {
+		unused := entry.provider == nil
+		entry.mu.Unlock()
+		c.mu.Lock()
+		if unused && c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return nil, err
+	}
+	entry.provider, entry.scope = provider, nil
+	entry.expiresAt = time.Time{}
+	if expiresAt, ok := c.tokenExpiry(provider); ok {
+		entry.expiresAt = now.Add(expiresAt.Sub(now) / 2)
+	}
+	return entry, nil
+}
+
+// invalidate discards the provider clients of the clouds read from secret.
+func (c *providerClientCache) invalidate(secret types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if entry.secrets.Has(secret) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// invalidateAll discards all provider clients.
+func (c *providerClientCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*providerClientCacheEntry)
+}
+
+// providerTokenExpiry returns when the identity v3 token of the provider
+// client expires.
+func providerTokenExpiry(provider *gophercloud.ProviderClient) (time.Time, bool) {
+	authResult, ok := provider.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return time.Time{}, false
+	}
+	token, err := authResult.ExtractToken()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return token.ExpiresAt, true
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,208 @@
+package clients
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestProviderClientCache(t *testing.T) {
+	now := time.Now()
+	created := 0
+	withToken := true
+	cache := newProviderClientCache()
+	cache.now = func() time.Time { return now }
+	cache.newProviderClient = func(clientconfig.Cloud, []byte) (*gophercloud.ProviderClient, error) {
+		created++
+		return &gophercloud.ProviderClient{}, nil
+	}
+	cache.tokenExpiry = func(*gophercloud.ProviderClient) (time.Time, bool) {
+		return now.Add(time.Hour), withToken
+	}
+
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{AuthURL: "https://keystone.example.com", ApplicationCredentialID: "id", ApplicationCredentialSecret: "secret"}}
+	get := func(cloud clientconfig.Cloud, cert []byte) *gophercloud.ProviderClient {
+		t.Helper()
+		provider, err := cache.get(cloud, cert)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return provider
+	}
+	expectCreated := func(expected int) {
+		t.Helper()
+		if created != expected {
+			t.Errorf("Expected %d provider clients to be created, got %d", expected, created)
+		}
+	}
+
+	// Instance services with the same credentials share a provider client
+	if get(cloud, nil) != get(cloud, nil) {
+		t.Errorf("Expected the same provider client")
+	}
+	expectCreated(1)
+
+	// Rotated credentials or a changed CA certificate get a new provider
+	// client
+	rotated := cloud
+	rotated.AuthInfo = &clientconfig.AuthInfo{AuthURL: "https://keystone.example.com", ApplicationCredentialID: "id", ApplicationCredentialSecret: "rotated"}
+	get(rotated, nil)
+	expectCreated(2)
+	get(cloud, []byte("ca"))
+	expectCreated(3)
+
+	// Provider clients are renewed half way through the lifetime of
+	// their token, and expired ones are dropped
+	now = now.Add(31 * time.Minute)
+	get(cloud, nil)
+	expectCreated(4)
+	if len(cache.entries) != 1 {
+		t.Errorf("Expected the expired provider clients to be dropped, got %d entries", len(cache.entries))
+	}
+
+	// Provider clients whose token expiry is unknown aren't cached
+	withToken = false
+	get(rotated, nil)
+	get(rotated, nil)
+	expectCreated(6)
+
+	// Failed authentications aren't cached
+	cache.newProviderClient = func(clientconfig.Cloud, []byte) (*gophercloud.ProviderClient, error) {
+		return nil, fmt.Errorf("authentication failed")
+	}
+	if _, err := cache.get(rotated, []byte("ca")); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestProviderClientCacheScopes(t *testing.T) {
+	created := 0
+	cache := newProviderClientCache()
+	cache.newProviderClient = func(clientconfig.Cloud, []byte) (*gophercloud.ProviderClient, error) {
+		created++
+		return &gophercloud.ProviderClient{}, nil
+	}
+	cache.newScope = func(provider *gophercloud.ProviderClient, _ clientconfig.Cloud, _ logr.Logger) (*providerScope, error) {
+		return &providerScope{providerClient: provider}, nil
+	}
+	cache.tokenExpiry = func(*gophercloud.ProviderClient) (time.Time, bool) {
+		return time.Now().Add(time.Hour), true
+	}
+
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{AuthURL: "https://keystone.example.com", Username: "user", Password: "password"}}
+	rotated := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{AuthURL: "https://keystone.example.com", Username: "user", Password: "rotated"}}
+	secret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials"}
+	otherSecret := types.NamespacedName{Namespace: "openshift-machine-api", Name: "other-credentials"}
+
+	getScope := func(cloud clientconfig.Cloud, secret types.NamespacedName, cert []byte) *providerScope {
+		t.Helper()
+		s, err := cache.getScope(cloud, cert, secret)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return s
+	}
+	expectCreated := func(expected int) {
+		t.Helper()
+		if created != expected {
+			t.Errorf("Expected %d provider clients to be created, got %d", expected, created)
+		}
+	}
+
+	// Machines and instance services with the same credentials share a
+	// provider client
+	s := getScope(cloud, secret, nil)
+	if getScope(cloud, secret, nil) != s {
+		t.Errorf("Expected the same scope")
+	}
+	if provider, err := cache.get(cloud, nil); err != nil || provider != s.providerClient {
+		t.Errorf("Expected the instance service to share the provider client of the scope, got %v", err)
+	}
+	expectCreated(1)
+
+	// Changes to other secrets keep the provider clients
+	getScope(cloud, otherSecret, []byte("other"))
+	cache.invalidate(otherSecret)
+	getScope(cloud, secret, nil)
+	expectCreated(2)
+
+	// Changes to the secret discard its provider clients
+	getScope(rotated, secret, nil)
+	cache.invalidate(secret)
+	getScope(cloud, secret, nil)
+	getScope(rotated, secret, nil)
+	expectCreated(5)
+
+	// Changes to the CA certificate discard all provider clients
+	cache.invalidateAll()
+	getScope(cloud, otherSecret, []byte("other"))
+	getScope(rotated, secret, nil)
+	expectCreated(7)
+}
+
+func TestProviderClientCacheConcurrentAuthentication(t *testing.T) {
+	slow := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{AuthURL: "https://slow.example.com", Username: "user", Password: "password"}}
+	fast := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{AuthURL: "https://fast.example.com", Username: "user", Password: "password"}}
+
+	var mu sync.Mutex
+	created := map[string]int{}
+	authenticating := make(chan struct{})
+	unblock := make(chan struct{})
+	cache := newProviderClientCache()
+	cache.newProviderClient = func(cloud clientconfig.Cloud, _ []byte) (*gophercloud.ProviderClient, error) {
+		mu.Lock()
+		created[cloud.AuthInfo.AuthURL]++
+		mu.Unlock()
+		if cloud.AuthInfo.AuthURL == slow.AuthInfo.AuthURL {
+			close(authenticating)
+			<-unblock
+		}
+		return &gophercloud.ProviderClient{}, nil
+	}
+	cache.tokenExpiry = func(*gophercloud.ProviderClient) (time.Time, bool) {
+		return time.Now().Add(time.Hour), true
+	}
+
+	// Users of the slow cloud wait for a single authentication
+	var wg sync.WaitGroup
+	providers := make([]*gophercloud.ProviderClient, 3)
+	for i := range providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			providers[i], _ = cache.get(slow, nil)
+		}(i)
+	}
+	<-authenticating
+
+	// while the other clouds don't
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cache.get(fast, nil); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the authentication of another cloud not to wait")
+	}
+
+	close(unblock)
+	wg.Wait()
+	for _, provider := range providers {
+		if provider == nil || provider != providers[0] {
+			t.Errorf("Expected the users of the slow cloud to share a provider client")
+		}
+	}
+	if created[slow.AuthInfo.AuthURL] != 1 || created[fast.AuthInfo.AuthURL] != 1 {
+		t.Errorf("Expected each cloud to be authenticated once, got %v", created)
+	}
+}
@@ -0,0 +1,440 @@
+package clients
+
+import (
+	"errors"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ProviderSpecExtensions contains the providerSpec fields which are supported
+// by MAPO but are not part of OpenstackProviderSpec. They are set in the same
+// providerSpec value as the fields of OpenstackProviderSpec.
+type ProviderSpecExtensions struct {
+	// SchedulerHints are passed to Nova when creating the server.
+	// +optional
+	SchedulerHints *SchedulerHints `json:"schedulerHints,omitempty"`
+
+	// ReservationID is the ID of a Blazar reservation. It is passed to
+	// Nova as the reservation scheduler hint, so that the server is created
+	// on one of the reserved hosts. The flavor must be the one created for
+	// the reservation if it is an instance reservation.
+	// +optional
+	ReservationID string `json:"reservationID,omitempty"`
+
+	// ServerGroupPolicy is the policy of the server group created when
+	// serverGroupName does not refer to an existing server group. It must be
+	// one of affinity, anti-affinity, soft-affinity or soft-anti-affinity.
+	// Defaults to soft-anti-affinity.
+	// +optional
+	ServerGroupPolicy string `json:"serverGroupPolicy,omitempty"`
+
+	// ServerGroupScope is what owns the server group created when
+	// serverGroupName does not refer to an existing server group. It must be
+	// Machine, which creates it for the first machine using it, or
+	// MachineSet, which creates it once for the MachineSet of the machine
+	// and records its ID in an annotation of the MachineSet. Defaults to
+	// Machine.
+	// +optional
+	ServerGroupScope ServerGroupScope `json:"serverGroupScope,omitempty"`
+
+	// InheritServerGroup makes a machine of a MachineSet which replaces a
+	// machine being deleted, e.g. by MachineHealthCheck remediation, use the
+	// server group of the deleted machine instead of looking up
+	// serverGroupName.
+	// +optional
+	InheritServerGroup bool `json:"inheritServerGroup,omitempty"`
+
+	// ImageSelection controls which image is used when more than one image
+	// has the name given in image or rootVolume.sourceUUID.
+	// +optional
+	ImageSelection *ImageSelection `json:"imageSelection,omitempty"`
+
+	// PortDNSName is the dns_name of the primary port, used by the DNS
+	// integration of Neutron. It may use the template variables of the
+	// server metadata, e.g. {{.MachineName}}.
+	// +optional
+	PortDNSName string `json:"portDNSName,omitempty"`
+
+	// Hostname is the hostname of the instance, which is also the name of
+	// its node. It may be a fully qualified name and may use the template
+	// variables of the server metadata, e.g.
+	// {{.MachineName}}.internal.example.com. It is set in the Ignition user
+	// data. If not set, the hostname is the name of the machine.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// ServerDescription is the description of the server. It may use the
+	// template variables of the server metadata, and is at most 255
+	// characters long once they are replaced. It needs compute microversion
+	// 2.19.
+	// +optional
+	ServerDescription string `json:"serverDescription,omitempty"`
+
+	// FixedIP is the address of the primary port. It must be in the subnet
+	// of the primary port, or in a subnet of its network if no subnet is
+	// given.
+	// +optional
+	FixedIP string `json:"fixedIP,omitempty"`
+
+	// AddressClaims are IPAddressClaims whose allocated addresses are used
+	// as fixed IPs of the ports of the server. The server is not created
+	// until all of them have been bound.
+	// +optional
+	AddressClaims []AddressClaim `json:"addressClaims,omitempty"`
+
+	// AddressesFromPools are IP address pools of IPAM providers. An
+	// IPAddressClaim is created for the machine from each of them, and used
+	// like those in addressClaims.
+	// +optional
+	AddressesFromPools []AddressFromPool `json:"addressesFromPools,omitempty"`
+
+	// FloatingIPs are floating IPs to associate with ports of the server in
+	// addition to floatingIP.
+	// +optional
+	FloatingIPs []FloatingIPRequest `json:"floatingIPs,omitempty"`
+
+	// FloatingIPNetwork is the name or ID of the external network from
+	// which floatingIP, and floating IPs in floatingIPs which don't specify
+	// a network, are allocated if they don't exist.
+	// +optional
+	FloatingIPNetwork string `json:"floatingIPNetwork,omitempty"`
+
+	// DeleteFloatingIP deletes floatingIP and the floating IPs in
+	// floatingIPs which have an address, returning them to their pool, when
+	// the machine is deleted. By default they are only disassociated.
+	// +optional
+	DeleteFloatingIP bool `json:"deleteFloatingIP,omitempty"`
+
+	// LoadBalancerPools are Octavia pools which the machine is added to as
+	// a member once its instance exists, and removed from when it is
+	// deleted.
+	// +optional
+	LoadBalancerPools []LoadBalancerPool `json:"loadBalancerPools,omitempty"`
+
+	// FlavorExtraSpecLabels maps extra specs of the flavor to labels of the
+	// node: if the flavor of the server has an extra spec whose key is a key
+	// of this map, the node is labelled with the value of the extra spec
+	// under the label key it maps to. Other extra specs are ignored.
+	// +optional
+	FlavorExtraSpecLabels map[string]string `json:"flavorExtraSpecLabels,omitempty"`
+
+	// InactiveInstancePolicy is what is done when the instance of the
+	// machine is paused or suspended. It must be Report, which only reports
+	// it in the InstanceActive condition of the machine, or Resume, which
+	// also unpauses or resumes the instance. Defaults to Report.
+	// +optional
+	InactiveInstancePolicy InactiveInstancePolicy `json:"inactiveInstancePolicy,omitempty"`
+
+	// MultiattachVolumes are existing multiattach volumes which are attached
+	// to the server once it is active, e.g. to share block storage between
+	// the machines of a clustered workload.
+	// +optional
+	MultiattachVolumes []MultiattachVolume `json:"multiattachVolumes,omitempty"`
+
+	// FlavorDisks configures the ephemeral and swap disks of the flavor. By
+	// default the server gets them as Nova configures them.
+	// +optional
+	FlavorDisks *FlavorDisks `json:"flavorDisks,omitempty"`
+
+	// ConfigDriveFiles are files written on the instance when it boots, with
+	// the contents of keys of ConfigMaps or Secrets in the namespace of the
+	// machine, e.g. for CA certificates. They are added to the Ignition
+	// user data, so configDrive must be true, and the userData secret is
+	// left as it is.
+	// +optional
+	ConfigDriveFiles []ConfigDriveFile `json:"configDriveFiles,omitempty"`
+
+	// SSHPublicKeySecret is a key of a Secret in the namespace of the
+	// machine with an SSH public key in the authorized_keys format. A Nova
+	// keypair is created for the key if there is none, and used instead of
+	// keyName, so it can't be set together with keyName.
+	// +optional
+	SSHPublicKeySecret *corev1.SecretKeySelector `json:"sshPublicKeySecret,omitempty"`
+
+	// ComputeMicroversion is the highest compute microversion used for the
+	// machine instead of the highest one supported by the compute service,
+	// e.g. for a cloud which doesn't implement a microversion it advertises.
+	// Features which need a higher microversion are not used. It must be at
+	// least 2.60, which servers are created with.
+	// +optional
+	ComputeMicroversion string `json:"computeMicroversion,omitempty"`
+
+	// Networks extends the entries of networks with the same index.
+	// +optional
+	Networks []NetworkParamExtensions `json:"networks,omitempty"`
+
+	// Ports extends the entries of ports with the same index.
+	// +optional
+	Ports []PortOptsExtensions `json:"ports,omitempty"`
+
+	// AdditionalBlockDevices extends the entries of additionalBlockDevices
+	// with the same index.
+	// +optional
+	AdditionalBlockDevices []AdditionalBlockDeviceExtensions `json:"additionalBlockDevices,omitempty"`
+}
+
+// ServerGroupScope is what owns a server group created by MAPO.
+type ServerGroupScope string
+
+const (
+	// ServerGroupScopeMachine makes the machine which created the server
+	// group its owner.
+	ServerGroupScopeMachine ServerGroupScope = "Machine"
+
+	// ServerGroupScopeMachineSet makes the MachineSet of the machine the
+	// owner of the server group.
+	ServerGroupScopeMachineSet ServerGroupScope = "MachineSet"
+)
+
+// InactiveInstancePolicy is what is done when an instance is paused or
+// suspended.
+type InactiveInstancePolicy string
+
+const (
+	// InactiveInstancePolicyReport only reports that the instance is
+	// inactive.
+	InactiveInstancePolicyReport InactiveInstancePolicy = "Report"
+
+	// InactiveInstancePolicyResume unpauses or resumes the instance.
+	InactiveInstancePolicyResume InactiveInstancePolicy = "Resume"
+)
+
+// NetworkParamExtensions contains the fields of an entry of networks which
+// are not part of NetworkParam.
+type NetworkParamExtensions struct {
+	// QoSPolicy is the name or ID of the QoS policy of the ports created
+	// for the network.
+	// +optional
+	QoSPolicy string `json:"qosPolicy,omitempty"`
+
+	// BindingProfile is added to the binding:profile of the ports created
+	// for the network unchanged, e.g. for the keys needed by SmartNICs.
+	// +optional
+	BindingProfile map[string]interface{} `json:"bindingProfile,omitempty"`
+
+	// SegmentsByAvailabilityZone maps availability zones to the name or ID
+	// of the segment of the network which is routable in them, for routed
+	// provider networks. The port of a machine in one of these zones gets
+	// its fixed IPs from the subnets of that segment. The network must be
+	// given by ID, without subnets.
+	// +optional
+	SegmentsByAvailabilityZone map[string]string `json:"segmentsByAvailabilityZone,omitempty"`
+
+	// NoSecurityGroups creates the ports of the network without any
+	// security group, instead of with the securityGroups of the
+	// providerSpec or the default security group of the project. Neutron
+	// drops all the traffic of a port with port security enabled and no
+	// security group. It can't be set if portSecurity is
+	// false, as those ports have no security groups anyway.
+	// +optional
+	NoSecurityGroups bool `json:"noSecurityGroups,omitempty"`
+}
+
+// PortOptsExtensions contains the fields of an entry of ports which are not
+// part of PortOpts.
+type PortOptsExtensions struct {
+	// QoSPolicy is the name or ID of the QoS policy of the port.
+	// +optional
+	QoSPolicy string `json:"qosPolicy,omitempty"`
+
+	// BindingProfile is added to the binding:profile of the port unchanged.
+	// +optional
+	BindingProfile map[string]interface{} `json:"bindingProfile,omitempty"`
+
+	// NoSecurityGroups creates the port without any security group, as in
+	// NetworkParamExtensions. It can't be set together with the
+	// securityGroups of the port, or if portSecurity is false.
+	// +optional
+	NoSecurityGroups bool `json:"noSecurityGroups,omitempty"`
+}
+
+// AdditionalBlockDeviceExtensions contains the fields of an entry of
+// additionalBlockDevices which are not part of AdditionalBlockDevice.
+type AdditionalBlockDeviceExtensions struct {
+	// Metadata is added to the metadata of the volume of the block device,
+	// e.g. for backup tools which select volumes by it. Only block devices
+	// with volume storage have metadata.
+	// +optional
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Retain keeps the volume of the block device when the machine is
+	// deleted. It is detached from the instance before the instance is
+	// deleted, instead of being deleted with it. Only block devices with
+	// volume storage can be retained.
+	// +optional
+	Retain bool `json:"retain,omitempty"`
+}
+
+// FlavorDisks configures the disks of the flavor of the server.
+type FlavorDisks struct {
+	// Ephemeral configures the ephemeral disk of the flavor. The flavor
+	// must have an ephemeral disk.
+	// +optional
+	Ephemeral *FlavorDisk `json:"ephemeral,omitempty"`
+
+	// Swap configures the swap disk of the flavor. The flavor must have
+	// swap.
+	// +optional
+	Swap *FlavorDisk `json:"swap,omitempty"`
+}
+
+// FlavorDisk configures a disk of the flavor of the server.
+type FlavorDisk struct {
+	// Disabled leaves the disk out of the server.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// GuestFormat is the file system the ephemeral disk is formatted with,
+	// e.g. ext4 or xfs. Defaults to the default ephemeral format of the
+	// compute host. The swap disk is always formatted as swap.
+	// +optional
+	GuestFormat string `json:"guestFormat,omitempty"`
+}
+
+// ConfigDriveFile is a file written on the instance when it boots. Exactly
+// one of ConfigMap and Secret must be set.
+type ConfigDriveFile struct {
+	// Path is the absolute path of the file.
+	Path string `json:"path"`
+
+	// Mode is the permissions of the file, e.g. 0644. Defaults to 0644 for
+	// files from ConfigMaps, and to 0600 for files from Secrets.
+	// +optional
+	Mode *int `json:"mode,omitempty"`
+
+	// ConfigMap selects the key of a ConfigMap with the contents of the
+	// file.
+	// +optional
+	ConfigMap *corev1.ConfigMapKeySelector `json:"configMap,omitempty"`
+
+	// Secret selects the key of a Secret with the contents of the file. It
+	// needs AllowSecretInUserData.
+	// +optional
+	Secret *corev1.SecretKeySelector `json:"secret,omitempty"`
+
+	// AllowSecretInUserData must be true for a file from a Secret. The
+	// contents of the file are copied into the user data of the server,
+	// which is stored unencrypted by Nova and can be read from the
+	// metadata service and the config drive by anything running on the
+	// instance.
+	// +optional
+	AllowSecretInUserData bool `json:"allowSecretInUserData,omitempty"`
+}
+
+// MultiattachVolume is an existing volume which may be attached to several
+// servers at once.
+type MultiattachVolume struct {
+	// VolumeID is the ID of the volume. Its volume type must have the
+	// multiattach capability.
+	VolumeID string `json:"volumeID"`
+}
+
+// LoadBalancerPool is an Octavia pool which the machine is a member of.
+type LoadBalancerPool struct {
+	// Pool is the name or ID of the pool.
+	Pool string `json:"pool"`
+
+	// ProtocolPort is the port of the machine which receives the traffic
+	// of the pool.
+	ProtocolPort int `json:"protocolPort"`
+
+	// PortIndex is the index of the port whose fixed IP is the address of
+	// the member, numbered as in AddressClaim. Defaults to 0, the primary
+	// port.
+	// +optional
+	PortIndex int `json:"portIndex,omitempty"`
+
+	// SubnetID is the ID of the subnet of the fixed IP which is the address
+	// of the member. Defaults to the first IPv4 fixed IP of the port, or its
+	// first fixed IP if it only has IPv6 fixed IPs.
+	// +optional
+	SubnetID string `json:"subnetID,omitempty"`
+}
+
+// FloatingIPRequest is a floating IP to associate with a port of the server.
+type FloatingIPRequest struct {
+	// Address is the address of the floating IP. If it is not set, a
+	// floating IP is allocated from Network for the machine, and it is
+	// deleted with the machine.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Network is the name or ID of the external network the floating IP is
+	// allocated from if it doesn't exist. Defaults to floatingIPNetwork.
+	// +optional
+	Network string `json:"network,omitempty"`
+
+	// PortIndex is the index of the port the floating IP is associated
+	// with, numbered as in AddressClaim. Defaults to 0, the primary port.
+	// +optional
+	PortIndex int `json:"portIndex,omitempty"`
+
+	// SubnetID is the ID of the subnet of the fixed IP of the port which the
+	// floating IP is associated with. Defaults to the first IPv4 fixed IP
+	// of the port.
+	// +optional
+	SubnetID string `json:"subnetID,omitempty"`
+}
+
+// AddressClaim references an IPAddressClaim in the namespace of the machine.
+type AddressClaim struct {
+	// Name is the name of the IPAddressClaim.
+	Name string `json:"name"`
+
+	// PortIndex is the index of the port the address is assigned to. Ports
+	// are numbered in the order they are created: first those of networks,
+	// then those of ports. Defaults to 0, the primary port.
+	// +optional
+	PortIndex int `json:"portIndex,omitempty"`
+}
+
+// AddressFromPool is an address allocated for the machine from an IP address
+// pool in the namespace of the machine.
+type AddressFromPool struct {
+	// PoolRef references the pool, e.g. an InClusterIPPool of the
+	// in-cluster IPAM provider.
+	PoolRef corev1.TypedLocalObjectReference `json:"poolRef"`
+
+	// PortIndex is the index of the port the address is assigned to,
+	// numbered as in AddressClaim. Defaults to 0, the primary port.
+	// +optional
+	PortIndex int `json:"portIndex,omitempty"`
+}
+
+// SchedulerHints are used by the Nova scheduler to select a host for a server.
+type SchedulerHints struct {
+	// Group is the UUID of a server group to place the server in. It may not
+	// conflict with the serverGroupID or serverGroupName of the providerSpec.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// SameHost is a list of server UUIDs. The server will be placed on a
+	// host which hosts all of them.
+	// +optional
+	SameHost []string `json:"sameHost,omitempty"`
+
+	// DifferentHost is a list of server UUIDs. The server will be placed on
+	// a host which hosts none of them.
+	// +optional
+	DifferentHost []string `json:"differentHost,omitempty"`
+
+	// Custom contains additional hints which are passed to Nova unmodified.
+	// They are only useful with scheduler filters which understand them.
+	// +optional
+	Custom map[string]string `json:"custom,omitempty"`
+}
+
+// ExtensionsFromProviderSpec unmarshals the MAPO-specific fields of a provider spec
+func ExtensionsFromProviderSpec(providerSpec machinev1.ProviderSpec) (*ProviderSpecExtensions, error) {
+	if providerSpec.Value == nil {
+		return nil, errors.New("no such providerSpec found in manifest")
+	}
+
+	var extensions ProviderSpecExtensions
+	if err := yaml.Unmarshal(providerSpec.Value.Raw, &extensions); err != nil {
+		return nil, err
+	}
+	return &extensions, nil
+}
@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// DefaultAPIRetries is the default for how often a request to an OpenStack
+// API is retried after a transient error.
+const DefaultAPIRetries = 3
+
+var (
+	// apiRetries is how often a request to an OpenStack API is retried
+	// after a transient error. Requests aren't retried if it is 0.
+	apiRetries = DefaultAPIRetries
+
+	// retryBaseDelay is the delay before the first retry, which doubles
+	// with every retry up to retryMaxDelay
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// SetAPIRetries sets how often a request to an OpenStack API is retried after
+// a transient error, e.g. a 503 while Neutron restarts, before the error is
+// returned. It applies to the provider clients created afterwards.
+func SetAPIRetries(retries int) {
+	apiRetries = retries
+}
+
+// isIdempotent returns true if a request with the method can be repeated
+// without changing its effect.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isTransientAPIError returns true if the request failed with an error which
+// is likely to go away on its own: throttling, a server error or a dropped
+// connection. Requests which aren't idempotent, e.g. creating a server, are
+// only retried if they can't have been processed, so that nothing is created
+// twice. Timeouts aren't retried, as the endpoint is more likely hung than
+// slow.
+func isTransientAPIError(method string, err error) bool {
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		switch statusErr.GetStatusCode() {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+			return isIdempotent(method)
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return isIdempotent(method)
+	}
+	return false
+}
+
+// retryDelay returns the jittered delay before the retry after the failCount
+// failure of a request.
+func retryDelay(failCount uint) time.Duration {
+	delay := retryMaxDelay
+	if failCount <= 16 {
+		delay = min(retryBaseDelay<<(failCount-1), retryMaxDelay)
+	}
+	return wait.Jitter(delay, 0.5)
+}
+
+// retryTransientErrors is the gophercloud.RetryFunc of the provider clients.
+// It retries requests which failed with a transient error, with jittered
+// exponential backoff, and otherwise returns the error unchanged so that
+// callers can still check its type.
+func retryTransientErrors(ctx context.Context, method, url string, _ *gophercloud.RequestOpts, err error, failCount uint) error {
+	if failCount > uint(apiRetries) || !isTransientAPIError(method, err) {
+		return err
+	}
+
+	delay := retryDelay(failCount)
+	klog.V(3).Infof("Retrying %s %s in %s after a transient error: %v", method, url, delay.Round(time.Millisecond), err)
+	if ctx == nil {
+		time.Sleep(delay)
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return err
+	case <-time.After(delay):
+		return nil
+	}
+}
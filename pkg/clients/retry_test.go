@@ -0,0 +1,116 @@
+package clients
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Client.Timeout exceeded" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientAPIError(t *testing.T) {
+	statusErr := func(code int) error {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: code}
+	}
+	response := func(code int) gophercloud.ErrUnexpectedResponseCode {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: code}
+	}
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://neutron.example.com", Err: err}
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		err       error
+		transient bool
+	}{
+		{name: "throttled", method: http.MethodPost, err: gophercloud.ErrDefault429{ErrUnexpectedResponseCode: response(http.StatusTooManyRequests)}, transient: true},
+		{name: "unavailable", method: http.MethodPost, err: statusErr(http.StatusServiceUnavailable), transient: true},
+		{name: "server error on GET", method: http.MethodGet, err: gophercloud.ErrDefault500{ErrUnexpectedResponseCode: response(http.StatusInternalServerError)}, transient: true},
+		{name: "server error on POST", method: http.MethodPost, err: gophercloud.ErrDefault500{ErrUnexpectedResponseCode: response(http.StatusInternalServerError)}, transient: false},
+		{name: "bad gateway on DELETE", method: http.MethodDelete, err: statusErr(http.StatusBadGateway), transient: true},
+		{name: "not found", method: http.MethodGet, err: gophercloud.ErrDefault404{ErrUnexpectedResponseCode: response(http.StatusNotFound)}, transient: false},
+		{name: "conflict", method: http.MethodPut, err: gophercloud.ErrDefault409{ErrUnexpectedResponseCode: response(http.StatusConflict)}, transient: false},
+		{name: "connection refused on POST", method: http.MethodPost, err: urlErr(syscall.ECONNREFUSED), transient: true},
+		{name: "connection reset on GET", method: http.MethodGet, err: urlErr(syscall.ECONNRESET), transient: true},
+		{name: "connection reset on POST", method: http.MethodPost, err: urlErr(syscall.ECONNRESET), transient: false},
+		{name: "EOF on GET", method: http.MethodGet, err: urlErr(io.EOF), transient: true},
+		{name: "timeout", method: http.MethodGet, err: urlErr(timeoutError{}), transient: false},
+		{name: "other error", method: http.MethodGet, err: fmt.Errorf("invalid JSON"), transient: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := isTransientAPIError(tt.method, tt.err); actual != tt.transient {
+				t.Errorf("Expected isTransientAPIError() to be %t, got %t", tt.transient, actual)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for failCount := uint(1); failCount < 100; failCount++ {
+		delay := retryDelay(failCount)
+		expected := min(retryBaseDelay<<min(failCount-1, 16), retryMaxDelay)
+		if delay < expected || delay > expected*3/2 {
+			t.Errorf("Expected the delay of retry %d to be within 50%% above %s, got %s", failCount, expected, delay)
+		}
+	}
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	defer SetAPIRetries(apiRetries)
+
+	tests := []struct {
+		name             string
+		retries          int
+		failures         int
+		status           int
+		expectedRequests int
+		expectedErr      bool
+	}{
+		{name: "recovers", retries: 3, failures: 2, status: http.StatusServiceUnavailable, expectedRequests: 3},
+		{name: "keeps failing", retries: 3, failures: 10, status: http.StatusServiceUnavailable, expectedRequests: 4, expectedErr: true},
+		{name: "not transient", retries: 3, failures: 1, status: http.StatusNotFound, expectedRequests: 1, expectedErr: true},
+		{name: "retries disabled", retries: 0, failures: 1, status: http.StatusServiceUnavailable, expectedRequests: 1, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests++
+				if requests <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			SetAPIRetries(tt.retries)
+			provider := &gophercloud.ProviderClient{RetryFunc: retryTransientErrors}
+			_, err := provider.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{})
+			if (err != nil) != tt.expectedErr {
+				t.Errorf("Expected error %t, got %v", tt.expectedErr, err)
+			}
+			if requests != tt.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", tt.expectedRequests, requests)
+			}
+		})
+	}
+}
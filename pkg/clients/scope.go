@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// DefaultAPITimeout is the default for the timeout of OpenStack API requests.
+const DefaultAPITimeout = 2 * time.Minute
+
+// apiTimeout is how long a request to an OpenStack API may take, including
+// reading its response, before it fails. There is no timeout if it is 0.
+var apiTimeout = DefaultAPITimeout
+
+// SetAPITimeout sets how long a request to an OpenStack API may take, so that
+// a hung endpoint fails the reconcile instead of blocking its worker. It
+// applies to the provider clients created afterwards.
+//
+// The timeout applies to each request, including the authentication of
+// provider clients, which are shared by all machines with the same
+// credentials. The requests of a reconcile are also made with its context,
+// see WithContext.
+func SetAPITimeout(timeout time.Duration) {
+	apiTimeout = timeout
+}
+
+// providerScope is the scope.Scope of CAPO, with the provider client of
+// GetProviderClient, whose requests time out after the API timeout and are
+// retried after transient errors.
+type providerScope struct {
+	providerClient     *gophercloud.ProviderClient
+	providerClientOpts *clientconfig.ClientOpts
+	projectID          string
+	logger             logr.Logger
+
+	// endpoints are the endpoints located by the scope and its copies
+	endpoints *endpointCache
+}
+
+// NewProviderScope returns a scope of cloud like scope.NewProviderScope of
+// CAPO, whose provider client is authenticated by GetProviderClient.
+func NewProviderScope(cloud clientconfig.Cloud, caCert []byte, logger logr.Logger) (scope.Scope, error) {
+	provider, err := GetProviderClient(cloud, caCert)
+	if err != nil {
+		return nil, err
+	}
+	return newProviderScope(provider, cloud, logger)
+}
+
+// newProviderScope returns the scope of cloud with the authenticated provider
+// client of cloud.
+func newProviderScope(provider *gophercloud.ProviderClient, cloud clientconfig.Cloud, logger logr.Logger) (*providerScope, error) {
+	clientOpts := new(clientconfig.ClientOpts)
+	if cloud.AuthInfo != nil {
+		clientOpts.AuthInfo = cloud.AuthInfo
+		clientOpts.AuthType = cloud.AuthType
+		clientOpts.RegionName = cloud.RegionName
+		clientOpts.EndpointType = cloud.EndpointType
+	}
+
+	authResult, ok := provider.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return nil, fmt.Errorf("unable to get the project id from auth response with type %T", provider.GetAuthResult())
+	}
+	project, err := authResult.ExtractProject()
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract project from CreateResult: %v", err)
+	}
+
+	return &providerScope{
+		providerClient:     provider,
+		providerClientOpts: clientOpts,
+		projectID:          project.ID,
+		logger:             logger,
+		endpoints:          newEndpointCache(provider.EndpointLocator),
+	}, nil
+}
+
+// WithContext returns a scope whose requests are made with ctx, so that they
+// are cancelled with it. The copy shares the endpoints located by s, so that
+// the service clients of the copies of a shared scope are created without
+// searching the catalog again. A scope which doesn't support contexts, e.g. a
+// mock, is returned as it is.
+func WithContext(ctx context.Context, s scope.Scope) scope.Scope {
+	if s, ok := s.(*providerScope); ok {
+		withContext := *s
+		withContext.providerClient = providerClientWithContext(ctx, s.providerClient)
+		if s.endpoints != nil {
+			withContext.providerClient.EndpointLocator = s.endpoints.locate
+		}
+		return &withContext
+	}
+	return s
+}
+
+func (s *providerScope) Logger() logr.Logger {
+	return s.logger
+}
+
+func (s *providerScope) ProjectID() string {
+	return s.projectID
+}
+
+func (s *providerScope) NewComputeClient() (capoclients.ComputeClient, error) {
+	return capoclients.NewComputeClient(s.providerClient, s.providerClientOpts)
+}
+
+func (s *providerScope) NewNetworkClient() (capoclients.NetworkClient, error) {
+	return capoclients.NewNetworkClient(s.providerClient, s.providerClientOpts)
+}
+
+func (s *providerScope) NewVolumeClient() (capoclients.VolumeClient, error) {
+	return capoclients.NewVolumeClient(s.providerClient, s.providerClientOpts)
+}
+
+func (s *providerScope) NewImageClient() (capoclients.ImageClient, error) {
+	return capoclients.NewImageClient(s.providerClient, s.providerClientOpts)
+}
+
+func (s *providerScope) NewLbClient() (capoclients.LbClient, error) {
+	return capoclients.NewLbClient(s.providerClient, s.providerClientOpts)
+}
+
+func (s *providerScope) ExtractToken() (*tokens.Token, error) {
+	client, err := openstack.NewIdentityV3(s.providerClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("create new identity service client: %w", err)
+	}
+	return tokens.Get(client, s.providerClient.Token()).ExtractToken()
+}
@@ -0,0 +1,70 @@
+package clients
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+func TestAPITimeout(t *testing.T) {
+	// A Keystone which never responds
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	defer SetAPITimeout(apiTimeout)
+	SetAPITimeout(100 * time.Millisecond)
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:     server.URL + "/v3",
+			Username:    "user",
+			Password:    "password",
+			ProjectName: "project",
+			DomainName:  "Default",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		authenticate func() error
+	}{
+		{
+			name: "scope",
+			authenticate: func() error {
+				_, err := NewProviderScope(cloud, nil, logr.Discard())
+				return err
+			},
+		},
+		{
+			name: "provider client",
+			authenticate: func() error {
+				_, err := GetProviderClient(cloud, nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			go func() { errs <- tt.authenticate() }()
+
+			select {
+			case err := <-errs:
+				if err == nil {
+					t.Errorf("Expected the authentication to fail")
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Expected the authentication to time out")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package clients
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cloudsSecretCache holds the secrets of one namespace while
+// RunCloudsSecretInformer runs.
+var cloudsSecretCache struct {
+	sync.RWMutex
+	namespace string
+	informer  cache.SharedIndexInformer
+}
+
+// RunCloudsSecretInformer watches the secrets in namespace until ctx is done.
+// While it runs, and once it has synced, GetCloudFromSecret reads the clouds
+// secrets in namespace from the watched secrets instead of getting them from
+// the API server on every call. onChange is called with the namespace and name
+// of every secret whose data is updated, e.g. because its credentials were
+// rotated, or which is deleted.
+func RunCloudsSecretInformer(ctx context.Context, kubeClient kubernetes.Interface, namespace string, onChange func(namespace, name string)) {
+	secrets := kubeClient.CoreV1().Secrets(namespace)
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return secrets.List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return secrets.Watch(ctx, options)
+			},
+		},
+		&corev1.Secret{}, 0, cache.Indexers{},
+	)
+
+	if onChange != nil {
+		notify := func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if secret, ok := obj.(*corev1.Secret); ok {
+				onChange(secret.Namespace, secret.Name)
+			}
+		}
+		_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, obj interface{}) {
+				if !secretDataChanged(oldObj, obj) {
+					return
+				}
+				notify(obj)
+			},
+			DeleteFunc: notify,
+		})
+	}
+
+	cloudsSecretCache.Lock()
+	cloudsSecretCache.namespace = namespace
+	cloudsSecretCache.informer = informer
+	cloudsSecretCache.Unlock()
+
+	defer func() {
+		cloudsSecretCache.Lock()
+		cloudsSecretCache.namespace = ""
+		cloudsSecretCache.informer = nil
+		cloudsSecretCache.Unlock()
+	}()
+
+	informer.Run(ctx.Done())
+}
+
+// secretDataChanged returns whether the data of an updated secret changed.
+// Updates of only its metadata, e.g. its labels, don't change credentials.
+func secretDataChanged(oldObj, obj interface{}) bool {
+	oldSecret, ok := oldObj.(*corev1.Secret)
+	if !ok {
+		return true
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(oldSecret.Data, secret.Data)
+}
+
+// cachedCloudsSecretStore returns the store of the secrets informer if it
+// watches namespace, or nil if it doesn't, isn't running or hasn't synced yet.
+func cachedCloudsSecretStore(namespace string) cache.Store {
+	cloudsSecretCache.RLock()
+	defer cloudsSecretCache.RUnlock()
+
+	informer := cloudsSecretCache.informer
+	if informer == nil || cloudsSecretCache.namespace != namespace || !informer.HasSynced() {
+		return nil
+	}
+	return informer.GetStore()
+}
+
+// getSecret returns the secret with the given namespace and name from the
+// secrets informer if it watches namespace, or else from the API server.
+func getSecret(kubeClient kubernetes.Interface, namespace, name string) (*corev1.Secret, error) {
+	if store := cachedCloudsSecretStore(namespace); store != nil {
+		return secretFromStore(store, namespace, name)
+	}
+	return kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// secretFromStore returns the secret with the given namespace and name in
+// store, or a NotFound error.
+func secretFromStore(store cache.Store, namespace, name string) (*corev1.Secret, error) {
+	obj, exists, err := store.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !exists || !ok {
+		return nil, apierrors.NewNotFound(corev1.Resource("secrets"), name)
+	}
+	return secret, nil
+}
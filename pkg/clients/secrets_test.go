@@ -0,0 +1,51 @@
+package clients
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSecretFromStore(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	if err := store.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials"},
+		Data:       map[string][]byte{CloudsSecretKey: []byte("clouds: {}")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := secretFromStore(store, "openshift-machine-api", "openstack-cloud-credentials")
+	if err != nil {
+		t.Fatalf("Expected the secret, got error %v", err)
+	}
+	if string(secret.Data[CloudsSecretKey]) != "clouds: {}" {
+		t.Errorf("Expected the clouds of the secret, got %q", secret.Data[CloudsSecretKey])
+	}
+
+	if _, err := secretFromStore(store, "openshift-machine-api", "missing"); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a NotFound error, got %v", err)
+	}
+}
+
+func TestSecretDataChanged(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials"},
+		Data:       map[string][]byte{CloudsSecretKey: []byte("clouds: {}")},
+	}
+
+	relabeled := secret.DeepCopy()
+	relabeled.Labels = map[string]string{"rotated": "false"}
+	if secretDataChanged(secret, relabeled) {
+		t.Errorf("Expected a change of the labels not to change the data")
+	}
+
+	rotated := secret.DeepCopy()
+	rotated.Data[CloudsSecretKey] = []byte("clouds: {openstack: {}}")
+	if !secretDataChanged(secret, rotated) {
+		t.Errorf("Expected a change of the clouds to change the data")
+	}
+}
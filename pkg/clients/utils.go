@@ -50,13 +50,17 @@ func GetCloud(kubeClient kubernetes.Interface, machine *machinev1.Machine) (clie
 
 // GetCACertificate gets the CA certificate from the configmap
 func GetCACertificate(kubeClient kubernetes.Interface) []byte {
-	cloudConfig, err := kubeClient.CoreV1().ConfigMaps("openshift-config").Get(context.TODO(), "cloud-provider-config", metav1.GetOptions{})
+	if store := cachedCloudProviderConfigStore(); store != nil {
+		return caCertificateFromStore(store)
+	}
+
+	cloudConfig, err := kubeClient.CoreV1().ConfigMaps(cloudProviderConfigNamespace).Get(context.TODO(), cloudProviderConfigName, metav1.GetOptions{})
 	if err != nil {
-		klog.Warningf("failed to get configmap openshift-config/cloud-provider-config from kubernetes api: %v", err)
+		klog.Warningf("failed to get configmap %s/%s from kubernetes api: %v", cloudProviderConfigNamespace, cloudProviderConfigName, err)
 		return nil
 	}
 
-	if cacert, ok := cloudConfig.Data["ca-bundle.pem"]; ok {
+	if cacert, ok := cloudConfig.Data[caBundleKey]; ok {
 		return []byte(cacert)
 	}
 
@@ -92,24 +96,34 @@ func GetProviderClient(cloud clientconfig.Cloud, cert []byte) (*gophercloud.Prov
 	ua.Prepend(fmt.Sprintf("machine-api-provider-openstack/%s", version.Get().GitCommit))
 	provider.UserAgent = ua
 
-	if cert != nil {
-		certPool, err := x509.SystemCertPool()
-		if err != nil {
-			return nil, fmt.Errorf("Create system cert pool failed: %v", err)
+	clientCerts, err := clientCertificates(cloud)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil || clientCerts != nil {
+		tlsConfig := &tls.Config{Certificates: clientCerts}
+		if cert != nil {
+			certPool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("Create system cert pool failed: %v", err)
+			}
+			certPool.AppendCertsFromPEM(cert)
+			tlsConfig.RootCAs = certPool
 		}
-		certPool.AppendCertsFromPEM(cert)
 		client := http.Client{
 			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: certPool,
-				},
-				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+				Proxy:           http.ProxyFromEnvironment,
 			},
 		}
 		provider.HTTPClient = client
-	} else {
+	}
+	if cert == nil {
 		klog.Infof("Cloud provider CA cert not provided, using system trust bundle")
 	}
+	instrumentAPIRequests(provider, opts.IdentityEndpoint)
+	provider.HTTPClient.Timeout = apiTimeout
+	provider.RetryFunc = retryTransientErrors
 
 	err = openstack.Authenticate(provider, *opts)
 	if err != nil {
@@ -130,7 +144,7 @@ func GetCloudFromSecret(kubeClient kubernetes.Interface, namespace string, secre
 		return emptyCloud, fmt.Errorf("Secret name set to %v but no cloud was specified. Please set cloud_name in your machine spec.", secretName)
 	}
 
-	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := getSecret(kubeClient, namespace, secretName)
 	if err != nil {
 		return emptyCloud, fmt.Errorf("Failed to get secrets from kubernetes api: %v", err)
 	}
@@ -146,7 +160,9 @@ func GetCloudFromSecret(kubeClient kubernetes.Interface, namespace string, secre
 		return emptyCloud, fmt.Errorf("failed to unmarshal clouds credentials stored in secret %v: %v", secretName, err)
 	}
 
-	return clouds.Clouds[cloudName], nil
+	cloud := clouds.Clouds[cloudName]
+	resolveClientCertificate(&cloud, secret)
+	return cloud, nil
 }
 
 // MachineSpecFromProviderSpec unmarshals a provider status into an OpenStack Machine Status type
@@ -0,0 +1,119 @@
+// Package cloudfeatures checks that the cloud of each MachineSet supports the
+// features which its machines use, such as server tags and multiattach
+// volumes, so that machines which can't be created, or would silently lack a
+// feature, are reported before they are created.
+package cloudfeatures
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// DegradedCondition is true if machines use features which their cloud
+// doesn't support, and unknown if the cloud could not be checked.
+const DegradedCondition = "Degraded"
+
+// Status is the support of a cloud for the features used by its machines.
+type Status struct {
+	// ComputeMicroversion is the maximum microversion of the compute
+	// service.
+	ComputeMicroversion string `json:"computeMicroversion,omitempty"`
+
+	// BlockStorage is true if the cloud has a block storage service.
+	BlockStorage bool `json:"blockStorage"`
+
+	// UnusableFeatures are the features used by machines which the cloud
+	// doesn't support.
+	UnusableFeatures []UnusableFeature `json:"unusableFeatures,omitempty"`
+
+	// Conditions contains the Degraded condition.
+	Conditions []metav1.Condition `json:"conditions"`
+
+	// LastChecked is when the cloud was checked.
+	LastChecked time.Time `json:"lastChecked"`
+}
+
+// UnusableFeature is a feature which is not supported by the cloud, and the
+// machines which use it.
+type UnusableFeature struct {
+	// Name is the name of the feature.
+	Name string `json:"name"`
+
+	// Reason describes why the cloud doesn't support the feature.
+	Reason string `json:"reason"`
+
+	// Machines are the names of the machines which use the feature.
+	Machines []string `json:"machines"`
+}
+
+// Check returns the status of the features used by machines, by machine name,
+// with the capabilities of their cloud.
+func Check(machines map[string][]clients.Feature, capabilities clients.Capabilities) Status {
+	status := Status{
+		ComputeMicroversion: capabilities.ComputeMicroversion,
+		BlockStorage:        capabilities.BlockStorage,
+		LastChecked:         time.Now(),
+	}
+
+	unusable := make(map[string]*UnusableFeature)
+	for machineName, features := range machines {
+		for _, feature := range features {
+			reason := capabilities.Unsupported(feature)
+			if reason == "" {
+				continue
+			}
+			unusableFeature, ok := unusable[feature.Name]
+			if !ok {
+				unusableFeature = &UnusableFeature{Name: feature.Name, Reason: reason}
+				unusable[feature.Name] = unusableFeature
+			}
+			unusableFeature.Machines = append(unusableFeature.Machines, machineName)
+		}
+	}
+
+	var names []string
+	for name := range unusable {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		slices.Sort(unusable[name].Machines)
+		status.UnusableFeatures = append(status.UnusableFeatures, *unusable[name])
+	}
+
+	if len(names) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    DegradedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AsExpected",
+			Message: "The cloud supports all features used by machines",
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    DegradedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  "UnusableFeatures",
+			Message: fmt.Sprintf("The cloud doesn't support features used by machines: %s", strings.Join(names, ", ")),
+		})
+	}
+	return status
+}
+
+// checkFailed returns the status of a cloud which could not be checked.
+func checkFailed(err error) Status {
+	status := Status{LastChecked: time.Now()}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    DegradedCondition,
+		Status:  metav1.ConditionUnknown,
+		Reason:  "CheckFailed",
+		Message: err.Error(),
+	})
+	return status
+}
@@ -0,0 +1,74 @@
+package cloudfeatures
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestCheck(t *testing.T) {
+	machines := map[string][]clients.Feature{
+		"worker-2": {clients.FeatureServerTags, clients.FeatureMultiattachVolumes},
+		"worker-0": {clients.FeatureMultiattachVolumes},
+		"master-0": {clients.FeatureServerTags},
+	}
+
+	tests := []struct {
+		name         string
+		capabilities clients.Capabilities
+		unusable     []UnusableFeature
+		degraded     metav1.ConditionStatus
+	}{
+		{
+			name:         "all features supported",
+			capabilities: clients.Capabilities{ComputeMicroversion: "2.95", BlockStorage: true},
+			degraded:     metav1.ConditionFalse,
+		},
+		{
+			name:         "multiattach not supported",
+			capabilities: clients.Capabilities{ComputeMicroversion: "2.53"},
+			unusable: []UnusableFeature{
+				{Name: "MultiattachVolumes", Machines: []string{"worker-0", "worker-2"}},
+			},
+			degraded: metav1.ConditionTrue,
+		},
+		{
+			name:         "no features supported",
+			capabilities: clients.Capabilities{},
+			unusable: []UnusableFeature{
+				{Name: "MultiattachVolumes", Machines: []string{"worker-0", "worker-2"}},
+				{Name: "ServerTags", Machines: []string{"master-0", "worker-2"}},
+			},
+			degraded: metav1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			status := Check(machines, tt.capabilities)
+			g.Expect(status.UnusableFeatures).To(HaveLen(len(tt.unusable)))
+			for i := range tt.unusable {
+				g.Expect(status.UnusableFeatures[i].Name).To(Equal(tt.unusable[i].Name))
+				g.Expect(status.UnusableFeatures[i].Reason).NotTo(BeEmpty())
+				g.Expect(status.UnusableFeatures[i].Machines).To(Equal(tt.unusable[i].Machines))
+			}
+			g.Expect(meta.FindStatusCondition(status.Conditions, DegradedCondition).Status).To(Equal(tt.degraded))
+		})
+	}
+}
+
+func TestCheckFailed(t *testing.T) {
+	g := NewWithT(t)
+
+	status := checkFailed(errors.New("compute service unavailable"))
+	condition := meta.FindStatusCondition(status.Conditions, DegradedCondition)
+	g.Expect(condition.Status).To(Equal(metav1.ConditionUnknown))
+	g.Expect(condition.Message).To(Equal("compute service unavailable"))
+}
@@ -0,0 +1,257 @@
+package cloudfeatures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	ctrlRuntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+const (
+	// ConfigMapName is the name of the ConfigMap, in the namespace of the
+	// MachineSets, in which the status of the features of their clouds is
+	// written.
+	ConfigMapName = "openstack-cloud-features"
+
+	// DefaultInterval is the default for Interval.
+	DefaultInterval = time.Hour
+)
+
+// cloudRef identifies a cloud in a clouds secret.
+type cloudRef struct {
+	Namespace string
+	Name      string
+	Cloud     string
+}
+
+var invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// configMapKey returns the key of the ConfigMap for the cloud.
+func (ref cloudRef) configMapKey() string {
+	return invalidConfigMapKeyChars.ReplaceAllString(fmt.Sprintf("%s.%s.%s", ref.Namespace, ref.Name, ref.Cloud), "-")
+}
+
+// providerSpecCloudRef returns the cloud of a providerSpec in namespace, or
+// false if it has no clouds secret.
+func providerSpecCloudRef(providerSpec machinev1.ProviderSpec, namespace string) (cloudRef, bool, error) {
+	pSpec, err := clients.MachineSpecFromProviderSpec(providerSpec)
+	if err != nil {
+		return cloudRef{}, false, err
+	}
+	if pSpec.CloudsSecret == nil || pSpec.CloudsSecret.Name == "" {
+		return cloudRef{}, false, nil
+	}
+
+	ref := cloudRef{
+		Namespace: pSpec.CloudsSecret.Namespace,
+		Name:      pSpec.CloudsSecret.Name,
+		Cloud:     pSpec.CloudName,
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = namespace
+	}
+	return ref, true, nil
+}
+
+// Reconciler checks that the cloud of each MachineSet supports the features
+// used by the machines of that cloud when it starts and periodically, and
+// writes the result to a ConfigMap.
+type Reconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Interval is how often the cloud of a MachineSet is checked.
+	Interval time.Duration
+
+	kubeClient *kubernetes.Clientset
+}
+
+// Reconcile implements controller runtime Reconciler interface.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrlRuntime.Request) (ctrlRuntime.Result, error) {
+	logger := r.Log.WithValues("machineset", req.Name, "namespace", req.Namespace)
+	logger.V(3).Info("Checking cloud features")
+
+	machineSet := &machinev1.MachineSet{}
+	if err := r.Client.Get(ctx, req.NamespacedName, machineSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Remove the status of a cloud no longer used
+			return ctrlRuntime.Result{}, r.writeStatus(ctx, req.Namespace, nil, Status{})
+		}
+		return ctrlRuntime.Result{}, err
+	}
+
+	if !machineSet.DeletionTimestamp.IsZero() {
+		return ctrlRuntime.Result{}, nil
+	}
+
+	ref, ok, err := providerSpecCloudRef(machineSet.Spec.Template.Spec.ProviderSpec, machineSet.Namespace)
+	if err != nil {
+		return ctrlRuntime.Result{}, fmt.Errorf("failed to get OpenStackProviderSpec from machineset: %v", err)
+	}
+	if !ok {
+		return ctrlRuntime.Result{}, nil
+	}
+
+	machines, err := r.machineFeatures(ctx, machineSet.Namespace, ref)
+	if err != nil {
+		return ctrlRuntime.Result{}, err
+	}
+
+	var status Status
+	cloud, err := clients.GetCloudFromSecret(r.kubeClient, ref.Namespace, ref.Name, ref.Cloud)
+	if err == nil {
+		var instanceService *clients.InstanceService
+		instanceService, err = clients.NewInstanceServiceFromCloud(ctx, cloud, clients.GetCACertificate(r.kubeClient))
+		if err == nil {
+			var capabilities clients.Capabilities
+			capabilities, err = instanceService.GetCapabilities()
+			status = Check(machines, capabilities)
+		}
+	}
+	if err != nil {
+		status = checkFailed(err)
+		logger.Info("Unable to check cloud features", "secret", ref.Namespace+"/"+ref.Name, "cloud", ref.Cloud, "reason", err.Error())
+	}
+
+	for _, feature := range status.UnusableFeatures {
+		logger.Info("Cloud doesn't support a feature used by machines", "secret", ref.Namespace+"/"+ref.Name, "cloud", ref.Cloud, "feature", feature.Name, "reason", feature.Reason, "machines", feature.Machines)
+	}
+
+	if err := r.writeStatus(ctx, machineSet.Namespace, &ref, status); err != nil {
+		return ctrlRuntime.Result{}, fmt.Errorf("failed to write cloud features status: %w", err)
+	}
+
+	return ctrlRuntime.Result{RequeueAfter: r.Interval}, nil
+}
+
+// machineFeatures returns the features used by each machine in namespace
+// which uses the cloud, by machine name.
+func (r *Reconciler) machineFeatures(ctx context.Context, namespace string, ref cloudRef) (map[string][]clients.Feature, error) {
+	machineList := &machinev1.MachineList{}
+	if err := r.Client.List(ctx, machineList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	machines := make(map[string][]clients.Feature)
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		machineRef, ok, err := providerSpecCloudRef(machine.Spec.ProviderSpec, machine.Namespace)
+		if err != nil || !ok || machineRef != ref {
+			continue
+		}
+		machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+		if err != nil {
+			continue
+		}
+		extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+		if err != nil {
+			continue
+		}
+		if features := clients.MachineFeatures(machineSpec, extensions); len(features) > 0 {
+			machines[machine.Name] = features
+		}
+	}
+	return machines, nil
+}
+
+// configMapKeys returns the keys of the clouds of the MachineSets in
+// namespace.
+func (r *Reconciler) configMapKeys(ctx context.Context, namespace string) (sets.Set[string], error) {
+	machineSets := &machinev1.MachineSetList{}
+	if err := r.Client.List(ctx, machineSets, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machinesets: %w", err)
+	}
+
+	keys := sets.New[string]()
+	for i := range machineSets.Items {
+		machineSet := &machineSets.Items[i]
+		if !machineSet.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if ref, ok, err := providerSpecCloudRef(machineSet.Spec.Template.Spec.ProviderSpec, machineSet.Namespace); err == nil && ok {
+			keys.Insert(ref.configMapKey())
+		}
+	}
+	return keys, nil
+}
+
+// writeStatus writes status to the status ConfigMap in namespace, unless ref
+// is nil, and removes the status of the clouds no longer used by a MachineSet
+// in namespace. Conditions which haven't changed keep their last transition
+// time.
+func (r *Reconciler) writeStatus(ctx context.Context, namespace string, ref *cloudRef, status Status) error {
+	keys, err := r.configMapKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	if ref != nil {
+		key = ref.configMapKey()
+	}
+	return utils.WriteConfigMapKey(ctx, r.kubeClient.CoreV1().ConfigMaps(namespace), ConfigMapName, key, keys, func(data string) (string, error) {
+		return mergeStatus(data, status)
+	})
+}
+
+// mergeStatus returns status serialized, with the last transition times of
+// the conditions of the previous serialized status which haven't changed.
+func mergeStatus(previousData string, status Status) (string, error) {
+	var previous Status
+	if previousData != "" {
+		// A previous status which can't be read is overwritten
+		_ = json.Unmarshal([]byte(previousData), &previous)
+	}
+	conditions := make([]metav1.Condition, len(status.Conditions))
+	for i, condition := range status.Conditions {
+		if old := meta.FindStatusCondition(previous.Conditions, condition.Type); old != nil && old.Status == condition.Status {
+			condition.LastTransitionTime = old.LastTransitionTime
+		}
+		conditions[i] = condition
+	}
+	status.Conditions = conditions
+
+	data, err := json.Marshal(status)
+	return string(data), err
+}
+
+// SetupWithManager creates a new controller for a manager.
+func (r *Reconciler) SetupWithManager(mgr ctrlRuntime.Manager, options controller.Options) error {
+	err := ctrlRuntime.NewControllerManagedBy(mgr).
+		Named("features").
+		// All MachineSets are reconciled when the controller starts, and
+		// every Interval after that
+		For(&machinev1.MachineSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(options).
+		Complete(r)
+	if err != nil {
+		return fmt.Errorf("controller creation failed: %w", err)
+	}
+
+	if r.Interval == 0 {
+		r.Interval = DefaultInterval
+	}
+	r.kubeClient, err = kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("could not create kubernetes client to talk to the API server: %w", err)
+	}
+
+	return nil
+}
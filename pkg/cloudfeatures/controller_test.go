@@ -0,0 +1,49 @@
+package cloudfeatures
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	before := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	previous, err := json.Marshal(Status{Conditions: []metav1.Condition{
+		{Type: "Degraded", Status: metav1.ConditionFalse, LastTransitionTime: before},
+	}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	unchanged := Status{Conditions: []metav1.Condition{{Type: "Degraded", Status: metav1.ConditionFalse, LastTransitionTime: now}}}
+	changed := Status{Conditions: []metav1.Condition{{Type: "Degraded", Status: metav1.ConditionTrue, LastTransitionTime: now}}}
+
+	for _, tt := range []struct {
+		name     string
+		previous string
+		status   Status
+		expected metav1.Time
+	}{
+		{name: "unchanged condition", previous: string(previous), status: unchanged, expected: before},
+		{name: "changed condition", previous: string(previous), status: changed, expected: now},
+		{name: "no previous status", status: unchanged, expected: now},
+		{name: "unreadable previous status", previous: "{", status: unchanged, expected: now},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			data, err := mergeStatus(tt.previous, tt.status)
+			g.Expect(err).NotTo(HaveOccurred())
+			var merged Status
+			g.Expect(json.Unmarshal([]byte(data), &merged)).To(Succeed())
+			g.Expect(merged.Conditions[0].LastTransitionTime.Equal(&tt.expected)).To(BeTrue())
+
+			// The status itself is left as it is, for retries
+			g.Expect(tt.status.Conditions[0].LastTransitionTime).To(Equal(now))
+		})
+	}
+}
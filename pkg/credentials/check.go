@@ -0,0 +1,105 @@
+package credentials
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// Status is the result of checking the credentials of a cloud.
+type Status struct {
+	// Valid is true if a token could be issued which is scoped to a project
+	// and has all the required roles.
+	Valid bool `json:"valid"`
+
+	// Message describes why the credentials are not valid.
+	Message string `json:"message,omitempty"`
+
+	// ProjectID and ProjectName are the project the token is scoped to.
+	ProjectID   string `json:"projectID,omitempty"`
+	ProjectName string `json:"projectName,omitempty"`
+
+	// Roles are the names of the roles of the token.
+	Roles []string `json:"roles,omitempty"`
+
+	// ExpiresAt is when the token which was issued expires.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// LastChecked is when the credentials were checked.
+	LastChecked time.Time `json:"lastChecked"`
+}
+
+// Check authenticates with the credentials of cloud and checks that the issued
+// token is scoped to a project and has all of requiredRoles.
+func Check(cloud clientconfig.Cloud, cert []byte, requiredRoles []string) Status {
+	status := Status{LastChecked: time.Now()}
+
+	provider, err := clients.GetProviderClient(cloud, cert)
+	if err != nil {
+		status.Message = err.Error()
+		return status
+	}
+
+	// The token is only scoped if the identity v3 API is used
+	authResult, ok := provider.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		status.Message = "authentication did not use the identity v3 API"
+		return status
+	}
+
+	token, err := authResult.ExtractToken()
+	if err != nil {
+		status.Message = fmt.Sprintf("unable to read token: %v", err)
+		return status
+	}
+	status.ExpiresAt = token.ExpiresAt
+
+	project, err := authResult.ExtractProject()
+	if err != nil {
+		status.Message = fmt.Sprintf("unable to read project of token: %v", err)
+		return status
+	}
+	roles, err := authResult.ExtractRoles()
+	if err != nil {
+		status.Message = fmt.Sprintf("unable to read roles of token: %v", err)
+		return status
+	}
+
+	evaluate(&status, project, roles, requiredRoles)
+	return status
+}
+
+// evaluate sets the project, roles and validity of status from the contents
+// of a token.
+func evaluate(status *Status, project *tokens.Project, roles []tokens.Role, requiredRoles []string) {
+	if project == nil {
+		status.Message = "token is not scoped to a project"
+		return
+	}
+	status.ProjectID = project.ID
+	status.ProjectName = project.Name
+
+	status.Roles = make([]string, len(roles))
+	for i := range roles {
+		status.Roles[i] = roles[i].Name
+	}
+
+	var missing []string
+	for _, role := range requiredRoles {
+		if !slices.Contains(status.Roles, role) {
+			missing = append(missing, role)
+		}
+	}
+	if len(missing) > 0 {
+		status.Message = fmt.Sprintf("token is missing required roles: %s", strings.Join(missing, ", "))
+		return
+	}
+
+	status.Valid = true
+}
@@ -0,0 +1,62 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+func TestEvaluate(t *testing.T) {
+	project := &tokens.Project{ID: "b4b5e2a0-6d1c-4a8e-9f3d-2c7a1e0b5d94", Name: "openshift"}
+	roles := []tokens.Role{{Name: "member"}, {Name: "reader"}}
+
+	tests := []struct {
+		name          string
+		project       *tokens.Project
+		requiredRoles []string
+		valid         bool
+		message       string
+	}{
+		{
+			name:    "no required roles",
+			project: project,
+			valid:   true,
+		},
+		{
+			name:          "has required roles",
+			project:       project,
+			requiredRoles: []string{"member", "reader"},
+			valid:         true,
+		},
+		{
+			name:          "missing required roles",
+			project:       project,
+			requiredRoles: []string{"member", "load-balancer_member", "swiftoperator"},
+			message:       "token is missing required roles: load-balancer_member, swiftoperator",
+		},
+		{
+			name:    "not scoped to a project",
+			message: "token is not scoped to a project",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status Status
+			evaluate(&status, tt.project, roles, tt.requiredRoles)
+			if status.Valid != tt.valid {
+				t.Errorf("Expected valid to be %t, got %t", tt.valid, status.Valid)
+			}
+			if status.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, status.Message)
+			}
+		})
+	}
+}
+
+func TestConfigMapKey(t *testing.T) {
+	ref := cloudRef{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials", Cloud: "my cloud"}
+	if key := ref.configMapKey(); key != "openshift-machine-api.openstack-cloud-credentials.my-cloud" {
+		t.Errorf("Unexpected key %q", key)
+	}
+}
@@ -0,0 +1,210 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	ctrlRuntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+const (
+	// StatusConfigMapName is the name of the ConfigMap, in the namespace of
+	// the MachineSets, in which the status of their credentials is written.
+	StatusConfigMapName = "openstack-credentials-status"
+
+	// CredentialsValidCondition is set on a MachineSet to report whether the
+	// credentials in its clouds secret are valid.
+	CredentialsValidCondition machinev1.ConditionType = "CredentialsValid"
+
+	// DefaultInterval is the default for Interval.
+	DefaultInterval = 10 * time.Minute
+)
+
+// cloudRef identifies a cloud in a clouds secret.
+type cloudRef struct {
+	Namespace string
+	Name      string
+	Cloud     string
+}
+
+var invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// configMapKey returns the key of the status ConfigMap for the cloud.
+func (ref cloudRef) configMapKey() string {
+	return invalidConfigMapKeyChars.ReplaceAllString(fmt.Sprintf("%s.%s.%s", ref.Namespace, ref.Name, ref.Cloud), "-")
+}
+
+// Reconciler periodically checks the credentials in the clouds secret of each
+// MachineSet, so that problems such as expired credentials are reported before
+// machine operations fail.
+type Reconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Interval is how often the credentials of a MachineSet are checked.
+	Interval time.Duration
+
+	// RequiredRoles are roles which a token issued for the credentials
+	// must have.
+	RequiredRoles []string
+
+	kubeClient *kubernetes.Clientset
+}
+
+// Reconcile implements controller runtime Reconciler interface.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrlRuntime.Request) (ctrlRuntime.Result, error) {
+	logger := r.Log.WithValues("machineset", req.Name, "namespace", req.Namespace)
+	logger.V(3).Info("Checking credentials")
+
+	machineSet := &machinev1.MachineSet{}
+	if err := r.Client.Get(ctx, req.NamespacedName, machineSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Remove the status of a cloud no longer used
+			return ctrlRuntime.Result{}, r.writeStatus(ctx, req.Namespace, nil, Status{})
+		}
+		return ctrlRuntime.Result{}, err
+	}
+
+	if !machineSet.DeletionTimestamp.IsZero() {
+		return ctrlRuntime.Result{}, nil
+	}
+
+	ref, ok, err := machineSetCloudRef(machineSet)
+	if err != nil {
+		return ctrlRuntime.Result{}, fmt.Errorf("failed to get OpenStackProviderSpec from machineset: %v", err)
+	}
+	if !ok {
+		return ctrlRuntime.Result{}, nil
+	}
+
+	var status Status
+	cloud, err := clients.GetCloudFromSecret(r.kubeClient, ref.Namespace, ref.Name, ref.Cloud)
+	if err != nil {
+		status = Status{Message: err.Error(), LastChecked: time.Now()}
+	} else {
+		status = Check(cloud, clients.GetCACertificate(r.kubeClient), r.RequiredRoles)
+	}
+
+	if !status.Valid {
+		logger.Info("Credentials are not valid", "secret", ref.Namespace+"/"+ref.Name, "cloud", ref.Cloud, "reason", status.Message)
+	}
+	recordMetrics(ref, status)
+
+	if err := r.writeStatus(ctx, machineSet.Namespace, &ref, status); err != nil {
+		return ctrlRuntime.Result{}, fmt.Errorf("failed to write credentials status: %w", err)
+	}
+
+	patch := client.MergeFrom(machineSet.DeepCopy())
+	if status.Valid {
+		conditions.Set(machineSet, conditions.TrueCondition(CredentialsValidCondition))
+	} else {
+		conditions.MarkFalse(machineSet, CredentialsValidCondition, "InvalidCredentials", machinev1.ConditionSeverityError, "%s", status.Message)
+	}
+	if err := r.Client.Status().Patch(ctx, machineSet, patch); err != nil {
+		return ctrlRuntime.Result{}, fmt.Errorf("failed to patch machineSet status: %w", err)
+	}
+
+	return ctrlRuntime.Result{RequeueAfter: r.Interval}, nil
+}
+
+// machineSetCloudRef returns the cloud of machineSet, or false if it has no
+// clouds secret.
+func machineSetCloudRef(machineSet *machinev1.MachineSet) (cloudRef, bool, error) {
+	pSpec, err := clients.MachineSpecFromProviderSpec(machineSet.Spec.Template.Spec.ProviderSpec)
+	if err != nil {
+		return cloudRef{}, false, err
+	}
+	if pSpec.CloudsSecret == nil || pSpec.CloudsSecret.Name == "" {
+		return cloudRef{}, false, nil
+	}
+
+	ref := cloudRef{
+		Namespace: pSpec.CloudsSecret.Namespace,
+		Name:      pSpec.CloudsSecret.Name,
+		Cloud:     pSpec.CloudName,
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = machineSet.Namespace
+	}
+	return ref, true, nil
+}
+
+// configMapKeys returns the keys of the clouds of the MachineSets in
+// namespace.
+func (r *Reconciler) configMapKeys(ctx context.Context, namespace string) (sets.Set[string], error) {
+	machineSets := &machinev1.MachineSetList{}
+	if err := r.Client.List(ctx, machineSets, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list machinesets: %w", err)
+	}
+
+	keys := sets.New[string]()
+	for i := range machineSets.Items {
+		machineSet := &machineSets.Items[i]
+		if !machineSet.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if ref, ok, err := machineSetCloudRef(machineSet); err == nil && ok {
+			keys.Insert(ref.configMapKey())
+		}
+	}
+	return keys, nil
+}
+
+// writeStatus writes status to the status ConfigMap in namespace, unless ref
+// is nil, and removes the status of the clouds no longer used by a MachineSet
+// in namespace.
+func (r *Reconciler) writeStatus(ctx context.Context, namespace string, ref *cloudRef, status Status) error {
+	keys, err := r.configMapKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	if ref != nil {
+		key = ref.configMapKey()
+	}
+	return utils.WriteConfigMapKey(ctx, r.kubeClient.CoreV1().ConfigMaps(namespace), StatusConfigMapName, key, keys, func(string) (string, error) {
+		data, err := json.Marshal(status)
+		return string(data), err
+	})
+}
+
+// SetupWithManager creates a new controller for a manager.
+func (r *Reconciler) SetupWithManager(mgr ctrlRuntime.Manager, options controller.Options) error {
+	err := ctrlRuntime.NewControllerManagedBy(mgr).
+		Named("credentials").
+		// Changes to the status of a MachineSet don't affect its
+		// credentials, which are rechecked every Interval anyway
+		For(&machinev1.MachineSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(options).
+		Complete(r)
+	if err != nil {
+		return fmt.Errorf("controller creation failed: %w", err)
+	}
+
+	if r.Interval == 0 {
+		r.Interval = DefaultInterval
+	}
+	r.kubeClient, err = kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("could not create kubernetes client to talk to the API server: %w", err)
+	}
+
+	return nil
+}
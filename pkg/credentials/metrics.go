@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	credentialsValid = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapo_openstack_credentials_valid",
+			Help: "Whether the OpenStack credentials of a clouds secret were valid when last checked.",
+		},
+		[]string{"secret_namespace", "secret_name", "cloud"},
+	)
+
+	credentialsTokenExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapo_openstack_credentials_token_expiry_timestamp_seconds",
+			Help: "When the token issued for the OpenStack credentials of a clouds secret when last checked expires.",
+		},
+		[]string{"secret_namespace", "secret_name", "cloud"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(credentialsValid, credentialsTokenExpiry)
+}
+
+func recordMetrics(ref cloudRef, status Status) {
+	labels := prometheus.Labels{
+		"secret_namespace": ref.Namespace,
+		"secret_name":      ref.Name,
+		"cloud":            ref.Cloud,
+	}
+
+	if status.Valid {
+		credentialsValid.With(labels).Set(1)
+	} else {
+		credentialsValid.With(labels).Set(0)
+	}
+
+	if status.ExpiresAt.IsZero() {
+		credentialsTokenExpiry.Delete(labels)
+	} else {
+		credentialsTokenExpiry.With(labels).Set(float64(status.ExpiresAt.Unix()))
+	}
+}
@@ -0,0 +1,91 @@
+// Package export writes the MachineSets and Machines of the cluster as the
+// equivalent CAPO OpenStackMachineTemplates and OpenStackMachines, to help
+// plan the migration from Machine API to Cluster API.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/machine"
+)
+
+// Run writes the MachineSets and Machines in namespace, or in all namespaces
+// if it is empty, to w as a YAML stream of OpenStackMachineTemplates and
+// OpenStackMachines. c must be able to read Infrastructures, MachineSets and
+// Machines.
+func Run(ctx context.Context, c client.Client, namespace string, w io.Writer) error {
+	infra := &configv1.Infrastructure{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "cluster"}, infra); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get cluster Infrastructure object: %w", err)
+	}
+	var platformStatus *configv1.OpenStackPlatformStatus
+	if infra.Status.PlatformStatus != nil {
+		platformStatus = infra.Status.PlatformStatus.OpenStack
+	}
+
+	machineSets := &machinev1.MachineSetList{}
+	if err := c.List(ctx, machineSets, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list MachineSets: %w", err)
+	}
+	machines := &machinev1.MachineList{}
+	if err := c.List(ctx, machines, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("failed to list Machines: %w", err)
+	}
+
+	return write(w, machineSets.Items, machines.Items, platformStatus)
+}
+
+// write writes the OpenStackMachineTemplates of machineSets followed by the
+// OpenStackMachines of machines to w. The notes of each object are written
+// as comments before it.
+func write(w io.Writer, machineSets []machinev1.MachineSet, machines []machinev1.Machine, platformStatus *configv1.OpenStackPlatformStatus) error {
+	for i := range machineSets {
+		machineSet := &machineSets[i]
+		template, notes, err := machine.MachineSetToOpenStackMachineTemplate(machineSet, platformStatus)
+		if err != nil {
+			return fmt.Errorf("failed to convert MachineSet %s/%s: %w", machineSet.Namespace, machineSet.Name, err)
+		}
+		if err := writeDocument(w, template, notes); err != nil {
+			return err
+		}
+	}
+
+	for i := range machines {
+		m := &machines[i]
+		openStackMachine, notes, err := machine.MachineToOpenStackMachine(m, platformStatus)
+		if err != nil {
+			return fmt.Errorf("failed to convert Machine %s/%s: %w", m.Namespace, m.Name, err)
+		}
+		if err := writeDocument(w, openStackMachine, notes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDocument writes obj to w as a YAML document preceded by notes as
+// comments.
+func writeDocument(w io.Writer, obj interface{}, notes []string) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if _, err := fmt.Fprintf(w, "# %s\n", note); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestWrite(t *testing.T) {
+	providerSpec := machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(`{"flavor":"m1.large","image":"rhcos","serverGroupName":"workers"}`)}}
+	machineSets := []machinev1.MachineSet{{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "openshift-machine-api"}}}
+	machineSets[0].Spec.Template.Spec.ProviderSpec = providerSpec
+	machines := []machinev1.Machine{{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"},
+		Spec:       machinev1.MachineSpec{ProviderSpec: providerSpec},
+	}}
+
+	var out bytes.Buffer
+	if err := write(&out, machineSets, machines, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `---
+# serverGroupName workers must be replaced by the ID of the server group
+apiVersion: infrastructure.cluster.x-k8s.io/v1alpha7
+kind: OpenStackMachineTemplate
+metadata:
+  creationTimestamp: null
+  name: worker
+  namespace: openshift-machine-api
+spec:
+  template:
+    spec:
+      cloudName: ""
+      flavor: m1.large
+      image: rhcos
+---
+# serverGroupName workers must be replaced by the ID of the server group
+apiVersion: infrastructure.cluster.x-k8s.io/v1alpha7
+kind: OpenStackMachine
+metadata:
+  creationTimestamp: null
+  name: worker-0
+  namespace: openshift-machine-api
+spec:
+  cloudName: ""
+  flavor: m1.large
+  image: rhcos
+status:
+  ready: false
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteInvalidProviderSpec(t *testing.T) {
+	machines := []machinev1.Machine{{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"}}}
+
+	var out bytes.Buffer
+	err := write(&out, nil, machines, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to convert Machine openshift-machine-api/worker-0") {
+		t.Errorf("Expected a conversion error, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package features defines the feature gates of the provider, which enable
+// experimental behaviours per cluster with the --feature-gates flag, so that
+// they can ship disabled until they are proven.
+package features
+
+import (
+	"k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/featuregate"
+)
+
+const (
+	// InstanceGarbageCollection deletes the servers tagged with the cluster
+	// which no machine owns, instead of only reporting them.
+	InstanceGarbageCollection featuregate.Feature = "OpenStackInstanceGarbageCollection"
+)
+
+// defaultFeatureGates are the feature gates of the provider and their
+// defaults. Experimental behaviours are Alpha and disabled by default.
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	InstanceGarbageCollection: {Default: false, PreRelease: featuregate.Alpha},
+}
+
+// Gates are the feature gates which the provider reads. The provider features
+// are added to them with Add, together with the OpenShift features, and set
+// from the --feature-gates flag.
+var Gates featuregate.FeatureGate = feature.DefaultFeatureGate
+
+// Add adds the feature gates of the provider to gates.
+func Add(gates featuregate.MutableFeatureGate) error {
+	return gates.Add(defaultFeatureGates)
+}
+
+// Enabled returns whether the provider feature is enabled.
+func Enabled(f featuregate.Feature) bool {
+	return Gates.Enabled(f)
+}
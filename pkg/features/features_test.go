@@ -0,0 +1,27 @@
+package features
+
+import (
+	"testing"
+
+	"k8s.io/component-base/featuregate"
+)
+
+func TestAdd(t *testing.T) {
+	gates := featuregate.NewFeatureGate()
+	if err := Add(gates); err != nil {
+		t.Fatalf("Unexpected error adding the feature gates: %v", err)
+	}
+
+	for f := range defaultFeatureGates {
+		if gates.Enabled(f) {
+			t.Errorf("Expected %s to be disabled by default", f)
+		}
+	}
+
+	if err := gates.Set("OpenStackInstanceGarbageCollection=true"); err != nil {
+		t.Fatalf("Unexpected error setting the feature gates: %v", err)
+	}
+	if !gates.Enabled(InstanceGarbageCollection) {
+		t.Errorf("Expected %s to be enabled", InstanceGarbageCollection)
+	}
+}
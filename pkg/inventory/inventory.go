@@ -0,0 +1,242 @@
+// Package inventory periodically compares the machines of each cluster with
+// the OpenStack servers tagged with the cluster, to detect servers deleted out
+// of band and servers which were leaked.
+package inventory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/features"
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+// DefaultInterval is the default for Interval.
+const DefaultInterval = 10 * time.Minute
+
+// The prefix of ProviderID for OpenStack machines
+const providerPrefix = "openstack:///"
+
+// The prefix of the tag with which the machine actuator tags the server of
+// each machine with the UID of the machine
+const machineUIDTagPrefix = "machine-uid:"
+
+// garbageCollectionMinAge is how old a server without a machine must be
+// before it is garbage collected, so that the server of a machine which is
+// being created is never deleted before the machine records it.
+const garbageCollectionMinAge = time.Hour
+
+// Reporter exports the number of machines without instances and instances
+// without machines of each cluster as metrics. With the
+// OpenStackInstanceGarbageCollection feature gate, it also deletes the
+// instances without machines.
+type Reporter struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Interval is how often machines and instances are compared.
+	Interval time.Duration
+
+	kubeClient kubernetes.Interface
+
+	// leaked are the IDs of the instances without machines found by the
+	// previous comparison. Only instances found without machines by two
+	// consecutive comparisons are garbage collected.
+	leaked sets.Set[string]
+}
+
+// inventoryKey identifies the servers of a cluster in a cloud.
+type inventoryKey struct {
+	secretNamespace string
+	secretName      string
+	cloud           string
+	clusterTag      string
+}
+
+// inventory is the machines of a cluster in a cloud.
+type inventory struct {
+	// machine is any machine, used to authenticate with the cloud
+	machine *machinev1.Machine
+
+	// instanceIDs are the instance IDs of the machines with a providerID
+	// which are not being deleted
+	instanceIDs sets.Set[string]
+
+	// Servers with these IDs or names are not counted as instances without
+	// machines: they belong to machines which are being deleted, or which
+	// have no providerID yet because they are being created.
+	ignoredIDs   sets.Set[string]
+	ignoredNames sets.Set[string]
+
+	// machineUIDs are the UIDs of all the machines. Servers tagged with one
+	// of them belong to a machine, whatever their name.
+	machineUIDs sets.Set[string]
+}
+
+// compare returns the number of machines without instances and the instances
+// without machines given the servers tagged with the cluster.
+func (inv *inventory) compare(allServers []servers.Server) (int, []servers.Server) {
+	serverIDs := sets.New[string]()
+	var instancesWithoutMachines []servers.Server
+	for _, server := range allServers {
+		serverIDs.Insert(server.ID)
+		if !inv.instanceIDs.Has(server.ID) && !inv.ignoredIDs.Has(server.ID) && !inv.ignoredNames.Has(server.Name) && !inv.hasMachineUIDTag(server) {
+			instancesWithoutMachines = append(instancesWithoutMachines, server)
+		}
+	}
+	return inv.instanceIDs.Difference(serverIDs).Len(), instancesWithoutMachines
+}
+
+// hasMachineUIDTag returns whether the server is tagged with the UID of one of
+// the machines.
+func (inv *inventory) hasMachineUIDTag(server servers.Server) bool {
+	if server.Tags == nil {
+		return false
+	}
+	for _, tag := range *server.Tags {
+		if uid, ok := strings.CutPrefix(tag, machineUIDTagPrefix); ok && inv.machineUIDs.Has(uid) {
+			return true
+		}
+	}
+	return false
+}
+
+// garbage returns the instances without machines which can be garbage
+// collected: those which were also found without machines by the previous
+// comparison, and which are older than garbageCollectionMinAge.
+func garbage(instancesWithoutMachines []servers.Server, leaked sets.Set[string], now time.Time) []servers.Server {
+	var garbage []servers.Server
+	for _, server := range instancesWithoutMachines {
+		if leaked.Has(server.ID) && now.Sub(server.Created) >= garbageCollectionMinAge {
+			garbage = append(garbage, server)
+		}
+	}
+	return garbage
+}
+
+// SetupWithManager adds the reporter to a manager.
+func (r *Reporter) SetupWithManager(mgr manager.Manager) error {
+	if r.Interval == 0 {
+		r.Interval = DefaultInterval
+	}
+
+	var err error
+	r.kubeClient, err = kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	return mgr.Add(r)
+}
+
+// Start implements manager.Runnable.
+func (r *Reporter) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, r.report, r.Interval)
+	return nil
+}
+
+func (r *Reporter) report(ctx context.Context) {
+	machines := &machinev1.MachineList{}
+	if err := r.Client.List(ctx, machines); err != nil {
+		r.Log.Error(err, "Failed to list machines")
+		return
+	}
+
+	leaked := sets.New[string]()
+	for key, inv := range groupMachines(machines.Items) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, r.kubeClient, inv.machine)
+		if err != nil {
+			r.Log.Error(err, "Failed to get instance service", "cluster", key.clusterTag)
+			continue
+		}
+		servers, err := instanceService.ListServersByTag(key.clusterTag)
+		if err != nil {
+			r.Log.Error(err, "Failed to list servers", "cluster", key.clusterTag)
+			continue
+		}
+
+		machinesWithoutInstances, instancesWithoutMachines := inv.compare(servers)
+		if machinesWithoutInstances > 0 || len(instancesWithoutMachines) > 0 {
+			r.Log.Info("Machines and instances don't match", "cluster", key.clusterTag,
+				"machinesWithoutInstances", machinesWithoutInstances, "instancesWithoutMachines", len(instancesWithoutMachines))
+		}
+		recordMetrics(key.clusterTag, machinesWithoutInstances, len(instancesWithoutMachines))
+
+		if features.Enabled(features.InstanceGarbageCollection) {
+			r.collectGarbage(key.clusterTag, instanceService, garbage(instancesWithoutMachines, r.leaked, time.Now()))
+		}
+		for _, server := range instancesWithoutMachines {
+			leaked.Insert(server.ID)
+		}
+	}
+	r.leaked = leaked
+}
+
+// collectGarbage deletes the instances without machines of a cluster.
+func (r *Reporter) collectGarbage(cluster string, instanceService *clients.InstanceService, garbage []servers.Server) {
+	for _, server := range garbage {
+		r.Log.Info("Deleting instance without machine", "cluster", cluster, "id", server.ID, "name", server.Name, "created", server.Created)
+		if err := instanceService.DeleteServer(server.ID); err != nil {
+			r.Log.Error(err, "Failed to delete instance without machine", "cluster", cluster, "id", server.ID)
+			continue
+		}
+		garbageCollectedInstances.WithLabelValues(cluster).Inc()
+	}
+}
+
+// groupMachines groups machines by the cloud and cluster of their instances.
+func groupMachines(machines []machinev1.Machine) map[inventoryKey]*inventory {
+	inventories := make(map[inventoryKey]*inventory)
+	for i := range machines {
+		machine := &machines[i]
+
+		machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+		if err != nil || machineSpec.CloudsSecret == nil {
+			continue
+		}
+		key := inventoryKey{
+			secretNamespace: machineSpec.CloudsSecret.Namespace,
+			secretName:      machineSpec.CloudsSecret.Name,
+			cloud:           machineSpec.CloudName,
+			clusterTag:      utils.GetClusterNameWithNamespace(machine),
+		}
+		if key.secretNamespace == "" {
+			key.secretNamespace = machine.Namespace
+		}
+
+		inv, ok := inventories[key]
+		if !ok {
+			inv = &inventory{
+				machine:      machine,
+				instanceIDs:  sets.New[string](),
+				ignoredIDs:   sets.New[string](),
+				ignoredNames: sets.New[string](),
+				machineUIDs:  sets.New[string](),
+			}
+			inventories[key] = inv
+		}
+
+		inv.machineUIDs.Insert(string(machine.UID))
+		switch {
+		case machine.Spec.ProviderID == nil:
+			inv.ignoredNames.Insert(machine.Name)
+		case !strings.HasPrefix(*machine.Spec.ProviderID, providerPrefix):
+			continue
+		case machine.DeletionTimestamp != nil:
+			inv.ignoredIDs.Insert(strings.TrimPrefix(*machine.Spec.ProviderID, providerPrefix))
+		default:
+			inv.instanceIDs.Insert(strings.TrimPrefix(*machine.Spec.ProviderID, providerPrefix))
+		}
+	}
+	return inventories
+}
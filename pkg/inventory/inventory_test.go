@@ -0,0 +1,97 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+)
+
+func newMachine(name, providerID string, deleting bool) machinev1.Machine {
+	machine := machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			UID:       types.UID(name + "-uid"),
+			Namespace: "openshift-machine-api",
+			Labels:    map[string]string{machinev1.MachineClusterIDLabel: "cluster-id"},
+		},
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{
+				Value: &runtime.RawExtension{
+					Raw: []byte(`{"cloudName":"openstack","cloudsSecret":{"name":"openstack-cloud-credentials"}}`),
+				},
+			},
+		},
+	}
+	if providerID != "" {
+		machine.Spec.ProviderID = ptr.To(providerID)
+	}
+	if deleting {
+		machine.DeletionTimestamp = &metav1.Time{}
+	}
+	return machine
+}
+
+func TestInventory(t *testing.T) {
+	machines := []machinev1.Machine{
+		newMachine("running", "openstack:///running-id", false),
+		newMachine("deleted-out-of-band", "openstack:///deleted-id", false),
+		newMachine("deleting", "openstack:///deleting-id", true),
+		newMachine("creating", "", false),
+		newMachine("other-provider", "aws:///other-id", false),
+	}
+
+	inventories := groupMachines(machines)
+	if len(inventories) != 1 {
+		t.Fatalf("expected 1 inventory, got %d", len(inventories))
+	}
+	key := inventoryKey{
+		secretNamespace: "openshift-machine-api",
+		secretName:      "openstack-cloud-credentials",
+		cloud:           "openstack",
+		clusterTag:      "openshift-machine-api-cluster-id",
+	}
+	inv, ok := inventories[key]
+	if !ok {
+		t.Fatalf("expected inventory for %+v, got %+v", key, inventories)
+	}
+
+	machinesWithoutInstances, instancesWithoutMachines := inv.compare([]servers.Server{
+		{ID: "running-id", Name: "running"},
+		{ID: "deleting-id", Name: "deleting"},
+		{ID: "creating-id", Name: "creating"},
+		{ID: "renamed-id", Name: "renamed", Tags: &[]string{"machine-uid:creating-uid"}},
+		{ID: "leaked-id", Name: "leaked", Tags: &[]string{"machine-uid:deleted-machine-uid"}},
+	})
+	if machinesWithoutInstances != 1 {
+		t.Errorf("expected 1 machine without instance, got %d", machinesWithoutInstances)
+	}
+	if len(instancesWithoutMachines) != 1 || instancesWithoutMachines[0].ID != "leaked-id" {
+		t.Errorf("expected leaked-id to be the only instance without machine, got %+v", instancesWithoutMachines)
+	}
+}
+
+func TestGarbage(t *testing.T) {
+	now := time.Now()
+	instancesWithoutMachines := []servers.Server{
+		{ID: "old-leaked-id", Created: now.Add(-2 * garbageCollectionMinAge)},
+		{ID: "new-leaked-id", Created: now.Add(-garbageCollectionMinAge / 2)},
+		{ID: "old-first-seen-id", Created: now.Add(-2 * garbageCollectionMinAge)},
+	}
+	leaked := sets.New("old-leaked-id", "new-leaked-id", "deleted-id")
+
+	got := garbage(instancesWithoutMachines, leaked, now)
+	if len(got) != 1 || got[0].ID != "old-leaked-id" {
+		t.Errorf("expected old-leaked-id to be the only garbage, got %+v", got)
+	}
+
+	if got := garbage(instancesWithoutMachines, nil, now); len(got) != 0 {
+		t.Errorf("expected no garbage on the first comparison, got %+v", got)
+	}
+}
@@ -0,0 +1,41 @@
+package inventory
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	machinesWithoutInstances = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapo_machines_without_instances",
+			Help: "Number of machines with a providerID whose OpenStack server does not exist.",
+		},
+		[]string{"cluster"},
+	)
+
+	instancesWithoutMachines = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapo_instances_without_machines",
+			Help: "Number of OpenStack servers tagged with the cluster which do not belong to a machine.",
+		},
+		[]string{"cluster"},
+	)
+
+	garbageCollectedInstances = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapo_garbage_collected_instances_total",
+			Help: "Number of OpenStack servers without machines deleted with the OpenStackInstanceGarbageCollection feature gate.",
+		},
+		[]string{"cluster"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(machinesWithoutInstances, instancesWithoutMachines, garbageCollectedInstances)
+}
+
+func recordMetrics(cluster string, machines, instances int) {
+	machinesWithoutInstances.WithLabelValues(cluster).Set(float64(machines))
+	instancesWithoutMachines.WithLabelValues(cluster).Set(float64(instances))
+}
@@ -0,0 +1,155 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// Flavor extra specs which request PCI devices and vGPUs. vGPUs may also be
+// requested in granular resource groups, e.g. resources1:VGPU.
+const (
+	extraSpecPCIAlias       = "pci_passthrough:alias"
+	extraSpecResourcePrefix = "resources"
+	resourceClassVGPU       = "VGPU"
+)
+
+// acceleratorRequest is the PCI devices and vGPUs requested by a flavor.
+type acceleratorRequest struct {
+	// pciAliases are the numbers of PCI devices requested by alias
+	pciAliases map[string]int
+	// vGPUs are the numbers of vGPUs requested by each resource group,
+	// each of which must be provided by a single resource provider
+	vGPUs []int
+}
+
+func (r *acceleratorRequest) String() string {
+	var requests []string
+	aliases := make([]string, 0, len(r.pciAliases))
+	for alias := range r.pciAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		requests = append(requests, fmt.Sprintf("%d PCI devices of alias %s", r.pciAliases[alias], alias))
+	}
+	for _, vGPUs := range r.vGPUs {
+		requests = append(requests, fmt.Sprintf("%d vGPUs", vGPUs))
+	}
+	return strings.Join(requests, ", ")
+}
+
+// parseAcceleratorRequest returns the PCI devices and vGPUs requested by the
+// extra specs of the flavor, or nil if it requests none.
+func parseAcceleratorRequest(flavor *flavors.Flavor, extraSpecs map[string]string) (*acceleratorRequest, error) {
+	request := &acceleratorRequest{}
+
+	if value, ok := extraSpecs[extraSpecPCIAlias]; ok {
+		request.pciAliases = make(map[string]int)
+		for _, item := range strings.Split(value, ",") {
+			alias, count, ok := strings.Cut(strings.TrimSpace(item), ":")
+			n, err := strconv.Atoi(count)
+			if !ok || alias == "" || err != nil || n < 1 {
+				return nil, fmt.Errorf("flavor %s: %s must be a list of alias:count, got %q", flavor.Name, extraSpecPCIAlias, value)
+			}
+			request.pciAliases[alias] += n
+		}
+	}
+
+	keys := make([]string, 0, len(extraSpecs))
+	for key := range extraSpecs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		group, resourceClass, ok := strings.Cut(key, ":")
+		if !ok || resourceClass != resourceClassVGPU || !strings.HasPrefix(group, extraSpecResourcePrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(extraSpecs[key])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("flavor %s: %s must be a number of vGPUs, got %q", flavor.Name, key, extraSpecs[key])
+		}
+		if n > 0 {
+			request.vGPUs = append(request.vGPUs, n)
+		}
+	}
+
+	if len(request.pciAliases) == 0 && len(request.vGPUs) == 0 {
+		return nil, nil
+	}
+	return request, nil
+}
+
+// acceleratorService is the part of clients.InstanceService which checks
+// that requested resources exist.
+type acceleratorService interface {
+	HasResourceProvider(resources string) (bool, bool, error)
+}
+
+// missingVGPUs returns the numbers of vGPUs requested which no resource
+// provider has the capacity for. PCI aliases are defined in the configuration
+// of Nova, so they can't be checked. Neither can vGPUs if resource providers
+// can't be listed.
+func missingVGPUs(request *acceleratorRequest, service acceleratorService) ([]int, error) {
+	var missing []int
+	for _, vGPUs := range request.vGPUs {
+		found, discoverable, err := service.HasResourceProvider(fmt.Sprintf("%s:%d", resourceClassVGPU, vGPUs))
+		if err != nil {
+			return nil, err
+		}
+		if discoverable && !found {
+			missing = append(missing, vGPUs)
+		}
+	}
+	return missing, nil
+}
+
+// checkAcceleratorCapacity emits a warning event if no compute host currently
+// has the capacity for the vGPUs requested by the flavor of machine. The
+// machine is created anyway, since capacity may become available.
+func (oc *OpenstackClient) checkAcceleratorCapacity(machine *machinev1.Machine, flavor *flavors.Flavor, request *acceleratorRequest, service acceleratorService) {
+	if request == nil {
+		return
+	}
+	missing, err := missingVGPUs(request, service)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to check the capacity for the vGPUs of flavor %s: %v", machine.Name, flavor.Name, err)
+		return
+	}
+	for _, vGPUs := range missing {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InsufficientVGPUs", "No compute host has the capacity for the %d vGPUs requested by flavor %s", vGPUs, flavor.Name)
+	}
+}
+
+// recordAcceleratorFailure emits a warning event naming the PCI devices and
+// vGPUs requested by the flavor of machine, if any, when its instance could
+// not be created. Nova only reports that no valid host was found if none of
+// the compute hosts has them free.
+func (oc *OpenstackClient) recordAcceleratorFailure(ctx context.Context, machine *machinev1.Machine, flavorName string) {
+	instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to get flavor %s: %v", machine.Name, flavorName, err)
+		return
+	}
+	flavor, extraSpecs, err := getFlavor(flavorName, instanceService)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to get flavor %s: %v", machine.Name, flavorName, err)
+		return
+	}
+	request, err := parseAcceleratorRequest(flavor, extraSpecs)
+	if err != nil || request == nil {
+		return
+	}
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "AcceleratorsUnavailable",
+		"Flavor %s requests %s: check that compute hosts in the availability zone of the machine have them free", flavor.Name, request)
+}
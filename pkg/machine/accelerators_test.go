@@ -0,0 +1,92 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+)
+
+func TestParseAcceleratorRequest(t *testing.T) {
+	flavor := &flavors.Flavor{Name: "g1.large"}
+
+	tests := []struct {
+		name       string
+		extraSpecs map[string]string
+		expected   *acceleratorRequest
+		wantErr    bool
+	}{
+		{
+			name:       "no accelerators",
+			extraSpecs: map[string]string{"hw:cpu_policy": "dedicated"},
+		},
+		{
+			name:       "PCI aliases",
+			extraSpecs: map[string]string{"pci_passthrough:alias": "a100:2, nvme:1"},
+			expected:   &acceleratorRequest{pciAliases: map[string]int{"a100": 2, "nvme": 1}},
+		},
+		{
+			name:       "vGPUs in resource groups",
+			extraSpecs: map[string]string{"resources:VGPU": "1", "resources1:VGPU": "2", "resources:VCPU": "4"},
+			expected:   &acceleratorRequest{vGPUs: []int{2, 1}},
+		},
+		{
+			name:       "PCI alias without count",
+			extraSpecs: map[string]string{"pci_passthrough:alias": "a100"},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid number of vGPUs",
+			extraSpecs: map[string]string{"resources:VGPU": "one"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := parseAcceleratorRequest(flavor, tt.extraSpecs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(request, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, request)
+			}
+		})
+	}
+}
+
+type fakeAcceleratorService struct {
+	resources    map[string]bool
+	discoverable bool
+}
+
+func (f *fakeAcceleratorService) HasResourceProvider(resources string) (bool, bool, error) {
+	return f.resources[resources], f.discoverable, nil
+}
+
+func TestMissingVGPUs(t *testing.T) {
+	request := &acceleratorRequest{vGPUs: []int{1, 4}}
+
+	missing, err := missingVGPUs(request, &fakeAcceleratorService{resources: map[string]bool{"VGPU:1": true}, discoverable: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []int{4}) {
+		t.Errorf("expected 4 vGPUs to be missing, got %v", missing)
+	}
+
+	// Nothing is missing if the resource providers can't be listed
+	missing, err = missingVGPUs(request, &fakeAcceleratorService{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("expected no missing vGPUs, got %v", missing)
+	}
+}
@@ -18,24 +18,24 @@ package machine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 
 	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
 	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
-	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
 	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
 	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
 
 	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
 	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
 
-	configv1 "github.com/openshift/api/config/v1"
-	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	configclient "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
@@ -54,11 +54,54 @@ type ActuatorParams struct {
 	ConfigClient  configclient.ConfigV1Interface
 	EventRecorder record.EventRecorder
 	Scheme        *runtime.Scheme
+
+	// InstanceDeleteTimeout is how long we wait for an instance whose
+	// deletion has already been requested to disappear before requesting
+	// its deletion again. Bare metal instances may take a long time to
+	// deprovision.
+	InstanceDeleteTimeout time.Duration
+
+	// PortCreateConflictRetries is how often the creation of a port is
+	// retried after Neutron reports a conflict. Retries are disabled if
+	// it is 0.
+	PortCreateConflictRetries int
+
+	// ZoneCreateFailureThreshold is how many creations of machines in an
+	// availability zone must fail within ZoneCreateFailureWindow for an
+	// outage of the zone to be suspected. Zones aren't tracked if it is 0.
+	ZoneCreateFailureThreshold int
+
+	// ZoneCreateFailureWindow is how long failed creations of machines
+	// count towards ZoneCreateFailureThreshold
+	ZoneCreateFailureWindow time.Duration
+
+	// ZoneCreateFailurePolicy is ZoneCreateFailurePolicyWarn to only
+	// report suspected outages, or ZoneCreateFailurePolicyBlock to also
+	// delay the creation of machines in the zone
+	ZoneCreateFailurePolicy string
+
+	// DisableInstanceStateAnnotation stops writing the legacy
+	// machine.openshift.io/instance-state annotation, and removes it. The
+	// state of the instance is then only reported by the InstanceReady
+	// condition.
+	DisableInstanceStateAnnotation bool
+
+	// CAPOCoexistence only adopts servers by name which are marked as owned
+	// by their machine, with the machine UID tag or server metadata, so that
+	// servers created by CAPO in the same project are never touched. The
+	// servers of the providerIDs of machines are marked if they aren't yet.
+	CAPOCoexistence bool
 }
 
 const (
 	// The prefix of ProviderID for OpenStack machines
 	providerPrefix = "openstack:///"
+
+	// The task state of a server whose deletion is in progress
+	taskStateDeleting = "deleting"
+
+	// DefaultInstanceDeleteTimeout is the default for InstanceDeleteTimeout
+	DefaultInstanceDeleteTimeout = 60 * time.Minute
 )
 
 type OpenstackClient struct {
@@ -66,16 +109,42 @@ type OpenstackClient struct {
 	scheme        *runtime.Scheme
 	client        client.Client
 	eventRecorder record.EventRecorder
+
+	// scaleOperations exports the machines created and deleted by scale
+	// operations of MachineSets
+	scaleOperations *scaleOperationMetrics
+
+	// zoneHealth tracks the failed creations of machines per
+	// availability zone
+	zoneHealth *zoneHealth
+
+	// provisioningTimings holds the timings of the instances being created
+	// until they are summarized
+	provisioningTimings *provisioningTimingsByMachine
+
+	// deletions follows the instances whose deletion is in progress
+	deletions *deletionProgress
 }
 
 func NewActuator(params ActuatorParams) (*OpenstackClient, error) {
 	capoRecorder.InitFromRecorder(params.EventRecorder)
 
+	if params.ZoneCreateFailurePolicy != "" {
+		if err := ValidateZoneCreateFailurePolicy(params.ZoneCreateFailurePolicy); err != nil {
+			return nil, err
+		}
+	}
+
 	return &OpenstackClient{
-		params:        params,
-		client:        params.Client,
-		scheme:        params.Scheme,
-		eventRecorder: params.EventRecorder,
+		params:          params,
+		client:          params.Client,
+		scheme:          params.Scheme,
+		eventRecorder:   params.EventRecorder,
+		scaleOperations: newScaleOperationMetrics(),
+		zoneHealth:      newZoneHealth(params.ZoneCreateFailureThreshold, params.ZoneCreateFailureWindow, params.ZoneCreateFailurePolicy, params.EventRecorder),
+
+		provisioningTimings: newProvisioningTimingsByMachine(),
+		deletions:           newDeletionProgress(),
 	}, nil
 }
 
@@ -87,8 +156,23 @@ func (oc *OpenstackClient) getScope(ctx context.Context, machine *machinev1.Mach
 		return nil, "", err
 	}
 	regionName := cloud.RegionName
-	scope, err := scope.NewProviderScope(cloud, clients.GetCACertificate(oc.params.KubeClient), log)
-	return scope, regionName, err
+
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// GetCloud has checked that the machine has a clouds secret
+	secret := machineCloudsSecret(machine, machineSpec)
+	shared, err := clients.SharedProviderScope(ctx, cloud, clients.GetCACertificate(oc.params.KubeClient), secret, log)
+	if err != nil {
+		return nil, "", err
+	}
+	scope := newClientPoolScope(shared)
+	if err := checkServiceCatalog(scope, regionName, machineSpec); err != nil {
+		return nil, "", err
+	}
+	return scope, regionName, nil
 }
 
 func (oc *OpenstackClient) setProviderID(ctx context.Context, machine *machinev1.Machine, instanceID string) error {
@@ -105,7 +189,12 @@ func (oc *OpenstackClient) setProviderID(ctx context.Context, machine *machinev1
 	return oc.client.Patch(ctx, machine, patch)
 }
 
-func getInstanceStatus(scope scope.Scope, machine *machinev1.Machine) (*compute.InstanceStatus, error) {
+// getInstanceStatus returns the status of the instance of the machine, or nil
+// if it has none. When coexisting with CAPO, the server of the providerID of
+// the machine must not have been created for another machine, or else
+// errForeignServer is returned, and it is marked with marker as owned by the
+// machine if it isn't yet.
+func getInstanceStatus(scope scope.Scope, machine *machinev1.Machine, coexistWithCAPO bool, marker serverMarker) (*compute.InstanceStatus, error) {
 	computeService, err := compute.NewService(scope)
 	if err != nil {
 		return nil, err
@@ -113,7 +202,7 @@ func getInstanceStatus(scope scope.Scope, machine *machinev1.Machine) (*compute.
 
 	providerID := machine.Spec.ProviderID
 	if providerID == nil {
-		return computeService.GetInstanceStatusByName(machine, machine.Name)
+		return getInstanceStatusByName(scope, machine, coexistWithCAPO)
 	}
 
 	if !strings.HasPrefix(*providerID, providerPrefix) {
@@ -121,35 +210,84 @@ func getInstanceStatus(scope scope.Scope, machine *machinev1.Machine) (*compute.
 	}
 
 	instanceID := (*providerID)[len(providerPrefix):]
+	if coexistWithCAPO {
+		return getOwnedInstanceStatus(scope, machine, instanceID, marker)
+	}
 	return computeService.GetInstanceStatus(instanceID)
 }
 
-func (oc *OpenstackClient) convertMachineToCapoInstanceSpec(scope scope.Scope, machine *machinev1.Machine) (*compute.InstanceSpec, error) {
+// convertMachineToCapoInstanceSpec returns the CAPO InstanceSpec of machine.
+// If a server group had to be created for the machine it also returns the
+// server group.
+func (oc *OpenstackClient) convertMachineToCapoInstanceSpec(ctx context.Context, scope scope.Scope, machine *machinev1.Machine) (*compute.InstanceSpec, *servergroups.ServerGroup, error) {
 	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate MachineSpec object: %v", err)
+		return nil, nil, fmt.Errorf("failed to generate MachineSpec object: %v", err)
 	}
 
-	clusterInfra, err := oc.params.ConfigClient.Infrastructures().Get(context.TODO(), "cluster", metav1.GetOptions{})
+	clusterInfra, err := oc.params.ConfigClient.Infrastructures().Get(ctx, "cluster", metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve cluster Infrastructure object: %v", err)
+		return nil, nil, fmt.Errorf("failed to retrieve cluster Infrastructure object: %v", err)
 	}
 
-	instanceService, err := clients.NewInstanceServiceFromMachine(oc.params.KubeClient, machine)
+	machineService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	userDataRendered, err := oc.getUserData(machine, machineSpec, oc.params.KubeClient)
 	if err != nil {
-		return nil, fmt.Errorf("error getting bootstrap for %s: %v", machine.Name, err)
+		return nil, nil, fmt.Errorf("error getting bootstrap for %s: %v", machine.Name, err)
 	}
 
-	var ignoreAddressPairs bool = false
-	if clusterInfra.Status.PlatformStatus.OpenStack.LoadBalancer != nil && clusterInfra.Status.PlatformStatus.OpenStack.LoadBalancer.Type == configv1.LoadBalancerTypeUserManaged {
-		// If the load balancer type is managed by the user, we don't want to create address pairs because the
-		// API & Ingress VIPs are not managed by the cluster.
-		ignoreAddressPairs = true
+	// If the load balancer type is managed by the user, we don't want to create address pairs because the
+	// API & Ingress VIPs are not managed by the cluster.
+	ignoreAddressPairs := hasUserManagedLoadBalancer(clusterInfra.Status.PlatformStatus.OpenStack)
+
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(extensions.ConfigDriveFiles) > 0 {
+		files, err := getConfigDriveFiles(ctx, machine, extensions.ConfigDriveFiles, oc.params.KubeClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		userDataRendered, err = addIgnitionFiles(userDataRendered, files)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error adding config drive files for %s: %w", machine.Name, err)
+		}
+	}
+	userDataRendered, err = addHostname(userDataRendered, machine, machineSpec, extensions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error setting the hostname of %s: %w", machine.Name, err)
+	}
+
+	// A server group created for a machine is owned by the machine, unless
+	// it is owned by the MachineSet of the machine
+	serverGroupRecorder := &serverGroupRecorder{instanceService: machineService}
+	var serverGroups instanceService = serverGroupRecorder
+	if extensions.ServerGroupScope == clients.ServerGroupScopeMachineSet {
+		machineSet, err := oc.getMachineSet(ctx, machine)
+		if err != nil {
+			return nil, nil, err
+		}
+		if machineSet != nil {
+			serverGroups = &machineSetServerGroups{
+				oc:             oc,
+				ctx:            ctx,
+				machine:        machine,
+				machineSet:     machineSet,
+				machineService: machineService,
+			}
+		}
+	} else if serverGroupID := machine.Annotations[InheritedServerGroupAnnotationKey]; serverGroupID != "" {
+		serverGroups = &inheritedServerGroups{
+			instanceService: serverGroupRecorder,
+			serverGroupID:   serverGroupID,
+			machineService:  machineService,
+		}
 	}
 
 	// Convert to CAPO InstanceSpec
@@ -157,14 +295,42 @@ func (oc *OpenstackClient) convertMachineToCapoInstanceSpec(scope scope.Scope, m
 		machine,
 		clusterInfra.Status.PlatformStatus.OpenStack.APIServerInternalIPs,
 		clusterInfra.Status.PlatformStatus.OpenStack.IngressIPs,
-		userDataRendered, instanceService,
+		userDataRendered, serverGroups,
 		ignoreAddressPairs,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if err := oc.setRootVolumeZone(machine, instanceSpec); err != nil {
+		return nil, nil, err
+	}
+
+	if secret := extensions.SSHPublicKeySecret; secret != nil {
+		publicKey, err := getSSHPublicKey(ctx, machine, secret, oc.params.KubeClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		instanceSpec.SSHKeyName, err = ensureKeyPair(machine, publicKey, machineService)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return instanceSpec, nil
+	// Resolve the image here so that CAPO uses the same image if more than
+	// one has the name, and so that the image may be given by ID.
+	if instanceSpec.Image != "" && instanceSpec.ImageUUID == "" {
+		imageID, count, err := machineService.GetImageID(instanceSpec.Image, extensions.ImageSelection)
+		if err != nil {
+			return nil, nil, err
+		}
+		if count > 1 {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "SelectedImage", "Selected image %s of %d images named %s", imageID, count, instanceSpec.Image)
+		}
+		instanceSpec.ImageUUID = imageID
+	}
+
+	return instanceSpec, serverGroupRecorder.created, nil
 }
 
 func (oc *OpenstackClient) Create(ctx context.Context, machine *machinev1.Machine) error {
@@ -176,20 +342,29 @@ func (oc *OpenstackClient) Update(ctx context.Context, machine *machinev1.Machin
 }
 
 func (oc *OpenstackClient) reconcile(ctx context.Context, machine *machinev1.Machine) error {
+	if err := oc.checkPaused(machine, "reconciling"); err != nil {
+		return err
+	}
+
 	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
 		return maoMachine.InvalidMachineConfiguration("Cannot unmarshal providerSpec for %s: %v", machine.Name, err)
 	}
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return maoMachine.InvalidMachineConfiguration("Cannot unmarshal providerSpec for %s: %v", machine.Name, err)
+	}
 
 	scope, regionName, err := oc.getScope(ctx, machine)
 	if err != nil {
 		return err
 	}
 
-	instanceStatus, err := getInstanceStatus(scope, machine)
+	instanceStatus, err := getInstanceStatus(scope, machine, oc.params.CAPOCoexistence, oc.serverMarker(ctx))
 	if err != nil {
 		return err
 	}
+	provisioning := getProvisioningProgress(machine)
 
 	// MAO shouldn't have called reconcile if the ProviderID is already set.
 	// We check here anyway just in case because we definitely don't want to
@@ -197,10 +372,17 @@ func (oc *OpenstackClient) reconcile(ctx context.Context, machine *machinev1.Mac
 	// below and MAO will mark the machine failed on the next reconcile when
 	// Exists() returns false.
 	if instanceStatus == nil && machine.Spec.ProviderID == nil {
+		if err := oc.recordScaleOperation(ctx, machine); err != nil {
+			return fmt.Errorf("error recording scale operation of %q: %w", machine.Name, err)
+		}
+		if err := oc.inheritPlacement(ctx, machine, machineSpec, extensions); err != nil {
+			return fmt.Errorf("error inheriting placement of %q: %w", machine.Name, err)
+		}
 		instanceStatus, err = oc.createInstance(ctx, machine, scope)
 		if err != nil {
 			return err
 		}
+		oc.recordMachineCreated(machine)
 	}
 
 	if instanceStatus == nil {
@@ -212,111 +394,334 @@ func (oc *OpenstackClient) reconcile(ctx context.Context, machine *machinev1.Mac
 		return fmt.Errorf("error setting provider ID for %q: %w", machine.Name, err)
 	}
 
-	if err := reconcileFloatingIP(machine, machineSpec, instanceStatus, scope); err != nil {
+	err = reconcileFloatingIPs(machine, machineSpec, extensions, instanceStatus, scope)
+	if err := oc.setFloatingIPsAllocatedCondition(ctx, machine, err); err != nil {
 		return err
 	}
 
+	if err := reconcileLoadBalancerMembers(machine, machineSpec, extensions, instanceStatus, scope); err != nil {
+		return err
+	}
+
+	if qosPolicies := portQoSPolicies(machineSpec, extensions); qosPolicies != nil {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := reconcilePortQoSPolicies(machine, machineSpec, qosPolicies, instanceStatus.ID(), instanceService); err != nil {
+			return err
+		}
+	}
+
+	if hasBlockDeviceMetadata(extensions) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := reconcileBlockDeviceMetadata(machine, machineSpec, extensions, instanceService); err != nil {
+			return err
+		}
+	}
+
+	if len(extensions.MultiattachVolumes) > 0 {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := reconcileMultiattachVolumes(machine, extensions.MultiattachVolumes, instanceStatus, instanceService); err != nil {
+			return err
+		}
+	}
+
+	if hasServerIdentity(extensions) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := reconcileServerIdentity(machine, machineSpec, extensions, instanceStatus, instanceService); err != nil {
+			return err
+		}
+	}
+
+	// Disruptive actions wait for the maintenance window, while the rest of
+	// the machine is reconciled as usual
+	disruptionDeferral, err := oc.checkMaintenanceWindow(ctx, machine)
+	if err != nil {
+		return err
+	}
+	_, rebootPending := machine.Annotations[RootVolumeRebootPendingAnnotationKey]
+	_, rebuildRequested := machine.Annotations[RebuildAnnotationKey]
+
+	if needsRootVolumeResize(machine, machineSpec) && !(rebootPending && disruptionDeferral > 0) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := oc.reconcileRootVolumeSize(ctx, machine, machineSpec, instanceStatus, instanceService); err != nil {
+			return err
+		}
+	}
+
+	if hasRebuildAnnotations(machine) && !(rebuildRequested && disruptionDeferral > 0) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := oc.reconcileRebuild(ctx, machine, machineSpec, extensions, instanceStatus, instanceService); err != nil {
+			return err
+		}
+	}
+
 	// Apply labels and annotations and patch the machine object
 	patch := client.MergeFrom(machine.DeepCopy())
 	setMachineLabels(machine, regionName, instanceStatus.AvailabilityZone(), machineSpec.Flavor)
-	setMachineAnnotations(machine, instanceStatus)
+	setMachineAnnotations(machine, instanceStatus, oc.params.DisableInstanceStateAnnotation)
+	if err := setFlavorLabels(machine, extensions.FlavorExtraSpecLabels, instanceStatus, scope); err != nil {
+		return err
+	}
 	if err := oc.client.Patch(ctx, machine, patch); err != nil {
 		return err
 	}
 
 	// Update machine status and patch the machine status object
+	hostname, err := machineHostname(machine, machineSpec, extensions)
+	if err != nil {
+		return err
+	}
 	patch = client.MergeFrom(machine.DeepCopy())
-	if err := setMachineStatus(machine, instanceStatus); err != nil {
+	previousAddresses := machine.Status.Addresses
+	if err := setMachineStatus(machine, instanceStatus, hostname); err != nil {
 		return err
 	}
+	// Ports are still being attached while the instance is building
+	if instanceStatus.State() == capov1.InstanceStateActive {
+		networkClient, err := scope.NewNetworkClient()
+		if err != nil {
+			return err
+		}
+		if err := refreshStaleAddresses(machine, previousAddresses, instanceStatus.ID(), networkClient, oc.eventRecorder); err != nil {
+			return err
+		}
+	}
+	setInstanceReadyCondition(machine, instanceStatus.ID(), string(instanceStatus.State()))
+	setInstanceActiveCondition(machine, instanceStatus)
 	if err := oc.client.Status().Patch(ctx, machine, patch); err != nil {
 		return err
 	}
+	recordProvisioningMilestones(machine, provisioning, instanceStatus.AvailabilityZone())
+	if provisioning.instanceBecameActive(machine) {
+		oc.recordProvisioningSummary(ctx, machine, instanceStatus.ID())
+	}
+
+	if err := oc.reconcileInactiveInstance(ctx, machine, extensions.InactiveInstancePolicy, instanceStatus); err != nil {
+		return err
+	}
+
+	if disruptionDeferral > 0 {
+		return &maoMachine.RequeueAfterError{RequeueAfter: disruptionDeferral}
+	}
 
 	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Reconciled", "Reconciled machine %v", machine.Name)
 	return nil
 }
 
 func (oc *OpenstackClient) createInstance(ctx context.Context, machine *machinev1.Machine, scope scope.Scope) (*compute.InstanceStatus, error) {
-	if err := oc.validateMachine(machine); err != nil {
+	started := time.Now()
+	timings := oc.provisioningTimings.start(machine)
+
+	if err := oc.validateMachine(ctx, machine); err != nil {
+		if errors.Is(err, errValidationTimeout) {
+			return nil, err
+		}
 		return nil, maoMachine.InvalidMachineConfiguration("Machine validation failed: %v", err)
 	}
 
-	instanceSpec, err := oc.convertMachineToCapoInstanceSpec(scope, machine)
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, err
 	}
 
-	computeService, err := compute.NewService(scope)
+	zone := newZoneKey(machine, machineSpec)
+	if err := oc.checkZoneHealth(machine, zone); err != nil {
+		return nil, err
+	}
+
+	quotaService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
 	if err != nil {
 		return nil, err
 	}
+	if err := oc.checkComputeQuota(machine, machineSpec.Flavor, quotaService); err != nil {
+		return nil, err
+	}
 
-	var osCluster capov1.OpenStackCluster
-	clusterNameWithNamespace := utils.GetClusterNameWithNamespace(machine)
-	instanceStatus, err := computeService.CreateInstance(machine, &osCluster, instanceSpec, clusterNameWithNamespace)
+	instanceSpec, createdServerGroup, err := oc.convertMachineToCapoInstanceSpec(ctx, scope, machine)
 	if err != nil {
-		return nil, maoMachine.CreateMachine("error creating Openstack instance: %v", err)
+		return nil, err
 	}
-	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Created", "Created OpenStack instance %s", instanceStatus.ID())
-	return instanceStatus, nil
-}
 
-func reconcileFloatingIP(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, instanceStatus *compute.InstanceStatus, scope scope.Scope) error {
-	if machineSpec.FloatingIP == "" {
-		return nil
+	if createdServerGroup != nil {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "CreatedServerGroup", "Created server group %s with id %s", createdServerGroup.Name, createdServerGroup.ID)
+		if err := oc.setServerGroupOwner(ctx, machine, createdServerGroup.ID); err != nil {
+			return nil, fmt.Errorf("error setting owner of server group %s: %w", createdServerGroup.ID, err)
+		}
 	}
 
-	networkStatus, err := instanceStatus.NetworkStatus()
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Look for the floating IP on the server
-	for _, address := range networkStatus.Addresses() {
-		if address.Type == corev1.NodeExternalIP && address.Address == machineSpec.FloatingIP {
-			return nil
+	floatingIPs := allocatedFloatingIPs(floatingIPRequests(machineSpec, extensions))
+	oc.checkNetworkQuota(machine, scope.ProjectID(), len(instanceSpec.Ports), floatingIPs, quotaService)
+
+	if hasNetworkSegments(extensions) {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return nil, err
+		}
+		if err := selectSegmentSubnets(machineSpec, extensions, instanceSpec.FailureDomain, instanceSpec.Ports, instanceService); err != nil {
+			return nil, err
 		}
 	}
 
-	networkService, err := networking.NewService(scope)
-	if err != nil {
-		return err
+	if err := setPrimaryFixedIP(scope, instanceSpec.Ports, extensions.FixedIP); err != nil {
+		return nil, err
 	}
-	var osCluster capov1.OpenStackCluster
-	fp, err := networkService.GetOrCreateFloatingIP(machine, &osCluster, utils.GetClusterNameWithNamespace(machine), machineSpec.FloatingIP)
+
+	poolClaims, err := oc.ensureAddressClaims(ctx, machine, extensions.AddressesFromPools)
 	if err != nil {
-		return fmt.Errorf("get floatingIP err: %v", err)
+		return nil, err
 	}
-	computeService, err := compute.NewService(scope)
-	if err != nil {
-		return err
+	addressClaims := append(slices.Clone(extensions.AddressClaims), poolClaims...)
+
+	if err := oc.resolveAddressClaims(ctx, machine, addressClaims, instanceSpec); err != nil {
+		return nil, err
 	}
-	// XXX(mdbooth): Network isn't set on osCluster, so this won't work
-	port, err := computeService.GetManagementPort(&osCluster, instanceStatus)
+
+	instanceScope, err := newInstanceScope(scope, extensions)
 	if err != nil {
-		return fmt.Errorf("get management port err: %v", err)
+		return nil, maoMachine.InvalidMachineConfiguration("Machine validation failed: %v", err)
+	}
+	instanceScope.setPortBindingProfiles(machine.Name, instanceSpec.Ports, portBindingProfiles(machineSpec, extensions))
+	instanceScope.setPortsWithoutSecurityGroups(machine.Name, instanceSpec.Ports, portsWithoutSecurityGroups(machineSpec, extensions))
+	instanceScope.portConflictRetries = oc.params.PortCreateConflictRetries
+
+	if qosPolicies := portQoSPolicies(machineSpec, extensions); qosPolicies != nil {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return nil, err
+		}
+		qosPolicyIDs, err := portQoSPolicyIDs(qosPolicies, instanceService)
+		if err != nil {
+			return nil, err
+		}
+		instanceScope.setPortQoSPolicies(machine.Name, instanceSpec.Ports, qosPolicyIDs)
+	}
+	instanceScope.timings = timings
+
+	if extensions.FlavorDisks != nil {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return nil, err
+		}
+		flavor, _, err := getFlavor(machineSpec.Flavor, instanceService)
+		if err != nil {
+			return nil, err
+		}
+		instanceScope.blockDevices = flavorDiskBlockDevices(extensions.FlavorDisks, flavor)
 	}
 
-	err = networkService.AssociateFloatingIP(&osCluster, fp, port.ID)
+	// Another machine with the same name may have created its server
+	// since we last looked for ours
+	if err := checkServerNameCollision(scope, machine, oc.params.CAPOCoexistence); err != nil {
+		return nil, err
+	}
+	if err := oc.checkDNSNameCollision(ctx, machine, scope, machineSpec, extensions, instanceSpec.Ports); err != nil {
+		return nil, err
+	}
+
+	computeService, err := compute.NewService(instanceScope)
 	if err != nil {
-		return fmt.Errorf("associate floatingIP err: %v", err)
+		return nil, err
 	}
 
-	return &maoMachine.RequeueAfterError{RequeueAfter: 5 * time.Second}
+	var osCluster capov1.OpenStackCluster
+	clusterNameWithNamespace := utils.GetClusterNameWithNamespace(machine)
+	timings.setValidation(time.Since(started))
+	instanceStatus, err := computeService.CreateInstance(machine, &osCluster, instanceSpec, clusterNameWithNamespace)
+	if err != nil {
+		// The server may have been created before the failure
+		failedInstance, lookupErr := getInstanceStatusByName(scope, machine, oc.params.CAPOCoexistence)
+		if failedInstance != nil {
+			oc.recordServerActions(ctx, machine, failedInstance.ID())
+		}
+		oc.recordAcceleratorFailure(ctx, machine, machineSpec.Flavor)
+		if err := deleteOrphanedPorts(machine, scope, instanceSpec.Ports); err != nil {
+			klog.Errorf("Machine %s: failed to delete orphaned ports: %v", machine.Name, err)
+		}
+		// Volumes of a server which was created are deleted with it
+		if lookupErr == nil && failedInstance == nil {
+			if err := oc.cleanupOrphanedVolumes(ctx, machine, machineSpec, extensions); err != nil {
+				klog.Errorf("Machine %s: failed to delete orphaned volumes: %v", machine.Name, err)
+			}
+		}
+		// Retrying can't fix e.g. an exceeded quota, so the machine fails
+		// instead of being requeued
+		if reason := terminalCreateError(instanceScope.lastError); reason != "" {
+			return nil, maoMachine.InvalidMachineConfiguration("error creating Openstack instance: %s: %v", reason, err)
+		}
+		oc.zoneHealth.recordFailure(zone)
+		return nil, maoMachine.CreateMachine("error creating Openstack instance: %v", err)
+	}
+	oc.zoneHealth.recordSuccess(zone)
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Created", "Created OpenStack instance %s", instanceStatus.ID())
+	return instanceStatus, nil
 }
 
 func (oc *OpenstackClient) Delete(ctx context.Context, machine *machinev1.Machine) error {
+	if err := oc.checkPaused(machine, "deleting"); err != nil {
+		return err
+	}
+
+	// The instance of the machine won't be summarized once provisioned,
+	// even if this fails
+	oc.provisioningTimings.pop(machine)
+
 	osc, _, err := oc.getScope(ctx, machine)
 	if err != nil {
+		withoutCredentials, err := oc.deleteWithoutCredentials(ctx, machine, err)
+		if withoutCredentials {
+			oc.recordDeletedWithoutCredentials(machine)
+			oc.recordMachineDeleted(ctx, machine)
+		}
 		return err
 	}
 
-	instanceStatus, err := getInstanceStatus(osc, machine)
+	instanceStatus, err := getInstanceStatus(osc, machine, oc.params.CAPOCoexistence, oc.serverMarker(ctx))
+	if errors.Is(err, errForeignServer) {
+		// The server and its resources are left to whoever manages them,
+		// and the machine keeps its finalizer until its providerID is
+		// fixed, so that its own server is never leaked
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "SkippedForeignServer", "Not deleting OpenStack server of %s: %v", machine.Name, err)
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error getting instance status for %q: %w", machine.Name, err)
 	}
 
+	if instanceStatus != nil {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := oc.checkDeletionInProgress(machine, instanceStatus, instanceService); err != nil {
+			return err
+		}
+		if err := oc.checkInstanceLocked(ctx, machine, instanceStatus, instanceService); err != nil {
+			return err
+		}
+	}
+
 	computeService, err := compute.NewService(osc)
 	if err != nil {
 		return err
@@ -326,25 +731,146 @@ func (oc *OpenstackClient) Delete(ctx context.Context, machine *machinev1.Machin
 	if err != nil {
 		return err
 	}
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return err
+	}
+
+	// Nova deletes the volumes of the instance with it, so the retained
+	// ones are detached first
+	if err := oc.reconcileRetainedVolumes(ctx, machine, machineSpec, extensions, instanceStatus); err != nil {
+		return err
+	}
+
+	// Ports are required when deleting a server in the ERROR state: OCPBUGS-33806
+	// We only need a list of port names, so apiVIPs and ingressVIPs are unnecessary
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+
+	var instanceID string
+	if instanceStatus != nil {
+		instanceID = instanceStatus.ID()
+		if instanceStatus.State() == capov1.InstanceStateError {
+			if err := releaseErrorInstancePorts(machine, osc, portOpts, instanceID); err != nil {
+				return fmt.Errorf("error releasing ports of %q: %w", machine.Name, err)
+			}
+		}
+	}
+	if err := releaseFloatingIPs(machine, machineSpec, extensions, instanceID, osc); err != nil {
+		return err
+	}
+
+	// Stop sending traffic to the machine before deleting its instance
+	if err := deleteLoadBalancerMembers(machine, extensions, osc); err != nil {
+		return err
+	}
+
 	// Create a minimal instancespec since we don't want to reparse and reconstruct all the networking info just to delete
 	instanceSpec := compute.InstanceSpec{
-		Name: machine.Name,
-		// Ports are required when deleting a server in the ERROR state: OCPBUGS-33806
-		// We only need a list of port names, so apiVIPs and ingressVIPs are unnecessary
-		Ports:      createCAPOPorts(machineSpec, nil, nil, true),
+		Name:       machine.Name,
+		Ports:      portOpts,
 		RootVolume: extractRootVolumeFromProviderSpec(machineSpec),
 	}
 
 	var osCluster capov1.OpenStackCluster
 	err = computeService.DeleteInstance(&osCluster, machine, instanceStatus, &instanceSpec)
 	if err != nil {
+		if instanceStatus != nil {
+			oc.recordServerActions(ctx, machine, instanceStatus.ID())
+		}
 		return err
 	}
 
+	// If there is no instance, ports and volumes created by a failed attempt
+	// to create it may remain
+	if instanceStatus == nil {
+		if err := deleteOrphanedPorts(machine, osc, instanceSpec.Ports); err != nil {
+			return fmt.Errorf("error deleting orphaned ports of %q: %w", machine.Name, err)
+		}
+		if err := oc.cleanupOrphanedVolumes(ctx, machine, machineSpec, extensions); err != nil {
+			return fmt.Errorf("error deleting orphaned volumes of %q: %w", machine.Name, err)
+		}
+	}
+
+	// DeleteInstance waits for the instance to be gone, so it is no longer
+	// a member of its server group.
+	if _, ok := machine.Annotations[ServerGroupOwnerAnnotationKey]; ok {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := oc.releaseServerGroup(ctx, machine, instanceService); err != nil {
+			return err
+		}
+	}
+	if _, ok := machine.Annotations[MachineSetServerGroupAnnotationKey]; ok {
+		instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+		if err != nil {
+			return err
+		}
+		if err := oc.releaseMachineSetServerGroup(ctx, machine, instanceService); err != nil {
+			return err
+		}
+	}
+
+	oc.deletions.forget(machine)
+	oc.recordMachineDeleted(ctx, machine)
 	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleted", "Deleted machine %v", machine.Name)
 	return nil
 }
 
+// checkDeletionInProgress returns an error if deletion of the instance has
+// already been requested and is still in progress. Instead of requesting
+// deletion again we report progress, at most every deletionEventInterval, and
+// requeue until the instance is gone. Once InstanceDeleteTimeout has elapsed
+// since the machine was deleted, the deletion is requested again, once, by
+// returning nil; after that we keep waiting for the instance to be gone.
+func (oc *OpenstackClient) checkDeletionInProgress(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus, instanceService deletionStatusService) error {
+	taskState, err := instanceService.GetServerTaskState(instanceStatus.ID())
+	if err != nil {
+		return fmt.Errorf("error getting task state of instance %s: %w", instanceStatus.ID(), err)
+	}
+	if taskState != taskStateDeleting {
+		return nil
+	}
+
+	// The provision state is informational only, so we don't fail if we
+	// can't get it.
+	provisionState, err := instanceService.GetBaremetalProvisionState(instanceStatus.ID())
+	if err != nil {
+		klog.V(3).Infof("Machine %s: unable to get bare metal provision state: %v", machine.Name, err)
+	}
+
+	var elapsed time.Duration
+	if machine.DeletionTimestamp != nil {
+		elapsed = time.Since(machine.DeletionTimestamp.Time).Round(time.Second)
+	}
+
+	timeout := oc.params.InstanceDeleteTimeout
+	if timeout == 0 {
+		timeout = DefaultInstanceDeleteTimeout
+	}
+	if elapsed > timeout {
+		if oc.deletions.reissue(machine) {
+			klog.Warningf("Machine %s: instance %s is still being deleted after %s, requesting its deletion again", machine.Name, instanceStatus.ID(), elapsed)
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "DeleteTimeout", "Instance %s is still being deleted after %s, requesting its deletion again", instanceStatus.ID(), elapsed)
+			return nil
+		}
+		if oc.deletions.reportEvent(machine) {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "DeleteTimeout", "Instance %s is still being deleted after %s, although its deletion was requested again", instanceStatus.ID(), elapsed)
+		}
+		return &maoMachine.RequeueAfterError{RequeueAfter: deletionRequeueAfter}
+	}
+
+	if oc.deletions.reportEvent(machine) {
+		if provisionState != "" {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleting", "Waiting for deletion of instance %s for %s, bare metal provision state is %q", instanceStatus.ID(), elapsed, provisionState)
+		} else {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleting", "Waiting for deletion of instance %s for %s", instanceStatus.ID(), elapsed)
+		}
+	}
+	return &maoMachine.RequeueAfterError{RequeueAfter: deletionRequeueAfter}
+}
+
 func setMachineLabels(machine *machinev1.Machine, region, availability_zone, flavor string) {
 	// Don't update labels which have already been set
 	if machine.Labels[maoMachine.MachineRegionLabelName] != "" && machine.Labels[maoMachine.MachineAZLabelName] != "" && machine.Labels[maoMachine.MachineInstanceTypeLabelName] != "" {
@@ -365,9 +891,8 @@ func setMachineLabels(machine *machinev1.Machine, region, availability_zone, fla
 	machine.Labels[maoMachine.MachineInstanceTypeLabelName] = flavor
 }
 
-func setMachineAnnotations(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus) {
+func setMachineAnnotations(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus, disableInstanceStateAnnotation bool) {
 	const InstanceStatusAnnotationKey = "instance-status"
-	const OpenstackIdAnnotationKey = "openstack-resourceId"
 
 	// Former annotation
 	// machine.ObjectMeta.Annotations[openstack.OpenstackIPAnnotationKey] = primaryIP
@@ -383,11 +908,14 @@ func setMachineAnnotations(machine *machinev1.Machine, instanceStatus *compute.I
 		delete(machine.Annotations, InstanceStatusAnnotationKey)
 	}
 
-	machine.Annotations[OpenstackIdAnnotationKey] = instanceStatus.ID()
-	machine.Annotations[maoMachine.MachineInstanceStateAnnotationName] = string(instanceStatus.State())
+	machine.Annotations[openstackIDAnnotationKey] = instanceStatus.ID()
+	setInstanceStateAnnotation(machine, string(instanceStatus.State()), disableInstanceStateAnnotation)
 }
 
-func setMachineStatus(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus) error {
+// setMachineStatus sets the addresses of the machine to those of its
+// instance, and its hostname, which the node link controller uses to find
+// the node of the machine.
+func setMachineStatus(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus, hostname string) error {
 	networkStatus, err := instanceStatus.NetworkStatus()
 	if err != nil {
 		return err
@@ -395,11 +923,11 @@ func setMachineStatus(machine *machinev1.Machine, instanceStatus *compute.Instan
 	networkAddresses := networkStatus.Addresses()
 	networkAddresses = append(networkAddresses, corev1.NodeAddress{
 		Type:    corev1.NodeHostName,
-		Address: machine.Name,
+		Address: hostname,
 	})
 	networkAddresses = append(networkAddresses, corev1.NodeAddress{
 		Type:    corev1.NodeInternalDNS,
-		Address: machine.Name,
+		Address: hostname,
 	})
 	machine.Status.Addresses = networkAddresses
 
@@ -409,72 +937,163 @@ func setMachineStatus(machine *machinev1.Machine, instanceStatus *compute.Instan
 func (oc *OpenstackClient) Exists(ctx context.Context, machine *machinev1.Machine) (bool, error) {
 	osc, _, err := oc.getScope(ctx, machine)
 	if err != nil {
+		// The instance of a machine deleted without credentials is
+		// reported as gone, so that the machine's finalizer is removed
+		_, err := oc.deleteWithoutCredentials(ctx, machine, err)
 		return false, err
 	}
 
-	instanceStatus, err := getInstanceStatus(osc, machine)
+	instanceStatus, err := getInstanceStatus(osc, machine, oc.params.CAPOCoexistence, oc.serverMarker(ctx))
 	if err != nil {
 		return false, err
 	}
 	return instanceStatus != nil, nil
 }
 
-func (oc *OpenstackClient) validateMachine(machine *machinev1.Machine) error {
+func (oc *OpenstackClient) validateMachine(ctx context.Context, machine *machinev1.Machine) error {
 	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
 		return fmt.Errorf("\nError getting the machine spec from the provider spec: %v", err)
 	}
 
-	machineService, err := clients.NewInstanceServiceFromMachine(oc.params.KubeClient, machine)
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("\nError getting the machine spec extensions from the provider spec: %v", err)
+	}
+
+	machineService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
 	if err != nil {
 		return fmt.Errorf("\nError getting a new instance service from the machine: %v", err)
 	}
 
 	// TODO(mfedosin): add more validations here
 
-	// Validate that image exists when not booting from volume
-	if machineSpec.RootVolume == nil {
-		err = machineService.DoesImageExist(machineSpec.Image)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Validate that flavor exists
-	err = machineService.DoesFlavorExist(machineSpec.Flavor)
-	if err != nil {
-		return err
+	if err := validateProviderSpec(machine, machineSpec, extensions); err != nil {
+		return fmt.Errorf("\n%v", err)
 	}
 
-	// Validate that Availability Zone exists
-	err = machineService.DoesAvailabilityZoneExist(machineSpec.AvailabilityZone)
-	if err != nil {
-		return err
-	}
+	availabilityZone := machineAvailabilityZone(machine, machineSpec)
+	serverGroupID := coalesce(machineSpec.ServerGroupID, extractServerGroupHint(extensions))
+
+	// Each of the checks against the cloud is a round trip or more, so
+	// they run concurrently, each with its own instance service
+	return runValidationChecks(ctx, validationTimeout,
+		// Validate that the image, or the source image of the root volume, exists
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if image := extractImageFromProviderSpec(machineSpec); machineSpec.RootVolume == nil || image != "" {
+				return machineService.DoesImageExist(image, extensions.ImageSelection)
+			}
+			return nil
+		},
+
+		// Validate that flavor exists, and that the NUMA topology, PCI
+		// devices and vGPUs requested by the flavor can be scheduled
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if err := machineService.DoesFlavorExist(machineSpec.Flavor); err != nil {
+				return err
+			}
+			flavor, extraSpecs, err := getFlavor(machineSpec.Flavor, machineService)
+			if err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			if err := validateFlavorNUMATopology(flavor, extraSpecs); err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			if err := validateFlavorDisks(machineSpec, extensions.FlavorDisks, flavor); err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			accelerators, err := parseAcceleratorRequest(flavor, extraSpecs)
+			if err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			oc.checkAcceleratorCapacity(machine, flavor, accelerators, machineService)
+			return nil
+		},
+
+		// Validate that Availability Zone exists
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			return machineService.DoesAvailabilityZoneExist(availabilityZone)
+		},
+
+		// Validate that the volume types of the root volume and of the
+		// additional block devices exist
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if err := validateVolumeTypes(machineSpec, machineService); err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			return nil
+		},
 
-	// Check that server group exists or values aren't inconsistent
-	if machineSpec.ServerGroupID != "" && machineSpec.ServerGroupName != "" {
-		serverGroup, err := machineService.GetServerGroupByID(machineSpec.ServerGroupID)
-		if err != nil {
-			return fmt.Errorf("\nError when looking up server group with ID %s: %v", machineSpec.ServerGroupID, err)
-		}
-		if serverGroup.Name != machineSpec.ServerGroupName {
-			return fmt.Errorf("\nName of a %s server group does not match defined name %s", machineSpec.ServerGroupID, machineSpec.ServerGroupName)
-		}
-	} else if machineSpec.ServerGroupID != "" {
-		_, err := machineService.GetServerGroupByID(machineSpec.ServerGroupID)
-		if err != nil {
-			return fmt.Errorf("\nError when looking up server group with ID %s: %v", machineSpec.ServerGroupID, err)
-		}
-	} else if machineSpec.ServerGroupName != "" {
-		serverGroups, err := machineService.GetServerGroupsByName(machineSpec.ServerGroupName)
-		if err != nil {
-			return err
-		}
-		if len(serverGroups) > 1 {
-			return fmt.Errorf("\n%d server groups named %s exist", len(serverGroups), machineSpec.ServerGroupName)
-		}
-	}
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if err := validatePortQoSPolicies(portQoSPolicies(machineSpec, extensions), machineService); err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			return nil
+		},
+
+		// Features which the cloud doesn't support would fail later, or
+		// worse, be silently ignored
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			features := clients.MachineFeatures(machineSpec, extensions)
+			if len(features) == 0 {
+				return nil
+			}
+			capabilities, err := machineService.GetCapabilities()
+			if err != nil {
+				return err
+			}
+			for _, feature := range features {
+				if reason := capabilities.Unsupported(feature); reason != "" {
+					return fmt.Errorf("\n%s", reason)
+				}
+			}
+			return nil
+		},
 
-	return nil
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if err := validateMultiattachVolumes(extensions.MultiattachVolumes, machineService); err != nil {
+				return fmt.Errorf("\n%v", err)
+			}
+			return nil
+		},
+
+		// Check that server group exists or values aren't inconsistent
+		func(ctx context.Context) error {
+			machineService := machineService.WithContext(ctx)
+			if serverGroupID != "" && machineSpec.ServerGroupName != "" {
+				serverGroup, err := machineService.GetServerGroupByID(serverGroupID)
+				if err != nil {
+					return fmt.Errorf("\nError when looking up server group with ID %s: %v", serverGroupID, err)
+				}
+				if serverGroup.Name != machineSpec.ServerGroupName {
+					return fmt.Errorf("\nName of a %s server group does not match defined name %s", serverGroupID, machineSpec.ServerGroupName)
+				}
+			} else if serverGroupID != "" {
+				_, err := machineService.GetServerGroupByID(serverGroupID)
+				if err != nil {
+					return fmt.Errorf("\nError when looking up server group with ID %s: %v", serverGroupID, err)
+				}
+			} else if machineSpec.ServerGroupName != "" {
+				serverGroups, err := machineService.GetServerGroupsByName(machineSpec.ServerGroupName)
+				if err != nil {
+					return err
+				}
+				if len(serverGroups) > 1 {
+					return fmt.Errorf("\n%d server groups named %s exist", len(serverGroups), machineSpec.ServerGroupName)
+				}
+				// The policy of an existing server group can't be changed
+				if len(serverGroups) == 1 && extensions.ServerGroupPolicy != "" && !slices.Contains(serverGroups[0].Policies, extensions.ServerGroupPolicy) {
+					return fmt.Errorf("\nServer group %s exists with policies %v, not %s", machineSpec.ServerGroupName, serverGroups[0].Policies, extensions.ServerGroupPolicy)
+				}
+			}
+			return nil
+		},
+	)
 }
@@ -0,0 +1,85 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// portLister is the part of the network client used to verify the addresses
+// of machines.
+type portLister interface {
+	ListPort(opts ports.ListOptsBuilder) ([]ports.Port, error)
+}
+
+// refreshStaleAddresses replaces the internal IP addresses in the status of
+// the machine with the fixed IPs of the ports of its instance if they differ.
+// Nova reports the addresses of a server from its network info cache, which
+// isn't refreshed when the fixed IPs of a port are changed in Neutron, so
+// the machine would otherwise keep the addresses it was created with.
+//
+// Since the addresses reported by Nova replace the status on every reconcile,
+// the stale addresses are replaced every time too. They are only logged and
+// reported in an event when the replacement changes the previous addresses
+// of the machine, i.e. once per change of the fixed IPs.
+func refreshStaleAddresses(machine *machinev1.Machine, previous []corev1.NodeAddress, instanceID string, networkClient portLister, recorder record.EventRecorder) error {
+	instancePorts, err := networkClient.ListPort(ports.ListOpts{DeviceID: instanceID})
+	if err != nil {
+		return fmt.Errorf("list ports of instance err: %v", err)
+	}
+
+	fixedIPs := sets.New[string]()
+	for _, port := range instancePorts {
+		for _, fixedIP := range port.FixedIPs {
+			fixedIPs.Insert(fixedIP.IPAddress)
+		}
+	}
+	// Don't remove all the addresses of an instance whose ports can't be
+	// seen, e.g. because they are owned by another project
+	if fixedIPs.Len() == 0 {
+		return nil
+	}
+
+	var addresses []corev1.NodeAddress
+	var stale []string
+	reported := sets.New[string]()
+	// New addresses are inserted after the IP addresses, before the hostname
+	insertAt := 0
+	for _, address := range machine.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			if !fixedIPs.Has(address.Address) {
+				stale = append(stale, address.Address)
+				continue
+			}
+			reported.Insert(address.Address)
+		}
+		addresses = append(addresses, address)
+		if address.Type == corev1.NodeInternalIP || address.Type == corev1.NodeExternalIP {
+			insertAt = len(addresses)
+		}
+	}
+	missing := sets.List(fixedIPs.Difference(reported))
+	if len(stale) == 0 && len(missing) == 0 {
+		return nil
+	}
+
+	var missingAddresses []corev1.NodeAddress
+	for _, ip := range missing {
+		missingAddresses = append(missingAddresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: ip})
+	}
+	machine.Status.Addresses = append(addresses[:insertAt:insertAt], append(missingAddresses, addresses[insertAt:]...)...)
+	if equality.Semantic.DeepEqual(machine.Status.Addresses, previous) {
+		return nil
+	}
+
+	klog.Infof("Machine %s: Replaced stale addresses [%s] with fixed IPs [%s] of the ports of instance %s", machine.Name, strings.Join(stale, ", "), strings.Join(missing, ", "), instanceID)
+	recorder.Eventf(machine, corev1.EventTypeNormal, "RefreshedStaleAddresses", "Replaced stale addresses [%s] with fixed IPs [%s] of the ports of instance %s", strings.Join(stale, ", "), strings.Join(missing, ", "), instanceID)
+	return nil
+}
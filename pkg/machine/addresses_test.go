@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakePortLister struct {
+	ports []ports.Port
+}
+
+func (f *fakePortLister) ListPort(ports.ListOptsBuilder) ([]ports.Port, error) {
+	return f.ports, nil
+}
+
+func TestRefreshStaleAddresses(t *testing.T) {
+	hostname := []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: "worker-0"},
+		{Type: corev1.NodeInternalDNS, Address: "worker-0"},
+	}
+	withHostname := func(addresses ...corev1.NodeAddress) []corev1.NodeAddress {
+		return append(addresses, hostname...)
+	}
+	internal := func(ip string) corev1.NodeAddress {
+		return corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: ip}
+	}
+	external := func(ip string) corev1.NodeAddress {
+		return corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: ip}
+	}
+	port := func(ips ...string) ports.Port {
+		var port ports.Port
+		for _, ip := range ips {
+			port.FixedIPs = append(port.FixedIPs, ports.IP{IPAddress: ip})
+		}
+		return port
+	}
+
+	tests := []struct {
+		name      string
+		addresses []corev1.NodeAddress
+		// previous are the addresses in the status before the reconcile,
+		// the same as addresses if nil
+		previous    []corev1.NodeAddress
+		ports       []ports.Port
+		expected    []corev1.NodeAddress
+		expectEvent bool
+	}{
+		{
+			name:      "current",
+			addresses: withHostname(internal("10.0.0.5"), external("172.24.4.10"), internal("192.168.0.5")),
+			ports:     []ports.Port{port("10.0.0.5"), port("192.168.0.5")},
+			expected:  withHostname(internal("10.0.0.5"), external("172.24.4.10"), internal("192.168.0.5")),
+		},
+		{
+			name:      "fixed IP of a port changed",
+			addresses: withHostname(internal("10.0.0.5"), external("172.24.4.10"), internal("192.168.0.5")),
+			ports:     []ports.Port{port("10.0.0.7"), port("192.168.0.5")},
+			expected:  withHostname(external("172.24.4.10"), internal("192.168.0.5"), internal("10.0.0.7")),
+
+			expectEvent: true,
+		},
+		{
+			name:      "fixed IP of a port changed in a previous reconcile",
+			addresses: withHostname(internal("10.0.0.5"), external("172.24.4.10"), internal("192.168.0.5")),
+			previous:  withHostname(external("172.24.4.10"), internal("192.168.0.5"), internal("10.0.0.7")),
+			ports:     []ports.Port{port("10.0.0.7"), port("192.168.0.5")},
+			expected:  withHostname(external("172.24.4.10"), internal("192.168.0.5"), internal("10.0.0.7")),
+		},
+		{
+			name:      "fixed IP added to a port",
+			addresses: withHostname(internal("10.0.0.5")),
+			ports:     []ports.Port{port("10.0.0.5", "fd00::5")},
+			expected:  withHostname(internal("10.0.0.5"), internal("fd00::5")),
+
+			expectEvent: true,
+		},
+		{
+			name:      "ports can't be seen",
+			addresses: withHostname(internal("10.0.0.5")),
+			expected:  withHostname(internal("10.0.0.5")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := tt.previous
+			if previous == nil {
+				previous = tt.addresses
+			}
+			recorder := record.NewFakeRecorder(10)
+			machine := &machinev1.Machine{Status: machinev1.MachineStatus{Addresses: tt.addresses}}
+			if err := refreshStaleAddresses(machine, previous, "instance-id", &fakePortLister{ports: tt.ports}, recorder); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(machine.Status.Addresses, tt.expected) {
+				t.Errorf("Expected addresses %v, got %v", tt.expected, machine.Status.Addresses)
+			}
+			if events := len(recorder.Events); (events > 0) != tt.expectEvent {
+				t.Errorf("Expected an event: %v, got %d events", tt.expectEvent, events)
+			}
+		})
+	}
+}
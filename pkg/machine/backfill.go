@@ -0,0 +1,157 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+// openstackIDAnnotationKey is the annotation with the ID of the instance of a
+// machine, which is set by setMachineAnnotations.
+const openstackIDAnnotationKey = "openstack-resourceId"
+
+// BackfilledAnnotationKey is set on machines once they were backfilled, so
+// that they aren't backfilled again, e.g. because their cloud has no region
+// and their region label stays empty.
+const BackfilledAnnotationKey = "machine.openshift.io/openstack-backfilled"
+
+// BackfillMachines sets the providerID, labels and annotations of existing
+// machines which lack them because they were created by a very old version.
+// It is run once at startup, and logs a report of the machines it migrated.
+// Machines whose instance can't be found are left for the machine controller.
+func (oc *OpenstackClient) BackfillMachines(ctx context.Context) error {
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines); err != nil {
+		return fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	var backfilled, withoutInstance, failed []string
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		if !needsBackfill(machine) {
+			continue
+		}
+
+		ok, err := oc.backfillMachine(ctx, machine)
+		switch {
+		case err != nil:
+			klog.Errorf("Machine %s/%s: failed to backfill: %v", machine.Namespace, machine.Name, err)
+			failed = append(failed, machine.Name)
+		case !ok:
+			withoutInstance = append(withoutInstance, machine.Name)
+		default:
+			backfilled = append(backfilled, machine.Name)
+		}
+	}
+
+	if len(backfilled)+len(withoutInstance)+len(failed) > 0 {
+		klog.Infof("Backfilled machines: %d migrated %v, %d without an instance tagged with their cluster %v, %d failed %v",
+			len(backfilled), backfilled, len(withoutInstance), withoutInstance, len(failed), failed)
+	}
+	return nil
+}
+
+// needsBackfill returns true if the machine has been provisioned but lacks
+// its providerID, any of the labels and annotations set when it is
+// reconciled, or the state of its instance, and wasn't backfilled yet.
+func needsBackfill(machine *machinev1.Machine) bool {
+	if machine.DeletionTimestamp != nil || machine.Status.Phase == nil {
+		return false
+	}
+	if _, ok := machine.Annotations[BackfilledAnnotationKey]; ok {
+		return false
+	}
+	if phase := *machine.Status.Phase; phase != machinev1.PhaseProvisioned && phase != machinev1.PhaseRunning {
+		return false
+	}
+
+	return machine.Spec.ProviderID == nil ||
+		machine.Labels[maoMachine.MachineRegionLabelName] == "" ||
+		machine.Labels[maoMachine.MachineAZLabelName] == "" ||
+		machine.Labels[maoMachine.MachineInstanceTypeLabelName] == "" ||
+		machine.Annotations[openstackIDAnnotationKey] == "" ||
+		!hasInstanceState(machine)
+}
+
+// backfillMachine sets the providerID, labels, annotations and addresses of
+// the machine from its instance. The instance is found by providerID or by
+// name, and must be tagged with the cluster of the machine. It returns false
+// if there is no such instance.
+func (oc *OpenstackClient) backfillMachine(ctx context.Context, machine *machinev1.Machine) (bool, error) {
+	scope, regionName, err := oc.getScope(ctx, machine)
+	if err != nil {
+		return false, err
+	}
+
+	instanceStatus, err := getInstanceStatus(scope, machine, oc.params.CAPOCoexistence, oc.serverMarker(ctx))
+	if err != nil || instanceStatus == nil {
+		return false, err
+	}
+
+	computeClient, err := scope.NewComputeClient()
+	if err != nil {
+		return false, err
+	}
+	server, err := computeClient.GetServer(instanceStatus.ID())
+	if err != nil {
+		return false, err
+	}
+	if server.Tags == nil || !slices.Contains(*server.Tags, utils.GetClusterNameWithNamespace(machine)) {
+		return false, nil
+	}
+
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return false, err
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return false, err
+	}
+	hostname, err := machineHostname(machine, machineSpec, extensions)
+	if err != nil {
+		return false, err
+	}
+
+	if err := oc.setProviderID(ctx, machine, instanceStatus.ID()); err != nil {
+		return false, err
+	}
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	setMachineLabels(machine, regionName, instanceStatus.AvailabilityZone(), machineSpec.Flavor)
+	setMachineAnnotations(machine, instanceStatus, oc.params.DisableInstanceStateAnnotation)
+	if err := oc.client.Patch(ctx, machine, patch); err != nil {
+		return false, err
+	}
+
+	patch = client.MergeFrom(machine.DeepCopy())
+	if err := setMachineStatus(machine, instanceStatus, hostname); err != nil {
+		return false, err
+	}
+	setInstanceReadyCondition(machine, instanceStatus.ID(), string(instanceStatus.State()))
+	if err := oc.client.Status().Patch(ctx, machine, patch); err != nil {
+		return false, err
+	}
+
+	// The fields which the instance doesn't have, e.g. the region of a
+	// cloud without regions, stay empty
+	patch = client.MergeFrom(machine.DeepCopy())
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[BackfilledAnnotationKey] = "true"
+	if err := oc.client.Patch(ctx, machine, patch); err != nil {
+		return false, err
+	}
+
+	klog.Infof("Machine %s/%s: backfilled from instance %s", machine.Namespace, machine.Name, instanceStatus.ID())
+	return true, nil
+}
@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"testing"
+
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestNeedsBackfill(t *testing.T) {
+	reconciled := func() *machinev1beta1.Machine {
+		return &machinev1beta1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					maoMachine.MachineRegionLabelName:       "regionOne",
+					maoMachine.MachineAZLabelName:           "nova",
+					maoMachine.MachineInstanceTypeLabelName: "m1.xlarge",
+				},
+				Annotations: map[string]string{
+					openstackIDAnnotationKey:                      "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d",
+					maoMachine.MachineInstanceStateAnnotationName: "ACTIVE",
+				},
+			},
+			Spec:   machinev1beta1.MachineSpec{ProviderID: ptr.To("openstack:///c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d")},
+			Status: machinev1beta1.MachineStatus{Phase: ptr.To(machinev1beta1.PhaseRunning)},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*machinev1beta1.Machine)
+		expected bool
+	}{
+		{
+			name:     "reconciled",
+			modify:   func(*machinev1beta1.Machine) {},
+			expected: false,
+		},
+		{
+			name:     "no providerID",
+			modify:   func(m *machinev1beta1.Machine) { m.Spec.ProviderID = nil },
+			expected: true,
+		},
+		{
+			name:     "no instance ID annotation",
+			modify:   func(m *machinev1beta1.Machine) { delete(m.Annotations, openstackIDAnnotationKey) },
+			expected: true,
+		},
+		{
+			name:     "no instance state",
+			modify:   func(m *machinev1beta1.Machine) { delete(m.Annotations, maoMachine.MachineInstanceStateAnnotationName) },
+			expected: true,
+		},
+		{
+			name: "instance state only in the condition",
+			modify: func(m *machinev1beta1.Machine) {
+				delete(m.Annotations, maoMachine.MachineInstanceStateAnnotationName)
+				m.Status.Conditions = []machinev1beta1.Condition{{Type: InstanceReadyCondition, Status: corev1.ConditionTrue}}
+			},
+			expected: false,
+		},
+		{
+			name:     "no zone label",
+			modify:   func(m *machinev1beta1.Machine) { delete(m.Labels, maoMachine.MachineAZLabelName) },
+			expected: true,
+		},
+		{
+			name: "no region label after the backfill",
+			modify: func(m *machinev1beta1.Machine) {
+				m.Labels[maoMachine.MachineRegionLabelName] = ""
+				m.Annotations[BackfilledAnnotationKey] = "true"
+			},
+			expected: false,
+		},
+		{
+			name:     "no region label",
+			modify:   func(m *machinev1beta1.Machine) { m.Labels[maoMachine.MachineRegionLabelName] = "" },
+			expected: true,
+		},
+		{
+			name: "provisioning",
+			modify: func(m *machinev1beta1.Machine) {
+				m.Spec.ProviderID = nil
+				m.Status.Phase = ptr.To(machinev1beta1.PhaseProvisioning)
+			},
+			expected: false,
+		},
+		{
+			name: "deleting",
+			modify: func(m *machinev1beta1.Machine) {
+				m.Spec.ProviderID = nil
+				m.DeletionTimestamp = &metav1.Time{}
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := reconciled()
+			tt.modify(machine)
+			if actual := needsBackfill(machine); actual != tt.expected {
+				t.Errorf("Expected needsBackfill() to be %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
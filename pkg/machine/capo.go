@@ -0,0 +1,257 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// MachineToOpenStackMachine returns the CAPO OpenStackMachine equivalent to
+// machine in a cluster with the given platform status, which may be nil, for
+// migrating the machine to Cluster API. The templates of the providerSpec are
+// rendered for the machine and, if it has an instance, the OpenStackMachine
+// refers to it.
+//
+// No calls are made to the cloud. What can't be converted is left out and
+// described by the returned notes, e.g. a server group given by name or the
+// fields only MAPO supports.
+func MachineToOpenStackMachine(machine *machinev1beta1.Machine, platformStatus *configv1.OpenStackPlatformStatus) (*capov1.OpenStackMachine, []string, error) {
+	ps, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spec, notes, err := providerSpecToOpenStackMachineSpec(machine.Namespace, ps, extensions, platformStatus)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	availabilityZone := machineAvailabilityZone(machine, ps)
+	if availabilityZone != "" {
+		notes = append(notes, fmt.Sprintf("availability zone %s must be set as the failureDomain of the Cluster API Machine", availabilityZone))
+	}
+
+	if spec.ServerMetadata, err = renderServerMetadata(machine, ps.ServerMetadata, availabilityZone); err != nil {
+		return nil, nil, err
+	}
+
+	portDNSName, err := renderPortDNSName(machine, extensions.PortDNSName, availabilityZone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if portDNSName != "" && len(spec.Ports) > 0 {
+		spec.Ports[0].ValueSpecs = append(spec.Ports[0].ValueSpecs, capov1.ValueSpec{
+			Name:  "dns_name",
+			Key:   "dns_name",
+			Value: portDNSName,
+		})
+	}
+
+	if providerID := machine.Spec.ProviderID; providerID != nil && strings.HasPrefix(*providerID, providerPrefix) {
+		instanceID := strings.TrimPrefix(*providerID, providerPrefix)
+		spec.ProviderID = providerID
+		spec.InstanceID = &instanceID
+	}
+
+	return &capov1.OpenStackMachine{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: capov1.GroupVersion.String(),
+			Kind:       "OpenStackMachine",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machine.Name,
+			Namespace: machine.Namespace,
+			Labels:    machine.Labels,
+		},
+		Spec: spec,
+	}, notes, nil
+}
+
+// MachineSetToOpenStackMachineTemplate returns the CAPO
+// OpenStackMachineTemplate equivalent to the template of machineSet in a
+// cluster with the given platform status, which may be nil, for migrating the
+// MachineSet to a Cluster API MachineSet.
+//
+// As with MachineToOpenStackMachine no calls are made to the cloud, and what
+// can't be converted is described by the returned notes. This includes the
+// templates of the providerSpec, which are rendered by MAPO for each machine:
+// they are copied unrendered.
+func MachineSetToOpenStackMachineTemplate(machineSet *machinev1beta1.MachineSet, platformStatus *configv1.OpenStackPlatformStatus) (*capov1.OpenStackMachineTemplate, []string, error) {
+	providerSpec := machineSet.Spec.Template.Spec.ProviderSpec
+	ps, err := clients.MachineSpecFromProviderSpec(providerSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(providerSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spec, notes, err := providerSpecToOpenStackMachineSpec(machineSet.Namespace, ps, extensions, platformStatus)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ps.AvailabilityZone != "" {
+		notes = append(notes, fmt.Sprintf("availability zone %s must be set as the failureDomain of the Cluster API MachineSet", ps.AvailabilityZone))
+	}
+
+	spec.ServerMetadata = ps.ServerMetadata
+	keys := make([]string, 0, len(ps.ServerMetadata))
+	for key := range ps.ServerMetadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(ps.ServerMetadata[key], "{{") {
+			notes = append(notes, fmt.Sprintf("server metadata %s is a template, which is not rendered by CAPO", key))
+		}
+	}
+	if extensions.PortDNSName != "" {
+		notes = append(notes, "portDNSName is a template, which is not rendered by CAPO: it was left out")
+	}
+
+	return &capov1.OpenStackMachineTemplate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: capov1.GroupVersion.String(),
+			Kind:       "OpenStackMachineTemplate",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machineSet.Name,
+			Namespace: machineSet.Namespace,
+			Labels:    machineSet.Labels,
+		},
+		Spec: capov1.OpenStackMachineTemplateSpec{
+			Template: capov1.OpenStackMachineTemplateResource{Spec: spec},
+		},
+	}, notes, nil
+}
+
+// providerSpecToOpenStackMachineSpec returns the OpenStackMachineSpec of the
+// fields of a providerSpec in namespace which don't depend on the machine,
+// and notes describing the fields which can't be converted.
+func providerSpecToOpenStackMachineSpec(namespace string, ps *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, platformStatus *configv1.OpenStackPlatformStatus) (capov1.OpenStackMachineSpec, []string, error) {
+	var notes []string
+
+	spec := capov1.OpenStackMachineSpec{
+		CloudName:      ps.CloudName,
+		Flavor:         ps.Flavor,
+		SSHKeyName:     ps.KeyName,
+		Ports:          ResolvePorts(ps, platformStatus),
+		SecurityGroups: securityGroupParamToCapov1SecurityGroupFilter(ps.SecurityGroups),
+		Trunk:          ps.Trunk,
+		Tags:           ps.Tags,
+		ConfigDrive:    ps.ConfigDrive,
+		RootVolume:     extractRootVolumeFromProviderSpec(ps),
+		ServerGroupID:  coalesce(ps.ServerGroupID, extractServerGroupHint(extensions)),
+	}
+
+	// CAPO looks up images by name unless they are given by ID
+	if image := extractImageFromProviderSpec(ps); uuid.Validate(image) == nil {
+		spec.ImageUUID = image
+	} else {
+		spec.Image = image
+	}
+
+	var err error
+	if spec.AdditionalBlockDevices, err = additionalBlockDevicesToCapov1(ps.AdditionalBlockDevices); err != nil {
+		return spec, nil, err
+	}
+
+	if ps.CloudsSecret != nil && ps.CloudsSecret.Name != "" {
+		spec.IdentityRef = &capov1.OpenStackIdentityReference{Kind: "Secret", Name: ps.CloudsSecret.Name}
+		if ps.CloudsSecret.Namespace != "" && ps.CloudsSecret.Namespace != namespace {
+			notes = append(notes, fmt.Sprintf("clouds secret %s must be copied from namespace %s to %s", ps.CloudsSecret.Name, ps.CloudsSecret.Namespace, namespace))
+		}
+	}
+
+	if spec.ServerGroupID == "" && ps.ServerGroupName != "" {
+		notes = append(notes, fmt.Sprintf("serverGroupName %s must be replaced by the ID of the server group", ps.ServerGroupName))
+	}
+
+	unsupported, err := unsupportedExtensions(extensions)
+	if err != nil {
+		return spec, nil, err
+	}
+	for _, field := range unsupported {
+		notes = append(notes, fmt.Sprintf("%s is not supported by CAPO: it was left out", field))
+	}
+
+	return spec, notes, nil
+}
+
+// unsupportedExtensions returns the sorted JSON names of the fields of
+// extensions which are set and have no CAPO equivalent. The server group of
+// the scheduler hints and portDNSName are converted, so they are not
+// included.
+func unsupportedExtensions(extensions *clients.ProviderSpecExtensions) ([]string, error) {
+	unsupported := *extensions
+	unsupported.PortDNSName = ""
+	if unsupported.SchedulerHints != nil {
+		hints := *unsupported.SchedulerHints
+		hints.Group = ""
+		unsupported.SchedulerHints = &hints
+	}
+
+	raw, err := json.Marshal(&unsupported)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, value := range fields {
+		if !isEmptyJSON(value) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isEmptyJSON returns true if the unmarshalled JSON value holds no data, e.g.
+// the extensions of networks which have none.
+func isEmptyJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		for _, item := range v {
+			if !isEmptyJSON(item) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for _, item := range v {
+			if !isEmptyJSON(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+)
+
+func TestMachineToOpenStackMachine(t *testing.T) {
+	providerID := "openstack:///0e2d8a34-5a8e-4a8f-9d5c-0c6a1c3b9e11"
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"},
+		Spec: machinev1.MachineSpec{
+			ProviderID: &providerID,
+			ProviderSpec: machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(`{
+				"cloudName": "openstack",
+				"cloudsSecret": {"name": "openstack-cloud-credentials", "namespace": "openshift-machine-api"},
+				"flavor": "m1.large",
+				"image": "rhcos",
+				"availabilityZone": "az1",
+				"networks": [{"uuid": "a"}],
+				"serverMetadata": {"Name": "{{ .MachineName }}"},
+				"serverGroupName": "workers",
+				"portDNSName": "{{ .MachineName }}",
+				"schedulerHints": {"sameHost": ["b"]},
+				"floatingIPs": [{"network": "public"}]
+			}`)}},
+		},
+	}
+	platformStatus := &configv1.OpenStackPlatformStatus{APIServerInternalIPs: []string{"10.0.0.5"}, IngressIPs: []string{"10.0.0.7"}}
+
+	openStackMachine, notes, err := MachineToOpenStackMachine(machine, platformStatus)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spec := openStackMachine.Spec
+	if spec.Flavor != "m1.large" || spec.Image != "rhcos" || spec.ImageUUID != "" || spec.CloudName != "openstack" {
+		t.Errorf("Unexpected flavor, image or cloud: %+v", spec)
+	}
+	if spec.IdentityRef == nil || *spec.IdentityRef != (capov1.OpenStackIdentityReference{Kind: "Secret", Name: "openstack-cloud-credentials"}) {
+		t.Errorf("Unexpected identityRef: %v", spec.IdentityRef)
+	}
+	if spec.InstanceID == nil || *spec.InstanceID != "0e2d8a34-5a8e-4a8f-9d5c-0c6a1c3b9e11" || spec.ProviderID != &providerID {
+		t.Errorf("Unexpected instance: %v %v", spec.InstanceID, spec.ProviderID)
+	}
+	if !reflect.DeepEqual(spec.ServerMetadata, map[string]string{"Name": "worker-0"}) {
+		t.Errorf("Unexpected server metadata: %v", spec.ServerMetadata)
+	}
+	if len(spec.Ports) != 1 || len(spec.Ports[0].AllowedAddressPairs) != 2 {
+		t.Fatalf("Expected one port with the VIPs as allowed address pairs, got %+v", spec.Ports)
+	}
+	if !reflect.DeepEqual(spec.Ports[0].ValueSpecs, []capov1.ValueSpec{{Name: "dns_name", Key: "dns_name", Value: "worker-0"}}) {
+		t.Errorf("Unexpected value specs: %v", spec.Ports[0].ValueSpecs)
+	}
+
+	expectedNotes := []string{
+		"serverGroupName workers must be replaced by the ID of the server group",
+		"floatingIPs is not supported by CAPO: it was left out",
+		"schedulerHints is not supported by CAPO: it was left out",
+		"availability zone az1 must be set as the failureDomain of the Cluster API Machine",
+	}
+	if !reflect.DeepEqual(notes, expectedNotes) {
+		t.Errorf("Expected notes %q, got %q", expectedNotes, notes)
+	}
+}
+
+func TestMachineSetToOpenStackMachineTemplate(t *testing.T) {
+	machineSet := &machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "capi"}}
+	machineSet.Spec.Template.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: []byte(`{
+		"cloudsSecret": {"name": "openstack-cloud-credentials", "namespace": "openshift-machine-api"},
+		"flavor": "m1.large",
+		"rootVolume": {"sourceUUID": "8d4e3c1a-6f2b-4c7d-9e0a-1b2c3d4e5f60", "diskSize": 30},
+		"networks": [{"uuid": "a"}],
+		"serverMetadata": {"Name": "{{ .MachineName }}", "Team": "infra"},
+		"schedulerHints": {"group": "c"},
+		"portDNSName": "{{ .MachineName }}"
+	}`)}
+
+	template, notes, err := MachineSetToOpenStackMachineTemplate(machineSet, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spec := template.Spec.Template.Spec
+	if spec.ImageUUID != "8d4e3c1a-6f2b-4c7d-9e0a-1b2c3d4e5f60" || spec.Image != "" {
+		t.Errorf("Expected the image to be given by ID, got %q %q", spec.Image, spec.ImageUUID)
+	}
+	if spec.RootVolume == nil || spec.RootVolume.Size != 30 {
+		t.Errorf("Unexpected root volume: %v", spec.RootVolume)
+	}
+	if spec.ServerGroupID != "c" {
+		t.Errorf("Expected the server group of the scheduler hints, got %q", spec.ServerGroupID)
+	}
+	if spec.ServerMetadata["Name"] != "{{ .MachineName }}" {
+		t.Errorf("Expected the server metadata to be unrendered, got %v", spec.ServerMetadata)
+	}
+	if len(spec.Ports) != 1 || len(spec.Ports[0].ValueSpecs) != 0 {
+		t.Errorf("Expected one port without value specs, got %+v", spec.Ports)
+	}
+
+	expectedNotes := []string{
+		"clouds secret openstack-cloud-credentials must be copied from namespace openshift-machine-api to capi",
+		"server metadata Name is a template, which is not rendered by CAPO",
+		"portDNSName is a template, which is not rendered by CAPO: it was left out",
+	}
+	if !reflect.DeepEqual(notes, expectedNotes) {
+		t.Errorf("Expected notes %q, got %q", expectedNotes, notes)
+	}
+}
@@ -0,0 +1,51 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// checkServiceCatalog returns an error naming the services used by the machine
+// which have no endpoint in the service catalog of the cloud. Without it the
+// machine would fail much later with an endpoint error which doesn't say
+// which service is missing. Creating a service client doesn't make any
+// request, so this is cheap.
+func checkServiceCatalog(scope scope.Scope, regionName string, machineSpec *machinev1alpha1.OpenstackProviderSpec) error {
+	var missing []string
+	if _, err := scope.NewComputeClient(); err != nil {
+		missing = append(missing, "compute")
+	}
+	if _, err := scope.NewNetworkClient(); err != nil {
+		missing = append(missing, "network")
+	}
+	if _, err := scope.NewImageClient(); err != nil {
+		missing = append(missing, "image")
+	}
+	if usesVolumes(machineSpec) {
+		if _, err := scope.NewVolumeClient(); err != nil {
+			missing = append(missing, "volume")
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the service catalog has no endpoint in region %q for the services used by the machine: %s", regionName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// usesVolumes returns true if the machine has a root volume or an additional
+// block device which is a volume.
+func usesVolumes(machineSpec *machinev1alpha1.OpenstackProviderSpec) bool {
+	if machineSpec.RootVolume != nil {
+		return true
+	}
+	for _, blockDevice := range machineSpec.AdditionalBlockDevices {
+		if blockDevice.Storage.Type == machinev1alpha1.VolumeBlockDevice {
+			return true
+		}
+	}
+	return false
+}
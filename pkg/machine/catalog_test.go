@@ -0,0 +1,57 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// catalogScope is a scope whose cloud has no network or volume endpoint.
+type catalogScope struct {
+	scope.Scope
+}
+
+func (catalogScope) NewNetworkClient() (capoclients.NetworkClient, error) {
+	return nil, errors.New("failed to create networking service providerClient: No suitable endpoint could be found in the service catalog.")
+}
+
+func (catalogScope) NewVolumeClient() (capoclients.VolumeClient, error) {
+	return nil, errors.New("failed to create volume service client: No suitable endpoint could be found in the service catalog.")
+}
+
+func TestCheckServiceCatalog(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineSpec machinev1alpha1.OpenstackProviderSpec
+		expected    string
+	}{
+		{
+			name:     "no volumes",
+			expected: `the service catalog has no endpoint in region "regionOne" for the services used by the machine: network`,
+		},
+		{
+			name: "root volume",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				RootVolume: &machinev1alpha1.RootVolume{Size: 25},
+			},
+			expected: `the service catalog has no endpoint in region "regionOne" for the services used by the machine: network, volume`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			s := catalogScope{scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())}
+
+			err := checkServiceCatalog(s, "regionOne", &tt.machineSpec)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package machine
+
+import (
+	"sync"
+
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// pooledClient is a service client which is created on first use and then
+// reused. A failure to create it isn't remembered, so it is retried.
+type pooledClient[T any] struct {
+	mu      sync.Mutex
+	client  T
+	created bool
+}
+
+func (p *pooledClient[T]) get(newClient func() (T, error)) (T, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.created {
+		client, err := newClient()
+		if err != nil {
+			return client, err
+		}
+		p.client, p.created = client, true
+	}
+	return p.client, nil
+}
+
+// clientPoolScope is the scope of a reconcile, which reuses its service
+// clients. The compute and networking services of CAPO create a client, with
+// the endpoint from the catalog of the token, every time they are created,
+// which happens several times in each reconcile. The clients aren't shared
+// between reconciles, since they make their requests with the context of
+// their reconcile, but the endpoints they are created with are: they are
+// located once per shared provider client, see clients.SharedProviderScope.
+type clientPoolScope struct {
+	scope.Scope
+
+	compute      pooledClient[capoclients.ComputeClient]
+	network      pooledClient[capoclients.NetworkClient]
+	volume       pooledClient[capoclients.VolumeClient]
+	image        pooledClient[capoclients.ImageClient]
+	loadBalancer pooledClient[capoclients.LbClient]
+}
+
+func newClientPoolScope(s scope.Scope) *clientPoolScope {
+	return &clientPoolScope{Scope: s}
+}
+
+func (s *clientPoolScope) NewComputeClient() (capoclients.ComputeClient, error) {
+	return s.compute.get(s.Scope.NewComputeClient)
+}
+
+func (s *clientPoolScope) NewNetworkClient() (capoclients.NetworkClient, error) {
+	return s.network.get(s.Scope.NewNetworkClient)
+}
+
+func (s *clientPoolScope) NewVolumeClient() (capoclients.VolumeClient, error) {
+	return s.volume.get(s.Scope.NewVolumeClient)
+}
+
+func (s *clientPoolScope) NewImageClient() (capoclients.ImageClient, error) {
+	return s.image.get(s.Scope.NewImageClient)
+}
+
+func (s *clientPoolScope) NewLbClient() (capoclients.LbClient, error) {
+	return s.loadBalancer.get(s.Scope.NewLbClient)
+}
@@ -0,0 +1,46 @@
+package machine
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// countingScope creates a new compute client on every call, and fails the
+// calls in failures.
+type countingScope struct {
+	scope.Scope
+	calls    int
+	failures map[int]bool
+}
+
+func (s *countingScope) NewComputeClient() (capoclients.ComputeClient, error) {
+	s.calls++
+	if s.failures[s.calls] {
+		return nil, fmt.Errorf("no compute endpoint")
+	}
+	return capoclients.NewComputeErrorClient(fmt.Errorf("client %d", s.calls)), nil
+}
+
+func TestClientPoolScope(t *testing.T) {
+	g := NewWithT(t)
+
+	inner := &countingScope{failures: map[int]bool{1: true}}
+	pool := newClientPoolScope(inner)
+
+	// A failure to create the client is returned and retried
+	_, err := pool.NewComputeClient()
+	g.Expect(err).To(MatchError("no compute endpoint"))
+
+	first, err := pool.NewComputeClient()
+	g.Expect(err).NotTo(HaveOccurred())
+	second, err := pool.NewComputeClient()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Once created, the client is reused
+	g.Expect(second).To(BeIdenticalTo(first))
+	g.Expect(inner.calls).To(Equal(2))
+}
@@ -0,0 +1,102 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// errForeignServer is returned when the server of a machine's providerID
+// was created for another machine, so that it is neither adopted nor deleted.
+var errForeignServer = errors.New("server is not owned by the machine")
+
+// serverMarker marks the server of a machine as owned by the machine.
+type serverMarker interface {
+	markServer(serverID string, machine *machinev1.Machine) error
+}
+
+// instanceServiceMarker marks servers with the machine UID server metadata,
+// with the instance service of the machine, which is only created when a
+// server must be marked.
+type instanceServiceMarker struct {
+	ctx        context.Context
+	kubeClient kubernetes.Interface
+}
+
+func (m instanceServiceMarker) markServer(serverID string, machine *machinev1.Machine) error {
+	instanceService, err := clients.NewInstanceServiceFromMachine(m.ctx, m.kubeClient, machine)
+	if err != nil {
+		return err
+	}
+	return instanceService.SetServerMetadata(serverID, map[string]string{ServerMetadataMachineUIDKey: string(machine.UID)})
+}
+
+// ownedByMachine returns true if the server carries a marker which MAPO sets
+// on the servers it creates for the machine: the machine UID tag or the
+// machine UID server metadata. Servers created by CAPO for a CAPI machine, or
+// by MAPO before servers were marked, carry neither.
+func ownedByMachine(server *capoclients.ServerExt, machine *machinev1.Machine) bool {
+	if machine.UID == "" {
+		return false
+	}
+	if serverMachineUID(server) == string(machine.UID) {
+		return true
+	}
+	return server.Metadata[ServerMetadataMachineUIDKey] == string(machine.UID)
+}
+
+// isForeignServer returns true if the server must not be adopted or deleted
+// for the machine. A server created for another machine is always foreign.
+// When coexisting with CAPO, so is any server not marked as owned by the
+// machine, since CAPO may have created it with the same name in the same
+// project.
+func isForeignServer(server *capoclients.ServerExt, machine *machinev1.Machine, coexistWithCAPO bool) bool {
+	if belongsToOtherMachine(server, machine) {
+		return true
+	}
+	return coexistWithCAPO && !ownedByMachine(server, machine)
+}
+
+// getOwnedInstanceStatus returns the status of the server with the given ID,
+// or nil if it doesn't exist. It returns errForeignServer if the server was
+// created for another machine. The server is the one of the providerID of
+// the machine, which only MAPO sets, so a server without any marker was
+// adopted by MAPO before servers were marked: it is marked with marker, so
+// that it is known to be owned even if the providerID is lost.
+func getOwnedInstanceStatus(scope scope.Scope, machine *machinev1.Machine, instanceID string, marker serverMarker) (*compute.InstanceStatus, error) {
+	computeClient, err := scope.NewComputeClient()
+	if err != nil {
+		return nil, err
+	}
+	server, err := computeClient.GetServer(instanceID)
+	if err != nil {
+		if capoerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get server %q detail failed: %v", instanceID, err)
+	}
+	if belongsToOtherMachine(server, machine) {
+		return nil, fmt.Errorf("OpenStack server %s of machine %s: %w", instanceID, machine.Name, errForeignServer)
+	}
+	if !ownedByMachine(server, machine) && machine.UID != "" {
+		if err := marker.markServer(instanceID, machine); err != nil {
+			return nil, fmt.Errorf("error marking OpenStack server %s as owned by machine %s: %w", instanceID, machine.Name, err)
+		}
+		scope.Logger().Info("Marked OpenStack server as owned by its machine", "machine", machine.Name, "server", instanceID)
+	}
+	return compute.NewInstanceStatusFromServer(server, scope.Logger()), nil
+}
+
+// serverMarker returns the marker of the servers of machines.
+func (oc *OpenstackClient) serverMarker(ctx context.Context) serverMarker {
+	return instanceServiceMarker{ctx: ctx, kubeClient: oc.params.KubeClient}
+}
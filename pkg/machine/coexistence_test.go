@@ -0,0 +1,140 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestIsForeignServer(t *testing.T) {
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: types.UID("3f9e2a1b-7c4d-4e5f-8a6b-9c0d1e2f3a4b")}}
+
+	server := func(metadata map[string]string, tags ...string) *capoclients.ServerExt {
+		return &capoclients.ServerExt{Server: servers.Server{ID: "id", Name: machine.Name, Metadata: metadata, Tags: &tags}}
+	}
+
+	tests := []struct {
+		name          string
+		server        *capoclients.ServerExt
+		foreign       bool
+		foreignToCAPO bool
+	}{
+		{
+			name:   "tagged with the machine UID",
+			server: server(nil, machineUIDTag(machine)),
+		},
+		{
+			name:   "machine UID server metadata",
+			server: server(map[string]string{ServerMetadataMachineUIDKey: string(machine.UID)}),
+		},
+		{
+			name:          "unmarked, e.g. created by CAPO",
+			server:        server(map[string]string{"capi-machine": "worker-0"}, "capi-cluster"),
+			foreignToCAPO: true,
+		},
+		{
+			name:          "tagged with the UID of another machine",
+			server:        server(nil, "machine-uid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"),
+			foreign:       true,
+			foreignToCAPO: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if foreign := isForeignServer(tt.server, machine, false); foreign != tt.foreign {
+				t.Errorf("expected foreign %t, got %t", tt.foreign, foreign)
+			}
+			if foreign := isForeignServer(tt.server, machine, true); foreign != tt.foreignToCAPO {
+				t.Errorf("expected foreign %t when coexisting with CAPO, got %t", tt.foreignToCAPO, foreign)
+			}
+		})
+	}
+}
+
+func TestGetInstanceStatusCoexistingWithCAPO(t *testing.T) {
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: types.UID("3f9e2a1b-7c4d-4e5f-8a6b-9c0d1e2f3a4b")}}
+	capoServer := capoclients.ServerExt{Server: servers.Server{ID: "capo-id", Name: machine.Name, Status: "ACTIVE"}}
+	ownServer := capoclients.ServerExt{Server: servers.Server{ID: "own-id", Name: machine.Name, Status: "ACTIVE", Tags: &[]string{machineUIDTag(machine)}}}
+
+	t.Run("by name", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+		mockScopeFactory.ComputeClient.EXPECT().ListServers(servers.ListOpts{Name: "^worker-0$"}).Return([]capoclients.ServerExt{capoServer}, nil).Times(3)
+
+		instanceStatus, err := getInstanceStatusByName(mockScopeFactory, machine, false)
+		if err != nil || instanceStatus == nil || instanceStatus.ID() != "capo-id" {
+			t.Fatalf("expected the unmarked server to be adopted without coexistence, got %v, %v", instanceStatus, err)
+		}
+		instanceStatus, err = getInstanceStatusByName(mockScopeFactory, machine, true)
+		if err != nil || instanceStatus != nil {
+			t.Fatalf("expected the unmarked server to be ignored, got %v, %v", instanceStatus, err)
+		}
+		if err := checkServerNameCollision(mockScopeFactory, machine, true); err == nil {
+			t.Errorf("expected a name collision with the unmarked server")
+		}
+	})
+
+	t.Run("by provider ID", func(t *testing.T) {
+		otherServer := capoclients.ServerExt{Server: servers.Server{ID: "other-id", Name: machine.Name, Status: "ACTIVE", Tags: &[]string{"machine-uid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"}}}
+
+		mockCtrl := gomock.NewController(t)
+		mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+		mockScopeFactory.ComputeClient.EXPECT().GetServer("unmarked-id").Return(&capoServer, nil)
+		mockScopeFactory.ComputeClient.EXPECT().GetServer("other-id").Return(&otherServer, nil)
+		mockScopeFactory.ComputeClient.EXPECT().GetServer("own-id").Return(&ownServer, nil)
+		mockScopeFactory.ComputeClient.EXPECT().GetServer("deleted-id").Return(nil, gophercloud.ErrDefault404{})
+		marker := &fakeServerMarker{}
+
+		// A server adopted by providerID before servers were marked is
+		// marked, rather than treated as foreign
+		if instanceStatus, err := getOwnedInstanceStatus(mockScopeFactory, machine, "unmarked-id", marker); err != nil || instanceStatus == nil || instanceStatus.ID() != "capo-id" {
+			t.Errorf("expected the unmarked server, got %v, %v", instanceStatus, err)
+		}
+		if _, err := getOwnedInstanceStatus(mockScopeFactory, machine, "other-id", marker); !errors.Is(err, errForeignServer) {
+			t.Errorf("expected errForeignServer, got %v", err)
+		}
+		if instanceStatus, err := getOwnedInstanceStatus(mockScopeFactory, machine, "own-id", marker); err != nil || instanceStatus == nil || instanceStatus.ID() != "own-id" {
+			t.Errorf("expected the owned server, got %v, %v", instanceStatus, err)
+		}
+		if instanceStatus, err := getOwnedInstanceStatus(mockScopeFactory, machine, "deleted-id", marker); err != nil || instanceStatus != nil {
+			t.Errorf("expected no server, got %v, %v", instanceStatus, err)
+		}
+		if len(marker.marked) != 1 || marker.marked[0] != "unmarked-id" {
+			t.Errorf("expected only the unmarked server to be marked, got %v", marker.marked)
+		}
+	})
+
+	t.Run("marking fails", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+		mockScopeFactory.ComputeClient.EXPECT().GetServer("unmarked-id").Return(&capoServer, nil)
+
+		marker := &fakeServerMarker{err: errors.New("forbidden")}
+		if _, err := getOwnedInstanceStatus(mockScopeFactory, machine, "unmarked-id", marker); err == nil || errors.Is(err, errForeignServer) {
+			t.Errorf("expected the marking error, got %v", err)
+		}
+	})
+}
+
+// fakeServerMarker records the servers it marks.
+type fakeServerMarker struct {
+	marked []string
+	err    error
+}
+
+func (m *fakeServerMarker) markServer(serverID string, _ *machinev1beta1.Machine) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.marked = append(m.marked, serverID)
+	return nil
+}
@@ -0,0 +1,85 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// computeQuotaService is the part of clients.InstanceService which looks up
+// flavors and the compute limits of the project.
+type computeQuotaService interface {
+	GetFlavorID(flavorName string) (string, error)
+	GetFlavorInfo(flavorID string) (*flavors.Flavor, error)
+	GetComputeLimits() (*clients.ComputeLimits, error)
+}
+
+// computeQuotaRequeueAfter is how long the creation of a machine waits when
+// the compute quota of the project is used up by other servers.
+const computeQuotaRequeueAfter = time.Minute
+
+// insufficientComputeQuota returns which compute quotas of the project are
+// smaller than a server of the flavor, so that it can never fit, and which
+// are too small for it given the current usage of the project, which may
+// change. Each is an empty string if there is none. Quotas of -1 are
+// unlimited.
+func insufficientComputeQuota(flavor *flavors.Flavor, limits *clients.ComputeLimits) (string, string) {
+	var tooSmall, exhausted []string
+	check := func(resource string, requested, limit, used int) {
+		switch {
+		case limit < 0:
+		case requested > limit:
+			tooSmall = append(tooSmall, fmt.Sprintf("%s: %d requested, quota of %d", resource, requested, limit))
+		case requested > limit-used:
+			exhausted = append(exhausted, fmt.Sprintf("%s: %d requested, %d of %d available", resource, requested, max(limit-used, 0), limit))
+		}
+	}
+	check("cores", flavor.VCPUs, limits.MaxTotalCores, limits.TotalCoresUsed)
+	check("RAM (MiB)", flavor.RAM, limits.MaxTotalRAMSize, limits.TotalRAMUsed)
+	check("instances", 1, limits.MaxTotalInstances, limits.TotalInstancesUsed)
+	return strings.Join(tooSmall, ", "), strings.Join(exhausted, ", ")
+}
+
+// checkComputeQuota checks, before any resource of the machine is created,
+// that the compute quotas of the project leave room for a server of its
+// flavor. If a quota is smaller than the flavor, the server can never be
+// created, so the machine fails with an InsufficientComputeQuota event. If
+// the quotas are only used up by other servers, the creation is retried
+// later with an InsufficientComputeQuota warning. The check is skipped if the
+// limits can't be read.
+func (oc *OpenstackClient) checkComputeQuota(machine *machinev1.Machine, flavorName string, service computeQuotaService) error {
+	limits, err := service.GetComputeLimits()
+	if err != nil {
+		klog.Warningf("Machine %s: not checking the compute quota, since the limits of the project can't be read: %v", machine.Name, err)
+		return nil
+	}
+	flavorID, err := service.GetFlavorID(flavorName)
+	if err != nil {
+		return err
+	}
+	flavor, err := service.GetFlavorInfo(flavorID)
+	if err != nil {
+		return err
+	}
+
+	tooSmall, exhausted := insufficientComputeQuota(flavor, limits)
+	switch {
+	case tooSmall != "":
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InsufficientComputeQuota",
+			"The compute quota of the project is smaller than a server of flavor %s: %s", flavorName, tooSmall)
+		return maoMachine.InvalidMachineConfiguration("the compute quota of the project is smaller than a server of flavor %s: %s", flavorName, tooSmall)
+	case exhausted != "":
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InsufficientComputeQuota",
+			"The compute quota of the project has no room for a server of flavor %s, retrying in %s: %s", flavorName, computeQuotaRequeueAfter, exhausted)
+		return &maoMachine.RequeueAfterError{RequeueAfter: computeQuotaRequeueAfter}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeComputeQuotaService struct {
+	limits    *clients.ComputeLimits
+	limitsErr error
+}
+
+func (s *fakeComputeQuotaService) GetFlavorID(flavorName string) (string, error) {
+	return flavorName + "-id", nil
+}
+
+func (s *fakeComputeQuotaService) GetFlavorInfo(flavorID string) (*flavors.Flavor, error) {
+	return &flavors.Flavor{ID: flavorID, VCPUs: 8, RAM: 16384}, nil
+}
+
+func (s *fakeComputeQuotaService) GetComputeLimits() (*clients.ComputeLimits, error) {
+	return s.limits, s.limitsErr
+}
+
+func TestInsufficientComputeQuota(t *testing.T) {
+	flavor := &flavors.Flavor{VCPUs: 8, RAM: 16384}
+	tests := []struct {
+		name              string
+		limits            clients.ComputeLimits
+		expectedTooSmall  string
+		expectedExhausted string
+	}{
+		{
+			name:   "fits",
+			limits: clients.ComputeLimits{MaxTotalCores: 100, TotalCoresUsed: 92, MaxTotalRAMSize: 51200, TotalRAMUsed: 32768, MaxTotalInstances: 10, TotalInstancesUsed: 9},
+		},
+		{
+			name:   "unlimited",
+			limits: clients.ComputeLimits{MaxTotalCores: -1, TotalCoresUsed: 500, MaxTotalRAMSize: -1, TotalRAMUsed: 1048576, MaxTotalInstances: -1, TotalInstancesUsed: 60},
+		},
+		{
+			name:              "cores and instances exhausted",
+			limits:            clients.ComputeLimits{MaxTotalCores: 100, TotalCoresUsed: 96, MaxTotalRAMSize: -1, MaxTotalInstances: 10, TotalInstancesUsed: 10},
+			expectedExhausted: "cores: 8 requested, 4 of 100 available, instances: 1 requested, 0 of 10 available",
+		},
+		{
+			name:             "flavor larger than the quota",
+			limits:           clients.ComputeLimits{MaxTotalCores: -1, MaxTotalRAMSize: 8192, MaxTotalInstances: -1},
+			expectedTooSmall: "RAM (MiB): 16384 requested, quota of 8192",
+		},
+		{
+			name:              "usage above the quota",
+			limits:            clients.ComputeLimits{MaxTotalCores: 10, TotalCoresUsed: 12, MaxTotalRAMSize: 8192, MaxTotalInstances: -1},
+			expectedTooSmall:  "RAM (MiB): 16384 requested, quota of 8192",
+			expectedExhausted: "cores: 8 requested, 0 of 10 available",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tooSmall, exhausted := insufficientComputeQuota(flavor, &tt.limits)
+			if tooSmall != tt.expectedTooSmall {
+				t.Errorf("Expected too small %q, got %q", tt.expectedTooSmall, tooSmall)
+			}
+			if exhausted != tt.expectedExhausted {
+				t.Errorf("Expected exhausted %q, got %q", tt.expectedExhausted, exhausted)
+			}
+		})
+	}
+}
+
+func TestCheckComputeQuota(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+
+	// A flavor larger than the quota never fits
+	recorder := record.NewFakeRecorder(10)
+	oc := &OpenstackClient{eventRecorder: recorder}
+	service := &fakeComputeQuotaService{limits: &clients.ComputeLimits{MaxTotalCores: 4, MaxTotalRAMSize: -1, MaxTotalInstances: -1}}
+	err := oc.checkComputeQuota(machine, "m1.xlarge", service)
+	var invalidConfiguration *maoMachine.MachineError
+	if !errors.As(err, &invalidConfiguration) || invalidConfiguration.Reason != machinev1.InvalidConfigurationMachineError {
+		t.Errorf("Expected an invalid configuration error, got %v", err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected an InsufficientComputeQuota event, got %d events", len(recorder.Events))
+	}
+
+	// A quota used up by other servers is retried
+	recorder = record.NewFakeRecorder(10)
+	oc = &OpenstackClient{eventRecorder: recorder}
+	service = &fakeComputeQuotaService{limits: &clients.ComputeLimits{MaxTotalCores: 16, TotalCoresUsed: 12, MaxTotalRAMSize: -1, MaxTotalInstances: -1}}
+	err = oc.checkComputeQuota(machine, "m1.xlarge", service)
+	var requeue *maoMachine.RequeueAfterError
+	if !errors.As(err, &requeue) || requeue.RequeueAfter != computeQuotaRequeueAfter {
+		t.Errorf("Expected a requeue, got %v", err)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Expected an InsufficientComputeQuota event, got %d events", len(recorder.Events))
+	}
+
+	// The check is skipped if the limits can't be read
+	service = &fakeComputeQuotaService{limitsErr: errors.New("forbidden")}
+	if err := oc.checkComputeQuota(machine, "m1.xlarge", service); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package machine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// Default modes of config drive files.
+const (
+	configMapFileMode = 0644
+	secretFileMode    = 0600
+)
+
+// validateConfigDriveFiles checks that the config drive files have unique
+// absolute paths and a single source. Files from Secrets must allow their
+// contents in the user data, since they are no longer secret there.
+func validateConfigDriveFiles(machineSpec *machinev1alpha1.OpenstackProviderSpec, files []clients.ConfigDriveFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if machineSpec.ConfigDrive == nil || !*machineSpec.ConfigDrive {
+		return fmt.Errorf("configDriveFiles require configDrive to be true")
+	}
+
+	paths := make(map[string]bool, len(files))
+	for i, file := range files {
+		if !path.IsAbs(file.Path) || path.Clean(file.Path) != file.Path {
+			return fmt.Errorf("config drive file %d: path %q is not a clean absolute path", i, file.Path)
+		}
+		if paths[file.Path] {
+			return fmt.Errorf("config drive file %d: path %s is used more than once", i, file.Path)
+		}
+		paths[file.Path] = true
+
+		if (file.ConfigMap == nil) == (file.Secret == nil) {
+			return fmt.Errorf("config drive file %s: exactly one of configMap and secret must be set", file.Path)
+		}
+		if file.ConfigMap != nil && (file.ConfigMap.Name == "" || file.ConfigMap.Key == "") {
+			return fmt.Errorf("config drive file %s: configMap must have a name and a key", file.Path)
+		}
+		if file.Secret != nil && (file.Secret.Name == "" || file.Secret.Key == "") {
+			return fmt.Errorf("config drive file %s: secret must have a name and a key", file.Path)
+		}
+		if file.Secret != nil && !file.AllowSecretInUserData {
+			return fmt.Errorf("config drive file %s: secret needs allowSecretInUserData, since the user data can be read from the metadata service and the config drive of the instance", file.Path)
+		}
+		if file.Mode != nil && (*file.Mode < 0 || *file.Mode > 07777) {
+			return fmt.Errorf("config drive file %s: invalid mode %o", file.Path, *file.Mode)
+		}
+	}
+	return nil
+}
+
+// ignitionFile is a file added to the Ignition user data, with its
+// contents.
+type ignitionFile struct {
+	path     string
+	mode     int
+	contents []byte
+}
+
+// getConfigDriveFiles reads the contents of the config drive files from
+// their ConfigMaps and Secrets in the namespace of the machine.
+func getConfigDriveFiles(ctx context.Context, machine *machinev1.Machine, files []clients.ConfigDriveFile, kubeClient kubernetes.Interface) ([]ignitionFile, error) {
+	contents := make([]ignitionFile, 0, len(files))
+	for _, file := range files {
+		var mode int
+		var data []byte
+		switch {
+		case file.ConfigMap != nil:
+			configMap, err := kubeClient.CoreV1().ConfigMaps(machine.Namespace).Get(ctx, file.ConfigMap.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting ConfigMap %s of config drive file %s: %w", file.ConfigMap.Name, file.Path, err)
+			}
+			if value, ok := configMap.Data[file.ConfigMap.Key]; ok {
+				data = []byte(value)
+			} else if value, ok := configMap.BinaryData[file.ConfigMap.Key]; ok {
+				data = value
+			} else {
+				return nil, fmt.Errorf("ConfigMap %s of config drive file %s has no key %s", file.ConfigMap.Name, file.Path, file.ConfigMap.Key)
+			}
+			mode = configMapFileMode
+		case file.Secret != nil:
+			secret, err := kubeClient.CoreV1().Secrets(machine.Namespace).Get(ctx, file.Secret.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("error getting Secret %s of config drive file %s: %w", file.Secret.Name, file.Path, err)
+			}
+			value, ok := secret.Data[file.Secret.Key]
+			if !ok {
+				return nil, fmt.Errorf("Secret %s of config drive file %s has no key %s", file.Secret.Name, file.Path, file.Secret.Key)
+			}
+			data = value
+			mode = secretFileMode
+		}
+		if file.Mode != nil {
+			mode = *file.Mode
+		}
+		contents = append(contents, ignitionFile{path: file.Path, mode: mode, contents: data})
+	}
+	return contents, nil
+}
+
+// addIgnitionFiles adds the files to the storage of an Ignition config.
+// Files of the config with the same paths are replaced. Ignition spec 2 and
+// 3 configs are supported.
+func addIgnitionFiles(userData string, files []ignitionFile) (string, error) {
+	if len(files) == 0 {
+		return userData, nil
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(userData), &config); err != nil {
+		return "", fmt.Errorf("files can only be added to Ignition user data: %w", err)
+	}
+	ignition, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignition["version"].(string)
+	var specV2 bool
+	switch {
+	case strings.HasPrefix(version, "2."):
+		specV2 = true
+	case strings.HasPrefix(version, "3."):
+	default:
+		return "", fmt.Errorf("files can't be added to user data with Ignition version %q", version)
+	}
+
+	paths := make(map[string]bool, len(files))
+	for _, file := range files {
+		paths[file.path] = true
+	}
+
+	storage, _ := config["storage"].(map[string]interface{})
+	if storage == nil {
+		storage = make(map[string]interface{})
+		config["storage"] = storage
+	}
+	existing, _ := storage["files"].([]interface{})
+	ignitionFiles := make([]interface{}, 0, len(existing)+len(files))
+	for _, file := range existing {
+		if f, ok := file.(map[string]interface{}); ok && paths[fmt.Sprint(f["path"])] {
+			continue
+		}
+		ignitionFiles = append(ignitionFiles, file)
+	}
+
+	for _, file := range files {
+		entry := map[string]interface{}{
+			"path": file.path,
+			"mode": file.mode,
+			"contents": map[string]interface{}{
+				"source": "data:;base64," + base64.StdEncoding.EncodeToString(file.contents),
+			},
+		}
+		if specV2 {
+			entry["filesystem"] = "root"
+		} else {
+			// Files are only replaced by spec 3 if they are overwritten
+			entry["overwrite"] = true
+		}
+		ignitionFiles = append(ignitionFiles, entry)
+	}
+	storage["files"] = ignitionFiles
+
+	out, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
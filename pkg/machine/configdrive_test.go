@@ -0,0 +1,181 @@
+package machine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestValidateConfigDriveFiles(t *testing.T) {
+	configMap := &corev1.ConfigMapKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "trusted-ca"},
+		Key:                  "ca-bundle.crt",
+	}
+	secret := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "registry-auth"},
+		Key:                  "auth.json",
+	}
+
+	tests := []struct {
+		name        string
+		configDrive *bool
+		files       []clients.ConfigDriveFile
+		wantErr     bool
+	}{
+		{
+			name: "no files",
+		},
+		{
+			name:        "ConfigMap and Secret",
+			configDrive: ptr.To(true),
+			files: []clients.ConfigDriveFile{
+				{Path: "/etc/pki/ca-trust/source/anchors/ca.crt", ConfigMap: configMap},
+				{Path: "/var/lib/kubelet/config.json", Mode: ptr.To(0640), Secret: secret, AllowSecretInUserData: true},
+			},
+		},
+		{
+			name:        "Secret without allowing it in the user data",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "/var/lib/kubelet/config.json", Secret: secret}},
+			wantErr:     true,
+		},
+		{
+			name:    "without config drive",
+			files:   []clients.ConfigDriveFile{{Path: "/etc/ca.crt", ConfigMap: configMap}},
+			wantErr: true,
+		},
+		{
+			name:        "relative path",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "etc/ca.crt", ConfigMap: configMap}},
+			wantErr:     true,
+		},
+		{
+			name:        "unclean path",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "/etc/../ca.crt", ConfigMap: configMap}},
+			wantErr:     true,
+		},
+		{
+			name:        "duplicate path",
+			configDrive: ptr.To(true),
+			files: []clients.ConfigDriveFile{
+				{Path: "/etc/ca.crt", ConfigMap: configMap},
+				{Path: "/etc/ca.crt", Secret: secret},
+			},
+			wantErr: true,
+		},
+		{
+			name:        "no source",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "/etc/ca.crt"}},
+			wantErr:     true,
+		},
+		{
+			name:        "two sources",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "/etc/ca.crt", ConfigMap: configMap, Secret: secret}},
+			wantErr:     true,
+		},
+		{
+			name:        "no key",
+			configDrive: ptr.To(true),
+			files: []clients.ConfigDriveFile{{
+				Path:      "/etc/ca.crt",
+				ConfigMap: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "trusted-ca"}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:        "invalid mode",
+			configDrive: ptr.To(true),
+			files:       []clients.ConfigDriveFile{{Path: "/etc/ca.crt", Mode: ptr.To(010000), ConfigMap: configMap}},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineSpec := &machinev1alpha1.OpenstackProviderSpec{ConfigDrive: tt.configDrive}
+			err := validateConfigDriveFiles(machineSpec, tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConfigDriveFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddIgnitionFiles(t *testing.T) {
+	files := []ignitionFile{
+		{path: "/etc/pki/ca-trust/source/anchors/ca.crt", mode: 0644, contents: []byte("certificate")},
+	}
+
+	tests := []struct {
+		name     string
+		userData string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "spec 3",
+			userData: `{"ignition":{"config":{"merge":[{"source":"https://api-int.example.com:22623/config/worker"}]},"version":"3.2.0"}}`,
+			expected: `{"ignition":{"config":{"merge":[{"source":"https://api-int.example.com:22623/config/worker"}]},"version":"3.2.0"},"storage":{"files":[{"contents":{"source":"data:;base64,Y2VydGlmaWNhdGU="},"mode":420,"overwrite":true,"path":"/etc/pki/ca-trust/source/anchors/ca.crt"}]}}`,
+		},
+		{
+			name:     "spec 3 replacing a file",
+			userData: `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"path":"/etc/hostname","contents":{"source":"data:,worker"}},{"path":"/etc/pki/ca-trust/source/anchors/ca.crt","contents":{"source":"data:,old"}}]}}`,
+			expected: `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"contents":{"source":"data:,worker"},"path":"/etc/hostname"},{"contents":{"source":"data:;base64,Y2VydGlmaWNhdGU="},"mode":420,"overwrite":true,"path":"/etc/pki/ca-trust/source/anchors/ca.crt"}]}}`,
+		},
+		{
+			name:     "spec 2",
+			userData: `{"ignition":{"version":"2.2.0"}}`,
+			expected: `{"ignition":{"version":"2.2.0"},"storage":{"files":[{"contents":{"source":"data:;base64,Y2VydGlmaWNhdGU="},"filesystem":"root","mode":420,"path":"/etc/pki/ca-trust/source/anchors/ca.crt"}]}}`,
+		},
+		{
+			name:     "cloud-init",
+			userData: "#cloud-config\nhostname: worker-0\n",
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported Ignition version",
+			userData: `{"ignition":{"version":"1.0.0"}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userData, err := addIgnitionFiles(tt.userData, files)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", userData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var actual, expected interface{}
+			if err := json.Unmarshal([]byte(userData), &actual); err != nil {
+				t.Fatalf("Invalid user data %s: %v", userData, err)
+			}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatalf("Invalid expected user data: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected user data %s, got %s", tt.expected, userData)
+			}
+		})
+	}
+
+	if userData, err := addIgnitionFiles("#cloud-config\n", nil); err != nil || userData != "#cloud-config\n" {
+		t.Errorf("Expected user data to be unchanged without files, got %q, %v", userData, err)
+	}
+}
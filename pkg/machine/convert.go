@@ -5,17 +5,19 @@ import (
 	"strings"
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	configv1 "github.com/openshift/api/config/v1"
 	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
 	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
 	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
 	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
 )
 
 type instanceService interface {
 	GetServerGroupsByName(name string) ([]servergroups.ServerGroup, error)
-	CreateServerGroup(name string) (*servergroups.ServerGroup, error)
+	CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error)
 }
 
 // networkParamToCapov1PortOpts Converts a MAPO NetworkParams to an array of CAPO PortOpts
@@ -201,12 +203,21 @@ func extractDefaultTags(machine *machinev1beta1.Machine) []string {
 	return defaultTags
 }
 
+// extractServerGroupHint returns the server group from the scheduler hints, if
+// any. All other scheduler hints are passed to Nova by instanceScope.
+func extractServerGroupHint(extensions *clients.ProviderSpecExtensions) string {
+	if extensions.SchedulerHints == nil {
+		return ""
+	}
+	return extensions.SchedulerHints.Group
+}
+
 func extractImageFromProviderSpec(providerSpec *machinev1alpha1.OpenstackProviderSpec) string {
 	if providerSpec.RootVolume != nil {
-		// TODO(dulek): Installer does not populate ps.Image when ps.RootVolume is set and will instead
-		//              populate ps.RootVolume.SourceUUID. Moreover, according to the ClusterOSImage
-		//              option definition this is always the name of the image and never the UUID.
-		//              We should allow UUID at some point and this will need an update.
+		// Installer does not populate ps.Image when ps.RootVolume is set and will instead
+		// populate ps.RootVolume.SourceUUID. Despite its name it is usually the name of the
+		// image, but it may be its ID. Either is resolved to the image ID before the
+		// instance is created.
 		return providerSpec.RootVolume.SourceUUID
 	}
 	return providerSpec.Image
@@ -274,12 +285,58 @@ func portProfileToCapov1BindingProfile(portProfile map[string]string) capov1.Bin
 	return bindingProfile
 }
 
+func additionalBlockDevicesToCapov1(blockDevices []machinev1alpha1.AdditionalBlockDevice) ([]capov1.AdditionalBlockDevice, error) {
+	if blockDevices == nil {
+		return nil, nil
+	}
+
+	var capoBDType capov1.BlockDeviceType
+	var emptyStorage machinev1alpha1.BlockDeviceStorage
+	capoBlockDevices := make([]capov1.AdditionalBlockDevice, len(blockDevices))
+	for i, blockDevice := range blockDevices {
+		if blockDevice.Storage == emptyStorage {
+			return nil, fmt.Errorf("missing storage for additional block device")
+		}
+		if blockDevice.Storage.Type == machinev1alpha1.LocalBlockDevice {
+			capoBDType = capov1.LocalBlockDevice
+		} else if blockDevice.Storage.Type == machinev1alpha1.VolumeBlockDevice {
+			capoBDType = capov1.VolumeBlockDevice
+		} else {
+			return nil, fmt.Errorf("unknown block device type: %s", blockDevice.Storage.Type)
+		}
+		capoBlockDevices[i] = capov1.AdditionalBlockDevice{
+			Name:    blockDevice.Name,
+			SizeGiB: blockDevice.SizeGiB,
+			Storage: capov1.BlockDeviceStorage{Type: capoBDType},
+		}
+		if blockDevice.Storage.Volume != nil {
+			capoBlockDevices[i].Storage.Volume = &capov1.BlockDeviceVolume{
+				AvailabilityZone: blockDevice.Storage.Volume.AvailabilityZone,
+				Type:             blockDevice.Storage.Volume.Type,
+			}
+		}
+	}
+	return capoBlockDevices, nil
+}
+
 func MachineToInstanceSpec(machine *machinev1beta1.Machine, apiVIPs, ingressVIPs []string, userData string, instanceService instanceService, ignoreAddressPairs bool) (*compute.InstanceSpec, error) {
 	ps, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
 	if err != nil {
 		return nil, err
 	}
 
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityZone := machineAvailabilityZone(machine, ps)
+	metadata, err := renderServerMetadata(machine, ps.ServerMetadata, availabilityZone)
+	if err != nil {
+		return nil, err
+	}
+	metadata = addIdentityServerMetadata(machine, metadata)
+
 	instanceSpec := compute.InstanceSpec{
 		Name:           machine.Name,
 		Image:          extractImageFromProviderSpec(ps),
@@ -287,48 +344,39 @@ func MachineToInstanceSpec(machine *machinev1beta1.Machine, apiVIPs, ingressVIPs
 		Flavor:         ps.Flavor,
 		SSHKeyName:     ps.KeyName,
 		UserData:       userData,
-		Metadata:       ps.ServerMetadata,
+		Metadata:       metadata,
 		Tags:           ps.Tags,
 		ConfigDrive:    ps.ConfigDrive != nil && *ps.ConfigDrive,
-		FailureDomain:  ps.AvailabilityZone,
-		ServerGroupID:  ps.ServerGroupID,
+		FailureDomain:  availabilityZone,
+		ServerGroupID:  coalesce(ps.ServerGroupID, extractServerGroupHint(extensions)),
 		Trunk:          ps.Trunk,
 		Ports:          createCAPOPorts(ps, apiVIPs, ingressVIPs, ignoreAddressPairs),
 		SecurityGroups: securityGroupParamToCapov1SecurityGroupFilter(ps.SecurityGroups),
 	}
 
+	portDNSName, err := renderPortDNSName(machine, extensions.PortDNSName, availabilityZone)
+	if err != nil {
+		return nil, err
+	}
+	if portDNSName != "" && len(instanceSpec.Ports) > 0 {
+		instanceSpec.Ports[0].ValueSpecs = append(instanceSpec.Ports[0].ValueSpecs, capov1.ValueSpec{
+			Name:  "dns_name",
+			Key:   "dns_name",
+			Value: portDNSName,
+		})
+	}
+
 	instanceSpec.Tags = append(instanceSpec.Tags, extractDefaultTags(machine)...)
+	if uidTag := machineUIDTag(machine); uidTag != "" {
+		instanceSpec.Tags = append(instanceSpec.Tags, uidTag)
+	}
 
-	if ps.AdditionalBlockDevices != nil {
-		var capoBDType capov1.BlockDeviceType
-		var emptyStorage machinev1alpha1.BlockDeviceStorage
-		instanceSpec.AdditionalBlockDevices = make([]capov1.AdditionalBlockDevice, len(ps.AdditionalBlockDevices))
-		for i, blockDevice := range ps.AdditionalBlockDevices {
-			if blockDevice.Storage == emptyStorage {
-				return nil, fmt.Errorf("missing storage for additional block device")
-			}
-			if blockDevice.Storage.Type == machinev1alpha1.LocalBlockDevice {
-				capoBDType = capov1.LocalBlockDevice
-			} else if blockDevice.Storage.Type == machinev1alpha1.VolumeBlockDevice {
-				capoBDType = capov1.VolumeBlockDevice
-			} else {
-				return nil, fmt.Errorf("unknown block device type: %s", blockDevice.Storage.Type)
-			}
-			instanceSpec.AdditionalBlockDevices[i] = capov1.AdditionalBlockDevice{
-				Name:    blockDevice.Name,
-				SizeGiB: blockDevice.SizeGiB,
-				Storage: capov1.BlockDeviceStorage{Type: capoBDType},
-			}
-			if blockDevice.Storage.Volume != nil {
-				instanceSpec.AdditionalBlockDevices[i].Storage.Volume = &capov1.BlockDeviceVolume{
-					AvailabilityZone: blockDevice.Storage.Volume.AvailabilityZone,
-					Type:             blockDevice.Storage.Volume.Type,
-				}
-			}
-		}
+	instanceSpec.AdditionalBlockDevices, err = additionalBlockDevicesToCapov1(ps.AdditionalBlockDevices)
+	if err != nil {
+		return nil, err
 	}
 
-	if ps.ServerGroupName != "" && ps.ServerGroupID == "" {
+	if ps.ServerGroupName != "" && instanceSpec.ServerGroupID == "" {
 		// We assume that all the hard cases are covered by validation so here it's a matter of checking
 		// for existence of server group and creating it if it doesn't exist.
 		serverGroups, err := instanceService.GetServerGroupsByName(ps.ServerGroupName)
@@ -338,7 +386,7 @@ func MachineToInstanceSpec(machine *machinev1beta1.Machine, apiVIPs, ingressVIPs
 		if len(serverGroups) == 1 {
 			instanceSpec.ServerGroupID = serverGroups[0].ID
 		} else if len(serverGroups) == 0 {
-			serverGroup, err := instanceService.CreateServerGroup(ps.ServerGroupName)
+			serverGroup, err := instanceService.CreateServerGroup(ps.ServerGroupName, extensions.ServerGroupPolicy)
 			if err != nil {
 				return nil, fmt.Errorf("error when creating a server group: %v", err)
 			}
@@ -351,6 +399,28 @@ func MachineToInstanceSpec(machine *machinev1beta1.Machine, apiVIPs, ingressVIPs
 	return &instanceSpec, nil
 }
 
+// ResolvePorts returns the CAPO ports which are created for a machine with the
+// given providerSpec in a cluster with the given platform status, in the
+// order they are created. The API and ingress VIPs of the cluster are allowed
+// address pairs of the ports of networks unless the load balancer is managed
+// by the user.
+//
+// The ports are those of the providerSpec alone: fixed IPs which are only
+// determined when the machine is created, e.g. from IPAddressClaims, are not
+// included.
+func ResolvePorts(providerSpec *machinev1alpha1.OpenstackProviderSpec, platformStatus *configv1.OpenStackPlatformStatus) []capov1.PortOpts {
+	if platformStatus == nil {
+		return createCAPOPorts(providerSpec, nil, nil, false)
+	}
+	return createCAPOPorts(providerSpec, platformStatus.APIServerInternalIPs, platformStatus.IngressIPs, hasUserManagedLoadBalancer(platformStatus))
+}
+
+// hasUserManagedLoadBalancer returns true if the API and ingress VIPs of the
+// cluster are managed by the user rather than by the cluster.
+func hasUserManagedLoadBalancer(platformStatus *configv1.OpenStackPlatformStatus) bool {
+	return platformStatus.LoadBalancer != nil && platformStatus.LoadBalancer.Type == configv1.LoadBalancerTypeUserManaged
+}
+
 func createCAPOPorts(ps *machinev1alpha1.OpenstackProviderSpec, apiVIPs, ingressVIPs []string, ignoreAddressPairs bool) []capov1.PortOpts {
 	capoPorts := make([]capov1.PortOpts, 0, len(ps.Networks)+len(ps.Ports))
 
@@ -379,3 +449,11 @@ func coalesce(values ...string) string {
 	}
 	return ""
 }
+
+// machineAvailabilityZone returns the availability zone of the machine's
+// instance: the availability zone of the providerSpec or, if it is empty, the
+// zone in the Kubernetes failure domain label of the machine. This lets the
+// failure domains of machines be managed in one place.
+func machineAvailabilityZone(machine *machinev1beta1.Machine, ps *machinev1alpha1.OpenstackProviderSpec) string {
+	return coalesce(ps.AvailabilityZone, machine.Labels[corev1.LabelTopologyZone])
+}
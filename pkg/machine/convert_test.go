@@ -7,8 +7,11 @@ import (
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	configv1 "github.com/openshift/api/config/v1"
 	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
 	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/utils/ptr"
 	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
@@ -31,10 +34,10 @@ func (testInstanceService) GetServerGroupsByName(name string) ([]servergroups.Se
 	return []servergroups.ServerGroup{}, nil
 }
 
-func (testInstanceService) CreateServerGroup(name string) (*servergroups.ServerGroup, error) {
+func (testInstanceService) CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error) {
 	servergroup := servergroups.ServerGroup{
 		Name:     "fakeServerGroup",
-		Policies: []string{"soft-anti-affinity"},
+		Policies: []string{policy},
 	}
 	return &servergroup, nil
 }
@@ -471,6 +474,57 @@ func TestPortOptsToCapov1PortOpts(t *testing.T) {
 	}
 }
 
+func TestResolvePorts(t *testing.T) {
+	providerSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"}},
+		Ports:    []machinev1alpha1.PortOpts{{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", NameSuffix: "storage"}},
+	}
+	vipAddressPairs := []capov1.AddressPair{{IPAddress: "192.0.2.5"}, {IPAddress: "192.0.2.7"}}
+
+	tests := []struct {
+		name           string
+		platformStatus *configv1.OpenStackPlatformStatus
+		addressPairs   []capov1.AddressPair
+	}{
+		{
+			name:         "no platform status",
+			addressPairs: []capov1.AddressPair{},
+		},
+		{
+			name: "cluster-managed load balancer",
+			platformStatus: &configv1.OpenStackPlatformStatus{
+				APIServerInternalIPs: []string{"192.0.2.5"},
+				IngressIPs:           []string{"192.0.2.7"},
+			},
+			addressPairs: vipAddressPairs,
+		},
+		{
+			name: "user-managed load balancer",
+			platformStatus: &configv1.OpenStackPlatformStatus{
+				APIServerInternalIPs: []string{"192.0.2.5"},
+				IngressIPs:           []string{"192.0.2.7"},
+				LoadBalancer:         &configv1.OpenStackPlatformLoadBalancer{Type: configv1.LoadBalancerTypeUserManaged},
+			},
+			addressPairs: []capov1.AddressPair{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports := ResolvePorts(providerSpec, tt.platformStatus)
+			if len(ports) != 2 {
+				t.Fatalf("expected 2 ports, got %d", len(ports))
+			}
+			if !reflect.DeepEqual(ports[0].AllowedAddressPairs, tt.addressPairs) {
+				t.Errorf("expected address pairs %v, got %v", tt.addressPairs, ports[0].AllowedAddressPairs)
+			}
+			if ports[1].NameSuffix != "storage" {
+				t.Errorf("expected the port of ports to be last, got %+v", ports[1])
+			}
+		})
+	}
+}
+
 func TestSecurityGroupsToSecurityGroupParams(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -576,6 +630,37 @@ func TestMachineToInstanceSpec(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "with port tags",
+			providerSpec: &machinev1alpha1.OpenstackProviderSpec{
+				Tags: []string{"machine-tag"},
+				Ports: []machinev1alpha1.PortOpts{
+					{
+						NetworkID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b",
+						Tags:      []string{"sdn-selector"},
+					},
+				},
+			},
+			expected: &compute.InstanceSpec{
+				Ports: []capov1.PortOpts{
+					{
+						AllowedAddressPairs:  []capov1.AddressPair{},
+						FixedIPs:             []capov1.FixedIP{},
+						Network:              &capov1.NetworkFilter{ID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"},
+						SecurityGroupFilters: []capov1.SecurityGroupFilter{},
+						// The tags of the instance are added to these
+						// when the port is created
+						Tags: []string{"sdn-selector"},
+					},
+				},
+				SecurityGroups: []capov1.SecurityGroupFilter{},
+				Tags: []string{
+					"machine-tag",
+					"cluster-api-provider-openstack",
+					"-",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -691,3 +776,85 @@ func TestExtractRootVolumeFromProviderSpec(t *testing.T) {
 		}
 	})
 }
+
+func TestMachineToInstanceSpecServerGroupHint(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerSpec string
+		expected     string
+	}{
+		{
+			name:         "group hint",
+			providerSpec: `{"schedulerHints": {"group": "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"}}`,
+			expected:     "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62",
+		},
+		{
+			name:         "serverGroupID takes precedence",
+			providerSpec: `{"serverGroupID": "e7f1c8a9-3a4e-4c1b-9a0e-2d3c4b5a6f70", "schedulerHints": {"group": "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"}}`,
+			expected:     "e7f1c8a9-3a4e-4c1b-9a0e-2d3c4b5a6f70",
+		},
+		{
+			name:         "group hint is not overridden by serverGroupName",
+			providerSpec: `{"serverGroupName": "workers", "schedulerHints": {"group": "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"}}`,
+			expected:     "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := machinev1beta1.Machine{
+				Spec: machinev1beta1.MachineSpec{
+					ProviderSpec: machinev1beta1.ProviderSpec{
+						Value: &runtime.RawExtension{
+							Raw: []byte(tt.providerSpec),
+						},
+					},
+				},
+			}
+
+			actual, err := MachineToInstanceSpec(&machine, nil, nil, "", newInstanceService(), false)
+			if err != nil {
+				t.Fatalf("Expected no error, found one: %v", err)
+			}
+			if actual.ServerGroupID != tt.expected {
+				t.Errorf("Expected ServerGroupID %q, got %q", tt.expected, actual.ServerGroupID)
+			}
+		})
+	}
+}
+
+func TestMachineAvailabilityZone(t *testing.T) {
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		providerSpec *machinev1alpha1.OpenstackProviderSpec
+		expected     string
+	}{
+		{
+			name:         "providerSpec",
+			labels:       map[string]string{corev1.LabelTopologyZone: "az1"},
+			providerSpec: &machinev1alpha1.OpenstackProviderSpec{AvailabilityZone: "az0"},
+			expected:     "az0",
+		},
+		{
+			name:         "failure domain label",
+			labels:       map[string]string{corev1.LabelTopologyZone: "az1"},
+			providerSpec: &machinev1alpha1.OpenstackProviderSpec{},
+			expected:     "az1",
+		},
+		{
+			name:         "none",
+			providerSpec: &machinev1alpha1.OpenstackProviderSpec{},
+			expected:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}}
+			if actual := machineAvailabilityZone(machine, tt.providerSpec); actual != tt.expected {
+				t.Errorf("Expected availability zone %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"context"
+	"time"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// CredentialsChangedAnnotationKey is set to the time the clouds secret of a
+// machine, or the CA certificate, last changed, e.g. because its application
+// credential was rotated.
+// Setting it requeues the machine, so that it is reconciled with the new
+// credentials right away instead of after a failure.
+const CredentialsChangedAnnotationKey = "machine.openshift.io/openstack-credentials-changed"
+
+// machineCloudsSecret returns the clouds secret of the machine. A secret
+// without a namespace is in the namespace of the machine.
+func machineCloudsSecret(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec) types.NamespacedName {
+	secret := types.NamespacedName{}
+	if machineSpec.CloudsSecret != nil {
+		secret.Namespace = machineSpec.CloudsSecret.Namespace
+		secret.Name = machineSpec.CloudsSecret.Name
+	}
+	if secret.Namespace == "" {
+		secret.Namespace = machine.Namespace
+	}
+	return secret
+}
+
+// machinesUsingCloudsSecret returns the machines whose clouds secret is
+// secret. Machines whose providerSpec can't be read are skipped.
+func machinesUsingCloudsSecret(machines []machinev1.Machine, secret types.NamespacedName) []*machinev1.Machine {
+	var using []*machinev1.Machine
+	for i := range machines {
+		machine := &machines[i]
+		machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+		if err != nil || machineSpec.CloudsSecret == nil {
+			continue
+		}
+		if machineCloudsSecret(machine, machineSpec) == secret {
+			using = append(using, machine)
+		}
+	}
+	return using
+}
+
+// CloudsSecretChanged discards the shared provider clients whose cloud was
+// read from the clouds secret with the given namespace and name, and requeues
+// the machines which use it. It is called when the data of the secret is
+// updated, or the secret is deleted.
+func (oc *OpenstackClient) CloudsSecretChanged(ctx context.Context, namespace, name string) {
+	clients.DiscardProviderClients(namespace, name)
+
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines); err != nil {
+		klog.Errorf("Failed to list the machines using clouds secret %s/%s: %v", namespace, name, err)
+		return
+	}
+
+	using := machinesUsingCloudsSecret(machines.Items, types.NamespacedName{Namespace: namespace, Name: name})
+	requeued := oc.requeueMachines(ctx, using)
+	klog.Infof("Clouds secret %s/%s changed: discarded its authentications and requeued %d machines", namespace, name, requeued)
+}
+
+// CACertificateChanged discards all shared provider clients, which trust the
+// previous CA certificate, and requeues all machines. It is called when the
+// CA certificate of the cloud-provider-config ConfigMap changes.
+func (oc *OpenstackClient) CACertificateChanged(ctx context.Context) {
+	clients.DiscardAllProviderClients()
+
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines); err != nil {
+		klog.Errorf("Failed to list the machines after the CA certificate changed: %v", err)
+		return
+	}
+
+	all := make([]*machinev1.Machine, len(machines.Items))
+	for i := range machines.Items {
+		all[i] = &machines.Items[i]
+	}
+	requeued := oc.requeueMachines(ctx, all)
+	klog.Infof("CA certificate changed: discarded all authentications and requeued %d machines", requeued)
+}
+
+// requeueMachines requeues the machines by annotating them, and returns how
+// many were requeued.
+func (oc *OpenstackClient) requeueMachines(ctx context.Context, machines []*machinev1.Machine) int {
+	changed := time.Now().UTC().Format(time.RFC3339)
+	requeued := 0
+	for _, machine := range machines {
+		patch := client.MergeFrom(machine.DeepCopy())
+		if machine.Annotations == nil {
+			machine.Annotations = make(map[string]string)
+		}
+		machine.Annotations[CredentialsChangedAnnotationKey] = changed
+		if err := oc.client.Patch(ctx, machine, patch); err != nil {
+			klog.Errorf("Machine %s: failed to requeue after its credentials changed: %v", machine.Name, err)
+			continue
+		}
+		requeued++
+	}
+	return requeued
+}
@@ -0,0 +1,39 @@
+package machine
+
+import (
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMachinesUsingCloudsSecret(t *testing.T) {
+	newMachine := func(name, providerSpec string) machinev1.Machine {
+		return machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openshift-machine-api"},
+			Spec: machinev1.MachineSpec{
+				ProviderSpec: machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(providerSpec)}},
+			},
+		}
+	}
+	machines := []machinev1.Machine{
+		newMachine("secret-with-namespace", `{"cloudsSecret":{"namespace":"openshift-machine-api","name":"openstack-cloud-credentials"}}`),
+		newMachine("secret-without-namespace", `{"cloudsSecret":{"name":"openstack-cloud-credentials"}}`),
+		newMachine("other-secret", `{"cloudsSecret":{"name":"other-credentials"}}`),
+		newMachine("other-namespace", `{"cloudsSecret":{"namespace":"other","name":"openstack-cloud-credentials"}}`),
+		newMachine("no-secret", `{}`),
+		newMachine("invalid", `{"cloudsSecret":`),
+	}
+
+	using := machinesUsingCloudsSecret(machines, types.NamespacedName{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials"})
+	var names []string
+	for _, machine := range using {
+		names = append(names, machine.Name)
+	}
+	expected := []string{"secret-with-namespace", "secret-without-namespace"}
+	if len(names) != len(expected) || names[0] != expected[0] || names[1] != expected[1] {
+		t.Errorf("Expected machines %v, got %v", expected, names)
+	}
+}
@@ -0,0 +1,97 @@
+package machine
+
+import (
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// deletionRequeueAfter is how often a machine whose instance is being
+	// deleted is checked.
+	deletionRequeueAfter = 30 * time.Second
+
+	// deletionEventInterval is how often the progress of the deletion of
+	// an instance is reported in an event.
+	deletionEventInterval = 5 * time.Minute
+)
+
+// deletionStatusService is the part of the instance service used to follow
+// the deletion of instances.
+type deletionStatusService interface {
+	GetServerTaskState(serverID string) (string, error)
+	GetBaremetalProvisionState(serverID string) (string, error)
+}
+
+// deletionProgress remembers, for each machine whose instance is being
+// deleted, when its progress was last reported and whether its deletion was
+// requested again after InstanceDeleteTimeout. It isn't persisted: after a
+// restart of the controller the deletion may be requested again once more,
+// which Nova accepts for instances being deleted.
+type deletionProgress struct {
+	mu       sync.Mutex
+	machines map[types.UID]*machineDeletion
+
+	now func() time.Time
+}
+
+type machineDeletion struct {
+	lastEvent time.Time
+	reissued  bool
+}
+
+func newDeletionProgress() *deletionProgress {
+	return &deletionProgress{
+		machines: make(map[types.UID]*machineDeletion),
+		now:      time.Now,
+	}
+}
+
+func (p *deletionProgress) get(machine *machinev1.Machine) *machineDeletion {
+	deletion, ok := p.machines[machine.UID]
+	if !ok {
+		deletion = &machineDeletion{}
+		p.machines[machine.UID] = deletion
+	}
+	return deletion
+}
+
+// reportEvent returns true if the progress of the deletion of the machine's
+// instance wasn't reported for deletionEventInterval, and then expects it to
+// be reported.
+func (p *deletionProgress) reportEvent(machine *machinev1.Machine) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deletion := p.get(machine)
+	now := p.now()
+	if !deletion.lastEvent.IsZero() && now.Sub(deletion.lastEvent) < deletionEventInterval {
+		return false
+	}
+	deletion.lastEvent = now
+	return true
+}
+
+// reissue returns true the first time it is called for the machine, when the
+// deletion of its instance should be requested again.
+func (p *deletionProgress) reissue(machine *machinev1.Machine) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deletion := p.get(machine)
+	if deletion.reissued {
+		return false
+	}
+	deletion.reissued = true
+	return true
+}
+
+// forget forgets the machine once its instance is deleted.
+func (p *deletionProgress) forget(machine *machinev1.Machine) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.machines, machine.UID)
+}
@@ -0,0 +1,84 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+)
+
+type fakeDeletionStatusService struct {
+	taskState string
+}
+
+func (f *fakeDeletionStatusService) GetServerTaskState(string) (string, error) {
+	return f.taskState, nil
+}
+
+func (f *fakeDeletionStatusService) GetBaremetalProvisionState(string) (string, error) {
+	return "", nil
+}
+
+func TestCheckDeletionInProgress(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	now := time.Now()
+	deletions := newDeletionProgress()
+	deletions.now = func() time.Time { return now }
+	oc := &OpenstackClient{
+		eventRecorder: recorder,
+		params:        ActuatorParams{InstanceDeleteTimeout: time.Hour},
+		deletions:     deletions,
+	}
+	deletedAt := metav1.NewTime(now.Add(-10 * time.Minute))
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: "uid", DeletionTimestamp: &deletedAt}}
+	instanceStatus := compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: "instance"}}, logr.Discard())
+	service := &fakeDeletionStatusService{}
+
+	expectRequeue := func() {
+		t.Helper()
+		var requeue *maoMachine.RequeueAfterError
+		if err := oc.checkDeletionInProgress(machine, instanceStatus, service); !errors.As(err, &requeue) {
+			t.Fatalf("Expected a requeue, got %v", err)
+		}
+	}
+	// The deletion isn't in progress yet
+	if err := oc.checkDeletionInProgress(machine, instanceStatus, service); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Progress is reported at most every deletionEventInterval
+	service.taskState = taskStateDeleting
+	expectRequeue()
+	expectEvent(t, recorder, "Deleting")
+	expectRequeue()
+	expectNoEvent(t, recorder)
+	now = now.Add(deletionEventInterval)
+	expectRequeue()
+	expectEvent(t, recorder, "Deleting")
+
+	// After the timeout the deletion is requested again, once
+	now = now.Add(time.Hour)
+	deletedAt.Time = deletedAt.Add(-time.Hour)
+	if err := oc.checkDeletionInProgress(machine, instanceStatus, service); err != nil {
+		t.Fatalf("Expected the deletion to be requested again, got %v", err)
+	}
+	expectEvent(t, recorder, "DeleteTimeout")
+	expectRequeue()
+	expectEvent(t, recorder, "DeleteTimeout")
+	expectRequeue()
+	expectNoEvent(t, recorder)
+
+	// A deleted machine is forgotten
+	oc.deletions.forget(machine)
+	if len(oc.deletions.machines) != 0 {
+		t.Errorf("Expected the machine to be forgotten")
+	}
+}
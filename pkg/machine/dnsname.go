@@ -0,0 +1,224 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// dnsIntegrationExtension is the alias of the extension of Neutron which
+// gives ports a dns_name.
+const dnsIntegrationExtension = "dns-integration"
+
+// dnsNameService is the part of clients.InstanceService which looks up the
+// DNS names of ports and the records of the DNS service.
+type dnsNameService interface {
+	HasNetworkExtension(alias string) (bool, error)
+	ListPortsByDNSName(dnsName string) ([]clients.PortWithDNS, error)
+	GetNetworkDNSDomain(networkID string) (string, error)
+	ListDNSRecordSets(name string) ([]clients.DNSRecordSet, bool, error)
+}
+
+// machineDNSName returns the dns_name the primary port of the machine gets
+// with the DNS integration of Neutron: its portDNSName, or else the first
+// label of its hostname, which Nova gives the ports of the server.
+func machineDNSName(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) (string, error) {
+	dnsName, err := renderPortDNSName(machine, extensions.PortDNSName, machineAvailabilityZone(machine, machineSpec))
+	if err != nil || dnsName != "" {
+		return dnsName, err
+	}
+	hostname, err := machineHostname(machine, machineSpec, extensions)
+	if err != nil {
+		return "", err
+	}
+	label, _, _ := strings.Cut(hostname, ".")
+	return label, nil
+}
+
+// dnsRecordName returns the fully qualified name of the DNS records of a port
+// with the given dns_name in a network with the given dns_domain.
+func dnsRecordName(dnsName, dnsDomain string) string {
+	if strings.HasSuffix(dnsName, ".") {
+		return dnsName
+	}
+	return dnsName + "." + strings.TrimSuffix(dnsDomain, ".") + "."
+}
+
+// primaryNetworkID returns the ID of the network of the primary port, or an
+// empty string if it can't be determined before the port is created, e.g.
+// because the network is given by its subnets.
+func primaryNetworkID(scope scope.Scope, portOpts []capov1.PortOpts) (string, error) {
+	if len(portOpts) == 0 || portOpts[0].Network == nil {
+		return "", nil
+	}
+	filter := portOpts[0].Network
+	if filter.ID != "" {
+		return filter.ID, nil
+	}
+
+	networkService, err := networking.NewService(scope)
+	if err != nil {
+		return "", err
+	}
+	networkIDs, err := networkService.GetNetworkIDsByFilter(filter.ToListOpt())
+	if err != nil {
+		return "", fmt.Errorf("error getting the network of the primary port: %w", err)
+	}
+	if len(networkIDs) != 1 {
+		return "", nil
+	}
+	return networkIDs[0], nil
+}
+
+// dnsNameCollision is a port, or a recordset of the DNS service, which
+// already has the DNS name of a machine.
+type dnsNameCollision struct {
+	port      *clients.PortWithDNS
+	recordSet *clients.DNSRecordSet
+}
+
+func (c *dnsNameCollision) String() string {
+	if c.port != nil {
+		return fmt.Sprintf("port %s (%s) in network %s", c.port.Name, c.port.ID, c.port.NetworkID)
+	}
+	return fmt.Sprintf("DNS recordset %s (%s) in zone %s", c.recordSet.Name, c.recordSet.ID, c.recordSet.ZoneName)
+}
+
+// findDNSNameCollision returns what already has the DNS name dnsName of the
+// primary port of machine in the network with the given ID, or nil if
+// nothing has: a port of another machine, or of no machine, in the same
+// network or in another network with the same dns_domain, or an A or AAAA
+// recordset of the DNS service in the dns_domain of the network whose
+// addresses aren't those of the ports of machine. Ports tagged with the UID
+// of machine are its own. Nothing collides if Neutron has no DNS
+// integration.
+func findDNSNameCollision(machine *machinev1.Machine, dnsName, networkID string, service dnsNameService) (*dnsNameCollision, error) {
+	enabled, err := service.HasNetworkExtension(dnsIntegrationExtension)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for the %s extension: %w", dnsIntegrationExtension, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	portList, err := service.ListPortsByDNSName(dnsName)
+	if err != nil {
+		return nil, fmt.Errorf("error listing ports with DNS name %s: %w", dnsName, err)
+	}
+	// Designate records are only created in the dns_domain of networks
+	dnsDomain, err := service.GetNetworkDNSDomain(networkID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the DNS domain of network %s: %w", networkID, err)
+	}
+
+	uidTag := machineUIDTag(machine)
+	ownAddresses := sets.New[string]()
+	dnsDomains := map[string]string{}
+	for i := range portList {
+		port := &portList[i]
+		if port.DNSName != dnsName {
+			continue
+		}
+		if uidTag != "" && slices.Contains(port.Tags, uidTag) {
+			for _, fixedIP := range port.FixedIPs {
+				ownAddresses.Insert(fixedIP.IPAddress)
+			}
+			continue
+		}
+		if port.NetworkID == networkID {
+			return &dnsNameCollision{port: port}, nil
+		}
+
+		if dnsDomain == "" {
+			continue
+		}
+		otherDomain, ok := dnsDomains[port.NetworkID]
+		if !ok {
+			otherDomain, err = service.GetNetworkDNSDomain(port.NetworkID)
+			if err != nil {
+				return nil, fmt.Errorf("error getting the DNS domain of network %s: %w", port.NetworkID, err)
+			}
+			dnsDomains[port.NetworkID] = otherDomain
+		}
+		if otherDomain == dnsDomain {
+			return &dnsNameCollision{port: port}, nil
+		}
+	}
+	if dnsDomain == "" {
+		return nil, nil
+	}
+
+	// Records which no port has, e.g. created by hand or left behind by
+	// a deleted port, are overwritten just as well
+	recordName := dnsRecordName(dnsName, dnsDomain)
+	recordSets, ok, err := service.ListDNSRecordSets(recordName)
+	if err != nil {
+		return nil, fmt.Errorf("error listing DNS recordsets named %s: %w", recordName, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	for i := range recordSets {
+		recordSet := &recordSets[i]
+		if recordSet.Type != "A" && recordSet.Type != "AAAA" {
+			continue
+		}
+		for _, record := range recordSet.Records {
+			if !ownAddresses.Has(record) {
+				return &dnsNameCollision{recordSet: recordSet}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// checkDNSNameCollision checks that the DNS name of the primary port of the
+// machine isn't already used in its DNS domain, by a port of another machine
+// or by records of the DNS service, which the port would silently overwrite,
+// e.g. while a machine with the same name is being replaced. It returns an
+// InvalidMachineConfiguration error if it is, before any resources of the
+// machine are created.
+func (oc *OpenstackClient) checkDNSNameCollision(ctx context.Context, machine *machinev1.Machine, scope scope.Scope, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, portOpts []capov1.PortOpts) error {
+	dnsName, err := machineDNSName(machine, machineSpec, extensions)
+	if err != nil {
+		return maoMachine.InvalidMachineConfiguration("Machine validation failed: %v", err)
+	}
+	networkID, err := primaryNetworkID(scope, portOpts)
+	if err != nil {
+		return err
+	}
+	if networkID == "" {
+		klog.V(3).Infof("Machine %s: not checking DNS name %s for collisions, since the network of the primary port is not known", machine.Name, dnsName)
+		return nil
+	}
+
+	instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		return err
+	}
+	collision, err := findDNSNameCollision(machine, dnsName, networkID, instanceService)
+	if err != nil {
+		return err
+	}
+	if collision == nil {
+		return nil
+	}
+
+	klog.Warningf("Machine %s: DNS name %s is already used by %s", machine.Name, dnsName, collision)
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "DNSNameCollision",
+		"DNS name %s is already used by %s, whose DNS records would be overwritten", dnsName, collision)
+	return maoMachine.InvalidMachineConfiguration("DNS name %s is already used by %s, whose DNS records would be overwritten", dnsName, collision)
+}
@@ -0,0 +1,184 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeDNSNameService struct {
+	noDNSIntegration bool
+	ports            []clients.PortWithDNS
+	dnsDomains       map[string]string
+	recordSets       map[string][]clients.DNSRecordSet
+}
+
+func (s *fakeDNSNameService) HasNetworkExtension(alias string) (bool, error) {
+	return alias == dnsIntegrationExtension && !s.noDNSIntegration, nil
+}
+
+func (s *fakeDNSNameService) ListPortsByDNSName(dnsName string) ([]clients.PortWithDNS, error) {
+	return s.ports, nil
+}
+
+func (s *fakeDNSNameService) GetNetworkDNSDomain(networkID string) (string, error) {
+	return s.dnsDomains[networkID], nil
+}
+
+func (s *fakeDNSNameService) ListDNSRecordSets(name string) ([]clients.DNSRecordSet, bool, error) {
+	if s.recordSets == nil {
+		return nil, false, nil
+	}
+	return s.recordSets[name], true, nil
+}
+
+func TestFindDNSNameCollision(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: "machine-uid"}}
+	newPort := func(id, networkID string, tags ...string) clients.PortWithDNS {
+		return clients.PortWithDNS{Port: ports.Port{ID: id, NetworkID: networkID, Tags: tags}, DNSName: "worker-0"}
+	}
+	ownPort := newPort("own", "cluster-network", "machine-uid:machine-uid")
+	ownPort.FixedIPs = []ports.IP{{IPAddress: "10.0.0.10"}}
+	dnsDomains := map[string]string{
+		"cluster-network": "cluster.example.com.",
+		"other-network":   "cluster.example.com.",
+		"lab-network":     "lab.example.com.",
+	}
+	newRecordSets := func(recordType string, records ...string) map[string][]clients.DNSRecordSet {
+		return map[string][]clients.DNSRecordSet{
+			"worker-0.cluster.example.com.": {{ID: "recordset", Name: "worker-0.cluster.example.com.", Type: recordType, Records: records}},
+		}
+	}
+
+	tests := []struct {
+		name              string
+		service           fakeDNSNameService
+		networkID         string
+		expectedPort      string
+		expectedRecordSet string
+	}{
+		{
+			name:      "no other port",
+			service:   fakeDNSNameService{ports: []clients.PortWithDNS{ownPort}},
+			networkID: "cluster-network",
+		},
+		{
+			name:         "port of a replaced machine in the same network",
+			service:      fakeDNSNameService{ports: []clients.PortWithDNS{ownPort, newPort("replaced", "cluster-network", "machine-uid:replaced-uid")}},
+			networkID:    "cluster-network",
+			expectedPort: "replaced",
+		},
+		{
+			name:         "port in a network with the same DNS domain",
+			service:      fakeDNSNameService{ports: []clients.PortWithDNS{newPort("other", "other-network")}},
+			networkID:    "cluster-network",
+			expectedPort: "other",
+		},
+		{
+			name:      "port in a network with another DNS domain",
+			service:   fakeDNSNameService{ports: []clients.PortWithDNS{newPort("lab", "lab-network")}},
+			networkID: "cluster-network",
+		},
+		{
+			name:      "network without DNS domain",
+			service:   fakeDNSNameService{ports: []clients.PortWithDNS{newPort("other", "other-network")}},
+			networkID: "tenant-network",
+		},
+		{
+			name:      "no DNS integration",
+			service:   fakeDNSNameService{noDNSIntegration: true, ports: []clients.PortWithDNS{newPort("replaced", "cluster-network")}},
+			networkID: "cluster-network",
+		},
+		{
+			name:              "DNS record of no port",
+			service:           fakeDNSNameService{recordSets: newRecordSets("A", "10.0.0.20")},
+			networkID:         "cluster-network",
+			expectedRecordSet: "recordset",
+		},
+		{
+			name:      "DNS record of the machine's own port",
+			service:   fakeDNSNameService{ports: []clients.PortWithDNS{ownPort}, recordSets: newRecordSets("A", "10.0.0.10")},
+			networkID: "cluster-network",
+		},
+		{
+			name:      "DNS record of another type",
+			service:   fakeDNSNameService{recordSets: newRecordSets("TXT", "text")},
+			networkID: "cluster-network",
+		},
+		{
+			name:      "DNS record in a network without DNS domain",
+			service:   fakeDNSNameService{recordSets: newRecordSets("A", "10.0.0.20")},
+			networkID: "tenant-network",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tt.service
+			service.dnsDomains = dnsDomains
+			collision, err := findDNSNameCollision(machine, "worker-0", tt.networkID, &service)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var portID, recordSetID string
+			if collision != nil && collision.port != nil {
+				portID = collision.port.ID
+			}
+			if collision != nil && collision.recordSet != nil {
+				recordSetID = collision.recordSet.ID
+			}
+			if portID != tt.expectedPort || recordSetID != tt.expectedRecordSet {
+				t.Errorf("Expected collision with port %q and recordset %q, got %v", tt.expectedPort, tt.expectedRecordSet, collision)
+			}
+		})
+	}
+}
+
+func TestMachineDNSName(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+
+	tests := []struct {
+		name       string
+		extensions clients.ProviderSpecExtensions
+		expected   string
+	}{
+		{
+			name:     "machine name",
+			expected: "worker-0",
+		},
+		{
+			name:       "hostname",
+			extensions: clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}.example.com"},
+			expected:   "worker-0",
+		},
+		{
+			name:       "port DNS name",
+			extensions: clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}.example.com", PortDNSName: "{{ .MachineName }}-{{ .AZ }}"},
+			expected:   "worker-0-az1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dnsName, err := machineDNSName(machine, &machinev1alpha1.OpenstackProviderSpec{AvailabilityZone: "az1"}, &tt.extensions)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dnsName != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, dnsName)
+			}
+		})
+	}
+
+	for dnsName, expected := range map[string]string{
+		"worker-0":                      "worker-0.cluster.example.com.",
+		"worker-0.cluster.example.com.": "worker-0.cluster.example.com.",
+	} {
+		if name := dnsRecordName(dnsName, "cluster.example.com."); name != expected {
+			t.Errorf("Expected the record name of %s to be %s, got %s", dnsName, expected, name)
+		}
+	}
+}
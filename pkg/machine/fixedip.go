@@ -0,0 +1,95 @@
+package machine
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// validateFixedIP checks that the fixed IP of the primary port is an IP
+// address.
+func validateFixedIP(address string) error {
+	if address != "" && net.ParseIP(address) == nil {
+		return fmt.Errorf("fixedIP %q is not an IP address", address)
+	}
+	return nil
+}
+
+// setPrimaryFixedIP requests address as a fixed IP of the primary port. Like
+// setPortAddress, it is used for the first fixed IP which doesn't already
+// have an address. The address must be in the subnet selected for that fixed
+// IP or, if no subnet is selected, in a subnet of the network of the port,
+// which is then selected.
+func setPrimaryFixedIP(scope scope.Scope, ports []capov1.PortOpts, address string) error {
+	if address == "" {
+		return nil
+	}
+	if len(ports) == 0 {
+		return maoMachine.InvalidMachineConfiguration("fixedIP %s: the machine has no ports", address)
+	}
+
+	port := &ports[0]
+	index := 0
+	for index < len(port.FixedIPs) && port.FixedIPs[index].IPAddress != "" {
+		index++
+	}
+	if index == len(port.FixedIPs) {
+		port.FixedIPs = append(port.FixedIPs, capov1.FixedIP{})
+	}
+	fixedIP := &port.FixedIPs[index]
+
+	networkService, err := networking.NewService(scope)
+	if err != nil {
+		return err
+	}
+
+	var candidates []subnets.Subnet
+	switch {
+	case fixedIP.Subnet != nil:
+		var subnet *subnets.Subnet
+		if port.Network != nil && port.Network.ID != "" {
+			subnet, err = networkService.GetNetworkSubnetByFilter(port.Network.ID, fixedIP.Subnet)
+		} else {
+			subnet, err = networkService.GetSubnetByFilter(fixedIP.Subnet)
+		}
+		if err != nil {
+			return fmt.Errorf("fixedIP %s: error getting the subnet of the primary port: %w", address, err)
+		}
+		candidates = []subnets.Subnet{*subnet}
+	case port.Network != nil && port.Network.ID != "":
+		candidates, err = networkService.GetSubnetsByFilter(subnets.ListOpts{NetworkID: port.Network.ID})
+		if err != nil {
+			return fmt.Errorf("fixedIP %s: error listing the subnets of network %s: %w", address, port.Network.ID, err)
+		}
+	default:
+		return maoMachine.InvalidMachineConfiguration("fixedIP %s: the primary port must have a subnet, or a network given by ID", address)
+	}
+
+	subnet := subnetContaining(candidates, address)
+	if subnet == nil {
+		return maoMachine.InvalidMachineConfiguration("fixedIP %s is not in the subnet of the primary port", address)
+	}
+
+	fixedIP.IPAddress = address
+	if fixedIP.Subnet == nil {
+		fixedIP.Subnet = &capov1.SubnetFilter{ID: subnet.ID}
+	}
+	return nil
+}
+
+// subnetContaining returns the subnet whose CIDR contains address, if any.
+func subnetContaining(subnetList []subnets.Subnet, address string) *subnets.Subnet {
+	ip := net.ParseIP(address)
+	for i := range subnetList {
+		_, cidr, err := net.ParseCIDR(subnetList[i].CIDR)
+		if err == nil && cidr.Contains(ip) {
+			return &subnetList[i]
+		}
+	}
+	return nil
+}
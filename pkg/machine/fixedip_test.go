@@ -0,0 +1,98 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	. "github.com/onsi/gomega"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestSetPrimaryFixedIP(t *testing.T) {
+	const (
+		networkID = "1e6c8a4f-2b3d-4c5e-9f7a-0b1c2d3e4f5a"
+		subnetID  = "7b9d1f3a-5c6e-4a8b-8d0f-2e4a6c8b0d1f"
+		subnetID6 = "4f6a8c0e-2b4d-4e6f-8a0c-1d3f5b7d9e2a"
+	)
+	subnet := subnets.Subnet{ID: subnetID, NetworkID: networkID, CIDR: "192.0.2.0/24"}
+	subnet6 := subnets.Subnet{ID: subnetID6, NetworkID: networkID, CIDR: "2001:db8::/64"}
+
+	tests := []struct {
+		name     string
+		ports    []capov1.PortOpts
+		address  string
+		expect   func(m *scope.MockScopeFactory)
+		expected []capov1.FixedIP
+		wantErr  bool
+	}{
+		{
+			name:    "address in the subnet of the primary port",
+			ports:   []capov1.PortOpts{{Network: &capov1.NetworkFilter{ID: networkID}, FixedIPs: []capov1.FixedIP{{Subnet: &capov1.SubnetFilter{ID: subnetID}}}}},
+			address: "192.0.2.10",
+			expect: func(m *scope.MockScopeFactory) {
+				m.NetworkClient.EXPECT().GetSubnet(subnetID).Return(&subnet, nil)
+			},
+			expected: []capov1.FixedIP{{Subnet: &capov1.SubnetFilter{ID: subnetID}, IPAddress: "192.0.2.10"}},
+		},
+		{
+			name:    "address outside the subnet of the primary port",
+			ports:   []capov1.PortOpts{{Network: &capov1.NetworkFilter{ID: networkID}, FixedIPs: []capov1.FixedIP{{Subnet: &capov1.SubnetFilter{ID: subnetID}}}}},
+			address: "198.51.100.10",
+			expect: func(m *scope.MockScopeFactory) {
+				m.NetworkClient.EXPECT().GetSubnet(subnetID).Return(&subnet, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "subnet selected from the network of the primary port",
+			ports:   []capov1.PortOpts{{Network: &capov1.NetworkFilter{ID: networkID}}},
+			address: "2001:db8::10",
+			expect: func(m *scope.MockScopeFactory) {
+				m.NetworkClient.EXPECT().ListSubnet(subnets.ListOpts{NetworkID: networkID}).Return([]subnets.Subnet{subnet, subnet6}, nil)
+			},
+			expected: []capov1.FixedIP{{Subnet: &capov1.SubnetFilter{ID: subnetID6}, IPAddress: "2001:db8::10"}},
+		},
+		{
+			name:    "primary port without a subnet or a network ID",
+			ports:   []capov1.PortOpts{{Network: &capov1.NetworkFilter{Name: "machines"}}},
+			address: "192.0.2.10",
+			wantErr: true,
+		},
+		{
+			name:    "no ports",
+			address: "192.0.2.10",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			if tt.expect != nil {
+				tt.expect(mockScopeFactory)
+			}
+
+			err := setPrimaryFixedIP(mockScopeFactory, tt.ports, tt.address)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(tt.ports[0].FixedIPs).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestValidateFixedIP(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(validateFixedIP("")).To(Succeed())
+	g.Expect(validateFixedIP("192.0.2.10")).To(Succeed())
+	g.Expect(validateFixedIP("2001:db8::10")).To(Succeed())
+	g.Expect(validateFixedIP("192.0.2.0/24")).NotTo(Succeed())
+}
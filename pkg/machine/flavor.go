@@ -0,0 +1,30 @@
+package machine
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+)
+
+// flavorService is the part of clients.InstanceService which looks up
+// flavors.
+type flavorService interface {
+	GetFlavorID(flavorName string) (string, error)
+	GetFlavorInfo(flavorID string) (*flavors.Flavor, error)
+	GetFlavorExtraSpecs(flavorID string) (map[string]string, error)
+}
+
+// getFlavor returns the flavor with the given name and its extra specs.
+func getFlavor(flavorName string, service flavorService) (*flavors.Flavor, map[string]string, error) {
+	flavorID, err := service.GetFlavorID(flavorName)
+	if err != nil {
+		return nil, nil, err
+	}
+	flavor, err := service.GetFlavorInfo(flavorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraSpecs, err := service.GetFlavorExtraSpecs(flavorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return flavor, extraSpecs, nil
+}
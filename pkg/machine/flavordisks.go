@@ -0,0 +1,108 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// guestFormatSwap is the guest format of swap disks.
+const guestFormatSwap = "swap"
+
+// validateFlavorDisks checks that the flavor has the disks which are
+// configured. Local additional block devices are ephemeral disks too, and
+// Nova only allows them to add up to the ephemeral disk of the flavor, so
+// they can't be combined with a configured ephemeral disk.
+func validateFlavorDisks(machineSpec *machinev1alpha1.OpenstackProviderSpec, flavorDisks *clients.FlavorDisks, flavor *flavors.Flavor) error {
+	if flavorDisks == nil {
+		return nil
+	}
+
+	if ephemeral := flavorDisks.Ephemeral; ephemeral != nil {
+		if flavor.Ephemeral == 0 {
+			return fmt.Errorf("flavor %s has no ephemeral disk", flavor.Name)
+		}
+		if ephemeral.GuestFormat == guestFormatSwap {
+			return fmt.Errorf("the ephemeral disk can't have guest format %s", guestFormatSwap)
+		}
+		for _, blockDevice := range machineSpec.AdditionalBlockDevices {
+			if blockDevice.Storage.Type == machinev1alpha1.LocalBlockDevice {
+				return fmt.Errorf("the ephemeral disk of the flavor can't be configured together with local additional block device %s", blockDevice.Name)
+			}
+		}
+	}
+
+	if swap := flavorDisks.Swap; swap != nil {
+		if flavor.Swap == 0 {
+			return fmt.Errorf("flavor %s has no swap", flavor.Name)
+		}
+		if swap.GuestFormat != "" && swap.GuestFormat != guestFormatSwap {
+			return fmt.Errorf("the swap disk can't have guest format %s", swap.GuestFormat)
+		}
+	}
+	return nil
+}
+
+// flavorDiskBlockDevices returns the block device mappings of the configured
+// disks of the flavor. Nova only adds the ephemeral and swap disks of the
+// flavor to a server whose block device mappings have none, so a mapping
+// replaces the disk of the flavor, and a mapping without a device disables
+// it.
+func flavorDiskBlockDevices(flavorDisks *clients.FlavorDisks, flavor *flavors.Flavor) []map[string]interface{} {
+	if flavorDisks == nil {
+		return nil
+	}
+
+	var blockDevices []map[string]interface{}
+	if ephemeral := flavorDisks.Ephemeral; ephemeral != nil {
+		blockDevices = append(blockDevices, flavorDiskBlockDevice(ephemeral, ephemeral.GuestFormat, flavor.Ephemeral))
+	}
+	// The size of swap is in MiB
+	if swap := flavorDisks.Swap; swap != nil {
+		blockDevices = append(blockDevices, flavorDiskBlockDevice(swap, guestFormatSwap, flavor.Swap))
+	}
+	return blockDevices
+}
+
+func flavorDiskBlockDevice(disk *clients.FlavorDisk, guestFormat string, size int) map[string]interface{} {
+	blockDevice := map[string]interface{}{
+		"source_type":           "blank",
+		"destination_type":      "local",
+		"boot_index":            -1,
+		"delete_on_termination": true,
+	}
+	if guestFormat != "" {
+		blockDevice["guest_format"] = guestFormat
+	}
+	if disk.Disabled {
+		blockDevice["no_device"] = true
+	} else {
+		blockDevice["volume_size"] = size
+	}
+	return blockDevice
+}
+
+// blockDeviceCreateOpts adds block device mappings to a server create
+// request, after those which were already added to it, e.g. for the root
+// volume and the additional block devices.
+type blockDeviceCreateOpts struct {
+	servers.CreateOptsBuilder
+	blockDevices []map[string]interface{}
+}
+
+func (opts blockDeviceCreateOpts) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	server, _ := base["server"].(map[string]interface{})
+	blockDevices, _ := server["block_device_mapping_v2"].([]map[string]interface{})
+	server["block_device_mapping_v2"] = append(blockDevices, opts.blockDevices...)
+
+	return base, nil
+}
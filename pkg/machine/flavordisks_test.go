@@ -0,0 +1,155 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/bootfromvolume"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestValidateFlavorDisks(t *testing.T) {
+	withDisks := &flavors.Flavor{Name: "m1.nvme", Ephemeral: 100, Swap: 2048}
+	withoutDisks := &flavors.Flavor{Name: "m1.large"}
+	localBlockDevice := machinev1alpha1.AdditionalBlockDevice{
+		Name:    "scratch",
+		SizeGiB: 10,
+		Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.LocalBlockDevice},
+	}
+
+	tests := []struct {
+		name        string
+		flavorDisks *clients.FlavorDisks
+		flavor      *flavors.Flavor
+		blockDevice *machinev1alpha1.AdditionalBlockDevice
+		wantErr     bool
+	}{
+		{
+			name:   "not configured",
+			flavor: withoutDisks,
+		},
+		{
+			name: "ephemeral and swap",
+			flavorDisks: &clients.FlavorDisks{
+				Ephemeral: &clients.FlavorDisk{GuestFormat: "xfs"},
+				Swap:      &clients.FlavorDisk{Disabled: true},
+			},
+			flavor: withDisks,
+		},
+		{
+			name:        "flavor without ephemeral disk",
+			flavorDisks: &clients.FlavorDisks{Ephemeral: &clients.FlavorDisk{GuestFormat: "xfs"}},
+			flavor:      withoutDisks,
+			wantErr:     true,
+		},
+		{
+			name:        "flavor without swap",
+			flavorDisks: &clients.FlavorDisks{Swap: &clients.FlavorDisk{}},
+			flavor:      withoutDisks,
+			wantErr:     true,
+		},
+		{
+			name:        "ephemeral disk formatted as swap",
+			flavorDisks: &clients.FlavorDisks{Ephemeral: &clients.FlavorDisk{GuestFormat: "swap"}},
+			flavor:      withDisks,
+			wantErr:     true,
+		},
+		{
+			name:        "swap with a file system",
+			flavorDisks: &clients.FlavorDisks{Swap: &clients.FlavorDisk{GuestFormat: "ext4"}},
+			flavor:      withDisks,
+			wantErr:     true,
+		},
+		{
+			name:        "ephemeral disk with local block devices",
+			flavorDisks: &clients.FlavorDisks{Ephemeral: &clients.FlavorDisk{GuestFormat: "xfs"}},
+			flavor:      withDisks,
+			blockDevice: &localBlockDevice,
+			wantErr:     true,
+		},
+		{
+			name:        "swap with local block devices",
+			flavorDisks: &clients.FlavorDisks{Swap: &clients.FlavorDisk{Disabled: true}},
+			flavor:      withDisks,
+			blockDevice: &localBlockDevice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineSpec := &machinev1alpha1.OpenstackProviderSpec{}
+			if tt.blockDevice != nil {
+				machineSpec.AdditionalBlockDevices = []machinev1alpha1.AdditionalBlockDevice{*tt.blockDevice}
+			}
+			err := validateFlavorDisks(machineSpec, tt.flavorDisks, tt.flavor)
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected an error")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBlockDeviceCreateOpts(t *testing.T) {
+	flavor := &flavors.Flavor{Ephemeral: 100, Swap: 2048}
+	flavorDisks := &clients.FlavorDisks{
+		Ephemeral: &clients.FlavorDisk{GuestFormat: "xfs"},
+		Swap:      &clients.FlavorDisk{Disabled: true},
+	}
+
+	var createOpts servers.CreateOptsBuilder = servers.CreateOpts{
+		Name:      "test",
+		FlavorRef: "flavor",
+	}
+	createOpts = bootfromvolume.CreateOptsExt{
+		CreateOptsBuilder: createOpts,
+		BlockDevice: []bootfromvolume.BlockDevice{{
+			SourceType:          bootfromvolume.SourceImage,
+			DestinationType:     bootfromvolume.DestinationLocal,
+			UUID:                "image-id",
+			DeleteOnTermination: true,
+		}},
+	}
+	createOpts = blockDeviceCreateOpts{
+		CreateOptsBuilder: createOpts,
+		blockDevices:      flavorDiskBlockDevices(flavorDisks, flavor),
+	}
+
+	body, err := createOpts.ToServerCreateMap()
+	if err != nil {
+		t.Fatalf("Expected no error, found one: %v", err)
+	}
+
+	// The block devices are added after the image
+	expected := []map[string]interface{}{
+		{
+			"source_type":           "blank",
+			"destination_type":      "local",
+			"boot_index":            -1,
+			"delete_on_termination": true,
+			"guest_format":          "xfs",
+			"volume_size":           100,
+		},
+		{
+			"source_type":           "blank",
+			"destination_type":      "local",
+			"boot_index":            -1,
+			"delete_on_termination": true,
+			"guest_format":          "swap",
+			"no_device":             true,
+		},
+	}
+	server := body["server"].(map[string]interface{})
+	blockDevices := server["block_device_mapping_v2"].([]map[string]interface{})
+	if len(blockDevices) != 3 || blockDevices[0]["uuid"] != "image-id" {
+		t.Fatalf("Expected the image and 2 block device mappings, got %v", blockDevices)
+	}
+	if actual := blockDevices[1:]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected block device mappings %v, got %v", expected, actual)
+	}
+}
@@ -0,0 +1,125 @@
+package machine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// FlavorLabelsAnnotationKey is set on a machine once its node was labelled
+// with the allowlisted extra specs of the flavor of its instance. Its value
+// identifies the instance and the allowlist, so that the flavor of the
+// instance is only looked up again when either changes.
+const FlavorLabelsAnnotationKey = "machine.openshift.io/openstack-flavor-labels"
+
+// validateFlavorExtraSpecLabels checks that the extra specs are mapped to
+// valid label keys.
+func validateFlavorExtraSpecLabels(flavorExtraSpecLabels map[string]string) error {
+	for extraSpec, labelKey := range flavorExtraSpecLabels {
+		if msgs := validation.IsQualifiedName(labelKey); len(msgs) > 0 {
+			return fmt.Errorf("flavor extra spec %s: invalid label key %q: %s", extraSpec, labelKey, strings.Join(msgs, "; "))
+		}
+	}
+	return nil
+}
+
+// serverFlavorExtraSpecs returns the extra specs of the flavor of the server
+// as it was when the server was created. Nova embeds them in the server since
+// microversion 2.47.
+func serverFlavorExtraSpecs(server *capoclients.ServerExt) map[string]string {
+	extraSpecs, _ := server.Flavor["extra_specs"].(map[string]interface{})
+
+	specs := make(map[string]string, len(extraSpecs))
+	for key, value := range extraSpecs {
+		if s, ok := value.(string); ok {
+			specs[key] = s
+		}
+	}
+	return specs
+}
+
+// flavorLabels returns the node labels of the allowlisted extra specs, and the
+// allowlisted extra specs whose values can't be label values.
+func flavorLabels(flavorExtraSpecLabels, extraSpecs map[string]string) (map[string]string, []string) {
+	labels := make(map[string]string)
+	var invalid []string
+	for extraSpec, labelKey := range flavorExtraSpecLabels {
+		value, ok := extraSpecs[extraSpec]
+		if !ok {
+			continue
+		}
+		if len(validation.IsValidLabelValue(value)) > 0 {
+			invalid = append(invalid, extraSpec)
+			continue
+		}
+		labels[labelKey] = value
+	}
+	sort.Strings(invalid)
+	return labels, invalid
+}
+
+// flavorLabelsMarker returns the value of FlavorLabelsAnnotationKey for the
+// instance with the given ID and the allowlisted extra specs.
+func flavorLabelsMarker(instanceID string, flavorExtraSpecLabels map[string]string) (string, error) {
+	// The keys of maps are marshalled in order
+	allowlist, err := json.Marshal(flavorExtraSpecLabels)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(allowlist)
+	return instanceID + "/" + hex.EncodeToString(sum[:8]), nil
+}
+
+// setFlavorLabels labels the node of the machine with the allowlisted extra
+// specs of the flavor of its instance. Labels in the machine spec are
+// propagated to the node by the Machine API. The extra specs are those of
+// the flavor when the instance was created, so they are only looked up once
+// per instance and allowlist.
+func setFlavorLabels(machine *machinev1.Machine, flavorExtraSpecLabels map[string]string, instanceStatus *compute.InstanceStatus, scope scope.Scope) error {
+	if len(flavorExtraSpecLabels) == 0 {
+		return nil
+	}
+	marker, err := flavorLabelsMarker(instanceStatus.ID(), flavorExtraSpecLabels)
+	if err != nil {
+		return err
+	}
+	if machine.Annotations[FlavorLabelsAnnotationKey] == marker {
+		return nil
+	}
+
+	computeClient, err := scope.NewComputeClient()
+	if err != nil {
+		return err
+	}
+	server, err := computeClient.GetServer(instanceStatus.ID())
+	if err != nil {
+		return fmt.Errorf("error getting instance %s: %w", instanceStatus.ID(), err)
+	}
+
+	labels, invalid := flavorLabels(flavorExtraSpecLabels, serverFlavorExtraSpecs(server))
+	if len(invalid) > 0 {
+		capoRecorder.Warnf(machine, "InvalidFlavorLabel", "Values of flavor extra specs %v are not valid label values", invalid)
+	}
+	if len(labels) > 0 && machine.Spec.Labels == nil {
+		machine.Spec.Labels = make(map[string]string)
+	}
+	for key, value := range labels {
+		machine.Spec.Labels[key] = value
+	}
+
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[FlavorLabelsAnnotationKey] = marker
+	return nil
+}
@@ -0,0 +1,102 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestValidateFlavorExtraSpecLabels(t *testing.T) {
+	if err := validateFlavorExtraSpecLabels(map[string]string{"hw:cpu_policy": "node.openshift.io/cpu-policy"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateFlavorExtraSpecLabels(map[string]string{"hw:cpu_policy": "hw:cpu_policy"}); err == nil {
+		t.Errorf("expected an error for an invalid label key")
+	}
+}
+
+func TestSetFlavorLabels(t *testing.T) {
+	const instanceID = "8d2f4b6a-1c3e-4a5b-9d7f-0e2a4c6b8d1f"
+
+	flavorExtraSpecLabels := map[string]string{
+		"hw:cpu_policy":                         "node.openshift.io/cpu-policy",
+		"hw:mem_page_size":                      "node.openshift.io/mem-page-size",
+		"aggregate_instance_extra_specs:pinned": "node.openshift.io/pinned",
+	}
+
+	tests := []struct {
+		name       string
+		extraSpecs map[string]interface{}
+		want       map[string]string
+	}{
+		{
+			name: "allowlisted extra specs",
+			extraSpecs: map[string]interface{}{
+				"hw:cpu_policy":    "dedicated",
+				"hw:mem_page_size": "large",
+				"hw:numa_nodes":    "1",
+			},
+			want: map[string]string{
+				"existing":                        "label",
+				"node.openshift.io/cpu-policy":    "dedicated",
+				"node.openshift.io/mem-page-size": "large",
+			},
+		},
+		{
+			name: "invalid label value",
+			extraSpecs: map[string]interface{}{
+				"hw:cpu_policy":                         "dedicated",
+				"aggregate_instance_extra_specs:pinned": "not a label value",
+			},
+			want: map[string]string{
+				"existing":                     "label",
+				"node.openshift.io/cpu-policy": "dedicated",
+			},
+		},
+		{
+			name: "no extra specs",
+			want: map[string]string{
+				"existing": "label",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			server := &capoclients.ServerExt{Server: servers.Server{ID: instanceID}}
+			if tt.extraSpecs != nil {
+				server.Flavor = map[string]interface{}{"original_name": "m1.pinned", "extra_specs": tt.extraSpecs}
+			}
+			mockScopeFactory.ComputeClient.EXPECT().GetServer(instanceID).Return(server, nil)
+
+			machine := &machinev1beta1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+				Spec: machinev1beta1.MachineSpec{
+					ObjectMeta: machinev1beta1.ObjectMeta{Labels: map[string]string{"existing": "label"}},
+				},
+			}
+			instanceStatus := compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID}}, logr.Discard())
+
+			if err := setFlavorLabels(machine, flavorExtraSpecLabels, instanceStatus, mockScopeFactory); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(machine.Spec.Labels, tt.want) {
+				t.Errorf("expected labels %v, got %v", tt.want, machine.Spec.Labels)
+			}
+
+			// The flavor of the instance is only looked up once
+			if err := setFlavorLabels(machine, flavorExtraSpecLabels, instanceStatus, mockScopeFactory); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"k8s.io/utils/ptr"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// FloatingIPsAllocatedCondition is false while a floating IP requested for a
+// machine can't be allocated because the floating IP quota of the project is
+// exceeded.
+const FloatingIPsAllocatedCondition machinev1.ConditionType = "FloatingIPsAllocated"
+
+// floatingIPQuotaRequeueAfter is how often we retry allocating a floating IP
+// after the floating IP quota was exceeded. Floating IPs are released and
+// quotas increased by people, so there is no point retrying often.
+const floatingIPQuotaRequeueAfter = 5 * time.Minute
+
+// floatingIPRequests returns all the floating IPs requested for the machine.
+// floatingIP is associated with the primary port.
+func floatingIPRequests(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) []clients.FloatingIPRequest {
+	var requests []clients.FloatingIPRequest
+	if machineSpec.FloatingIP != "" {
+		requests = append(requests, clients.FloatingIPRequest{Address: machineSpec.FloatingIP})
+	}
+	requests = append(requests, extensions.FloatingIPs...)
+
+	for i := range requests {
+		if requests[i].Network == "" {
+			requests[i].Network = extensions.FloatingIPNetwork
+		}
+	}
+	return requests
+}
+
+// validateFloatingIPRequests returns an error if a floating IP request is
+// invalid.
+func validateFloatingIPRequests(requests []clients.FloatingIPRequest) error {
+	for i, request := range requests {
+		if request.Address == "" && request.Network == "" {
+			return fmt.Errorf("floating IP %d has neither an address nor a network to allocate it from", i)
+		}
+		if request.PortIndex < 0 {
+			return fmt.Errorf("floating IP %d has negative port index %d", i, request.PortIndex)
+		}
+	}
+	return nil
+}
+
+// allocatedFloatingIPDescription is the description of the floating IPs
+// allocated for the machine, by which they are found.
+func allocatedFloatingIPDescription(machine *machinev1.Machine) string {
+	return fmt.Sprintf("Created by machine-api-provider-openstack for machine %s/%s of cluster %s",
+		machine.Namespace, machine.Name, machine.Labels[machinev1.MachineClusterIDLabel])
+}
+
+// requestedFloatingIPDescription is the description of the floating IPs
+// created with the address requested for the machine. It differs from
+// allocatedFloatingIPDescription so that they are not always deleted with the
+// machine.
+func requestedFloatingIPDescription(machine *machinev1.Machine) string {
+	return fmt.Sprintf("Created by machine-api-provider-openstack with the address requested by machine %s/%s of cluster %s",
+		machine.Namespace, machine.Name, machine.Labels[machinev1.MachineClusterIDLabel])
+}
+
+// floatingIPTags returns the tags of the floating IPs created for the machine:
+// the default tags of its instance, and the name of the machine.
+func floatingIPTags(machine *machinev1.Machine) []string {
+	return append(extractDefaultTags(machine), "machine:"+machine.Name)
+}
+
+// floatingIPNetworkClient is the part of the network client used to
+// associate floating IPs with the ports of instances.
+type floatingIPNetworkClient interface {
+	ListPort(opts ports.ListOptsBuilder) ([]ports.Port, error)
+	ListNetwork(opts networks.ListOptsBuilder) ([]networks.Network, error)
+	ListFloatingIP(opts floatingips.ListOptsBuilder) ([]floatingips.FloatingIP, error)
+	CreateFloatingIP(opts floatingips.CreateOptsBuilder) (*floatingips.FloatingIP, error)
+	UpdateFloatingIP(id string, opts floatingips.UpdateOptsBuilder) (*floatingips.FloatingIP, error)
+	ReplaceAllAttributesTags(resourceType string, resourceID string, opts attributestags.ReplaceAllOptsBuilder) ([]string, error)
+}
+
+// reconcileFloatingIPs associates all the floating IPs requested for the
+// machine with their ports, allocating them if they don't exist. It returns a
+// RequeueAfterError if any of them had to be associated.
+func reconcileFloatingIPs(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus, scope scope.Scope) error {
+	requests := floatingIPRequests(machineSpec, extensions)
+	if len(requests) == 0 {
+		return nil
+	}
+
+	networkClient, err := scope.NewNetworkClient()
+	if err != nil {
+		return err
+	}
+	return associateFloatingIPs(machine, machineSpec, requests, instanceStatus.ID(), networkClient)
+}
+
+// associateFloatingIPs associates the requested floating IPs with the ports of
+// the instance with instanceID, allocating them if they don't exist. It
+// returns a RequeueAfterError if any of them had to be associated.
+func associateFloatingIPs(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, requests []clients.FloatingIPRequest, instanceID string, networkClient floatingIPNetworkClient) error {
+	instancePorts, err := networkClient.ListPort(ports.ListOpts{DeviceID: instanceID})
+	if err != nil {
+		return fmt.Errorf("list ports of instance err: %v", err)
+	}
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+
+	var associated bool
+	for i, request := range requests {
+		var port *ports.Port
+		var fixedIP string
+		if request.PortIndex == 0 && request.SubnetID == "" {
+			port, fixedIP, err = selectManagementPortFixedIP(machine.Name, machineSpec.PrimarySubnet, portOpts, instancePorts)
+		} else {
+			port, fixedIP, err = selectPortFixedIP(machine.Name, portOpts, instancePorts, request.PortIndex, request.SubnetID)
+		}
+		if err != nil {
+			return maoMachine.InvalidMachineConfiguration("floating IP %d: %v", i, err)
+		}
+		// Neutron only supports IPv4 floating IPs
+		if !isIPv4(fixedIP) {
+			return maoMachine.InvalidMachineConfiguration("floating IP %d: fixed IP %s of port %s is not an IPv4 address", i, fixedIP, port.Name)
+		}
+
+		var fp *floatingips.FloatingIP
+		if request.Address != "" {
+			fp, err = getFloatingIP(networkClient, request.Address)
+		} else {
+			fp, err = getAllocatedFloatingIP(networkClient, machine, port.ID, fixedIP)
+		}
+		if err != nil {
+			return fmt.Errorf("get floatingIP err: %v", err)
+		}
+
+		if fp == nil {
+			if err := allocateFloatingIP(machine, networkClient, request, port.ID, fixedIP); err != nil {
+				return err
+			}
+			associated = true
+			continue
+		}
+
+		if fp.PortID == port.ID && (request.SubnetID == "" || fp.FixedIP == fixedIP) {
+			continue
+		}
+
+		_, err = networkClient.UpdateFloatingIP(fp.ID, floatingips.UpdateOpts{
+			PortID:  &port.ID,
+			FixedIP: fixedIP,
+		})
+		if err != nil {
+			capoRecorder.Warnf(machine, "FailedAssociateFloatingIP", "Failed to associate floating IP %s with port %s: %v", fp.FloatingIP, port.ID, err)
+			return fmt.Errorf("associate floatingIP err: %v", err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulAssociateFloatingIP", "Associated floating IP %s with port %s", fp.FloatingIP, port.ID)
+		associated = true
+	}
+
+	if associated {
+		return &maoMachine.RequeueAfterError{RequeueAfter: 5 * time.Second}
+	}
+	return nil
+}
+
+// getFloatingIP returns the floating IP with the given address, if it exists.
+func getFloatingIP(networkClient floatingIPNetworkClient, address string) (*floatingips.FloatingIP, error) {
+	fpList, err := networkClient.ListFloatingIP(floatingips.ListOpts{FloatingIP: address})
+	if err != nil || len(fpList) == 0 {
+		return nil, err
+	}
+	return &fpList[0], nil
+}
+
+// getAllocatedFloatingIP returns the floating IP allocated for the machine
+// which is associated with the fixed IP of the port, if any.
+func getAllocatedFloatingIP(networkClient floatingIPNetworkClient, machine *machinev1.Machine, portID, fixedIP string) (*floatingips.FloatingIP, error) {
+	fpList, err := networkClient.ListFloatingIP(floatingips.ListOpts{
+		Description: allocatedFloatingIPDescription(machine),
+		PortID:      portID,
+		FixedIP:     fixedIP,
+	})
+	if err != nil || len(fpList) == 0 {
+		return nil, err
+	}
+	return &fpList[0], nil
+}
+
+// allocateFloatingIP creates the requested floating IP on its network and
+// associates it with the fixed IP of the port.
+func allocateFloatingIP(machine *machinev1.Machine, networkClient floatingIPNetworkClient, request clients.FloatingIPRequest, portID, fixedIP string) error {
+	if request.Network == "" {
+		return maoMachine.InvalidMachineConfiguration("floating IP %s does not exist and there is no network to allocate it from", request.Address)
+	}
+	networkID, err := getExternalNetworkID(networkClient, request.Network)
+	if err != nil {
+		return err
+	}
+
+	// Only admins can choose the address of a floating IP
+	createOpts := floatingips.CreateOpts{
+		FloatingNetworkID: networkID,
+		FloatingIP:        request.Address,
+		PortID:            portID,
+		FixedIP:           fixedIP,
+		Description:       requestedFloatingIPDescription(machine),
+	}
+	if request.Address == "" {
+		createOpts.Description = allocatedFloatingIPDescription(machine)
+	}
+
+	fp, err := networkClient.CreateFloatingIP(createOpts)
+	if err != nil && isOverQuota(err) {
+		capoRecorder.Warnf(machine, "FloatingIPQuotaExceeded", "Failed to create floating IP %s on network %s: the floating IP quota of the project is exceeded", request.Address, request.Network)
+		return &floatingIPQuotaError{network: request.Network, err: err}
+	}
+	if err != nil {
+		capoRecorder.Warnf(machine, "FailedCreateFloatingIP", "Failed to create floating IP %s on network %s: %v", request.Address, request.Network, err)
+		return fmt.Errorf("create floatingIP err: %v", err)
+	}
+	capoRecorder.Eventf(machine, "SuccessfulCreateFloatingIP", "Created floating IP %s with id %s on network %s", fp.FloatingIP, fp.ID, request.Network)
+
+	// The floating IP is found by its description, so failing to tag it
+	// is not an error.
+	_, err = networkClient.ReplaceAllAttributesTags("floatingips", fp.ID, attributestags.ReplaceAllOpts{Tags: floatingIPTags(machine)})
+	if err != nil {
+		capoRecorder.Warnf(machine, "FailedTagFloatingIP", "Failed to tag floating IP %s: %v", fp.FloatingIP, err)
+	}
+	return nil
+}
+
+// floatingIPQuotaError is returned when a floating IP can't be allocated
+// because the floating IP quota of the project is exceeded.
+type floatingIPQuotaError struct {
+	network string
+	err     error
+}
+
+func (e *floatingIPQuotaError) Error() string {
+	return fmt.Sprintf("create floatingIP on network %s err: floating IP quota exceeded: %v", e.network, e.err)
+}
+
+func (e *floatingIPQuotaError) Unwrap() error {
+	return e.err
+}
+
+// isOverQuota returns true if err is the conflict Neutron returns when the
+// quota of a resource is exceeded.
+func isOverQuota(err error) bool {
+	var errUnexpectedResponseCode gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &errUnexpectedResponseCode) || errUnexpectedResponseCode.Actual != http.StatusConflict {
+		return false
+	}
+
+	var body struct {
+		NeutronError struct {
+			Type string `json:"type"`
+		} `json:"NeutronError"`
+	}
+	if err := json.Unmarshal(errUnexpectedResponseCode.Body, &body); err != nil {
+		return false
+	}
+	return body.NeutronError.Type == "OverQuota"
+}
+
+// setFloatingIPsAllocatedCondition reports in the FloatingIPsAllocated
+// condition whether reconcileFloatingIPs, which returned err, failed because
+// the floating IP quota is exceeded. Retrying is pointless until floating IPs
+// are released or the quota is increased, so instead of returning err it then
+// requeues after floatingIPQuotaRequeueAfter. Other errors are returned as
+// they are. The condition is only added once the quota has been exceeded.
+func (oc *OpenstackClient) setFloatingIPsAllocatedCondition(ctx context.Context, machine *machinev1.Machine, err error) error {
+	var quotaErr *floatingIPQuotaError
+	overQuota := errors.As(err, &quotaErr)
+
+	var requeueErr *maoMachine.RequeueAfterError
+	if err != nil && !overQuota && !errors.As(err, &requeueErr) {
+		return err
+	}
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	if overQuota {
+		conditions.MarkFalse(machine, FloatingIPsAllocatedCondition, "FloatingIPQuotaExceeded", machinev1.ConditionSeverityWarning,
+			"The floating IP quota of the project is exceeded on network %s. Pre-allocate floating IPs and set their addresses in the providerSpec, or increase the quota", quotaErr.network)
+	} else if conditions.Get(machine, FloatingIPsAllocatedCondition) != nil {
+		conditions.MarkTrue(machine, FloatingIPsAllocatedCondition)
+	} else {
+		return err
+	}
+	if patchErr := oc.client.Status().Patch(ctx, machine, patch); patchErr != nil {
+		return fmt.Errorf("error patching status of %q: %w", machine.Name, patchErr)
+	}
+
+	if overQuota {
+		return &maoMachine.RequeueAfterError{RequeueAfter: floatingIPQuotaRequeueAfter}
+	}
+	return err
+}
+
+// getExternalNetworkID returns the ID of the external network with the given
+// name or ID.
+func getExternalNetworkID(networkClient floatingIPNetworkClient, nameOrID string) (string, error) {
+	isExternal := true
+	networkList, err := networkClient.ListNetwork(external.ListOptsExt{
+		ListOptsBuilder: networks.ListOpts{},
+		External:        &isExternal,
+	})
+	if err != nil {
+		return "", fmt.Errorf("list external networks err: %v", err)
+	}
+
+	var ids []string
+	for _, network := range networkList {
+		if network.ID == nameOrID {
+			return network.ID, nil
+		}
+		if network.Name == nameOrID {
+			ids = append(ids, network.ID)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("could not find external network: %s", nameOrID)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%d external networks named %s exist", len(ids), nameOrID)
+	}
+}
+
+// selectPortFixedIP returns the port of the instance with the given index,
+// numbered as in clients.AddressClaim, and its fixed IP in the subnet with
+// subnetID or, if subnetID is empty, its first IPv4 fixed IP. The first fixed
+// IP is returned instead if the port only has IPv6 fixed IPs.
+func selectPortFixedIP(machineName string, portOpts []capov1.PortOpts, instancePorts []ports.Port, portIndex int, subnetID string) (*ports.Port, string, error) {
+	if portIndex < 0 || portIndex >= len(portOpts) {
+		return nil, "", fmt.Errorf("port index %d is out of range, the machine has %d ports", portIndex, len(portOpts))
+	}
+	portName := networking.GetPortName(machineName, &portOpts[portIndex], portIndex)
+
+	var port *ports.Port
+	for i := range instancePorts {
+		if instancePorts[i].Name == portName {
+			port = &instancePorts[i]
+			break
+		}
+	}
+	if port == nil {
+		return nil, "", fmt.Errorf("port %s is not attached to the instance", portName)
+	}
+
+	for _, fixedIP := range port.FixedIPs {
+		if subnetID != "" {
+			if fixedIP.SubnetID == subnetID {
+				return port, fixedIP.IPAddress, nil
+			}
+		} else if isIPv4(fixedIP.IPAddress) {
+			return port, fixedIP.IPAddress, nil
+		}
+	}
+	if subnetID != "" {
+		return nil, "", fmt.Errorf("port %s has no fixed IP in subnet %s", portName, subnetID)
+	}
+	if len(port.FixedIPs) > 0 {
+		return port, port.FixedIPs[0].IPAddress, nil
+	}
+	return nil, "", fmt.Errorf("port %s has no fixed IP", portName)
+}
+
+// selectManagementPortFixedIP returns the management port of the instance,
+// which floating IPs without a port index or subnet are associated with, and
+// its fixed IP. If primarySubnet is set, it is the port created for the
+// machine which has a fixed IP in that subnet, and that fixed IP is returned.
+// Otherwise it is the primary port, as selected by selectPortFixedIP.
+func selectManagementPortFixedIP(machineName, primarySubnet string, portOpts []capov1.PortOpts, instancePorts []ports.Port) (*ports.Port, string, error) {
+	if primarySubnet == "" {
+		return selectPortFixedIP(machineName, portOpts, instancePorts, 0, "")
+	}
+
+	for i := range portOpts {
+		portName := networking.GetPortName(machineName, &portOpts[i], i)
+		for j := range instancePorts {
+			if instancePorts[j].Name != portName {
+				continue
+			}
+			for _, fixedIP := range instancePorts[j].FixedIPs {
+				if fixedIP.SubnetID == primarySubnet {
+					return &instancePorts[j], fixedIP.IPAddress, nil
+				}
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("no port of the instance has a fixed IP in primary subnet %s", primarySubnet)
+}
+
+// isIPv4 returns true if address is an IPv4 address.
+func isIPv4(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() != nil
+}
+
+// releaseFloatingIPs releases all the floating IPs requested for the machine.
+func releaseFloatingIPs(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceID string, scope scope.Scope) error {
+	requests := floatingIPRequests(machineSpec, extensions)
+	if len(requests) == 0 {
+		return nil
+	}
+
+	networkService, err := networking.NewService(scope)
+	if err != nil {
+		return err
+	}
+	networkClient, err := scope.NewNetworkClient()
+	if err != nil {
+		return err
+	}
+
+	var allocated bool
+	for _, request := range requests {
+		if request.Address == "" {
+			allocated = true
+			continue
+		}
+		if err := releaseFloatingIP(machine, request.Address, extensions.DeleteFloatingIP, instanceID, networkService, networkClient); err != nil {
+			return err
+		}
+	}
+
+	// Floating IPs allocated for the machine are always deleted. Deleting
+	// a floating IP disassociates it.
+	if allocated {
+		fpList, err := networkClient.ListFloatingIP(floatingips.ListOpts{Description: allocatedFloatingIPDescription(machine)})
+		if err != nil {
+			return fmt.Errorf("list floatingIPs err: %v", err)
+		}
+		for _, fp := range fpList {
+			if err := networkService.DeleteFloatingIP(machine, fp.FloatingIP); err != nil {
+				return fmt.Errorf("delete floatingIP err: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// releaseFloatingIP disassociates the floating IP with the given address from
+// the instance with instanceID, if it is still associated with it, and deletes
+// it if requested. A floating IP associated with another server is left alone.
+func releaseFloatingIP(machine *machinev1.Machine, address string, deleteFloatingIP bool, instanceID string, networkService *networking.Service, networkClient capoclients.NetworkClient) error {
+	fp, err := networkService.GetFloatingIP(address)
+	if err != nil {
+		return fmt.Errorf("get floatingIP err: %v", err)
+	}
+	if fp == nil {
+		return nil
+	}
+
+	if fp.PortID != "" {
+		if instanceID == "" {
+			return nil
+		}
+		port, err := networkClient.GetPort(fp.PortID)
+		if err != nil {
+			return fmt.Errorf("get port of floatingIP err: %v", err)
+		}
+		if port.DeviceID != instanceID {
+			return nil
+		}
+		// CAPO's DisassociateFloatingIP leaves port_id out of the update,
+		// which doesn't disassociate the floating IP. An empty port ID is
+		// sent as a null port_id, which does.
+		if _, err := networkClient.UpdateFloatingIP(fp.ID, floatingips.UpdateOpts{PortID: ptr.To("")}); err != nil {
+			return fmt.Errorf("disassociate floatingIP err: %v", err)
+		}
+	}
+
+	if deleteFloatingIP {
+		if err := networkService.DeleteFloatingIP(machine, fp.FloatingIP); err != nil {
+			return fmt.Errorf("delete floatingIP err: %v", err)
+		}
+	}
+	return nil
+}
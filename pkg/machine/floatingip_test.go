@@ -0,0 +1,667 @@
+package machine
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	capomock "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients/mock"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestReleaseFloatingIPs(t *testing.T) {
+	const (
+		instanceID = "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"
+		portID     = "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"
+		fipID      = "3b2a1f0e-9d8c-4b7a-a6f5-e4d3c2b1a0f9"
+		fipAddress = "203.0.113.10"
+	)
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{FloatingIP: fipAddress}
+
+	tests := []struct {
+		name       string
+		extensions clients.ProviderSpecExtensions
+		instanceID string
+		expect     func(t *testing.T, n *capomock.MockNetworkClientMockRecorder)
+	}{
+		{
+			name:       "associated with the instance",
+			instanceID: instanceID,
+			expect: func(t *testing.T, n *capomock.MockNetworkClientMockRecorder) {
+				n.GetPort(portID).Return(&ports.Port{ID: portID, DeviceID: instanceID}, nil)
+				n.UpdateFloatingIP(fipID, floatingips.UpdateOpts{PortID: ptr.To("")}).
+					DoAndReturn(func(_ string, opts floatingips.UpdateOptsBuilder) (*floatingips.FloatingIP, error) {
+						expectDisassociation(t, opts)
+						return &floatingips.FloatingIP{ID: fipID}, nil
+					})
+			},
+		},
+		{
+			name:       "associated with the instance and deleted",
+			extensions: clients.ProviderSpecExtensions{DeleteFloatingIP: true},
+			instanceID: instanceID,
+			expect: func(t *testing.T, n *capomock.MockNetworkClientMockRecorder) {
+				n.GetPort(portID).Return(&ports.Port{ID: portID, DeviceID: instanceID}, nil)
+				n.UpdateFloatingIP(fipID, floatingips.UpdateOpts{PortID: ptr.To("")}).
+					DoAndReturn(func(_ string, opts floatingips.UpdateOptsBuilder) (*floatingips.FloatingIP, error) {
+						expectDisassociation(t, opts)
+						return &floatingips.FloatingIP{ID: fipID}, nil
+					})
+				n.DeleteFloatingIP(fipID).Return(nil)
+			},
+		},
+		{
+			name:       "associated with another server",
+			extensions: clients.ProviderSpecExtensions{DeleteFloatingIP: true},
+			instanceID: instanceID,
+			expect: func(t *testing.T, n *capomock.MockNetworkClientMockRecorder) {
+				n.GetPort(portID).Return(&ports.Port{ID: portID, DeviceID: "1f2e3d4c-5b6a-4798-8a9b-0c1d2e3f4a5b"}, nil)
+			},
+		},
+		{
+			name:       "no instance",
+			extensions: clients.ProviderSpecExtensions{DeleteFloatingIP: true},
+			expect:     func(_ *testing.T, _ *capomock.MockNetworkClientMockRecorder) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			networkClient := mockScopeFactory.NetworkClient.EXPECT()
+
+			networkClient.ListFloatingIP(floatingips.ListOpts{FloatingIP: fipAddress}).
+				Return([]floatingips.FloatingIP{{ID: fipID, FloatingIP: fipAddress, PortID: portID}}, nil).
+				MinTimes(1)
+			tt.expect(t, networkClient)
+
+			if err := releaseFloatingIPs(&machinev1beta1.Machine{}, machineSpec, &tt.extensions, tt.instanceID, mockScopeFactory); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSelectPortFixedIP(t *testing.T) {
+	const (
+		ipv4SubnetID = "6a4d0c8e-2b1f-4e3a-9c5d-7f8e9a0b1c2d"
+		ipv6SubnetID = "d2c1b0a9-8f7e-4d6c-b5a4-3f2e1d0c9b8a"
+	)
+	portOpts := []capov1.PortOpts{{}, {NameSuffix: "storage"}}
+	instancePorts := []ports.Port{
+		{
+			ID:   "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60",
+			Name: "worker-0-0",
+			FixedIPs: []ports.IP{
+				{SubnetID: ipv6SubnetID, IPAddress: "2001:db8::10"},
+				{SubnetID: ipv4SubnetID, IPAddress: "192.0.2.10"},
+			},
+		},
+		{
+			ID:       "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d",
+			Name:     "worker-0-storage",
+			FixedIPs: []ports.IP{{SubnetID: ipv6SubnetID, IPAddress: "2001:db8::20"}},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		portIndex       int
+		subnetID        string
+		expectedPortID  string
+		expectedFixedIP string
+		wantErr         bool
+	}{
+		{
+			name:            "first IPv4 fixed IP of the primary port",
+			expectedPortID:  "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60",
+			expectedFixedIP: "192.0.2.10",
+		},
+		{
+			name:            "fixed IP in subnet",
+			subnetID:        ipv6SubnetID,
+			expectedPortID:  "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60",
+			expectedFixedIP: "2001:db8::10",
+		},
+		{
+			name:            "first fixed IP of an IPv6-only port",
+			portIndex:       1,
+			expectedPortID:  "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d",
+			expectedFixedIP: "2001:db8::20",
+		},
+		{
+			name:      "port index out of range",
+			portIndex: 2,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, fixedIP, err := selectPortFixedIP("worker-0", portOpts, instancePorts, tt.portIndex, tt.subnetID)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got port %v", port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if port.ID != tt.expectedPortID || fixedIP != tt.expectedFixedIP {
+				t.Errorf("Expected port %s and fixed IP %s, got port %s and fixed IP %s", tt.expectedPortID, tt.expectedFixedIP, port.ID, fixedIP)
+			}
+		})
+	}
+}
+
+func TestSelectManagementPortFixedIP(t *testing.T) {
+	const (
+		primaryPortID  = "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"
+		ingressPortID  = "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d"
+		machineSubnet  = "6a4d0c8e-2b1f-4e3a-9c5d-7f8e9a0b1c2d"
+		ingressSubnet  = "1c3e5a7c-9e1a-4c3e-8a7c-9e1a3c5e7a9c"
+		foreignSubnet  = "8e0a2c4e-6a8c-4e0a-9c4e-6a8c0e2a4c6e"
+		foreignPortID  = "4a6c8e0a-2c4e-4a6c-8e0a-2c4e6a8c0e2a"
+		missingSubnet  = "7b9d1f3b-5d7f-4b9d-9f3b-5d7f9b1d3f5b"
+		primaryFixedIP = "10.0.0.12"
+		ingressFixedIP = "192.0.2.10"
+	)
+	portOpts := []capov1.PortOpts{{}, {NameSuffix: "ingress"}}
+	instancePorts := []ports.Port{
+		{
+			ID:       primaryPortID,
+			Name:     "worker-0-0",
+			FixedIPs: []ports.IP{{SubnetID: machineSubnet, IPAddress: primaryFixedIP}},
+		},
+		{
+			ID:       ingressPortID,
+			Name:     "worker-0-ingress",
+			FixedIPs: []ports.IP{{SubnetID: "ipv6-subnet-id", IPAddress: "2001:db8::20"}, {SubnetID: ingressSubnet, IPAddress: ingressFixedIP}},
+		},
+		// Attached to the instance, but not created for the machine
+		{
+			ID:       foreignPortID,
+			Name:     "manually-attached",
+			FixedIPs: []ports.IP{{SubnetID: foreignSubnet, IPAddress: "172.16.0.5"}},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		primarySubnet   string
+		instancePorts   []ports.Port
+		expectedPortID  string
+		expectedFixedIP string
+		wantErr         bool
+	}{
+		{
+			name:            "primary port without a primary subnet",
+			instancePorts:   instancePorts,
+			expectedPortID:  primaryPortID,
+			expectedFixedIP: primaryFixedIP,
+		},
+		{
+			name:            "port in the primary subnet",
+			primarySubnet:   ingressSubnet,
+			instancePorts:   instancePorts,
+			expectedPortID:  ingressPortID,
+			expectedFixedIP: ingressFixedIP,
+		},
+		{
+			name:          "primary subnet only on a port not created for the machine",
+			primarySubnet: foreignSubnet,
+			instancePorts: instancePorts,
+			wantErr:       true,
+		},
+		{
+			name:          "no port in the primary subnet",
+			primarySubnet: missingSubnet,
+			instancePorts: instancePorts,
+			wantErr:       true,
+		},
+		{
+			name:          "missing primary port",
+			instancePorts: instancePorts[1:],
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, fixedIP, err := selectManagementPortFixedIP("worker-0", tt.primarySubnet, portOpts, tt.instancePorts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got port %v", port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if port.ID != tt.expectedPortID || fixedIP != tt.expectedFixedIP {
+				t.Errorf("Expected port %s and fixed IP %s, got port %s and fixed IP %s", tt.expectedPortID, tt.expectedFixedIP, port.ID, fixedIP)
+			}
+		})
+	}
+}
+
+func TestGetExternalNetworkID(t *testing.T) {
+	networkList := []networks.Network{
+		{ID: "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9", Name: "public"},
+		{ID: "0f1e2d3c-4b5a-4697-8869-5a4b3c2d1e0f", Name: "provider"},
+		{ID: "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d", Name: "provider"},
+	}
+
+	tests := []struct {
+		name     string
+		nameOrID string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "by name",
+			nameOrID: "public",
+			expected: "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9",
+		},
+		{
+			name:     "by ID",
+			nameOrID: "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d",
+			expected: "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d",
+		},
+		{
+			name:     "ambiguous name",
+			nameOrID: "provider",
+			wantErr:  true,
+		},
+		{
+			name:     "not found",
+			nameOrID: "private",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			networkClient := capomock.NewMockNetworkClient(mockCtrl)
+			networkClient.EXPECT().ListNetwork(gomock.Any()).Return(networkList, nil)
+
+			id, err := getExternalNetworkID(networkClient, tt.nameOrID)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got network %s", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id != tt.expected {
+				t.Errorf("Expected network %s, got %s", tt.expected, id)
+			}
+		})
+	}
+}
+
+func TestAllocateFloatingIP(t *testing.T) {
+	const (
+		networkID = "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9"
+		portID    = "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"
+		fipID     = "3b2a1f0e-9d8c-4b7a-a6f5-e4d3c2b1a0f9"
+		fixedIP   = "10.0.0.12"
+	)
+	machine := &machinev1beta1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-id-worker-0-abcde",
+			Namespace: "openshift-machine-api",
+			Labels:    map[string]string{machinev1beta1.MachineClusterIDLabel: "cluster-id"},
+		},
+	}
+
+	mockCtrl := gomock.NewController(t)
+	networkClient := capomock.NewMockNetworkClient(mockCtrl)
+	networkClient.EXPECT().ListNetwork(gomock.Any()).Return([]networks.Network{{ID: networkID, Name: "public"}}, nil)
+	networkClient.EXPECT().CreateFloatingIP(floatingips.CreateOpts{
+		FloatingNetworkID: networkID,
+		PortID:            portID,
+		FixedIP:           fixedIP,
+		Description:       "Created by machine-api-provider-openstack for machine openshift-machine-api/cluster-id-worker-0-abcde of cluster cluster-id",
+	}).Return(&floatingips.FloatingIP{ID: fipID, FloatingIP: "203.0.113.10"}, nil)
+	networkClient.EXPECT().ReplaceAllAttributesTags("floatingips", fipID, attributestags.ReplaceAllOpts{
+		Tags: []string{"cluster-api-provider-openstack", "openshift-machine-api-cluster-id", "machine:cluster-id-worker-0-abcde"},
+	}).Return(nil, nil)
+
+	if err := allocateFloatingIP(machine, networkClient, clients.FloatingIPRequest{Network: "public"}, portID, fixedIP); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestAllocateFloatingIPOverQuota(t *testing.T) {
+	const networkID = "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9"
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "cluster-id-worker-0-abcde"}}
+
+	overQuota := gophercloud.ErrDefault409{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{
+		Actual: http.StatusConflict,
+		Body:   []byte(`{"NeutronError": {"type": "OverQuota", "message": "Quota exceeded for resources: ['floatingip'].", "detail": ""}}`),
+	}}
+
+	mockCtrl := gomock.NewController(t)
+	networkClient := capomock.NewMockNetworkClient(mockCtrl)
+	networkClient.EXPECT().ListNetwork(gomock.Any()).Return([]networks.Network{{ID: networkID, Name: "public"}}, nil)
+	networkClient.EXPECT().CreateFloatingIP(gomock.Any()).Return(nil, overQuota)
+
+	err := allocateFloatingIP(machine, networkClient, clients.FloatingIPRequest{Network: "public"}, "port-id", "10.0.0.12")
+	var quotaErr *floatingIPQuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.network != "public" {
+		t.Fatalf("Expected a floating IP quota error for network public, got %v", err)
+	}
+}
+
+func TestIsOverQuota(t *testing.T) {
+	conflict := func(body string) error {
+		return gophercloud.ErrDefault409{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusConflict, Body: []byte(body)}}
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "over quota",
+			err:      conflict(`{"NeutronError": {"type": "OverQuota", "message": "Quota exceeded for resources: ['floatingip']."}}`),
+			expected: true,
+		},
+		{
+			name: "other conflict",
+			err:  conflict(`{"NeutronError": {"type": "IpAddressInUse", "message": "IP address in use."}}`),
+		},
+		{
+			name: "not JSON",
+			err:  conflict("Conflict"),
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := isOverQuota(tt.err); actual != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReconcileFloatingIPsIPv6Only(t *testing.T) {
+	const instanceID = "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"
+
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"}},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		FloatingIPs: []clients.FloatingIPRequest{{Network: "public"}},
+	}
+	instanceStatus := compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID}}, logr.Discard())
+
+	mockCtrl := gomock.NewController(t)
+	mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+	mockScopeFactory.NetworkClient.EXPECT().ListPort(ports.ListOpts{DeviceID: instanceID}).Return([]ports.Port{{
+		ID:       "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60",
+		Name:     "worker-0-0",
+		FixedIPs: []ports.IP{{IPAddress: "2001:db8::10"}},
+	}}, nil)
+
+	err := reconcileFloatingIPs(machine, machineSpec, extensions, instanceStatus, mockScopeFactory)
+	var invalidConfiguration *maoMachine.MachineError
+	if !errors.As(err, &invalidConfiguration) {
+		t.Errorf("Expected an invalid configuration error, got %v", err)
+	}
+}
+
+type fakeFloatingIPNetworkClient struct {
+	ports       []ports.Port
+	floatingIPs []floatingips.FloatingIP
+	created     []floatingips.CreateOpts
+	updated     map[string]floatingips.UpdateOpts
+}
+
+func (f *fakeFloatingIPNetworkClient) ListPort(ports.ListOptsBuilder) ([]ports.Port, error) {
+	return f.ports, nil
+}
+
+func (f *fakeFloatingIPNetworkClient) ListNetwork(networks.ListOptsBuilder) ([]networks.Network, error) {
+	return []networks.Network{{ID: "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9", Name: "public"}}, nil
+}
+
+func (f *fakeFloatingIPNetworkClient) ListFloatingIP(opts floatingips.ListOptsBuilder) ([]floatingips.FloatingIP, error) {
+	listOpts := opts.(floatingips.ListOpts)
+	var fpList []floatingips.FloatingIP
+	for _, fp := range f.floatingIPs {
+		if (listOpts.FloatingIP == "" || fp.FloatingIP == listOpts.FloatingIP) &&
+			(listOpts.Description == "" || fp.Description == listOpts.Description) &&
+			(listOpts.PortID == "" || fp.PortID == listOpts.PortID) &&
+			(listOpts.FixedIP == "" || fp.FixedIP == listOpts.FixedIP) {
+			fpList = append(fpList, fp)
+		}
+	}
+	return fpList, nil
+}
+
+func (f *fakeFloatingIPNetworkClient) CreateFloatingIP(opts floatingips.CreateOptsBuilder) (*floatingips.FloatingIP, error) {
+	createOpts := opts.(floatingips.CreateOpts)
+	f.created = append(f.created, createOpts)
+	return &floatingips.FloatingIP{ID: "created-floating-ip-id", FloatingIP: "203.0.113.99"}, nil
+}
+
+func (f *fakeFloatingIPNetworkClient) UpdateFloatingIP(id string, opts floatingips.UpdateOptsBuilder) (*floatingips.FloatingIP, error) {
+	f.updated[id] = opts.(floatingips.UpdateOpts)
+	return &floatingips.FloatingIP{ID: id}, nil
+}
+
+func (f *fakeFloatingIPNetworkClient) ReplaceAllAttributesTags(string, string, attributestags.ReplaceAllOptsBuilder) ([]string, error) {
+	return nil, nil
+}
+
+func TestAssociateFloatingIPs(t *testing.T) {
+	const (
+		instanceID   = "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"
+		portID       = "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"
+		otherPortID  = "2d4f6b8d-0f2b-4d6f-8b0d-2f4b6d8f0b2d"
+		fipID        = "3b2a1f0e-9d8c-4b7a-a6f5-e4d3c2b1a0f9"
+		fipAddress   = "203.0.113.10"
+		fixedIP      = "10.0.0.12"
+		otherFixedIP = "10.0.1.12"
+		subnetID     = "5c7e9a1c-3e5a-4c7e-9a1c-3e5a7c9e1a3c"
+	)
+	machine := &machinev1beta1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker-0",
+			Namespace: "openshift-machine-api",
+			Labels:    map[string]string{machinev1beta1.MachineClusterIDLabel: "cluster-id"},
+		},
+	}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"}},
+	}
+	instancePort := ports.Port{
+		ID:       portID,
+		Name:     "worker-0-0",
+		FixedIPs: []ports.IP{{IPAddress: otherFixedIP, SubnetID: "other-subnet-id"}, {IPAddress: fixedIP, SubnetID: subnetID}},
+	}
+	allocatedFloatingIP := func(portID, status string) floatingips.FloatingIP {
+		return floatingips.FloatingIP{
+			ID:          fipID,
+			FloatingIP:  fipAddress,
+			PortID:      portID,
+			FixedIP:     otherFixedIP,
+			Status:      status,
+			Description: allocatedFloatingIPDescription(machine),
+		}
+	}
+	requestedFloatingIP := func(portID, fixedIP, status string) floatingips.FloatingIP {
+		return floatingips.FloatingIP{ID: fipID, FloatingIP: fipAddress, PortID: portID, FixedIP: fixedIP, Status: status}
+	}
+
+	tests := []struct {
+		name        string
+		requests    []clients.FloatingIPRequest
+		ports       []ports.Port
+		floatingIPs []floatingips.FloatingIP
+		created     int
+		updated     map[string]floatingips.UpdateOpts
+		requeue     bool
+		invalid     bool
+		// event is the reason of the expected event, as title cased by
+		// the CAPO recorder
+		event string
+	}{
+		{
+			name:        "allocated floating IP already associated",
+			requests:    []clients.FloatingIPRequest{{Network: "public"}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{allocatedFloatingIP(portID, "ACTIVE")},
+		},
+		{
+			name:        "requested floating IP already associated",
+			requests:    []clients.FloatingIPRequest{{Address: fipAddress}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{requestedFloatingIP(portID, otherFixedIP, "ACTIVE")},
+		},
+		{
+			name:        "requested floating IP associated with the wrong port",
+			requests:    []clients.FloatingIPRequest{{Address: fipAddress}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{requestedFloatingIP(otherPortID, otherFixedIP, "ACTIVE")},
+			updated:     map[string]floatingips.UpdateOpts{fipID: {PortID: ptr.To(portID), FixedIP: otherFixedIP}},
+			requeue:     true,
+			event:       "Successfulassociatefloatingip",
+		},
+		{
+			name:        "requested floating IP associated with the wrong fixed IP",
+			requests:    []clients.FloatingIPRequest{{Address: fipAddress, SubnetID: subnetID}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{requestedFloatingIP(portID, otherFixedIP, "ACTIVE")},
+			updated:     map[string]floatingips.UpdateOpts{fipID: {PortID: ptr.To(portID), FixedIP: fixedIP}},
+			requeue:     true,
+			event:       "Successfulassociatefloatingip",
+		},
+		{
+			name:        "requested floating IP in ERROR state already associated",
+			requests:    []clients.FloatingIPRequest{{Address: fipAddress}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{requestedFloatingIP(portID, otherFixedIP, "ERROR")},
+		},
+		{
+			name:        "requested floating IP in ERROR state not associated",
+			requests:    []clients.FloatingIPRequest{{Address: fipAddress}},
+			ports:       []ports.Port{instancePort},
+			floatingIPs: []floatingips.FloatingIP{requestedFloatingIP("", "", "ERROR")},
+			updated:     map[string]floatingips.UpdateOpts{fipID: {PortID: ptr.To(portID), FixedIP: otherFixedIP}},
+			requeue:     true,
+			event:       "Successfulassociatefloatingip",
+		},
+		{
+			name:     "floating IP not allocated yet",
+			requests: []clients.FloatingIPRequest{{Network: "public"}},
+			ports:    []ports.Port{instancePort},
+			created:  1,
+			requeue:  true,
+			event:    "Successfulcreatefloatingip",
+		},
+		{
+			name:     "missing requested floating IP without a network",
+			requests: []clients.FloatingIPRequest{{Address: fipAddress}},
+			ports:    []ports.Port{instancePort},
+			invalid:  true,
+		},
+		{
+			name:     "missing management port",
+			requests: []clients.FloatingIPRequest{{Network: "public"}},
+			ports:    []ports.Port{{ID: otherPortID, Name: "worker-0-1", FixedIPs: []ports.IP{{IPAddress: fixedIP}}}},
+			invalid:  true,
+		},
+		{
+			name:     "port index out of range",
+			requests: []clients.FloatingIPRequest{{Network: "public", PortIndex: 1}},
+			ports:    []ports.Port{instancePort},
+			invalid:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordCapoEvents(t)
+			networkClient := &fakeFloatingIPNetworkClient{
+				ports:       tt.ports,
+				floatingIPs: tt.floatingIPs,
+				updated:     map[string]floatingips.UpdateOpts{},
+			}
+			machine := machine.DeepCopy()
+
+			err := associateFloatingIPs(machine, machineSpec, tt.requests, instanceID, networkClient)
+
+			var requeueErr *maoMachine.RequeueAfterError
+			var invalidConfiguration *maoMachine.MachineError
+			switch {
+			case tt.invalid:
+				if !errors.As(err, &invalidConfiguration) {
+					t.Errorf("Expected an invalid configuration error, got %v", err)
+				}
+			case tt.requeue:
+				if !errors.As(err, &requeueErr) || requeueErr.RequeueAfter != 5*time.Second {
+					t.Errorf("Expected a requeue after 5s, got %v", err)
+				}
+			case err != nil:
+				t.Errorf("Unexpected error: %v", err)
+			}
+			// Only invalid configurations fail the machine
+			if !tt.invalid && errors.As(err, &invalidConfiguration) {
+				t.Errorf("Expected the machine not to fail, got %v", err)
+			}
+			if machine.Status.Phase != nil || machine.Status.ErrorReason != nil {
+				t.Errorf("Expected the machine status to be left to the machine controller, got phase %v and reason %v", machine.Status.Phase, machine.Status.ErrorReason)
+			}
+
+			if tt.event != "" {
+				expectEvent(t, recorder, tt.event)
+			}
+			expectNoEvent(t, recorder)
+
+			if len(networkClient.created) != tt.created {
+				t.Errorf("Expected %d floating IPs to be created, got %d", tt.created, len(networkClient.created))
+			}
+			if tt.updated == nil {
+				tt.updated = map[string]floatingips.UpdateOpts{}
+			}
+			if !reflect.DeepEqual(networkClient.updated, tt.updated) {
+				t.Errorf("Expected floating IP updates %v, got %v", tt.updated, networkClient.updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// hostnameFile is the file of the Ignition user data which sets the hostname.
+const (
+	hostnameFile     = "/etc/hostname"
+	hostnameFileMode = 0644
+)
+
+// renderHostname returns the hostname of the machine, which may use the same
+// template variables as the server metadata. Without a hostname template the
+// hostname is the name of the machine. It returns an error if the hostname
+// isn't a valid DNS name, as the node would have no valid name, or if its
+// first label isn't the name of the machine, which is the name of its server:
+// Nova and its metadata service would know the server by another name than
+// the node.
+func renderHostname(machine *machinev1.Machine, hostname string, availabilityZone string) (string, error) {
+	if hostname == "" {
+		return machine.Name, nil
+	}
+
+	rendered, err := renderTemplate("hostname", hostname, newMetadataVariables(machine, availabilityZone))
+	if err != nil {
+		return "", err
+	}
+	if msgs := validation.IsDNS1123Subdomain(rendered); len(msgs) > 0 {
+		return "", fmt.Errorf("hostname %q is not a valid DNS name: %s", rendered, strings.Join(msgs, "; "))
+	}
+	label, _, _ := strings.Cut(rendered, ".")
+	if len(label) > validation.DNS1123LabelMaxLength {
+		return "", fmt.Errorf("hostname %q is not a valid DNS name: its first label is longer than %d characters", rendered, validation.DNS1123LabelMaxLength)
+	}
+	if label != machine.Name {
+		return "", fmt.Errorf("hostname %q differs from the server name %s: its first label must be the name of the machine", rendered, machine.Name)
+	}
+	return rendered, nil
+}
+
+// machineHostname returns the hostname of the machine, rendered with the
+// availability zone the machine was created in.
+func machineHostname(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) (string, error) {
+	return renderHostname(machine, extensions.Hostname, machineAvailabilityZone(machine, machineSpec))
+}
+
+// validateHostname checks that the hostname template renders a valid DNS
+// name, and that no config drive file also sets the hostname.
+func validateHostname(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	if extensions.Hostname == "" {
+		return nil
+	}
+	if _, err := machineHostname(machine, machineSpec, extensions); err != nil {
+		return err
+	}
+	for _, file := range extensions.ConfigDriveFiles {
+		if file.Path == hostnameFile {
+			return fmt.Errorf("config drive file %s can't be set together with hostname", hostnameFile)
+		}
+	}
+	return nil
+}
+
+// addHostname sets the hostname of the machine in its Ignition user data.
+// Nova only sets the hostname of a server from its name before compute
+// microversion 2.90, so it is written to the hostname file instead. Without a
+// hostname template the user data is unchanged.
+func addHostname(userData string, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) (string, error) {
+	if extensions.Hostname == "" {
+		return userData, nil
+	}
+
+	hostname, err := machineHostname(machine, machineSpec, extensions)
+	if err != nil {
+		return "", err
+	}
+	return addIgnitionFiles(userData, []ignitionFile{
+		{path: hostnameFile, mode: hostnameFileMode, contents: []byte(hostname + "\n")},
+	})
+}
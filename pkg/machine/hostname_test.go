@@ -0,0 +1,161 @@
+package machine
+
+import (
+	"strings"
+	"testing"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestRenderHostname(t *testing.T) {
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cluster-id-worker-0-abcde",
+			Labels: map[string]string{machinev1.MachineClusterIDLabel: "cluster-id"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		hostname  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "not set",
+			expected: "cluster-id-worker-0-abcde",
+		},
+		{
+			name:     "fully qualified name",
+			hostname: "{{ .MachineName }}.internal.example.com",
+			expected: "cluster-id-worker-0-abcde.internal.example.com",
+		},
+		{
+			name:     "availability zone",
+			hostname: "{{ .MachineName }}.{{ .AZ }}.{{ .ClusterID }}",
+			expected: "cluster-id-worker-0-abcde.az1.cluster-id",
+		},
+		{
+			name:      "other name than the server",
+			hostname:  "{{ .ClusterID }}-node.internal.example.com",
+			expectErr: true,
+		},
+		{
+			name:      "machine name in another label",
+			hostname:  "node.{{ .MachineName }}.internal.example.com",
+			expectErr: true,
+		},
+		{
+			name:      "trailing dot",
+			hostname:  "{{ .MachineName }}.example.com.",
+			expectErr: true,
+		},
+		{
+			name:      "invalid DNS name",
+			hostname:  "{{ .MachineName }}_{{ .AZ }}",
+			expectErr: true,
+		},
+		{
+			name:      "first label too long",
+			hostname:  strings.Repeat("a", 64) + ".example.com",
+			expectErr: true,
+		},
+		{
+			name:      "unknown variable",
+			hostname:  "{{ .Region }}",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := renderHostname(machine, tt.hostname, "az1")
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got hostname %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected hostname %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{}
+
+	tests := []struct {
+		name       string
+		extensions clients.ProviderSpecExtensions
+		wantErr    bool
+	}{
+		{
+			name: "not set",
+			extensions: clients.ProviderSpecExtensions{
+				ConfigDriveFiles: []clients.ConfigDriveFile{{Path: hostnameFile}},
+			},
+		},
+		{
+			name:       "valid",
+			extensions: clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}.example.com"},
+		},
+		{
+			name:       "invalid",
+			extensions: clients.ProviderSpecExtensions{Hostname: "worker_0"},
+			wantErr:    true,
+		},
+		{
+			name:       "other name than the server",
+			extensions: clients.ProviderSpecExtensions{Hostname: "worker-1.example.com"},
+			wantErr:    true,
+		},
+		{
+			name: "hostname config drive file",
+			extensions: clients.ProviderSpecExtensions{
+				Hostname:         "{{ .MachineName }}.example.com",
+				ConfigDriveFiles: []clients.ConfigDriveFile{{Path: hostnameFile}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHostname(machine, machineSpec, &tt.extensions)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateHostname() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddHostname(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{}
+	userData := `{"ignition":{"version":"3.2.0"}}`
+
+	actual, err := addHostname(userData, machine, machineSpec, &clients.ProviderSpecExtensions{})
+	if err != nil || actual != userData {
+		t.Errorf("Expected user data to be unchanged without hostname, got %q, %v", actual, err)
+	}
+
+	actual, err = addHostname(userData, machine, machineSpec, &clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}.example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// worker-0.example.com\n
+	expected := `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"contents":{"source":"data:;base64,d29ya2VyLTAuZXhhbXBsZS5jb20K"},"mode":420,"overwrite":true,"path":"/etc/hostname"}]}}`
+	if actual != expected {
+		t.Errorf("Expected user data %s, got %s", expected, actual)
+	}
+}
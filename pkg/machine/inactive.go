@@ -0,0 +1,95 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// InstanceActiveCondition is false while the instance of a machine is paused
+// or suspended. The node of the machine is NotReady then.
+const InstanceActiveCondition machinev1.ConditionType = "InstanceActive"
+
+// States of instances which are neither active nor failed. They only change
+// when somebody unpauses or resumes the instance.
+const (
+	instanceStatePaused    = "PAUSED"
+	instanceStateSuspended = "SUSPENDED"
+)
+
+// inactiveInstanceService is the part of InstanceService used to reactivate
+// instances.
+type inactiveInstanceService interface {
+	UnpauseServer(serverID string) error
+	ResumeServer(serverID string) error
+}
+
+func validateInactiveInstancePolicy(policy clients.InactiveInstancePolicy) error {
+	switch policy {
+	case "", clients.InactiveInstancePolicyReport, clients.InactiveInstancePolicyResume:
+		return nil
+	default:
+		return fmt.Errorf("inactiveInstancePolicy %q is not one of %s, %s", policy, clients.InactiveInstancePolicyReport, clients.InactiveInstancePolicyResume)
+	}
+}
+
+// isInstanceInactive returns true if the instance is paused or suspended.
+func isInstanceInactive(instanceStatus *compute.InstanceStatus) bool {
+	state := string(instanceStatus.State())
+	return state == instanceStatePaused || state == instanceStateSuspended
+}
+
+// setInstanceActiveCondition reports in the InstanceActive condition whether
+// the instance is paused or suspended. The condition is only added once the
+// instance has been inactive.
+func setInstanceActiveCondition(machine *machinev1.Machine, instanceStatus *compute.InstanceStatus) {
+	if isInstanceInactive(instanceStatus) {
+		conditions.MarkFalse(machine, InstanceActiveCondition, "Instance"+string(instanceStatus.State()), machinev1.ConditionSeverityWarning,
+			"Instance %s is %s", instanceStatus.ID(), instanceStatus.State())
+	} else if conditions.Get(machine, InstanceActiveCondition) != nil {
+		conditions.MarkTrue(machine, InstanceActiveCondition)
+	}
+}
+
+// reactivateInstance unpauses or resumes the instance, depending on its state.
+func reactivateInstance(instanceStatus *compute.InstanceStatus, instanceService inactiveInstanceService) error {
+	switch instanceStatus.State() {
+	case instanceStatePaused:
+		return instanceService.UnpauseServer(instanceStatus.ID())
+	case instanceStateSuspended:
+		return instanceService.ResumeServer(instanceStatus.ID())
+	}
+	return nil
+}
+
+// reconcileInactiveInstance handles a paused or suspended instance according
+// to the inactiveInstancePolicy of the machine. If the instance is
+// reactivated it returns a RequeueAfterError, to check that it became active.
+func (oc *OpenstackClient) reconcileInactiveInstance(ctx context.Context, machine *machinev1.Machine, policy clients.InactiveInstancePolicy, instanceStatus *compute.InstanceStatus) error {
+	if !isInstanceInactive(instanceStatus) {
+		return nil
+	}
+
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InstanceInactive", "Instance %s is %s", instanceStatus.ID(), instanceStatus.State())
+	if policy != clients.InactiveInstancePolicyResume {
+		return nil
+	}
+
+	instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		return err
+	}
+	if err := reactivateInstance(instanceStatus, instanceService); err != nil {
+		return fmt.Errorf("error reactivating %s instance %s: %w", instanceStatus.State(), instanceStatus.ID(), err)
+	}
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "ReactivatedInstance", "Reactivated %s instance %s", instanceStatus.State(), instanceStatus.ID())
+	return &maoMachine.RequeueAfterError{RequeueAfter: 30 * time.Second}
+}
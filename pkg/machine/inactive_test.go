@@ -0,0 +1,108 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeInactiveInstanceService struct {
+	unpaused []string
+	resumed  []string
+}
+
+func (f *fakeInactiveInstanceService) UnpauseServer(serverID string) error {
+	f.unpaused = append(f.unpaused, serverID)
+	return nil
+}
+
+func (f *fakeInactiveInstanceService) ResumeServer(serverID string) error {
+	f.resumed = append(f.resumed, serverID)
+	return nil
+}
+
+func TestInactiveInstance(t *testing.T) {
+	const instanceID = "5e7a9c1b-3d5f-4b7d-9f1a-3c5e7a9b1d3f"
+
+	instance := func(state string) *compute.InstanceStatus {
+		return compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID, Status: state}}, logr.Discard())
+	}
+
+	tests := []struct {
+		name            string
+		state           string
+		previouslyFalse bool
+		condition       corev1.ConditionStatus
+		unpaused        int
+		resumed         int
+	}{
+		{
+			name:  "active",
+			state: "ACTIVE",
+		},
+		{
+			name:      "paused",
+			state:     "PAUSED",
+			condition: corev1.ConditionFalse,
+			unpaused:  1,
+		},
+		{
+			name:      "suspended",
+			state:     "SUSPENDED",
+			condition: corev1.ConditionFalse,
+			resumed:   1,
+		},
+		{
+			name:            "active again",
+			state:           "ACTIVE",
+			previouslyFalse: true,
+			condition:       corev1.ConditionTrue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &machinev1beta1.Machine{}
+			if tt.previouslyFalse {
+				conditions.MarkFalse(machine, InstanceActiveCondition, "InstancePAUSED", machinev1beta1.ConditionSeverityWarning, "Instance is paused")
+			}
+
+			setInstanceActiveCondition(machine, instance(tt.state))
+			condition := conditions.Get(machine, InstanceActiveCondition)
+			switch {
+			case tt.condition == "" && condition != nil:
+				t.Errorf("expected no condition, got %+v", condition)
+			case tt.condition != "" && condition == nil:
+				t.Errorf("expected condition %s, got none", tt.condition)
+			case tt.condition != "" && condition.Status != tt.condition:
+				t.Errorf("expected condition %s, got %s", tt.condition, condition.Status)
+			}
+
+			service := &fakeInactiveInstanceService{}
+			if err := reactivateInstance(instance(tt.state), service); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(service.unpaused) != tt.unpaused || len(service.resumed) != tt.resumed {
+				t.Errorf("expected %d unpaused and %d resumed instances, got %v and %v", tt.unpaused, tt.resumed, service.unpaused, service.resumed)
+			}
+		})
+	}
+}
+
+func TestValidateInactiveInstancePolicy(t *testing.T) {
+	for _, policy := range []clients.InactiveInstancePolicy{"", clients.InactiveInstancePolicyReport, clients.InactiveInstancePolicyResume} {
+		if err := validateInactiveInstancePolicy(policy); err != nil {
+			t.Errorf("unexpected error for %q: %v", policy, err)
+		}
+	}
+	if err := validateInactiveInstancePolicy("Unpause"); err == nil {
+		t.Errorf("expected an error for an invalid policy")
+	}
+}
@@ -0,0 +1,57 @@
+package machine
+
+import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+)
+
+// InstanceReadyCondition reports the state of the instance of a machine. It
+// is true while the instance is ACTIVE. Otherwise its reason is Instance
+// followed by the state, e.g. InstanceSHUTOFF. It replaces the
+// machine.openshift.io/instance-state annotation, which is still written
+// alongside it unless the annotation is disabled.
+const InstanceReadyCondition machinev1.ConditionType = "InstanceReady"
+
+// instanceStateBuild is the state of an instance which is being created.
+const instanceStateBuild = "BUILD"
+
+// setInstanceStateAnnotation sets the legacy instance-state annotation of the
+// machine to the state of its instance. If the annotation is disabled it is
+// removed instead, so that it doesn't go stale.
+func setInstanceStateAnnotation(machine *machinev1.Machine, state string, disabled bool) {
+	if disabled {
+		delete(machine.Annotations, maoMachine.MachineInstanceStateAnnotationName)
+		return
+	}
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[maoMachine.MachineInstanceStateAnnotationName] = state
+}
+
+// setInstanceReadyCondition reports the state of the instance in the
+// InstanceReady condition.
+func setInstanceReadyCondition(machine *machinev1.Machine, instanceID, state string) {
+	if state == string(capov1.InstanceStateActive) {
+		conditions.MarkTrue(machine, InstanceReadyCondition)
+		return
+	}
+
+	severity := machinev1.ConditionSeverityWarning
+	switch state {
+	case string(capov1.InstanceStateError):
+		severity = machinev1.ConditionSeverityError
+	case instanceStateBuild, instanceStateRebuild:
+		severity = machinev1.ConditionSeverityInfo
+	}
+	conditions.MarkFalse(machine, InstanceReadyCondition, "Instance"+state, severity, "Instance %s is %s", instanceID, state)
+}
+
+// hasInstanceState returns true if the state of the instance of the machine
+// has been recorded, in either the annotation or the condition.
+func hasInstanceState(machine *machinev1.Machine) bool {
+	return machine.Annotations[maoMachine.MachineInstanceStateAnnotationName] != "" ||
+		conditions.Get(machine, InstanceReadyCondition) != nil
+}
@@ -0,0 +1,72 @@
+package machine
+
+import (
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetInstanceStateAnnotation(t *testing.T) {
+	machine := &machinev1.Machine{}
+
+	setInstanceStateAnnotation(machine, "ACTIVE", false)
+	if state := machine.Annotations[maoMachine.MachineInstanceStateAnnotationName]; state != "ACTIVE" {
+		t.Errorf("Expected the instance-state annotation to be ACTIVE, got %q", state)
+	}
+
+	setInstanceStateAnnotation(machine, "SHUTOFF", true)
+	if state, ok := machine.Annotations[maoMachine.MachineInstanceStateAnnotationName]; ok {
+		t.Errorf("Expected the disabled instance-state annotation to be removed, got %q", state)
+	}
+}
+
+func TestSetInstanceReadyCondition(t *testing.T) {
+	tests := []struct {
+		state            string
+		expectedStatus   corev1.ConditionStatus
+		expectedReason   string
+		expectedSeverity machinev1.ConditionSeverity
+	}{
+		{
+			state:          "ACTIVE",
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			state:            "BUILD",
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   "InstanceBUILD",
+			expectedSeverity: machinev1.ConditionSeverityInfo,
+		},
+		{
+			state:            "SHUTOFF",
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   "InstanceSHUTOFF",
+			expectedSeverity: machinev1.ConditionSeverityWarning,
+		},
+		{
+			state:            "ERROR",
+			expectedStatus:   corev1.ConditionFalse,
+			expectedReason:   "InstanceERROR",
+			expectedSeverity: machinev1.ConditionSeverityError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			machine := &machinev1.Machine{}
+			setInstanceReadyCondition(machine, "instance-id", tt.state)
+
+			condition := conditions.Get(machine, InstanceReadyCondition)
+			if condition == nil {
+				t.Fatalf("Expected the %s condition to be set", InstanceReadyCondition)
+			}
+			if condition.Status != tt.expectedStatus || condition.Reason != tt.expectedReason || condition.Severity != tt.expectedSeverity {
+				t.Errorf("Expected status %s, reason %q and severity %q, got %s, %q and %q",
+					tt.expectedStatus, tt.expectedReason, tt.expectedSeverity, condition.Status, condition.Reason, condition.Severity)
+			}
+		})
+	}
+}
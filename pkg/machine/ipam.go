@@ -0,0 +1,131 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	ipamv1 "sigs.k8s.io/cluster-api/exp/ipam/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// resolveAddressClaims sets the addresses allocated to the IPAddressClaims of
+// the machine as fixed IPs of its ports. It returns a RequeueAfterError if a
+// claim has not been bound yet.
+func (oc *OpenstackClient) resolveAddressClaims(ctx context.Context, machine *machinev1.Machine, claims []clients.AddressClaim, instanceSpec *compute.InstanceSpec) error {
+	for _, claimRef := range claims {
+		claim := &ipamv1.IPAddressClaim{}
+		if err := oc.client.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: claimRef.Name}, claim); err != nil {
+			return fmt.Errorf("error getting IPAddressClaim %s: %w", claimRef.Name, err)
+		}
+
+		if claim.Status.AddressRef.Name == "" {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "WaitingForIPAddress", "Waiting for IPAddressClaim %s to be bound", claimRef.Name)
+			return &maoMachine.RequeueAfterError{RequeueAfter: 30 * time.Second}
+		}
+
+		address := &ipamv1.IPAddress{}
+		if err := oc.client.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: claim.Status.AddressRef.Name}, address); err != nil {
+			return fmt.Errorf("error getting IPAddress %s of IPAddressClaim %s: %w", claim.Status.AddressRef.Name, claimRef.Name, err)
+		}
+
+		if err := setPortAddress(instanceSpec.Ports, claimRef.PortIndex, address.Spec.Address); err != nil {
+			return maoMachine.InvalidMachineConfiguration("IPAddressClaim %s: %v", claimRef.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateAddressesFromPools checks that the pools are fully referenced.
+func validateAddressesFromPools(addressesFromPools []clients.AddressFromPool) error {
+	for i, addressFromPool := range addressesFromPools {
+		poolRef := addressFromPool.PoolRef
+		if poolRef.APIGroup == nil || *poolRef.APIGroup == "" || poolRef.Kind == "" || poolRef.Name == "" {
+			return fmt.Errorf("address from pool %d: poolRef must have an apiGroup, a kind and a name", i)
+		}
+	}
+	return nil
+}
+
+// addressClaimName returns the name of the IPAddressClaim created for the
+// machine from the pool with the given index in addressesFromPools.
+func addressClaimName(machine *machinev1.Machine, index int) string {
+	return fmt.Sprintf("%s-address-%d", machine.Name, index)
+}
+
+// newAddressClaim returns the IPAddressClaim of the machine for an address
+// from the pool with the given index in addressesFromPools. The claim is
+// owned by the machine, so that the address is released when the machine is
+// gone.
+func newAddressClaim(machine *machinev1.Machine, index int, poolRef corev1.TypedLocalObjectReference) *ipamv1.IPAddressClaim {
+	return &ipamv1.IPAddressClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      addressClaimName(machine, index),
+			Namespace: machine.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(machine, machinev1.GroupVersion.WithKind("Machine")),
+			},
+		},
+		Spec: ipamv1.IPAddressClaimSpec{
+			PoolRef: poolRef,
+		},
+	}
+}
+
+// ensureAddressClaims creates the IPAddressClaims of the machine for its
+// addressesFromPools, and returns references to them. It returns a
+// RequeueAfterError if a claim with the same name belongs to another machine,
+// e.g. to a deleted machine with the same name which is not gone yet.
+func (oc *OpenstackClient) ensureAddressClaims(ctx context.Context, machine *machinev1.Machine, addressesFromPools []clients.AddressFromPool) ([]clients.AddressClaim, error) {
+	var claims []clients.AddressClaim
+	for i, addressFromPool := range addressesFromPools {
+		claim := newAddressClaim(machine, i, addressFromPool.PoolRef)
+		if err := oc.client.Create(ctx, claim); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return nil, fmt.Errorf("error creating IPAddressClaim %s: %w", claim.Name, err)
+			}
+
+			existing := &ipamv1.IPAddressClaim{}
+			if err := oc.client.Get(ctx, client.ObjectKeyFromObject(claim), existing); err != nil {
+				return nil, fmt.Errorf("error getting IPAddressClaim %s: %w", claim.Name, err)
+			}
+			if !metav1.IsControlledBy(existing, machine) {
+				oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "WaitingForIPAddress", "Waiting for IPAddressClaim %s of another machine to be deleted", claim.Name)
+				return nil, &maoMachine.RequeueAfterError{RequeueAfter: 30 * time.Second}
+			}
+		} else {
+			oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "CreatedIPAddressClaim", "Created IPAddressClaim %s for an address from %s %s", claim.Name, addressFromPool.PoolRef.Kind, addressFromPool.PoolRef.Name)
+		}
+
+		claims = append(claims, clients.AddressClaim{Name: claim.Name, PortIndex: addressFromPool.PortIndex})
+	}
+	return claims, nil
+}
+
+// setPortAddress requests address as a fixed IP of the port with the given
+// index. The address is used for the first fixed IP which doesn't already
+// have one, so that it is allocated from the subnet requested there.
+func setPortAddress(ports []capov1.PortOpts, index int, address string) error {
+	if index < 0 || index >= len(ports) {
+		return fmt.Errorf("port index %d is out of range, the machine has %d ports", index, len(ports))
+	}
+
+	port := &ports[index]
+	for i := range port.FixedIPs {
+		if port.FixedIPs[i].IPAddress == "" {
+			port.FixedIPs[i].IPAddress = address
+			return nil
+		}
+	}
+	port.FixedIPs = append(port.FixedIPs, capov1.FixedIP{IPAddress: address})
+	return nil
+}
@@ -0,0 +1,99 @@
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+var inClusterPoolRef = corev1.TypedLocalObjectReference{
+	APIGroup: ptr.To("ipam.cluster.x-k8s.io"),
+	Kind:     "InClusterIPPool",
+	Name:     "machine-network",
+}
+
+func TestValidateAddressesFromPools(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(validateAddressesFromPools([]clients.AddressFromPool{{PoolRef: inClusterPoolRef}})).To(Succeed())
+	g.Expect(validateAddressesFromPools([]clients.AddressFromPool{{PoolRef: corev1.TypedLocalObjectReference{Kind: "InClusterIPPool", Name: "machine-network"}}})).NotTo(Succeed())
+	g.Expect(validateAddressesFromPools([]clients.AddressFromPool{{PoolRef: corev1.TypedLocalObjectReference{APIGroup: ptr.To("ipam.cluster.x-k8s.io"), Kind: "InClusterIPPool"}}})).NotTo(Succeed())
+}
+
+func TestNewAddressClaim(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{
+		Name:      "worker-0",
+		Namespace: "openshift-machine-api",
+		UID:       types.UID("3f9e2a1b-7c4d-4e5f-8a6b-9c0d1e2f3a4b"),
+	}}
+
+	claim := newAddressClaim(machine, 1, inClusterPoolRef)
+	g.Expect(claim.Name).To(Equal("worker-0-address-1"))
+	g.Expect(claim.Namespace).To(Equal("openshift-machine-api"))
+	g.Expect(claim.Spec.PoolRef).To(Equal(inClusterPoolRef))
+	g.Expect(metav1.IsControlledBy(claim, machine)).To(BeTrue())
+}
+
+func TestSetPortAddress(t *testing.T) {
+	subnet := &capov1.SubnetFilter{ID: "c8a5e7d3-0d8e-4b5c-9c3a-5f0e4b2a1d6c"}
+
+	tests := []struct {
+		name     string
+		ports    []capov1.PortOpts
+		index    int
+		expected []capov1.FixedIP
+		wantErr  bool
+	}{
+		{
+			name:     "port without fixed IPs",
+			ports:    []capov1.PortOpts{{}},
+			expected: []capov1.FixedIP{{IPAddress: "192.0.2.10"}},
+		},
+		{
+			name:     "fixed IP with a subnet",
+			ports:    []capov1.PortOpts{{FixedIPs: []capov1.FixedIP{{Subnet: subnet}}}},
+			expected: []capov1.FixedIP{{Subnet: subnet, IPAddress: "192.0.2.10"}},
+		},
+		{
+			name:     "fixed IP with an address",
+			ports:    []capov1.PortOpts{{FixedIPs: []capov1.FixedIP{{IPAddress: "192.0.2.20"}}}},
+			expected: []capov1.FixedIP{{IPAddress: "192.0.2.20"}, {IPAddress: "192.0.2.10"}},
+		},
+		{
+			name:     "second port",
+			ports:    []capov1.PortOpts{{}, {}},
+			index:    1,
+			expected: []capov1.FixedIP{{IPAddress: "192.0.2.10"}},
+		},
+		{
+			name:    "index out of range",
+			ports:   []capov1.PortOpts{{}},
+			index:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := setPortAddress(tt.ports, tt.index, "192.0.2.10")
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(tt.ports[tt.index].FixedIPs).To(Equal(tt.expected))
+		})
+	}
+}
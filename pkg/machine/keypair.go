@@ -0,0 +1,121 @@
+package machine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+)
+
+// keyPairService manages the keypairs of the user of the cloud.
+type keyPairService interface {
+	GetKeyPair(name string) (*keypairs.KeyPair, error)
+	CreateKeyPair(name, publicKey string) error
+}
+
+// validateSSHPublicKeySecret checks that the SSH public key Secret has a name
+// and a key, and that keyName isn't set too.
+func validateSSHPublicKeySecret(machineSpec *machinev1alpha1.OpenstackProviderSpec, secret *corev1.SecretKeySelector) error {
+	if secret == nil {
+		return nil
+	}
+	if machineSpec.KeyName != "" {
+		return fmt.Errorf("sshPublicKeySecret can't be set together with keyName")
+	}
+	if secret.Name == "" || secret.Key == "" {
+		return fmt.Errorf("sshPublicKeySecret must have a name and a key")
+	}
+	return nil
+}
+
+// parseSSHPublicKey returns the type and the base64 encoded key of an SSH
+// public key in the authorized_keys format. The comment and any options are
+// ignored.
+func parseSSHPublicKey(publicKey string) (string, string, error) {
+	fields := strings.Fields(publicKey)
+	for i := 0; i+1 < len(fields); i++ {
+		if !strings.HasPrefix(fields[i], "ssh-") && !strings.HasPrefix(fields[i], "ecdsa-") && !strings.HasPrefix(fields[i], "sk-") {
+			continue
+		}
+		if _, err := base64.StdEncoding.DecodeString(fields[i+1]); err != nil {
+			return "", "", fmt.Errorf("invalid SSH public key: %w", err)
+		}
+		return fields[i], fields[i+1], nil
+	}
+	return "", "", fmt.Errorf("invalid SSH public key: no key type and key found")
+}
+
+// keyPairName returns the name of the keypair for an SSH public key. It is
+// derived from the key, so that machines with the same key share a keypair
+// and a changed key gets a new keypair.
+func keyPairName(clusterID, keyType, key string) string {
+	if clusterID == "" {
+		clusterID = "openshift"
+	}
+	sum := sha256.Sum256([]byte(keyType + " " + key))
+	return fmt.Sprintf("%s-%s", clusterID, hex.EncodeToString(sum[:])[:16])
+}
+
+// getSSHPublicKey reads the SSH public key of the machine from its Secret.
+func getSSHPublicKey(ctx context.Context, machine *machinev1.Machine, secret *corev1.SecretKeySelector, kubeClient kubernetes.Interface) (string, error) {
+	s, err := kubeClient.CoreV1().Secrets(machine.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting SSH public key Secret %s: %w", secret.Name, err)
+	}
+	publicKey, ok := s.Data[secret.Key]
+	if !ok {
+		return "", fmt.Errorf("SSH public key Secret %s has no key %s", secret.Name, secret.Key)
+	}
+	return string(publicKey), nil
+}
+
+// ensureKeyPair returns the name of the keypair of the SSH public key, which
+// it creates if there is none. A keypair with the name and another key is an
+// error, as it was not created for this key.
+func ensureKeyPair(machine *machinev1.Machine, publicKey string, service keyPairService) (string, error) {
+	keyType, key, err := parseSSHPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	name := keyPairName(machine.Labels[machinev1.MachineClusterIDLabel], keyType, key)
+
+	keyPair, err := service.GetKeyPair(name)
+	if err != nil {
+		return "", fmt.Errorf("error getting keypair %s: %w", name, err)
+	}
+	if keyPair == nil {
+		err := service.CreateKeyPair(name, keyType+" "+key)
+		switch {
+		case err == nil:
+			klog.Infof("Machine %s: created keypair %s", machine.Name, name)
+			return name, nil
+		case !capoerrors.IsConflict(err):
+			return "", fmt.Errorf("error creating keypair %s: %w", name, err)
+		}
+		// Another machine created the keypair first
+		keyPair, err = service.GetKeyPair(name)
+		if err != nil {
+			return "", fmt.Errorf("error getting keypair %s: %w", name, err)
+		}
+		if keyPair == nil {
+			return "", fmt.Errorf("keypair %s was not found after a conflict creating it", name)
+		}
+	}
+
+	existingType, existingKey, err := parseSSHPublicKey(keyPair.PublicKey)
+	if err != nil || existingType != keyType || existingKey != key {
+		return "", fmt.Errorf("keypair %s has another public key than the SSH public key Secret", name)
+	}
+	return name, nil
+}
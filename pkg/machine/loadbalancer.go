@@ -0,0 +1,152 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// validateLoadBalancerPools returns an error if any of the load balancer pools
+// is invalid.
+func validateLoadBalancerPools(lbPools []clients.LoadBalancerPool) error {
+	for i, lbPool := range lbPools {
+		if lbPool.Pool == "" {
+			return fmt.Errorf("load balancer pool %d: pool must be set", i)
+		}
+		if lbPool.ProtocolPort < 1 || lbPool.ProtocolPort > 65535 {
+			return fmt.Errorf("load balancer pool %d: protocolPort %d is not a valid port", i, lbPool.ProtocolPort)
+		}
+	}
+	return nil
+}
+
+// reconcileLoadBalancerMembers adds the machine as a member of all its load
+// balancer pools which it isn't a member of yet. Members are named after the
+// machine, by which they are found.
+func reconcileLoadBalancerMembers(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus, scope scope.Scope) error {
+	if len(extensions.LoadBalancerPools) == 0 {
+		return nil
+	}
+
+	lbClient, err := scope.NewLbClient()
+	if err != nil {
+		return err
+	}
+	networkClient, err := scope.NewNetworkClient()
+	if err != nil {
+		return err
+	}
+
+	instancePorts, err := networkClient.ListPort(ports.ListOpts{DeviceID: instanceStatus.ID()})
+	if err != nil {
+		return fmt.Errorf("list ports of instance err: %v", err)
+	}
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+
+	for i, lbPool := range extensions.LoadBalancerPools {
+		_, address, err := selectPortFixedIP(machine.Name, portOpts, instancePorts, lbPool.PortIndex, lbPool.SubnetID)
+		if err != nil {
+			return maoMachine.InvalidMachineConfiguration("load balancer pool %d: %v", i, err)
+		}
+
+		pool, err := getPool(lbClient, lbPool.Pool)
+		if err != nil {
+			return err
+		}
+		if pool == nil {
+			return maoMachine.InvalidMachineConfiguration("load balancer pool %d: pool %s does not exist", i, lbPool.Pool)
+		}
+
+		members, err := lbClient.ListPoolMember(pool.ID, pools.ListMembersOpts{Name: machine.Name, ProtocolPort: lbPool.ProtocolPort})
+		if err != nil {
+			return fmt.Errorf("list members of pool %s err: %v", pool.ID, err)
+		}
+		if len(members) > 0 {
+			continue
+		}
+
+		member, err := lbClient.CreatePoolMember(pool.ID, pools.CreateMemberOpts{
+			Name:         machine.Name,
+			Address:      address,
+			ProtocolPort: lbPool.ProtocolPort,
+			SubnetID:     lbPool.SubnetID,
+		})
+		if err != nil {
+			capoRecorder.Warnf(machine, "FailedCreatePoolMember", "Failed to add %s:%d to load balancer pool %s: %v", address, lbPool.ProtocolPort, pool.ID, err)
+			return fmt.Errorf("create member of pool %s err: %v", pool.ID, err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulCreatePoolMember", "Added %s:%d to load balancer pool %s as member %s", address, lbPool.ProtocolPort, pool.ID, member.ID)
+	}
+	return nil
+}
+
+// deleteLoadBalancerMembers removes the machine from all its load balancer
+// pools. Pools which no longer exist are ignored.
+func deleteLoadBalancerMembers(machine *machinev1.Machine, extensions *clients.ProviderSpecExtensions, scope scope.Scope) error {
+	if len(extensions.LoadBalancerPools) == 0 {
+		return nil
+	}
+
+	lbClient, err := scope.NewLbClient()
+	if err != nil {
+		return err
+	}
+
+	for _, lbPool := range extensions.LoadBalancerPools {
+		pool, err := getPool(lbClient, lbPool.Pool)
+		if err != nil {
+			return err
+		}
+		if pool == nil {
+			continue
+		}
+
+		members, err := lbClient.ListPoolMember(pool.ID, pools.ListMembersOpts{Name: machine.Name, ProtocolPort: lbPool.ProtocolPort})
+		if err != nil {
+			return fmt.Errorf("list members of pool %s err: %v", pool.ID, err)
+		}
+		for _, member := range members {
+			if err := lbClient.DeletePoolMember(pool.ID, member.ID); err != nil && !capoerrors.IsNotFound(err) {
+				capoRecorder.Warnf(machine, "FailedDeletePoolMember", "Failed to remove member %s from load balancer pool %s: %v", member.ID, pool.ID, err)
+				return fmt.Errorf("delete member of pool %s err: %v", pool.ID, err)
+			}
+			capoRecorder.Eventf(machine, "SuccessfulDeletePoolMember", "Removed member %s from load balancer pool %s", member.ID, pool.ID)
+		}
+	}
+	return nil
+}
+
+// getPool returns the pool with the given name or ID, or nil if it doesn't
+// exist.
+func getPool(lbClient capoclients.LbClient, nameOrID string) (*pools.Pool, error) {
+	poolList, err := lbClient.ListPools(pools.ListOpts{ID: nameOrID})
+	if err != nil {
+		return nil, fmt.Errorf("list pools err: %v", err)
+	}
+	if len(poolList) == 0 {
+		poolList, err = lbClient.ListPools(pools.ListOpts{Name: nameOrID})
+		if err != nil {
+			return nil, fmt.Errorf("list pools err: %v", err)
+		}
+	}
+
+	switch len(poolList) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &poolList[0], nil
+	default:
+		return nil, maoMachine.InvalidMachineConfiguration("there are %d load balancer pools named %s", len(poolList), nameOrID)
+	}
+}
@@ -0,0 +1,123 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	capomock "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients/mock"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+const (
+	ingressPoolID = "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a"
+	memberID      = "e9d8c7b6-a5f4-4e3d-2c1b-0a9f8e7d6c5b"
+)
+
+func TestReconcileLoadBalancerMembers(t *testing.T) {
+	const instanceID = "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"
+
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"}},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		LoadBalancerPools: []clients.LoadBalancerPool{{Pool: "ingress-https", ProtocolPort: 443}},
+	}
+	instanceStatus := compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID}}, logr.Discard())
+
+	tests := []struct {
+		name   string
+		expect func(lb *capomock.MockLbClientMockRecorder)
+	}{
+		{
+			name: "not a member",
+			expect: func(lb *capomock.MockLbClientMockRecorder) {
+				lb.ListPoolMember(ingressPoolID, pools.ListMembersOpts{Name: "worker-0", ProtocolPort: 443}).Return(nil, nil)
+				lb.CreatePoolMember(ingressPoolID, pools.CreateMemberOpts{
+					Name:         "worker-0",
+					Address:      "192.0.2.10",
+					ProtocolPort: 443,
+				}).Return(&pools.Member{ID: memberID}, nil)
+			},
+		},
+		{
+			name: "already a member",
+			expect: func(lb *capomock.MockLbClientMockRecorder) {
+				lb.ListPoolMember(ingressPoolID, pools.ListMembersOpts{Name: "worker-0", ProtocolPort: 443}).
+					Return([]pools.Member{{ID: memberID, Name: "worker-0", Address: "192.0.2.10", ProtocolPort: 443}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			mockScopeFactory.NetworkClient.EXPECT().ListPort(ports.ListOpts{DeviceID: instanceID}).Return([]ports.Port{{
+				ID:       "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60",
+				Name:     "worker-0-0",
+				FixedIPs: []ports.IP{{IPAddress: "192.0.2.10"}},
+			}}, nil)
+			lbClient := mockScopeFactory.LbClient.EXPECT()
+			lbClient.ListPools(pools.ListOpts{ID: "ingress-https"}).Return(nil, nil)
+			lbClient.ListPools(pools.ListOpts{Name: "ingress-https"}).Return([]pools.Pool{{ID: ingressPoolID, Name: "ingress-https"}}, nil)
+			tt.expect(lbClient)
+
+			if err := reconcileLoadBalancerMembers(machine, machineSpec, extensions, instanceStatus, mockScopeFactory); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteLoadBalancerMembers(t *testing.T) {
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	extensions := &clients.ProviderSpecExtensions{
+		LoadBalancerPools: []clients.LoadBalancerPool{{Pool: ingressPoolID, ProtocolPort: 443}},
+	}
+
+	tests := []struct {
+		name   string
+		expect func(lb *capomock.MockLbClientMockRecorder)
+	}{
+		{
+			name: "member",
+			expect: func(lb *capomock.MockLbClientMockRecorder) {
+				lb.ListPools(pools.ListOpts{ID: ingressPoolID}).Return([]pools.Pool{{ID: ingressPoolID}}, nil)
+				lb.ListPoolMember(ingressPoolID, pools.ListMembersOpts{Name: "worker-0", ProtocolPort: 443}).
+					Return([]pools.Member{{ID: memberID}}, nil)
+				lb.DeletePoolMember(ingressPoolID, memberID).Return(nil)
+			},
+		},
+		{
+			name: "pool deleted",
+			expect: func(lb *capomock.MockLbClientMockRecorder) {
+				lb.ListPools(pools.ListOpts{ID: ingressPoolID}).Return(nil, nil)
+				lb.ListPools(pools.ListOpts{Name: ingressPoolID}).Return(nil, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			tt.expect(mockScopeFactory.LbClient.EXPECT())
+
+			if err := deleteLoadBalancerMembers(machine, extensions, mockScopeFactory); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
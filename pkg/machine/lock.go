@@ -0,0 +1,53 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// InstanceUnlockedCondition is false while the instance of a machine which is
+// being deleted is locked.
+const InstanceUnlockedCondition machinev1.ConditionType = "InstanceUnlocked"
+
+// lockedRequeueAfter is how often we check whether a locked instance has been
+// unlocked. Locks are set by people, so there is no point checking often.
+const lockedRequeueAfter = 5 * time.Minute
+
+// checkInstanceLocked returns an error if the instance is locked. Requests to
+// delete a locked instance fail until whoever locked it unlocks it, so instead
+// of making them we report the lock in a condition and requeue.
+func (oc *OpenstackClient) checkInstanceLocked(ctx context.Context, machine *machinev1.Machine, instanceStatus *compute.InstanceStatus, instanceService *clients.InstanceService) error {
+	locked, err := instanceService.IsServerLocked(instanceStatus.ID())
+	if err != nil {
+		return fmt.Errorf("error checking whether instance %s is locked: %w", instanceStatus.ID(), err)
+	}
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	if locked {
+		conditions.MarkFalse(machine, InstanceUnlockedCondition, "InstanceLocked", machinev1.ConditionSeverityWarning,
+			"Instance %s is locked and can't be deleted until it is unlocked", instanceStatus.ID())
+	} else if conditions.Get(machine, InstanceUnlockedCondition) != nil {
+		conditions.MarkTrue(machine, InstanceUnlockedCondition)
+	} else {
+		return nil
+	}
+	if err := oc.client.Status().Patch(ctx, machine, patch); err != nil {
+		return fmt.Errorf("error patching status of %q: %w", machine.Name, err)
+	}
+
+	if locked {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InstanceLocked", "Instance %s is locked and can't be deleted until it is unlocked", instanceStatus.ID())
+		return &maoMachine.RequeueAfterError{RequeueAfter: lockedRequeueAfter}
+	}
+	return nil
+}
@@ -19,15 +19,14 @@ package machine
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"text/template"
 
-	clconfig "github.com/coreos/container-linux-config-transpiler/config"
 	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	"github.com/openshift/machine-api-provider-openstack/pkg/bootstrap"
 	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -95,6 +94,7 @@ func (oc *OpenstackClient) getUserData(machine *machinev1.Machine, providerSpec
 	var disableTemplating bool
 	var postprocessor string
 	var postprocess bool
+	var userDataSecret *corev1.Secret
 
 	userData := []byte{}
 	if providerSpec.UserDataSecret != nil {
@@ -107,7 +107,8 @@ func (oc *OpenstackClient) getUserData(machine *machinev1.Machine, providerSpec
 			return "", fmt.Errorf("UserDataSecret name must be provided")
 		}
 
-		userDataSecret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), providerSpec.UserDataSecret.Name, metav1.GetOptions{})
+		var err error
+		userDataSecret, err = kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), providerSpec.UserDataSecret.Name, metav1.GetOptions{})
 		if err != nil {
 			return "", err
 		}
@@ -150,28 +151,9 @@ func (oc *OpenstackClient) getUserData(machine *machinev1.Machine, providerSpec
 	}
 
 	if postprocess {
-		switch postprocessor {
-		// Postprocess with the Container Linux ct transpiler.
-		case "ct":
-			clcfg, ast, report := clconfig.Parse([]byte(userDataRendered))
-			if len(report.Entries) > 0 {
-				return "", fmt.Errorf("postprocessor error: %s", report.String())
-			}
-
-			ignCfg, report := clconfig.Convert(clcfg, "openstack-metadata", ast)
-			if len(report.Entries) > 0 {
-				return "", fmt.Errorf("postprocessor error: %s", report.String())
-			}
-
-			ud, err := json.Marshal(&ignCfg)
-			if err != nil {
-				return "", fmt.Errorf("postprocessor error: %s", err)
-			}
-
-			userDataRendered = string(ud)
-
-		default:
-			return "", fmt.Errorf("postprocessor error: unknown postprocessor: '%s'", postprocessor)
+		userDataRendered, err = postprocessUserData(postprocessor, userDataRendered, userDataSecret)
+		if err != nil {
+			return "", fmt.Errorf("postprocessor error: %w", err)
 		}
 	}
 
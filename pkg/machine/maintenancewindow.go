@@ -0,0 +1,256 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MaintenanceWindowAnnotationKey is the annotation of a MachineSet which
+// restricts disruptive actions on the instances of its machines, rebuilds and
+// reboots, to a recurring window. Its value is a cron schedule of five fields,
+// minute, hour, day of month, month and day of week, in UTC, at which the
+// window opens, followed by how long it stays open, e.g. "0 2 * * 6 4h".
+const MaintenanceWindowAnnotationKey = "machine.openshift.io/openstack-maintenance-window"
+
+// DisruptiveActionsAllowedCondition is false while disruptive actions on the
+// instance of a machine are deferred until the maintenance window of its
+// MachineSet opens.
+const DisruptiveActionsAllowedCondition machinev1.ConditionType = "DisruptiveActionsAllowed"
+
+// maintenanceWindowRequeueAfter is how often at most we check whether the
+// maintenance window of a machine with deferred actions has opened, so that
+// changes to the window are picked up.
+const maintenanceWindowRequeueAfter = time.Hour
+
+// maxMaintenanceWindowDuration is how long a maintenance window may stay open
+// at most.
+const maxMaintenanceWindowDuration = 7 * 24 * time.Hour
+
+// maintenanceWindowSearchLimit is how far ahead we look for the next opening
+// of a maintenance window.
+const maintenanceWindowSearchLimit = 366 * 24 * time.Hour
+
+// maintenanceWindow is a parsed MaintenanceWindowAnnotationKey.
+type maintenanceWindow struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	// A day matches if either its day of month or its day of week
+	// matches, unless one of them is unrestricted
+	anyDayOfMonth, anyDayOfWeek bool
+	duration                    time.Duration
+}
+
+// parseCronField returns the bitset of the values in [min, max] matched by a
+// cron field, and whether it is "*".
+func parseCronField(field string, min, max int) (uint64, bool, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step < 1 {
+				return 0, false, fmt.Errorf("invalid step %q in %q", stepSpec, field)
+			}
+		}
+
+		first, last := min, max
+		if rangeSpec != "*" {
+			firstSpec, lastSpec, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if first, err = strconv.Atoi(firstSpec); err != nil {
+				return 0, false, fmt.Errorf("invalid value %q in %q", firstSpec, field)
+			}
+			last = first
+			if isRange {
+				if last, err = strconv.Atoi(lastSpec); err != nil {
+					return 0, false, fmt.Errorf("invalid value %q in %q", lastSpec, field)
+				}
+			} else if hasStep {
+				last = max
+			}
+			if first < min || last > max || first > last {
+				return 0, false, fmt.Errorf("%q is not within %d-%d", rangeSpec, min, max)
+			}
+		}
+
+		for value := first; value <= last; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, field == "*", nil
+}
+
+// parseMaintenanceWindow parses the value of MaintenanceWindowAnnotationKey.
+// Days of week are 0 to 7, where both 0 and 7 are Sunday.
+func parseMaintenanceWindow(value string) (*maintenanceWindow, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%q is not a cron schedule of five fields followed by a duration", value)
+	}
+
+	window := &maintenanceWindow{}
+	var err error
+	if window.minutes, _, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if window.hours, _, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if window.daysOfMonth, window.anyDayOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if window.months, _, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if window.daysOfWeek, window.anyDayOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	if window.daysOfWeek&(1<<7) != 0 {
+		window.daysOfWeek |= 1
+	}
+
+	window.duration, err = time.ParseDuration(fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("duration: %v", err)
+	}
+	if window.duration < time.Minute || window.duration > maxMaintenanceWindowDuration {
+		return nil, fmt.Errorf("duration %s is not between 1m and %s", window.duration, maxMaintenanceWindowDuration)
+	}
+	return window, nil
+}
+
+// matchesDay returns true if the window may open on the day of t.
+func (w *maintenanceWindow) matchesDay(t time.Time) bool {
+	if w.months&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := w.daysOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := w.daysOfWeek&(1<<int(t.Weekday())) != 0
+	switch {
+	case w.anyDayOfMonth && w.anyDayOfWeek:
+		return true
+	case w.anyDayOfMonth:
+		return dayOfWeek
+	case w.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+// opensAt returns true if the window opens at the minute of t.
+func (w *maintenanceWindow) opensAt(t time.Time) bool {
+	return w.matchesDay(t) && w.hours&(1<<t.Hour()) != 0 && w.minutes&(1<<t.Minute()) != 0
+}
+
+// nextOpening returns when the window is open next: now if it is open, or
+// when it opens. It returns false if it doesn't open within a year.
+func (w *maintenanceWindow) nextOpening(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	for t := now.Truncate(time.Minute); t.After(now.Add(-w.duration)); t = t.Add(-time.Minute) {
+		if w.opensAt(t) {
+			return now, true
+		}
+	}
+
+	// Whole days and hours in which the window doesn't open are skipped
+	t := now.Truncate(time.Minute).Add(time.Minute)
+	for limit := now.Add(maintenanceWindowSearchLimit); t.Before(limit); {
+		switch {
+		case !w.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case w.hours&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case w.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hasDisruptiveActions returns true if a disruptive action on the instance of
+// machine is pending: a requested rebuild, or the reboot after its root
+// volume was extended.
+func hasDisruptiveActions(machine *machinev1.Machine) bool {
+	_, rebuild := machine.Annotations[RebuildAnnotationKey]
+	_, reboot := machine.Annotations[RootVolumeRebootPendingAnnotationKey]
+	return rebuild || reboot
+}
+
+// disruptionDeferral returns how long the disruptive actions on the instance
+// of machine are deferred, or zero if they are allowed now, and a message
+// explaining the deferral. Actions are only deferred if the MachineSet of the
+// machine has a maintenance window; if its window is invalid they are
+// deferred until it is fixed.
+func disruptionDeferral(machine *machinev1.Machine, machineSet *machinev1.MachineSet, now time.Time) (time.Duration, string, string) {
+	if machineSet == nil || !hasDisruptiveActions(machine) {
+		return 0, "", ""
+	}
+	value, ok := machineSet.Annotations[MaintenanceWindowAnnotationKey]
+	if !ok {
+		return 0, "", ""
+	}
+
+	window, err := parseMaintenanceWindow(value)
+	if err != nil {
+		return maintenanceWindowRequeueAfter, "InvalidMaintenanceWindow",
+			fmt.Sprintf("Disruptive actions are deferred, since the maintenance window of MachineSet %s is invalid: %v", machineSet.Name, err)
+	}
+	opening, ok := window.nextOpening(now)
+	if !ok {
+		return maintenanceWindowRequeueAfter, "InvalidMaintenanceWindow",
+			fmt.Sprintf("Disruptive actions are deferred, since the maintenance window %q of MachineSet %s never opens", value, machineSet.Name)
+	}
+	if !opening.After(now) {
+		return 0, "", ""
+	}
+	return min(opening.Sub(now), maintenanceWindowRequeueAfter), "OutsideMaintenanceWindow",
+		fmt.Sprintf("Disruptive actions are deferred until the maintenance window of MachineSet %s opens at %s", machineSet.Name, opening.Format(time.RFC3339))
+}
+
+// checkMaintenanceWindow returns how long the disruptive actions on the
+// instance of machine are deferred by the maintenance window of its
+// MachineSet, or zero if they are allowed now. The deferral is reported in the
+// DisruptiveActionsAllowed condition of the machine.
+func (oc *OpenstackClient) checkMaintenanceWindow(ctx context.Context, machine *machinev1.Machine) (time.Duration, error) {
+	var machineSet *machinev1.MachineSet
+	if hasDisruptiveActions(machine) {
+		var err error
+		machineSet, err = oc.getMachineSet(ctx, machine)
+		if err != nil {
+			return 0, err
+		}
+	}
+	deferral, reason, message := disruptionDeferral(machine, machineSet, time.Now())
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	if deferral > 0 {
+		if condition := conditions.Get(machine, DisruptiveActionsAllowedCondition); condition != nil && condition.Reason == reason && condition.Message == message {
+			return deferral, nil
+		}
+		conditions.MarkFalse(machine, DisruptiveActionsAllowedCondition, reason, machinev1.ConditionSeverityInfo, "%s", message)
+	} else if condition := conditions.Get(machine, DisruptiveActionsAllowedCondition); condition != nil && condition.Status != corev1.ConditionTrue {
+		conditions.MarkTrue(machine, DisruptiveActionsAllowedCondition)
+	} else {
+		return 0, nil
+	}
+	if err := oc.client.Status().Patch(ctx, machine, patch); err != nil {
+		return 0, fmt.Errorf("error patching status of %q: %w", machine.Name, err)
+	}
+
+	if deferral > 0 {
+		oc.eventRecorder.Event(machine, corev1.EventTypeNormal, "DeferredDisruptiveActions", message)
+	}
+	return deferral, nil
+}
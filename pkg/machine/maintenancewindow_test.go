@@ -0,0 +1,183 @@
+package machine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	for _, value := range []string{
+		"0 2 * * 6 4h",
+		"*/15 1-3,22 1,15 * 1-5 30m",
+		"30 0 * 1/3 7 168h",
+	} {
+		if _, err := parseMaintenanceWindow(value); err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", value, err)
+		}
+	}
+
+	for _, value := range []string{
+		"0 2 * * 6",
+		"60 2 * * 6 4h",
+		"0 2 0 * * 4h",
+		"0 5-3 * * * 4h",
+		"0 */0 * * * 4h",
+		"0 2 * * sat 4h",
+		"0 2 * * 6 forever",
+		"0 2 * * 6 30s",
+		"0 2 * * 6 200h",
+	} {
+		if _, err := parseMaintenanceWindow(value); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestMaintenanceWindowNextOpening(t *testing.T) {
+	// 2024-03-06 is a Wednesday
+	wednesday := time.Date(2024, 3, 6, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		name     string
+		window   string
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			name:     "open",
+			window:   "0 12 * * * 1h",
+			now:      wednesday,
+			expected: wednesday,
+		},
+		{
+			name:     "open since the previous day",
+			window:   "0 22 * * 2 24h",
+			now:      wednesday,
+			expected: wednesday,
+		},
+		{
+			name:     "closed",
+			window:   "0 12 * * * 30m",
+			now:      wednesday,
+			expected: time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "later today",
+			window:   "*/20 13-14 * * * 10m",
+			now:      wednesday,
+			expected: time.Date(2024, 3, 6, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "on Sundays",
+			window:   "0 2 * * 7 4h",
+			now:      wednesday,
+			expected: time.Date(2024, 3, 10, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "on the first of the month or on Fridays",
+			window:   "0 0 1 * 5 1h",
+			now:      wednesday,
+			expected: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "next year",
+			window:   "0 0 1 1 * 1h",
+			now:      wednesday,
+			expected: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := parseMaintenanceWindow(tt.window)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			opening, ok := window.nextOpening(tt.now)
+			if !ok || !opening.Equal(tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, opening)
+			}
+		})
+	}
+
+	window, err := parseMaintenanceWindow("0 0 30 2 * 1h")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := window.nextOpening(wednesday); ok {
+		t.Errorf("Expected a window on February 30 to never open")
+	}
+}
+
+func TestDisruptionDeferral(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	rebuild := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RebuildAnnotationKey: ""}}}
+	machineSet := func(window string) *machinev1.MachineSet {
+		return &machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: "workers", Annotations: map[string]string{MaintenanceWindowAnnotationKey: window}}}
+	}
+
+	tests := []struct {
+		name       string
+		machine    *machinev1.Machine
+		machineSet *machinev1.MachineSet
+		deferral   time.Duration
+		reason     string
+	}{
+		{
+			name:       "no disruptive actions",
+			machine:    &machinev1.Machine{},
+			machineSet: machineSet("0 2 * * 6 4h"),
+		},
+		{
+			name:    "no MachineSet",
+			machine: rebuild,
+		},
+		{
+			name:       "no maintenance window",
+			machine:    rebuild,
+			machineSet: &machinev1.MachineSet{},
+		},
+		{
+			name:       "inside the maintenance window",
+			machine:    rebuild,
+			machineSet: machineSet("0 11 * * * 2h"),
+		},
+		{
+			name: "reboot outside the maintenance window",
+			machine: &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				RootVolumeResizeAnnotationKey:        RootVolumeResizeExtendAndReboot,
+				RootVolumeRebootPendingAnnotationKey: "",
+			}}},
+			machineSet: machineSet("30 12 * * * 1h"),
+			deferral:   30 * time.Minute,
+			reason:     "OutsideMaintenanceWindow",
+		},
+		{
+			name:       "rebuild outside the maintenance window",
+			machine:    rebuild,
+			machineSet: machineSet("0 2 * * 6 4h"),
+			deferral:   maintenanceWindowRequeueAfter,
+			reason:     "OutsideMaintenanceWindow",
+		},
+		{
+			name:       "invalid maintenance window",
+			machine:    rebuild,
+			machineSet: machineSet("weekends"),
+			deferral:   maintenanceWindowRequeueAfter,
+			reason:     "InvalidMaintenanceWindow",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deferral, reason, message := disruptionDeferral(tt.machine, tt.machineSet, now)
+			if deferral != tt.deferral || reason != tt.reason {
+				t.Errorf("Expected %s %q, got %s %q", tt.deferral, tt.reason, deferral, reason)
+			}
+			if reason != "" && !strings.Contains(message, "MachineSet workers") {
+				t.Errorf("Expected the message to name the MachineSet, got %q", message)
+			}
+		})
+	}
+}
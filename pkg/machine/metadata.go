@@ -0,0 +1,156 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Keys of the server metadata which identify the OpenShift objects owning the
+// server, for chargeback and auditing in the cloud. They are set on every
+// server and can't be set in serverMetadata.
+const (
+	// ServerMetadataClusterIDKey is the infrastructure ID of the cluster
+	ServerMetadataClusterIDKey = "openshift-cluster-id"
+
+	// ServerMetadataNamespaceKey is the namespace of the machine
+	ServerMetadataNamespaceKey = "openshift-machine-namespace"
+
+	// ServerMetadataMachineSetKey is the name of the MachineSet of the
+	// machine, if it has one
+	ServerMetadataMachineSetKey = "openshift-machineset"
+
+	// ServerMetadataMachineUIDKey is the UID of the machine
+	ServerMetadataMachineUIDKey = "openshift-machine-uid"
+)
+
+// metadataVariables are the variables which can be used in the values of the
+// server metadata.
+type metadataVariables struct {
+	// MachineName is the name of the machine
+	MachineName string
+
+	// ClusterID is the infrastructure ID of the cluster of the machine
+	ClusterID string
+
+	// AZ is the availability zone of the instance
+	AZ string
+}
+
+// newMetadataVariables returns the values of the template variables for the
+// machine.
+func newMetadataVariables(machine *machinev1.Machine, availabilityZone string) metadataVariables {
+	return metadataVariables{
+		MachineName: machine.Name,
+		ClusterID:   machine.Labels[machinev1.MachineClusterIDLabel],
+		AZ:          availabilityZone,
+	}
+}
+
+// renderTemplate returns value with its template variables replaced.
+func renderTemplate(name, value string, variables metadataVariables) (string, error) {
+	// Values without actions are used as they are
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %w", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, variables); err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// renderServerMetadata returns the server metadata with the template variables
+// in its values replaced by their values for the machine, so that MachineSets
+// can share otherwise identical metadata.
+func renderServerMetadata(machine *machinev1.Machine, metadata map[string]string, availabilityZone string) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return metadata, nil
+	}
+
+	variables := newMetadataVariables(machine, availabilityZone)
+	rendered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		var err error
+		if rendered[key], err = renderTemplate("server metadata "+key, value, variables); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// identityServerMetadata returns the server metadata which identifies the
+// machine and its owners. Keys whose values are unknown are left out.
+func identityServerMetadata(machine *machinev1.Machine) map[string]string {
+	identity := map[string]string{
+		ServerMetadataClusterIDKey:  machine.Labels[machinev1.MachineClusterIDLabel],
+		ServerMetadataNamespaceKey:  machine.Namespace,
+		ServerMetadataMachineUIDKey: string(machine.UID),
+	}
+	if ref := metav1.GetControllerOf(machine); ref != nil && ref.Kind == "MachineSet" {
+		identity[ServerMetadataMachineSetKey] = ref.Name
+	}
+	for key, value := range identity {
+		if value == "" {
+			delete(identity, key)
+		}
+	}
+	return identity
+}
+
+// addIdentityServerMetadata returns the server metadata with the identity of
+// the machine added to it.
+func addIdentityServerMetadata(machine *machinev1.Machine, metadata map[string]string) map[string]string {
+	identity := identityServerMetadata(machine)
+	if len(identity) == 0 {
+		return metadata
+	}
+
+	merged := make(map[string]string, len(metadata)+len(identity))
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range identity {
+		merged[key] = value
+	}
+	return merged
+}
+
+// validateServerMetadata checks that the server metadata doesn't set the keys
+// which identify the machine.
+func validateServerMetadata(metadata map[string]string) error {
+	for _, key := range []string{ServerMetadataClusterIDKey, ServerMetadataNamespaceKey, ServerMetadataMachineSetKey, ServerMetadataMachineUIDKey} {
+		if _, ok := metadata[key]; ok {
+			return fmt.Errorf("server metadata key %s is reserved for the identity of the machine", key)
+		}
+	}
+	return nil
+}
+
+// renderPortDNSName returns the dns_name of the primary port of the machine,
+// which may use the same template variables as the server metadata. It
+// returns an error if it isn't a valid DNS name.
+func renderPortDNSName(machine *machinev1.Machine, portDNSName string, availabilityZone string) (string, error) {
+	if portDNSName == "" {
+		return "", nil
+	}
+
+	dnsName, err := renderTemplate("portDNSName", portDNSName, newMetadataVariables(machine, availabilityZone))
+	if err != nil {
+		return "", err
+	}
+	// Neutron accepts fully qualified names with a trailing dot
+	if msgs := validation.IsDNS1123Subdomain(strings.TrimSuffix(dnsName, ".")); len(msgs) > 0 {
+		return "", fmt.Errorf("portDNSName %q is not a valid DNS name: %s", dnsName, strings.Join(msgs, "; "))
+	}
+	return dnsName, nil
+}
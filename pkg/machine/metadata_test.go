@@ -0,0 +1,209 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderServerMetadata(t *testing.T) {
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cluster-id-worker-0-abcde",
+			Labels: map[string]string{machinev1.MachineClusterIDLabel: "cluster-id"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		metadata  map[string]string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name: "no templates",
+			metadata: map[string]string{
+				"name":     "bob",
+				"nickname": "bobbert",
+			},
+			expected: map[string]string{
+				"name":     "bob",
+				"nickname": "bobbert",
+			},
+		},
+		{
+			name: "templates",
+			metadata: map[string]string{
+				"hostname": "{{ .MachineName }}",
+				"owner":    "team-a/{{.ClusterID}}",
+				"zone":     "{{ .AZ }}",
+			},
+			expected: map[string]string{
+				"hostname": "cluster-id-worker-0-abcde",
+				"owner":    "team-a/cluster-id",
+				"zone":     "az1",
+			},
+		},
+		{
+			name:      "unknown variable",
+			metadata:  map[string]string{"region": "{{ .Region }}"},
+			expectErr: true,
+		},
+		{
+			name:      "invalid template",
+			metadata:  map[string]string{"hostname": "{{ .MachineName"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := renderServerMetadata(machine, tt.metadata, "az1")
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got metadata %v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected metadata %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderPortDNSName(t *testing.T) {
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cluster-id-worker-0-abcde",
+			Labels: map[string]string{machinev1.MachineClusterIDLabel: "cluster-id"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		portDNSName string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:        "machine name",
+			portDNSName: "{{ .MachineName }}",
+			expected:    "cluster-id-worker-0-abcde",
+		},
+		{
+			name:        "fully qualified name",
+			portDNSName: "{{ .MachineName }}.{{ .ClusterID }}.example.com.",
+			expected:    "cluster-id-worker-0-abcde.cluster-id.example.com.",
+		},
+		{
+			name:        "invalid DNS name",
+			portDNSName: "{{ .MachineName }}_{{ .AZ }}",
+			expectErr:   true,
+		},
+		{
+			name:        "unknown variable",
+			portDNSName: "{{ .Region }}",
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := renderPortDNSName(machine, tt.portDNSName, "az1")
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got DNS name %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected DNS name %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAddIdentityServerMetadata(t *testing.T) {
+	isController := true
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster-id-worker-0-abcde",
+			Namespace: "openshift-machine-api",
+			UID:       "9d0e8a5c-6f3b-4a2e-8c1d-7b6a5f4e3d2c",
+			Labels:    map[string]string{machinev1.MachineClusterIDLabel: "cluster-id"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "MachineSet", Name: "cluster-id-worker-0", Controller: &isController},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		machine  *machinev1.Machine
+		metadata map[string]string
+		expected map[string]string
+	}{
+		{
+			name:     "machine of a MachineSet",
+			machine:  machine,
+			metadata: map[string]string{"owner": "team-a"},
+			expected: map[string]string{
+				"owner":                     "team-a",
+				ServerMetadataClusterIDKey:  "cluster-id",
+				ServerMetadataNamespaceKey:  "openshift-machine-api",
+				ServerMetadataMachineSetKey: "cluster-id-worker-0",
+				ServerMetadataMachineUIDKey: "9d0e8a5c-6f3b-4a2e-8c1d-7b6a5f4e3d2c",
+			},
+		},
+		{
+			name: "machine without a MachineSet",
+			machine: &machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cluster-id-master-0",
+					Namespace: "openshift-machine-api",
+					UID:       "1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b",
+				},
+			},
+			expected: map[string]string{
+				ServerMetadataNamespaceKey:  "openshift-machine-api",
+				ServerMetadataMachineUIDKey: "1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b",
+			},
+		},
+		{
+			name:     "nothing known",
+			machine:  &machinev1.Machine{},
+			metadata: map[string]string{"owner": "team-a"},
+			expected: map[string]string{"owner": "team-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addIdentityServerMetadata(tt.machine, tt.metadata)
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected metadata %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateServerMetadata(t *testing.T) {
+	if err := validateServerMetadata(map[string]string{"owner": "team-a"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateServerMetadata(map[string]string{ServerMetadataMachineUIDKey: "spoofed"}); err == nil {
+		t.Errorf("Expected an error for a reserved key")
+	}
+}
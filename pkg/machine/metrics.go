@@ -0,0 +1,81 @@
+package machine
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	scaleOperationMachinesCreated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapo_scale_operation_machines_created_total",
+			Help: "Number of machines whose OpenStack server was created in the latest scale operation of their MachineSet.",
+		},
+		[]string{"namespace", "machineset", "scale_operation"},
+	)
+
+	scaleOperationMachinesDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapo_scale_operation_machines_deleted_total",
+			Help: "Number of machines deleted in the latest scale operation of their MachineSet.",
+		},
+		[]string{"namespace", "machineset", "scale_operation"},
+	)
+
+	machineProvisioningDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapo_machine_provisioning_duration_seconds",
+			Help:    "Time from the creation of a machine until a milestone of its provisioning: its instance becoming ACTIVE, its providerID being set or its IP addresses being set.",
+			Buckets: []float64{15, 30, 60, 90, 120, 180, 240, 300, 600, 900, 1800, 3600},
+		},
+		[]string{"namespace", "machineset", "availability_zone", "milestone"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(scaleOperationMachinesCreated, scaleOperationMachinesDeleted, machineProvisioningDuration)
+}
+
+// scaleOperationMetrics exports the machines created and deleted in the
+// latest scale operation of each MachineSet. The counters of earlier scale
+// operations are removed, so that their number doesn't grow with every scale
+// operation.
+type scaleOperationMetrics struct {
+	mu     sync.Mutex
+	latest map[types.NamespacedName]scaleOperation
+}
+
+func newScaleOperationMetrics() *scaleOperationMetrics {
+	return &scaleOperationMetrics{latest: make(map[types.NamespacedName]scaleOperation)}
+}
+
+func (m *scaleOperationMetrics) machineCreated(machineSet types.NamespacedName, operation scaleOperation) {
+	m.record(scaleOperationMachinesCreated, machineSet, operation)
+}
+
+func (m *scaleOperationMetrics) machineDeleted(machineSet types.NamespacedName, operation scaleOperation) {
+	m.record(scaleOperationMachinesDeleted, machineSet, operation)
+}
+
+func (m *scaleOperationMetrics) record(counter *prometheus.CounterVec, machineSet types.NamespacedName, operation scaleOperation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A MachineSet which replaced another with the same name starts its
+	// generations again
+	latest, ok := m.latest[machineSet]
+	if ok && latest.uid == operation.uid && operation.generation < latest.generation {
+		return
+	}
+	if ok && latest != operation {
+		for _, c := range []*prometheus.CounterVec{scaleOperationMachinesCreated, scaleOperationMachinesDeleted} {
+			c.DeleteLabelValues(machineSet.Namespace, machineSet.Name, latest.id)
+		}
+	}
+	m.latest[machineSet] = operation
+
+	counter.WithLabelValues(machineSet.Namespace, machineSet.Name, operation.id).Inc()
+}
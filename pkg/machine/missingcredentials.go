@@ -0,0 +1,77 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// DeleteWithoutCredentialsAnnotationKey can be set to "true" on a machine
+// being deleted whose clouds secret was already deleted, e.g. during the
+// teardown of a cluster, to delete the machine without deleting its OpenStack
+// resources, which may then be leaked.
+const DeleteWithoutCredentialsAnnotationKey = "machine.openshift.io/openstack-delete-without-credentials"
+
+// deletedCloudsSecret returns the clouds secret of the machine if the machine
+// is being deleted and its clouds secret no longer exists. The secret is read
+// from the API server rather than the secrets informer, so that a secret which
+// the informer hasn't seen yet isn't mistaken for a deleted one.
+func (oc *OpenstackClient) deletedCloudsSecret(ctx context.Context, machine *machinev1.Machine) (*types.NamespacedName, error) {
+	if machine.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+	if machineSpec.CloudsSecret == nil || machineSpec.CloudsSecret.Name == "" {
+		return nil, nil
+	}
+
+	secret := machineCloudsSecret(machine, machineSpec)
+	_, err = oc.params.KubeClient.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &secret, nil
+	}
+	return nil, err
+}
+
+// deleteWithoutCredentials is called when the scope of a machine being
+// deleted can't be created. If its clouds secret was deleted, it returns
+// true if the machine is annotated with DeleteWithoutCredentialsAnnotationKey,
+// so that the machine is deleted without its OpenStack resources, and else an
+// error explaining how to delete it. It returns false and scopeErr otherwise.
+func (oc *OpenstackClient) deleteWithoutCredentials(ctx context.Context, machine *machinev1.Machine, scopeErr error) (bool, error) {
+	secret, err := oc.deletedCloudsSecret(ctx, machine)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to check whether its clouds secret was deleted: %v", machine.Name, err)
+		return false, scopeErr
+	}
+	if secret == nil {
+		return false, scopeErr
+	}
+	if machine.Annotations[DeleteWithoutCredentialsAnnotationKey] != "true" {
+		return false, fmt.Errorf("clouds secret %s of %q was deleted: set the annotation %s=true to delete the machine without deleting its OpenStack resources", secret, machine.Name, DeleteWithoutCredentialsAnnotationKey)
+	}
+	return true, nil
+}
+
+// recordDeletedWithoutCredentials warns that the OpenStack resources of a
+// machine deleted without credentials may have been leaked.
+func (oc *OpenstackClient) recordDeletedWithoutCredentials(machine *machinev1.Machine) {
+	instanceID := "unknown"
+	if machine.Spec.ProviderID != nil {
+		instanceID = *machine.Spec.ProviderID
+	}
+	klog.Warningf("Machine %s: deleted without credentials, its OpenStack server %s, ports, volumes and floating IPs may have been leaked", machine.Name, instanceID)
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "DeletedWithoutCredentials",
+		"Deleted machine %s without deleting its OpenStack resources because its clouds secret was deleted: its server %s, ports, volumes and floating IPs may have been leaked and must be deleted manually", machine.Name, instanceID)
+}
@@ -0,0 +1,102 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestDeleteWithoutCredentials(t *testing.T) {
+	// The API server only has the secret openstack-cloud-credentials
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/namespaces/openshift-machine-api/secrets/openstack-cloud-credentials" {
+			_, _ = w.Write([]byte(`{"kind":"Secret","apiVersion":"v1","metadata":{"name":"openstack-cloud-credentials","namespace":"openshift-machine-api"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+	}))
+	defer server.Close()
+
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oc := &OpenstackClient{params: ActuatorParams{KubeClient: kubeClient}}
+
+	newMachine := func(secret string, deleting bool, annotation string) *machinev1.Machine {
+		machine := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"},
+			Spec: machinev1.MachineSpec{
+				ProviderSpec: machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(`{"cloudsSecret":{"name":"` + secret + `"}}`)}},
+			},
+		}
+		if deleting {
+			machine.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		if annotation != "" {
+			machine.Annotations = map[string]string{DeleteWithoutCredentialsAnnotationKey: annotation}
+		}
+		return machine
+	}
+
+	scopeErr := errors.New("Failed to get cloud from secret")
+	tests := []struct {
+		name               string
+		machine            *machinev1.Machine
+		withoutCredentials bool
+		expectedErr        string
+	}{
+		{
+			name:        "machine not being deleted",
+			machine:     newMachine("deleted-credentials", false, "true"),
+			expectedErr: scopeErr.Error(),
+		},
+		{
+			name:        "secret exists",
+			machine:     newMachine("openstack-cloud-credentials", true, "true"),
+			expectedErr: scopeErr.Error(),
+		},
+		{
+			name:        "secret deleted without annotation",
+			machine:     newMachine("deleted-credentials", true, ""),
+			expectedErr: "set the annotation " + DeleteWithoutCredentialsAnnotationKey + "=true",
+		},
+		{
+			name:        "secret deleted with annotation set to false",
+			machine:     newMachine("deleted-credentials", true, "false"),
+			expectedErr: "set the annotation " + DeleteWithoutCredentialsAnnotationKey + "=true",
+		},
+		{
+			name:               "secret deleted with annotation",
+			machine:            newMachine("deleted-credentials", true, "true"),
+			withoutCredentials: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutCredentials, err := oc.deleteWithoutCredentials(context.Background(), tt.machine, scopeErr)
+			if withoutCredentials != tt.withoutCredentials {
+				t.Errorf("Expected deletion without credentials to be %t, got %t", tt.withoutCredentials, withoutCredentials)
+			}
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
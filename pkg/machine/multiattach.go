@@ -0,0 +1,78 @@
+package machine
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// multiattachService is the part of clients.InstanceService which attaches
+// existing volumes to servers.
+type multiattachService interface {
+	GetVolume(volumeID string) (*volumes.Volume, error)
+	ListAttachedVolumeIDs(serverID string) ([]string, error)
+	AttachVolume(serverID, volumeID string) error
+}
+
+// validateMultiattachVolumes checks that each multiattach volume is given
+// once, exists, and has a volume type with the multiattach capability.
+// Otherwise the volume could only be attached to the first machine.
+func validateMultiattachVolumes(multiattachVolumes []clients.MultiattachVolume, volumeService multiattachService) error {
+	var volumeIDs []string
+	for i := range multiattachVolumes {
+		volumeID := multiattachVolumes[i].VolumeID
+		if volumeID == "" {
+			return fmt.Errorf("multiattach volume %d has no volumeID", i)
+		}
+		if slices.Contains(volumeIDs, volumeID) {
+			return fmt.Errorf("multiattach volume %s is given more than once", volumeID)
+		}
+		volumeIDs = append(volumeIDs, volumeID)
+
+		volume, err := volumeService.GetVolume(volumeID)
+		if err != nil {
+			return fmt.Errorf("error getting multiattach volume %s: %v", volumeID, err)
+		}
+		if !volume.Multiattach {
+			return fmt.Errorf("volume %s can't be attached to more than one server, because its volume type %s doesn't have the multiattach capability", volumeID, volume.VolumeType)
+		}
+	}
+	return nil
+}
+
+// reconcileMultiattachVolumes attaches the multiattach volumes which aren't
+// attached to the instance yet. Volumes can only be attached to active or
+// stopped instances, so nothing is done while the instance is building.
+func reconcileMultiattachVolumes(machine *machinev1.Machine, multiattachVolumes []clients.MultiattachVolume, instanceStatus *compute.InstanceStatus, volumeService multiattachService) error {
+	if len(multiattachVolumes) == 0 {
+		return nil
+	}
+	if state := instanceStatus.State(); state != capov1.InstanceStateActive && state != capov1.InstanceStateShutoff {
+		return nil
+	}
+
+	attachedVolumeIDs, err := volumeService.ListAttachedVolumeIDs(instanceStatus.ID())
+	if err != nil {
+		return fmt.Errorf("list volumes attached to instance err: %v", err)
+	}
+
+	for i := range multiattachVolumes {
+		volumeID := multiattachVolumes[i].VolumeID
+		if slices.Contains(attachedVolumeIDs, volumeID) {
+			continue
+		}
+		if err := volumeService.AttachVolume(instanceStatus.ID(), volumeID); err != nil {
+			capoRecorder.Warnf(machine, "FailedAttachVolume", "Failed to attach multiattach volume %s: %v", volumeID, err)
+			return fmt.Errorf("attach volume %s err: %v", volumeID, err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulAttachVolume", "Attached multiattach volume %s", volumeID)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package machine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeMultiattachService struct {
+	volumes  map[string]*volumes.Volume
+	attached []string
+}
+
+func (f *fakeMultiattachService) GetVolume(volumeID string) (*volumes.Volume, error) {
+	volume, ok := f.volumes[volumeID]
+	if !ok {
+		return nil, fmt.Errorf("volume %s not found", volumeID)
+	}
+	return volume, nil
+}
+
+func (f *fakeMultiattachService) ListAttachedVolumeIDs(string) ([]string, error) {
+	return f.attached, nil
+}
+
+func (f *fakeMultiattachService) AttachVolume(_, volumeID string) error {
+	f.attached = append(f.attached, volumeID)
+	return nil
+}
+
+func TestValidateMultiattachVolumes(t *testing.T) {
+	const (
+		sharedVolumeID = "4d6f8a0c-2e4a-4c6e-8a0c-2e4a6c8e0a2c"
+		localVolumeID  = "7a9c1e3a-5c7e-4a9c-9e3a-5c7e9a1c3e5a"
+	)
+	service := &fakeMultiattachService{
+		volumes: map[string]*volumes.Volume{
+			sharedVolumeID: {ID: sharedVolumeID, VolumeType: "multiattach", Multiattach: true},
+			localVolumeID:  {ID: localVolumeID, VolumeType: "standard"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		volumes []clients.MultiattachVolume
+		wantErr bool
+	}{
+		{
+			name:    "multiattach volume",
+			volumes: []clients.MultiattachVolume{{VolumeID: sharedVolumeID}},
+		},
+		{
+			name:    "volume type without multiattach",
+			volumes: []clients.MultiattachVolume{{VolumeID: localVolumeID}},
+			wantErr: true,
+		},
+		{
+			name:    "missing volume",
+			volumes: []clients.MultiattachVolume{{VolumeID: "missing"}},
+			wantErr: true,
+		},
+		{
+			name:    "no volume ID",
+			volumes: []clients.MultiattachVolume{{}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate volume",
+			volumes: []clients.MultiattachVolume{{VolumeID: sharedVolumeID}, {VolumeID: sharedVolumeID}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := validateMultiattachVolumes(tt.volumes, service)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestReconcileMultiattachVolumes(t *testing.T) {
+	const (
+		instanceID     = "1b3d5f7b-9d1f-4b3d-8f7b-9d1f3b5d7f9b"
+		sharedVolumeID = "4d6f8a0c-2e4a-4c6e-8a0c-2e4a6c8e0a2c"
+		otherVolumeID  = "6e8a0c2e-4a6c-4e8a-8c2e-4a6c8e0a2c4e"
+	)
+	multiattachVolumes := []clients.MultiattachVolume{{VolumeID: sharedVolumeID}, {VolumeID: otherVolumeID}}
+	instance := func(state string) *compute.InstanceStatus {
+		return compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID, Status: state}}, logr.Discard())
+	}
+
+	g := NewWithT(t)
+	machine := &machinev1.Machine{}
+	service := &fakeMultiattachService{attached: []string{otherVolumeID}}
+
+	g.Expect(reconcileMultiattachVolumes(machine, multiattachVolumes, instance("BUILD"), service)).To(Succeed())
+	g.Expect(service.attached).To(Equal([]string{otherVolumeID}))
+
+	g.Expect(reconcileMultiattachVolumes(machine, multiattachVolumes, instance("ACTIVE"), service)).To(Succeed())
+	g.Expect(service.attached).To(Equal([]string{otherVolumeID, sharedVolumeID}))
+
+	g.Expect(reconcileMultiattachVolumes(machine, multiattachVolumes, instance("ACTIVE"), service)).To(Succeed())
+	g.Expect(service.attached).To(Equal([]string{otherVolumeID, sharedVolumeID}))
+}
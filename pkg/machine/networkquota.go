@@ -0,0 +1,76 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// networkQuotaService is the part of clients.InstanceService which looks up
+// the network quotas of the project.
+type networkQuotaService interface {
+	GetNetworkQuotas(projectID string) (*clients.NetworkQuotas, error)
+}
+
+// allocatedFloatingIPs returns how many floating IPs are allocated for the
+// machine, as opposed to existing floating IPs given by their address.
+func allocatedFloatingIPs(requests []clients.FloatingIPRequest) int {
+	allocated := 0
+	for _, request := range requests {
+		if request.Address == "" {
+			allocated++
+		}
+	}
+	return allocated
+}
+
+// insufficientNetworkQuota returns which network quotas of the project are
+// too small for the ports and floating IPs of a machine, or an empty string
+// if they fit. The machine creates no security group rules, but the security
+// group rules quota is reported when it is used up, since no rule can then be
+// added for the node of the machine, e.g. by the cloud provider for load
+// balancers. Quotas of -1 are unlimited.
+func insufficientNetworkQuota(ports, floatingIPs int, quotas *clients.NetworkQuotas) string {
+	var exceeded []string
+	check := func(resource string, requested int, quota clients.NetworkQuota) {
+		if quota.Limit < 0 {
+			return
+		}
+		available := quota.Limit - quota.Used - quota.Reserved
+		if requested > available || (requested == 0 && available <= 0) {
+			exceeded = append(exceeded, fmt.Sprintf("%s: %d requested, %d of %d available", resource, requested, max(available, 0), quota.Limit))
+		}
+	}
+	if ports > 0 {
+		check("ports", ports, quotas.Port)
+	}
+	if floatingIPs > 0 {
+		check("floating IPs", floatingIPs, quotas.FloatingIP)
+	}
+	check("security group rules", 0, quotas.SecurityGroupRule)
+	return strings.Join(exceeded, ", ")
+}
+
+// checkNetworkQuota checks, before any resource of the machine is created,
+// that the network quotas of the project leave room for its ports and the
+// floating IPs allocated for it. If they don't, creating them will fail with
+// a less helpful error, so an InsufficientNetworkQuota warning event names
+// the exhausted quotas. The quotas may be freed before the ports are created,
+// so the creation goes on. The check is skipped if the quotas can't be read.
+func (oc *OpenstackClient) checkNetworkQuota(machine *machinev1.Machine, projectID string, ports, floatingIPs int, service networkQuotaService) {
+	quotas, err := service.GetNetworkQuotas(projectID)
+	if err != nil {
+		klog.Warningf("Machine %s: not checking the network quota, since the quotas of the project can't be read: %v", machine.Name, err)
+		return
+	}
+
+	if exceeded := insufficientNetworkQuota(ports, floatingIPs, quotas); exceeded != "" {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "InsufficientNetworkQuota",
+			"The network quota of the project is too small for the ports and floating IPs of the machine: %s", exceeded)
+	}
+}
@@ -0,0 +1,125 @@
+package machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeNetworkQuotaService struct {
+	quotas    *clients.NetworkQuotas
+	quotasErr error
+}
+
+func (s *fakeNetworkQuotaService) GetNetworkQuotas(projectID string) (*clients.NetworkQuotas, error) {
+	return s.quotas, s.quotasErr
+}
+
+func TestInsufficientNetworkQuota(t *testing.T) {
+	tests := []struct {
+		name        string
+		ports       int
+		floatingIPs int
+		quotas      clients.NetworkQuotas
+		expected    string
+	}{
+		{
+			name:        "fits",
+			ports:       2,
+			floatingIPs: 1,
+			quotas: clients.NetworkQuotas{
+				Port:       clients.NetworkQuota{Limit: 50, Used: 47, Reserved: 1},
+				FloatingIP: clients.NetworkQuota{Limit: 10, Used: 9},
+			},
+		},
+		{
+			name:        "unlimited",
+			ports:       2,
+			floatingIPs: 1,
+			quotas: clients.NetworkQuotas{
+				Port:       clients.NetworkQuota{Limit: -1, Used: 500},
+				FloatingIP: clients.NetworkQuota{Limit: -1, Used: 60},
+			},
+		},
+		{
+			name:  "no floating IPs allocated",
+			ports: 1,
+			quotas: clients.NetworkQuotas{
+				Port:       clients.NetworkQuota{Limit: 50, Used: 10},
+				FloatingIP: clients.NetworkQuota{Limit: 10, Used: 10},
+			},
+		},
+		{
+			name:        "ports exhausted by reservations",
+			ports:       2,
+			floatingIPs: 1,
+			quotas: clients.NetworkQuotas{
+				Port:       clients.NetworkQuota{Limit: 50, Used: 48, Reserved: 1},
+				FloatingIP: clients.NetworkQuota{Limit: 10},
+			},
+			expected: "ports: 2 requested, 1 of 50 available",
+		},
+		{
+			name:        "usage above the quota",
+			ports:       1,
+			floatingIPs: 1,
+			quotas: clients.NetworkQuotas{
+				Port:       clients.NetworkQuota{Limit: 50, Used: 52},
+				FloatingIP: clients.NetworkQuota{Limit: 10, Used: 10},
+			},
+			expected: "ports: 1 requested, 0 of 50 available, floating IPs: 1 requested, 0 of 10 available",
+		},
+		{
+			name:  "security group rules used up",
+			ports: 1,
+			quotas: clients.NetworkQuotas{
+				Port:              clients.NetworkQuota{Limit: 50, Used: 10},
+				SecurityGroupRule: clients.NetworkQuota{Limit: 100, Used: 99, Reserved: 1},
+			},
+			expected: "security group rules: 0 requested, 0 of 100 available",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Security group rules are unlimited unless the test sets them
+			if tt.quotas.SecurityGroupRule == (clients.NetworkQuota{}) {
+				tt.quotas.SecurityGroupRule.Limit = -1
+			}
+			if exceeded := insufficientNetworkQuota(tt.ports, tt.floatingIPs, &tt.quotas); exceeded != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, exceeded)
+			}
+		})
+	}
+}
+
+func TestCheckNetworkQuota(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+
+	recorder := record.NewFakeRecorder(10)
+	oc := &OpenstackClient{eventRecorder: recorder}
+	service := &fakeNetworkQuotaService{quotas: &clients.NetworkQuotas{
+		Port:              clients.NetworkQuota{Limit: 10, Used: 10},
+		FloatingIP:        clients.NetworkQuota{Limit: -1},
+		SecurityGroupRule: clients.NetworkQuota{Limit: -1},
+	}}
+	oc.checkNetworkQuota(machine, "project", 1, 0, service)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("Expected an InsufficientNetworkQuota event, got %d events", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "InsufficientNetworkQuota") || !strings.Contains(event, "ports: 1 requested, 0 of 10 available") {
+		t.Errorf("Expected an InsufficientNetworkQuota event naming the port quota, got %q", event)
+	}
+
+	// The check is skipped if the quotas can't be read
+	service = &fakeNetworkQuotaService{quotasErr: errors.New("quota_details extension not found")}
+	oc.checkNetworkQuota(machine, "project", 1, 0, service)
+	if len(recorder.Events) != 0 {
+		t.Errorf("Expected no event, got %d events", len(recorder.Events))
+	}
+}
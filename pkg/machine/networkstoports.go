@@ -0,0 +1,178 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// ConvertNetworksToPorts returns the value of providerSpec with its networks
+// replaced by the equivalent ports, and those ports. It returns nil if
+// providerSpec has no networks.
+//
+// The ports of the networks come before the existing ports, in the order in
+// which they are created for the networks, so that the ports of machines keep
+// their names and indexes. Network and subnet filters are resolved to IDs in
+// the cloud of scope, and the API and ingress VIPs of the cluster are added as
+// allowed address pairs where they would be for the networks. The extensions
+// of a network, such as its QoS policy, are moved to each of its ports.
+func ConvertNetworksToPorts(providerSpec machinev1.ProviderSpec, platformStatus *configv1.OpenStackPlatformStatus, scope scope.Scope) (*runtime.RawExtension, []machinev1alpha1.PortOpts, error) {
+	machineSpec, err := clients.MachineSpecFromProviderSpec(providerSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(machineSpec.Networks) == 0 {
+		return nil, nil, nil
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(providerSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hasNetworkSegments(extensions) {
+		return nil, nil, fmt.Errorf("networks with segments by availability zone can't be converted to ports")
+	}
+
+	var apiVIPs, ingressVIPs []string
+	ignoreAddressPairs := false
+	if platformStatus != nil {
+		apiVIPs, ingressVIPs = platformStatus.APIServerInternalIPs, platformStatus.IngressIPs
+		ignoreAddressPairs = hasUserManagedLoadBalancer(platformStatus)
+	}
+
+	networkService, err := networking.NewService(scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var converted []machinev1alpha1.PortOpts
+	var rawPorts []interface{}
+	for i := range machineSpec.Networks {
+		network := &machineSpec.Networks[i]
+
+		var extension map[string]interface{}
+		if i < len(extensions.Networks) {
+			if extension, err = toJSONObject(extensions.Networks[i]); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		for _, capoPort := range networkParamToCapov1PortOpts(network, apiVIPs, ingressVIPs, &machineSpec.Trunk, ignoreAddressPairs) {
+			port, err := capoPortToPortOpts(&capoPort, networkService)
+			if err != nil {
+				return nil, nil, fmt.Errorf("network %d: %w", i, err)
+			}
+			port.PortSecurity = network.PortSecurity
+			port.Profile = network.Profile
+			converted = append(converted, port)
+
+			rawPort, err := toJSONObject(port)
+			if err != nil {
+				return nil, nil, err
+			}
+			for key, value := range extension {
+				rawPort[key] = value
+			}
+			rawPorts = append(rawPorts, rawPort)
+		}
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal(providerSpec.Value.Raw, &value); err != nil {
+		return nil, nil, err
+	}
+	if existing, ok := value["ports"].([]interface{}); ok {
+		rawPorts = append(rawPorts, existing...)
+	}
+	value["ports"] = rawPorts
+	delete(value, "networks")
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &runtime.RawExtension{Raw: raw}, converted, nil
+}
+
+// capoPortToPortOpts returns the port of the providerSpec which is equivalent
+// to a CAPO port created for a network, with the network and the subnets of
+// its fixed IPs resolved to IDs.
+func capoPortToPortOpts(capoPort *capov1.PortOpts, networkService *networking.Service) (machinev1alpha1.PortOpts, error) {
+	port := machinev1alpha1.PortOpts{
+		Tags:     capoPort.Tags,
+		VNICType: capoPort.VNICType,
+	}
+	if capoPort.Trunk != nil && *capoPort.Trunk {
+		port.Trunk = capoPort.Trunk
+	}
+	for _, addressPair := range capoPort.AllowedAddressPairs {
+		port.AllowedAddressPairs = append(port.AllowedAddressPairs, machinev1alpha1.AddressPair(addressPair))
+	}
+
+	if capoPort.Network != nil {
+		port.NetworkID = capoPort.Network.ID
+		if port.NetworkID == "" && (*capoPort.Network != capov1.NetworkFilter{}) {
+			networks, err := networkService.GetNetworksByFilter(capoPort.Network.ToListOpt())
+			if err != nil {
+				return port, fmt.Errorf("error getting the network of the port: %w", err)
+			}
+			if len(networks) != 1 {
+				return port, fmt.Errorf("%d networks match the filter of the network", len(networks))
+			}
+			port.NetworkID = networks[0].ID
+		}
+	}
+
+	for _, fixedIP := range capoPort.FixedIPs {
+		if fixedIP.Subnet == nil {
+			port.FixedIPs = append(port.FixedIPs, machinev1alpha1.FixedIPs{IPAddress: fixedIP.IPAddress})
+			continue
+		}
+
+		subnetID := fixedIP.Subnet.ID
+		if subnetID == "" || port.NetworkID == "" {
+			var err error
+			var subnet *subnets.Subnet
+			if port.NetworkID != "" {
+				subnet, err = networkService.GetNetworkSubnetByFilter(port.NetworkID, fixedIP.Subnet)
+			} else {
+				subnet, err = networkService.GetSubnetByFilter(fixedIP.Subnet)
+			}
+			if err != nil {
+				return port, fmt.Errorf("error getting the subnet of the port: %w", err)
+			}
+			subnetID = subnet.ID
+			if port.NetworkID == "" {
+				port.NetworkID = subnet.NetworkID
+			}
+		}
+		port.FixedIPs = append(port.FixedIPs, machinev1alpha1.FixedIPs{SubnetID: subnetID, IPAddress: fixedIP.IPAddress})
+	}
+
+	if port.NetworkID == "" {
+		return port, fmt.Errorf("the port has neither a network nor a subnet")
+	}
+	return port, nil
+}
+
+// toJSONObject returns the JSON object which v is marshalled to.
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestConvertNetworksToPorts(t *testing.T) {
+	const (
+		machinesNetworkID = "3b5d7f9a-1c3e-4a5b-8d7f-9a1c3e5b7d9f"
+		machinesSubnetID  = "8e0a2c4e-6a8c-4e0a-9c2e-4a6c8e0a2c4e"
+		storageNetworkID  = "5f7b9d1f-3b5d-4f7b-9d1f-3b5d7f9b1d3f"
+		storageSubnetID   = "2a4c6e8a-0c2e-4a4c-8e0a-2c4e6a8c0e2a"
+		extraNetworkID    = "9c1e3a5c-7e9a-4c1e-8a5c-7e9a1c3e5a7c"
+	)
+
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+	mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+	mockScopeFactory.NetworkClient.EXPECT().ListNetwork(gomock.Any()).Return([]networks.Network{{ID: storageNetworkID}}, nil)
+	mockScopeFactory.NetworkClient.EXPECT().ListSubnet(gomock.Any()).Return([]subnets.Subnet{{ID: storageSubnetID, NetworkID: storageNetworkID}}, nil)
+
+	value := map[string]interface{}{
+		"flavor": "m1.large",
+		"networks": []interface{}{
+			map[string]interface{}{
+				"uuid":    machinesNetworkID,
+				"subnets": []interface{}{map[string]interface{}{"uuid": machinesSubnetID}},
+			},
+			map[string]interface{}{
+				"filter":                map[string]interface{}{"name": "storage"},
+				"subnets":               []interface{}{map[string]interface{}{"filter": map[string]interface{}{"name": "storage-v4"}}},
+				"noAllowedAddressPairs": true,
+				"qosPolicy":             "storage-qos",
+				"portTags":              []interface{}{"storage"},
+				"vnicType":              "direct",
+			},
+		},
+		"ports": []interface{}{
+			map[string]interface{}{"networkID": extraNetworkID, "nameSuffix": "extra"},
+		},
+	}
+	raw, err := json.Marshal(value)
+	g.Expect(err).NotTo(HaveOccurred())
+	providerSpec := machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: raw}}
+	platformStatus := &configv1.OpenStackPlatformStatus{
+		APIServerInternalIPs: []string{"192.0.2.5"},
+		IngressIPs:           []string{"192.0.2.7"},
+	}
+
+	converted, ports, err := ConvertNetworksToPorts(providerSpec, platformStatus, mockScopeFactory)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ports).To(Equal([]machinev1alpha1.PortOpts{
+		{
+			NetworkID:           machinesNetworkID,
+			FixedIPs:            []machinev1alpha1.FixedIPs{{SubnetID: machinesSubnetID}},
+			AllowedAddressPairs: []machinev1alpha1.AddressPair{{IPAddress: "192.0.2.5"}, {IPAddress: "192.0.2.7"}},
+		},
+		{
+			NetworkID: storageNetworkID,
+			FixedIPs:  []machinev1alpha1.FixedIPs{{SubnetID: storageSubnetID}},
+			Tags:      []string{"storage"},
+			VNICType:  "direct",
+		},
+	}))
+
+	convertedSpec := machinev1.ProviderSpec{Value: converted}
+	machineSpec, err := clients.MachineSpecFromProviderSpec(convertedSpec)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(machineSpec.Networks).To(BeEmpty())
+	g.Expect(machineSpec.Flavor).To(Equal("m1.large"))
+	g.Expect(machineSpec.Ports).To(HaveLen(3))
+	g.Expect(machineSpec.Ports[0:2]).To(Equal(ports))
+	g.Expect(machineSpec.Ports[2].NetworkID).To(Equal(extraNetworkID))
+
+	extensions, err := clients.ExtensionsFromProviderSpec(convertedSpec)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(extensions.Networks).To(BeEmpty())
+	g.Expect(extensions.Ports).To(HaveLen(3))
+	g.Expect(extensions.Ports[0].QoSPolicy).To(BeEmpty())
+	g.Expect(extensions.Ports[1].QoSPolicy).To(Equal("storage-qos"))
+}
+
+func TestConvertNetworksToPortsWithoutNetworks(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+	mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+
+	providerSpec := machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(`{"ports":[{"networkID":"9c1e3a5c-7e9a-4c1e-8a5c-7e9a1c3e5a7c"}]}`)}}
+	converted, ports, err := ConvertNetworksToPorts(providerSpec, nil, mockScopeFactory)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(converted).To(BeNil())
+	g.Expect(ports).To(BeEmpty())
+}
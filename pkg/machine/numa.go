@@ -0,0 +1,191 @@
+package machine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Flavor extra specs which define the NUMA topology and the memory pages of
+// a server.
+const (
+	extraSpecNUMANodes   = "hw:numa_nodes"
+	extraSpecNUMACPUs    = "hw:numa_cpus."
+	extraSpecNUMAMem     = "hw:numa_mem."
+	extraSpecMemPageSize = "hw:mem_page_size"
+)
+
+// memPageSizeRegexp matches an explicit page size, as understood by Nova: a
+// number with an optional unit, which defaults to KiB.
+var memPageSizeRegexp = regexp.MustCompile(`^([0-9]+)\s*([KMG]?i?B?)$`)
+
+// validateFlavorNUMATopology checks that the NUMA topology and the page size
+// requested by the extra specs of the flavor fit the flavor's vCPUs and RAM.
+// Nova rejects such flavors only when it schedules the server, with errors
+// which don't name the cause.
+func validateFlavorNUMATopology(flavor *flavors.Flavor, extraSpecs map[string]string) error {
+	nodes := 1
+	if value, ok := extraSpecs[extraSpecNUMANodes]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("flavor %s: %s must be a positive integer, got %q", flavor.Name, extraSpecNUMANodes, value)
+		}
+		if n > flavor.VCPUs {
+			return fmt.Errorf("flavor %s: %s is %d, but the flavor only has %d vCPUs", flavor.Name, extraSpecNUMANodes, n, flavor.VCPUs)
+		}
+		nodes = n
+	}
+
+	nodeRAM, err := numaNodeRAM(flavor, extraSpecs, nodes)
+	if err != nil {
+		return err
+	}
+
+	value, ok := extraSpecs[extraSpecMemPageSize]
+	if !ok {
+		return nil
+	}
+	pageSizeKiB, err := parseMemPageSize(value)
+	if err != nil {
+		return fmt.Errorf("flavor %s: %s: %w", flavor.Name, extraSpecMemPageSize, err)
+	}
+	if pageSizeKiB == 0 {
+		return nil
+	}
+	for node, ram := range nodeRAM {
+		if ram*1024%pageSizeKiB != 0 {
+			return fmt.Errorf("flavor %s: the %d MiB of RAM of NUMA node %d are not a multiple of the %s page size", flavor.Name, ram, node, value)
+		}
+	}
+	return nil
+}
+
+// numaNodeRAM returns the RAM in MiB of each NUMA node of a server of the
+// flavor. Unless the extra specs assign vCPUs and RAM to each node, they are
+// split evenly between the nodes.
+func numaNodeRAM(flavor *flavors.Flavor, extraSpecs map[string]string, nodes int) ([]int, error) {
+	explicit := false
+	for key := range extraSpecs {
+		if strings.HasPrefix(key, extraSpecNUMACPUs) || strings.HasPrefix(key, extraSpecNUMAMem) {
+			explicit = true
+			break
+		}
+	}
+
+	nodeRAM := make([]int, nodes)
+	if !explicit {
+		if flavor.VCPUs%nodes != 0 || flavor.RAM%nodes != 0 {
+			return nil, fmt.Errorf("flavor %s: %d vCPUs and %d MiB of RAM can't be split evenly between %d NUMA nodes: set %sN and %sN for each node", flavor.Name, flavor.VCPUs, flavor.RAM, nodes, extraSpecNUMACPUs, extraSpecNUMAMem)
+		}
+		for i := range nodeRAM {
+			nodeRAM[i] = flavor.RAM / nodes
+		}
+		return nodeRAM, nil
+	}
+
+	cpus := sets.New[int]()
+	totalRAM := 0
+	for i := 0; i < nodes; i++ {
+		cpuSpec, ok := extraSpecs[fmt.Sprintf("%s%d", extraSpecNUMACPUs, i)]
+		if !ok {
+			return nil, fmt.Errorf("flavor %s: %s%d is not set", flavor.Name, extraSpecNUMACPUs, i)
+		}
+		nodeCPUs, err := parseCPUSpec(cpuSpec)
+		if err != nil {
+			return nil, fmt.Errorf("flavor %s: %s%d: %w", flavor.Name, extraSpecNUMACPUs, i, err)
+		}
+		for _, cpu := range sets.List(nodeCPUs) {
+			if cpu >= flavor.VCPUs {
+				return nil, fmt.Errorf("flavor %s: %s%d: vCPU %d is out of range for %d vCPUs", flavor.Name, extraSpecNUMACPUs, i, cpu, flavor.VCPUs)
+			}
+			if cpus.Has(cpu) {
+				return nil, fmt.Errorf("flavor %s: %s%d: vCPU %d is assigned to more than one NUMA node", flavor.Name, extraSpecNUMACPUs, i, cpu)
+			}
+		}
+		cpus = cpus.Union(nodeCPUs)
+
+		memSpec, ok := extraSpecs[fmt.Sprintf("%s%d", extraSpecNUMAMem, i)]
+		if !ok {
+			return nil, fmt.Errorf("flavor %s: %s%d is not set", flavor.Name, extraSpecNUMAMem, i)
+		}
+		ram, err := strconv.Atoi(memSpec)
+		if err != nil || ram < 1 {
+			return nil, fmt.Errorf("flavor %s: %s%d must be a positive number of MiB, got %q", flavor.Name, extraSpecNUMAMem, i, memSpec)
+		}
+		nodeRAM[i] = ram
+		totalRAM += ram
+	}
+	if cpus.Len() != flavor.VCPUs {
+		return nil, fmt.Errorf("flavor %s: %s assign %d of the %d vCPUs of the flavor", flavor.Name, extraSpecNUMACPUs+"N", cpus.Len(), flavor.VCPUs)
+	}
+	if totalRAM != flavor.RAM {
+		return nil, fmt.Errorf("flavor %s: %s assign %d of the %d MiB of RAM of the flavor", flavor.Name, extraSpecNUMAMem+"N", totalRAM, flavor.RAM)
+	}
+	return nodeRAM, nil
+}
+
+// parseCPUSpec parses a list of vCPUs in the format of hw:numa_cpus.N, e.g.
+// "0-3,^2,6".
+func parseCPUSpec(spec string) (sets.Set[int], error) {
+	cpus := sets.New[int]()
+	excluded := sets.New[int]()
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		target := cpus
+		if strings.HasPrefix(item, "^") {
+			target = excluded
+			item = item[1:]
+		}
+
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid vCPU list %q", spec)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid vCPU list %q", spec)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			target.Insert(cpu)
+		}
+	}
+
+	cpus = cpus.Difference(excluded)
+	if cpus.Len() == 0 {
+		return nil, fmt.Errorf("vCPU list %q is empty", spec)
+	}
+	return cpus, nil
+}
+
+// parseMemPageSize returns the page size in KiB of a value of
+// hw:mem_page_size, or 0 if it doesn't request a specific page size.
+func parseMemPageSize(value string) (int, error) {
+	switch value {
+	case "small", "large", "any":
+		return 0, nil
+	}
+
+	match := memPageSizeRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid page size %q: must be small, large, any or a size such as 2MB", value)
+	}
+	size, err := strconv.Atoi(match[1])
+	if err != nil || size == 0 {
+		return 0, fmt.Errorf("invalid page size %q", value)
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(match[2], "B"), "i") {
+	case "M":
+		size *= 1024
+	case "G":
+		size *= 1024 * 1024
+	}
+	return size, nil
+}
@@ -0,0 +1,118 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+)
+
+func TestValidateFlavorNUMATopology(t *testing.T) {
+	flavor := &flavors.Flavor{Name: "m1.numa", VCPUs: 8, RAM: 16384}
+
+	tests := []struct {
+		name       string
+		extraSpecs map[string]string
+		wantErr    bool
+	}{
+		{
+			name: "no NUMA topology",
+		},
+		{
+			name:       "even NUMA nodes with huge pages",
+			extraSpecs: map[string]string{"hw:numa_nodes": "2", "hw:mem_page_size": "1GB"},
+		},
+		{
+			name:       "large pages",
+			extraSpecs: map[string]string{"hw:mem_page_size": "large"},
+		},
+		{
+			name:       "page size in KiB",
+			extraSpecs: map[string]string{"hw:mem_page_size": "2048"},
+		},
+		{
+			name: "explicit NUMA nodes",
+			extraSpecs: map[string]string{
+				"hw:numa_nodes":  "2",
+				"hw:numa_cpus.0": "0-5,^4",
+				"hw:numa_cpus.1": "4,6-7",
+				"hw:numa_mem.0":  "12288",
+				"hw:numa_mem.1":  "4096",
+			},
+		},
+		{
+			name:       "invalid number of NUMA nodes",
+			extraSpecs: map[string]string{"hw:numa_nodes": "two"},
+			wantErr:    true,
+		},
+		{
+			name:       "more NUMA nodes than vCPUs",
+			extraSpecs: map[string]string{"hw:numa_nodes": "16"},
+			wantErr:    true,
+		},
+		{
+			name:       "vCPUs can't be split evenly",
+			extraSpecs: map[string]string{"hw:numa_nodes": "3"},
+			wantErr:    true,
+		},
+		{
+			name: "explicit NUMA node missing",
+			extraSpecs: map[string]string{
+				"hw:numa_nodes":  "2",
+				"hw:numa_cpus.0": "0-7",
+				"hw:numa_mem.0":  "16384",
+			},
+			wantErr: true,
+		},
+		{
+			name: "explicit NUMA nodes don't assign all RAM",
+			extraSpecs: map[string]string{
+				"hw:numa_nodes":  "2",
+				"hw:numa_cpus.0": "0-3",
+				"hw:numa_cpus.1": "4-7",
+				"hw:numa_mem.0":  "4096",
+				"hw:numa_mem.1":  "4096",
+			},
+			wantErr: true,
+		},
+		{
+			name: "vCPU assigned twice",
+			extraSpecs: map[string]string{
+				"hw:numa_nodes":  "2",
+				"hw:numa_cpus.0": "0-4",
+				"hw:numa_cpus.1": "4-7",
+				"hw:numa_mem.0":  "8192",
+				"hw:numa_mem.1":  "8192",
+			},
+			wantErr: true,
+		},
+		{
+			name: "RAM of a NUMA node not a multiple of the page size",
+			extraSpecs: map[string]string{
+				"hw:numa_nodes":    "2",
+				"hw:numa_cpus.0":   "0-3",
+				"hw:numa_cpus.1":   "4-7",
+				"hw:numa_mem.0":    "7680",
+				"hw:numa_mem.1":    "8704",
+				"hw:mem_page_size": "1GB",
+			},
+			wantErr: true,
+		},
+		{
+			name:       "invalid page size",
+			extraSpecs: map[string]string{"hw:mem_page_size": "huge"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFlavorNUMATopology(flavor, tt.extraSpecs)
+			if tt.wantErr && err == nil {
+				t.Errorf("expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
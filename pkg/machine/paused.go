@@ -0,0 +1,29 @@
+package machine
+
+import (
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+// pausedRequeueDelay is how long until a paused machine is checked again. Its
+// authoritative API and conditions are watched, so it is usually reconciled
+// as soon as it is unpaused.
+const pausedRequeueDelay = 5 * time.Minute
+
+// checkPaused returns an error requeueing machine, and records an event, if
+// it is paused, e.g. because Cluster API is its authoritative API. action
+// describes what is not done, e.g. "deleting". The instance of a paused
+// machine is never changed, as it may be managed by CAPO.
+func (oc *OpenstackClient) checkPaused(machine *machinev1.Machine, action string) error {
+	reason := utils.MachinePausedReason(machine)
+	if reason == "" {
+		return nil
+	}
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Paused", "Not %s %s: %s", action, machine.Name, reason)
+	return &maoMachine.RequeueAfterError{RequeueAfter: pausedRequeueDelay}
+}
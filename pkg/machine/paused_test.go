@@ -0,0 +1,35 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPausedMachinesAreNotReconciled(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	oc := &OpenstackClient{eventRecorder: recorder}
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"},
+		Status:     machinev1.MachineStatus{AuthoritativeAPI: machinev1.MachineAuthorityClusterAPI},
+	}
+
+	// No cloud is reached: the actuator has no clients
+	for name, action := range map[string]func(context.Context, *machinev1.Machine) error{
+		"create": oc.Create,
+		"update": oc.Update,
+		"delete": oc.Delete,
+	} {
+		err := action(context.Background(), machine)
+		var requeue *maoMachine.RequeueAfterError
+		if !errors.As(err, &requeue) || requeue.RequeueAfter != pausedRequeueDelay {
+			t.Errorf("%s: expected the machine to be requeued, got %v", name, err)
+		}
+		expectEvent(t, recorder, "Paused")
+	}
+}
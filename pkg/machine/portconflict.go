@@ -0,0 +1,86 @@
+package machine
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+)
+
+// portConflictRetryDelay is the delay before the first retry of a port
+// creation which failed with a conflict. It doubles with every retry, and
+// jitter is added so that machines created together don't retry together.
+var portConflictRetryDelay = time.Second
+
+// createPortWithConflictRetries creates a port, retrying up to retries times
+// if Neutron reports a conflict, which happens when many ports are created or
+// bound concurrently during large scale-outs. A failed request may still have
+// created the port, so before each retry an unbound port with the same name
+// is adopted instead of creating another one.
+func (c *instanceNetworkClient) createPortWithConflictRetries(createOpts ports.CreateOptsBuilder, retries int) (*ports.Port, error) {
+	port, err := c.NetworkClient.CreatePort(createOpts)
+	for attempt := 0; attempt < retries && capoerrors.IsConflict(err); attempt++ {
+		klog.V(3).Infof("Retrying port creation after conflict: %v", err)
+		time.Sleep(wait.Jitter(portConflictRetryDelay<<attempt, 1.0))
+
+		var adopted *ports.Port
+		adopted, err = c.adoptCreatedPort(createOpts)
+		if err != nil {
+			return nil, err
+		}
+		if adopted != nil {
+			return adopted, nil
+		}
+		port, err = c.NetworkClient.CreatePort(createOpts)
+	}
+	return port, err
+}
+
+// adoptCreatedPort returns the unbound port with the name and network of
+// createOpts which a failed request may have created, or nil if there is
+// none. If there is more than one, the oldest is returned and the others are
+// deleted.
+func (c *instanceNetworkClient) adoptCreatedPort(createOpts ports.CreateOptsBuilder) (*ports.Port, error) {
+	createMap, err := createOpts.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	portMap, _ := createMap["port"].(map[string]interface{})
+	name, _ := portMap["name"].(string)
+	networkID, _ := portMap["network_id"].(string)
+	if name == "" {
+		return nil, nil
+	}
+
+	existing, err := c.NetworkClient.ListPort(ports.ListOpts{Name: name, NetworkID: networkID})
+	if err != nil {
+		return nil, err
+	}
+	var candidates []ports.Port
+	for _, port := range existing {
+		if port.DeviceID == "" {
+			candidates = append(candidates, port)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	slices.SortFunc(candidates, func(a, b ports.Port) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	for _, duplicate := range candidates[1:] {
+		if err := c.NetworkClient.DeletePort(duplicate.ID); err != nil && !capoerrors.IsNotFound(err) {
+			return nil, err
+		}
+		klog.Infof("Deleted duplicate port %s named %s", duplicate.ID, name)
+	}
+	return &candidates[0], nil
+}
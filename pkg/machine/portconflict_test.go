@@ -0,0 +1,106 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestCreatePortWithConflictRetries(t *testing.T) {
+	const (
+		networkID = "3d5f7b9d-1f3b-4d5f-9b9d-1f3b5d7f9b1d"
+		portName  = "worker-0-0"
+	)
+	createOpts := ports.CreateOpts{Name: portName, NetworkID: networkID}
+	listOpts := ports.ListOpts{Name: portName, NetworkID: networkID}
+	conflict := gophercloud.ErrDefault409{}
+	older := time.Date(2024, time.June, 1, 10, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Second)
+
+	defer func(delay time.Duration) { portConflictRetryDelay = delay }(portConflictRetryDelay)
+	portConflictRetryDelay = 0
+
+	tests := []struct {
+		name     string
+		retries  int
+		expect   func(m *scope.MockScopeFactory)
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:    "created after a conflict",
+			retries: 3,
+			expect: func(m *scope.MockScopeFactory) {
+				gomock.InOrder(
+					m.NetworkClient.EXPECT().CreatePort(createOpts).Return(nil, conflict),
+					m.NetworkClient.EXPECT().ListPort(listOpts).Return(nil, nil),
+					m.NetworkClient.EXPECT().CreatePort(createOpts).Return(&ports.Port{ID: "port-id"}, nil),
+				)
+			},
+			expected: "port-id",
+		},
+		{
+			name:    "port created by the failed request is adopted",
+			retries: 3,
+			expect: func(m *scope.MockScopeFactory) {
+				gomock.InOrder(
+					m.NetworkClient.EXPECT().CreatePort(createOpts).Return(nil, conflict),
+					m.NetworkClient.EXPECT().ListPort(listOpts).Return([]ports.Port{
+						{ID: "newer-port-id", CreatedAt: newer},
+						{ID: "bound-port-id", CreatedAt: older, DeviceID: "other-server-id"},
+						{ID: "older-port-id", CreatedAt: older},
+					}, nil),
+					m.NetworkClient.EXPECT().DeletePort("newer-port-id").Return(nil),
+				)
+			},
+			expected: "older-port-id",
+		},
+		{
+			name:    "retries exhausted",
+			retries: 1,
+			expect: func(m *scope.MockScopeFactory) {
+				gomock.InOrder(
+					m.NetworkClient.EXPECT().CreatePort(createOpts).Return(nil, conflict),
+					m.NetworkClient.EXPECT().ListPort(listOpts).Return(nil, nil),
+					m.NetworkClient.EXPECT().CreatePort(createOpts).Return(nil, conflict),
+				)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "retries disabled",
+			retries: 0,
+			expect: func(m *scope.MockScopeFactory) {
+				m.NetworkClient.EXPECT().CreatePort(createOpts).Return(nil, conflict)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			tt.expect(mockScopeFactory)
+
+			instanceScope := &instanceScope{Scope: mockScopeFactory, portConflictRetries: tt.retries}
+			networkClient, err := instanceScope.NewNetworkClient()
+			g.Expect(err).NotTo(HaveOccurred())
+
+			port, err := networkClient.CreatePort(createOpts)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(port.ID).To(Equal(tt.expected))
+		})
+	}
+}
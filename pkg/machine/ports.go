@@ -0,0 +1,152 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/trunks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
+)
+
+// vnicTypes are the VNIC types supported by Neutron. Ports with any other VNIC
+// type can't be created.
+var vnicTypes = sets.New(
+	"normal",
+	"direct",
+	"direct-physical",
+	"macvtap",
+	"baremetal",
+	"virtio-forwarder",
+	"smart-nic",
+	"vdpa",
+	"remote-managed",
+	"accelerator-direct",
+	"accelerator-direct-physical",
+)
+
+// validateVNICTypes checks that the VNIC types of the networks and ports of
+// the machine are supported, so that the machine fails with a clear error
+// before any port is created.
+func validateVNICTypes(machineSpec *machinev1alpha1.OpenstackProviderSpec) error {
+	for i, network := range machineSpec.Networks {
+		if network.VNICType != "" && !vnicTypes.Has(network.VNICType) {
+			return fmt.Errorf("network %d: unknown vnicType %q, must be one of %v", i, network.VNICType, sets.List(vnicTypes))
+		}
+	}
+	for i, port := range machineSpec.Ports {
+		if port.VNICType != "" && !vnicTypes.Has(port.VNICType) {
+			return fmt.Errorf("port %d: unknown vnicType %q, must be one of %v", i, port.VNICType, sets.List(vnicTypes))
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedPorts deletes the ports created for the machine which are not
+// attached to a server. They are left behind if creating the server fails
+// after its ports were created, and would otherwise never be deleted.
+//
+// Only ports with one of the names the machine's ports are given and the tag
+// of the cluster are considered, so that we never delete a port which was
+// not created for the machine.
+func deleteOrphanedPorts(machine *machinev1.Machine, scope scope.Scope, portOpts []capov1.PortOpts) error {
+	networkClient, err := scope.NewNetworkClient()
+	if err != nil {
+		return err
+	}
+	networkService, err := networking.NewService(scope)
+	if err != nil {
+		return err
+	}
+
+	clusterTag := utils.GetClusterNameWithNamespace(machine)
+	for i := range portOpts {
+		portName := networking.GetPortName(machine.Name, &portOpts[i], i)
+
+		portList, err := networkClient.ListPort(ports.ListOpts{Name: portName, Tags: clusterTag})
+		if err != nil {
+			return fmt.Errorf("error listing ports named %s: %w", portName, err)
+		}
+
+		for _, port := range portList {
+			if port.DeviceID != "" {
+				continue
+			}
+
+			if portOpts[i].Trunk != nil && *portOpts[i].Trunk {
+				if err := networkService.DeleteTrunk(machine, port.ID); err != nil {
+					return err
+				}
+			}
+			if err := networkService.DeletePort(machine, port.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// releaseErrorInstancePorts prepares the ports of an instance in the ERROR
+// state for deletion. Such an instance may have been only partially wired up:
+// its ports are not attached interfaces, so they are deleted by name. Before
+// that, floating IPs are disassociated from them, so that floating IPs of the
+// machine can still be released, and their trunks are deleted, which detaches
+// any subports.
+//
+// As in deleteOrphanedPorts, only ports with the names and the cluster tag of
+// the machine's ports, which are not bound to another server, are considered.
+func releaseErrorInstancePorts(machine *machinev1.Machine, scope scope.Scope, portOpts []capov1.PortOpts, instanceID string) error {
+	networkClient, err := scope.NewNetworkClient()
+	if err != nil {
+		return err
+	}
+
+	clusterTag := utils.GetClusterNameWithNamespace(machine)
+	for i := range portOpts {
+		portName := networking.GetPortName(machine.Name, &portOpts[i], i)
+
+		portList, err := networkClient.ListPort(ports.ListOpts{Name: portName, Tags: clusterTag})
+		if err != nil {
+			return fmt.Errorf("error listing ports named %s: %w", portName, err)
+		}
+
+		for _, port := range portList {
+			if port.DeviceID != "" && port.DeviceID != instanceID {
+				continue
+			}
+
+			fips, err := networkClient.ListFloatingIP(floatingips.ListOpts{PortID: port.ID})
+			if err != nil {
+				return fmt.Errorf("error listing floating IPs of port %s: %w", port.ID, err)
+			}
+			for _, fip := range fips {
+				// An empty port ID is sent as a null port_id, which
+				// disassociates the floating IP
+				if _, err := networkClient.UpdateFloatingIP(fip.ID, floatingips.UpdateOpts{PortID: ptr.To("")}); err != nil {
+					return fmt.Errorf("error disassociating floating IP %s from port %s: %w", fip.FloatingIP, port.ID, err)
+				}
+			}
+
+			trunkList, err := networkClient.ListTrunk(trunks.ListOpts{PortID: port.ID})
+			if err != nil {
+				return fmt.Errorf("error listing trunks of port %s: %w", port.ID, err)
+			}
+			for _, trunk := range trunkList {
+				if err := networkClient.DeleteTrunk(trunk.ID); err != nil {
+					return fmt.Errorf("error deleting trunk %s of port %s: %w", trunk.ID, port.ID, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/trunks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestDeleteOrphanedPorts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+	networkClient := mockScopeFactory.NetworkClient.EXPECT()
+
+	machine := &machinev1beta1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker-0",
+			Namespace: "openshift-machine-api",
+			Labels:    map[string]string{machinev1beta1.MachineClusterIDLabel: "cluster"},
+		},
+	}
+	trunk := true
+	portOpts := []capov1.PortOpts{
+		{},
+		{Trunk: &trunk, NameSuffix: "storage"},
+	}
+
+	// The first port is attached to a server, so it isn't deleted
+	networkClient.ListPort(ports.ListOpts{Name: "worker-0-0", Tags: "openshift-machine-api-cluster"}).
+		Return([]ports.Port{{ID: "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60", DeviceID: "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"}}, nil)
+	networkClient.ListPort(ports.ListOpts{Name: "worker-0-storage", Tags: "openshift-machine-api-cluster"}).
+		Return([]ports.Port{{ID: "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d"}}, nil)
+	networkClient.ListTrunk(trunks.ListOpts{PortID: "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d"}).
+		Return([]trunks.Trunk{{ID: "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a"}}, nil)
+	networkClient.DeleteTrunk("5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a").Return(nil)
+	networkClient.DeletePort("0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d").Return(nil)
+
+	if err := deleteOrphanedPorts(machine, mockScopeFactory, portOpts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestReleaseErrorInstancePorts(t *testing.T) {
+	const instanceID = "3b5d7f9a-1c3e-4a5b-8d7f-9a1b3c5d7e9f"
+
+	mockCtrl := gomock.NewController(t)
+	mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+	networkClient := mockScopeFactory.NetworkClient.EXPECT()
+
+	machine := &machinev1beta1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker-0",
+			Namespace: "openshift-machine-api",
+			Labels:    map[string]string{machinev1beta1.MachineClusterIDLabel: "cluster"},
+		},
+	}
+	trunk := true
+	portOpts := []capov1.PortOpts{
+		{Trunk: &trunk},
+		{NameSuffix: "storage"},
+		{NameSuffix: "other"},
+	}
+
+	// The primary port was created and has a floating IP and a trunk, but
+	// was never bound to the server
+	networkClient.ListPort(ports.ListOpts{Name: "worker-0-0", Tags: "openshift-machine-api-cluster"}).
+		Return([]ports.Port{{ID: "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"}}, nil)
+	gomock.InOrder(
+		networkClient.ListFloatingIP(floatingips.ListOpts{PortID: "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"}).
+			Return([]floatingips.FloatingIP{{ID: "2c4e6a8b-0d1f-4a3c-9e5b-7d9f1b3d5e7a", FloatingIP: "203.0.113.10"}}, nil),
+		networkClient.UpdateFloatingIP("2c4e6a8b-0d1f-4a3c-9e5b-7d9f1b3d5e7a", gomock.Any()).
+			DoAndReturn(func(_ string, opts floatingips.UpdateOptsBuilder) (*floatingips.FloatingIP, error) {
+				expectDisassociation(t, opts)
+				return &floatingips.FloatingIP{}, nil
+			}),
+		networkClient.ListTrunk(trunks.ListOpts{PortID: "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"}).
+			Return([]trunks.Trunk{{ID: "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a"}}, nil),
+		networkClient.DeleteTrunk("5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a").Return(nil),
+	)
+
+	// The second port was never created
+	networkClient.ListPort(ports.ListOpts{Name: "worker-0-storage", Tags: "openshift-machine-api-cluster"}).
+		Return(nil, nil)
+
+	// The third port is bound to another server, so it is left alone
+	networkClient.ListPort(ports.ListOpts{Name: "worker-0-other", Tags: "openshift-machine-api-cluster"}).
+		Return([]ports.Port{{ID: "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d", DeviceID: "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d"}}, nil)
+
+	if err := releaseErrorInstancePorts(machine, mockScopeFactory, portOpts, instanceID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidateVNICTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineSpec machinev1alpha1.OpenstackProviderSpec
+		wantErr     bool
+	}{
+		{
+			name: "default VNIC types",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{}},
+				Ports:    []machinev1alpha1.PortOpts{{}},
+			},
+		},
+		{
+			name: "new VNIC types",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{VNICType: "vdpa"}},
+				Ports:    []machinev1alpha1.PortOpts{{VNICType: "remote-managed"}, {VNICType: "direct-physical"}},
+			},
+		},
+		{
+			name: "unknown VNIC type of a network",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{VNICType: "sriov"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown VNIC type of a port",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Ports: []machinev1alpha1.PortOpts{{VNICType: "Direct"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVNICTypes(&tt.machineSpec)
+			if tt.wantErr && err == nil {
+				t.Errorf("expected an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// expectDisassociation checks that the floating IP update opts send a null
+// port_id, which disassociates the floating IP from its port.
+func expectDisassociation(t *testing.T, opts floatingips.UpdateOptsBuilder) {
+	t.Helper()
+	body, err := opts.ToFloatingIPUpdateMap()
+	if err != nil {
+		t.Fatalf("Unexpected error building the floating IP update: %v", err)
+	}
+	floatingIP, _ := body["floatingip"].(map[string]interface{})
+	if portID, ok := floatingIP["port_id"]; !ok || portID != nil {
+		t.Errorf("Expected the floating IP update to send a null port_id, got %v", body)
+	}
+}
@@ -0,0 +1,155 @@
+package machine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	clconfig "github.com/coreos/container-linux-config-transpiler/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// IgnitionMergeKey is the key of the userData secret with the Ignition config
+// which the ignition-merge postprocessor merges into the user data.
+const IgnitionMergeKey = "ignitionMerge"
+
+// UserDataPostprocessor transforms the user data of a machine after it was
+// rendered. The postprocessor is chosen by name with the postprocessor key of
+// the userData secret, which it is given to read any other keys from.
+type UserDataPostprocessor interface {
+	Postprocess(userData string, userDataSecret *corev1.Secret) (string, error)
+}
+
+// UserDataPostprocessorFunc is a function which is a UserDataPostprocessor.
+type UserDataPostprocessorFunc func(userData string, userDataSecret *corev1.Secret) (string, error)
+
+func (f UserDataPostprocessorFunc) Postprocess(userData string, userDataSecret *corev1.Secret) (string, error) {
+	return f(userData, userDataSecret)
+}
+
+var (
+	postprocessorsMu sync.RWMutex
+	postprocessors   = make(map[string]UserDataPostprocessor)
+)
+
+func init() {
+	RegisterUserDataPostprocessor("ct", UserDataPostprocessorFunc(transpileContainerLinuxConfig))
+	RegisterUserDataPostprocessor("ignition-merge", UserDataPostprocessorFunc(mergeIgnitionConfig))
+	RegisterUserDataPostprocessor("none", UserDataPostprocessorFunc(func(userData string, _ *corev1.Secret) (string, error) {
+		return userData, nil
+	}))
+}
+
+// RegisterUserDataPostprocessor makes a postprocessor available by name to
+// the userData secrets of machines, so that downstreams can add their own.
+// It panics if a postprocessor is already registered with the name, and is
+// meant to be called from init functions.
+func RegisterUserDataPostprocessor(name string, postprocessor UserDataPostprocessor) {
+	postprocessorsMu.Lock()
+	defer postprocessorsMu.Unlock()
+
+	if postprocessor == nil {
+		panic("userdata postprocessor " + name + " is nil")
+	}
+	if _, ok := postprocessors[name]; ok {
+		panic("userdata postprocessor " + name + " is already registered")
+	}
+	postprocessors[name] = postprocessor
+}
+
+// UserDataPostprocessors returns the names of the registered postprocessors,
+// sorted.
+func UserDataPostprocessors() []string {
+	postprocessorsMu.RLock()
+	defer postprocessorsMu.RUnlock()
+
+	names := make([]string, 0, len(postprocessors))
+	for name := range postprocessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// postprocessUserData transforms the user data with the named postprocessor.
+func postprocessUserData(name, userData string, userDataSecret *corev1.Secret) (string, error) {
+	postprocessorsMu.RLock()
+	postprocessor, ok := postprocessors[name]
+	postprocessorsMu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unknown postprocessor: '%s'", name)
+	}
+	return postprocessor.Postprocess(userData, userDataSecret)
+}
+
+// transpileContainerLinuxConfig converts a Container Linux Config to an
+// Ignition config with the ct transpiler.
+func transpileContainerLinuxConfig(userData string, _ *corev1.Secret) (string, error) {
+	clcfg, ast, report := clconfig.Parse([]byte(userData))
+	if len(report.Entries) > 0 {
+		return "", fmt.Errorf("%s", report.String())
+	}
+
+	ignCfg, report := clconfig.Convert(clcfg, "openstack-metadata", ast)
+	if len(report.Entries) > 0 {
+		return "", fmt.Errorf("%s", report.String())
+	}
+
+	ud, err := json.Marshal(&ignCfg)
+	if err != nil {
+		return "", err
+	}
+	return string(ud), nil
+}
+
+// mergeIgnitionConfig merges the Ignition config in the ignitionMerge key of
+// the userData secret into the Ignition config of the user data. The config
+// is embedded as a data URL in the configs which Ignition merges when the
+// instance boots: config.merge with spec 3, and config.append with spec 2.
+func mergeIgnitionConfig(userData string, userDataSecret *corev1.Secret) (string, error) {
+	merge, ok := userDataSecret.Data[IgnitionMergeKey]
+	if !ok {
+		return "", fmt.Errorf("userData secret %s has no key %s to merge", userDataSecret.Name, IgnitionMergeKey)
+	}
+	if !json.Valid(merge) {
+		return "", fmt.Errorf("key %s of userData secret %s is not an Ignition config", IgnitionMergeKey, userDataSecret.Name)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(userData))
+	decoder.UseNumber()
+	var config map[string]interface{}
+	if err := decoder.Decode(&config); err != nil {
+		return "", fmt.Errorf("configs can only be merged into Ignition user data: %w", err)
+	}
+	ignition, _ := config["ignition"].(map[string]interface{})
+	version, _ := ignition["version"].(string)
+	var field string
+	switch {
+	case strings.HasPrefix(version, "2."):
+		field = "append"
+	case strings.HasPrefix(version, "3."):
+		field = "merge"
+	default:
+		return "", fmt.Errorf("configs can't be merged into user data with Ignition version %q", version)
+	}
+
+	ignitionConfig, _ := ignition["config"].(map[string]interface{})
+	if ignitionConfig == nil {
+		ignitionConfig = make(map[string]interface{})
+		ignition["config"] = ignitionConfig
+	}
+	configs, _ := ignitionConfig[field].([]interface{})
+	ignitionConfig[field] = append(configs, map[string]interface{}{
+		"source": "data:;base64," + base64.StdEncoding.EncodeToString(merge),
+	})
+
+	out, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
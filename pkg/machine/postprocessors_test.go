@@ -0,0 +1,101 @@
+package machine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRegisterUserDataPostprocessor(t *testing.T) {
+	RegisterUserDataPostprocessor("test-upper", UserDataPostprocessorFunc(func(userData string, secret *corev1.Secret) (string, error) {
+		return strings.ToUpper(userData) + string(secret.Data["suffix"]), nil
+	}))
+
+	for _, name := range []string{"ct", "ignition-merge", "none", "test-upper"} {
+		found := false
+		for _, registered := range UserDataPostprocessors() {
+			found = found || registered == name
+		}
+		if !found {
+			t.Errorf("Expected postprocessor %s to be registered", name)
+		}
+	}
+
+	secret := &corev1.Secret{Data: map[string][]byte{"suffix": []byte("!")}}
+	if userData, err := postprocessUserData("test-upper", "hello", secret); err != nil || userData != "HELLO!" {
+		t.Errorf("Expected the registered postprocessor to be used, got %q, %v", userData, err)
+	}
+	if userData, err := postprocessUserData("none", "hello", secret); err != nil || userData != "hello" {
+		t.Errorf("Expected the user data to be unchanged, got %q, %v", userData, err)
+	}
+	if _, err := postprocessUserData("jsonnet", "hello", secret); err == nil {
+		t.Errorf("Expected an error for an unknown postprocessor")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected registering a postprocessor twice to panic")
+		}
+	}()
+	RegisterUserDataPostprocessor("test-upper", UserDataPostprocessorFunc(transpileContainerLinuxConfig))
+}
+
+func TestMergeIgnitionConfig(t *testing.T) {
+	merge := `{"ignition":{"version":"3.2.0"},"storage":{"files":[{"path":"/etc/motd","contents":{"source":"data:,hello"}}]}}`
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-user-data"},
+		Data:       map[string][]byte{IgnitionMergeKey: []byte(merge)},
+	}
+	source := map[string]interface{}{"source": "data:;base64," + base64.StdEncoding.EncodeToString([]byte(merge))}
+
+	tests := []struct {
+		name     string
+		userData string
+		field    string
+		expected []interface{}
+	}{
+		{
+			name:     "spec 3 with a config to merge",
+			userData: `{"ignition":{"version":"3.2.0","config":{"merge":[{"source":"https://api-int:22623/config/worker"}]}}}`,
+			field:    "merge",
+			expected: []interface{}{map[string]interface{}{"source": "https://api-int:22623/config/worker"}, source},
+		},
+		{
+			name:     "spec 2",
+			userData: `{"ignition":{"version":"2.2.0"}}`,
+			field:    "append",
+			expected: []interface{}{source},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userData, err := mergeIgnitionConfig(tt.userData, secret)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var config struct {
+				Ignition struct {
+					Config map[string][]interface{} `json:"config"`
+				} `json:"ignition"`
+			}
+			if err := json.Unmarshal([]byte(userData), &config); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if configs := config.Ignition.Config[tt.field]; !reflect.DeepEqual(configs, tt.expected) {
+				t.Errorf("Expected configs %v, got %v", tt.expected, configs)
+			}
+		})
+	}
+
+	if _, err := mergeIgnitionConfig("#cloud-config", secret); err == nil {
+		t.Errorf("Expected an error merging into user data which isn't Ignition")
+	}
+	if _, err := mergeIgnitionConfig(`{"ignition":{"version":"3.2.0"}}`, &corev1.Secret{}); err == nil {
+		t.Errorf("Expected an error without a config to merge")
+	}
+}
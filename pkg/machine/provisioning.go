@@ -0,0 +1,100 @@
+package machine
+
+import (
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Milestones of the provisioning of a machine, which are the values of the
+// milestone label of mapo_machine_provisioning_duration_seconds.
+const (
+	// provisioningInstanceActive is when the instance first became ACTIVE
+	provisioningInstanceActive = "instance_active"
+
+	// provisioningProviderIDSet is when the providerID was set
+	provisioningProviderIDSet = "provider_id_set"
+
+	// provisioningAddressesSet is when the first IP address was set in the
+	// status of the machine
+	provisioningAddressesSet = "addresses_set"
+)
+
+// provisioningProgress is what a reconcile of a machine has reached of its
+// provisioning before changing it.
+type provisioningProgress struct {
+	instanceActive bool
+	providerIDSet  bool
+	addressesSet   bool
+}
+
+// getProvisioningProgress returns the milestones of its provisioning which
+// the machine has reached.
+func getProvisioningProgress(machine *machinev1.Machine) provisioningProgress {
+	return provisioningProgress{
+		instanceActive: instanceWasActive(machine),
+		providerIDSet:  machine.Spec.ProviderID != nil,
+		addressesSet:   hasIPAddress(machine.Status.Addresses),
+	}
+}
+
+// instanceWasActive returns true if the instance of the machine has been
+// ACTIVE, which is assumed once it has a state other than BUILD, so that an
+// instance which is started again after being stopped isn't counted again.
+func instanceWasActive(machine *machinev1.Machine) bool {
+	if condition := conditions.Get(machine, InstanceReadyCondition); condition != nil {
+		return condition.Status == corev1.ConditionTrue || condition.Reason != "Instance"+instanceStateBuild
+	}
+	state := machine.Annotations[maoMachine.MachineInstanceStateAnnotationName]
+	return state != "" && state != instanceStateBuild
+}
+
+// instanceBecameActive returns true if the instance of the machine is ACTIVE
+// and had not been before.
+func (before provisioningProgress) instanceBecameActive(machine *machinev1.Machine) bool {
+	return !before.instanceActive && conditions.IsTrue(machine, InstanceReadyCondition)
+}
+
+// hasIPAddress returns true if any of the addresses is an IP address rather
+// than a hostname.
+func hasIPAddress(addresses []corev1.NodeAddress) bool {
+	for _, address := range addresses {
+		if address.Type == corev1.NodeInternalIP || address.Type == corev1.NodeExternalIP {
+			return true
+		}
+	}
+	return false
+}
+
+// recordProvisioningMilestones observes the time since the creation of the
+// machine for each milestone which it reached since before.
+func recordProvisioningMilestones(machine *machinev1.Machine, before provisioningProgress, availabilityZone string) {
+	after := provisioningProgress{
+		instanceActive: conditions.IsTrue(machine, InstanceReadyCondition),
+		providerIDSet:  machine.Spec.ProviderID != nil,
+		addressesSet:   hasIPAddress(machine.Status.Addresses),
+	}
+
+	var machineSet string
+	if ref := metav1.GetControllerOf(machine); ref != nil && ref.Kind == "MachineSet" {
+		machineSet = ref.Name
+	}
+	elapsed := time.Since(machine.CreationTimestamp.Time).Seconds()
+	observe := func(milestone string) {
+		machineProvisioningDuration.WithLabelValues(machine.Namespace, machineSet, availabilityZone, milestone).Observe(elapsed)
+	}
+
+	if after.instanceActive && !before.instanceActive {
+		observe(provisioningInstanceActive)
+	}
+	if after.providerIDSet && !before.providerIDSet {
+		observe(provisioningProviderIDSet)
+	}
+	if after.addressesSet && !before.addressesSet {
+		observe(provisioningAddressesSet)
+	}
+}
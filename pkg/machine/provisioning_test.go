@@ -0,0 +1,111 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func provisioningDurationCount(t *testing.T, machineSet, milestone string) uint64 {
+	t.Helper()
+
+	metric, err := machineProvisioningDuration.GetMetricWithLabelValues("openshift-machine-api", machineSet, "az-1", milestone)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var m dto.Metric
+	if err := metric.(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestGetProvisioningProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    string
+		expected bool
+	}{
+		{name: "no instance"},
+		{name: "building", state: instanceStateBuild},
+		{name: "active", state: "ACTIVE", expected: true},
+		{name: "stopped after being active", state: "SHUTOFF", expected: true},
+		{name: "rebuilding after being active", state: instanceStateRebuild, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &machinev1.Machine{}
+			if tt.state != "" {
+				setInstanceReadyCondition(machine, "instance-id", tt.state)
+			}
+			if active := getProvisioningProgress(machine).instanceActive; active != tt.expected {
+				t.Errorf("Expected instance active %t, got %t", tt.expected, active)
+			}
+		})
+	}
+
+	// Machines reconciled before the InstanceReady condition have the
+	// instance state annotation
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		"machine.openshift.io/instance-state": "ACTIVE",
+	}}}
+	if !getProvisioningProgress(machine).instanceActive {
+		t.Errorf("Expected the instance of the state annotation to be active")
+	}
+
+	machine.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeHostName, Address: "worker-0"}}
+	if getProvisioningProgress(machine).addressesSet {
+		t.Errorf("Expected a hostname not to count as an address")
+	}
+	machine.Status.Addresses = append(machine.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.5"})
+	if !getProvisioningProgress(machine).addressesSet {
+		t.Errorf("Expected the addresses to be set")
+	}
+}
+
+func TestRecordProvisioningMilestones(t *testing.T) {
+	isController := true
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "provisioning-abcde",
+			Namespace:         "openshift-machine-api",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Minute)),
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "MachineSet", Name: "provisioning", Controller: &isController},
+			},
+		},
+	}
+	count := func(milestone string) uint64 { return provisioningDurationCount(t, "provisioning", milestone) }
+	beforeActive, beforeProviderID, beforeAddresses := count(provisioningInstanceActive), count(provisioningProviderIDSet), count(provisioningAddressesSet)
+
+	// The instance is still being built
+	before := getProvisioningProgress(machine)
+	setInstanceReadyCondition(machine, "instance-id", instanceStateBuild)
+	machine.Spec.ProviderID = ptr.To("openstack:///instance-id")
+	recordProvisioningMilestones(machine, before, "az-1")
+
+	// The instance became ACTIVE and got its addresses
+	before = getProvisioningProgress(machine)
+	setInstanceReadyCondition(machine, "instance-id", "ACTIVE")
+	machine.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.5"}}
+	recordProvisioningMilestones(machine, before, "az-1")
+
+	// Nothing changed
+	recordProvisioningMilestones(machine, getProvisioningProgress(machine), "az-1")
+
+	for milestone, before := range map[string]uint64{
+		provisioningInstanceActive: beforeActive,
+		provisioningProviderIDSet:  beforeProviderID,
+		provisioningAddressesSet:   beforeAddresses,
+	} {
+		if n := count(milestone) - before; n != 1 {
+			t.Errorf("Expected milestone %s to be observed once, got %d", milestone, n)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/instanceactions"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// Events of the create action of a server, whose timestamps give how long
+// scheduling and building the server took.
+const (
+	instanceEventSchedule = "conductor_schedule_and_build_instances"
+	instanceEventBuild    = "compute__do_build_and_run_instance"
+)
+
+// provisioningTimings are the durations of the steps of creating the
+// instance of a machine which are measured by MAPO.
+type provisioningTimings struct {
+	mu sync.Mutex
+
+	// validation is how long validating the machine and preparing the
+	// request to create its instance took
+	validation time.Duration
+
+	// portCreation is how long the requests to create the ports of the
+	// instance took
+	portCreation time.Duration
+
+	// volumesStarted is when the first volume of the instance was created,
+	// and serverRequested when the server was requested, after all its
+	// volumes were available
+	volumesStarted  time.Time
+	serverRequested time.Time
+}
+
+func (t *provisioningTimings) setValidation(duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.validation = duration
+}
+
+func (t *provisioningTimings) addPortCreation(duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.portCreation += duration
+}
+
+func (t *provisioningTimings) volumeCreated(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.volumesStarted.IsZero() {
+		t.volumesStarted = at
+	}
+}
+
+func (t *provisioningTimings) setServerRequested(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.serverRequested = at
+}
+
+// durations returns how long validation and port creation took, and how
+// long it took from creating the first volume until all the volumes were
+// available, which is 0 if no volume was created.
+func (t *provisioningTimings) durations() (validation, portCreation, volumeProvisioning time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.volumesStarted.IsZero() && !t.serverRequested.IsZero() {
+		volumeProvisioning = t.serverRequested.Sub(t.volumesStarted)
+	}
+	return t.validation, t.portCreation, volumeProvisioning
+}
+
+// provisioningTimingsByMachine holds the timings of the instances being
+// created until they are summarized.
+type provisioningTimingsByMachine struct {
+	mu      sync.Mutex
+	timings map[types.UID]*provisioningTimings
+}
+
+func newProvisioningTimingsByMachine() *provisioningTimingsByMachine {
+	return &provisioningTimingsByMachine{timings: make(map[types.UID]*provisioningTimings)}
+}
+
+// start returns new timings for the machine, replacing those of an earlier
+// attempt to create its instance.
+func (p *provisioningTimingsByMachine) start(machine *machinev1.Machine) *provisioningTimings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timings := &provisioningTimings{}
+	p.timings[machine.UID] = timings
+	return timings
+}
+
+// pop returns the timings of the machine, if any, and forgets them.
+func (p *provisioningTimingsByMachine) pop(machine *machinev1.Machine) *provisioningTimings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timings := p.timings[machine.UID]
+	delete(p.timings, machine.UID)
+	return timings
+}
+
+// serverBuildDurations returns how long scheduling and building the server
+// took, from the events of its create action. They are 0 if the events are
+// not reported, e.g. because the cloud hides them from the user.
+func serverBuildDurations(actions []instanceactions.InstanceActionDetail) (scheduling, build time.Duration) {
+	for _, action := range actions {
+		if action.Action != "create" || action.Events == nil {
+			continue
+		}
+		for _, event := range *action.Events {
+			if event.StartTime.IsZero() || event.FinishTime.IsZero() {
+				continue
+			}
+			switch event.Event {
+			case instanceEventSchedule:
+				scheduling = event.FinishTime.Sub(event.StartTime)
+			case instanceEventBuild:
+				build = event.FinishTime.Sub(event.StartTime)
+			}
+		}
+	}
+	return scheduling, build
+}
+
+// formatProvisioningSummary returns the message of the event summarizing the
+// provisioning of a machine. Steps which weren't measured are left out.
+func formatProvisioningSummary(total time.Duration, timings *provisioningTimings, actions []instanceactions.InstanceActionDetail) string {
+	var steps []string
+	addStep := func(name string, duration time.Duration) {
+		if duration > 0 {
+			steps = append(steps, fmt.Sprintf("%s %s", name, duration.Round(100*time.Millisecond)))
+		}
+	}
+
+	if timings != nil {
+		validation, portCreation, volumeProvisioning := timings.durations()
+		addStep("validation", validation)
+		addStep("port creation", portCreation)
+		addStep("volume provisioning", volumeProvisioning)
+	}
+	scheduling, build := serverBuildDurations(actions)
+	addStep("scheduling", scheduling)
+	addStep("server build", build)
+
+	message := fmt.Sprintf("Provisioned in %s", total.Round(time.Second))
+	if len(steps) > 0 {
+		message += ": " + strings.Join(steps, ", ")
+	}
+	return message
+}
+
+// recordProvisioningSummary is called when the instance of the machine has
+// become ACTIVE for the first time. It records an event with how long the
+// steps of provisioning the machine took: those measured while creating its
+// instance, unless the controller was restarted since, and those reported by
+// the create action of the server.
+func (oc *OpenstackClient) recordProvisioningSummary(ctx context.Context, machine *machinev1.Machine, instanceID string) {
+	timings := oc.provisioningTimings.pop(machine)
+
+	var actions []instanceactions.InstanceActionDetail
+	instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err == nil {
+		actions, err = instanceService.GetServerActions(instanceID, serverActionsLimit)
+	}
+	if err != nil {
+		klog.Warningf("Machine %s: unable to get actions of instance %s: %v", machine.Name, instanceID, err)
+	}
+
+	total := time.Since(machine.CreationTimestamp.Time)
+	oc.eventRecorder.Event(machine, corev1.EventTypeNormal, "ProvisioningSummary", formatProvisioningSummary(total, timings, actions))
+}
@@ -0,0 +1,86 @@
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/instanceactions"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestFormatProvisioningSummary(t *testing.T) {
+	start := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	actions := []instanceactions.InstanceActionDetail{
+		{
+			Action: "stop",
+			Events: &[]instanceactions.Event{{Event: "compute_stop_instance", StartTime: start, FinishTime: start.Add(time.Hour)}},
+		},
+		{
+			Action: "create",
+			Events: &[]instanceactions.Event{
+				{Event: instanceEventSchedule, StartTime: start, FinishTime: start.Add(1500 * time.Millisecond)},
+				{Event: instanceEventBuild, StartTime: start.Add(2 * time.Second), FinishTime: start.Add(72 * time.Second)},
+			},
+		},
+	}
+
+	timings := &provisioningTimings{}
+	timings.setValidation(1200 * time.Millisecond)
+	timings.addPortCreation(time.Second)
+	timings.addPortCreation(1300 * time.Millisecond)
+	timings.volumeCreated(start)
+	timings.volumeCreated(start.Add(10 * time.Second))
+	timings.setServerRequested(start.Add(45 * time.Second))
+
+	tests := []struct {
+		name     string
+		timings  *provisioningTimings
+		actions  []instanceactions.InstanceActionDetail
+		expected string
+	}{
+		{
+			name:     "all steps",
+			timings:  timings,
+			actions:  actions,
+			expected: "Provisioned in 2m5s: validation 1.2s, port creation 2.3s, volume provisioning 45s, scheduling 1.5s, server build 1m10s",
+		},
+		{
+			name:     "controller restarted while the server was built",
+			actions:  actions,
+			expected: "Provisioned in 2m5s: scheduling 1.5s, server build 1m10s",
+		},
+		{
+			name:     "no events",
+			actions:  []instanceactions.InstanceActionDetail{{Action: "create"}},
+			expected: "Provisioned in 2m5s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if message := formatProvisioningSummary(125*time.Second, tt.timings, tt.actions); message != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, message)
+			}
+		})
+	}
+}
+
+func TestDeleteForgetsProvisioningTimings(t *testing.T) {
+	oc := &OpenstackClient{
+		eventRecorder:       record.NewFakeRecorder(10),
+		provisioningTimings: newProvisioningTimingsByMachine(),
+	}
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: "machine-uid"}}
+	oc.provisioningTimings.start(machine)
+
+	// The machine is deleted before its instance is provisioned, and
+	// deleting it fails since it has no clouds secret
+	if err := oc.Delete(context.Background(), machine); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if timings := oc.provisioningTimings.pop(machine); timings != nil {
+		t.Errorf("Expected the timings of the machine to be forgotten")
+	}
+}
@@ -0,0 +1,171 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// qosPolicyService is the part of clients.InstanceService which manages the
+// QoS policies of ports.
+type qosPolicyService interface {
+	GetQoSPolicyID(nameOrID string) (string, error)
+	ListPortsWithQoSPolicy(serverID string) ([]clients.PortWithQoSPolicy, error)
+	SetPortQoSPolicy(portID, policyID string) error
+}
+
+// portQoSPolicies returns the name or ID of the QoS policy of each port of the
+// machine, in the order of createCAPOPorts, or nil if no port has a QoS
+// policy. A network has a port for each of its subnets when it has no
+// network filter, and all of them get the QoS policy of the network.
+func portQoSPolicies(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) []string {
+	if len(extensions.Networks) == 0 && len(extensions.Ports) == 0 {
+		return nil
+	}
+
+	var qosPolicies []string
+	for i := range machineSpec.Networks {
+		var qosPolicy string
+		if i < len(extensions.Networks) {
+			qosPolicy = extensions.Networks[i].QoSPolicy
+		}
+		networkPorts := networkParamToCapov1PortOpts(&machineSpec.Networks[i], nil, nil, &machineSpec.Trunk, true)
+		for range networkPorts {
+			qosPolicies = append(qosPolicies, qosPolicy)
+		}
+	}
+	for i := range machineSpec.Ports {
+		var qosPolicy string
+		if i < len(extensions.Ports) {
+			qosPolicy = extensions.Ports[i].QoSPolicy
+		}
+		qosPolicies = append(qosPolicies, qosPolicy)
+	}
+
+	for _, qosPolicy := range qosPolicies {
+		if qosPolicy != "" {
+			return qosPolicies
+		}
+	}
+	return nil
+}
+
+// validatePortQoSPolicies returns an error if any of the QoS policies of the
+// ports of the machine doesn't exist.
+func validatePortQoSPolicies(qosPolicies []string, qosService qosPolicyService) error {
+	for _, qosPolicy := range qosPolicies {
+		if qosPolicy == "" {
+			continue
+		}
+		if _, err := qosService.GetQoSPolicyID(qosPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// portQoSPolicyIDs returns the IDs of the QoS policies, given by name or ID.
+// Ports without a QoS policy have an empty ID.
+func portQoSPolicyIDs(qosPolicies []string, qosService qosPolicyService) ([]string, error) {
+	qosPolicyIDs := make([]string, len(qosPolicies))
+	for i, qosPolicy := range qosPolicies {
+		if qosPolicy == "" {
+			continue
+		}
+		qosPolicyID, err := qosService.GetQoSPolicyID(qosPolicy)
+		if err != nil {
+			return nil, err
+		}
+		qosPolicyIDs[i] = qosPolicyID
+	}
+	return qosPolicyIDs, nil
+}
+
+// setPortQoSPolicies records the IDs of the QoS policies, in the order of
+// createCAPOPorts, of the ports created for the instance.
+func (s *instanceScope) setPortQoSPolicies(instanceName string, portOpts []capov1.PortOpts, qosPolicyIDs []string) {
+	for i := range portOpts {
+		if i >= len(qosPolicyIDs) || qosPolicyIDs[i] == "" {
+			continue
+		}
+		if s.qosPolicyIDs == nil {
+			s.qosPolicyIDs = make(map[string]string)
+		}
+		s.qosPolicyIDs[networking.GetPortName(instanceName, &portOpts[i], i)] = qosPolicyIDs[i]
+	}
+}
+
+// qosPolicyCreateOpts adds the QoS policy of a port to a port create
+// request, so that the instance never uses the port without it.
+type qosPolicyCreateOpts struct {
+	ports.CreateOptsBuilder
+	qosPolicyIDs map[string]string
+}
+
+func (opts qosPolicyCreateOpts) ToPortCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	port, _ := base["port"].(map[string]interface{})
+	name, _ := port["name"].(string)
+	if qosPolicyID, ok := opts.qosPolicyIDs[name]; ok {
+		port["qos_policy_id"] = qosPolicyID
+	}
+
+	return base, nil
+}
+
+// reconcilePortQoSPolicies sets the QoS policy of each port of the instance
+// which doesn't have the one requested for it. Ports get their QoS policy
+// when they are created, so this only changes the ports of instances created
+// by older versions, or whose QoS policy was changed in OpenStack.
+func reconcilePortQoSPolicies(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, qosPolicies []string, instanceID string, qosService qosPolicyService) error {
+	instancePorts, err := qosService.ListPortsWithQoSPolicy(instanceID)
+	if err != nil {
+		return fmt.Errorf("list ports of instance err: %v", err)
+	}
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+
+	for i, qosPolicy := range qosPolicies {
+		if qosPolicy == "" || i >= len(portOpts) {
+			continue
+		}
+		portName := networking.GetPortName(machine.Name, &portOpts[i], i)
+
+		var port *clients.PortWithQoSPolicy
+		for j := range instancePorts {
+			if instancePorts[j].Name == portName {
+				port = &instancePorts[j]
+				break
+			}
+		}
+		if port == nil {
+			continue
+		}
+
+		qosPolicyID, err := qosService.GetQoSPolicyID(qosPolicy)
+		if err != nil {
+			return maoMachine.InvalidMachineConfiguration("port %s: %v", portName, err)
+		}
+		if port.QoSPolicyID == qosPolicyID {
+			continue
+		}
+
+		if err := qosService.SetPortQoSPolicy(port.ID, qosPolicyID); err != nil {
+			capoRecorder.Warnf(machine, "FailedSetPortQoSPolicy", "Failed to set QoS policy %s of port %s: %v", qosPolicy, portName, err)
+			return fmt.Errorf("set QoS policy of port %s err: %v", portName, err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulSetPortQoSPolicy", "Set QoS policy %s of port %s", qosPolicy, portName)
+	}
+	return nil
+}
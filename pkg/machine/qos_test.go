@@ -0,0 +1,158 @@
+package machine
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/qos/policies"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeQoSPolicyService struct {
+	policyIDs map[string]string
+	ports     []clients.PortWithQoSPolicy
+
+	// updated maps the IDs of the ports whose QoS policy was set to the
+	// ID of their QoS policy
+	updated map[string]string
+}
+
+func (f *fakeQoSPolicyService) GetQoSPolicyID(nameOrID string) (string, error) {
+	if id, ok := f.policyIDs[nameOrID]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("could not find QoS policy: %s", nameOrID)
+}
+
+func (f *fakeQoSPolicyService) ListPortsWithQoSPolicy(_ string) ([]clients.PortWithQoSPolicy, error) {
+	return f.ports, nil
+}
+
+func (f *fakeQoSPolicyService) SetPortQoSPolicy(portID, policyID string) error {
+	f.updated[portID] = policyID
+	return nil
+}
+
+func TestPortQoSPolicies(t *testing.T) {
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{
+			{
+				// A port for each subnet
+				Subnets: []machinev1alpha1.SubnetParam{
+					{Filter: machinev1alpha1.SubnetFilter{Name: "subnet-a"}},
+					{Filter: machinev1alpha1.SubnetFilter{Name: "subnet-b"}},
+				},
+			},
+			{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"},
+		},
+		Ports: []machinev1alpha1.PortOpts{
+			{NameSuffix: "sriov"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		extensions clients.ProviderSpecExtensions
+		expected   []string
+	}{
+		{
+			name: "no QoS policies",
+		},
+		{
+			name: "QoS policies of networks and ports",
+			extensions: clients.ProviderSpecExtensions{
+				Networks: []clients.NetworkParamExtensions{{QoSPolicy: "bw-limit"}},
+				Ports:    []clients.PortOptsExtensions{{QoSPolicy: "min-bw"}},
+			},
+			expected: []string{"bw-limit", "bw-limit", "", "min-bw"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := portQoSPolicies(machineSpec, &tt.extensions); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected QoS policies %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPortQoSPolicyCreateOpts(t *testing.T) {
+	const minBWPolicyID = "8f7e6d5c-4b3a-4291-8a7b-6c5d4e3f2a1b"
+
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"}},
+		Ports:    []machinev1alpha1.PortOpts{{NameSuffix: "sriov"}},
+	}
+	qosService := &fakeQoSPolicyService{policyIDs: map[string]string{"min-bw": minBWPolicyID}}
+
+	qosPolicyIDs, err := portQoSPolicyIDs([]string{"", "min-bw"}, qosService)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := &instanceScope{}
+	s.setPortQoSPolicies("worker-0", createCAPOPorts(machineSpec, nil, nil, true), qosPolicyIDs)
+
+	for _, tt := range []struct {
+		name     string
+		expected interface{}
+	}{
+		{name: "worker-0-0"},
+		{name: "worker-0-sriov", expected: minBWPolicyID},
+	} {
+		createOpts := qosPolicyCreateOpts{
+			CreateOptsBuilder: ports.CreateOpts{Name: tt.name, NetworkID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"},
+			qosPolicyIDs:      s.qosPolicyIDs,
+		}
+		body, err := createOpts.ToPortCreateMap()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		port := body["port"].(map[string]interface{})
+		if actual := port["qos_policy_id"]; actual != tt.expected {
+			t.Errorf("Expected QoS policy %v of port %s, got %v", tt.expected, tt.name, actual)
+		}
+	}
+
+	if _, err := portQoSPolicyIDs([]string{"missing"}, qosService); err == nil {
+		t.Errorf("Expected an error for a missing QoS policy")
+	}
+}
+
+func TestReconcilePortQoSPolicies(t *testing.T) {
+	const (
+		minBWPolicyID = "8f7e6d5c-4b3a-4291-8a7b-6c5d4e3f2a1b"
+		primaryPortID = "9e1f5b8e-3f3a-4a4c-8a47-1c2b3d4e5f60"
+		sriovPortID   = "0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d"
+	)
+
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"}},
+		Ports:    []machinev1alpha1.PortOpts{{NameSuffix: "sriov"}},
+	}
+
+	qosService := &fakeQoSPolicyService{
+		policyIDs: map[string]string{"min-bw": minBWPolicyID},
+		ports: []clients.PortWithQoSPolicy{
+			{Port: ports.Port{ID: primaryPortID, Name: "worker-0-0"}, QoSPolicyExt: policies.QoSPolicyExt{QoSPolicyID: minBWPolicyID}},
+			{Port: ports.Port{ID: sriovPortID, Name: "worker-0-sriov"}},
+		},
+		updated: map[string]string{},
+	}
+
+	if err := reconcilePortQoSPolicies(machine, machineSpec, []string{"min-bw", "min-bw"}, "c7a2f1d4-8b3e-4f5a-9c6d-0e1f2a3b4c5d", qosService); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{sriovPortID: minBWPolicyID}
+	if !reflect.DeepEqual(qosService.updated, expected) {
+		t.Errorf("Expected QoS policies to be set %v, got %v", expected, qosService.updated)
+	}
+}
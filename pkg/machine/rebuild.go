@@ -0,0 +1,135 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// RebuildAnnotationKey requests that the instance of a machine is rebuilt
+// from the image of its providerSpec, e.g. because its root disk is corrupted.
+// The instance keeps its ID and its ports. The annotation is removed once the
+// rebuild has been requested.
+const RebuildAnnotationKey = "machine.openshift.io/openstack-rebuild"
+
+// RebuildInProgressAnnotationKey is set on a machine while its instance is
+// being rebuilt. Its value is the ID of the image it is rebuilt from.
+const RebuildInProgressAnnotationKey = "machine.openshift.io/openstack-rebuild-in-progress"
+
+// instanceStateRebuild is the state of an instance which is being rebuilt.
+const instanceStateRebuild = "REBUILD"
+
+// rebuildRequeueAfter is how often we check whether a rebuild has finished.
+const rebuildRequeueAfter = 30 * time.Second
+
+// rebuildService is the part of clients.InstanceService which rebuilds
+// instances.
+type rebuildService interface {
+	GetImageID(imageName string, selection *clients.ImageSelection) (string, int, error)
+	RebuildServer(serverID, imageID string) error
+}
+
+// hasRebuildAnnotations returns true if a rebuild of the instance of machine
+// has been requested or is in progress.
+func hasRebuildAnnotations(machine *machinev1.Machine) bool {
+	_, requested := machine.Annotations[RebuildAnnotationKey]
+	_, inProgress := machine.Annotations[RebuildInProgressAnnotationKey]
+	return requested || inProgress
+}
+
+// reconcileRebuild rebuilds the instance if the machine requests it with
+// RebuildAnnotationKey. It returns a RequeueAfterError until the rebuild has
+// finished.
+func (oc *OpenstackClient) reconcileRebuild(ctx context.Context, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus, service rebuildService) error {
+	original := machine.DeepCopy()
+	inProgress, err := rebuildInstance(machine, machineSpec, extensions, instanceStatus, service)
+	_, rebuilding := machine.Annotations[RebuildInProgressAnnotationKey]
+	if rebuilding {
+		setInstanceStateAnnotation(machine, instanceStateRebuild, oc.params.DisableInstanceStateAnnotation)
+	}
+	if !reflect.DeepEqual(original.Annotations, machine.Annotations) {
+		if patchErr := oc.client.Patch(ctx, machine, client.MergeFrom(original)); patchErr != nil {
+			return fmt.Errorf("error patching %q: %w", machine.Name, patchErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// The status of the machine isn't patched again until the rebuild has
+	// finished, so report it now
+	if rebuilding {
+		original := machine.DeepCopy()
+		setInstanceReadyCondition(machine, instanceStatus.ID(), instanceStateRebuild)
+		if !reflect.DeepEqual(original.Status.Conditions, machine.Status.Conditions) {
+			if patchErr := oc.client.Status().Patch(ctx, machine, client.MergeFrom(original)); patchErr != nil {
+				return fmt.Errorf("error patching status of %q: %w", machine.Name, patchErr)
+			}
+		}
+	}
+	if inProgress {
+		return &maoMachine.RequeueAfterError{RequeueAfter: rebuildRequeueAfter}
+	}
+	return nil
+}
+
+// rebuildInstance requests the rebuild of the instance, and reports its
+// progress in events. It returns true while the rebuild is in progress. The
+// request and the progress of the rebuild are recorded in the annotations of
+// the machine; the state of the instance is left to the caller.
+func rebuildInstance(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus, service rebuildService) (bool, error) {
+	state := instanceStatus.State()
+
+	if imageID, ok := machine.Annotations[RebuildInProgressAnnotationKey]; ok {
+		switch state {
+		case instanceStateRebuild:
+			return true, nil
+		case capov1.InstanceStateError:
+			capoRecorder.Warnf(machine, "FailedRebuildInstance", "Rebuilding instance %s from image %s failed", instanceStatus.ID(), imageID)
+		default:
+			capoRecorder.Eventf(machine, "RebuiltInstance", "Rebuilt instance %s from image %s", instanceStatus.ID(), imageID)
+		}
+		delete(machine.Annotations, RebuildInProgressAnnotationKey)
+		return false, nil
+	}
+
+	if _, ok := machine.Annotations[RebuildAnnotationKey]; !ok {
+		return false, nil
+	}
+	// Rebuilding the root volume of a server needs a newer compute API
+	if machineSpec.RootVolume != nil {
+		capoRecorder.Warnf(machine, "InvalidRebuild", "Instance %s boots from a volume and can't be rebuilt", instanceStatus.ID())
+		delete(machine.Annotations, RebuildAnnotationKey)
+		return false, nil
+	}
+	// Wait for other operations on the instance to finish
+	if state != capov1.InstanceStateActive && state != capov1.InstanceStateShutoff && state != capov1.InstanceStateError {
+		return true, nil
+	}
+
+	// The image is looked up again, so that the instance is rebuilt from the
+	// newest image if several have its name
+	imageID, _, err := service.GetImageID(machineSpec.Image, extensions.ImageSelection)
+	if err != nil {
+		return false, fmt.Errorf("get image %s err: %v", machineSpec.Image, err)
+	}
+	if err := service.RebuildServer(instanceStatus.ID(), imageID); err != nil {
+		capoRecorder.Warnf(machine, "FailedRebuildInstance", "Failed to rebuild instance %s from image %s: %v", instanceStatus.ID(), imageID, err)
+		return false, fmt.Errorf("rebuild instance %s err: %v", instanceStatus.ID(), err)
+	}
+	capoRecorder.Eventf(machine, "RebuildingInstance", "Rebuilding instance %s from image %s", instanceStatus.ID(), imageID)
+
+	delete(machine.Annotations, RebuildAnnotationKey)
+	machine.Annotations[RebuildInProgressAnnotationKey] = imageID
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeRebuildService struct {
+	rebuilt []string
+}
+
+func (f *fakeRebuildService) GetImageID(string, *clients.ImageSelection) (string, int, error) {
+	return "rhcos-image-id", 1, nil
+}
+
+func (f *fakeRebuildService) RebuildServer(_, imageID string) error {
+	f.rebuilt = append(f.rebuilt, imageID)
+	return nil
+}
+
+func TestRebuildInstance(t *testing.T) {
+	const instanceID = "8b0d2f4b-6d8f-4b0d-8f4b-6d8f0b2d4f6b"
+	instance := func(state string) *compute.InstanceStatus {
+		return compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID, Status: state}}, logr.Discard())
+	}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{Image: "rhcos"}
+	extensions := &clients.ProviderSpecExtensions{}
+
+	tests := []struct {
+		name            string
+		machineSpec     *machinev1alpha1.OpenstackProviderSpec
+		annotations     map[string]string
+		states          []string
+		expectedRebuilt []string
+	}{
+		{
+			name:            "active instance",
+			annotations:     map[string]string{RebuildAnnotationKey: ""},
+			states:          []string{"ACTIVE", "REBUILD", "REBUILD", "ACTIVE"},
+			expectedRebuilt: []string{"rhcos-image-id"},
+		},
+		{
+			name:            "instance in error",
+			annotations:     map[string]string{RebuildAnnotationKey: ""},
+			states:          []string{"ERROR", "REBUILD", "ACTIVE"},
+			expectedRebuilt: []string{"rhcos-image-id"},
+		},
+		{
+			name:            "resizing instance",
+			annotations:     map[string]string{RebuildAnnotationKey: ""},
+			states:          []string{"RESIZE", "ACTIVE", "REBUILD", "ACTIVE"},
+			expectedRebuilt: []string{"rhcos-image-id"},
+		},
+		{
+			name:            "failed rebuild",
+			annotations:     map[string]string{RebuildAnnotationKey: ""},
+			states:          []string{"ACTIVE", "REBUILD", "ERROR"},
+			expectedRebuilt: []string{"rhcos-image-id"},
+		},
+		{
+			name:   "without the annotation",
+			states: []string{"ACTIVE"},
+		},
+		{
+			name:        "instance booted from volume",
+			machineSpec: &machinev1alpha1.OpenstackProviderSpec{RootVolume: &machinev1alpha1.RootVolume{SourceUUID: "rhcos", Size: 50}},
+			annotations: map[string]string{RebuildAnnotationKey: ""},
+			states:      []string{"ACTIVE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Annotations: tt.annotations}}
+			spec := machineSpec
+			if tt.machineSpec != nil {
+				spec = tt.machineSpec
+			}
+			service := &fakeRebuildService{}
+
+			// Reconcile once in each state of the instance, until the
+			// rebuild is done
+			for i, state := range tt.states {
+				inProgress, err := rebuildInstance(machine, spec, extensions, instance(state), service)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(inProgress).To(Equal(i < len(tt.states)-1), "in state %s", state)
+				if inProgress && len(service.rebuilt) > 0 {
+					g.Expect(machine.Annotations).To(HaveKey(RebuildInProgressAnnotationKey))
+				}
+			}
+
+			g.Expect(service.rebuilt).To(Equal(tt.expectedRebuilt))
+			g.Expect(machine.Annotations).NotTo(HaveKey(RebuildAnnotationKey))
+			g.Expect(machine.Annotations).NotTo(HaveKey(RebuildInProgressAnnotationKey))
+			// The state of the instance is set by reconcileRebuild
+			g.Expect(machine.Annotations).NotTo(HaveKey(maoMachine.MachineInstanceStateAnnotationName))
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// ReplacesAnnotationKey is set on a machine of a MachineSet whose server is
+// about to be created while another machine of the MachineSet is being
+// deleted, e.g. by MachineHealthCheck remediation. Its value is the name of
+// the deleted machine, whose placement the machine inherits.
+const ReplacesAnnotationKey = "machine.openshift.io/openstack-replaces"
+
+// ReplacedByAnnotationKey is set on a machine being deleted whose placement
+// was inherited by a new machine of its MachineSet. Its value is the name of
+// the new machine, so that the placement is only inherited once.
+const ReplacedByAnnotationKey = "machine.openshift.io/openstack-replaced-by"
+
+// InheritedServerGroupAnnotationKey is set on a machine which replaces a
+// machine being deleted and inherits its server group. Its value is the ID
+// of the server group.
+const InheritedServerGroupAnnotationKey = "machine.openshift.io/openstack-inherited-server-group"
+
+// findReplacedMachine returns the machine of the same MachineSet as machine
+// which is being deleted and whose placement machine inherits: the one
+// already claimed by machine, or else the first deleted one which isn't
+// claimed yet. It returns nil if there is none.
+func findReplacedMachine(machine *machinev1.Machine, machines []machinev1.Machine) *machinev1.Machine {
+	ref := metav1.GetControllerOf(machine)
+	if ref == nil || ref.Kind != "MachineSet" {
+		return nil
+	}
+
+	var replaced *machinev1.Machine
+	for i := range machines {
+		other := &machines[i]
+		if other.UID == machine.UID || other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if otherRef := metav1.GetControllerOf(other); otherRef == nil || otherRef.UID != ref.UID {
+			continue
+		}
+		switch other.Annotations[ReplacedByAnnotationKey] {
+		case machine.Name:
+			return other
+		case "":
+		default:
+			continue
+		}
+		if replaced == nil || other.DeletionTimestamp.Before(replaced.DeletionTimestamp) ||
+			(other.DeletionTimestamp.Equal(replaced.DeletionTimestamp) && other.Name < replaced.Name) {
+			replaced = other
+		}
+	}
+	return replaced
+}
+
+// setInheritedPlacement makes machine inherit the placement of the replaced
+// machine: its availability zone, unless the providerSpec or the failure
+// domain label of machine sets one, and if inheritServerGroup is set, the
+// server group it used.
+func setInheritedPlacement(machine, replaced *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, inheritServerGroup bool) {
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[ReplacesAnnotationKey] = replaced.Name
+
+	if zone := replaced.Labels[maoMachine.MachineAZLabelName]; zone != "" && machineAvailabilityZone(machine, machineSpec) == "" {
+		if machine.Labels == nil {
+			machine.Labels = make(map[string]string)
+		}
+		machine.Labels[corev1.LabelTopologyZone] = zone
+	}
+
+	if inheritServerGroup {
+		if serverGroupID := coalesce(replaced.Annotations[MachineSetServerGroupAnnotationKey], replaced.Annotations[ServerGroupOwnerAnnotationKey]); serverGroupID != "" {
+			machine.Annotations[InheritedServerGroupAnnotationKey] = serverGroupID
+		}
+	}
+}
+
+// inheritPlacement makes a machine of a MachineSet whose server is about to be
+// created inherit the placement of a machine of the MachineSet which is
+// being deleted, so that replacing unhealthy machines doesn't change the
+// distribution of the machines of the MachineSet across availability zones.
+func (oc *OpenstackClient) inheritPlacement(ctx context.Context, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	if _, ok := machine.Annotations[ReplacesAnnotationKey]; ok {
+		return nil
+	}
+	if ref := metav1.GetControllerOf(machine); ref == nil || ref.Kind != "MachineSet" {
+		return nil
+	}
+
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines, client.InNamespace(machine.Namespace)); err != nil {
+		return fmt.Errorf("error listing machines: %w", err)
+	}
+	replaced := findReplacedMachine(machine, machines.Items)
+	if replaced == nil {
+		return nil
+	}
+
+	// The optimistic lock fails if another machine claimed the replaced
+	// machine in the meantime
+	if replaced.Annotations[ReplacedByAnnotationKey] != machine.Name {
+		patch := client.MergeFromWithOptions(replaced.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if replaced.Annotations == nil {
+			replaced.Annotations = make(map[string]string)
+		}
+		replaced.Annotations[ReplacedByAnnotationKey] = machine.Name
+		if err := oc.client.Patch(ctx, replaced, patch); err != nil {
+			return fmt.Errorf("error recording that machine %s replaces %s: %w", machine.Name, replaced.Name, err)
+		}
+	}
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	setInheritedPlacement(machine, replaced, machineSpec, extensions.InheritServerGroup)
+	if err := oc.client.Patch(ctx, machine, patch); err != nil {
+		return err
+	}
+	klog.Infof("Machine %s: inherited the placement of machine %s which it replaces: availability zone %q, server group %q",
+		machine.Name, replaced.Name, machine.Labels[corev1.LabelTopologyZone], machine.Annotations[InheritedServerGroupAnnotationKey])
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "InheritedPlacement", "Replaces machine %s", replaced.Name)
+	return nil
+}
+
+// inheritedServerGroups is an instanceService which uses the server group
+// inherited by a machine from the machine it replaces, if it still exists.
+type inheritedServerGroups struct {
+	instanceService
+	serverGroupID  string
+	machineService *clients.InstanceService
+}
+
+func (r *inheritedServerGroups) GetServerGroupsByName(name string) ([]servergroups.ServerGroup, error) {
+	serverGroup, err := r.machineService.GetServerGroupByID(r.serverGroupID)
+	if err == nil {
+		return []servergroups.ServerGroup{*serverGroup}, nil
+	}
+	if !capoerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting inherited server group %s: %w", r.serverGroupID, err)
+	}
+	return r.instanceService.GetServerGroupsByName(name)
+}
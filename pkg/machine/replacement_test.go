@@ -0,0 +1,118 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newReplacementMachine(name string, machineSetUID types.UID, deleted time.Time) machinev1.Machine {
+	isController := true
+	machine := machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openshift-machine-api",
+			UID:       types.UID(name + "-uid"),
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "MachineSet", Name: "worker", UID: machineSetUID, Controller: &isController},
+			},
+		},
+	}
+	if !deleted.IsZero() {
+		machine.DeletionTimestamp = &metav1.Time{Time: deleted}
+	}
+	return machine
+}
+
+func TestFindReplacedMachine(t *testing.T) {
+	now := time.Now()
+	machine := newReplacementMachine("worker-new", "worker-uid", time.Time{})
+
+	claimed := newReplacementMachine("worker-claimed", "worker-uid", now.Add(-time.Hour))
+	claimed.Annotations = map[string]string{ReplacedByAnnotationKey: "worker-other"}
+
+	machines := []machinev1.Machine{
+		machine,
+		newReplacementMachine("worker-running", "worker-uid", time.Time{}),
+		newReplacementMachine("other-deleted", "other-uid", now.Add(-time.Hour)),
+		claimed,
+		newReplacementMachine("worker-deleted-later", "worker-uid", now.Add(-time.Minute)),
+		newReplacementMachine("worker-deleted-first", "worker-uid", now.Add(-10*time.Minute)),
+	}
+
+	replaced := findReplacedMachine(&machine, machines)
+	if replaced == nil || replaced.Name != "worker-deleted-first" {
+		t.Fatalf("Expected the first deleted machine of the MachineSet to be replaced, got %v", replaced)
+	}
+
+	// The machine claimed by machine is kept
+	machines[4].Annotations = map[string]string{ReplacedByAnnotationKey: machine.Name}
+	if replaced := findReplacedMachine(&machine, machines); replaced == nil || replaced.Name != "worker-deleted-later" {
+		t.Errorf("Expected the machine claimed by the machine to be replaced, got %v", replaced)
+	}
+
+	if replaced := findReplacedMachine(&machine, machines[:4]); replaced != nil {
+		t.Errorf("Expected no machine to be replaced, got %s", replaced.Name)
+	}
+}
+
+func TestSetInheritedPlacement(t *testing.T) {
+	replaced := newReplacementMachine("worker-old", "worker-uid", time.Now())
+	replaced.Labels = map[string]string{maoMachine.MachineAZLabelName: "az-2"}
+	replaced.Annotations = map[string]string{ServerGroupOwnerAnnotationKey: "server-group-id"}
+
+	tests := []struct {
+		name               string
+		machineSpec        machinev1alpha1.OpenstackProviderSpec
+		zoneLabel          string
+		inheritServerGroup bool
+		expectedZone       string
+		expectedGroup      string
+	}{
+		{
+			name:         "zone chosen by Nova",
+			expectedZone: "az-2",
+		},
+		{
+			name:         "zone of the providerSpec",
+			machineSpec:  machinev1alpha1.OpenstackProviderSpec{AvailabilityZone: "az-1"},
+			expectedZone: "",
+		},
+		{
+			name:         "zone of the failure domain label",
+			zoneLabel:    "az-3",
+			expectedZone: "az-3",
+		},
+		{
+			name:               "server group",
+			inheritServerGroup: true,
+			expectedZone:       "az-2",
+			expectedGroup:      "server-group-id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := newReplacementMachine("worker-new", "worker-uid", time.Time{})
+			if tt.zoneLabel != "" {
+				machine.Labels = map[string]string{corev1.LabelTopologyZone: tt.zoneLabel}
+			}
+			setInheritedPlacement(&machine, &replaced, &tt.machineSpec, tt.inheritServerGroup)
+
+			if got := machine.Annotations[ReplacesAnnotationKey]; got != replaced.Name {
+				t.Errorf("Expected the machine to replace %s, got %q", replaced.Name, got)
+			}
+			if got := machine.Labels[corev1.LabelTopologyZone]; got != tt.expectedZone {
+				t.Errorf("Expected zone %q, got %q", tt.expectedZone, got)
+			}
+			if got := machine.Annotations[InheritedServerGroupAnnotationKey]; got != tt.expectedGroup {
+				t.Errorf("Expected server group %q, got %q", tt.expectedGroup, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// retainedVolumeDetachRequeueAfter is how often we check whether the retained
+// volumes have been detached.
+const retainedVolumeDetachRequeueAfter = 10 * time.Second
+
+// volumeStatusDetaching is the status of a volume which is being detached.
+const volumeStatusDetaching = "detaching"
+
+// retainedVolumeService is the part of clients.InstanceService which detaches
+// retained volumes.
+type retainedVolumeService interface {
+	GetVolumeByName(name string) (*volumes.Volume, error)
+	DetachVolume(serverID, volumeID string) error
+}
+
+// validateRetainedBlockDevices checks that only additional block devices with
+// volume storage are retained.
+func validateRetainedBlockDevices(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	for i := range extensions.AdditionalBlockDevices {
+		if !extensions.AdditionalBlockDevices[i].Retain {
+			continue
+		}
+		if i >= len(machineSpec.AdditionalBlockDevices) {
+			return fmt.Errorf("additional block device %d is retained but is not in additionalBlockDevices", i)
+		}
+		blockDevice := &machineSpec.AdditionalBlockDevices[i]
+		if blockDevice.Storage.Type != machinev1alpha1.VolumeBlockDevice {
+			return fmt.Errorf("additional block device %s is retained, so its storage type must be %s", blockDevice.Name, machinev1alpha1.VolumeBlockDevice)
+		}
+	}
+	return nil
+}
+
+// retainedVolumeNames returns the names of the volumes of the retained
+// additional block devices, named as CAPO creates them.
+func retainedVolumeNames(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) []string {
+	var names []string
+	for i := range extensions.AdditionalBlockDevices {
+		if !extensions.AdditionalBlockDevices[i].Retain || i >= len(machineSpec.AdditionalBlockDevices) {
+			continue
+		}
+		blockDevice := &machineSpec.AdditionalBlockDevices[i]
+		if blockDevice.Storage.Type != machinev1alpha1.VolumeBlockDevice {
+			continue
+		}
+		names = append(names, fmt.Sprintf("%s-%s", machine.Name, blockDevice.Name))
+	}
+	return names
+}
+
+// isAttachedTo returns true if the volume is attached to the server.
+func isAttachedTo(volume *volumes.Volume, serverID string) bool {
+	for _, attachment := range volume.Attachments {
+		if attachment.ServerID == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// detachRetainedVolumes requests the detachment of the retained volumes which
+// are attached to the server. It returns the IDs of the retained volumes, and
+// whether any of them is still being detached. Volumes which don't exist are
+// skipped.
+func detachRetainedVolumes(serverID string, names []string, service retainedVolumeService) ([]string, bool, error) {
+	var volumeIDs []string
+	detaching := false
+	for _, name := range names {
+		volume, err := service.GetVolumeByName(name)
+		if err != nil {
+			return nil, false, fmt.Errorf("get volume %s err: %v", name, err)
+		}
+		if volume == nil {
+			continue
+		}
+		volumeIDs = append(volumeIDs, volume.ID)
+
+		attached := isAttachedTo(volume, serverID)
+		switch {
+		case attached && volume.Status == volumeStatusInUse:
+			if err := service.DetachVolume(serverID, volume.ID); err != nil {
+				return nil, false, fmt.Errorf("detach volume %s err: %v", volume.ID, err)
+			}
+			detaching = true
+		case attached || volume.Status == volumeStatusDetaching:
+			// Wait for the requested detachment to finish
+			detaching = true
+		}
+	}
+	return volumeIDs, detaching, nil
+}
+
+// reconcileRetainedVolumes detaches the retained volumes from the instance
+// before it is deleted, so that Nova doesn't delete them with it. It returns
+// a RequeueAfterError until they are all detached.
+func (oc *OpenstackClient) reconcileRetainedVolumes(ctx context.Context, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus) error {
+	names := retainedVolumeNames(machine, machineSpec, extensions)
+	if instanceStatus == nil || len(names) == 0 {
+		return nil
+	}
+
+	volumeService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		return err
+	}
+	volumeIDs, detaching, err := detachRetainedVolumes(instanceStatus.ID(), names, volumeService)
+	if err != nil {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "FailedDetachVolume", "Failed to detach retained volumes from instance %s: %v", instanceStatus.ID(), err)
+		return err
+	}
+	if detaching {
+		return &maoMachine.RequeueAfterError{RequeueAfter: retainedVolumeDetachRequeueAfter}
+	}
+	if len(volumeIDs) > 0 {
+		oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "RetainedVolumes", "Detached retained volumes %s from instance %s", strings.Join(volumeIDs, ", "), instanceStatus.ID())
+	}
+	return nil
+}
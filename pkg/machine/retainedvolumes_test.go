@@ -0,0 +1,106 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeRetainedVolumeService struct {
+	volumes  map[string]*volumes.Volume
+	detached []string
+}
+
+func (f *fakeRetainedVolumeService) GetVolumeByName(name string) (*volumes.Volume, error) {
+	return f.volumes[name], nil
+}
+
+func (f *fakeRetainedVolumeService) DetachVolume(_, volumeID string) error {
+	f.detached = append(f.detached, volumeID)
+	return nil
+}
+
+func TestRetainedVolumeNames(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+			{Name: "etcd", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "data", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "scratch", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.LocalBlockDevice}},
+		},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		AdditionalBlockDevices: []clients.AdditionalBlockDeviceExtensions{{}, {Retain: true}},
+	}
+
+	g.Expect(retainedVolumeNames(machine, machineSpec, extensions)).To(Equal([]string{"worker-0-data"}))
+	g.Expect(validateRetainedBlockDevices(machineSpec, extensions)).To(Succeed())
+
+	extensions.AdditionalBlockDevices = append(extensions.AdditionalBlockDevices, clients.AdditionalBlockDeviceExtensions{Retain: true})
+	g.Expect(validateRetainedBlockDevices(machineSpec, extensions)).NotTo(Succeed())
+}
+
+func TestDetachRetainedVolumes(t *testing.T) {
+	const serverID = "server-id"
+	attached := []volumes.Attachment{{ServerID: serverID}}
+
+	tests := []struct {
+		name              string
+		volume            *volumes.Volume
+		expectedIDs       []string
+		expectedDetaching bool
+		expectedDetached  []string
+	}{
+		{
+			name:              "attached volume",
+			volume:            &volumes.Volume{ID: "data-volume-id", Status: "in-use", Attachments: attached},
+			expectedIDs:       []string{"data-volume-id"},
+			expectedDetaching: true,
+			expectedDetached:  []string{"data-volume-id"},
+		},
+		{
+			name:              "detaching volume",
+			volume:            &volumes.Volume{ID: "data-volume-id", Status: "detaching", Attachments: attached},
+			expectedIDs:       []string{"data-volume-id"},
+			expectedDetaching: true,
+		},
+		{
+			name:        "detached volume",
+			volume:      &volumes.Volume{ID: "data-volume-id", Status: "available"},
+			expectedIDs: []string{"data-volume-id"},
+		},
+		{
+			name:        "volume attached to another server",
+			volume:      &volumes.Volume{ID: "data-volume-id", Status: "in-use", Attachments: []volumes.Attachment{{ServerID: "other-server-id"}}},
+			expectedIDs: []string{"data-volume-id"},
+		},
+		{
+			name: "missing volume",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			service := &fakeRetainedVolumeService{volumes: map[string]*volumes.Volume{}}
+			if tt.volume != nil {
+				service.volumes["worker-0-data"] = tt.volume
+			}
+
+			volumeIDs, detaching, err := detachRetainedVolumes(serverID, []string{"worker-0-data"}, service)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(volumeIDs).To(Equal(tt.expectedIDs))
+			g.Expect(detaching).To(Equal(tt.expectedDetaching))
+			g.Expect(service.detached).To(Equal(tt.expectedDetached))
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RootVolumeResizeAnnotationKey is the annotation of a machine which allows
+// its root volume to be extended when the size of the root volume in its
+// providerSpec is increased. Without it, a larger size only applies to new
+// machines.
+const RootVolumeResizeAnnotationKey = "machine.openshift.io/openstack-root-volume-resize"
+
+// Values of RootVolumeResizeAnnotationKey.
+const (
+	// RootVolumeResizeExtend extends the root volume. The guest has to grow
+	// its partitions and file systems itself.
+	RootVolumeResizeExtend = "Extend"
+
+	// RootVolumeResizeExtendAndReboot extends the root volume, then soft
+	// reboots the instance, so that its partitions and file systems are
+	// grown when it boots.
+	RootVolumeResizeExtendAndReboot = "ExtendAndReboot"
+)
+
+// RootVolumeRebootPendingAnnotationKey is set on a machine while its root
+// volume is being extended and its instance has to be rebooted afterwards.
+const RootVolumeRebootPendingAnnotationKey = "machine.openshift.io/openstack-root-volume-reboot-pending"
+
+// RootVolumeResizedAnnotationKey is set on a machine once its root volume
+// was reconciled with the size in its providerSpec. Its value is the value
+// of RootVolumeResizeAnnotationKey and the size, so that the root volume is
+// only looked up again, and problems only reported again, when either
+// changes.
+const RootVolumeResizedAnnotationKey = "machine.openshift.io/openstack-root-volume-resized"
+
+// rootVolumeResizeRequeueAfter is how often we check whether the extension of
+// a root volume has finished.
+const rootVolumeResizeRequeueAfter = 15 * time.Second
+
+// Statuses of Cinder volumes.
+const (
+	volumeStatusAvailable      = "available"
+	volumeStatusInUse          = "in-use"
+	volumeStatusErrorExtending = "error_extending"
+)
+
+// rootVolumeService is the part of clients.InstanceService which extends root
+// volumes.
+type rootVolumeService interface {
+	GetVolumeByName(name string) (*volumes.Volume, error)
+	ExtendVolume(volumeID string, size int) error
+	RebootServer(serverID string) error
+}
+
+// reconcileRootVolumeSize extends the root volume of the instance if the
+// machine allows it with RootVolumeResizeAnnotationKey. It returns a
+// RequeueAfterError until the root volume has been extended, and the instance
+// rebooted if requested.
+func (oc *OpenstackClient) reconcileRootVolumeSize(ctx context.Context, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, instanceStatus *compute.InstanceStatus, volumeService rootVolumeService) error {
+	patch := client.MergeFrom(machine.DeepCopy())
+	annotations := maps.Clone(machine.Annotations)
+	inProgress, err := resizeRootVolume(machine, machineSpec, instanceStatus, volumeService)
+	if !maps.Equal(annotations, machine.Annotations) {
+		if patchErr := oc.client.Patch(ctx, machine, patch); patchErr != nil {
+			return fmt.Errorf("error patching %q: %w", machine.Name, patchErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if inProgress {
+		return &maoMachine.RequeueAfterError{RequeueAfter: rootVolumeResizeRequeueAfter}
+	}
+	return nil
+}
+
+// rootVolumeResizedMarker returns the value of RootVolumeResizedAnnotationKey
+// for the value of RootVolumeResizeAnnotationKey and the size of the root
+// volume.
+func rootVolumeResizedMarker(mode string, size int) string {
+	return fmt.Sprintf("%s/%d", mode, size)
+}
+
+// needsRootVolumeResize returns true if the machine allows its root volume to
+// be resized, and the root volume wasn't reconciled with its size and the
+// value of RootVolumeResizeAnnotationKey yet, or has to be rebooted.
+func needsRootVolumeResize(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec) bool {
+	mode := machine.Annotations[RootVolumeResizeAnnotationKey]
+	if mode == "" || machineSpec.RootVolume == nil {
+		return false
+	}
+	if _, ok := machine.Annotations[RootVolumeRebootPendingAnnotationKey]; ok {
+		return true
+	}
+	return machine.Annotations[RootVolumeResizedAnnotationKey] != rootVolumeResizedMarker(mode, machineSpec.RootVolume.Size)
+}
+
+// markRootVolumeResized records that the root volume was reconciled with its
+// size and the value of RootVolumeResizeAnnotationKey.
+func markRootVolumeResized(machine *machinev1.Machine, mode string, size int) {
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[RootVolumeResizedAnnotationKey] = rootVolumeResizedMarker(mode, size)
+}
+
+// resizeRootVolume extends the root volume to the size in the providerSpec,
+// and reboots the instance once it has been extended if the machine asks for
+// it. Root volumes are never shrunk. It returns true while the resize is in
+// progress. The pending reboot, and the size the root volume was reconciled
+// with, are recorded in the annotations of the machine.
+func resizeRootVolume(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, instanceStatus *compute.InstanceStatus, volumeService rootVolumeService) (bool, error) {
+	if !needsRootVolumeResize(machine, machineSpec) {
+		return false, nil
+	}
+	mode := machine.Annotations[RootVolumeResizeAnnotationKey]
+	size := machineSpec.RootVolume.Size
+	if mode != RootVolumeResizeExtend && mode != RootVolumeResizeExtendAndReboot {
+		capoRecorder.Warnf(machine, "InvalidRootVolumeResize", "Annotation %s is %q, which is not one of %s, %s", RootVolumeResizeAnnotationKey, mode, RootVolumeResizeExtend, RootVolumeResizeExtendAndReboot)
+		markRootVolumeResized(machine, mode, size)
+		return false, nil
+	}
+	state := instanceStatus.State()
+	if state != capov1.InstanceStateActive && state != capov1.InstanceStateShutoff {
+		return false, nil
+	}
+
+	volumeName := fmt.Sprintf("%s-root", machine.Name)
+	volume, err := volumeService.GetVolumeByName(volumeName)
+	if err != nil {
+		return false, fmt.Errorf("get root volume %s err: %v", volumeName, err)
+	}
+	if volume == nil {
+		markRootVolumeResized(machine, mode, size)
+		return false, nil
+	}
+	if volume.Status == volumeStatusErrorExtending {
+		capoRecorder.Warnf(machine, "FailedExtendRootVolume", "Root volume %s failed to extend", volume.ID)
+		return false, fmt.Errorf("root volume %s failed to extend", volume.ID)
+	}
+	// Volumes are extending or attaching for a while
+	if volume.Status != volumeStatusInUse && volume.Status != volumeStatusAvailable {
+		return true, nil
+	}
+
+	if _, ok := machine.Annotations[RootVolumeRebootPendingAnnotationKey]; ok {
+		// A stopped instance grows its root file system when it is
+		// started anyway
+		if state == capov1.InstanceStateActive {
+			if err := volumeService.RebootServer(instanceStatus.ID()); err != nil {
+				capoRecorder.Warnf(machine, "FailedRebootInstance", "Failed to reboot instance after extending its root volume: %v", err)
+				return false, fmt.Errorf("reboot instance %s err: %v", instanceStatus.ID(), err)
+			}
+			capoRecorder.Eventf(machine, "RebootedInstance", "Rebooted instance to grow its root volume")
+		}
+		delete(machine.Annotations, RootVolumeRebootPendingAnnotationKey)
+		markRootVolumeResized(machine, mode, size)
+		return false, nil
+	}
+
+	if volume.Size > size {
+		capoRecorder.Warnf(machine, "RootVolumeNotShrunk", "Root volume %s is %d GiB, which is larger than the %d GiB of the providerSpec, and can't be shrunk", volume.ID, volume.Size, size)
+		markRootVolumeResized(machine, mode, size)
+		return false, nil
+	}
+	if volume.Size == size {
+		markRootVolumeResized(machine, mode, size)
+		return false, nil
+	}
+
+	if err := volumeService.ExtendVolume(volume.ID, size); err != nil {
+		capoRecorder.Warnf(machine, "FailedExtendRootVolume", "Failed to extend root volume %s to %d GiB: %v", volume.ID, size, err)
+		return false, fmt.Errorf("extend root volume %s err: %v", volume.ID, err)
+	}
+	capoRecorder.Eventf(machine, "ExtendedRootVolume", "Extended root volume %s from %d GiB to %d GiB", volume.ID, volume.Size, size)
+	if mode == RootVolumeResizeExtendAndReboot {
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[RootVolumeRebootPendingAnnotationKey] = ""
+	}
+	return true, nil
+}
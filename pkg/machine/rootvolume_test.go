@@ -0,0 +1,150 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+)
+
+type fakeRootVolumeService struct {
+	volume   *volumes.Volume
+	lookups  int
+	extended int
+	reboots  int
+}
+
+func (f *fakeRootVolumeService) GetVolumeByName(string) (*volumes.Volume, error) {
+	f.lookups++
+	return f.volume, nil
+}
+
+func (f *fakeRootVolumeService) ExtendVolume(_ string, size int) error {
+	f.extended = size
+	f.volume.Status = "extending"
+	return nil
+}
+
+func (f *fakeRootVolumeService) RebootServer(string) error {
+	f.reboots++
+	return nil
+}
+
+func TestResizeRootVolume(t *testing.T) {
+	const instanceID = "3f5b7d9f-1b3d-4f5b-9d1f-3b5d7f9b1d3f"
+	instance := func(state string) *compute.InstanceStatus {
+		return compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: instanceID, Status: state}}, logr.Discard())
+	}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{RootVolume: &machinev1alpha1.RootVolume{Size: 50}}
+
+	tests := []struct {
+		name            string
+		mode            string
+		state           string
+		volumeSize      int
+		expectedSize    int
+		expectedReboots int
+	}{
+		{
+			name:         "extend",
+			mode:         RootVolumeResizeExtend,
+			state:        "ACTIVE",
+			volumeSize:   25,
+			expectedSize: 50,
+		},
+		{
+			name:            "extend and reboot",
+			mode:            RootVolumeResizeExtendAndReboot,
+			state:           "ACTIVE",
+			volumeSize:      25,
+			expectedSize:    50,
+			expectedReboots: 1,
+		},
+		{
+			name:         "extend and reboot a stopped instance",
+			mode:         RootVolumeResizeExtendAndReboot,
+			state:        "SHUTOFF",
+			volumeSize:   25,
+			expectedSize: 50,
+		},
+		{
+			name:       "without the annotation",
+			state:      "ACTIVE",
+			volumeSize: 25,
+		},
+		{
+			name:       "unknown mode",
+			mode:       "Grow",
+			state:      "ACTIVE",
+			volumeSize: 25,
+		},
+		{
+			name:       "building instance",
+			mode:       RootVolumeResizeExtend,
+			state:      "BUILD",
+			volumeSize: 25,
+		},
+		{
+			name:       "larger volume",
+			mode:       RootVolumeResizeExtend,
+			state:      "ACTIVE",
+			volumeSize: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+			if tt.mode != "" {
+				machine.Annotations = map[string]string{RootVolumeResizeAnnotationKey: tt.mode}
+			}
+			service := &fakeRootVolumeService{volume: &volumes.Volume{ID: "root-volume-id", Size: tt.volumeSize, Status: "in-use"}}
+
+			// Reconcile until the resize is done, with Cinder finishing
+			// the extension in between
+			for i := 0; ; i++ {
+				g.Expect(i).To(BeNumerically("<", 5))
+				inProgress, err := resizeRootVolume(machine, machineSpec, instance(tt.state), service)
+				g.Expect(err).NotTo(HaveOccurred())
+				if !inProgress {
+					break
+				}
+				if service.volume.Status == "extending" {
+					service.volume.Status = "in-use"
+					service.volume.Size = service.extended
+				}
+			}
+
+			g.Expect(service.extended).To(Equal(tt.expectedSize))
+			g.Expect(service.reboots).To(Equal(tt.expectedReboots))
+			g.Expect(machine.Annotations).NotTo(HaveKey(RootVolumeRebootPendingAnnotationKey))
+
+			// Nothing is done, and the volume isn't looked up again, once
+			// it was reconciled with the size of the providerSpec
+			lookups := service.lookups
+			inProgress, err := resizeRootVolume(machine, machineSpec, instance(tt.state), service)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(inProgress).To(BeFalse())
+			g.Expect(service.reboots).To(Equal(tt.expectedReboots))
+			if tt.state == "BUILD" {
+				return
+			}
+			g.Expect(service.lookups).To(Equal(lookups))
+
+			// A new size is reconciled again
+			if tt.mode != "" {
+				larger := &machinev1alpha1.OpenstackProviderSpec{RootVolume: &machinev1alpha1.RootVolume{Size: 200}}
+				g.Expect(needsRootVolumeResize(machine, larger)).To(BeTrue())
+			}
+		})
+	}
+}
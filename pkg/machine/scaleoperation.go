@@ -0,0 +1,125 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MachineSetGenerationAnnotationKey is set on a machine of a MachineSet before
+// its server is created. Its value is the generation of the MachineSet at
+// that time.
+const MachineSetGenerationAnnotationKey = "machine.openshift.io/openstack-machineset-generation"
+
+// ScaleOperationAnnotationKey is set on a machine of a MachineSet before its
+// server is created. Its value identifies the scale operation of the
+// MachineSet which created the machine, and is made of the name and the
+// generation of the MachineSet, so that it can be correlated with the
+// decisions of the autoscaler, which change the replicas of the MachineSet.
+const ScaleOperationAnnotationKey = "machine.openshift.io/openstack-scale-operation"
+
+// scaleOperation is a generation of a MachineSet. Every scale operation
+// changes the replicas of the MachineSet, so it increments its generation.
+type scaleOperation struct {
+	id         string
+	uid        types.UID
+	generation int64
+}
+
+func machineSetScaleOperation(machineSet *machinev1.MachineSet) scaleOperation {
+	return scaleOperation{
+		id:         fmt.Sprintf("%s-%d", machineSet.Name, machineSet.Generation),
+		uid:        machineSet.UID,
+		generation: machineSet.Generation,
+	}
+}
+
+// setScaleOperationAnnotations records the current scale operation of
+// machineSet on machine, unless a scale operation is already recorded on it.
+// It returns true if it changed the annotations of machine.
+func setScaleOperationAnnotations(machine *machinev1.Machine, machineSet *machinev1.MachineSet) bool {
+	if _, ok := machine.Annotations[ScaleOperationAnnotationKey]; ok {
+		return false
+	}
+
+	operation := machineSetScaleOperation(machineSet)
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[MachineSetGenerationAnnotationKey] = strconv.FormatInt(operation.generation, 10)
+	machine.Annotations[ScaleOperationAnnotationKey] = operation.id
+	return true
+}
+
+// machineScaleOperation returns the MachineSet which controls machine and the
+// scale operation recorded on machine. It returns false if machine has no
+// MachineSet or no scale operation.
+func machineScaleOperation(machine *machinev1.Machine) (types.NamespacedName, scaleOperation, bool) {
+	ref := metav1.GetControllerOf(machine)
+	if ref == nil || ref.Kind != "MachineSet" {
+		return types.NamespacedName{}, scaleOperation{}, false
+	}
+	id, ok := machine.Annotations[ScaleOperationAnnotationKey]
+	if !ok {
+		return types.NamespacedName{}, scaleOperation{}, false
+	}
+	generation, err := strconv.ParseInt(machine.Annotations[MachineSetGenerationAnnotationKey], 10, 64)
+	if err != nil {
+		return types.NamespacedName{}, scaleOperation{}, false
+	}
+
+	machineSet := types.NamespacedName{Namespace: machine.Namespace, Name: ref.Name}
+	return machineSet, scaleOperation{id: id, uid: ref.UID, generation: generation}, true
+}
+
+// recordScaleOperation annotates a machine whose server is about to be created
+// with the scale operation of its MachineSet.
+func (oc *OpenstackClient) recordScaleOperation(ctx context.Context, machine *machinev1.Machine) error {
+	if _, ok := machine.Annotations[ScaleOperationAnnotationKey]; ok {
+		return nil
+	}
+	machineSet, err := oc.getMachineSet(ctx, machine)
+	if err != nil || machineSet == nil {
+		return err
+	}
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	if !setScaleOperationAnnotations(machine, machineSet) {
+		return nil
+	}
+	return oc.client.Patch(ctx, machine, patch)
+}
+
+// recordMachineCreated counts a machine whose server was created in the scale
+// operation recorded on it.
+func (oc *OpenstackClient) recordMachineCreated(machine *machinev1.Machine) {
+	machineSet, operation, ok := machineScaleOperation(machine)
+	if !ok {
+		return
+	}
+	klog.V(3).Infof("Machine %s: created in scale operation %s of MachineSet %s", machine.Name, operation.id, machineSet.Name)
+	oc.scaleOperations.machineCreated(machineSet, operation)
+}
+
+// recordMachineDeleted counts a deleted machine in the current scale operation
+// of its MachineSet, which scaled it down. Machines whose MachineSet no longer
+// exists are not counted.
+func (oc *OpenstackClient) recordMachineDeleted(ctx context.Context, machine *machinev1.Machine) {
+	machineSet, err := oc.getMachineSet(ctx, machine)
+	if err != nil {
+		klog.Warningf("Machine %s: not counting the deletion in a scale operation: %v", machine.Name, err)
+		return
+	}
+	if machineSet == nil {
+		return
+	}
+	operation := machineSetScaleOperation(machineSet)
+	klog.V(3).Infof("Machine %s: deleted in scale operation %s of MachineSet %s", machine.Name, operation.id, machineSet.Name)
+	oc.scaleOperations.machineDeleted(client.ObjectKeyFromObject(machineSet), operation)
+}
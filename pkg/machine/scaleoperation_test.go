@@ -0,0 +1,115 @@
+package machine
+
+import (
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newScaleOperationMachineSet(uid types.UID, generation int64) *machinev1.MachineSet {
+	return &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "worker",
+			Namespace:  "openshift-machine-api",
+			UID:        uid,
+			Generation: generation,
+		},
+	}
+}
+
+func TestSetScaleOperationAnnotations(t *testing.T) {
+	machineSet := newScaleOperationMachineSet("machineset-uid", 7)
+	isController := true
+	machine := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker-abcde",
+			Namespace: "openshift-machine-api",
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "MachineSet", Name: "worker", UID: "machineset-uid", Controller: &isController},
+			},
+		},
+	}
+
+	if _, _, ok := machineScaleOperation(machine); ok {
+		t.Errorf("Expected no scale operation before annotating the machine")
+	}
+
+	if !setScaleOperationAnnotations(machine, machineSet) {
+		t.Fatalf("Expected the machine to be annotated")
+	}
+	if got := machine.Annotations[ScaleOperationAnnotationKey]; got != "worker-7" {
+		t.Errorf("Expected scale operation worker-7, got %s", got)
+	}
+	if got := machine.Annotations[MachineSetGenerationAnnotationKey]; got != "7" {
+		t.Errorf("Expected MachineSet generation 7, got %s", got)
+	}
+
+	// The scale operation which created the machine is kept
+	if setScaleOperationAnnotations(machine, newScaleOperationMachineSet("machineset-uid", 8)) {
+		t.Errorf("Expected the annotations of the machine to be kept")
+	}
+
+	key, operation, ok := machineScaleOperation(machine)
+	if !ok {
+		t.Fatalf("Expected a scale operation")
+	}
+	if key != (types.NamespacedName{Namespace: "openshift-machine-api", Name: "worker"}) {
+		t.Errorf("Unexpected MachineSet %v", key)
+	}
+	if operation != machineSetScaleOperation(machineSet) {
+		t.Errorf("Expected scale operation %+v, got %+v", machineSetScaleOperation(machineSet), operation)
+	}
+}
+
+func scaleOperationCount(t *testing.T, counter *prometheus.CounterVec, operation string) float64 {
+	t.Helper()
+	metric, err := counter.GetMetricWithLabelValues("openshift-machine-api", "worker", operation)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// GetMetricWithLabelValues creates missing counters
+	counter.DeleteLabelValues("openshift-machine-api", "worker", operation)
+	return m.GetCounter().GetValue()
+}
+
+func TestScaleOperationMetrics(t *testing.T) {
+	defer scaleOperationMachinesCreated.Reset()
+	defer scaleOperationMachinesDeleted.Reset()
+
+	m := newScaleOperationMetrics()
+	key := types.NamespacedName{Namespace: "openshift-machine-api", Name: "worker"}
+	first := machineSetScaleOperation(newScaleOperationMachineSet("machineset-uid", 1))
+	second := machineSetScaleOperation(newScaleOperationMachineSet("machineset-uid", 2))
+	replaced := machineSetScaleOperation(newScaleOperationMachineSet("other-uid", 1))
+
+	m.machineCreated(key, first)
+	m.machineCreated(key, first)
+	m.machineCreated(key, second)
+	m.machineDeleted(key, second)
+	// Earlier scale operations are no longer counted
+	m.machineCreated(key, first)
+
+	if got := scaleOperationCount(t, scaleOperationMachinesCreated, second.id); got != 1 {
+		t.Errorf("Expected 1 machine created in %s, got %v", second.id, got)
+	}
+	if got := scaleOperationCount(t, scaleOperationMachinesDeleted, second.id); got != 1 {
+		t.Errorf("Expected 1 machine deleted in %s, got %v", second.id, got)
+	}
+	if got := scaleOperationCount(t, scaleOperationMachinesCreated, first.id); got != 0 {
+		t.Errorf("Expected the machines created in %s to be removed, got %v", first.id, got)
+	}
+
+	// A MachineSet which replaced another with the same name
+	m.machineCreated(key, replaced)
+	if got := scaleOperationCount(t, scaleOperationMachinesCreated, replaced.id); got != 1 {
+		t.Errorf("Expected 1 machine created in %s of the new MachineSet, got %v", replaced.id, got)
+	}
+}
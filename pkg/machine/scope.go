@@ -0,0 +1,301 @@
+package machine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/schedulerhints"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// reservationHint is the scheduler hint of the Blazar reservation of a server.
+const reservationHint = "reservation"
+
+// instanceScope wraps a CAPO scope so that we can pass options to OpenStack
+// which can't be expressed in a CAPO InstanceSpec.
+type instanceScope struct {
+	scope.Scope
+	schedulerHints map[string]interface{}
+
+	// bindingProfiles are added to the binding profiles of the ports with
+	// these names
+	bindingProfiles map[string]map[string]interface{}
+
+	// noSecurityGroupPorts are the names of the ports which are created
+	// without security groups
+	noSecurityGroupPorts sets.Set[string]
+
+	// qosPolicyIDs are the IDs of the QoS policies of the ports with these
+	// names
+	qosPolicyIDs map[string]string
+
+	// portConflictRetries is how often the creation of a port is retried
+	// after a conflict
+	portConflictRetries int
+
+	// blockDevices are added to the block device mappings of the server
+	blockDevices []map[string]interface{}
+
+	// timings records how long creating the ports and volumes of the
+	// instance took, if set
+	timings *provisioningTimings
+
+	// lastError is the last error returned by OpenStack while creating the
+	// instance, which CAPO doesn't always wrap
+	lastError error
+}
+
+func newInstanceScope(s scope.Scope, extensions *clients.ProviderSpecExtensions) (*instanceScope, error) {
+	instanceScope := instanceScope{Scope: s}
+
+	// The group hint is passed to CAPO as the InstanceSpec's ServerGroupID
+	if hints := extensions.SchedulerHints; hints != nil || extensions.ReservationID != "" {
+		var opts schedulerhints.SchedulerHints
+		if hints != nil {
+			opts.SameHost = hints.SameHost
+			opts.DifferentHost = hints.DifferentHost
+			if len(hints.Custom) > 0 {
+				opts.AdditionalProperties = make(map[string]interface{}, len(hints.Custom)+1)
+				for k, v := range hints.Custom {
+					opts.AdditionalProperties[k] = v
+				}
+			}
+		}
+		if extensions.ReservationID != "" {
+			if opts.AdditionalProperties == nil {
+				opts.AdditionalProperties = make(map[string]interface{}, 1)
+			}
+			opts.AdditionalProperties[reservationHint] = extensions.ReservationID
+		}
+
+		schedulerHints, err := opts.ToServerSchedulerHintsCreateMap()
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduler hints: %w", err)
+		}
+		instanceScope.schedulerHints = schedulerHints
+	}
+
+	return &instanceScope, nil
+}
+
+// recordError records err, if any, as the last error returned by OpenStack
+// while creating the instance, and returns it.
+func (s *instanceScope) recordError(err error) error {
+	if err != nil {
+		s.lastError = err
+	}
+	return err
+}
+
+// setPortBindingProfiles adds the binding profiles, in the order of
+// createCAPOPorts, to the binding profiles of the ports created for the
+// instance.
+func (s *instanceScope) setPortBindingProfiles(instanceName string, portOpts []capov1.PortOpts, bindingProfiles []map[string]interface{}) {
+	for i := range portOpts {
+		if i >= len(bindingProfiles) || len(bindingProfiles[i]) == 0 {
+			continue
+		}
+		if s.bindingProfiles == nil {
+			s.bindingProfiles = make(map[string]map[string]interface{})
+		}
+		s.bindingProfiles[networking.GetPortName(instanceName, &portOpts[i], i)] = bindingProfiles[i]
+	}
+}
+
+func (s *instanceScope) NewComputeClient() (capoclients.ComputeClient, error) {
+	computeClient, err := s.Scope.NewComputeClient()
+	if err != nil {
+		return nil, err
+	}
+	return &instanceComputeClient{ComputeClient: computeClient, scope: s}, nil
+}
+
+type instanceComputeClient struct {
+	capoclients.ComputeClient
+	scope *instanceScope
+}
+
+func (c *instanceComputeClient) CreateServer(createOpts servers.CreateOptsBuilder) (*capoclients.ServerExt, error) {
+	if len(c.scope.schedulerHints) > 0 {
+		createOpts = schedulerHintsCreateOpts{
+			CreateOptsBuilder: createOpts,
+			schedulerHints:    c.scope.schedulerHints,
+		}
+	}
+	if len(c.scope.blockDevices) > 0 {
+		createOpts = blockDeviceCreateOpts{
+			CreateOptsBuilder: createOpts,
+			blockDevices:      c.scope.blockDevices,
+		}
+	}
+	if c.scope.timings != nil {
+		c.scope.timings.setServerRequested(time.Now())
+	}
+	server, err := c.ComputeClient.CreateServer(createOpts)
+	return server, c.scope.recordError(err)
+}
+
+func (c *instanceComputeClient) GetFlavorFromName(flavor string) (*flavors.Flavor, error) {
+	f, err := c.ComputeClient.GetFlavorFromName(flavor)
+	return f, c.scope.recordError(err)
+}
+
+func (s *instanceScope) NewNetworkClient() (capoclients.NetworkClient, error) {
+	networkClient, err := s.Scope.NewNetworkClient()
+	if err != nil {
+		return nil, err
+	}
+	return &instanceNetworkClient{NetworkClient: networkClient, scope: s}, nil
+}
+
+type instanceNetworkClient struct {
+	capoclients.NetworkClient
+	scope *instanceScope
+}
+
+func (c *instanceNetworkClient) CreatePort(createOpts ports.CreateOptsBuilder) (*ports.Port, error) {
+	if len(c.scope.bindingProfiles) > 0 {
+		createOpts = bindingProfileCreateOpts{
+			CreateOptsBuilder: createOpts,
+			bindingProfiles:   c.scope.bindingProfiles,
+		}
+	}
+	if c.scope.noSecurityGroupPorts.Len() > 0 {
+		createOpts = noSecurityGroupsCreateOpts{
+			CreateOptsBuilder: createOpts,
+			portNames:         c.scope.noSecurityGroupPorts,
+		}
+	}
+	if len(c.scope.qosPolicyIDs) > 0 {
+		createOpts = qosPolicyCreateOpts{
+			CreateOptsBuilder: createOpts,
+			qosPolicyIDs:      c.scope.qosPolicyIDs,
+		}
+	}
+	if c.scope.timings != nil {
+		defer func(started time.Time) {
+			c.scope.timings.addPortCreation(time.Since(started))
+		}(time.Now())
+	}
+	port, err := c.createPortWithConflictRetries(createOpts, c.scope.portConflictRetries)
+	return port, c.scope.recordError(err)
+}
+
+func (s *instanceScope) NewVolumeClient() (capoclients.VolumeClient, error) {
+	volumeClient, err := s.Scope.NewVolumeClient()
+	if err != nil {
+		return nil, err
+	}
+	return &instanceVolumeClient{VolumeClient: volumeClient, scope: s}, nil
+}
+
+type instanceVolumeClient struct {
+	capoclients.VolumeClient
+	scope *instanceScope
+}
+
+func (c *instanceVolumeClient) CreateVolume(createOpts volumes.CreateOptsBuilder) (*volumes.Volume, error) {
+	if c.scope.timings != nil {
+		c.scope.timings.volumeCreated(time.Now())
+	}
+	volume, err := c.VolumeClient.CreateVolume(createOpts)
+	return volume, c.scope.recordError(err)
+}
+
+// bindingProfileCreateOpts adds the binding profile of a port to a port
+// create request. Unlike portsbinding.CreateOptsExt it preserves the keys
+// which were already added to the binding profile, unless they are
+// overridden.
+type bindingProfileCreateOpts struct {
+	ports.CreateOptsBuilder
+	bindingProfiles map[string]map[string]interface{}
+}
+
+func (opts bindingProfileCreateOpts) ToPortCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	port, _ := base["port"].(map[string]interface{})
+	name, _ := port["name"].(string)
+	bindingProfile, ok := opts.bindingProfiles[name]
+	if !ok {
+		return base, nil
+	}
+
+	profile, _ := port["binding:profile"].(map[string]interface{})
+	if profile == nil {
+		profile = make(map[string]interface{}, len(bindingProfile))
+	}
+	for k, v := range bindingProfile {
+		profile[k] = v
+	}
+	port["binding:profile"] = profile
+
+	return base, nil
+}
+
+// portBindingProfiles returns the binding profile of each port of the
+// machine, in the order of createCAPOPorts. All the ports created for the
+// subnets of a network get the binding profile of the network.
+func portBindingProfiles(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) []map[string]interface{} {
+	var bindingProfiles []map[string]interface{}
+	for i := range machineSpec.Networks {
+		var bindingProfile map[string]interface{}
+		if i < len(extensions.Networks) {
+			bindingProfile = extensions.Networks[i].BindingProfile
+		}
+		networkPorts := networkParamToCapov1PortOpts(&machineSpec.Networks[i], nil, nil, &machineSpec.Trunk, true)
+		for range networkPorts {
+			bindingProfiles = append(bindingProfiles, bindingProfile)
+		}
+	}
+	for i := range machineSpec.Ports {
+		var bindingProfile map[string]interface{}
+		if i < len(extensions.Ports) {
+			bindingProfile = extensions.Ports[i].BindingProfile
+		}
+		bindingProfiles = append(bindingProfiles, bindingProfile)
+	}
+	return bindingProfiles
+}
+
+// schedulerHintsCreateOpts adds scheduler hints to a server create request.
+// Unlike schedulerhints.CreateOptsExt it preserves any hints which were
+// already added to the request, e.g. the server group.
+type schedulerHintsCreateOpts struct {
+	servers.CreateOptsBuilder
+	schedulerHints map[string]interface{}
+}
+
+func (opts schedulerHintsCreateOpts) ToServerCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	schedulerHints, _ := base["os:scheduler_hints"].(map[string]interface{})
+	if schedulerHints == nil {
+		schedulerHints = make(map[string]interface{}, len(opts.schedulerHints))
+	}
+	for k, v := range opts.schedulerHints {
+		if _, ok := schedulerHints[k]; !ok {
+			schedulerHints[k] = v
+		}
+	}
+	base["os:scheduler_hints"] = schedulerHints
+
+	return base, nil
+}
@@ -0,0 +1,186 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/schedulerhints"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/portsbinding"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestNewInstanceScopeSchedulerHints(t *testing.T) {
+	tests := []struct {
+		name          string
+		hints         *clients.SchedulerHints
+		reservationID string
+		expected      map[string]interface{}
+		expectErr     bool
+	}{
+		{
+			name:     "no scheduler hints",
+			hints:    nil,
+			expected: nil,
+		},
+		{
+			name: "all scheduler hints",
+			hints: &clients.SchedulerHints{
+				Group:         "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62",
+				SameHost:      []string{"a0cf03a5-d921-4877-bb5c-86d26cf818e1"},
+				DifferentHost: []string{"8c19174f-4220-44f0-824a-cd1eeef10287"},
+				Custom:        map[string]string{"reservation": "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a"},
+			},
+			expected: map[string]interface{}{
+				"same_host":      []string{"a0cf03a5-d921-4877-bb5c-86d26cf818e1"},
+				"different_host": []string{"8c19174f-4220-44f0-824a-cd1eeef10287"},
+				"reservation":    "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+			},
+		},
+		{
+			name:          "reservation",
+			reservationID: "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+			expected: map[string]interface{}{
+				"reservation": "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+			},
+		},
+		{
+			name: "reservation with other hints",
+			hints: &clients.SchedulerHints{
+				DifferentHost: []string{"8c19174f-4220-44f0-824a-cd1eeef10287"},
+				Custom:        map[string]string{"query": "[\">=\",\"$free_ram_mb\",1024]"},
+			},
+			reservationID: "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+			expected: map[string]interface{}{
+				"different_host": []string{"8c19174f-4220-44f0-824a-cd1eeef10287"},
+				"query":          "[\">=\",\"$free_ram_mb\",1024]",
+				"reservation":    "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+			},
+		},
+		{
+			name: "invalid server UUID",
+			hints: &clients.SchedulerHints{
+				SameHost: []string{"not-a-uuid"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newInstanceScope(nil, &clients.ProviderSpecExtensions{SchedulerHints: tt.hints, ReservationID: tt.reservationID})
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, found one: %v", err)
+			}
+			if len(tt.expected) == 0 && len(s.schedulerHints) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(s.schedulerHints, tt.expected) {
+				t.Errorf("Expected scheduler hints %v, got %v", tt.expected, s.schedulerHints)
+			}
+		})
+	}
+}
+
+func TestSchedulerHintsCreateOptsPreservesGroup(t *testing.T) {
+	var createOpts servers.CreateOptsBuilder = servers.CreateOpts{
+		Name:      "test",
+		FlavorRef: "flavor",
+	}
+	createOpts = schedulerhints.CreateOptsExt{
+		CreateOptsBuilder: createOpts,
+		SchedulerHints: schedulerhints.SchedulerHints{
+			Group: "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62",
+		},
+	}
+	createOpts = schedulerHintsCreateOpts{
+		CreateOptsBuilder: createOpts,
+		schedulerHints: map[string]interface{}{
+			"group":       "8c19174f-4220-44f0-824a-cd1eeef10287",
+			"reservation": "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+		},
+	}
+
+	body, err := createOpts.ToServerCreateMap()
+	if err != nil {
+		t.Fatalf("Expected no error, found one: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"group":       "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62",
+		"reservation": "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a",
+	}
+	if actual := body["os:scheduler_hints"]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected scheduler hints %v, got %v", expected, actual)
+	}
+}
+
+func TestBindingProfileCreateOpts(t *testing.T) {
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"}},
+		Ports: []machinev1alpha1.PortOpts{
+			{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", NameSuffix: "dpu", VNICType: "remote-managed"},
+		},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		Ports: []clients.PortOptsExtensions{{
+			BindingProfile: map[string]interface{}{
+				"card_serial_number": "MT2113X00000",
+				"pf_mac_address":     "00:53:00:00:00:42",
+				"vf_num":             float64(3),
+			},
+		}},
+	}
+
+	s := &instanceScope{}
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+	s.setPortBindingProfiles("worker-0", portOpts, portBindingProfiles(machineSpec, extensions))
+	if len(s.bindingProfiles) != 1 {
+		t.Fatalf("Expected the binding profile of 1 port, got %v", s.bindingProfiles)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		expected interface{}
+	}{
+		{
+			name:     "worker-0-0",
+			expected: map[string]interface{}{"capabilities": []string{"switchdev"}},
+		},
+		{
+			name: "worker-0-dpu",
+			expected: map[string]interface{}{
+				"capabilities":       []string{"switchdev"},
+				"card_serial_number": "MT2113X00000",
+				"pf_mac_address":     "00:53:00:00:00:42",
+				"vf_num":             float64(3),
+			},
+		},
+	} {
+		createOpts := bindingProfileCreateOpts{
+			CreateOptsBuilder: portsbinding.CreateOptsExt{
+				CreateOptsBuilder: ports.CreateOpts{Name: tt.name, NetworkID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"},
+				Profile:           map[string]interface{}{"capabilities": []string{"switchdev"}},
+			},
+			bindingProfiles: s.bindingProfiles,
+		}
+
+		body, err := createOpts.ToPortCreateMap()
+		if err != nil {
+			t.Fatalf("Expected no error, found one: %v", err)
+		}
+		port := body["port"].(map[string]interface{})
+		if actual := port["binding:profile"]; !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("Expected binding profile %v of port %s, got %v", tt.expected, tt.name, actual)
+		}
+	}
+}
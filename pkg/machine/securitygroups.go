@@ -0,0 +1,106 @@
+package machine
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/networking"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// portsWithoutSecurityGroups returns whether each port of the machine is
+// created without security groups, in the order of createCAPOPorts, or nil if
+// all of them get security groups. All the ports created for the subnets of a
+// network are created like the network requests.
+func portsWithoutSecurityGroups(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) []bool {
+	var noSecurityGroups []bool
+	found := false
+	for i := range machineSpec.Networks {
+		noSG := i < len(extensions.Networks) && extensions.Networks[i].NoSecurityGroups
+		found = found || noSG
+		networkPorts := networkParamToCapov1PortOpts(&machineSpec.Networks[i], nil, nil, &machineSpec.Trunk, true)
+		for range networkPorts {
+			noSecurityGroups = append(noSecurityGroups, noSG)
+		}
+	}
+	for i := range machineSpec.Ports {
+		noSG := i < len(extensions.Ports) && extensions.Ports[i].NoSecurityGroups
+		found = found || noSG
+		noSecurityGroups = append(noSecurityGroups, noSG)
+	}
+
+	if !found {
+		return nil
+	}
+	return noSecurityGroups
+}
+
+// validateNoSecurityGroups returns an error if noSecurityGroups is set for an
+// entry of networks or ports whose port security is disabled, where it would
+// have no effect, or for a port which also has security groups.
+func validateNoSecurityGroups(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	for i := range extensions.Networks {
+		if !extensions.Networks[i].NoSecurityGroups || i >= len(machineSpec.Networks) {
+			continue
+		}
+		if portSecurity := machineSpec.Networks[i].PortSecurity; portSecurity != nil && !*portSecurity {
+			return fmt.Errorf("network %d: noSecurityGroups can't be set when portSecurity is false", i)
+		}
+	}
+	for i := range extensions.Ports {
+		if !extensions.Ports[i].NoSecurityGroups || i >= len(machineSpec.Ports) {
+			continue
+		}
+		port := &machineSpec.Ports[i]
+		if port.PortSecurity != nil && !*port.PortSecurity {
+			return fmt.Errorf("port %d: noSecurityGroups can't be set when portSecurity is false", i)
+		}
+		if port.SecurityGroups != nil && len(*port.SecurityGroups) > 0 {
+			return fmt.Errorf("port %d: noSecurityGroups can't be set together with securityGroups", i)
+		}
+	}
+	return nil
+}
+
+// setPortsWithoutSecurityGroups records the names of the ports of the
+// instance which are created without security groups, given in the order of
+// createCAPOPorts.
+func (s *instanceScope) setPortsWithoutSecurityGroups(instanceName string, portOpts []capov1.PortOpts, noSecurityGroups []bool) {
+	for i := range portOpts {
+		if i >= len(noSecurityGroups) || !noSecurityGroups[i] {
+			continue
+		}
+		if s.noSecurityGroupPorts == nil {
+			s.noSecurityGroupPorts = sets.New[string]()
+		}
+		s.noSecurityGroupPorts.Insert(networking.GetPortName(instanceName, &portOpts[i], i))
+	}
+}
+
+// noSecurityGroupsCreateOpts sends an empty list of security groups in the
+// create request of the ports with these names. CAPO leaves the security
+// groups out of the request when it has none for a port, and Neutron then
+// gives the port the default security group of the project.
+type noSecurityGroupsCreateOpts struct {
+	ports.CreateOptsBuilder
+	portNames sets.Set[string]
+}
+
+func (opts noSecurityGroupsCreateOpts) ToPortCreateMap() (map[string]interface{}, error) {
+	base, err := opts.CreateOptsBuilder.ToPortCreateMap()
+	if err != nil {
+		return nil, err
+	}
+
+	port, _ := base["port"].(map[string]interface{})
+	name, _ := port["name"].(string)
+	if opts.portNames.Has(name) {
+		port["security_groups"] = []string{}
+	}
+
+	return base, nil
+}
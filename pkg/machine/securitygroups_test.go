@@ -0,0 +1,135 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	"k8s.io/utils/ptr"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestValidateNoSecurityGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineSpec *machinev1alpha1.OpenstackProviderSpec
+		extensions  *clients.ProviderSpecExtensions
+		expectErr   bool
+	}{
+		{
+			name: "network and port without security groups",
+			machineSpec: &machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"}},
+				Ports:    []machinev1alpha1.PortOpts{{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", PortSecurity: ptr.To(true)}},
+			},
+			extensions: &clients.ProviderSpecExtensions{
+				Networks: []clients.NetworkParamExtensions{{NoSecurityGroups: true}},
+				Ports:    []clients.PortOptsExtensions{{NoSecurityGroups: true}},
+			},
+		},
+		{
+			name: "network with port security disabled",
+			machineSpec: &machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b", PortSecurity: ptr.To(false)}},
+			},
+			extensions: &clients.ProviderSpecExtensions{
+				Networks: []clients.NetworkParamExtensions{{NoSecurityGroups: true}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "port with port security disabled",
+			machineSpec: &machinev1alpha1.OpenstackProviderSpec{
+				Ports: []machinev1alpha1.PortOpts{{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", PortSecurity: ptr.To(false)}},
+			},
+			extensions: &clients.ProviderSpecExtensions{
+				Ports: []clients.PortOptsExtensions{{NoSecurityGroups: true}},
+			},
+			expectErr: true,
+		},
+		{
+			name: "port with security groups",
+			machineSpec: &machinev1alpha1.OpenstackProviderSpec{
+				Ports: []machinev1alpha1.PortOpts{{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", SecurityGroups: &[]string{"default"}}},
+			},
+			extensions: &clients.ProviderSpecExtensions{
+				Ports: []clients.PortOptsExtensions{{NoSecurityGroups: true}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNoSecurityGroups(tt.machineSpec, tt.extensions)
+			if tt.expectErr && err == nil {
+				t.Errorf("Expected an error, got none")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Expected no error, found one: %v", err)
+			}
+		})
+	}
+}
+
+func TestNoSecurityGroupsCreateOpts(t *testing.T) {
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"}},
+		Ports: []machinev1alpha1.PortOpts{
+			{NetworkID: "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a", NameSuffix: "storage"},
+		},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		Ports: []clients.PortOptsExtensions{{NoSecurityGroups: true}},
+	}
+
+	s := &instanceScope{}
+	portOpts := createCAPOPorts(machineSpec, nil, nil, true)
+	s.setPortsWithoutSecurityGroups("worker-0", portOpts, portsWithoutSecurityGroups(machineSpec, extensions))
+	if s.noSecurityGroupPorts.Len() != 1 {
+		t.Fatalf("Expected 1 port without security groups, got %v", s.noSecurityGroupPorts)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		expected interface{}
+	}{
+		{
+			name:     "worker-0-0",
+			expected: []interface{}{"9d3b4c2e-5f6a-4b7c-8d9e-0f1a2b3c4d5e"},
+		},
+		{
+			name:     "worker-0-storage",
+			expected: []string{},
+		},
+	} {
+		createOpts := noSecurityGroupsCreateOpts{
+			CreateOptsBuilder: ports.CreateOpts{
+				Name:           tt.name,
+				NetworkID:      "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b",
+				SecurityGroups: &[]string{"9d3b4c2e-5f6a-4b7c-8d9e-0f1a2b3c4d5e"},
+			},
+			portNames: s.noSecurityGroupPorts,
+		}
+
+		body, err := createOpts.ToPortCreateMap()
+		if err != nil {
+			t.Fatalf("Expected no error, found one: %v", err)
+		}
+		port := body["port"].(map[string]interface{})
+		if actual := port["security_groups"]; !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("Expected security groups %#v of port %s, got %#v", tt.expected, tt.name, actual)
+		}
+	}
+}
+
+func TestPortsWithoutSecurityGroupsNone(t *testing.T) {
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{UUID: "c3127c12-fd96-4ab5-a4e0-dc4a69634f3b"}},
+	}
+	if noSG := portsWithoutSecurityGroups(machineSpec, &clients.ProviderSpecExtensions{}); noSG != nil {
+		t.Errorf("Expected nil, got %v", noSG)
+	}
+}
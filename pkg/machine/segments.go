@@ -0,0 +1,130 @@
+package machine
+
+import (
+	"fmt"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// segmentService is the part of clients.InstanceService which looks up the
+// segments of routed provider networks.
+type segmentService interface {
+	ListNetworkSegments(networkID string) ([]clients.NetworkSegment, error)
+	ListSubnetsWithSegment(networkID string) ([]clients.SubnetWithSegment, error)
+}
+
+// hasNetworkSegments returns true if any network has segments by
+// availability zone.
+func hasNetworkSegments(extensions *clients.ProviderSpecExtensions) bool {
+	for i := range extensions.Networks {
+		if len(extensions.Networks[i].SegmentsByAvailabilityZone) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNetworkSegments checks that the networks with segments by
+// availability zone are given by ID, and without subnets which could
+// contradict the segment.
+func validateNetworkSegments(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	for i := range extensions.Networks {
+		if len(extensions.Networks[i].SegmentsByAvailabilityZone) == 0 {
+			continue
+		}
+		if i >= len(machineSpec.Networks) {
+			return fmt.Errorf("network %d has segments but is not in networks", i)
+		}
+		network := &machineSpec.Networks[i]
+		if coalesce(network.UUID, network.Filter.ID) == "" {
+			return fmt.Errorf("network %d has segments, so it must be given by ID", i)
+		}
+		if len(network.Subnets) > 0 {
+			return fmt.Errorf("network %d has segments, so it can't have subnets", i)
+		}
+	}
+	return nil
+}
+
+// selectSegmentSubnets requests fixed IPs from the subnets of the segment of
+// each routed provider network which is routable in the availability zone of
+// the machine. Otherwise Neutron may allocate an address from a subnet which
+// is not routable where the server runs.
+func selectSegmentSubnets(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, availabilityZone string, ports []capov1.PortOpts, service segmentService) error {
+	portIndex := 0
+	for i := range machineSpec.Networks {
+		index := portIndex
+		portIndex += len(networkParamToCapov1PortOpts(&machineSpec.Networks[i], nil, nil, &machineSpec.Trunk, true))
+
+		if i >= len(extensions.Networks) || len(extensions.Networks[i].SegmentsByAvailabilityZone) == 0 {
+			continue
+		}
+		if index >= len(ports) {
+			return fmt.Errorf("network %d has no port", i)
+		}
+
+		segment, ok := extensions.Networks[i].SegmentsByAvailabilityZone[availabilityZone]
+		if !ok {
+			return maoMachine.InvalidMachineConfiguration("network %d has no segment for availability zone %q", i, availabilityZone)
+		}
+
+		networkID := coalesce(machineSpec.Networks[i].UUID, machineSpec.Networks[i].Filter.ID)
+		subnetIDs, err := segmentSubnetIDs(networkID, segment, service)
+		if err != nil {
+			return err
+		}
+
+		fixedIPs := make([]capov1.FixedIP, len(subnetIDs))
+		for j, subnetID := range subnetIDs {
+			fixedIPs[j] = capov1.FixedIP{Subnet: &capov1.SubnetFilter{ID: subnetID}}
+		}
+		ports[index].FixedIPs = fixedIPs
+	}
+	return nil
+}
+
+// segmentSubnetIDs returns the IDs of the subnets of the segment of the
+// network with the given name or ID.
+func segmentSubnetIDs(networkID, nameOrID string, service segmentService) ([]string, error) {
+	segments, err := service.ListNetworkSegments(networkID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing segments of network %s: %w", networkID, err)
+	}
+
+	var segmentID string
+	for _, segment := range segments {
+		if segment.ID == nameOrID {
+			segmentID = segment.ID
+			break
+		}
+		if segment.Name == nameOrID {
+			if segmentID != "" {
+				return nil, maoMachine.InvalidMachineConfiguration("network %s has more than one segment named %s", networkID, nameOrID)
+			}
+			segmentID = segment.ID
+		}
+	}
+	if segmentID == "" {
+		return nil, maoMachine.InvalidMachineConfiguration("network %s has no segment %s", networkID, nameOrID)
+	}
+
+	subnets, err := service.ListSubnetsWithSegment(networkID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing subnets of network %s: %w", networkID, err)
+	}
+
+	var subnetIDs []string
+	for _, subnet := range subnets {
+		if subnet.SegmentID == segmentID {
+			subnetIDs = append(subnetIDs, subnet.ID)
+		}
+	}
+	if len(subnetIDs) == 0 {
+		return nil, maoMachine.InvalidMachineConfiguration("segment %s of network %s has no subnets", nameOrID, networkID)
+	}
+	return subnetIDs, nil
+}
@@ -0,0 +1,125 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeSegmentService struct {
+	segments []clients.NetworkSegment
+	subnets  []clients.SubnetWithSegment
+}
+
+func (f *fakeSegmentService) ListNetworkSegments(string) ([]clients.NetworkSegment, error) {
+	return f.segments, nil
+}
+
+func (f *fakeSegmentService) ListSubnetsWithSegment(string) ([]clients.SubnetWithSegment, error) {
+	return f.subnets, nil
+}
+
+func TestSelectSegmentSubnets(t *testing.T) {
+	const (
+		machinesNetworkID = "0c2e4a6b-8d1f-4e3a-9b5c-7d9f1b3d5e7a"
+		routedNetworkID   = "6a8c0e2b-4d6f-4a1c-8e3b-5d7f9a1c3e5b"
+	)
+
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{
+			{UUID: machinesNetworkID},
+			{UUID: routedNetworkID},
+		},
+	}
+	service := &fakeSegmentService{
+		segments: []clients.NetworkSegment{
+			{ID: "segment-1-id", Name: "rack-1"},
+			{ID: "segment-2-id", Name: "rack-2"},
+		},
+		subnets: []clients.SubnetWithSegment{
+			{Subnet: subnets.Subnet{ID: "subnet-1-v4"}, SegmentID: "segment-1-id"},
+			{Subnet: subnets.Subnet{ID: "subnet-2-v4"}, SegmentID: "segment-2-id"},
+			{Subnet: subnets.Subnet{ID: "subnet-2-v6"}, SegmentID: "segment-2-id"},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		segments         map[string]string
+		availabilityZone string
+		expected         []capov1.FixedIP
+		wantErr          bool
+	}{
+		{
+			name:             "segment by name",
+			segments:         map[string]string{"az1": "rack-1", "az2": "rack-2"},
+			availabilityZone: "az2",
+			expected: []capov1.FixedIP{
+				{Subnet: &capov1.SubnetFilter{ID: "subnet-2-v4"}},
+				{Subnet: &capov1.SubnetFilter{ID: "subnet-2-v6"}},
+			},
+		},
+		{
+			name:             "segment by ID",
+			segments:         map[string]string{"az1": "segment-1-id"},
+			availabilityZone: "az1",
+			expected:         []capov1.FixedIP{{Subnet: &capov1.SubnetFilter{ID: "subnet-1-v4"}}},
+		},
+		{
+			name:             "no segment for the availability zone",
+			segments:         map[string]string{"az1": "rack-1"},
+			availabilityZone: "az3",
+			wantErr:          true,
+		},
+		{
+			name:             "unknown segment",
+			segments:         map[string]string{"az1": "rack-3"},
+			availabilityZone: "az1",
+			wantErr:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			extensions := &clients.ProviderSpecExtensions{
+				Networks: []clients.NetworkParamExtensions{{}, {SegmentsByAvailabilityZone: tt.segments}},
+			}
+			g.Expect(validateNetworkSegments(machineSpec, extensions)).To(Succeed())
+
+			ports := createCAPOPorts(machineSpec, nil, nil, true)
+			err := selectSegmentSubnets(machineSpec, extensions, tt.availabilityZone, ports, service)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ports[0].FixedIPs).To(BeEmpty())
+			g.Expect(ports[1].FixedIPs).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestValidateNetworkSegments(t *testing.T) {
+	g := NewWithT(t)
+
+	extensions := &clients.ProviderSpecExtensions{
+		Networks: []clients.NetworkParamExtensions{{SegmentsByAvailabilityZone: map[string]string{"az1": "rack-1"}}},
+	}
+
+	g.Expect(validateNetworkSegments(&machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{Filter: machinev1alpha1.Filter{Name: "routed"}}},
+	}, extensions)).NotTo(Succeed())
+	g.Expect(validateNetworkSegments(&machinev1alpha1.OpenstackProviderSpec{
+		Networks: []machinev1alpha1.NetworkParam{{
+			UUID:    "6a8c0e2b-4d6f-4a1c-8e3b-5d7f9a1c3e5b",
+			Subnets: []machinev1alpha1.SubnetParam{{UUID: "subnet-1-v4"}},
+		}},
+	}, extensions)).NotTo(Succeed())
+}
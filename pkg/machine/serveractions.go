@@ -0,0 +1,73 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/instanceactions"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// The number of server actions reported by recordServerActions
+const serverActionsLimit = 3
+
+// recordServerActions records the most recent actions performed on a server as
+// events on the machine. It is called when an operation on the server fails,
+// to surface the reasons reported by the cloud, e.g. scheduling failures.
+func (oc *OpenstackClient) recordServerActions(ctx context.Context, machine *machinev1.Machine, serverID string) {
+	instanceService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to get actions of instance %s: %v", machine.Name, serverID, err)
+		return
+	}
+
+	actions, err := instanceService.GetServerActions(serverID, serverActionsLimit)
+	if err != nil {
+		klog.Warningf("Machine %s: unable to get actions of instance %s: %v", machine.Name, serverID, err)
+		return
+	}
+
+	// Record the oldest action first so that events are in the same order
+	// as the actions.
+	for i := len(actions) - 1; i >= 0; i-- {
+		eventType, message := formatServerAction(&actions[i])
+		oc.eventRecorder.Event(machine, eventType, "ServerAction", message)
+	}
+}
+
+// formatServerAction returns the type and message of an event describing a
+// server action. The event is a warning if the action or any of its events
+// failed.
+func formatServerAction(action *instanceactions.InstanceActionDetail) (string, string) {
+	eventType := corev1.EventTypeNormal
+	if action.Message != "" {
+		eventType = corev1.EventTypeWarning
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "Instance action %s (request %s) started at %s", action.Action, action.RequestID, action.StartTime.UTC().Format("2006-01-02T15:04:05Z"))
+	if action.Message != "" {
+		fmt.Fprintf(&message, ": %s", action.Message)
+	}
+
+	if action.Events != nil {
+		for _, event := range *action.Events {
+			fmt.Fprintf(&message, "; %s: %s", event.Event, event.Result)
+			if event.Result == "Error" {
+				eventType = corev1.EventTypeWarning
+				// The last line of a traceback is the error
+				if traceback := strings.TrimSpace(event.Traceback); traceback != "" {
+					lines := strings.Split(traceback, "\n")
+					fmt.Fprintf(&message, " (%s)", strings.TrimSpace(lines[len(lines)-1]))
+				}
+			}
+		}
+	}
+
+	return eventType, message.String()
+}
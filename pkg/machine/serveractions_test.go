@@ -0,0 +1,77 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/instanceactions"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFormatServerAction(t *testing.T) {
+	startTime := time.Date(2024, time.May, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		action            instanceactions.InstanceActionDetail
+		expectedEventType string
+		expectedMessage   string
+	}{
+		{
+			name: "successful action",
+			action: instanceactions.InstanceActionDetail{
+				Action:    "create",
+				RequestID: "req-1",
+				StartTime: startTime,
+				Events: &[]instanceactions.Event{
+					{Event: "compute__do_build_and_run_instance", Result: "Success"},
+				},
+			},
+			expectedEventType: corev1.EventTypeNormal,
+			expectedMessage:   "Instance action create (request req-1) started at 2024-05-01T12:30:00Z; compute__do_build_and_run_instance: Success",
+		},
+		{
+			name: "failed action",
+			action: instanceactions.InstanceActionDetail{
+				Action:    "create",
+				RequestID: "req-2",
+				StartTime: startTime,
+				Message:   "No valid host was found. ",
+				Events: &[]instanceactions.Event{
+					{
+						Event:     "conductor_schedule_and_build_instances",
+						Result:    "Error",
+						Traceback: "Traceback (most recent call last):\n  File \"manager.py\", line 1\nnova.exception.NoValidHost: No valid host was found.\n",
+					},
+				},
+			},
+			expectedEventType: corev1.EventTypeWarning,
+			expectedMessage:   "Instance action create (request req-2) started at 2024-05-01T12:30:00Z: No valid host was found. ; conductor_schedule_and_build_instances: Error (nova.exception.NoValidHost: No valid host was found.)",
+		},
+		{
+			name: "failed event without traceback",
+			action: instanceactions.InstanceActionDetail{
+				Action:    "delete",
+				RequestID: "req-3",
+				StartTime: startTime,
+				Events: &[]instanceactions.Event{
+					{Event: "compute_terminate_instance", Result: "Error"},
+				},
+			},
+			expectedEventType: corev1.EventTypeWarning,
+			expectedMessage:   "Instance action delete (request req-3) started at 2024-05-01T12:30:00Z; compute_terminate_instance: Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventType, message := formatServerAction(&tt.action)
+			if eventType != tt.expectedEventType {
+				t.Errorf("Expected event type %q, got %q", tt.expectedEventType, eventType)
+			}
+			if message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, message)
+			}
+		})
+	}
+}
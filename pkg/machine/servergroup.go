@@ -0,0 +1,305 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// ServerGroupOwnerAnnotationKey is set on a Machine which owns a server group
+// created by MAPO. Its value is the ID of the server group. When the owner is
+// deleted ownership passes to another Machine using the server group, or the
+// server group is deleted if there is none.
+const ServerGroupOwnerAnnotationKey = "machine.openshift.io/openstack-server-group-owner"
+
+// MachineSetServerGroupAnnotationKey is set on a MachineSet which owns a
+// server group created by MAPO, and on its machines which use the server
+// group. Its value is the ID of the server group. The server group is deleted
+// with the last of these machines once the MachineSet is deleted.
+const MachineSetServerGroupAnnotationKey = "machine.openshift.io/openstack-server-group"
+
+// serverGroupReleaseRequeueAfter is how long the deletion of a machine waits
+// for the instances of other machines which are being deleted to leave its
+// server group.
+const serverGroupReleaseRequeueAfter = 30 * time.Second
+
+// serverGroupService is the part of clients.InstanceService which manages
+// server groups.
+type serverGroupService interface {
+	instanceService
+	GetServerGroupByID(id string) (*servergroups.ServerGroup, error)
+	DeleteServerGroup(id string) error
+}
+
+// serverGroupRecorder is an instanceService which records the server group
+// created by MachineToInstanceSpec, if any.
+type serverGroupRecorder struct {
+	instanceService
+	created *servergroups.ServerGroup
+}
+
+func (r *serverGroupRecorder) CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error) {
+	serverGroup, err := r.instanceService.CreateServerGroup(name, policy)
+	if err == nil {
+		r.created = serverGroup
+	}
+	return serverGroup, err
+}
+
+// machineSetServerGroups is an instanceService which uses the server group of
+// the MachineSet of a machine, and makes the MachineSet the owner of the
+// server group if it has to be created. The machine is annotated with the
+// server group it uses.
+type machineSetServerGroups struct {
+	oc             *OpenstackClient
+	ctx            context.Context
+	machine        *machinev1.Machine
+	machineSet     *machinev1.MachineSet
+	machineService serverGroupService
+}
+
+func (r *machineSetServerGroups) GetServerGroupsByName(name string) ([]servergroups.ServerGroup, error) {
+	if serverGroupID := r.machineSet.Annotations[MachineSetServerGroupAnnotationKey]; serverGroupID != "" {
+		serverGroup, err := r.machineService.GetServerGroupByID(serverGroupID)
+		if err == nil {
+			if err := r.useServerGroup(serverGroup.ID); err != nil {
+				return nil, err
+			}
+			return []servergroups.ServerGroup{*serverGroup}, nil
+		}
+		// If the server group of the MachineSet was deleted, another one is
+		// used or created instead
+		if !capoerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("error getting server group %s of MachineSet %s: %w", serverGroupID, r.machineSet.Name, err)
+		}
+	}
+
+	return r.machineService.GetServerGroupsByName(name)
+}
+
+func (r *machineSetServerGroups) CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error) {
+	serverGroup, err := r.machineService.CreateServerGroup(name, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// The optimistic lock fails if another machine of the MachineSet
+	// recorded a server group in the meantime. That server group is used
+	// when the machine is reconciled again.
+	patch := client.MergeFromWithOptions(r.machineSet.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if r.machineSet.Annotations == nil {
+		r.machineSet.Annotations = make(map[string]string)
+	}
+	r.machineSet.Annotations[MachineSetServerGroupAnnotationKey] = serverGroup.ID
+	if err := r.oc.client.Patch(r.ctx, r.machineSet, patch); err != nil {
+		if deleteErr := r.machineService.DeleteServerGroup(serverGroup.ID); deleteErr != nil {
+			klog.Warningf("Machine %s: error deleting server group %s which was not recorded in MachineSet %s: %v", r.machine.Name, serverGroup.ID, r.machineSet.Name, deleteErr)
+		}
+		return nil, fmt.Errorf("error recording server group %s in MachineSet %s: %w", serverGroup.ID, r.machineSet.Name, err)
+	}
+	r.oc.eventRecorder.Eventf(r.machineSet, corev1.EventTypeNormal, "CreatedServerGroup", "Created server group %s with id %s", serverGroup.Name, serverGroup.ID)
+
+	if err := r.useServerGroup(serverGroup.ID); err != nil {
+		return nil, err
+	}
+	return serverGroup, nil
+}
+
+// useServerGroup records that the machine uses the server group of its
+// MachineSet with the given ID.
+func (r *machineSetServerGroups) useServerGroup(serverGroupID string) error {
+	if r.machine.Annotations[MachineSetServerGroupAnnotationKey] == serverGroupID {
+		return nil
+	}
+	patch := client.MergeFrom(r.machine.DeepCopy())
+	if r.machine.Annotations == nil {
+		r.machine.Annotations = make(map[string]string)
+	}
+	r.machine.Annotations[MachineSetServerGroupAnnotationKey] = serverGroupID
+	return r.oc.client.Patch(r.ctx, r.machine, patch)
+}
+
+// getMachineSet returns the MachineSet which controls machine, or nil if there
+// is none.
+func (oc *OpenstackClient) getMachineSet(ctx context.Context, machine *machinev1.Machine) (*machinev1.MachineSet, error) {
+	ref := metav1.GetControllerOf(machine)
+	if ref == nil || ref.Kind != "MachineSet" {
+		return nil, nil
+	}
+
+	machineSet := &machinev1.MachineSet{}
+	err := oc.client.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: ref.Name}, machineSet)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting MachineSet %s: %w", ref.Name, err)
+	}
+	// A MachineSet with the same name may have replaced the owner
+	if machineSet.UID != ref.UID {
+		return nil, nil
+	}
+	return machineSet, nil
+}
+
+// setServerGroupOwner records that machine owns the server group with the
+// given ID.
+func (oc *OpenstackClient) setServerGroupOwner(ctx context.Context, machine *machinev1.Machine, serverGroupID string) error {
+	patch := client.MergeFrom(machine.DeepCopy())
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[ServerGroupOwnerAnnotationKey] = serverGroupID
+	return oc.client.Patch(ctx, machine, patch)
+}
+
+// releaseServerGroup is called when machine has been deleted. If machine owns
+// a server group, ownership is passed to another machine using the same
+// server group. If there is none the server group is deleted.
+func (oc *OpenstackClient) releaseServerGroup(ctx context.Context, machine *machinev1.Machine, machineService serverGroupService) error {
+	serverGroupID := machine.Annotations[ServerGroupOwnerAnnotationKey]
+	if serverGroupID == "" {
+		return nil
+	}
+
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return err
+	}
+
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines, client.InNamespace(machine.Namespace)); err != nil {
+		return fmt.Errorf("error listing machines: %w", err)
+	}
+
+	successor, deleting := serverGroupSuccessor(machine, machines.Items, func(other *machinev1.Machine) bool {
+		return usesServerGroup(other, machineSpec.ServerGroupName, serverGroupID)
+	})
+	if successor != nil {
+		klog.Infof("Machine %s: passing ownership of server group %s to machine %s", machine.Name, serverGroupID, successor.Name)
+		return oc.setServerGroupOwner(ctx, successor, serverGroupID)
+	}
+
+	return oc.deleteUnusedServerGroup(machine, serverGroupID, deleting, machineService)
+}
+
+// releaseMachineSetServerGroup is called when machine has been deleted. If
+// machine used the server group of its MachineSet, the server group is
+// deleted once the MachineSet has been deleted and no other machine uses it.
+func (oc *OpenstackClient) releaseMachineSetServerGroup(ctx context.Context, machine *machinev1.Machine, machineService serverGroupService) error {
+	serverGroupID := machine.Annotations[MachineSetServerGroupAnnotationKey]
+	if serverGroupID == "" {
+		return nil
+	}
+
+	machineSet, err := oc.getMachineSet(ctx, machine)
+	if err != nil {
+		return err
+	}
+	if machineSet != nil && machineSet.DeletionTimestamp.IsZero() && machineSet.Annotations[MachineSetServerGroupAnnotationKey] == serverGroupID {
+		return nil
+	}
+
+	machines := &machinev1.MachineList{}
+	if err := oc.client.List(ctx, machines, client.InNamespace(machine.Namespace)); err != nil {
+		return fmt.Errorf("error listing machines: %w", err)
+	}
+	successor, deleting := serverGroupSuccessor(machine, machines.Items, func(other *machinev1.Machine) bool {
+		return other.Annotations[MachineSetServerGroupAnnotationKey] == serverGroupID
+	})
+	if successor != nil {
+		return nil
+	}
+
+	return oc.deleteUnusedServerGroup(machine, serverGroupID, deleting, machineService)
+}
+
+// serverGroupSuccessor returns a machine other than machine which uses a server
+// group and isn't being deleted, or nil if there is none. Machines which are
+// being deleted may already have been released, so they can't take over the
+// server group; the second value is true if any of them uses it.
+func serverGroupSuccessor(machine *machinev1.Machine, machines []machinev1.Machine, uses func(*machinev1.Machine) bool) (*machinev1.Machine, bool) {
+	deleting := false
+	for i := range machines {
+		other := &machines[i]
+		if other.UID == machine.UID || !uses(other) {
+			continue
+		}
+		if !other.DeletionTimestamp.IsZero() {
+			deleting = true
+			continue
+		}
+		return other, deleting
+	}
+	return nil, deleting
+}
+
+// deleteUnusedServerGroup deletes the server group with the given ID, which is
+// no longer used by any machine, unless it still has members. If machines
+// using it are being deleted, their instances may still be members, so the
+// deletion is retried until they are gone.
+func (oc *OpenstackClient) deleteUnusedServerGroup(machine *machinev1.Machine, serverGroupID string, deleting bool, machineService serverGroupService) error {
+	serverGroup, err := machineService.GetServerGroupByID(serverGroupID)
+	if capoerrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting server group %s: %w", serverGroupID, err)
+	}
+	if len(serverGroup.Members) > 0 && deleting {
+		klog.Infof("Machine %s: waiting for the members %v of server group %s to be deleted", machine.Name, serverGroup.Members, serverGroupID)
+		return &maoMachine.RequeueAfterError{RequeueAfter: serverGroupReleaseRequeueAfter}
+	}
+	// The server group may have been adopted by something other than MAPO
+	if len(serverGroup.Members) > 0 {
+		klog.Warningf("Machine %s: not deleting server group %s which still has members %v", machine.Name, serverGroupID, serverGroup.Members)
+		return nil
+	}
+
+	if err := machineService.DeleteServerGroup(serverGroupID); err != nil {
+		return fmt.Errorf("error deleting server group %s: %w", serverGroupID, err)
+	}
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "DeletedServerGroup", "Deleted server group %s which is no longer used by any machine", serverGroupID)
+	return nil
+}
+
+// usesServerGroup returns true if machine uses the server group with the
+// given name and ID, by name, by ID or by the group scheduler hint.
+func usesServerGroup(machine *machinev1.Machine, serverGroupName, serverGroupID string) bool {
+	if machine.Annotations[ServerGroupOwnerAnnotationKey] == serverGroupID {
+		return true
+	}
+	if extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec); err == nil && extractServerGroupHint(extensions) == serverGroupID {
+		return true
+	}
+
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return false
+	}
+	if machineSpec.ServerGroupID != "" {
+		return machineSpec.ServerGroupID == serverGroupID
+	}
+	return serverGroupName != "" && machineSpec.ServerGroupName == serverGroupName
+}
+
+func validateServerGroupScope(scope clients.ServerGroupScope) error {
+	switch scope {
+	case "", clients.ServerGroupScopeMachine, clients.ServerGroupScopeMachineSet:
+		return nil
+	default:
+		return fmt.Errorf("serverGroupScope %q is not one of %s, %s", scope, clients.ServerGroupScopeMachine, clients.ServerGroupScopeMachineSet)
+	}
+}
@@ -0,0 +1,326 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestUsesServerGroup(t *testing.T) {
+	const serverGroupID = "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		providerSpec string
+		expected     bool
+	}{
+		{
+			name:         "same server group name",
+			providerSpec: `{"serverGroupName": "workers"}`,
+			expected:     true,
+		},
+		{
+			name:         "different server group name",
+			providerSpec: `{"serverGroupName": "masters"}`,
+			expected:     false,
+		},
+		{
+			name:         "same server group ID",
+			providerSpec: `{"serverGroupID": "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"}`,
+			expected:     true,
+		},
+		{
+			name:         "server group ID overrides name",
+			providerSpec: `{"serverGroupID": "e7f1c8a9-3a4e-4c1b-9a0e-2d3c4b5a6f70", "serverGroupName": "workers"}`,
+			expected:     false,
+		},
+		{
+			name:         "group scheduler hint",
+			providerSpec: `{"schedulerHints": {"group": "4f6e5a0c-3bb6-4b4e-8b5c-0a6b5b6a1c62"}}`,
+			expected:     true,
+		},
+		{
+			name:         "group scheduler hint of another server group",
+			providerSpec: `{"schedulerHints": {"group": "e7f1c8a9-3a4e-4c1b-9a0e-2d3c4b5a6f70"}}`,
+			expected:     false,
+		},
+		{
+			name:         "no server group",
+			providerSpec: `{}`,
+			expected:     false,
+		},
+		{
+			name:         "owner of the server group",
+			annotations:  map[string]string{ServerGroupOwnerAnnotationKey: serverGroupID},
+			providerSpec: `{}`,
+			expected:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := machinev1beta1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: tt.annotations,
+				},
+				Spec: machinev1beta1.MachineSpec{
+					ProviderSpec: machinev1beta1.ProviderSpec{
+						Value: &runtime.RawExtension{
+							Raw: []byte(tt.providerSpec),
+						},
+					},
+				},
+			}
+			if actual := usesServerGroup(&machine, "workers", serverGroupID); actual != tt.expected {
+				t.Errorf("Expected usesServerGroup to return %t, got %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestServerGroupSuccessor(t *testing.T) {
+	deleted := metav1.Now()
+	machine := func(name string, deleting bool) machinev1beta1.Machine {
+		m := machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)}}
+		if deleting {
+			m.DeletionTimestamp = &deleted
+		}
+		return m
+	}
+	usesAll := func(*machinev1beta1.Machine) bool { return true }
+	owner := machine("worker-0", true)
+
+	tests := []struct {
+		name              string
+		machines          []machinev1beta1.Machine
+		expectedSuccessor string
+		expectedDeleting  bool
+	}{
+		{
+			name:     "no other machine",
+			machines: []machinev1beta1.Machine{owner},
+		},
+		{
+			name:              "other machine",
+			machines:          []machinev1beta1.Machine{owner, machine("worker-1", false)},
+			expectedSuccessor: "worker-1",
+		},
+		{
+			name:             "other machine being deleted",
+			machines:         []machinev1beta1.Machine{owner, machine("worker-1", true)},
+			expectedDeleting: true,
+		},
+		{
+			name:              "machines being deleted are skipped",
+			machines:          []machinev1beta1.Machine{owner, machine("worker-1", true), machine("worker-2", false)},
+			expectedSuccessor: "worker-2",
+			expectedDeleting:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			successor, deleting := serverGroupSuccessor(&owner, tt.machines, usesAll)
+			var successorName string
+			if successor != nil {
+				successorName = successor.Name
+			}
+			if successorName != tt.expectedSuccessor || deleting != tt.expectedDeleting {
+				t.Errorf("Expected successor %q and deleting %t, got %q and %t", tt.expectedSuccessor, tt.expectedDeleting, successorName, deleting)
+			}
+		})
+	}
+}
+
+func TestValidateServerGroupScope(t *testing.T) {
+	for _, scope := range []clients.ServerGroupScope{"", clients.ServerGroupScopeMachine, clients.ServerGroupScopeMachineSet} {
+		if err := validateServerGroupScope(scope); err != nil {
+			t.Errorf("unexpected error for %q: %v", scope, err)
+		}
+	}
+	if err := validateServerGroupScope("Cluster"); err == nil {
+		t.Errorf("expected an error for an invalid scope")
+	}
+}
+
+// fakeMachineSetClient holds a MachineSet and its machines, and stores the
+// patched objects as they are.
+type fakeMachineSetClient struct {
+	client.Client
+
+	machineSet *machinev1beta1.MachineSet
+	machines   []machinev1beta1.Machine
+}
+
+func (c *fakeMachineSetClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	machineSet, ok := obj.(*machinev1beta1.MachineSet)
+	if !ok || c.machineSet == nil || c.machineSet.Name != key.Name {
+		return apierrors.NewNotFound(machinev1beta1.Resource("machinesets"), key.Name)
+	}
+	c.machineSet.DeepCopyInto(machineSet)
+	return nil
+}
+
+func (c *fakeMachineSetClient) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	machines := list.(*machinev1beta1.MachineList)
+	for i := range c.machines {
+		machines.Items = append(machines.Items, *c.machines[i].DeepCopy())
+	}
+	return nil
+}
+
+func (c *fakeMachineSetClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	switch obj := obj.(type) {
+	case *machinev1beta1.MachineSet:
+		c.machineSet = obj.DeepCopy()
+	case *machinev1beta1.Machine:
+		for i := range c.machines {
+			if c.machines[i].Name == obj.Name {
+				c.machines[i] = *obj.DeepCopy()
+			}
+		}
+	}
+	return nil
+}
+
+type fakeServerGroupService struct {
+	serverGroups map[string]*servergroups.ServerGroup
+	deleted      []string
+}
+
+func (s *fakeServerGroupService) GetServerGroupsByName(name string) ([]servergroups.ServerGroup, error) {
+	var found []servergroups.ServerGroup
+	for _, serverGroup := range s.serverGroups {
+		if serverGroup.Name == name {
+			found = append(found, *serverGroup)
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeServerGroupService) CreateServerGroup(name, policy string) (*servergroups.ServerGroup, error) {
+	serverGroup := &servergroups.ServerGroup{ID: fmt.Sprintf("server-group-%d", len(s.serverGroups)), Name: name, Policies: []string{policy}}
+	s.serverGroups[serverGroup.ID] = serverGroup
+	return serverGroup, nil
+}
+
+func (s *fakeServerGroupService) GetServerGroupByID(id string) (*servergroups.ServerGroup, error) {
+	serverGroup, ok := s.serverGroups[id]
+	if !ok {
+		return nil, gophercloud.ErrDefault404{}
+	}
+	return serverGroup, nil
+}
+
+func (s *fakeServerGroupService) DeleteServerGroup(id string) error {
+	delete(s.serverGroups, id)
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func TestMachineSetServerGroupLifecycle(t *testing.T) {
+	ctx := context.Background()
+	machineSet := &machinev1beta1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "openshift-machine-api", UID: "machineset-uid"}}
+	newMachine := func(name string) machinev1beta1.Machine {
+		return machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       "openshift-machine-api",
+			UID:             types.UID(name),
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(machineSet, machinev1beta1.GroupVersion.WithKind("MachineSet"))},
+		}}
+	}
+	fakeClient := &fakeMachineSetClient{
+		machineSet: machineSet.DeepCopy(),
+		machines:   []machinev1beta1.Machine{newMachine("worker-0"), newMachine("worker-1")},
+	}
+	recorder := record.NewFakeRecorder(10)
+	oc := &OpenstackClient{client: fakeClient, eventRecorder: recorder}
+	service := &fakeServerGroupService{serverGroups: map[string]*servergroups.ServerGroup{}}
+
+	// The machines of the MachineSet look up and create their server group
+	// through machineSetServerGroups
+	serverGroupOf := func(i int) string {
+		t.Helper()
+		machine := fakeClient.machines[i].DeepCopy()
+		currentMachineSet, err := oc.getMachineSet(ctx, machine)
+		if err != nil || currentMachineSet == nil {
+			t.Fatalf("Expected the MachineSet of %s, got %v and %v", machine.Name, currentMachineSet, err)
+		}
+		serverGroups := &machineSetServerGroups{oc: oc, ctx: ctx, machine: machine, machineSet: currentMachineSet, machineService: service}
+		found, err := serverGroups.GetServerGroupsByName("workers")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(found) > 0 {
+			return found[0].ID
+		}
+		created, err := serverGroups.CreateServerGroup("workers", "soft-anti-affinity")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return created.ID
+	}
+	release := func(i int) error {
+		t.Helper()
+		return oc.releaseMachineSetServerGroup(ctx, fakeClient.machines[i].DeepCopy(), service)
+	}
+
+	// The first machine creates the server group of the MachineSet
+	serverGroupID := serverGroupOf(0)
+	expectEvent(t, recorder, "CreatedServerGroup")
+	if recorded := fakeClient.machineSet.Annotations[MachineSetServerGroupAnnotationKey]; recorded != serverGroupID {
+		t.Fatalf("Expected server group %s to be recorded in the MachineSet, got %q", serverGroupID, recorded)
+	}
+
+	// The second machine reuses it
+	if reused := serverGroupOf(1); reused != serverGroupID || len(service.serverGroups) != 1 {
+		t.Fatalf("Expected server group %s to be reused, got %s and %d server groups", serverGroupID, reused, len(service.serverGroups))
+	}
+	expectNoEvent(t, recorder)
+	for _, machine := range fakeClient.machines {
+		if used := machine.Annotations[MachineSetServerGroupAnnotationKey]; used != serverGroupID {
+			t.Errorf("Expected machine %s to use server group %s, got %q", machine.Name, serverGroupID, used)
+		}
+	}
+
+	// The server group is kept while the MachineSet exists
+	if err := release(0); err != nil || len(service.deleted) != 0 {
+		t.Fatalf("Expected the server group to be kept, got %v and deleted %v", err, service.deleted)
+	}
+
+	// Once the MachineSet is deleted, it is kept while a machine uses it, and
+	// its members may still be deleted
+	fakeClient.machineSet = nil
+	deleted := metav1.Now()
+	fakeClient.machines[1].DeletionTimestamp = &deleted
+	service.serverGroups[serverGroupID].Members = []string{"worker-1-server"}
+	var requeue *maoMachine.RequeueAfterError
+	if err := release(0); !errors.As(err, &requeue) || len(service.deleted) != 0 {
+		t.Fatalf("Expected a requeue while the members are deleted, got %v and deleted %v", err, service.deleted)
+	}
+
+	// It is deleted with the last machine
+	fakeClient.machines = fakeClient.machines[1:]
+	service.serverGroups[serverGroupID].Members = nil
+	if err := release(0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(service.deleted) != 1 || service.deleted[0] != serverGroupID {
+		t.Errorf("Expected server group %s to be deleted, got %v", serverGroupID, service.deleted)
+	}
+	expectEvent(t, recorder, "DeletedServerGroup")
+}
@@ -0,0 +1,129 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	capov1 "sigs.k8s.io/cluster-api-provider-openstack/api/v1alpha7"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// maxServerDescriptionLength is the longest description Nova accepts.
+const maxServerDescriptionLength = 255
+
+// serverIdentityService is the part of clients.InstanceService which sets the
+// description and hostname of servers.
+type serverIdentityService interface {
+	Supports(feature clients.Feature) (bool, error)
+	GetServerIdentity(serverID, microversion string) (clients.ServerIdentity, error)
+	UpdateServerIdentity(serverID, microversion string, identity clients.ServerIdentity) error
+}
+
+// hasServerIdentity returns true if the server of a machine with the given
+// providerSpec extensions gets a description or hostname after its creation.
+func hasServerIdentity(extensions *clients.ProviderSpecExtensions) bool {
+	return extensions.ServerDescription != "" || extensions.Hostname != ""
+}
+
+// machineServerDescription returns the description of the server of the
+// machine, rendered with the availability zone the machine was created in.
+func machineServerDescription(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) (string, error) {
+	description, err := renderTemplate("serverDescription", extensions.ServerDescription, newMetadataVariables(machine, machineAvailabilityZone(machine, machineSpec)))
+	if err != nil {
+		return "", err
+	}
+	if len(description) > maxServerDescriptionLength {
+		return "", fmt.Errorf("serverDescription is longer than %d characters", maxServerDescriptionLength)
+	}
+	return description, nil
+}
+
+// desiredServerIdentity returns the identity of the server of the machine,
+// and the compute microversion needed to set it. The hostname is left out if
+// the cloud doesn't support setting it, since the user data already sets the
+// hostname of the instance.
+func desiredServerIdentity(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, identityService serverIdentityService) (clients.ServerIdentity, string, error) {
+	var identity clients.ServerIdentity
+	var microversion string
+
+	if extensions.ServerDescription != "" {
+		description, err := machineServerDescription(machine, machineSpec, extensions)
+		if err != nil {
+			return identity, "", err
+		}
+		identity.Description, microversion = description, clients.FeatureServerDescription.ComputeMicroversion
+	}
+
+	if extensions.Hostname != "" {
+		hostname, err := machineHostname(machine, machineSpec, extensions)
+		if err != nil {
+			return identity, "", err
+		}
+		feature := clients.FeatureServerHostname
+		if strings.Contains(hostname, ".") {
+			feature = clients.FeatureServerFQDNHostname
+		}
+		supported, err := identityService.Supports(feature)
+		if err != nil {
+			return identity, "", err
+		}
+		if supported {
+			identity.Hostname, microversion = hostname, feature.ComputeMicroversion
+		}
+	}
+
+	return identity, microversion, nil
+}
+
+// reconcileServerIdentity sets the description and hostname of the instance
+// when they differ from those of the machine. Like volumes, they are only set
+// on active or stopped instances.
+func reconcileServerIdentity(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, instanceStatus *compute.InstanceStatus, identityService serverIdentityService) error {
+	if !hasServerIdentity(extensions) {
+		return nil
+	}
+	if state := instanceStatus.State(); state != capov1.InstanceStateActive && state != capov1.InstanceStateShutoff {
+		return nil
+	}
+
+	desired, microversion, err := desiredServerIdentity(machine, machineSpec, extensions, identityService)
+	if err != nil || microversion == "" {
+		return err
+	}
+
+	current, err := identityService.GetServerIdentity(instanceStatus.ID(), microversion)
+	if err != nil {
+		return fmt.Errorf("error getting the description and hostname of instance %s: %w", instanceStatus.ID(), err)
+	}
+
+	// Only what differs is updated
+	update := clients.ServerIdentity{}
+	if desired.Description != "" && desired.Description != current.Description {
+		update.Description = desired.Description
+	}
+	if desired.Hostname != "" && desired.Hostname != current.Hostname {
+		update.Hostname = desired.Hostname
+	}
+	if update == (clients.ServerIdentity{}) {
+		return nil
+	}
+
+	if err := identityService.UpdateServerIdentity(instanceStatus.ID(), microversion, update); err != nil {
+		return fmt.Errorf("error updating the description and hostname of instance %s: %w", instanceStatus.ID(), err)
+	}
+	return nil
+}
+
+// validateServerDescription checks that the serverDescription template
+// renders a description which Nova accepts.
+func validateServerDescription(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	if extensions.ServerDescription == "" {
+		return nil
+	}
+	_, err := machineServerDescription(machine, machineSpec, extensions)
+	return err
+}
@@ -0,0 +1,140 @@
+package machine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+type fakeServerIdentityService struct {
+	capabilities clients.Capabilities
+	identity     clients.ServerIdentity
+	microversion string
+	updates      []clients.ServerIdentity
+}
+
+func (f *fakeServerIdentityService) Supports(feature clients.Feature) (bool, error) {
+	return f.capabilities.Unsupported(feature) == "", nil
+}
+
+func (f *fakeServerIdentityService) GetServerIdentity(_, microversion string) (clients.ServerIdentity, error) {
+	f.microversion = microversion
+	return f.identity, nil
+}
+
+func (f *fakeServerIdentityService) UpdateServerIdentity(_, microversion string, identity clients.ServerIdentity) error {
+	f.microversion = microversion
+	f.updates = append(f.updates, identity)
+	if identity.Description != "" {
+		f.identity.Description = identity.Description
+	}
+	if identity.Hostname != "" {
+		f.identity.Hostname = identity.Hostname
+	}
+	return nil
+}
+
+func TestReconcileServerIdentity(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{}
+	instance := func(state string) *compute.InstanceStatus {
+		return compute.NewInstanceStatusFromServer(&capoclients.ServerExt{Server: servers.Server{ID: "server-id", Status: state}}, logr.Discard())
+	}
+
+	tests := []struct {
+		name                 string
+		extensions           clients.ProviderSpecExtensions
+		maxMicroversion      string
+		state                string
+		expectedUpdates      []clients.ServerIdentity
+		expectedMicroversion string
+	}{
+		{
+			name:       "building instance",
+			extensions: clients.ProviderSpecExtensions{ServerDescription: "{{ .MachineName }}"},
+			state:      "BUILD",
+		},
+		{
+			name:                 "description",
+			extensions:           clients.ProviderSpecExtensions{ServerDescription: "Machine {{ .MachineName }}"},
+			maxMicroversion:      "2.60",
+			expectedUpdates:      []clients.ServerIdentity{{Description: "Machine worker-0"}},
+			expectedMicroversion: "2.19",
+		},
+		{
+			name:            "hostname without support",
+			extensions:      clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}"},
+			maxMicroversion: "2.89",
+		},
+		{
+			// The hostname of the server is already its name
+			name:                 "hostname",
+			extensions:           clients.ProviderSpecExtensions{Hostname: "{{ .MachineName }}"},
+			maxMicroversion:      "2.90",
+			expectedMicroversion: "2.90",
+		},
+		{
+			name:            "fully qualified hostname without support",
+			extensions:      clients.ProviderSpecExtensions{Hostname: "worker-0.example.com", ServerDescription: "worker"},
+			maxMicroversion: "2.93",
+			expectedUpdates: []clients.ServerIdentity{{Description: "worker"}},
+			// The description is still set
+			expectedMicroversion: "2.19",
+		},
+		{
+			name:                 "fully qualified hostname",
+			extensions:           clients.ProviderSpecExtensions{Hostname: "worker-0.example.com", ServerDescription: "worker"},
+			maxMicroversion:      "2.94",
+			expectedUpdates:      []clients.ServerIdentity{{Description: "worker", Hostname: "worker-0.example.com"}},
+			expectedMicroversion: "2.94",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			service := &fakeServerIdentityService{
+				capabilities: clients.Capabilities{ComputeMicroversion: tt.maxMicroversion},
+				identity:     clients.ServerIdentity{Hostname: "worker-0"},
+			}
+			state := tt.state
+			if state == "" {
+				state = "ACTIVE"
+			}
+
+			g.Expect(reconcileServerIdentity(machine, machineSpec, &tt.extensions, instance(state), service)).To(Succeed())
+			g.Expect(service.updates).To(Equal(tt.expectedUpdates))
+			g.Expect(service.microversion).To(Equal(tt.expectedMicroversion))
+
+			// Nothing is updated once the server has the identity
+			g.Expect(reconcileServerIdentity(machine, machineSpec, &tt.extensions, instance(state), service)).To(Succeed())
+			g.Expect(service.updates).To(Equal(tt.expectedUpdates))
+		})
+	}
+}
+
+func TestValidateServerDescription(t *testing.T) {
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{}
+
+	for description, valid := range map[string]bool{
+		"":                           true,
+		"Machine {{ .MachineName }}": true,
+		"{{ .Unknown }}":             false,
+		strings.Repeat("a", 256):     false,
+	} {
+		err := validateServerDescription(machine, machineSpec, &clients.ProviderSpecExtensions{ServerDescription: description})
+		if (err == nil) != valid {
+			t.Errorf("%.20q: expected valid to be %t, got %v", description, valid, err)
+		}
+	}
+}
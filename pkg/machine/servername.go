@@ -0,0 +1,113 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+// The prefix of the tag identifying the machine a server was created for
+const machineUIDTagPrefix = "machine-uid:"
+
+// machineUIDTag returns the tag identifying the servers created for the
+// machine, or an empty string if the machine has no UID.
+func machineUIDTag(machine *machinev1.Machine) string {
+	if machine.UID == "" {
+		return ""
+	}
+	return machineUIDTagPrefix + string(machine.UID)
+}
+
+// serverMachineUID returns the UID of the machine the server was created for,
+// or an empty string if the server was created before servers were tagged
+// with it.
+func serverMachineUID(server *capoclients.ServerExt) string {
+	if server.Tags == nil {
+		return ""
+	}
+	for _, tag := range *server.Tags {
+		if uid, ok := strings.CutPrefix(tag, machineUIDTagPrefix); ok {
+			return uid
+		}
+	}
+	return ""
+}
+
+// belongsToOtherMachine returns true if the server was created for a machine
+// other than the given one, which happens when a machine is recreated with the
+// name of a machine whose server still exists.
+func belongsToOtherMachine(server *capoclients.ServerExt, machine *machinev1.Machine) bool {
+	uid := serverMachineUID(server)
+	return uid != "" && machine.UID != "" && uid != string(machine.UID)
+}
+
+// listServersByName returns the servers with the machine's name.
+func listServersByName(scope scope.Scope, machine *machinev1.Machine) ([]capoclients.ServerExt, error) {
+	computeClient, err := scope.NewComputeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// The name parameter to /servers is a regular expression
+	serverList, err := computeClient.ListServers(servers.ListOpts{Name: fmt.Sprintf("^%s$", machine.Name)})
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers named %s: %w", machine.Name, err)
+	}
+	return serverList, nil
+}
+
+// getInstanceStatusByName returns the status of the server with the machine's
+// name, if any. Foreign servers, e.g. those created for other machines, are
+// ignored, so that we never adopt or delete them.
+func getInstanceStatusByName(scope scope.Scope, machine *machinev1.Machine, coexistWithCAPO bool) (*compute.InstanceStatus, error) {
+	serverList, err := listServersByName(scope, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceStatus *compute.InstanceStatus
+	found := 0
+	for i := range serverList {
+		if isForeignServer(&serverList[i], machine, coexistWithCAPO) {
+			continue
+		}
+		if instanceStatus == nil {
+			instanceStatus = compute.NewInstanceStatusFromServer(&serverList[i], scope.Logger())
+		}
+		found++
+	}
+	if found > 1 {
+		capoRecorder.Warnf(machine, "DuplicateServerNames", "Found %d servers with name '%s'. This is likely to cause errors.", found, machine.Name)
+	}
+	return instanceStatus, nil
+}
+
+// checkServerNameCollision returns an error if an active server with the
+// machine's name is foreign, e.g. was created for another machine. Creating
+// the machine's server would result in two servers with the same name, and in
+// two nodes claiming the same hostname.
+func checkServerNameCollision(scope scope.Scope, machine *machinev1.Machine, coexistWithCAPO bool) error {
+	serverList, err := listServersByName(scope, machine)
+	if err != nil {
+		return err
+	}
+
+	for i := range serverList {
+		server := &serverList[i]
+		if server.Status != "ACTIVE" || !isForeignServer(server, machine, coexistWithCAPO) {
+			continue
+		}
+		if uid := serverMachineUID(server); uid != "" {
+			return maoMachine.InvalidMachineConfiguration("OpenStack server %s is already named %s: it belongs to the machine with UID %s, which is not this machine", server.ID, machine.Name, uid)
+		}
+		return maoMachine.InvalidMachineConfiguration("OpenStack server %s is already named %s: it is not owned by this machine, and may be managed by CAPO", server.ID, machine.Name)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/mock/gomock"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	machinev1beta1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	capoclients "sigs.k8s.io/cluster-api-provider-openstack/pkg/clients"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/scope"
+)
+
+func TestServerNameCollision(t *testing.T) {
+	machine := &machinev1beta1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", UID: types.UID("3f9e2a1b-7c4d-4e5f-8a6b-9c0d1e2f3a4b")}}
+
+	server := func(id, status string, tags ...string) capoclients.ServerExt {
+		return capoclients.ServerExt{Server: servers.Server{ID: id, Name: machine.Name, Status: status, Tags: &tags}}
+	}
+	ownServer := server("own-id", "BUILD", machineUIDTag(machine))
+	otherServer := server("other-id", "ACTIVE", "machine-uid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+	otherDeletingServer := server("other-deleting-id", "DELETED", "machine-uid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+	untaggedServer := server("untagged-id", "ACTIVE")
+
+	tests := []struct {
+		name       string
+		servers    []capoclients.ServerExt
+		instanceID string
+		collision  bool
+	}{
+		{
+			name: "no server",
+		},
+		{
+			name:       "own server",
+			servers:    []capoclients.ServerExt{ownServer},
+			instanceID: "own-id",
+		},
+		{
+			name:       "server created before servers were tagged with the machine UID",
+			servers:    []capoclients.ServerExt{untaggedServer},
+			instanceID: "untagged-id",
+		},
+		{
+			name:      "active server of another machine",
+			servers:   []capoclients.ServerExt{otherServer},
+			collision: true,
+		},
+		{
+			name:    "deleted server of another machine",
+			servers: []capoclients.ServerExt{otherDeletingServer},
+		},
+		{
+			name:       "own server and active server of another machine",
+			servers:    []capoclients.ServerExt{otherServer, ownServer},
+			instanceID: "own-id",
+			collision:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			mockScopeFactory := scope.NewMockScopeFactory(mockCtrl, "", logr.Discard())
+			mockScopeFactory.ComputeClient.EXPECT().ListServers(servers.ListOpts{Name: "^worker-0$"}).Return(tt.servers, nil).Times(2)
+
+			instanceStatus, err := getInstanceStatusByName(mockScopeFactory, machine, false)
+			if err != nil {
+				t.Fatalf("unexpected error getting instance status: %v", err)
+			}
+			switch {
+			case tt.instanceID == "" && instanceStatus != nil:
+				t.Errorf("expected no instance, got %s", instanceStatus.ID())
+			case tt.instanceID != "" && instanceStatus == nil:
+				t.Errorf("expected instance %s, got none", tt.instanceID)
+			case tt.instanceID != "" && instanceStatus.ID() != tt.instanceID:
+				t.Errorf("expected instance %s, got %s", tt.instanceID, instanceStatus.ID())
+			}
+
+			err = checkServerNameCollision(mockScopeFactory, machine, false)
+			if tt.collision && err == nil {
+				t.Errorf("expected a name collision")
+			}
+			if !tt.collision && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// permanentCreateErrors are the messages of the errors Nova returns for
+// requests to create a server which can never succeed, and why they can't.
+var permanentCreateErrors = []struct {
+	message string
+	reason  string
+}{
+	{message: "invalid flavorref provided", reason: "the flavor does not exist"},
+	{message: "invalid imageref provided", reason: "the image is invalid"},
+	{message: "can not find requested image", reason: "the image does not exist"},
+	{message: "invalid key_name provided", reason: "the key pair does not exist"},
+	{message: "flavor's disk is too small for requested image", reason: "the disk of the flavor is too small for the image"},
+	{message: "flavor's memory is too small for requested image", reason: "the memory of the flavor is too small for the image"},
+}
+
+// terminalCreateError returns why err, returned by OpenStack while creating
+// the instance of a machine, can't be fixed by retrying the creation, e.g.
+// because the flavor doesn't exist. Only the errors known to be permanent are
+// terminal. It returns "" if retrying may succeed, e.g. after a server fault,
+// an API which is down, or an exceeded quota or a policy which an operator
+// can change.
+func terminalCreateError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var notFoundErr *gophercloud.ErrResourceNotFound
+	if errors.As(err, &notFoundErr) && notFoundErr.ResourceType == "flavor" {
+		return fmt.Sprintf("flavor %s does not exist", notFoundErr.Name)
+	}
+
+	var errUnexpectedResponseCode gophercloud.ErrUnexpectedResponseCode
+	if !errors.As(err, &errUnexpectedResponseCode) || errUnexpectedResponseCode.Actual != http.StatusBadRequest {
+		return ""
+	}
+	body := strings.ToLower(string(errUnexpectedResponseCode.Body))
+	for _, permanent := range permanentCreateErrors {
+		if strings.Contains(body, permanent.message) {
+			return permanent.reason
+		}
+	}
+	return ""
+}
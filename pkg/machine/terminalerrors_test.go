@@ -0,0 +1,80 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestTerminalCreateError(t *testing.T) {
+	responseError := func(code int, body string) gophercloud.ErrUnexpectedResponseCode {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: code, Body: []byte(body)}
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name: "no error",
+		},
+		{
+			name: "Nova quota exceeded",
+			err:  gophercloud.ErrDefault403{ErrUnexpectedResponseCode: responseError(http.StatusForbidden, `{"forbidden": {"code": 403, "message": "Quota exceeded for cores: Requested 8, but already used 96 of 100 cores"}}`)},
+		},
+		{
+			name: "Neutron quota exceeded",
+			err:  fmt.Errorf("create port: %w", gophercloud.ErrDefault409{ErrUnexpectedResponseCode: responseError(http.StatusConflict, `{"NeutronError": {"type": "OverQuota", "message": "Quota exceeded for resources: ['port']."}}`)}),
+		},
+		{
+			name: "Cinder quota exceeded",
+			err:  responseError(http.StatusRequestEntityTooLarge, `{"overLimit": {"code": 413, "message": "VolumeSizeExceedsAvailableQuota: Requested volume or snapshot exceeds allowed gigabytes quota."}}`),
+		},
+		{
+			name: "forbidden",
+			err:  gophercloud.ErrDefault403{ErrUnexpectedResponseCode: responseError(http.StatusForbidden, `{"forbidden": {"code": 403, "message": "Policy doesn't allow os_compute_api:servers:create:forced_host to be performed."}}`)},
+		},
+		{
+			name:     "flavor disk too small",
+			err:      gophercloud.ErrDefault400{ErrUnexpectedResponseCode: responseError(http.StatusBadRequest, `{"badRequest": {"code": 400, "message": "Flavor's disk is too small for requested image. Flavor disk is 10737418240 bytes, image is 21474836480 bytes."}}`)},
+			expected: "the disk of the flavor is too small for the image",
+		},
+		{
+			name:     "image not found",
+			err:      gophercloud.ErrDefault400{ErrUnexpectedResponseCode: responseError(http.StatusBadRequest, `{"badRequest": {"code": 400, "message": "Can not find requested image"}}`)},
+			expected: "the image does not exist",
+		},
+		{
+			name: "other invalid request",
+			err:  gophercloud.ErrDefault400{ErrUnexpectedResponseCode: responseError(http.StatusBadRequest, `{"badRequest": {"code": 400, "message": "Port 4c1b0f3e is still in use."}}`)},
+		},
+		{
+			name:     "flavor not found",
+			err:      &gophercloud.ErrResourceNotFound{Name: "m1.huge", ResourceType: "flavor"},
+			expected: "flavor m1.huge does not exist",
+		},
+		{
+			name: "port conflict",
+			err:  gophercloud.ErrDefault409{ErrUnexpectedResponseCode: responseError(http.StatusConflict, `{"NeutronError": {"type": "IpAddressAlreadyAllocated"}}`)},
+		},
+		{
+			name: "server error",
+			err:  gophercloud.ErrDefault500{ErrUnexpectedResponseCode: responseError(http.StatusInternalServerError, "")},
+		},
+		{
+			name: "not an OpenStack error",
+			err:  errors.New("connection refused"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := terminalCreateError(tt.err); reason != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, reason)
+			}
+		})
+	}
+}
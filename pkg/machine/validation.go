@@ -0,0 +1,238 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// validationTimeout bounds how long the validation of a machine against the
+// cloud may take altogether.
+const validationTimeout = 5 * time.Minute
+
+// errValidationTimeout is returned when the validation of a machine doesn't
+// complete in time. It says nothing about the machine's configuration, so
+// the validation is retried.
+var errValidationTimeout = errors.New("timed out validating the machine against the cloud")
+
+// runValidationChecks runs the checks concurrently and returns the errors of
+// those which fail, joined in the order of the checks, or nil if they all
+// pass. The checks are given a context which is cancelled when one of them
+// fails, so that the others stop calling the cloud, and the errors they
+// return because they were cancelled are left out. If ctx is done or the
+// timeout expires first, it returns errValidationTimeout without waiting for
+// the remaining checks, whose context is cancelled too, since the errors of
+// the checks then say nothing about the machine.
+func runValidationChecks(ctx context.Context, timeout time.Duration, checks ...func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	checksCtx, cancelChecks := context.WithCancel(ctx)
+	defer cancelChecks()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(checks))
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func(context.Context) error) {
+			defer wg.Done()
+			if err := check(checksCtx); err != nil {
+				errs[i] = err
+				cancelChecks()
+			}
+		}(i, check)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	// The checks may all have returned because ctx is done
+	if ctx.Err() != nil {
+		return errValidationTimeout
+	}
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// ValidateProviderSpec checks the providerSpec of machine without calling the
+// cloud, so that invalid providerSpecs can be rejected before the machine is
+// created.
+func ValidateProviderSpec(machine *machinev1.Machine) error {
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("error getting the machine spec from the provider spec: %v", err)
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(machine.Spec.ProviderSpec)
+	if err != nil {
+		return fmt.Errorf("error getting the machine spec extensions from the provider spec: %v", err)
+	}
+	return validateProviderSpec(machine, machineSpec, extensions)
+}
+
+// validateProviderSpec returns the first problem of the providerSpec of
+// machine which can be found without calling the cloud.
+func validateProviderSpec(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	if machineSpec.Flavor == "" {
+		return errors.New("flavor is required")
+	}
+	if machineSpec.Image == "" && machineSpec.RootVolume == nil {
+		return errors.New("image is required unless the machine boots from a root volume")
+	}
+	if err := validatePorts(machineSpec.Ports); err != nil {
+		return err
+	}
+
+	availabilityZone := machineAvailabilityZone(machine, machineSpec)
+
+	if err := validateServerMetadata(machineSpec.ServerMetadata); err != nil {
+		return err
+	}
+	if _, err := renderServerMetadata(machine, machineSpec.ServerMetadata, availabilityZone); err != nil {
+		return err
+	}
+
+	if _, err := renderPortDNSName(machine, extensions.PortDNSName, availabilityZone); err != nil {
+		return err
+	}
+
+	if err := validateHostname(machine, machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if err := validateFloatingIPRequests(floatingIPRequests(machineSpec, extensions)); err != nil {
+		return err
+	}
+
+	if err := validateLoadBalancerPools(extensions.LoadBalancerPools); err != nil {
+		return err
+	}
+
+	if err := validateInactiveInstancePolicy(extensions.InactiveInstancePolicy); err != nil {
+		return err
+	}
+
+	if err := validateVNICTypes(machineSpec); err != nil {
+		return err
+	}
+
+	if err := validateNetworkSegments(machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if err := validateNoSecurityGroups(machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if err := validateFixedIP(extensions.FixedIP); err != nil {
+		return err
+	}
+
+	if err := validateAddressesFromPools(extensions.AddressesFromPools); err != nil {
+		return err
+	}
+
+	if err := validateFlavorExtraSpecLabels(extensions.FlavorExtraSpecLabels); err != nil {
+		return err
+	}
+
+	if err := validateBlockDeviceMetadata(machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if err := validateRetainedBlockDevices(machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if err := validateConfigDriveFiles(machineSpec, extensions.ConfigDriveFiles); err != nil {
+		return err
+	}
+
+	if err := validateSSHPublicKeySecret(machineSpec, extensions.SSHPublicKeySecret); err != nil {
+		return err
+	}
+
+	if err := clients.ValidateServerGroupPolicy(extensions.ServerGroupPolicy); err != nil {
+		return err
+	}
+
+	if err := validateServerGroupScope(extensions.ServerGroupScope); err != nil {
+		return err
+	}
+
+	// The group scheduler hint is an alternative way to set the server group ID
+	if groupHint := extractServerGroupHint(extensions); groupHint != "" && machineSpec.ServerGroupID != "" && machineSpec.ServerGroupID != groupHint {
+		return fmt.Errorf("Server group %s of the group scheduler hint does not match serverGroupID %s", groupHint, machineSpec.ServerGroupID)
+	}
+
+	if err := validateReservationID(extensions); err != nil {
+		return err
+	}
+
+	if err := validateServerDescription(machine, machineSpec, extensions); err != nil {
+		return err
+	}
+
+	if extensions.ComputeMicroversion != "" {
+		if err := clients.ValidateComputeMicroversion(extensions.ComputeMicroversion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateReservationID returns an error if the reservationID is not a UUID,
+// or if it conflicts with a custom reservation scheduler hint.
+func validateReservationID(extensions *clients.ProviderSpecExtensions) error {
+	if extensions.ReservationID == "" {
+		return nil
+	}
+	if err := uuid.Validate(extensions.ReservationID); err != nil {
+		return fmt.Errorf("reservationID %s is not a UUID", extensions.ReservationID)
+	}
+	if extensions.SchedulerHints != nil {
+		if hint, ok := extensions.SchedulerHints.Custom[reservationHint]; ok && hint != extensions.ReservationID {
+			return fmt.Errorf("reservation %s of the custom scheduler hints does not match reservationID %s", hint, extensions.ReservationID)
+		}
+	}
+	return nil
+}
+
+// validatePorts returns an error if a port has no network, or if the names of
+// two ports would be the same.
+func validatePorts(ports []machinev1alpha1.PortOpts) error {
+	nameSuffixes := map[string]int{}
+	for i, port := range ports {
+		if port.NetworkID == "" {
+			return fmt.Errorf("networkID of port %d is required", i)
+		}
+		if port.NameSuffix == "" {
+			continue
+		}
+		if j, ok := nameSuffixes[port.NameSuffix]; ok {
+			return fmt.Errorf("ports %d and %d have the same nameSuffix %q", j, i, port.NameSuffix)
+		}
+		nameSuffixes[port.NameSuffix] = i
+	}
+	return nil
+}
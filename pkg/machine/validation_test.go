@@ -0,0 +1,121 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestRunValidationChecks(t *testing.T) {
+	ctx := context.Background()
+	pass := func(context.Context) error { return nil }
+
+	if err := runValidationChecks(ctx, time.Minute, pass, pass); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// The first check which fails cancels the others, whose errors are
+	// ignored if they were cancelled
+	err := runValidationChecks(ctx, time.Minute,
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			return fmt.Errorf("error getting image: %w", ctx.Err())
+		},
+		pass,
+		func(context.Context) error { return errors.New("flavor not found") },
+	)
+	if expected := "flavor not found"; err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, err)
+	}
+
+	// The errors of all the checks which fail are joined in the order of
+	// the checks, whichever fails first
+	for range 10 {
+		err = runValidationChecks(ctx, time.Minute,
+			func(context.Context) error {
+				time.Sleep(time.Millisecond)
+				return errors.New("image not found")
+			},
+			func(context.Context) error { return errors.New("flavor not found") },
+		)
+		if expected := "image not found\nflavor not found"; err == nil || err.Error() != expected {
+			t.Errorf("Expected %q, got %v", expected, err)
+		}
+	}
+
+	// A check which doesn't return in time fails the validation with a
+	// retriable error, and is cancelled
+	cancelled := make(chan struct{})
+	err = runValidationChecks(ctx, 10*time.Millisecond,
+		pass,
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			<-cancelled
+			return ctx.Err()
+		},
+	)
+	if !errors.Is(err, errValidationTimeout) {
+		t.Errorf("Expected %v, got %v", errValidationTimeout, err)
+	}
+	close(cancelled)
+
+	// Checks which fail because the reconcile is cancelled don't fail the
+	// machine, even if they all return before the cancellation is seen
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = runValidationChecks(cancelledCtx, time.Minute,
+		func(ctx context.Context) error { return fmt.Errorf("error getting flavor: %w", ctx.Err()) },
+	)
+	if !errors.Is(err, errValidationTimeout) {
+		t.Errorf("Expected %v, got %v", errValidationTimeout, err)
+	}
+}
+
+func TestValidateReservationID(t *testing.T) {
+	reservationID := "7a5d1ff4-0b0e-4b8a-9d6d-3d2f6d1c5e2a"
+	tests := []struct {
+		name       string
+		extensions clients.ProviderSpecExtensions
+		expectErr  bool
+	}{
+		{
+			name: "no reservation",
+		},
+		{
+			name:       "reservation",
+			extensions: clients.ProviderSpecExtensions{ReservationID: reservationID},
+		},
+		{
+			name:       "not a UUID",
+			extensions: clients.ProviderSpecExtensions{ReservationID: "gpu-hosts"},
+			expectErr:  true,
+		},
+		{
+			name: "same custom hint",
+			extensions: clients.ProviderSpecExtensions{
+				ReservationID:  reservationID,
+				SchedulerHints: &clients.SchedulerHints{Custom: map[string]string{"reservation": reservationID}},
+			},
+		},
+		{
+			name: "conflicting custom hint",
+			extensions: clients.ProviderSpecExtensions{
+				ReservationID:  reservationID,
+				SchedulerHints: &clients.SchedulerHints{Custom: map[string]string{"reservation": "0c9a3e57-2f4d-4c1b-8e6a-5b7d9f1a3c24"}},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateReservationID(&tt.extensions)
+			if tt.expectErr != (err != nil) {
+				t.Errorf("Expected error %t, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
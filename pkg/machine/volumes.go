@@ -0,0 +1,282 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/cluster-api-provider-openstack/pkg/cloud/services/compute"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+	capoerrors "sigs.k8s.io/cluster-api-provider-openstack/pkg/utils/errors"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// VolumeTypeZonesConfigMapName is the name of the optional ConfigMap, in the
+// namespace of the machines, which maps each volume type to the
+// comma-separated list of Cinder availability zones its backend is available
+// in.
+const VolumeTypeZonesConfigMapName = "openstack-volume-type-zones"
+
+// maxVolumeMetadataLength is the maximum length of the keys and values of the
+// metadata of Cinder volumes.
+const maxVolumeMetadataLength = 255
+
+// volumeMetadataService is the part of clients.InstanceService which sets the
+// metadata of volumes.
+type volumeMetadataService interface {
+	GetVolumeByName(name string) (*volumes.Volume, error)
+	SetVolumeMetadata(volumeID string, metadata map[string]string) error
+}
+
+// volumeTypeService is the part of clients.InstanceService which looks up
+// volume types.
+type volumeTypeService interface {
+	DoesVolumeTypeExist(volumeType string) error
+}
+
+// validateVolumeTypes checks that the volume types of the root volume and of
+// the additional block devices with volume storage exist. Otherwise the
+// volumes, and so the instance, would only fail once they are scheduled.
+func validateVolumeTypes(machineSpec *machinev1alpha1.OpenstackProviderSpec, volumeService volumeTypeService) error {
+	var checked []string
+	check := func(volumeType, volume string) error {
+		if volumeType == "" || slices.Contains(checked, volumeType) {
+			return nil
+		}
+		checked = append(checked, volumeType)
+		if err := volumeService.DoesVolumeTypeExist(volumeType); err != nil {
+			return fmt.Errorf("invalid volume type of %s: %v", volume, err)
+		}
+		return nil
+	}
+
+	if machineSpec.RootVolume != nil {
+		if err := check(machineSpec.RootVolume.VolumeType, "the root volume"); err != nil {
+			return err
+		}
+	}
+	for _, blockDevice := range machineSpec.AdditionalBlockDevices {
+		if blockDevice.Storage.Type != machinev1alpha1.VolumeBlockDevice || blockDevice.Storage.Volume == nil {
+			continue
+		}
+		if err := check(blockDevice.Storage.Volume.Type, "additional block device "+blockDevice.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRootVolumeZone sets the availability zone of the root volume from the
+// zones of its volume type, if it doesn't have one.
+func (oc *OpenstackClient) setRootVolumeZone(machine *machinev1.Machine, instanceSpec *compute.InstanceSpec) error {
+	rootVolume := instanceSpec.RootVolume
+	if rootVolume == nil || rootVolume.VolumeType == "" || rootVolume.AvailabilityZone != "" {
+		return nil
+	}
+
+	configMap, err := oc.params.KubeClient.CoreV1().ConfigMaps(machine.Namespace).Get(context.TODO(), VolumeTypeZonesConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s: %w", VolumeTypeZonesConfigMapName, err)
+	}
+
+	zones, ok := configMap.Data[rootVolume.VolumeType]
+	if !ok {
+		return nil
+	}
+	rootVolume.AvailabilityZone = selectVolumeZone(zones, instanceSpec.FailureDomain)
+	klog.V(3).Infof("Machine %s: using availability zone %q of volume type %s for the root volume", machine.Name, rootVolume.AvailabilityZone, rootVolume.VolumeType)
+	return nil
+}
+
+// selectVolumeZone returns the zone in the comma-separated list of zones which
+// has the name of the compute availability zone of the instance, or otherwise
+// the first zone.
+func selectVolumeZone(zones, instanceZone string) string {
+	var candidates []string
+	for _, zone := range strings.Split(zones, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			candidates = append(candidates, zone)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	if slices.Contains(candidates, instanceZone) {
+		return instanceZone
+	}
+	return candidates[0]
+}
+
+// hasBlockDeviceMetadata returns true if any additional block device has
+// metadata.
+func hasBlockDeviceMetadata(extensions *clients.ProviderSpecExtensions) bool {
+	for i := range extensions.AdditionalBlockDevices {
+		if len(extensions.AdditionalBlockDevices[i].Metadata) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBlockDeviceMetadata checks that only additional block devices with
+// volume storage have metadata, and that Cinder accepts their metadata.
+func validateBlockDeviceMetadata(machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	for i := range extensions.AdditionalBlockDevices {
+		metadata := extensions.AdditionalBlockDevices[i].Metadata
+		if len(metadata) == 0 {
+			continue
+		}
+		if i >= len(machineSpec.AdditionalBlockDevices) {
+			return fmt.Errorf("additional block device %d has metadata but is not in additionalBlockDevices", i)
+		}
+		blockDevice := &machineSpec.AdditionalBlockDevices[i]
+		if blockDevice.Storage.Type != machinev1alpha1.VolumeBlockDevice {
+			return fmt.Errorf("additional block device %s has metadata, so its storage type must be %s", blockDevice.Name, machinev1alpha1.VolumeBlockDevice)
+		}
+		for key, value := range metadata {
+			if key == "" || len(key) > maxVolumeMetadataLength || len(value) > maxVolumeMetadataLength {
+				return fmt.Errorf("metadata %q of additional block device %s must have a key and value of at most %d characters", key, blockDevice.Name, maxVolumeMetadataLength)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileBlockDeviceMetadata adds the requested metadata to the volume of
+// each additional block device which doesn't have it. CAPO creates the volumes
+// without metadata, so they get it as soon as the instance exists. Metadata
+// added by others is kept.
+func reconcileBlockDeviceMetadata(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions, volumeService volumeMetadataService) error {
+	for i := range extensions.AdditionalBlockDevices {
+		requested := extensions.AdditionalBlockDevices[i].Metadata
+		if len(requested) == 0 || i >= len(machineSpec.AdditionalBlockDevices) {
+			continue
+		}
+
+		// CAPO names the volume of a block device after the instance and
+		// the block device
+		volumeName := fmt.Sprintf("%s-%s", machine.Name, machineSpec.AdditionalBlockDevices[i].Name)
+		volume, err := volumeService.GetVolumeByName(volumeName)
+		if err != nil {
+			return fmt.Errorf("get volume %s err: %v", volumeName, err)
+		}
+		if volume == nil {
+			continue
+		}
+
+		metadata := maps.Clone(volume.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]string, len(requested))
+		}
+		changed := false
+		for key, value := range requested {
+			if existing, ok := metadata[key]; !ok || existing != value {
+				metadata[key] = value
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := volumeService.SetVolumeMetadata(volume.ID, metadata); err != nil {
+			capoRecorder.Warnf(machine, "FailedSetVolumeMetadata", "Failed to set metadata of volume %s: %v", volumeName, err)
+			return fmt.Errorf("set metadata of volume %s err: %v", volumeName, err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulSetVolumeMetadata", "Set metadata of volume %s", volumeName)
+	}
+	return nil
+}
+
+// orphanedVolumeService is the part of clients.InstanceService which deletes
+// the volumes of instances which don't exist.
+type orphanedVolumeService interface {
+	GetVolumeByName(name string) (*volumes.Volume, error)
+	DeleteVolume(volumeID string) error
+}
+
+// instanceVolume is a volume which is created for the instance of a machine
+// before the instance.
+type instanceVolume struct {
+	name        string
+	description string
+}
+
+// instanceVolumes returns the root volume and the volumes of the additional
+// block devices which are created for the instance of the machine, named and
+// described as CAPO creates them.
+func instanceVolumes(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec) []instanceVolume {
+	var instanceVolumes []instanceVolume
+	if machineSpec.RootVolume != nil && machineSpec.RootVolume.Size > 0 {
+		instanceVolumes = append(instanceVolumes, instanceVolume{
+			name:        fmt.Sprintf("%s-root", machine.Name),
+			description: fmt.Sprintf("Root volume for %s", machine.Name),
+		})
+	}
+	for _, blockDevice := range machineSpec.AdditionalBlockDevices {
+		if blockDevice.Storage.Type != machinev1alpha1.VolumeBlockDevice {
+			continue
+		}
+		instanceVolumes = append(instanceVolumes, instanceVolume{
+			name:        fmt.Sprintf("%s-%s", machine.Name, blockDevice.Name),
+			description: fmt.Sprintf("Additional block device for %s", machine.Name),
+		})
+	}
+	return instanceVolumes
+}
+
+// deleteOrphanedVolumes deletes the given volumes of an instance which doesn't
+// exist. They are left behind if creating the instance fails after they were
+// created, because otherwise they are deleted with the instance.
+//
+// Only volumes with the description CAPO gives them are deleted, so that we
+// never delete a volume which was not created for the machine.
+func deleteOrphanedVolumes(machine *machinev1.Machine, instanceVolumes []instanceVolume, volumeService orphanedVolumeService) error {
+	for _, instanceVolume := range instanceVolumes {
+		volume, err := volumeService.GetVolumeByName(instanceVolume.name)
+		if err != nil {
+			return fmt.Errorf("get volume %s err: %v", instanceVolume.name, err)
+		}
+		if volume == nil || volume.Description != instanceVolume.description {
+			continue
+		}
+
+		if err := volumeService.DeleteVolume(volume.ID); err != nil && !capoerrors.IsNotFound(err) {
+			capoRecorder.Warnf(machine, "FailedDeleteVolume", "Failed to delete orphaned volume %s: %v", volume.ID, err)
+			return fmt.Errorf("delete volume %s err: %v", volume.ID, err)
+		}
+		capoRecorder.Eventf(machine, "SuccessfulDeleteVolume", "Deleted orphaned volume %s with id %s", volume.Name, volume.ID)
+	}
+	return nil
+}
+
+// cleanupOrphanedVolumes deletes the volumes created for the instance of the
+// machine, which doesn't exist. Retained volumes are kept, as they may have
+// been detached from the deleted instance.
+func (oc *OpenstackClient) cleanupOrphanedVolumes(ctx context.Context, machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec, extensions *clients.ProviderSpecExtensions) error {
+	retained := retainedVolumeNames(machine, machineSpec, extensions)
+	instanceVolumes := slices.DeleteFunc(instanceVolumes(machine, machineSpec), func(volume instanceVolume) bool {
+		return slices.Contains(retained, volume.name)
+	})
+	if len(instanceVolumes) == 0 {
+		return nil
+	}
+
+	volumeService, err := clients.NewInstanceServiceFromMachine(ctx, oc.params.KubeClient, machine)
+	if err != nil {
+		return err
+	}
+	return deleteOrphanedVolumes(machine, instanceVolumes, volumeService)
+}
@@ -0,0 +1,252 @@
+package machine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	. "github.com/onsi/gomega"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func TestSelectVolumeZone(t *testing.T) {
+	tests := []struct {
+		name         string
+		zones        string
+		instanceZone string
+		expected     string
+	}{
+		{
+			name:     "single zone",
+			zones:    "az-ssd",
+			expected: "az-ssd",
+		},
+		{
+			name:         "zone of the instance",
+			zones:        "az0, az1,az2",
+			instanceZone: "az1",
+			expected:     "az1",
+		},
+		{
+			name:         "instance in another zone",
+			zones:        "az0,az1",
+			instanceZone: "az2",
+			expected:     "az0",
+		},
+		{
+			name:     "no zones",
+			zones:    " ",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := selectVolumeZone(tt.zones, tt.instanceZone); actual != tt.expected {
+				t.Errorf("Expected zone %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+type fakeVolumeMetadataService struct {
+	volumes map[string]*volumes.Volume
+	updated map[string]map[string]string
+}
+
+func (f *fakeVolumeMetadataService) GetVolumeByName(name string) (*volumes.Volume, error) {
+	return f.volumes[name], nil
+}
+
+func (f *fakeVolumeMetadataService) SetVolumeMetadata(volumeID string, metadata map[string]string) error {
+	f.updated[volumeID] = metadata
+	return nil
+}
+
+func TestReconcileBlockDeviceMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+			{Name: "etcd", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "data", SizeGiB: 100, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "logs", SizeGiB: 20, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+		},
+	}
+	extensions := &clients.ProviderSpecExtensions{
+		AdditionalBlockDevices: []clients.AdditionalBlockDeviceExtensions{
+			{Metadata: map[string]string{"purpose": "etcd"}},
+			{Metadata: map[string]string{"purpose": "data"}},
+		},
+	}
+	service := &fakeVolumeMetadataService{
+		volumes: map[string]*volumes.Volume{
+			"worker-0-etcd": {ID: "etcd-volume-id", Metadata: map[string]string{"backup": "daily"}},
+			"worker-0-data": {ID: "data-volume-id", Metadata: map[string]string{"purpose": "data"}},
+			"worker-0-logs": {ID: "logs-volume-id"},
+		},
+		updated: map[string]map[string]string{},
+	}
+
+	g.Expect(validateBlockDeviceMetadata(machineSpec, extensions)).To(Succeed())
+	g.Expect(reconcileBlockDeviceMetadata(machine, machineSpec, extensions, service)).To(Succeed())
+	g.Expect(service.updated).To(Equal(map[string]map[string]string{
+		"etcd-volume-id": {"backup": "daily", "purpose": "etcd"},
+	}))
+}
+
+func TestValidateBlockDeviceMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	extensions := &clients.ProviderSpecExtensions{
+		AdditionalBlockDevices: []clients.AdditionalBlockDeviceExtensions{{Metadata: map[string]string{"purpose": "etcd"}}},
+	}
+
+	g.Expect(validateBlockDeviceMetadata(&machinev1alpha1.OpenstackProviderSpec{}, extensions)).NotTo(Succeed())
+	g.Expect(validateBlockDeviceMetadata(&machinev1alpha1.OpenstackProviderSpec{
+		AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+			{Name: "etcd", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.LocalBlockDevice}},
+		},
+	}, extensions)).NotTo(Succeed())
+	g.Expect(validateBlockDeviceMetadata(&machinev1alpha1.OpenstackProviderSpec{
+		AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+			{Name: "etcd", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+		},
+	}, &clients.ProviderSpecExtensions{
+		AdditionalBlockDevices: []clients.AdditionalBlockDeviceExtensions{{Metadata: map[string]string{"": "etcd"}}},
+	})).NotTo(Succeed())
+}
+
+type fakeVolumeTypeService struct {
+	volumeTypes []string
+	lookups     int
+}
+
+func (f *fakeVolumeTypeService) DoesVolumeTypeExist(volumeType string) error {
+	f.lookups++
+	for _, vt := range f.volumeTypes {
+		if vt == volumeType {
+			return nil
+		}
+	}
+	return fmt.Errorf("could not find volume type: %s", volumeType)
+}
+
+func TestValidateVolumeTypes(t *testing.T) {
+	volumeDevice := func(name, volumeType string) machinev1alpha1.AdditionalBlockDevice {
+		return machinev1alpha1.AdditionalBlockDevice{
+			Name:    name,
+			SizeGiB: 10,
+			Storage: machinev1alpha1.BlockDeviceStorage{
+				Type:   machinev1alpha1.VolumeBlockDevice,
+				Volume: &machinev1alpha1.BlockDeviceVolume{Type: volumeType},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		machineSpec machinev1alpha1.OpenstackProviderSpec
+		lookups     int
+		wantErr     bool
+	}{
+		{
+			name: "no volume types",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				RootVolume:             &machinev1alpha1.RootVolume{Size: 25},
+				AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{volumeDevice("etcd", "")},
+			},
+		},
+		{
+			name: "existing volume types are looked up once",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				RootVolume: &machinev1alpha1.RootVolume{Size: 25, VolumeType: "ssd"},
+				AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+					volumeDevice("etcd", "ssd"),
+					volumeDevice("data", "hdd"),
+				},
+			},
+			lookups: 2,
+		},
+		{
+			name: "missing root volume type",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				RootVolume: &machinev1alpha1.RootVolume{Size: 25, VolumeType: "nvme"},
+			},
+			lookups: 1,
+			wantErr: true,
+		},
+		{
+			name: "missing block device volume type",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{volumeDevice("etcd", "nvme")},
+			},
+			lookups: 1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			service := &fakeVolumeTypeService{volumeTypes: []string{"ssd", "hdd"}}
+			err := validateVolumeTypes(&tt.machineSpec, service)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(service.lookups).To(Equal(tt.lookups))
+		})
+	}
+}
+
+type fakeOrphanedVolumeService struct {
+	volumes map[string]*volumes.Volume
+	deleted []string
+}
+
+func (f *fakeOrphanedVolumeService) GetVolumeByName(name string) (*volumes.Volume, error) {
+	return f.volumes[name], nil
+}
+
+func (f *fakeOrphanedVolumeService) DeleteVolume(volumeID string) error {
+	f.deleted = append(f.deleted, volumeID)
+	return nil
+}
+
+func TestDeleteOrphanedVolumes(t *testing.T) {
+	g := NewWithT(t)
+
+	machine := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}
+	machineSpec := &machinev1alpha1.OpenstackProviderSpec{
+		RootVolume: &machinev1alpha1.RootVolume{Size: 25},
+		AdditionalBlockDevices: []machinev1alpha1.AdditionalBlockDevice{
+			{Name: "etcd", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "scratch", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.LocalBlockDevice}},
+			{Name: "data", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+			{Name: "logs", SizeGiB: 10, Storage: machinev1alpha1.BlockDeviceStorage{Type: machinev1alpha1.VolumeBlockDevice}},
+		},
+	}
+	service := &fakeOrphanedVolumeService{
+		volumes: map[string]*volumes.Volume{
+			"worker-0-root": {ID: "root-volume-id", Name: "worker-0-root", Description: "Root volume for worker-0"},
+			"worker-0-etcd": {ID: "etcd-volume-id", Name: "worker-0-etcd", Description: "Additional block device for worker-0"},
+			// Not created for the machine
+			"worker-0-data": {ID: "data-volume-id", Name: "worker-0-data", Description: "Backups"},
+		},
+	}
+
+	orphans := instanceVolumes(machine, machineSpec)
+	g.Expect(orphans).To(HaveLen(4))
+	g.Expect(deleteOrphanedVolumes(machine, orphans, service)).To(Succeed())
+	g.Expect(service.deleted).To(Equal([]string{"root-volume-id", "etcd-volume-id"}))
+
+	g.Expect(instanceVolumes(machine, &machinev1alpha1.OpenstackProviderSpec{})).To(BeEmpty())
+}
@@ -0,0 +1,206 @@
+package machine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// Policies for availability zones in which the creation of machines keeps
+// failing.
+const (
+	// ZoneCreateFailurePolicyWarn only reports the suspected outage
+	ZoneCreateFailurePolicyWarn = "Warn"
+
+	// ZoneCreateFailurePolicyBlock also delays the creation of machines in
+	// the availability zone until its failures are older than the window
+	ZoneCreateFailurePolicyBlock = "Block"
+
+	// DefaultZoneCreateFailureWindow is the default for
+	// ZoneCreateFailureWindow
+	DefaultZoneCreateFailureWindow = 10 * time.Minute
+)
+
+// ValidateZoneCreateFailurePolicy returns an error if policy is not a policy
+// for availability zones in which the creation of machines keeps failing.
+func ValidateZoneCreateFailurePolicy(policy string) error {
+	switch policy {
+	case ZoneCreateFailurePolicyWarn, ZoneCreateFailurePolicyBlock:
+		return nil
+	}
+	return fmt.Errorf("invalid availability zone create failure policy %q: must be %s or %s", policy, ZoneCreateFailurePolicyWarn, ZoneCreateFailurePolicyBlock)
+}
+
+// infrastructureRef is the cluster Infrastructure object, which cluster-level
+// events are reported on.
+var infrastructureRef = &corev1.ObjectReference{
+	APIVersion: "config.openshift.io/v1",
+	Kind:       "Infrastructure",
+	Name:       "cluster",
+}
+
+// zoneKey identifies an availability zone of a cloud.
+type zoneKey struct {
+	secret types.NamespacedName
+	cloud  string
+	zone   string
+}
+
+func newZoneKey(machine *machinev1.Machine, machineSpec *machinev1alpha1.OpenstackProviderSpec) zoneKey {
+	return zoneKey{
+		secret: machineCloudsSecret(machine, machineSpec),
+		cloud:  machineSpec.CloudName,
+		zone:   machineAvailabilityZone(machine, machineSpec),
+	}
+}
+
+type zoneCreateFailures struct {
+	// failures are the times of the failed creations within the window
+	// since the last successful one
+	failures []time.Time
+
+	// suspected is whether an outage of the zone was reported
+	suspected bool
+}
+
+// zoneHealth tracks the failed creations of machines per availability zone.
+// An outage of a zone is suspected when at least threshold creations of
+// machines in it failed within the window, and none succeeded since. Machines
+// without an availability zone aren't tracked, as Nova chooses their zone.
+type zoneHealth struct {
+	mu       sync.Mutex
+	zones    map[zoneKey]*zoneCreateFailures
+	recorder record.EventRecorder
+
+	// threshold is the number of failures of a suspected outage. Zones
+	// aren't tracked if it is 0.
+	threshold int
+	window    time.Duration
+	policy    string
+
+	now func() time.Time
+}
+
+func newZoneHealth(threshold int, window time.Duration, policy string, recorder record.EventRecorder) *zoneHealth {
+	if window == 0 {
+		window = DefaultZoneCreateFailureWindow
+	}
+	if policy == "" {
+		policy = ZoneCreateFailurePolicyWarn
+	}
+	return &zoneHealth{
+		zones:     make(map[zoneKey]*zoneCreateFailures),
+		recorder:  recorder,
+		threshold: threshold,
+		window:    window,
+		policy:    policy,
+		now:       time.Now,
+	}
+}
+
+func (h *zoneHealth) tracks(key zoneKey) bool {
+	return h != nil && h.threshold > 0 && key.zone != ""
+}
+
+// prune drops the failures older than the window. It assumes the lock is
+// held.
+func (h *zoneHealth) prune(failures *zoneCreateFailures) {
+	cutoff := h.now().Add(-h.window)
+	i := 0
+	for i < len(failures.failures) && !failures.failures[i].After(cutoff) {
+		i++
+	}
+	failures.failures = failures.failures[i:]
+}
+
+// recordFailure records a failed creation of a machine in the zone, and
+// reports a suspected outage when the zone reaches the threshold.
+func (h *zoneHealth) recordFailure(key zoneKey) {
+	if !h.tracks(key) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failures, ok := h.zones[key]
+	if !ok {
+		failures = &zoneCreateFailures{}
+		h.zones[key] = failures
+	}
+	h.prune(failures)
+	failures.failures = append(failures.failures, h.now())
+
+	if len(failures.failures) >= h.threshold && !failures.suspected {
+		failures.suspected = true
+		h.recorder.Eventf(infrastructureRef, corev1.EventTypeWarning, "AvailabilityZoneOutageSuspected",
+			"Suspected outage of availability zone %s of cloud %s of clouds secret %s: %d creations of machines failed within %s",
+			key.zone, key.cloud, key.secret, len(failures.failures), h.window)
+	}
+}
+
+// recordSuccess records a successful creation of a machine in the zone, which
+// ends a suspected outage.
+func (h *zoneHealth) recordSuccess(key zoneKey) {
+	if !h.tracks(key) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failures, ok := h.zones[key]
+	if !ok {
+		return
+	}
+	delete(h.zones, key)
+	if failures.suspected {
+		h.recorder.Eventf(infrastructureRef, corev1.EventTypeNormal, "AvailabilityZoneRecovered",
+			"Availability zone %s of cloud %s of clouds secret %s recovered: a machine was created in it", key.zone, key.cloud, key.secret)
+	}
+}
+
+// blockedFor returns how long the creation of machines in the zone is
+// delayed by the Block policy: until enough of its failures are older than
+// the window for it to be below the threshold again. The next creation is
+// then attempted, and ends the suspected outage if it succeeds.
+func (h *zoneHealth) blockedFor(key zoneKey) time.Duration {
+	if !h.tracks(key) || h.policy != ZoneCreateFailurePolicyBlock {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failures, ok := h.zones[key]
+	if !ok {
+		return 0
+	}
+	h.prune(failures)
+	if len(failures.failures) < h.threshold {
+		return 0
+	}
+	// The failure which must expire for the zone to drop below the threshold
+	expiring := failures.failures[len(failures.failures)-h.threshold]
+	return expiring.Add(h.window).Sub(h.now())
+}
+
+// checkZoneHealth delays the creation of the machine if its availability
+// zone is suspected to be out and the policy blocks it.
+func (oc *OpenstackClient) checkZoneHealth(machine *machinev1.Machine, key zoneKey) error {
+	delay := oc.zoneHealth.blockedFor(key)
+	if delay <= 0 {
+		return nil
+	}
+	delay = delay.Round(time.Second) + time.Second
+	oc.eventRecorder.Eventf(machine, corev1.EventTypeWarning, "AvailabilityZoneBlocked",
+		"Creation delayed by %s: availability zone %s is suspected to be out", delay, key.zone)
+	return &maoMachine.RequeueAfterError{RequeueAfter: delay}
+}
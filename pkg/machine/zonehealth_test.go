@@ -0,0 +1,145 @@
+package machine
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	capoRecorder "sigs.k8s.io/cluster-api-provider-openstack/pkg/record"
+)
+
+func TestZoneHealth(t *testing.T) {
+	now := time.Now()
+	recorder := record.NewFakeRecorder(10)
+	health := newZoneHealth(2, 10*time.Minute, ZoneCreateFailurePolicyBlock, recorder)
+	health.now = func() time.Time { return now }
+
+	key := zoneKey{
+		secret: types.NamespacedName{Namespace: "openshift-machine-api", Name: "openstack-cloud-credentials"},
+		cloud:  "openstack",
+		zone:   "az1",
+	}
+	otherZone := key
+	otherZone.zone = "az2"
+
+	health.recordFailure(key)
+	if delay := health.blockedFor(key); delay != 0 {
+		t.Errorf("Expected no delay below the threshold, got %s", delay)
+	}
+
+	now = now.Add(time.Minute)
+	health.recordFailure(key)
+	if delay := health.blockedFor(key); delay != 9*time.Minute {
+		t.Errorf("Expected the creation to be delayed until the first failure expires, got %s", delay)
+	}
+	if delay := health.blockedFor(otherZone); delay != 0 {
+		t.Errorf("Expected no delay in another zone, got %s", delay)
+	}
+	expectEvent(t, recorder, "AvailabilityZoneOutageSuspected")
+
+	// Further failures don't report the outage again
+	health.recordFailure(key)
+	expectNoEvent(t, recorder)
+
+	// Once enough failures expired a creation is attempted again
+	now = now.Add(10 * time.Minute)
+	if delay := health.blockedFor(key); delay != 0 {
+		t.Errorf("Expected no delay after the failures expired, got %s", delay)
+	}
+	health.recordSuccess(key)
+	expectEvent(t, recorder, "AvailabilityZoneRecovered")
+	health.recordSuccess(key)
+	expectNoEvent(t, recorder)
+}
+
+func TestZoneHealthNotTracked(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+
+	tests := []struct {
+		name   string
+		health *zoneHealth
+		key    zoneKey
+	}{
+		{
+			name:   "disabled",
+			health: newZoneHealth(0, 0, ZoneCreateFailurePolicyBlock, recorder),
+			key:    zoneKey{zone: "az1"},
+		},
+		{
+			name:   "no availability zone",
+			health: newZoneHealth(1, 0, ZoneCreateFailurePolicyBlock, recorder),
+		},
+		{
+			name:   "warn policy",
+			health: newZoneHealth(1, 0, ZoneCreateFailurePolicyWarn, recorder),
+			key:    zoneKey{zone: "az1"},
+		},
+		{
+			name: "no tracker",
+			key:  zoneKey{zone: "az1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.health.recordFailure(tt.key)
+			if delay := tt.health.blockedFor(tt.key); delay != 0 {
+				t.Errorf("Expected no delay, got %s", delay)
+			}
+		})
+	}
+}
+
+func TestValidateZoneCreateFailurePolicy(t *testing.T) {
+	for _, policy := range []string{ZoneCreateFailurePolicyWarn, ZoneCreateFailurePolicyBlock} {
+		if err := ValidateZoneCreateFailurePolicy(policy); err != nil {
+			t.Errorf("Expected policy %s to be valid, got %v", policy, err)
+		}
+	}
+	if err := ValidateZoneCreateFailurePolicy("Deprioritize"); err == nil {
+		t.Errorf("Expected an unknown policy to be invalid")
+	}
+}
+
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, reason string) {
+	t.Helper()
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, reason) {
+			t.Errorf("Expected event %s, got %s", reason, event)
+		}
+	default:
+		t.Errorf("Expected event %s, got none", reason)
+	}
+}
+
+func expectNoEvent(t *testing.T, recorder *record.FakeRecorder) {
+	t.Helper()
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("Expected no event, got %s", event)
+	default:
+	}
+}
+
+var (
+	capoEventsOnce sync.Once
+	capoEvents     = &record.FakeRecorder{}
+)
+
+// recordCapoEvents returns a recorder of the events sent through the global
+// CAPO recorder until the end of the test. The global recorder can only be
+// set once, so it drops the events of the other tests.
+func recordCapoEvents(t *testing.T) *record.FakeRecorder {
+	capoEventsOnce.Do(func() {
+		capoRecorder.InitFromRecorder(capoEvents)
+	})
+	capoEvents.Events = make(chan string, 10)
+	t.Cleanup(func() {
+		capoEvents.Events = nil
+	})
+	return capoEvents
+}
@@ -0,0 +1,87 @@
+package machineset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CapacityUnknownCondition is true while the flavor of the template of a
+// MachineSet can't be looked up, e.g. during an outage of the cloud, so that
+// the autoscaler and admins know that its capacity annotations are stale.
+const CapacityUnknownCondition machinev1.ConditionType = "MachineSetCapacityUnknown"
+
+// CapacityAnnotationsGracePeriod is how long the capacity annotations of a
+// MachineSet are kept after its flavor could no longer be looked up. After it,
+// they are removed so that the autoscaler doesn't scale from zero with
+// capacity which may no longer be right.
+const CapacityAnnotationsGracePeriod = 10 * time.Minute
+
+// flavorLookupError is returned by reconcile when the flavor of a MachineSet
+// can't be looked up.
+type flavorLookupError struct {
+	flavor string
+	err    error
+}
+
+func (e *flavorLookupError) Error() string {
+	return fmt.Sprintf("failed to find information for %q: %v", e.flavor, e.err)
+}
+
+func (e *flavorLookupError) Unwrap() error {
+	return e.err
+}
+
+// expireCapacityAnnotations removes the capacity annotations of machineSet if
+// its capacity has been unknown for longer than the grace period, and returns
+// whether it removed them.
+func expireCapacityAnnotations(machineSet *machinev1.MachineSet, now time.Time) bool {
+	if !conditions.IsTrue(machineSet, CapacityUnknownCondition) {
+		return false
+	}
+	if condition := conditions.Get(machineSet, CapacityUnknownCondition); now.Sub(condition.LastTransitionTime.Time) < CapacityAnnotationsGracePeriod {
+		return false
+	}
+	_, hasCPU := machineSet.Annotations[cpuKey]
+	_, hasMemory := machineSet.Annotations[memoryKey]
+	delete(machineSet.Annotations, cpuKey)
+	delete(machineSet.Annotations, memoryKey)
+	return hasCPU || hasMemory
+}
+
+// setCapacityCondition sets CapacityUnknownCondition on machineSet from the
+// result of reconcile. It is left as it is if reconcile failed before looking
+// up the flavor.
+func setCapacityCondition(machineSet *machinev1.MachineSet, reconcileErr error) bool {
+	var lookupErr *flavorLookupError
+	switch {
+	case errors.As(reconcileErr, &lookupErr):
+		// The error is reported in an event, so that the message stays
+		// the same and the transition time tells how long the capacity
+		// has been unknown
+		conditions.Set(machineSet, conditions.TrueConditionWithReason(CapacityUnknownCondition, "FlavorLookupFailed",
+			"flavor %s could not be looked up, the capacity annotations are stale", lookupErr.flavor))
+	case machineSet.Annotations[cpuKey] != "":
+		conditions.Set(machineSet, conditions.FalseCondition(CapacityUnknownCondition, "FlavorFound", machinev1.ConditionSeverityNone, ""))
+	default:
+		return false
+	}
+	return true
+}
+
+// reportCapacity sets CapacityUnknownCondition on machineSet.
+func (r *Reconciler) reportCapacity(ctx context.Context, machineSet *machinev1.MachineSet, reconcileErr error) error {
+	patch := client.MergeFrom(machineSet.DeepCopy())
+	if !setCapacityCondition(machineSet, reconcileErr) {
+		return nil
+	}
+	if err := r.Client.Status().Patch(ctx, machineSet, patch); err != nil {
+		return fmt.Errorf("failed to patch machineSet status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package machineset
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpireCapacityAnnotations(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name            string
+		condition       *machinev1.Condition
+		expectedRemoved bool
+	}{
+		{
+			name: "capacity known",
+			condition: &machinev1.Condition{
+				Type:               CapacityUnknownCondition,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: metav1.NewTime(now.Add(-time.Hour)),
+			},
+		},
+		{
+			name: "capacity unknown within the grace period",
+			condition: &machinev1.Condition{
+				Type:               CapacityUnknownCondition,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(now.Add(-time.Minute)),
+			},
+		},
+		{
+			name: "capacity unknown after the grace period",
+			condition: &machinev1.Condition{
+				Type:               CapacityUnknownCondition,
+				Status:             corev1.ConditionTrue,
+				LastTransitionTime: metav1.NewTime(now.Add(-CapacityAnnotationsGracePeriod - time.Minute)),
+			},
+			expectedRemoved: true,
+		},
+		{
+			name: "no condition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machineSet := &machinev1.MachineSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{cpuKey: "4", memoryKey: "16000", "other": "annotation"},
+				},
+			}
+			if tt.condition != nil {
+				machineSet.Status.Conditions = []machinev1.Condition{*tt.condition}
+			}
+
+			removed := expireCapacityAnnotations(machineSet, now)
+			if removed != tt.expectedRemoved {
+				t.Errorf("Expected removed %v, got %v", tt.expectedRemoved, removed)
+			}
+			_, hasCPU := machineSet.Annotations[cpuKey]
+			_, hasMemory := machineSet.Annotations[memoryKey]
+			if hasCPU == tt.expectedRemoved || hasMemory == tt.expectedRemoved {
+				t.Errorf("Expected the capacity annotations to be removed: %v, got %v", tt.expectedRemoved, machineSet.Annotations)
+			}
+			if machineSet.Annotations["other"] != "annotation" {
+				t.Errorf("Expected other annotations to be kept, got %v", machineSet.Annotations)
+			}
+		})
+	}
+}
+
+func TestSetCapacityCondition(t *testing.T) {
+	machineSet := &machinev1.MachineSet{}
+	lookupErr := &flavorLookupError{flavor: "m1.large", err: fmt.Errorf("service unavailable")}
+
+	if setCapacityCondition(machineSet, fmt.Errorf("flavor name is empty")) {
+		t.Errorf("Expected no condition when the flavor was not looked up")
+	}
+
+	if !setCapacityCondition(machineSet, lookupErr) || !conditions.IsTrue(machineSet, CapacityUnknownCondition) {
+		t.Fatalf("Expected the capacity to be unknown, got %v", machineSet.Status.Conditions)
+	}
+	// The transition time must not change while the lookups keep failing
+	transitionTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	machineSet.Status.Conditions[0].LastTransitionTime = transitionTime
+	setCapacityCondition(machineSet, &flavorLookupError{flavor: "m1.large", err: fmt.Errorf("gateway timeout")})
+	if condition := conditions.Get(machineSet, CapacityUnknownCondition); !condition.LastTransitionTime.Equal(&transitionTime) {
+		t.Errorf("Expected the transition time to be kept, got %v", condition.LastTransitionTime)
+	}
+
+	machineSet.Annotations = map[string]string{cpuKey: "4", memoryKey: "16000"}
+	if !setCapacityCondition(machineSet, nil) || !conditions.IsFalse(machineSet, CapacityUnknownCondition) {
+		t.Errorf("Expected the capacity to be known, got %v", machineSet.Status.Conditions)
+	}
+}
@@ -2,12 +2,14 @@ package machineset
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
 	"github.com/openshift/machine-api-provider-openstack/pkg/machineset/flavorcache"
+	"github.com/openshift/machine-api-provider-openstack/pkg/utils"
 
 	"github.com/go-logr/logr"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
@@ -53,6 +55,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrlRuntime.Request) (ct
 	machineSet := &machinev1.MachineSet{}
 	if err := r.Client.Get(ctx, req.NamespacedName, machineSet); err != nil {
 		if apierrors.IsNotFound(err) {
+			forgetDeprecatedFields(req.Namespace, req.Name)
 			return ctrlRuntime.Result{}, nil
 		}
 		return ctrlRuntime.Result{}, err
@@ -61,6 +64,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrlRuntime.Request) (ct
 	// Ignore deleted MachineSets, this can happen when foregroundDeletion
 	// is enabled
 	if !machineSet.DeletionTimestamp.IsZero() {
+		forgetDeprecatedFields(machineSet.Namespace, machineSet.Name)
+		return ctrlRuntime.Result{}, nil
+	}
+
+	if r.skipPaused(machineSet) {
 		return ctrlRuntime.Result{}, nil
 	}
 
@@ -76,6 +84,23 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrlRuntime.Request) (ct
 	if err := r.Client.Patch(ctx, machineSet, originalMachineSetPatch); err != nil {
 		return ctrlRuntime.Result{}, fmt.Errorf("failed to patch machineSet: %v", err)
 	}
+
+	if err := r.reportCapacity(ctx, machineSet, err); err != nil {
+		return ctrlRuntime.Result{}, err
+	}
+
+	// The networks may have been converted to ports by reconcile
+	if err := r.reportDeprecatedFields(ctx, machineSet); err != nil {
+		return ctrlRuntime.Result{}, err
+	}
+
+	// A failed flavor lookup is reported by CapacityUnknownCondition and
+	// retried after a fixed delay, instead of with the growing backoff of
+	// errors, so that the capacity is known again soon after an outage
+	var lookupErr *flavorLookupError
+	if errors.As(err, &lookupErr) {
+		return result, nil
+	}
 	return result, err
 }
 
@@ -84,6 +109,19 @@ func requeueTime() time.Duration {
 	// retrying to refresh the information of a failed look up.
 	return flavorcache.RefreshFailureTime / 2
 }
+
+// skipPaused returns true, and records an event, if machineSet is paused,
+// e.g. because Cluster API is its authoritative API. Paused MachineSets are
+// left alone entirely: they are updated by whoever manages them.
+func (r *Reconciler) skipPaused(machineSet *machinev1.MachineSet) bool {
+	reason := utils.MachineSetPausedReason(machineSet)
+	if reason == "" {
+		return false
+	}
+	r.eventRecorder.Eventf(machineSet, corev1.EventTypeNormal, "Paused", "Not reconciling %s: %s", machineSet.Name, reason)
+	return true
+}
+
 func (r *Reconciler) reconcile(ctx context.Context, machineSet *machinev1.MachineSet) (ctrlRuntime.Result, error) {
 	pSpec, err := clients.MachineSpecFromProviderSpec(machineSet.Spec.Template.Spec.ProviderSpec)
 	if err != nil {
@@ -102,7 +140,7 @@ func (r *Reconciler) reconcile(ctx context.Context, machineSet *machinev1.Machin
 		instanceService = injected
 	} else {
 		m := &machinev1.Machine{Spec: machineSet.Spec.Template.Spec}
-		is, err := clients.NewInstanceServiceFromMachine(r.kubeClient, m)
+		is, err := clients.NewInstanceServiceFromMachine(ctx, r.kubeClient, m)
 		if err != nil {
 			return ctrlRuntime.Result{}, fmt.Errorf("failed to get InstanceService: %v", err)
 		}
@@ -113,15 +151,22 @@ func (r *Reconciler) reconcile(ctx context.Context, machineSet *machinev1.Machin
 	if err != nil {
 		// At this time we don't have enough information to set correct annotations
 		// so we inform the controller it needs to requeue the request.
+		if expireCapacityAnnotations(machineSet, time.Now()) {
+			r.eventRecorder.Eventf(machineSet, corev1.EventTypeWarning, "CapacityAnnotationsRemoved", "Removed the capacity annotations, flavor %s could not be looked up for %s", pSpec.Flavor, CapacityAnnotationsGracePeriod)
+		}
 		return ctrlRuntime.Result{
 			Requeue:      true,
 			RequeueAfter: requeueTime(),
-		}, fmt.Errorf("failed to find information for %q: %w", pSpec.Flavor, err)
+		}, &flavorLookupError{flavor: pSpec.Flavor, err: err}
 	}
 
 	machineSet.Annotations[cpuKey] = strconv.Itoa(flavorInfo.VCPUs)
 	machineSet.Annotations[memoryKey] = strconv.Itoa(flavorInfo.RAM)
 
+	if err := r.convertNetworksToPorts(ctx, machineSet); err != nil {
+		return ctrlRuntime.Result{}, err
+	}
+
 	return ctrlRuntime.Result{}, nil
 }
 
@@ -303,6 +303,22 @@ func TestReconcile(t *testing.T) {
 	}
 }
 
+func TestSkipPaused(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := record.NewFakeRecorder(10)
+	r := Reconciler{eventRecorder: recorder}
+
+	machineSet, err := newTestMachineSet("default", validFlavorName, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.skipPaused(machineSet)).To(BeFalse())
+	g.Expect(recorder.Events).To(BeEmpty())
+
+	machineSet.Status.AuthoritativeAPI = machinev1beta1.MachineAuthorityClusterAPI
+	g.Expect(r.skipPaused(machineSet)).To(BeTrue())
+	g.Expect(<-recorder.Events).To(ContainSubstring("Paused"))
+}
+
 func newTestMachineSet(namespace string, flavor string, existingAnnotations map[string]string) (*machinev1beta1.MachineSet, error) {
 	// Copy anntotations map so we don't modify the input
 	annotations := make(map[string]string)
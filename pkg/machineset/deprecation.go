@@ -0,0 +1,118 @@
+package machineset
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// DeprecatedFieldsRemovedCondition is set on a MachineSet to report whether
+// the providerSpec of its template still uses deprecated fields, so that they
+// can be removed across a fleet before support for them is dropped.
+const DeprecatedFieldsRemovedCondition machinev1.ConditionType = "DeprecatedFieldsRemoved"
+
+// deprecatedField is a deprecated field of the providerSpec. Fields of list
+// entries are named without their index, e.g. networks[].filter.
+type deprecatedField struct {
+	path        string
+	replacement string
+}
+
+func (f deprecatedField) String() string {
+	if f.replacement == "" {
+		return f.path + " (ignored)"
+	}
+	return fmt.Sprintf("%s (use %s)", f.path, f.replacement)
+}
+
+// deprecatedFields returns the deprecated fields used by the providerSpec, in
+// the order of the providerSpec.
+func deprecatedFields(machineSpec *machinev1alpha1.OpenstackProviderSpec) []deprecatedField {
+	var fields []deprecatedField
+	add := func(field deprecatedField) {
+		for _, f := range fields {
+			if f == field {
+				return
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	for _, network := range machineSpec.Networks {
+		if !reflect.DeepEqual(network.Filter, machinev1alpha1.Filter{}) {
+			add(deprecatedField{path: "networks[].filter", replacement: "networks[].uuid"})
+		}
+		for _, subnet := range network.Subnets {
+			if subnet.Filter.NetworkID != "" {
+				add(deprecatedField{path: "networks[].subnets[].filter.networkId"})
+			}
+		}
+	}
+
+	for _, port := range machineSpec.Ports {
+		if port.TenantID != "" {
+			add(deprecatedField{path: "ports[].tenantID", replacement: "ports[].projectID"})
+		}
+		if port.DeprecatedHostID != "" {
+			add(deprecatedField{path: "ports[].hostID"})
+		}
+	}
+
+	if machineSpec.FloatingIP != "" {
+		add(deprecatedField{path: "floatingIP", replacement: "floatingIPs"})
+	}
+
+	for _, securityGroup := range machineSpec.SecurityGroups {
+		filter := securityGroup.Filter
+		if filter.TenantID != "" {
+			add(deprecatedField{path: "securityGroups[].filter.tenantId", replacement: "securityGroups[].filter.projectId"})
+		}
+		if filter.DeprecatedLimit != 0 || filter.DeprecatedMarker != "" || filter.DeprecatedSortKey != "" || filter.DeprecatedSortDir != "" {
+			add(deprecatedField{path: "securityGroups[].filter.{limit,marker,sortKey,sortDir}"})
+		}
+	}
+
+	// The subnet of the fixed IP which floating IPs are associated with is
+	// given in floatingIPs instead
+	if machineSpec.PrimarySubnet != "" {
+		add(deprecatedField{path: "primarySubnet", replacement: "floatingIPs[].subnetID"})
+	}
+
+	return fields
+}
+
+// reportDeprecatedFields sets DeprecatedFieldsRemovedCondition on machineSet
+// and exports the deprecated fields it uses.
+func (r *Reconciler) reportDeprecatedFields(ctx context.Context, machineSet *machinev1.MachineSet) error {
+	machineSpec, err := clients.MachineSpecFromProviderSpec(machineSet.Spec.Template.Spec.ProviderSpec)
+	if err != nil {
+		// Reported by reconcile
+		return nil
+	}
+
+	fields := deprecatedFields(machineSpec)
+	recordDeprecatedFields(machineSet, fields)
+
+	patch := client.MergeFrom(machineSet.DeepCopy())
+	if len(fields) == 0 {
+		conditions.MarkTrue(machineSet, DeprecatedFieldsRemovedCondition)
+	} else {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.String()
+		}
+		conditions.MarkFalse(machineSet, DeprecatedFieldsRemovedCondition, "DeprecatedFieldsUsed", machinev1.ConditionSeverityWarning, "providerSpec uses deprecated fields: %s", strings.Join(names, ", "))
+	}
+	if err := r.Client.Status().Patch(ctx, machineSet, patch); err != nil {
+		return fmt.Errorf("failed to patch machineSet status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package machineset
+
+import (
+	"reflect"
+	"testing"
+
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+)
+
+func TestDeprecatedFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineSpec machinev1alpha1.OpenstackProviderSpec
+		expected    []string
+	}{
+		{
+			name: "none",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{{UUID: "network-uuid"}},
+				Ports:    []machinev1alpha1.PortOpts{{NetworkID: "network-uuid", ProjectID: "project-id"}},
+			},
+		},
+		{
+			name: "network filters",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Networks: []machinev1alpha1.NetworkParam{
+					{Filter: machinev1alpha1.Filter{Name: "machines"}},
+					{Filter: machinev1alpha1.Filter{Tags: "storage"}, Subnets: []machinev1alpha1.SubnetParam{
+						{Filter: machinev1alpha1.SubnetFilter{Name: "storage", NetworkID: "network-uuid"}},
+					}},
+				},
+			},
+			expected: []string{
+				"networks[].filter (use networks[].uuid)",
+				"networks[].subnets[].filter.networkId (ignored)",
+			},
+		},
+		{
+			name: "legacy floating IP and primary subnet",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				FloatingIP:    "203.0.113.10",
+				PrimarySubnet: "subnet-uuid",
+			},
+			expected: []string{
+				"floatingIP (use floatingIPs)",
+				"primarySubnet (use floatingIPs[].subnetID)",
+			},
+		},
+		{
+			name: "ports and security groups",
+			machineSpec: machinev1alpha1.OpenstackProviderSpec{
+				Ports: []machinev1alpha1.PortOpts{
+					{NetworkID: "network-uuid", TenantID: "project-id", DeprecatedHostID: "compute-0"},
+				},
+				SecurityGroups: []machinev1alpha1.SecurityGroupParam{
+					{Filter: machinev1alpha1.SecurityGroupFilter{Name: "workers", TenantID: "project-id", DeprecatedLimit: 1}},
+				},
+			},
+			expected: []string{
+				"ports[].tenantID (use ports[].projectID)",
+				"ports[].hostID (ignored)",
+				"securityGroups[].filter.tenantId (use securityGroups[].filter.projectId)",
+				"securityGroups[].filter.{limit,marker,sortKey,sortDir} (ignored)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual []string
+			for _, field := range deprecatedFields(&tt.machineSpec) {
+				actual = append(actual, field.String())
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected deprecated fields %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
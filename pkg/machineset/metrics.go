@@ -0,0 +1,34 @@
+package machineset
+
+import (
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var deprecatedFieldsUsed = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mapo_machineset_deprecated_fields",
+		Help: "Deprecated providerSpec fields used by the template of a MachineSet, with value 1 for each field used.",
+	},
+	[]string{"namespace", "machineset", "field"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(deprecatedFieldsUsed)
+}
+
+// recordDeprecatedFields exports the deprecated fields used by machineSet,
+// replacing those exported before.
+func recordDeprecatedFields(machineSet *machinev1.MachineSet, fields []deprecatedField) {
+	forgetDeprecatedFields(machineSet.Namespace, machineSet.Name)
+	for _, field := range fields {
+		deprecatedFieldsUsed.WithLabelValues(machineSet.Namespace, machineSet.Name, field.path).Set(1)
+	}
+}
+
+// forgetDeprecatedFields stops exporting the deprecated fields of a
+// MachineSet, e.g. once it has been deleted.
+func forgetDeprecatedFields(namespace, name string) {
+	deprecatedFieldsUsed.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "machineset": name})
+}
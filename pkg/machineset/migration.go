@@ -0,0 +1,96 @@
+package machineset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	configv1 "github.com/openshift/api/config/v1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/machine"
+)
+
+const (
+	// ConvertNetworksToPortsAnnotation requests that the networks of the
+	// providerSpec of the template of a MachineSet are converted to the
+	// equivalent ports. With ConvertDryRun the ports are only written to
+	// ConvertedPortsAnnotation. With ConvertApply the providerSpec is
+	// rewritten, and the annotation is removed.
+	ConvertNetworksToPortsAnnotation = "machine.openshift.io/openstack-convert-networks-to-ports"
+
+	// ConvertedPortsAnnotation is the ports which the networks of a MachineSet
+	// would be converted to, as JSON.
+	ConvertedPortsAnnotation = "machine.openshift.io/openstack-converted-ports"
+
+	ConvertDryRun = "DryRun"
+	ConvertApply  = "Apply"
+)
+
+// convertNetworksToPorts converts the networks of the template of machineSet
+// to ports if requested by ConvertNetworksToPortsAnnotation. Machines which
+// already exist are not changed.
+func (r *Reconciler) convertNetworksToPorts(ctx context.Context, machineSet *machinev1.MachineSet) error {
+	mode, ok := machineSet.Annotations[ConvertNetworksToPortsAnnotation]
+	if !ok {
+		return nil
+	}
+	if mode != ConvertDryRun && mode != ConvertApply {
+		return fmt.Errorf("%s must be %s or %s, not %q", ConvertNetworksToPortsAnnotation, ConvertDryRun, ConvertApply, mode)
+	}
+
+	infra := &configv1.Infrastructure{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "cluster"}, infra); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get cluster Infrastructure object: %w", err)
+	}
+	var platformStatus *configv1.OpenStackPlatformStatus
+	if infra.Status.PlatformStatus != nil {
+		platformStatus = infra.Status.PlatformStatus.OpenStack
+	}
+
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: machineSet.Namespace},
+		Spec:       machineSet.Spec.Template.Spec,
+	}
+	cloud, err := clients.GetCloud(r.kubeClient, m)
+	if err != nil {
+		return err
+	}
+	osScope, err := clients.NewProviderScope(cloud, clients.GetCACertificate(r.kubeClient), ctrl.LoggerFrom(ctx))
+	if err != nil {
+		return err
+	}
+
+	value, ports, err := machine.ConvertNetworksToPorts(machineSet.Spec.Template.Spec.ProviderSpec, platformStatus, clients.WithContext(ctx, osScope))
+	if err != nil {
+		return fmt.Errorf("failed to convert networks to ports: %w", err)
+	}
+
+	if mode == ConvertDryRun {
+		if value == nil {
+			delete(machineSet.Annotations, ConvertedPortsAnnotation)
+			return nil
+		}
+		data, err := json.Marshal(ports)
+		if err != nil {
+			return err
+		}
+		machineSet.Annotations[ConvertedPortsAnnotation] = string(data)
+		r.eventRecorder.Eventf(machineSet, corev1.EventTypeNormal, "ConvertedNetworksToPorts", "Networks would be converted to %d ports", len(ports))
+		return nil
+	}
+
+	if value != nil {
+		machineSet.Spec.Template.Spec.ProviderSpec.Value = value
+		r.eventRecorder.Eventf(machineSet, corev1.EventTypeNormal, "ConvertedNetworksToPorts", "Converted networks to %d ports", len(ports))
+	}
+	delete(machineSet.Annotations, ConvertNetworksToPortsAnnotation)
+	delete(machineSet.Annotations, ConvertedPortsAnnotation)
+	return nil
+}
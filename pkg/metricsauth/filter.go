@@ -0,0 +1,166 @@
+package metricsauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// ClientCATLSOption returns an option of the TLS config of the metrics server
+// which verifies the certificates presented by clients with the CAs in
+// caFile. Clients without a certificate can still authenticate with a token.
+func ClientCATLSOption(caFile string) (func(*tls.Config), error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA file %s has no PEM encoded certificates", caFile)
+	}
+	return func(config *tls.Config) {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}, nil
+}
+
+// FilterProvider is a FilterProvider of the metrics server which requires
+// requests to be authenticated, with a verified client certificate or a
+// bearer token reviewed by the API server, and authorized by a
+// SubjectAccessReview of their non-resource URL, e.g. get /metrics, as
+// kube-rbac-proxy does.
+func FilterProvider(config *rest.Config, httpClient *http.Client) (metricsserver.Filter, error) {
+	authenticationClient, err := authenticationv1client.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	authorizationClient, err := authorizationv1client.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &authenticator{
+		tokenReviews:  authenticationClient.TokenReviews(),
+		accessReviews: authorizationClient.SubjectAccessReviews(),
+	}
+	return a.filter, nil
+}
+
+type authenticator struct {
+	tokenReviews  authenticationv1client.TokenReviewInterface
+	accessReviews authorizationv1client.SubjectAccessReviewInterface
+}
+
+func (a *authenticator) filter(log logr.Logger, handler http.Handler) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		user, err := a.authenticate(ctx, r)
+		if err != nil {
+			log.Error(err, "Error authenticating a request to the metrics server")
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		allowed, reason, err := a.authorize(ctx, user, r)
+		if err != nil {
+			log.Error(err, "Error authorizing a request to the metrics server", "user", user.Username)
+			http.Error(w, "Authorization failed", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			log.V(4).Info("Forbidden request to the metrics server", "user", user.Username, "path", r.URL.Path, "reason", reason)
+			http.Error(w, fmt.Sprintf("Forbidden (user=%s, verb=%s, resource=, subresource=)", user.Username, verb(r)), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// authenticate returns the user of the request, or nil if the request isn't
+// authenticated. The user of a client certificate is its common name, and
+// its groups are its organizations.
+func (a *authenticator) authenticate(ctx context.Context, r *http.Request) (*authenticationv1.UserInfo, error) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		if cert.Subject.CommonName != "" {
+			return &authenticationv1.UserInfo{Username: cert.Subject.CommonName, Groups: cert.Subject.Organization}, nil
+		}
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return nil, nil
+	}
+	review, err := a.tokenReviews.Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error reviewing token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, nil
+	}
+	return &review.Status.User, nil
+}
+
+// authorize returns true if the user is allowed the verb of the request on
+// its non-resource URL, and otherwise the reason it is not.
+func (a *authenticator) authorize(ctx context.Context, user *authenticationv1.UserInfo, r *http.Request) (bool, string, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	review, err := a.accessReviews.Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: verb(r),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("error reviewing access: %w", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// verb returns the verb of a request to a non-resource URL.
+func verb(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return strings.ToLower(r.Method)
+}
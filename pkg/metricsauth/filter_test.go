@@ -0,0 +1,99 @@
+package metricsauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type fakeTokenReviews struct {
+	users map[string]string
+}
+
+func (f *fakeTokenReviews) Create(_ context.Context, review *authenticationv1.TokenReview, _ metav1.CreateOptions) (*authenticationv1.TokenReview, error) {
+	if user, ok := f.users[review.Spec.Token]; ok {
+		review.Status.Authenticated = true
+		review.Status.User = authenticationv1.UserInfo{Username: user}
+	}
+	return review, nil
+}
+
+type fakeAccessReviews struct {
+	allowed map[string]bool
+	reviews []authorizationv1.SubjectAccessReviewSpec
+}
+
+func (f *fakeAccessReviews) Create(_ context.Context, review *authorizationv1.SubjectAccessReview, _ metav1.CreateOptions) (*authorizationv1.SubjectAccessReview, error) {
+	f.reviews = append(f.reviews, review.Spec)
+	review.Status.Allowed = f.allowed[review.Spec.User]
+	return review, nil
+}
+
+func TestFilter(t *testing.T) {
+	accessReviews := &fakeAccessReviews{allowed: map[string]bool{
+		"system:serviceaccount:openshift-monitoring:prometheus-k8s": true,
+		"prometheus": true,
+	}}
+	a := &authenticator{
+		tokenReviews: &fakeTokenReviews{users: map[string]string{
+			"prometheus-token": "system:serviceaccount:openshift-monitoring:prometheus-k8s",
+			"other-token":      "system:serviceaccount:default:default",
+		}},
+		accessReviews: accessReviews,
+	}
+	handler, err := a.filter(logr.Discard(), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+		Subject: pkix.Name{CommonName: "prometheus", Organization: []string{"monitoring"}},
+	}}}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		tls           *tls.ConnectionState
+		expected      int
+	}{
+		{name: "no credentials", expected: http.StatusUnauthorized},
+		{name: "invalid token", authorization: "Bearer invalid", expected: http.StatusUnauthorized},
+		{name: "allowed token", authorization: "Bearer prometheus-token", expected: http.StatusOK},
+		{name: "forbidden token", authorization: "Bearer other-token", expected: http.StatusForbidden},
+		{name: "client certificate", tls: clientCert, expected: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			request.TLS = tt.tls
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, recorder.Code)
+			}
+		})
+	}
+
+	for _, review := range accessReviews.reviews {
+		if review.NonResourceAttributes == nil || review.NonResourceAttributes.Path != "/metrics" || review.NonResourceAttributes.Verb != "get" {
+			t.Errorf("Expected access to get /metrics to be reviewed, got %v", review.NonResourceAttributes)
+		}
+		if review.User == "prometheus" && (len(review.Groups) != 1 || review.Groups[0] != "monitoring") {
+			t.Errorf("Expected the organizations of the client certificate as groups, got %v", review.Groups)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package preflight checks, before any machine is reconciled, that the
+// credentials of the clouds used by MachineSets are allowed to use every
+// OpenStack API which the provider needs.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/gophercloud/gophercloud"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+// Cloud identifies a cloud in a clouds secret.
+type Cloud struct {
+	SecretNamespace string
+	SecretName      string
+	Name            string
+}
+
+func (c Cloud) String() string {
+	return fmt.Sprintf("cloud %s of secret %s/%s", c.Name, c.SecretNamespace, c.SecretName)
+}
+
+// Result is the result of a check of a cloud.
+type Result struct {
+	Cloud Cloud
+	Check string
+	Err   error
+}
+
+// cloudChecker returns the API checks of a cloud.
+type cloudChecker func(cloud Cloud) ([]clients.APICheck, error)
+
+// Run checks the clouds of the MachineSets in namespace, or in all namespaces
+// if it is empty.
+func Run(ctx context.Context, c client.Client, kubeClient kubernetes.Interface, namespace string) ([]Result, error) {
+	machineSets := &machinev1.MachineSetList{}
+	if err := c.List(ctx, machineSets, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list MachineSets: %w", err)
+	}
+
+	clouds, err := machineSetClouds(machineSets.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert := clients.GetCACertificate(kubeClient)
+	return check(clouds, func(cloud Cloud) ([]clients.APICheck, error) {
+		cloudConfig, err := clients.GetCloudFromSecret(kubeClient, cloud.SecretNamespace, cloud.SecretName, cloud.Name)
+		if err != nil {
+			return nil, err
+		}
+		instanceService, err := clients.NewInstanceServiceFromCloud(ctx, cloudConfig, caCert)
+		if err != nil {
+			return nil, err
+		}
+		return instanceService.APIChecks(), nil
+	}), nil
+}
+
+// machineSetClouds returns the clouds used by the MachineSets, sorted and
+// without duplicates.
+func machineSetClouds(machineSets []machinev1.MachineSet) ([]Cloud, error) {
+	seen := make(map[Cloud]bool)
+	var clouds []Cloud
+	for i := range machineSets {
+		machineSet := &machineSets[i]
+		machineSpec, err := clients.MachineSpecFromProviderSpec(machineSet.Spec.Template.Spec.ProviderSpec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get OpenStackProviderSpec from MachineSet %s/%s: %w", machineSet.Namespace, machineSet.Name, err)
+		}
+		if machineSpec.CloudsSecret == nil || machineSpec.CloudsSecret.Name == "" {
+			continue
+		}
+
+		cloud := Cloud{
+			SecretNamespace: machineSpec.CloudsSecret.Namespace,
+			SecretName:      machineSpec.CloudsSecret.Name,
+			Name:            machineSpec.CloudName,
+		}
+		if cloud.SecretNamespace == "" {
+			cloud.SecretNamespace = machineSet.Namespace
+		}
+		if !seen[cloud] {
+			seen[cloud] = true
+			clouds = append(clouds, cloud)
+		}
+	}
+
+	sort.Slice(clouds, func(i, j int) bool {
+		return clouds[i].String() < clouds[j].String()
+	})
+	return clouds, nil
+}
+
+// check runs the API checks of every cloud. A cloud whose checks can't be
+// created, e.g. because authentication fails, has a single failed result.
+func check(clouds []Cloud, checker cloudChecker) []Result {
+	var results []Result
+	for _, cloud := range clouds {
+		checks, err := checker(cloud)
+		if err != nil {
+			results = append(results, Result{Cloud: cloud, Check: "authenticate", Err: err})
+			continue
+		}
+		for _, c := range checks {
+			results = append(results, Result{Cloud: cloud, Check: c.Name, Err: c.Run()})
+		}
+	}
+	return results
+}
+
+// Report writes the results to w, explaining errors which mean that the
+// credentials lack a role. It returns false if any check failed.
+func Report(w io.Writer, results []Result) bool {
+	ok := true
+	for _, result := range results {
+		if result.Err == nil {
+			fmt.Fprintf(w, "OK     %s: %s\n", result.Cloud, result.Check)
+			continue
+		}
+		ok = false
+		fmt.Fprintf(w, "FAILED %s: %s: %s\n", result.Cloud, result.Check, describe(result.Err))
+	}
+	return ok
+}
+
+// describe returns the error, with a hint if it means that the policies of
+// the cloud don't allow the call.
+func describe(err error) string {
+	var forbidden gophercloud.ErrDefault403
+	if errors.As(err, &forbidden) {
+		return fmt.Sprintf("%v (the credentials are missing a role which the policy of the API requires)", err)
+	}
+	var unauthorized gophercloud.ErrDefault401
+	if errors.As(err, &unauthorized) {
+		return fmt.Sprintf("%v (the credentials are not valid)", err)
+	}
+	return err.Error()
+}
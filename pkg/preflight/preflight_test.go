@@ -0,0 +1,97 @@
+package preflight
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	machinev1alpha1 "github.com/openshift/api/machine/v1alpha1"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+func newMachineSet(t *testing.T, name string, cloudsSecret *corev1.SecretReference, cloudName string) machinev1.MachineSet {
+	t.Helper()
+	raw, err := json.Marshal(&machinev1alpha1.OpenstackProviderSpec{CloudsSecret: cloudsSecret, CloudName: cloudName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	machineSet := machinev1.MachineSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openshift-machine-api"}}
+	machineSet.Spec.Template.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: raw}
+	return machineSet
+}
+
+func TestMachineSetClouds(t *testing.T) {
+	machineSets := []machinev1.MachineSet{
+		newMachineSet(t, "worker-b", &corev1.SecretReference{Name: "openstack-cloud-credentials"}, "openstack"),
+		newMachineSet(t, "worker-a", &corev1.SecretReference{Name: "openstack-cloud-credentials", Namespace: "openshift-machine-api"}, "openstack"),
+		newMachineSet(t, "edge", &corev1.SecretReference{Name: "edge-credentials"}, "edge"),
+		newMachineSet(t, "no-secret", nil, "openstack"),
+	}
+
+	clouds, err := machineSetClouds(machineSets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Cloud{
+		{SecretNamespace: "openshift-machine-api", SecretName: "edge-credentials", Name: "edge"},
+		{SecretNamespace: "openshift-machine-api", SecretName: "openstack-cloud-credentials", Name: "openstack"},
+	}
+	if !reflect.DeepEqual(clouds, expected) {
+		t.Errorf("Expected clouds %v, got %v", expected, clouds)
+	}
+}
+
+func TestCheckAndReport(t *testing.T) {
+	good := Cloud{SecretNamespace: "openshift-machine-api", SecretName: "openstack-cloud-credentials", Name: "openstack"}
+	restricted := Cloud{SecretNamespace: "openshift-machine-api", SecretName: "restricted-credentials", Name: "openstack"}
+	invalid := Cloud{SecretNamespace: "openshift-machine-api", SecretName: "invalid-credentials", Name: "openstack"}
+
+	forbidden := gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: 403}}
+	results := check([]Cloud{good, restricted, invalid}, func(cloud Cloud) ([]clients.APICheck, error) {
+		switch cloud {
+		case good:
+			return []clients.APICheck{
+				{Name: "list servers", Run: func() error { return nil }},
+				{Name: "list ports", Run: func() error { return nil }},
+			}, nil
+		case restricted:
+			return []clients.APICheck{
+				{Name: "list servers", Run: func() error { return nil }},
+				{Name: "list ports", Run: func() error { return forbidden }},
+			}, nil
+		default:
+			return nil, errors.New("authentication failed")
+		}
+	})
+
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.Cloud.SecretName+": "+result.Check)
+		}
+	}
+	expectedFailed := []string{"restricted-credentials: list ports", "invalid-credentials: authenticate"}
+	if len(results) != 5 || !reflect.DeepEqual(failed, expectedFailed) {
+		t.Errorf("Expected 5 results with failures %v, got %v", expectedFailed, results)
+	}
+
+	var out strings.Builder
+	if Report(&out, results) {
+		t.Errorf("Expected the report to fail")
+	}
+	if !strings.Contains(out.String(), "missing a role") {
+		t.Errorf("Expected the report to explain the forbidden call, got:\n%s", out.String())
+	}
+
+	if !Report(&out, results[:2]) {
+		t.Errorf("Expected the report of successful checks to pass")
+	}
+}
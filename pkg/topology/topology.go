@@ -0,0 +1,64 @@
+// Package topology discovers the availability zones in which machines can be
+// created with the credentials of each MachineSet, so that tools such as the
+// control-plane-machine-set operator can offer valid failure domains.
+package topology
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Topology is the availability zones of a cloud.
+type Topology struct {
+	// ComputeZones are the available compute availability zones.
+	ComputeZones []string `json:"computeZones"`
+
+	// VolumeZones are the available block storage availability zones. They
+	// are omitted if the cloud has no block storage service.
+	VolumeZones []string `json:"volumeZones,omitempty"`
+
+	// Zones are the compute availability zones which are also block storage
+	// availability zones, in which machines can have root volumes in the
+	// same availability zone as their server. If the cloud has no block
+	// storage service they are the compute availability zones.
+	Zones []string `json:"zones"`
+
+	// Message describes why the availability zones could not be discovered.
+	Message string `json:"message,omitempty"`
+
+	// LastUpdated is when the availability zones were discovered.
+	LastUpdated time.Time `json:"lastUpdated"`
+}
+
+// zoneService is the part of clients.InstanceService which lists
+// availability zones.
+type zoneService interface {
+	ListAvailabilityZones() ([]string, error)
+	ListVolumeAvailabilityZones() ([]string, bool, error)
+}
+
+// Discover lists the availability zones of a cloud.
+func Discover(service zoneService) Topology {
+	topology := Topology{LastUpdated: time.Now()}
+
+	computeZones, err := service.ListAvailabilityZones()
+	if err != nil {
+		topology.Message = fmt.Sprintf("unable to list compute availability zones: %v", err)
+		return topology
+	}
+	volumeZones, hasVolumeService, err := service.ListVolumeAvailabilityZones()
+	if err != nil {
+		topology.Message = fmt.Sprintf("unable to list block storage availability zones: %v", err)
+		return topology
+	}
+
+	topology.ComputeZones = sets.List(sets.New(computeZones...))
+	topology.Zones = topology.ComputeZones
+	if hasVolumeService {
+		topology.VolumeZones = sets.List(sets.New(volumeZones...))
+		topology.Zones = sets.List(sets.New(computeZones...).Intersection(sets.New(volumeZones...)))
+	}
+	return topology
+}
@@ -0,0 +1,74 @@
+package topology
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fakeZoneService struct {
+	computeZones     []string
+	volumeZones      []string
+	hasVolumeService bool
+	err              error
+}
+
+func (f *fakeZoneService) ListAvailabilityZones() ([]string, error) {
+	return f.computeZones, f.err
+}
+
+func (f *fakeZoneService) ListVolumeAvailabilityZones() ([]string, bool, error) {
+	return f.volumeZones, f.hasVolumeService, nil
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  *fakeZoneService
+		expected Topology
+	}{
+		{
+			name: "compute and volume zones",
+			service: &fakeZoneService{
+				computeZones:     []string{"az2", "az1", "az3"},
+				volumeZones:      []string{"az3", "az1", "nova"},
+				hasVolumeService: true,
+			},
+			expected: Topology{
+				ComputeZones: []string{"az1", "az2", "az3"},
+				VolumeZones:  []string{"az1", "az3", "nova"},
+				Zones:        []string{"az1", "az3"},
+			},
+		},
+		{
+			name: "no block storage service",
+			service: &fakeZoneService{
+				computeZones: []string{"az2", "az1"},
+			},
+			expected: Topology{
+				ComputeZones: []string{"az1", "az2"},
+				Zones:        []string{"az1", "az2"},
+			},
+		},
+		{
+			name:    "error",
+			service: &fakeZoneService{err: errors.New("forbidden")},
+			expected: Topology{
+				Message: "unable to list compute availability zones: forbidden",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topology := Discover(tt.service)
+			if topology.LastUpdated.IsZero() {
+				t.Errorf("expected LastUpdated to be set")
+			}
+			topology.LastUpdated = tt.expected.LastUpdated
+			if !reflect.DeepEqual(topology, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, topology)
+			}
+		})
+	}
+}
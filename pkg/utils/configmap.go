@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// WriteConfigMapKey sets key of the ConfigMap name to the value returned by
+// value for its previous value, which is empty if the key isn't set, and
+// creates the ConfigMap if it doesn't exist. Keys which aren't in keys are
+// removed, so that the keys of e.g. clouds which are no longer used don't
+// stay forever. With an empty key, only those keys are removed.
+//
+// The ConfigMaps are written by several reconciles at once, so an update
+// which conflicts with another one is retried with the latest ConfigMap, and
+// value is called again.
+func WriteConfigMapKey(ctx context.Context, configMaps typedcorev1.ConfigMapInterface, name, key string, keys sets.Set[string], value func(previous string) (string, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if key == "" {
+				return nil
+			}
+			data, err := value("")
+			if err != nil {
+				return err
+			}
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Data:       map[string]string{key: data},
+			}
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created by another reconcile in the meantime
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for k := range configMap.Data {
+			if k != key && !keys.Has(k) {
+				delete(configMap.Data, k)
+				changed = true
+			}
+		}
+		if key != "" {
+			data, err := value(configMap.Data[key])
+			if err != nil {
+				return err
+			}
+			if previous, ok := configMap.Data[key]; !ok || previous != data {
+				if configMap.Data == nil {
+					configMap.Data = make(map[string]string)
+				}
+				configMap.Data[key] = data
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeConfigMaps holds a single ConfigMap, and fails the first conflicts
+// updates with a conflict.
+type fakeConfigMaps struct {
+	typedcorev1.ConfigMapInterface
+
+	configMap *corev1.ConfigMap
+	conflicts int
+	updates   int
+}
+
+func (f *fakeConfigMaps) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.ConfigMap, error) {
+	if f.configMap == nil {
+		return nil, apierrors.NewNotFound(corev1.Resource("configmaps"), name)
+	}
+	return f.configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Create(_ context.Context, configMap *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	if f.configMap != nil {
+		return nil, apierrors.NewAlreadyExists(corev1.Resource("configmaps"), configMap.Name)
+	}
+	f.configMap = configMap.DeepCopy()
+	return configMap, nil
+}
+
+func (f *fakeConfigMaps) Update(_ context.Context, configMap *corev1.ConfigMap, _ metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	f.updates++
+	if f.conflicts > 0 {
+		f.conflicts--
+		// Another reconcile wrote its key in the meantime
+		f.configMap.Data["other"] = "written"
+		return nil, apierrors.NewConflict(corev1.Resource("configmaps"), configMap.Name, nil)
+	}
+	f.configMap = configMap.DeepCopy()
+	return configMap, nil
+}
+
+func TestWriteConfigMapKey(t *testing.T) {
+	ctx := context.Background()
+	configMaps := &fakeConfigMaps{}
+	write := func(key string, keys sets.Set[string], value string) {
+		t.Helper()
+		err := WriteConfigMapKey(ctx, configMaps, "status", key, keys, func(string) (string, error) { return value, nil })
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expectData := func(expected map[string]string) {
+		t.Helper()
+		if !reflect.DeepEqual(configMaps.configMap.Data, expected) {
+			t.Errorf("Expected data %v, got %v", expected, configMaps.configMap.Data)
+		}
+	}
+
+	// The ConfigMap is created
+	write("cloud-a", sets.New("cloud-a", "cloud-b"), "a")
+	expectData(map[string]string{"cloud-a": "a"})
+
+	// Conflicting updates are retried with the latest ConfigMap
+	configMaps.conflicts = 1
+	write("cloud-b", sets.New("cloud-a", "cloud-b", "other"), "b")
+	expectData(map[string]string{"cloud-a": "a", "cloud-b": "b", "other": "written"})
+
+	// Unchanged values aren't updated
+	updates := configMaps.updates
+	write("cloud-b", sets.New("cloud-a", "cloud-b", "other"), "b")
+	if configMaps.updates != updates {
+		t.Errorf("Expected no update")
+	}
+
+	// Stale keys are removed
+	write("cloud-b", sets.New("cloud-b"), "b")
+	expectData(map[string]string{"cloud-b": "b"})
+	write("", sets.New[string](), "")
+	expectData(map[string]string{})
+
+	// The previous value is passed on
+	write("cloud-a", sets.New("cloud-a"), "a3")
+	var previous string
+	err := WriteConfigMapKey(ctx, configMaps, "status", "cloud-a", sets.New("cloud-a"), func(p string) (string, error) {
+		previous = p
+		return p, nil
+	})
+	if err != nil || previous != "a3" {
+		t.Errorf("Expected the previous value a3, got %q and %v", previous, err)
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	maoMachine "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-operator/pkg/util/conditions"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// MachinePausedReason returns why machine must not be reconciled by the
+// provider, or an empty string if it may be. See pausedReason.
+func MachinePausedReason(machine *machinev1.Machine) string {
+	return pausedReason(machine.Status.AuthoritativeAPI, conditions.Get(machine, maoMachine.PausedCondition))
+}
+
+// MachineSetPausedReason returns why machineSet must not be reconciled by the
+// provider, or an empty string if it may be. See pausedReason.
+func MachineSetPausedReason(machineSet *machinev1.MachineSet) string {
+	return pausedReason(machineSet.Status.AuthoritativeAPI, conditions.Get(machineSet, maoMachine.PausedCondition))
+}
+
+// pausedReason returns why a resource with the given authoritative API and
+// Paused condition must not be reconciled, or an empty string if it may be.
+// Resources are paused while Cluster API is their authoritative API, while
+// they are migrating between the two APIs and while the Machine API operator
+// marks them as paused, so that the provider and CAPO never manage the same
+// servers. The authoritative API is unset on clusters without the migration,
+// where resources are never paused by it.
+func pausedReason(authoritativeAPI machinev1.MachineAuthority, paused *machinev1.Condition) string {
+	if authoritativeAPI != "" && authoritativeAPI != machinev1.MachineAuthorityMachineAPI {
+		return fmt.Sprintf("the authoritative API is %s", authoritativeAPI)
+	}
+	if paused != nil && paused.Status == corev1.ConditionTrue {
+		if paused.Message != "" {
+			return fmt.Sprintf("it is paused: %s", paused.Message)
+		}
+		return "it is paused"
+	}
+	return ""
+}
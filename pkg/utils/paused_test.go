@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMachinePausedReason(t *testing.T) {
+	tests := []struct {
+		name             string
+		authoritativeAPI machinev1.MachineAuthority
+		conditions       []machinev1.Condition
+		expected         string
+	}{
+		{
+			name: "no migration",
+		},
+		{
+			name:             "machine API",
+			authoritativeAPI: machinev1.MachineAuthorityMachineAPI,
+			conditions:       []machinev1.Condition{{Type: "Paused", Status: corev1.ConditionFalse}},
+		},
+		{
+			name:             "cluster API",
+			authoritativeAPI: machinev1.MachineAuthorityClusterAPI,
+			expected:         "the authoritative API is ClusterAPI",
+		},
+		{
+			name:             "migrating",
+			authoritativeAPI: machinev1.MachineAuthorityMigrating,
+			expected:         "the authoritative API is Migrating",
+		},
+		{
+			name:       "paused condition",
+			conditions: []machinev1.Condition{{Type: "Paused", Status: corev1.ConditionTrue, Message: "The AuthoritativeAPI is set to ClusterAPI"}},
+			expected:   "it is paused: The AuthoritativeAPI is set to ClusterAPI",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := &machinev1.Machine{Status: machinev1.MachineStatus{AuthoritativeAPI: tt.authoritativeAPI, Conditions: tt.conditions}}
+			if actual := MachinePausedReason(machine); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMachineSetPausedReason(t *testing.T) {
+	machineSet := &machinev1.MachineSet{}
+	if actual := MachineSetPausedReason(machineSet); actual != "" {
+		t.Errorf("Expected the MachineSet not to be paused, got %q", actual)
+	}
+
+	machineSet.Status.AuthoritativeAPI = machinev1.MachineAuthorityClusterAPI
+	if actual := MachineSetPausedReason(machineSet); actual != "the authoritative API is ClusterAPI" {
+		t.Errorf("Expected the MachineSet to be paused, got %q", actual)
+	}
+}
@@ -0,0 +1,245 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+)
+
+const (
+	// defaultCloudName is the cloud of the clouds secret created by the
+	// installer.
+	defaultCloudName = "openstack"
+
+	// defaultCloudsSecretName is the name of the clouds secret created by
+	// the installer.
+	defaultCloudsSecretName = "openstack-cloud-credentials"
+
+	// machineRoleLabel is the label with the role of the machines of the
+	// installer, e.g. master or worker.
+	machineRoleLabel = "machine.openshift.io/cluster-api-machine-role"
+
+	// trunkCacheTTL is how long the trunk support of a cloud is cached, so
+	// that clouds which enable trunks are picked up.
+	trunkCacheTTL = time.Hour
+)
+
+// trunkLookupTimeout is how long admission waits for the trunk support of a
+// cloud, well within the timeout of the webhook. A lookup which takes longer
+// goes on in the background, and its result is used by later admissions.
+var trunkLookupTimeout = 5 * time.Second
+
+// ProviderSpecDefaulter fills in the fields of the OpenStack providerSpecs of
+// new Machines and MachineSets which are left out, with the values the
+// installer would give them.
+type ProviderSpecDefaulter struct {
+	KubeClient kubernetes.Interface
+
+	// lookupTrunk returns whether the cloud of a machine supports trunk
+	// ports. It is lookupTrunkSupport if nil.
+	lookupTrunk func(*machinev1.Machine) (bool, error)
+
+	trunksMu sync.Mutex
+	trunks   map[trunkCacheKey]*trunkLookup
+}
+
+// trunkCacheKey identifies the cloud of a machine.
+type trunkCacheKey struct {
+	secretNamespace string
+	secretName      string
+	cloud           string
+}
+
+// trunkLookup is a lookup of the trunk support of a cloud. Its result is set
+// when done is closed.
+type trunkLookup struct {
+	done      chan struct{}
+	supported bool
+	err       error
+	expires   time.Time
+}
+
+// expired returns true if the lookup is done, and either failed or is older
+// than trunkCacheTTL.
+func (l *trunkLookup) expired(now time.Time) bool {
+	select {
+	case <-l.done:
+		return l.err != nil || now.After(l.expires)
+	default:
+		return false
+	}
+}
+
+var _ admission.CustomDefaulter = &ProviderSpecDefaulter{}
+
+// SetupWebhookWithManager registers the webhooks for Machines and MachineSets
+// with the webhook server of mgr.
+func (d *ProviderSpecDefaulter) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	if err := ctrl.NewWebhookManagedBy(mgr).For(&machinev1.Machine{}).WithDefaulter(d).Complete(); err != nil {
+		return err
+	}
+	return ctrl.NewWebhookManagedBy(mgr).For(&machinev1.MachineSet{}).WithDefaulter(d).Complete()
+}
+
+// Default fills in the providerSpec of a Machine or MachineSet which is being
+// created. Existing objects are left alone, so that the providerSpecs of
+// their machines don't change.
+func (d *ProviderSpecDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation != admissionv1.Create {
+		return nil
+	}
+
+	var m *machinev1.Machine
+	var providerSpec *machinev1.ProviderSpec
+	switch o := obj.(type) {
+	case *machinev1.Machine:
+		m, providerSpec = o, &o.Spec.ProviderSpec
+	case *machinev1.MachineSet:
+		m, providerSpec = templateMachine(o), &o.Spec.Template.Spec.ProviderSpec
+	default:
+		return fmt.Errorf("expected a Machine or MachineSet, got %T", obj)
+	}
+	if !isOpenstackProviderSpec(*providerSpec) {
+		return nil
+	}
+
+	raw, err := defaultProviderSpec(providerSpec.Value.Raw, m, func(m *machinev1.Machine) (bool, error) {
+		return d.trunkSupported(ctx, m)
+	})
+	if err != nil {
+		return fmt.Errorf("error defaulting providerSpec: %w", err)
+	}
+	providerSpec.Value.Raw = raw
+	return nil
+}
+
+// trunkSupported returns true if the cloud of the machine supports trunk
+// ports. The result is cached per cloud, and concurrent admissions share a
+// lookup. It returns an error if the lookup takes longer than
+// trunkLookupTimeout.
+func (d *ProviderSpecDefaulter) trunkSupported(ctx context.Context, m *machinev1.Machine) (bool, error) {
+	machineSpec, err := clients.MachineSpecFromProviderSpec(m.Spec.ProviderSpec)
+	if err != nil {
+		return false, err
+	}
+	key := trunkCacheKey{cloud: machineSpec.CloudName}
+	if machineSpec.CloudsSecret != nil {
+		key.secretNamespace, key.secretName = machineSpec.CloudsSecret.Namespace, machineSpec.CloudsSecret.Name
+	}
+
+	lookup := d.trunkLookup(key, m)
+
+	ctx, cancel := context.WithTimeout(ctx, trunkLookupTimeout)
+	defer cancel()
+	select {
+	case <-lookup.done:
+		return lookup.supported, lookup.err
+	case <-ctx.Done():
+		return false, fmt.Errorf("trunk support of cloud %s is unknown: %w", key.cloud, ctx.Err())
+	}
+}
+
+// trunkLookup returns the current lookup of the trunk support of the cloud
+// with key, or starts one with machine m.
+func (d *ProviderSpecDefaulter) trunkLookup(key trunkCacheKey, m *machinev1.Machine) *trunkLookup {
+	d.trunksMu.Lock()
+	defer d.trunksMu.Unlock()
+
+	if lookup, ok := d.trunks[key]; ok && !lookup.expired(time.Now()) {
+		return lookup
+	}
+
+	lookupTrunk := d.lookupTrunk
+	if lookupTrunk == nil {
+		lookupTrunk = d.lookupTrunkSupport
+	}
+	lookup := &trunkLookup{done: make(chan struct{})}
+	go func() {
+		lookup.supported, lookup.err = lookupTrunk(m)
+		lookup.expires = time.Now().Add(trunkCacheTTL)
+		close(lookup.done)
+	}()
+
+	if d.trunks == nil {
+		d.trunks = make(map[trunkCacheKey]*trunkLookup)
+	}
+	d.trunks[key] = lookup
+	return lookup
+}
+
+// lookupTrunkSupport returns true if the cloud of the machine supports trunk
+// ports. It outlives the admission which started it, so its requests are only
+// bounded by the API timeout.
+func (d *ProviderSpecDefaulter) lookupTrunkSupport(m *machinev1.Machine) (bool, error) {
+	instanceService, err := clients.NewInstanceServiceFromMachine(context.Background(), d.KubeClient, m)
+	if err != nil {
+		return false, err
+	}
+	return instanceService.HasNetworkExtension("trunk")
+}
+
+// defaultProviderSpec returns the providerSpec of machine m, raw, with the
+// fields it leaves out filled in, like the installer does: the kind, the
+// cloud and clouds secret created by the installer, trunk ports if the cloud
+// supports them, and, if the machine has a cluster ID label, the security
+// group of its role and the tag of its cluster. Fields of the providerSpec,
+// including those which are set to their zero value, are never changed. If
+// support for trunks can't be checked, trunk is left out.
+func defaultProviderSpec(raw []byte, m *machinev1.Machine, trunkSupported func(*machinev1.Machine) (bool, error)) ([]byte, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	setDefault := func(key string, value interface{}) {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+
+	setDefault("apiVersion", "machine.openshift.io/v1alpha1")
+	setDefault("kind", providerSpecKind)
+	setDefault("cloudName", defaultCloudName)
+	setDefault("cloudsSecret", map[string]interface{}{"name": defaultCloudsSecretName, "namespace": m.Namespace})
+
+	if clusterID := m.Labels[machinev1.MachineClusterIDLabel]; clusterID != "" {
+		// Infra machines use the security group of the workers
+		role := "worker"
+		if m.Labels[machineRoleLabel] == "master" {
+			role = "master"
+		}
+		setDefault("securityGroups", []interface{}{map[string]interface{}{"name": clusterID + "-" + role}})
+		setDefault("tags", []interface{}{"openshiftClusterID=" + clusterID})
+	}
+
+	if _, ok := fields["trunk"]; !ok {
+		// The cloud is looked up with the defaulted clouds secret
+		defaulted, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		lookup := m.DeepCopy()
+		lookup.Spec.ProviderSpec.Value = &runtime.RawExtension{Raw: defaulted}
+		if trunk, err := trunkSupported(lookup); err != nil {
+			klog.Warningf("Not defaulting trunk of the providerSpec of %s: %v", m.Name, err)
+		} else {
+			fields["trunk"] = trunk
+		}
+	}
+
+	return json.Marshal(fields)
+}
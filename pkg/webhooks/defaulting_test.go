@@ -0,0 +1,164 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDefaultProviderSpec(t *testing.T) {
+	trunkSupported := func(*machinev1.Machine) (bool, error) {
+		return true, nil
+	}
+	cloudUnavailable := func(*machinev1.Machine) (bool, error) {
+		return false, errors.New("connection refused")
+	}
+
+	tests := []struct {
+		name           string
+		providerSpec   string
+		labels         map[string]string
+		trunkSupported func(*machinev1.Machine) (bool, error)
+		expected       string
+	}{
+		{
+			name:           "sparse",
+			providerSpec:   `{"flavor":"m1.large","image":"rhcos"}`,
+			labels:         map[string]string{machinev1.MachineClusterIDLabel: "ocp-x7k2p", machineRoleLabel: "infra"},
+			trunkSupported: trunkSupported,
+			expected: `{"apiVersion":"machine.openshift.io/v1alpha1","kind":"OpenstackProviderSpec","cloudName":"openstack",` +
+				`"cloudsSecret":{"name":"openstack-cloud-credentials","namespace":"openshift-machine-api"},"flavor":"m1.large","image":"rhcos",` +
+				`"securityGroups":[{"name":"ocp-x7k2p-worker"}],"tags":["openshiftClusterID=ocp-x7k2p"],"trunk":true}`,
+		},
+		{
+			name:           "control plane",
+			providerSpec:   `{"flavor":"m1.large","image":"rhcos","trunk":false}`,
+			labels:         map[string]string{machinev1.MachineClusterIDLabel: "ocp-x7k2p", machineRoleLabel: "master"},
+			trunkSupported: cloudUnavailable,
+			expected: `{"apiVersion":"machine.openshift.io/v1alpha1","kind":"OpenstackProviderSpec","cloudName":"openstack",` +
+				`"cloudsSecret":{"name":"openstack-cloud-credentials","namespace":"openshift-machine-api"},"flavor":"m1.large","image":"rhcos",` +
+				`"securityGroups":[{"name":"ocp-x7k2p-master"}],"tags":["openshiftClusterID=ocp-x7k2p"],"trunk":false}`,
+		},
+		{
+			name:           "set fields are kept",
+			providerSpec:   `{"cloudName":"edge","cloudsSecret":{"name":"edge-credentials"},"securityGroups":[],"tags":null,"serverGroupPolicy":"anti-affinity"}`,
+			labels:         map[string]string{machinev1.MachineClusterIDLabel: "ocp-x7k2p"},
+			trunkSupported: trunkSupported,
+			expected: `{"apiVersion":"machine.openshift.io/v1alpha1","kind":"OpenstackProviderSpec","cloudName":"edge",` +
+				`"cloudsSecret":{"name":"edge-credentials"},"securityGroups":[],"serverGroupPolicy":"anti-affinity","tags":null,"trunk":true}`,
+		},
+		{
+			name:           "no cluster ID and unavailable cloud",
+			providerSpec:   `{}`,
+			trunkSupported: cloudUnavailable,
+			expected: `{"apiVersion":"machine.openshift.io/v1alpha1","kind":"OpenstackProviderSpec","cloudName":"openstack",` +
+				`"cloudsSecret":{"name":"openstack-cloud-credentials","namespace":"openshift-machine-api"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api", Labels: tt.labels}}
+			raw, err := defaultProviderSpec([]byte(tt.providerSpec), m, tt.trunkSupported)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual, expected interface{}
+			if err := json.Unmarshal(raw, &actual); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, raw)
+			}
+		})
+	}
+}
+
+func TestProviderSpecDefaulterDefault(t *testing.T) {
+	providerSpec := `{"kind":"OpenstackProviderSpec","flavor":"m1.large","image":"rhcos"}`
+
+	// Existing machines are left alone
+	m := machineWithProviderSpec(providerSpec)
+	ctx := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update},
+	})
+	if err := (&ProviderSpecDefaulter{}).Default(ctx, m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if raw := string(m.Spec.ProviderSpec.Value.Raw); raw != providerSpec {
+		t.Errorf("Expected the providerSpec to be unchanged, got %s", raw)
+	}
+
+	// Other providers are left alone
+	m = machineWithProviderSpec(`{"kind":"AWSMachineProviderConfig"}`)
+	if err := (&ProviderSpecDefaulter{}).Default(context.Background(), m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if raw := string(m.Spec.ProviderSpec.Value.Raw); raw != `{"kind":"AWSMachineProviderConfig"}` {
+		t.Errorf("Expected the providerSpec to be unchanged, got %s", raw)
+	}
+}
+
+func TestTrunkSupported(t *testing.T) {
+	defer func(timeout time.Duration) { trunkLookupTimeout = timeout }(trunkLookupTimeout)
+	trunkLookupTimeout = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	var lookups atomic.Int32
+	d := &ProviderSpecDefaulter{
+		lookupTrunk: func(*machinev1.Machine) (bool, error) {
+			lookups.Add(1)
+			<-release
+			return true, nil
+		},
+	}
+	m := machineWithProviderSpec(`{"kind":"OpenstackProviderSpec","cloudName":"openstack","cloudsSecret":{"name":"openstack-cloud-credentials"}}`)
+
+	// A slow lookup doesn't hold up admission
+	start := time.Now()
+	if _, err := d.trunkSupported(context.Background(), m); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the lookup to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected admission to wait for %s, waited %s", trunkLookupTimeout, elapsed)
+	}
+
+	// It goes on in the background, and its result is cached
+	close(release)
+	for range 2 {
+		if supported, err := d.trunkSupported(context.Background(), m); err != nil || !supported {
+			t.Errorf("Expected trunks to be supported, got %t and %v", supported, err)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("Expected the cloud to be looked up once, got %d lookups", n)
+	}
+
+	// Failed lookups are not cached
+	d = &ProviderSpecDefaulter{
+		lookupTrunk: func(*machinev1.Machine) (bool, error) {
+			lookups.Add(1)
+			return false, errors.New("connection refused")
+		},
+	}
+	lookups.Store(0)
+	for range 2 {
+		if _, err := d.trunkSupported(context.Background(), m); err == nil {
+			t.Errorf("Expected the lookup to fail")
+		}
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("Expected the cloud to be looked up again after a failure, got %d lookups", n)
+	}
+}
@@ -0,0 +1,188 @@
+// Package webhooks contains the admission webhooks for the Machines and
+// MachineSets with an OpenStack providerSpec.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/machine-api-provider-openstack/pkg/clients"
+	"github.com/openshift/machine-api-provider-openstack/pkg/machine"
+)
+
+// providerSpecKind is the kind of the providerSpecs which are validated.
+// ProviderSpecs of other kinds belong to other providers.
+const providerSpecKind = "OpenstackProviderSpec"
+
+// MachineValidator rejects Machines whose providerSpec is invalid.
+type MachineValidator struct{}
+
+// MachineSetValidator rejects MachineSets whose template has an invalid
+// providerSpec.
+type MachineSetValidator struct{}
+
+var (
+	_ admission.CustomValidator = &MachineValidator{}
+	_ admission.CustomValidator = &MachineSetValidator{}
+)
+
+// SetupWebhookWithManager registers the webhook with the webhook server of
+// mgr.
+func (v *MachineValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&machinev1.Machine{}).WithValidator(v).Complete()
+}
+
+// SetupWebhookWithManager registers the webhook with the webhook server of
+// mgr.
+func (v *MachineSetValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&machinev1.MachineSet{}).WithValidator(v).Complete()
+}
+
+func (v *MachineValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	m, ok := obj.(*machinev1.Machine)
+	if !ok {
+		return nil, fmt.Errorf("expected a Machine, got %T", obj)
+	}
+	return validateMachine(m)
+}
+
+// ValidateUpdate only validates the providerSpec if it changed, so that
+// Machines created before a check was added can still be updated, e.g. to
+// remove their finalizers.
+func (v *MachineValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldMachine, ok := oldObj.(*machinev1.Machine)
+	if !ok {
+		return nil, fmt.Errorf("expected a Machine, got %T", oldObj)
+	}
+	m, ok := newObj.(*machinev1.Machine)
+	if !ok {
+		return nil, fmt.Errorf("expected a Machine, got %T", newObj)
+	}
+	if m.DeletionTimestamp != nil || providerSpecEqual(oldMachine.Spec.ProviderSpec, m.Spec.ProviderSpec) {
+		return nil, nil
+	}
+	return validateMachine(m)
+}
+
+func (v *MachineValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *MachineSetValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	machineSet, ok := obj.(*machinev1.MachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a MachineSet, got %T", obj)
+	}
+	return validateMachine(templateMachine(machineSet))
+}
+
+// ValidateUpdate only validates the providerSpec if it changed, like
+// MachineValidator.ValidateUpdate.
+func (v *MachineSetValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldMachineSet, ok := oldObj.(*machinev1.MachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a MachineSet, got %T", oldObj)
+	}
+	machineSet, ok := newObj.(*machinev1.MachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a MachineSet, got %T", newObj)
+	}
+	if machineSet.DeletionTimestamp != nil || providerSpecEqual(oldMachineSet.Spec.Template.Spec.ProviderSpec, machineSet.Spec.Template.Spec.ProviderSpec) {
+		return nil, nil
+	}
+	return validateMachine(templateMachine(machineSet))
+}
+
+func (v *MachineSetValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// templateMachine returns a machine as the MachineSet would create it. Its
+// name is made up, since the names of the machines are generated.
+func templateMachine(machineSet *machinev1.MachineSet) *machinev1.Machine {
+	template := machineSet.Spec.Template
+	return &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        machineSet.Name + "-xxxxx",
+			Namespace:   machineSet.Namespace,
+			Labels:      template.ObjectMeta.Labels,
+			Annotations: template.ObjectMeta.Annotations,
+		},
+		Spec: template.Spec,
+	}
+}
+
+// providerSpecEqual returns true if both providerSpecs have the same value.
+func providerSpecEqual(a, b machinev1.ProviderSpec) bool {
+	if a.Value == nil || b.Value == nil {
+		return a.Value == b.Value
+	}
+	return bytes.Equal(a.Value.Raw, b.Value.Raw)
+}
+
+// isOpenstackProviderSpec returns true if providerSpec is an OpenStack
+// providerSpec. Its kind may be left out.
+func isOpenstackProviderSpec(providerSpec machinev1.ProviderSpec) bool {
+	if providerSpec.Value == nil {
+		return false
+	}
+	var typeMeta struct {
+		Kind string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(providerSpec.Value.Raw, &typeMeta); err != nil {
+		return true
+	}
+	return typeMeta.Kind == "" || typeMeta.Kind == providerSpecKind
+}
+
+// validateMachine returns the warnings about the providerSpec of m, and an
+// error if it is invalid. On top of the checks made before a machine is
+// created, settings which used to be silently ignored are rejected or warned
+// about, since existing machines aren't affected.
+func validateMachine(m *machinev1.Machine) (admission.Warnings, error) {
+	if !isOpenstackProviderSpec(m.Spec.ProviderSpec) {
+		return nil, nil
+	}
+	if m.Name == "" {
+		m = m.DeepCopy()
+		m.Name = m.GenerateName + "xxxxx"
+	}
+	if err := machine.ValidateProviderSpec(m); err != nil {
+		return nil, fmt.Errorf("invalid providerSpec: %v", err)
+	}
+
+	machineSpec, err := clients.MachineSpecFromProviderSpec(m.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := clients.ExtensionsFromProviderSpec(m.Spec.ProviderSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	// The UUID of a network takes precedence over the ID of its filter
+	for i, network := range machineSpec.Networks {
+		if network.UUID != "" && network.Filter.ID != "" && network.UUID != network.Filter.ID {
+			return nil, fmt.Errorf("invalid providerSpec: network %d has both uuid %s and filter.id %s", i, network.UUID, network.Filter.ID)
+		}
+	}
+
+	var warnings admission.Warnings
+	if machineSpec.ServerGroupName == "" {
+		if extensions.ServerGroupPolicy != "" {
+			warnings = append(warnings, "serverGroupPolicy has no effect without serverGroupName")
+		}
+		if extensions.ServerGroupScope != "" {
+			warnings = append(warnings, "serverGroupScope has no effect without serverGroupName")
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,136 @@
+package webhooks
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func machineWithProviderSpec(providerSpec string) *machinev1.Machine {
+	return &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Namespace: "openshift-machine-api"},
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{Value: &runtime.RawExtension{Raw: []byte(providerSpec)}},
+		},
+	}
+}
+
+func TestMachineValidatorValidateCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerSpec string
+		err          string
+		warnings     int
+	}{
+		{
+			name:         "valid",
+			providerSpec: `{"kind":"OpenstackProviderSpec","flavor":"m1.large","image":"rhcos","networks":[{"uuid":"a"}],"ports":[{"networkID":"b","nameSuffix":"storage"}]}`,
+		},
+		{
+			name:         "other provider",
+			providerSpec: `{"kind":"AWSMachineProviderConfig"}`,
+		},
+		{
+			name:         "root volume without image",
+			providerSpec: `{"flavor":"m1.large","rootVolume":{"sourceUUID":"rhcos","diskSize":30}}`,
+		},
+		{
+			name:         "no flavor",
+			providerSpec: `{"kind":"OpenstackProviderSpec","image":"rhcos"}`,
+			err:          "flavor is required",
+		},
+		{
+			name:         "no image",
+			providerSpec: `{"kind":"OpenstackProviderSpec","flavor":"m1.large"}`,
+			err:          "image is required",
+		},
+		{
+			name:         "port without network",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","ports":[{"nameSuffix":"storage"}]}`,
+			err:          "networkID of port 0 is required",
+		},
+		{
+			name:         "ports with the same name",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","ports":[{"networkID":"a","nameSuffix":"storage"},{"networkID":"b","nameSuffix":"storage"}]}`,
+			err:          `ports 0 and 1 have the same nameSuffix "storage"`,
+		},
+		{
+			name:         "network with conflicting IDs",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","networks":[{"uuid":"a","filter":{"id":"b"}}]}`,
+			err:          "network 0 has both uuid a and filter.id b",
+		},
+		{
+			name:         "conflicting server groups",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","serverGroupID":"a","schedulerHints":{"group":"b"}}`,
+			err:          "does not match serverGroupID a",
+		},
+		{
+			name:         "reservation which is not a UUID",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","reservationID":"gpu-hosts"}`,
+			err:          "reservationID gpu-hosts is not a UUID",
+		},
+		{
+			name:         "compute microversion older than server creation",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","computeMicroversion":"2.53"}`,
+			err:          "invalid compute microversion 2.53: must be at least 2.60",
+		},
+		{
+			name:         "server group settings without server group",
+			providerSpec: `{"flavor":"m1.large","image":"rhcos","serverGroupPolicy":"anti-affinity","serverGroupScope":"MachineSet"}`,
+			warnings:     2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := (&MachineValidator{}).ValidateCreate(context.Background(), machineWithProviderSpec(tt.providerSpec))
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("Expected %d warnings, got %v", tt.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestMachineValidatorValidateUpdate(t *testing.T) {
+	invalid := machineWithProviderSpec(`{"image":"rhcos"}`)
+
+	// Machines whose providerSpec doesn't change can be updated
+	updated := invalid.DeepCopy()
+	updated.Finalizers = nil
+	if _, err := (&MachineValidator{}).ValidateUpdate(context.Background(), invalid, updated); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	updated = machineWithProviderSpec(`{"image":"rhcos-9"}`)
+	if _, err := (&MachineValidator{}).ValidateUpdate(context.Background(), invalid, updated); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestMachineSetValidatorValidateCreate(t *testing.T) {
+	machineSet := &machinev1.MachineSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "openshift-machine-api"},
+		Spec: machinev1.MachineSetSpec{
+			Template: machinev1.MachineTemplateSpec{
+				Spec: machineWithProviderSpec(`{"flavor":"m1.large","image":"rhcos","portDNSName":"{{ .MachineName }}"}`).Spec,
+			},
+		},
+	}
+	if _, err := (&MachineSetValidator{}).ValidateCreate(context.Background(), machineSet); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	machineSet.Spec.Template.Spec = machineWithProviderSpec(`{"flavor":"m1.large","image":"rhcos","serverGroupPolicy":"spread"}`).Spec
+	if _, err := (&MachineSetValidator{}).ValidateCreate(context.Background(), machineSet); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -17,8 +17,20 @@ limitations under the License.
 package version
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// The modules whose versions determine how a providerSpec is converted and
+// how OpenStack is called.
+const (
+	capoModule        = "sigs.k8s.io/cluster-api-provider-openstack"
+	gophercloudModule = "github.com/gophercloud/gophercloud"
 )
 
 var (
@@ -46,3 +58,77 @@ func Get() Info {
 		Platform:     fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
 	}
 }
+
+// Report is the version of the controller together with the versions of the
+// CAPO API and modules it converts machines with, and its feature gates.
+type Report struct {
+	Info
+	CAPOVersion        string          `json:"capoVersion,omitempty"`
+	CAPOAPIVersion     string          `json:"capoAPIVersion,omitempty"`
+	GophercloudVersion string          `json:"gophercloudVersion,omitempty"`
+	FeatureGates       map[string]bool `json:"featureGates,omitempty"`
+}
+
+// NewReport returns the Report of the running binary. The module versions are
+// read from its build information.
+func NewReport(capoAPIVersion string, featureGates map[string]bool) Report {
+	report := Report{
+		Info:           Get(),
+		CAPOAPIVersion: capoAPIVersion,
+		FeatureGates:   featureGates,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		report.CAPOVersion = moduleVersion(info, capoModule)
+		report.GophercloudVersion = moduleVersion(info, gophercloudModule)
+	}
+	return report
+}
+
+// moduleVersion returns the version of a dependency of the binary, including
+// its replacement if it is replaced.
+func moduleVersion(info *debug.BuildInfo, path string) string {
+	for _, dep := range info.Deps {
+		if dep.Path != path {
+			continue
+		}
+		if dep.Replace != nil {
+			return fmt.Sprintf("%s (replaced by %s %s)", dep.Version, dep.Replace.Path, dep.Replace.Version)
+		}
+		return dep.Version
+	}
+	return ""
+}
+
+// String formats the report for the --version flag. The git commit stays on
+// the first line.
+func (r Report) String() string {
+	gates := make([]string, 0, len(r.FeatureGates))
+	for gate, enabled := range r.FeatureGates {
+		gates = append(gates, fmt.Sprintf("%s=%t", gate, enabled))
+	}
+	sort.Strings(gates)
+
+	var b strings.Builder
+	fmt.Fprintln(&b, r.GitCommit)
+	fmt.Fprintf(&b, "CAPO: %s (API %s)\n", orUnknown(r.CAPOVersion), orUnknown(r.CAPOAPIVersion))
+	fmt.Fprintf(&b, "gophercloud: %s\n", orUnknown(r.GophercloudVersion))
+	fmt.Fprintf(&b, "Feature gates: %s", strings.Join(gates, ","))
+	return b.String()
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// Handler serves the report as JSON.
+func Handler(report Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
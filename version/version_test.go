@@ -0,0 +1,64 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+)
+
+func TestModuleVersion(t *testing.T) {
+	info := &debug.BuildInfo{
+		Deps: []*debug.Module{
+			{Path: capoModule, Version: "v0.8.0"},
+			{Path: gophercloudModule, Version: "v1.11.0", Replace: &debug.Module{Path: "github.com/openshift/gophercloud", Version: "v1.11.1"}},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: capoModule, expected: "v0.8.0"},
+		{path: gophercloudModule, expected: "v1.11.0 (replaced by github.com/openshift/gophercloud v1.11.1)"},
+		{path: "example.com/missing", expected: ""},
+	}
+	for _, tt := range tests {
+		if actual := moduleVersion(info, tt.path); actual != tt.expected {
+			t.Errorf("moduleVersion(%s) = %q, expected %q", tt.path, actual, tt.expected)
+		}
+	}
+}
+
+func TestReportString(t *testing.T) {
+	report := Report{
+		Info:           Info{GitCommit: "abc123"},
+		CAPOAPIVersion: "infrastructure.cluster.x-k8s.io/v1alpha7",
+		FeatureGates:   map[string]bool{"MachineAPIMigration": false, "A": true},
+	}
+	expected := "abc123\nCAPO: unknown (API infrastructure.cluster.x-k8s.io/v1alpha7)\ngophercloud: unknown\nFeature gates: A=true,MachineAPIMigration=false"
+	if actual := report.String(); actual != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	report := Report{
+		Info:               Info{GitCommit: "abc123"},
+		GophercloudVersion: "v1.11.0",
+		FeatureGates:       map[string]bool{"MachineAPIMigration": true},
+	}
+	recorder := httptest.NewRecorder()
+	Handler(report).ServeHTTP(recorder, httptest.NewRequest("GET", "/version", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+	var actual Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &actual); err != nil {
+		t.Fatalf("Unexpected error decoding %s: %v", recorder.Body.String(), err)
+	}
+	if actual.GitCommit != "abc123" || actual.GophercloudVersion != "v1.11.0" || !actual.FeatureGates["MachineAPIMigration"] {
+		t.Errorf("Unexpected report %+v", actual)
+	}
+}